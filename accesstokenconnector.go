@@ -6,6 +6,10 @@ import (
 	"context"
 	"database/sql/driver"
 	"errors"
+	"sync"
+	"time"
+
+	"github.com/microsoft/go-mssqldb/msdsn"
 )
 
 // NewAccessTokenConnector creates a new connector from a DSN and a token provider.
@@ -29,3 +33,85 @@ func NewAccessTokenConnector(dsn string, tokenProvider func() (string, error)) (
 
 	return conn, nil
 }
+
+// AccessTokenRequest describes the connection an AccessTokenProvider
+// is asked to provide a token for.
+type AccessTokenRequest struct {
+	// Server is the host the driver is logging in to. After a redirect
+	// to another server, such as an Azure SQL gateway redirect, this is
+	// the new host.
+	Server   string
+	Instance string
+	Port     uint64
+	Database string
+	// PreviousExpiry is the expiry returned with the previous token from
+	// the provider for this connector, or the zero time if there is none.
+	PreviousExpiry time.Time
+}
+
+// AccessToken is an access token returned by an AccessTokenProvider.
+type AccessToken struct {
+	Token string
+	// ExpiresOn is optional. It is passed back to the provider as
+	// AccessTokenRequest.PreviousExpiry for the next connection.
+	ExpiresOn time.Time
+}
+
+// AccessTokenProvider returns an access token for a new connection.
+// The context is the one of the connection attempt and should be used
+// to cancel token acquisition.
+type AccessTokenProvider func(ctx context.Context, req AccessTokenRequest) (AccessToken, error)
+
+// NewAccessTokenProviderConnector creates a new connector from a DSN and a token provider.
+// The token provider is called each time a new connection logs in, with
+// the server and database being connected to. The returned connector may
+// be used with sql.OpenDB.
+func NewAccessTokenProviderConnector(dsn string, tokenProvider AccessTokenProvider) (*Connector, error) {
+	if tokenProvider == nil {
+		return nil, errors.New("mssql: tokenProvider cannot be nil")
+	}
+
+	conn, err := NewConnector(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	conn.fedAuthRequired = true
+	conn.fedAuthLibrary = FedAuthLibrarySecurityToken
+	conn.accessTokenProvider = tokenProvider
+	conn.accessTokenState = &accessTokenState{}
+
+	return conn, nil
+}
+
+// accessTokenState keeps the expiry of the last token returned by an
+// AccessTokenProvider. It is shared by the connections of a connector.
+type accessTokenState struct {
+	mu     sync.Mutex
+	expiry time.Time
+}
+
+// securityToken returns the token for a login to the server in p.
+func (c *Connector) securityToken(ctx context.Context, p msdsn.Config) (string, error) {
+	if c.accessTokenProvider == nil {
+		return c.securityTokenProvider(ctx)
+	}
+	req := AccessTokenRequest{
+		Server:   p.Host,
+		Instance: p.Instance,
+		Port:     p.Port,
+		Database: p.Database,
+	}
+	c.accessTokenState.mu.Lock()
+	req.PreviousExpiry = c.accessTokenState.expiry
+	c.accessTokenState.mu.Unlock()
+
+	token, err := c.accessTokenProvider(ctx, req)
+	if err != nil {
+		return "", err
+	}
+	c.accessTokenState.mu.Lock()
+	c.accessTokenState.expiry = token.ExpiresOn
+	c.accessTokenState.mu.Unlock()
+	return token.Token, nil
+}
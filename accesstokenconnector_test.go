@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"strings"
 	"testing"
+	"time"
 )
 
 func TestNewAccessTokenConnector(t *testing.T) {
@@ -91,3 +92,54 @@ func TestAccessTokenConnectorFailsToConnectIfNoAccessToken(t *testing.T) {
 		t.Fatalf("expected error to contain %q, but got %q", errorText, err)
 	}
 }
+
+func TestAccessTokenProviderConnector(t *testing.T) {
+	if _, err := NewAccessTokenProviderConnector("Server=server.database.windows.net", nil); err == nil {
+		t.Fatal("expected an error for a nil token provider")
+	}
+
+	expiry := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	var requests []AccessTokenRequest
+	tp := func(ctx context.Context, req AccessTokenRequest) (AccessToken, error) {
+		requests = append(requests, req)
+		return AccessToken{Token: "token-" + req.Database, ExpiresOn: expiry}, nil
+	}
+	c, err := NewAccessTokenProviderConnector("Server=server.database.windows.net;Database=db", tp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !c.fedAuthRequired || c.fedAuthLibrary != FedAuthLibrarySecurityToken {
+		t.Fatal("expected the connector to use security token federated authentication")
+	}
+
+	for i := 0; i < 2; i++ {
+		token, err := c.securityToken(context.Background(), c.params)
+		if err != nil || token != "token-db" {
+			t.Fatalf("unexpected results from securityToken: %v, %v", token, err)
+		}
+	}
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 token requests, got %d", len(requests))
+	}
+	if requests[0].Server != "server.database.windows.net" || requests[0].Database != "db" || !requests[0].PreviousExpiry.IsZero() {
+		t.Errorf("unexpected first request %+v", requests[0])
+	}
+	if !requests[1].PreviousExpiry.Equal(expiry) {
+		t.Errorf("expected the previous expiry to be passed to the provider, got %v", requests[1].PreviousExpiry)
+	}
+}
+
+func TestAccessTokenProviderConnectorPassesError(t *testing.T) {
+	errorText := "This is a test"
+	tp := func(ctx context.Context, req AccessTokenRequest) (AccessToken, error) {
+		return AccessToken{}, errors.New(errorText)
+	}
+	c, err := NewAccessTokenProviderConnector("Server=server.database.windows.net;Database=db", tp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = c.securityToken(context.Background(), c.params)
+	if err == nil || err.Error() != errorText {
+		t.Fatalf("expected error %q, but got %v", errorText, err)
+	}
+}
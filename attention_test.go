@@ -0,0 +1,95 @@
+package mssql
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// pipeSession returns a session reading from and writing to the client end
+// of a pipe, and the server end.
+func pipeSession() (*tdsSession, net.Conn) {
+	client, server := net.Pipe()
+	return &tdsSession{
+		buf:    newTdsBuffer(defaultPacketSize, client),
+		conn:   client,
+		logger: optionalLogger{},
+	}, server
+}
+
+// serveAttention reads the attention packet sent on server and, when
+// confirm is set, replies with its confirmation.
+func serveAttention(server net.Conn, confirm bool) {
+	header := make([]byte, 8)
+	if _, err := server.Read(header); err != nil || header[0] != byte(packAttention) {
+		return
+	}
+	if confirm {
+		_, _ = server.Write(attentionReply().Bytes())
+	}
+}
+
+func TestCancelWaitsForAttentionConfirmation(t *testing.T) {
+	sess, server := pipeSession()
+	defer server.Close()
+	go serveAttention(server, true)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	reader := startReading(sess, ctx, outputs{})
+	if _, err := reader.nextToken(); err != context.Canceled {
+		t.Fatalf("got error %v, want context.Canceled", err)
+	}
+}
+
+func TestCancelGivesUpWithoutConfirmation(t *testing.T) {
+	defer func(d time.Duration) { attentionTimeout = d }(attentionTimeout)
+	attentionTimeout = 50 * time.Millisecond
+
+	sess, server := pipeSession()
+	defer server.Close()
+	go serveAttention(server, false)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	reader := startReading(sess, ctx, outputs{})
+	done := make(chan error)
+	go func() {
+		_, err := reader.nextToken()
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		var serverErr ServerError
+		if !errors.As(err, &serverErr) {
+			t.Errorf("got error %v, want a ServerError marking the connection bad", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the wait for the attention confirmation did not end")
+	}
+}
+
+func TestCancelWaitforKeepsPool(t *testing.T) {
+	db, logger := open(t)
+	defer db.Close()
+	defer logger.StopLogging()
+	db.SetMaxOpenConns(1)
+
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), getLatency(t)+200*time.Millisecond)
+		_, err := db.ExecContext(ctx, "WAITFOR DELAY '00:00:20'")
+		cancel()
+		if err != context.DeadlineExceeded {
+			t.Fatalf("got error %v, want context.DeadlineExceeded", err)
+		}
+		var one int
+		if err = db.QueryRow("select 1").Scan(&one); err != nil {
+			t.Fatalf("the pool is unusable after cancelling a WAITFOR: %v", err)
+		}
+	}
+	if n := db.Stats().OpenConnections; n != 1 {
+		t.Errorf("%d connections open, want the one that was cancelled", n)
+	}
+}
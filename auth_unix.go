@@ -12,4 +12,6 @@ func init() {
 	// we set the default authentication provider name here, rather than within each imported package,
 	// to force a known default. Go will order execution of init() calls but it is better to be explicit.
 	integratedauth.DefaultProviderName = "ntlm"
+	// trusted connections use kerberos, the krb5 package must be imported by the application to register it.
+	integratedauth.TrustedConnectionProviderNames = []string{"krb5"}
 }
@@ -15,4 +15,5 @@ func init() {
 	// we set the default authentication provider name here, rather than within each imported package,
 	// to force a known default. Go will order execution of init() calls but it is better to be explicit.
 	integratedauth.DefaultProviderName = "winsspi"
+	integratedauth.TrustedConnectionProviderNames = []string{"winsspi"}
 }
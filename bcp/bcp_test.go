@@ -0,0 +1,226 @@
+package bcp
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	mssql "github.com/microsoft/go-mssqldb"
+)
+
+const testFormat = `14.0
+4
+1       SQLINT              1       4       ""      1     id                ""
+2       SQLNCHAR            2       100     ""      2     name              SQL_Latin1_General_CP1_CI_AS
+3       SQLCHAR             0       0       "\t"    0     skipped           ""
+4       SQLDECIMAL          1       19      "\r\n"  3     "unit price"      ""
+`
+
+func TestReadFormat(t *testing.T) {
+	f, err := ReadFormat(strings.NewReader(testFormat))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Field{
+		{1, SQLInt, 1, 4, "", 1, "id", ""},
+		{2, SQLNChar, 2, 100, "", 2, "name", "SQL_Latin1_General_CP1_CI_AS"},
+		{3, SQLChar, 0, 0, "\t", 0, "skipped", ""},
+		{4, SQLDecimal, 1, 19, "\r\n", 3, "unit price", ""},
+	}
+	if f.Version != "14.0" || !reflect.DeepEqual(f.Fields, want) {
+		t.Fatalf("got %+v", f)
+	}
+
+	var b bytes.Buffer
+	if _, err = f.WriteTo(&b); err != nil {
+		t.Fatal(err)
+	}
+	back, err := ReadFormat(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(back, f) {
+		t.Errorf("round trip got %+v", back)
+	}
+
+	for _, bad := range []string{
+		"14.0",
+		"14.0\n2\n1 SQLINT 0 4 \"\" 1 id \"\"",
+		"14.0\n1\n1 SQLINT 3 4 \"\" 1 id \"\"",
+		"14.0\n1\n1 SQLFOO 0 4 \"\" 1 id \"\"",
+		"14.0\n1\n2 SQLINT 0 4 \"\" 1 id \"\"",
+		"14.0\n1\n1 SQLINT 0 4 \"\" 1 id",
+		"14.0\n1\n1 SQLINT 0 4 \" 1 id \"\"",
+	} {
+		if _, err = ReadFormat(strings.NewReader(bad)); err == nil {
+			t.Errorf("format %q should fail", bad)
+		}
+	}
+}
+
+func TestNativeKnownValues(t *testing.T) {
+	tests := []struct {
+		fld  Field
+		v    interface{}
+		data []byte
+	}{
+		{Field{HostType: SQLInt, PrefixLength: 1}, int64(-2), []byte{4, 0xfe, 0xff, 0xff, 0xff}},
+		{Field{HostType: SQLInt, PrefixLength: 1}, nil, []byte{0xff}},
+		{Field{HostType: SQLSmallInt}, int64(258), []byte{2, 1}},
+		{Field{HostType: SQLBit}, true, []byte{1}},
+		{Field{HostType: SQLNChar, PrefixLength: 2}, "hé", []byte{4, 0, 'h', 0, 0xe9, 0}},
+		{Field{HostType: SQLChar, PrefixLength: 8}, "", []byte{0, 0, 0, 0, 0, 0, 0, 0}},
+		{Field{HostType: SQLChar, Terminator: ","}, "abc", []byte("abc,")},
+		{Field{HostType: SQLMoney}, "-1.5000", []byte{0xff, 0xff, 0xff, 0xff, 0x68, 0xc5, 0xff, 0xff}},
+		{Field{HostType: SQLMoney4}, "2.0000", []byte{0x20, 0x4e, 0, 0}},
+		{Field{HostType: SQLDecimal}, "-12.34", []byte{38, 2, 0, 0xd2, 0x04, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}},
+		{Field{HostType: SQLFlt8}, 1.5, []byte{0, 0, 0, 0, 0, 0, 0xf8, 0x3f}},
+		{Field{HostType: SQLDateTime}, time.Date(1900, 1, 2, 0, 0, 1, 0, time.UTC), []byte{1, 0, 0, 0, 0x2c, 1, 0, 0}},
+		{Field{HostType: SQLDateTim4}, time.Date(1900, 1, 3, 1, 2, 0, 0, time.UTC), []byte{2, 0, 62, 0}},
+		{Field{HostType: SQLDate}, time.Date(1, 1, 2, 0, 0, 0, 0, time.UTC), []byte{1, 0, 0}},
+		{Field{HostType: SQLTime}, time.Date(1, 1, 1, 0, 0, 1, 0, time.UTC), []byte{0x80, 0x96, 0x98, 0, 0}},
+		{
+			Field{HostType: SQLDateTimeOffset},
+			time.Date(1, 1, 2, 1, 0, 0, 100, time.FixedZone("", 60*60)),
+			[]byte{1, 0, 0, 0, 0, 1, 0, 0, 60, 0},
+		},
+	}
+	for _, tst := range tests {
+		f := &Format{Fields: []Field{tst.fld}}
+		var b bytes.Buffer
+		w := NewWriter(&b, f)
+		if err := w.Write([]interface{}{tst.v}); err != nil {
+			t.Errorf("%s %v: %v", tst.fld.HostType, tst.v, err)
+			continue
+		}
+		w.Flush()
+		if !bytes.Equal(b.Bytes(), tst.data) {
+			t.Errorf("%s %v: wrote %x, want %x", tst.fld.HostType, tst.v, b.Bytes(), tst.data)
+		}
+		row, err := NewReader(bytes.NewReader(tst.data), f).Read()
+		if err != nil {
+			t.Errorf("%s %x: %v", tst.fld.HostType, tst.data, err)
+			continue
+		}
+		if got := row[0]; !reflect.DeepEqual(got, tst.v) && !(isTime(got) && got.(time.Time).Equal(tst.v.(time.Time))) {
+			t.Errorf("%s %x: read %#v, want %#v", tst.fld.HostType, tst.data, got, tst.v)
+		}
+	}
+}
+
+func isTime(v interface{}) bool {
+	_, ok := v.(time.Time)
+	return ok
+}
+
+func TestNativeRows(t *testing.T) {
+	f, err := ReadFormat(strings.NewReader(testFormat))
+	if err != nil {
+		t.Fatal(err)
+	}
+	rows := [][]interface{}{
+		{int64(1), "first", "x", "1.50"},
+		{nil, "", "", nil},
+		{int64(3), "δεύτερο", "tab\\", "-0.001"},
+	}
+	var b bytes.Buffer
+	w := NewWriter(&b, f)
+	for _, row := range rows {
+		if err = w.Write(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	r := NewReader(&b, f)
+	for i, want := range rows {
+		got, err := r.Read()
+		if err != nil {
+			t.Fatalf("row %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("row %d: got %#v, want %#v", i, got, want)
+		}
+	}
+	if _, err = r.Read(); err != io.EOF {
+		t.Errorf("got %v after the last row, want io.EOF", err)
+	}
+
+	if err = w.Write([]interface{}{int64(1)}); err == nil {
+		t.Error("a row with missing values should fail")
+	}
+	if err = w.Write([]interface{}{"a", "b", "c", "1"}); err == nil {
+		t.Error("a string for an int field should fail")
+	}
+	if _, err = NewReader(bytes.NewReader([]byte{4, 1, 0}), f).Read(); err == nil {
+		t.Error("a truncated row should fail")
+	}
+}
+
+func TestWriteOutOfRange(t *testing.T) {
+	tests := []struct {
+		fld Field
+		v   interface{}
+	}{
+		{Field{HostType: SQLTinyInt}, int64(256)},
+		{Field{HostType: SQLSmallInt}, int64(-40000)},
+		{Field{HostType: SQLMoney4}, "300000"},
+		{Field{HostType: SQLMoney}, "0.00001"},
+		{Field{HostType: SQLChar, PrefixLength: 1}, strings.Repeat("a", 255)},
+		{Field{HostType: SQLChar, PrefixLength: 2, DataLength: 2}, "abc"},
+		{Field{HostType: SQLChar, DataLength: 4}, "abc"},
+		{Field{HostType: SQLInt}, nil},
+	}
+	for _, tst := range tests {
+		w := NewWriter(io.Discard, &Format{Fields: []Field{tst.fld}})
+		if err := w.Write([]interface{}{tst.v}); err == nil {
+			t.Errorf("writing %v as %+v should fail", tst.v, tst.fld)
+		}
+	}
+}
+
+func TestExporter(t *testing.T) {
+	var b bytes.Buffer
+	e := &exporter{w: &b}
+	err := e.WriteColumns([]mssql.CopyOutColumn{
+		{Name: "id", DatabaseTypeName: "INT"},
+		{Name: "name", DatabaseTypeName: "NVARCHAR", Length: 10, Nullable: true},
+		{Name: "doc", DatabaseTypeName: "NVARCHAR", Length: 1073741822},
+		{Name: "price", DatabaseTypeName: "DECIMAL"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Field{
+		{1, SQLInt, 1, 4, "", 1, "id", ""},
+		{2, SQLNChar, 2, 20, "", 2, "name", ""},
+		{3, SQLNChar, 8, 0, "", 3, "doc", ""},
+		{4, SQLDecimal, 1, 19, "", 4, "price", ""},
+	}
+	if !reflect.DeepEqual(e.format.Fields, want) {
+		t.Errorf("got fields %+v", e.format.Fields)
+	}
+	row := []driver.Value{int64(7), nil, "text", []byte("1.25")}
+	if err = e.WriteRow(row); err != nil {
+		t.Fatal(err)
+	}
+	if err = e.writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	got, err := NewReader(&b, e.format).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, []interface{}{int64(7), nil, "text", "1.25"}) {
+		t.Errorf("got %#v", got)
+	}
+
+	if err = e.WriteColumns([]mssql.CopyOutColumn{{Name: "v", DatabaseTypeName: "SQL_VARIANT"}}); err == nil {
+		t.Error("sql_variant columns should not be supported")
+	}
+}
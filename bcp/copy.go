@@ -0,0 +1,204 @@
+package bcp
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+
+	mssql "github.com/microsoft/go-mssqldb"
+)
+
+// Import copies the rows of the native data file data, described by f,
+// into table with a bulk copy and returns the number of rows copied.
+// Fields with a ServerOrder of zero are skipped, the others are copied into
+// the columns named by their ServerName. The values are encoded by the bulk
+// copy of the driver for the type of each column.
+func Import(ctx context.Context, db *sql.DB, table string, f *Format, data io.Reader, opts mssql.BulkOptions) (int64, error) {
+	var (
+		columns []string
+		indexes []int
+	)
+	for i, fld := range f.Fields {
+		if fld.ServerOrder == 0 {
+			continue
+		}
+		if fld.ServerName == "" {
+			return 0, fmt.Errorf("bcp: field %d has no column name", fld.HostOrder)
+		}
+		columns = append(columns, fld.ServerName)
+		indexes = append(indexes, i)
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	stmt, err := conn.PrepareContext(ctx, mssql.CopyIn(table, opts, columns...))
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+
+	r := NewReader(data, f)
+	values := make([]interface{}, len(indexes))
+	for {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+		for i, j := range indexes {
+			values[i] = row[j]
+		}
+		if _, err = stmt.ExecContext(ctx, values...); err != nil {
+			return 0, err
+		}
+	}
+	res, err := stmt.ExecContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Export writes the rows of query to w in native format and returns the
+// format file describing them, which bcp needs to read the data. The rows
+// are streamed with mssql.CopyOut.
+func Export(ctx context.Context, db *sql.DB, w io.Writer, query string, args ...interface{}) (*Format, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	e := &exporter{w: w}
+	if _, err = mssql.CopyOut(ctx, conn, e, query, args...); err != nil {
+		return nil, err
+	}
+	if e.writer == nil {
+		return nil, errors.New("bcp: query returned no result set")
+	}
+	return e.format, e.writer.Flush()
+}
+
+// exporter is the mssql.RowWriter of Export.
+type exporter struct {
+	w      io.Writer
+	format *Format
+	writer *Writer
+	row    []interface{}
+}
+
+func (e *exporter) WriteColumns(cols []mssql.CopyOutColumn) (err error) {
+	fields := make([]column, len(cols))
+	for i, col := range cols {
+		fields[i] = column{col.Name, col.DatabaseTypeName, col.Length}
+	}
+	if e.format, err = formatOf(fields); err != nil {
+		return err
+	}
+	e.writer = NewWriter(e.w, e.format)
+	e.row = make([]interface{}, len(cols))
+	return nil
+}
+
+func (e *exporter) WriteRow(row []driver.Value) error {
+	for i, v := range row {
+		e.row[i] = v
+	}
+	return e.writer.Write(e.row)
+}
+
+// maxNonLOBLength is the largest size of a character or binary column that
+// is not a large object.
+const maxNonLOBLength = 8000
+
+// FormatOf returns the native format of the columns of a result. Every
+// field has a length prefix, so any of them can be NULL.
+func FormatOf(cols []*sql.ColumnType) (*Format, error) {
+	fields := make([]column, len(cols))
+	for i, col := range cols {
+		length, _ := col.Length()
+		fields[i] = column{col.Name(), col.DatabaseTypeName(), length}
+	}
+	return formatOf(fields)
+}
+
+type column struct {
+	name     string
+	typeName string
+	length   int64
+}
+
+func formatOf(cols []column) (*Format, error) {
+	f := &Format{Version: DefaultVersion}
+	for i, col := range cols {
+		fld := Field{HostOrder: i + 1, ServerOrder: i + 1, ServerName: col.name, PrefixLength: 1}
+		switch col.typeName {
+		case "CHAR", "VARCHAR", "TEXT":
+			fld.HostType = SQLChar
+		case "NCHAR", "NVARCHAR", "NTEXT", "XML":
+			fld.HostType = SQLNChar
+		case "BINARY", "VARBINARY", "IMAGE":
+			fld.HostType = SQLBinary
+		case "BIT":
+			fld.HostType = SQLBit
+		case "TINYINT":
+			fld.HostType = SQLTinyInt
+		case "SMALLINT":
+			fld.HostType = SQLSmallInt
+		case "INT":
+			fld.HostType = SQLInt
+		case "BIGINT":
+			fld.HostType = SQLBigInt
+		case "REAL":
+			fld.HostType = SQLFlt4
+		case "FLOAT":
+			fld.HostType = SQLFlt8
+		case "MONEY":
+			fld.HostType = SQLMoney
+		case "SMALLMONEY":
+			fld.HostType = SQLMoney4
+		case "DECIMAL":
+			fld.HostType = SQLDecimal
+		case "NUMERIC":
+			fld.HostType = SQLNumeric
+		case "DATETIME":
+			fld.HostType = SQLDateTime
+		case "SMALLDATETIME":
+			fld.HostType = SQLDateTim4
+		case "DATE":
+			fld.HostType = SQLDate
+		case "TIME":
+			fld.HostType = SQLTime
+		case "DATETIME2":
+			fld.HostType = SQLDateTime2
+		case "DATETIMEOFFSET":
+			fld.HostType = SQLDateTimeOffset
+		case "UNIQUEIDENTIFIER":
+			fld.HostType = SQLUniqueID
+		default:
+			return nil, fmt.Errorf("bcp: column %s has the unsupported type %s", col.name, col.typeName)
+		}
+		if size := hostTypes[fld.HostType]; size > 0 {
+			fld.DataLength = size
+		} else {
+			length := col.length
+			if fld.HostType == SQLNChar {
+				length *= 2
+			}
+			if length > 0 && length <= maxNonLOBLength {
+				fld.DataLength = int(length)
+				fld.PrefixLength = 2
+			} else {
+				fld.PrefixLength = 8
+			}
+		}
+		f.Fields = append(f.Fields, fld)
+	}
+	return f, nil
+}
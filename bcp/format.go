@@ -0,0 +1,233 @@
+// Package bcp reads and writes the native format data files and the
+// non-XML format files of the bcp utility, so bcp pipelines and Go programs
+// can exchange data.
+//
+// A native data file is a sequence of rows, each one made of the fields
+// described by a format file. Every field has a host data type, an
+// optional length prefix and an optional terminator. Reader decodes the
+// fields into the Go values the bulk copy of the driver accepts, and Import
+// loads a data file into a table with a bulk copy. Writer encodes rows in
+// the same format, and Export writes the result of a query along with the
+// format file describing it.
+package bcp
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Host data types of the fields of a format file.
+const (
+	SQLChar           = "SQLCHAR"
+	SQLVaryChar       = "SQLVARYCHAR"
+	SQLNChar          = "SQLNCHAR"
+	SQLNVarChar       = "SQLNVARCHAR"
+	SQLBinary         = "SQLBINARY"
+	SQLVaryBin        = "SQLVARYBIN"
+	SQLBit            = "SQLBIT"
+	SQLTinyInt        = "SQLTINYINT"
+	SQLSmallInt       = "SQLSMALLINT"
+	SQLInt            = "SQLINT"
+	SQLBigInt         = "SQLBIGINT"
+	SQLFlt4           = "SQLFLT4"
+	SQLFlt8           = "SQLFLT8"
+	SQLMoney          = "SQLMONEY"
+	SQLMoney4         = "SQLMONEY4"
+	SQLDecimal        = "SQLDECIMAL"
+	SQLNumeric        = "SQLNUMERIC"
+	SQLDateTime       = "SQLDATETIME"
+	SQLDateTim4       = "SQLDATETIM4"
+	SQLDate           = "SQLDATE"
+	SQLTime           = "SQLTIME"
+	SQLDateTime2      = "SQLDATETIME2"
+	SQLDateTimeOffset = "SQLDATETIMEOFFSET"
+	SQLUniqueID       = "SQLUNIQUEID"
+)
+
+// DefaultVersion is the version written in the format files of Export.
+const DefaultVersion = "14.0"
+
+// Format is a non-XML format file.
+type Format struct {
+	// Version is the version of the bcp utility the file is meant for.
+	Version string
+	Fields  []Field
+}
+
+// Field describes a field of the rows of a data file.
+type Field struct {
+	// HostOrder is the position of the field in the row, starting at 1.
+	HostOrder int
+	// HostType is the host data type of the field, such as SQLINT.
+	HostType string
+	// PrefixLength is the size of the length prefix of the field, 0, 1, 2,
+	// 4 or 8 bytes. A prefix of all one bits stands for NULL.
+	PrefixLength int
+	// DataLength is the size of the field without a prefix or terminator.
+	// Zero means no limit for character and binary fields.
+	DataLength int
+	// Terminator, when not empty, ends the field in the data file.
+	Terminator string
+	// ServerOrder is the position of the table column the field is
+	// imported into, starting at 1. Zero skips the field.
+	ServerOrder int
+	// ServerName is the name of the table column.
+	ServerName string
+	// Collation is the collation of character fields.
+	Collation string
+}
+
+// ReadFormat reads a non-XML format file.
+func ReadFormat(r io.Reader) (*Format, error) {
+	s := bufio.NewScanner(r)
+	var lines []string
+	for s.Scan() {
+		if line := strings.TrimSpace(s.Text()); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	if len(lines) < 2 {
+		return nil, errors.New("bcp: format file needs a version and a number of fields")
+	}
+	f := &Format{Version: lines[0]}
+	n, err := strconv.Atoi(lines[1])
+	if err != nil || n < 0 {
+		return nil, fmt.Errorf("bcp: invalid number of fields %q", lines[1])
+	}
+	if len(lines)-2 != n {
+		return nil, fmt.Errorf("bcp: format file declares %d fields but describes %d", n, len(lines)-2)
+	}
+	for i, line := range lines[2:] {
+		fld, err := parseField(line)
+		if err != nil {
+			return nil, fmt.Errorf("bcp: field %d: %v", i+1, err)
+		}
+		if fld.HostOrder != i+1 {
+			return nil, fmt.Errorf("bcp: field %d has host order %d", i+1, fld.HostOrder)
+		}
+		f.Fields = append(f.Fields, fld)
+	}
+	return f, nil
+}
+
+func parseField(line string) (fld Field, err error) {
+	tokens, err := splitFieldLine(line)
+	if err != nil {
+		return fld, err
+	}
+	if len(tokens) != 8 {
+		return fld, fmt.Errorf("expected 8 columns, got %d", len(tokens))
+	}
+	ints := []*int{&fld.HostOrder, nil, &fld.PrefixLength, &fld.DataLength, nil, &fld.ServerOrder}
+	for i, p := range ints {
+		if p == nil {
+			continue
+		}
+		if *p, err = strconv.Atoi(tokens[i]); err != nil || *p < 0 {
+			return fld, fmt.Errorf("invalid number %q", tokens[i])
+		}
+	}
+	switch fld.PrefixLength {
+	case 0, 1, 2, 4, 8:
+	default:
+		return fld, fmt.Errorf("invalid prefix length %d", fld.PrefixLength)
+	}
+	fld.HostType = strings.ToUpper(tokens[1])
+	if _, ok := hostTypes[fld.HostType]; !ok {
+		return fld, fmt.Errorf("unsupported host data type %s", tokens[1])
+	}
+	fld.Terminator = tokens[4]
+	fld.ServerName = tokens[6]
+	fld.Collation = tokens[7]
+	return fld, nil
+}
+
+// splitFieldLine splits a field line on white space. Quoted tokens can
+// hold white space and the escapes \t, \n, \r, \0, \\ and \".
+func splitFieldLine(line string) ([]string, error) {
+	var tokens []string
+	for i := 0; i < len(line); {
+		switch c := line[i]; {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '"':
+			var b strings.Builder
+			i++
+			for {
+				if i >= len(line) {
+					return nil, errors.New("unterminated quoted string")
+				}
+				c = line[i]
+				i++
+				if c == '"' {
+					break
+				}
+				if c == '\\' && i < len(line) {
+					switch line[i] {
+					case 't':
+						c = '\t'
+					case 'n':
+						c = '\n'
+					case 'r':
+						c = '\r'
+					case '0':
+						c = 0
+					case '\\', '"':
+						c = line[i]
+					default:
+						b.WriteByte('\\')
+						continue
+					}
+					i++
+				}
+				b.WriteByte(c)
+			}
+			tokens = append(tokens, b.String())
+		default:
+			j := i
+			for j < len(line) && line[j] != ' ' && line[j] != '\t' {
+				j++
+			}
+			tokens = append(tokens, line[i:j])
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+// WriteTo writes f as a non-XML format file.
+func (f *Format) WriteTo(w io.Writer) (int64, error) {
+	var b strings.Builder
+	b.WriteString(f.Version + "\r\n")
+	b.WriteString(strconv.Itoa(len(f.Fields)) + "\r\n")
+	for _, fld := range f.Fields {
+		collation := fld.Collation
+		if collation == "" {
+			collation = `""`
+		}
+		fmt.Fprintf(&b, "%-8d%-20s%-8d%-8d%-8s%-6d%-30s%s\r\n",
+			fld.HostOrder, fld.HostType, fld.PrefixLength, fld.DataLength,
+			quoteTerminator(fld.Terminator), fld.ServerOrder, quoteName(fld.ServerName), collation)
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err
+}
+
+func quoteTerminator(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\t", `\t`, "\n", `\n`, "\r", `\r`, "\x00", `\0`)
+	return `"` + r.Replace(s) + `"`
+}
+
+func quoteName(s string) string {
+	if s == "" || strings.ContainsAny(s, " \t\"") {
+		return quoteTerminator(s)
+	}
+	return s
+}
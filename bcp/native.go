@@ -0,0 +1,701 @@
+package bcp
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// hostTypes maps the supported host data types to their size, zero for
+// character and binary types whose size comes from the field.
+var hostTypes = map[string]int{
+	SQLChar:           0,
+	SQLVaryChar:       0,
+	SQLNChar:          0,
+	SQLNVarChar:       0,
+	SQLBinary:         0,
+	SQLVaryBin:        0,
+	SQLBit:            1,
+	SQLTinyInt:        1,
+	SQLSmallInt:       2,
+	SQLInt:            4,
+	SQLBigInt:         8,
+	SQLFlt4:           4,
+	SQLFlt8:           8,
+	SQLMoney:          8,
+	SQLMoney4:         4,
+	SQLDecimal:        19,
+	SQLNumeric:        19,
+	SQLDateTime:       8,
+	SQLDateTim4:       4,
+	SQLDate:           3,
+	SQLTime:           5,
+	SQLDateTime2:      8,
+	SQLDateTimeOffset: 10,
+	SQLUniqueID:       16,
+}
+
+func isUnicode(hostType string) bool {
+	return hostType == SQLNChar || hostType == SQLNVarChar
+}
+
+// terminator returns the bytes of the terminator of fld in the data file,
+// UTF-16 for Unicode fields.
+func terminator(fld Field) []byte {
+	if !isUnicode(fld.HostType) {
+		return []byte(fld.Terminator)
+	}
+	return encodeUTF16(fld.Terminator)
+}
+
+// Reader reads the rows of a data file.
+type Reader struct {
+	r      *bufio.Reader
+	format *Format
+	row    int
+}
+
+// NewReader returns a Reader of the rows of r described by f.
+func NewReader(r io.Reader, f *Format) *Reader {
+	return &Reader{r: bufio.NewReader(r), format: f}
+}
+
+// Read returns the values of the next row, one per field, or io.EOF after
+// the last row. NULL fields are nil. Character fields are strings, binary
+// and uniqueidentifier fields are []byte, integers are int64, floats are
+// float64, bits are bool, money and decimal fields are strings, and date
+// and time fields are time.Time values, in UTC unless they have an offset.
+//
+// Date and time fields do not record their scale, it is deduced from
+// their size: time fields of 3, 4 and 5 bytes have a scale of 2, 4 and 7.
+func (r *Reader) Read() ([]interface{}, error) {
+	if _, err := r.r.Peek(1); err != nil {
+		return nil, err
+	}
+	r.row++
+	row := make([]interface{}, len(r.format.Fields))
+	for i, fld := range r.format.Fields {
+		v, err := r.readField(fld)
+		if err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, fmt.Errorf("bcp: row %d, field %d: %v", r.row, fld.HostOrder, err)
+		}
+		row[i] = v
+	}
+	return row, nil
+}
+
+func (r *Reader) readField(fld Field) (interface{}, error) {
+	var data []byte
+	term := terminator(fld)
+	switch {
+	case fld.PrefixLength > 0:
+		prefix := make([]byte, fld.PrefixLength)
+		if _, err := io.ReadFull(r.r, prefix); err != nil {
+			return nil, err
+		}
+		n, null := decodePrefix(prefix)
+		if null {
+			return nil, r.skipTerminator(term)
+		}
+		if fld.DataLength > 0 && n > uint64(fld.DataLength) {
+			return nil, fmt.Errorf("length %d above the field length %d", n, fld.DataLength)
+		}
+		if n > math.MaxInt32 {
+			return nil, fmt.Errorf("length %d is too large", n)
+		}
+		data = make([]byte, n)
+		if _, err := io.ReadFull(r.r, data); err != nil {
+			return nil, err
+		}
+	case len(term) > 0 && hostTypes[fld.HostType] == 0:
+		var err error
+		if data, err = r.readUntil(term, isUnicode(fld.HostType)); err != nil {
+			return nil, err
+		}
+		return decodeValue(fld, data)
+	default:
+		size := hostTypes[fld.HostType]
+		if size == 0 || fld.DataLength > 0 {
+			size = fld.DataLength
+		}
+		if size == 0 {
+			return nil, errors.New("field has no prefix, length or terminator")
+		}
+		data = make([]byte, size)
+		if _, err := io.ReadFull(r.r, data); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.skipTerminator(term); err != nil {
+		return nil, err
+	}
+	return decodeValue(fld, data)
+}
+
+// readUntil reads up to term, which starts on a character boundary.
+func (r *Reader) readUntil(term []byte, unicode bool) ([]byte, error) {
+	var data []byte
+	for {
+		c, err := r.r.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		data = append(data, c)
+		if bytes.HasSuffix(data, term) && (!unicode || len(data)%2 == 0) {
+			return data[:len(data)-len(term)], nil
+		}
+	}
+}
+
+func (r *Reader) skipTerminator(term []byte) error {
+	if len(term) == 0 {
+		return nil
+	}
+	b := make([]byte, len(term))
+	if _, err := io.ReadFull(r.r, b); err != nil {
+		return err
+	}
+	if !bytes.Equal(b, term) {
+		return fmt.Errorf("expected terminator %q, got %q", term, b)
+	}
+	return nil
+}
+
+func decodePrefix(b []byte) (n uint64, null bool) {
+	null = true
+	for i := len(b) - 1; i >= 0; i-- {
+		n = n<<8 | uint64(b[i])
+		null = null && b[i] == 0xff
+	}
+	return n, null
+}
+
+func decodeValue(fld Field, b []byte) (interface{}, error) {
+	if size := hostTypes[fld.HostType]; size > 0 && len(b) != size && !variableSize(fld.HostType) {
+		return nil, fmt.Errorf("%s needs %d bytes, got %d", fld.HostType, size, len(b))
+	}
+	switch fld.HostType {
+	case SQLChar, SQLVaryChar:
+		return string(b), nil
+	case SQLNChar, SQLNVarChar:
+		return decodeUTF16(b)
+	case SQLBinary, SQLVaryBin, SQLUniqueID:
+		return b, nil
+	case SQLBit:
+		return b[0] != 0, nil
+	case SQLTinyInt:
+		return int64(b[0]), nil
+	case SQLSmallInt:
+		return int64(int16(binary.LittleEndian.Uint16(b))), nil
+	case SQLInt:
+		return int64(int32(binary.LittleEndian.Uint32(b))), nil
+	case SQLBigInt:
+		return int64(binary.LittleEndian.Uint64(b)), nil
+	case SQLFlt4:
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))), nil
+	case SQLFlt8:
+		return math.Float64frombits(binary.LittleEndian.Uint64(b)), nil
+	case SQLMoney:
+		v := int64(binary.LittleEndian.Uint32(b))<<32 | int64(binary.LittleEndian.Uint32(b[4:]))
+		return formatScaled(big.NewInt(v), 4), nil
+	case SQLMoney4:
+		return formatScaled(big.NewInt(int64(int32(binary.LittleEndian.Uint32(b)))), 4), nil
+	case SQLDecimal, SQLNumeric:
+		return decodeDecimal(b)
+	case SQLDateTime:
+		days := int32(binary.LittleEndian.Uint32(b))
+		ticks := binary.LittleEndian.Uint32(b[4:])
+		ns := int64(ticks) * 10000000 / 3
+		return time.Date(1900, 1, 1+int(days), 0, 0, 0, 0, time.UTC).Add(time.Duration(ns)), nil
+	case SQLDateTim4:
+		days := binary.LittleEndian.Uint16(b)
+		mins := binary.LittleEndian.Uint16(b[2:])
+		return time.Date(1900, 1, 1+int(days), 0, int(mins), 0, 0, time.UTC), nil
+	case SQLDate:
+		return decodeDate(b), nil
+	case SQLTime:
+		return decodeTime(b)
+	case SQLDateTime2:
+		if len(b) < 6 {
+			return nil, fmt.Errorf("invalid datetime2 size %d", len(b))
+		}
+		t, err := decodeTime(b[:len(b)-3])
+		if err != nil {
+			return nil, err
+		}
+		d := decodeDate(b[len(b)-3:])
+		return d.Add(t.Sub(time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC))), nil
+	case SQLDateTimeOffset:
+		if len(b) < 8 {
+			return nil, fmt.Errorf("invalid datetimeoffset size %d", len(b))
+		}
+		offset := int(int16(binary.LittleEndian.Uint16(b[len(b)-2:])))
+		t, err := decodeValue(Field{HostType: SQLDateTime2}, b[:len(b)-2])
+		if err != nil {
+			return nil, err
+		}
+		return t.(time.Time).In(time.FixedZone("", offset*60)), nil
+	}
+	return nil, fmt.Errorf("unsupported host data type %s", fld.HostType)
+}
+
+// variableSize reports whether the size of fields of hostType depends on
+// their scale.
+func variableSize(hostType string) bool {
+	switch hostType {
+	case SQLTime, SQLDateTime2, SQLDateTimeOffset:
+		return true
+	}
+	return false
+}
+
+func decodeUTF16(b []byte) (string, error) {
+	if len(b)%2 != 0 {
+		return "", errors.New("odd number of bytes in a Unicode field")
+	}
+	s := make([]uint16, len(b)/2)
+	for i := range s {
+		s[i] = binary.LittleEndian.Uint16(b[2*i:])
+	}
+	return string(utf16.Decode(s)), nil
+}
+
+func encodeUTF16(s string) []byte {
+	u := utf16.Encode([]rune(s))
+	b := make([]byte, 2*len(u))
+	for i, c := range u {
+		binary.LittleEndian.PutUint16(b[2*i:], c)
+	}
+	return b
+}
+
+// decodeDecimal reads a DBDECIMAL: precision, scale, sign (1 for positive)
+// and a 16 byte little endian magnitude.
+func decodeDecimal(b []byte) (string, error) {
+	scale := int(b[1])
+	if scale > 38 {
+		return "", fmt.Errorf("invalid decimal scale %d", scale)
+	}
+	mag := make([]byte, 16)
+	for i := range mag {
+		mag[i] = b[18-i]
+	}
+	v := new(big.Int).SetBytes(mag)
+	if b[2] == 0 {
+		v.Neg(v)
+	}
+	return formatScaled(v, scale), nil
+}
+
+// formatScaled formats v divided by 10^scale.
+func formatScaled(v *big.Int, scale int) string {
+	s := new(big.Int).Abs(v).String()
+	if scale > 0 {
+		if len(s) <= scale {
+			s = strings.Repeat("0", scale-len(s)+1) + s
+		}
+		s = s[:len(s)-scale] + "." + s[len(s)-scale:]
+	}
+	if v.Sign() < 0 {
+		s = "-" + s
+	}
+	return s
+}
+
+func decodeDate(b []byte) time.Time {
+	days := int(b[0]) | int(b[1])<<8 | int(b[2])<<16
+	return time.Date(1, 1, 1+days, 0, 0, 0, 0, time.UTC)
+}
+
+// timeScale returns the scale of time values stored in size bytes.
+func timeScale(size int) (int, error) {
+	switch size {
+	case 3:
+		return 2, nil
+	case 4:
+		return 4, nil
+	case 5:
+		return 7, nil
+	}
+	return 0, fmt.Errorf("invalid time size %d", size)
+}
+
+func decodeTime(b []byte) (time.Time, error) {
+	scale, err := timeScale(len(b))
+	if err != nil {
+		return time.Time{}, err
+	}
+	var v uint64
+	for i := len(b) - 1; i >= 0; i-- {
+		v = v<<8 | uint64(b[i])
+	}
+	ns := v * uint64(math.Pow10(9-scale))
+	return time.Date(1, 1, 1, 0, 0, 0, 0, time.UTC).Add(time.Duration(ns)), nil
+}
+
+// Writer writes rows to a data file.
+type Writer struct {
+	w      *bufio.Writer
+	format *Format
+}
+
+// NewWriter returns a Writer of rows described by f to w. Call Flush once
+// every row is written.
+func NewWriter(w io.Writer, f *Format) *Writer {
+	return &Writer{w: bufio.NewWriter(w), format: f}
+}
+
+// Write writes a row, one value per field. It accepts the values returned
+// by Reader.Read as well as other integer and float types, strings and
+// []byte for decimal and money fields, and []byte for character fields.
+func (w *Writer) Write(row []interface{}) error {
+	if len(row) != len(w.format.Fields) {
+		return fmt.Errorf("bcp: row has %d values for %d fields", len(row), len(w.format.Fields))
+	}
+	for i, fld := range w.format.Fields {
+		if err := w.writeField(fld, row[i]); err != nil {
+			return fmt.Errorf("bcp: field %d: %v", fld.HostOrder, err)
+		}
+	}
+	return nil
+}
+
+// Flush writes the buffered rows to the underlying writer.
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+func (w *Writer) writeField(fld Field, v interface{}) error {
+	var data []byte
+	if v != nil {
+		var err error
+		if data, err = encodeValue(fld, v); err != nil {
+			return err
+		}
+		if fld.DataLength > 0 && len(data) > fld.DataLength {
+			return fmt.Errorf("%d bytes above the field length %d", len(data), fld.DataLength)
+		}
+	}
+	switch {
+	case fld.PrefixLength > 0:
+		prefix := make([]byte, fld.PrefixLength)
+		if v == nil {
+			for i := range prefix {
+				prefix[i] = 0xff
+			}
+		} else {
+			n := uint64(len(data))
+			if fld.PrefixLength < 8 && n >= 1<<(8*uint(fld.PrefixLength))-1 {
+				return fmt.Errorf("%d bytes do not fit a %d byte prefix", n, fld.PrefixLength)
+			}
+			for i := range prefix {
+				prefix[i] = byte(n >> (8 * uint(i)))
+			}
+		}
+		w.w.Write(prefix)
+	case v == nil:
+		return errors.New("NULL needs a length prefix")
+	case len(fld.Terminator) == 0 && len(data) != fld.DataLength && hostTypes[fld.HostType] == 0:
+		return fmt.Errorf("%d bytes for a fixed length field of %d bytes", len(data), fld.DataLength)
+	}
+	w.w.Write(data)
+	_, err := w.w.Write(terminator(fld))
+	return err
+}
+
+func encodeValue(fld Field, v interface{}) ([]byte, error) {
+	switch fld.HostType {
+	case SQLChar, SQLVaryChar, SQLBinary, SQLVaryBin, SQLUniqueID:
+		switch v := v.(type) {
+		case string:
+			return []byte(v), nil
+		case []byte:
+			return v, nil
+		}
+	case SQLNChar, SQLNVarChar:
+		switch v := v.(type) {
+		case string:
+			return encodeUTF16(v), nil
+		case []byte:
+			return encodeUTF16(string(v)), nil
+		}
+	case SQLBit:
+		if b, ok := v.(bool); ok {
+			if b {
+				return []byte{1}, nil
+			}
+			return []byte{0}, nil
+		}
+	case SQLTinyInt, SQLSmallInt, SQLInt, SQLBigInt:
+		i, ok := toInt64(v)
+		if !ok {
+			break
+		}
+		var min, max int64 = math.MinInt64, math.MaxInt64
+		switch fld.HostType {
+		case SQLTinyInt:
+			min, max = 0, math.MaxUint8
+		case SQLSmallInt:
+			min, max = math.MinInt16, math.MaxInt16
+		case SQLInt:
+			min, max = math.MinInt32, math.MaxInt32
+		}
+		if i < min || i > max {
+			return nil, fmt.Errorf("%d is out of range for %s", i, fld.HostType)
+		}
+		size := hostTypes[fld.HostType]
+		b := make([]byte, 8)
+		binary.LittleEndian.PutUint64(b, uint64(i))
+		return b[:size], nil
+	case SQLFlt4, SQLFlt8:
+		f, ok := toFloat64(v)
+		if !ok {
+			break
+		}
+		if fld.HostType == SQLFlt4 {
+			b := make([]byte, 4)
+			binary.LittleEndian.PutUint32(b, math.Float32bits(float32(f)))
+			return b, nil
+		}
+		b := make([]byte, 8)
+		binary.LittleEndian.PutUint64(b, math.Float64bits(f))
+		return b, nil
+	case SQLMoney, SQLMoney4:
+		c, err := scaledValue(v, 4)
+		if err != nil {
+			return nil, err
+		}
+		if !c.IsInt64() {
+			return nil, fmt.Errorf("%v is out of range for %s", v, fld.HostType)
+		}
+		i := c.Int64()
+		if fld.HostType == SQLMoney4 {
+			if i < math.MinInt32 || i > math.MaxInt32 {
+				return nil, fmt.Errorf("%v is out of range for %s", v, fld.HostType)
+			}
+			b := make([]byte, 4)
+			binary.LittleEndian.PutUint32(b, uint32(i))
+			return b, nil
+		}
+		b := make([]byte, 8)
+		binary.LittleEndian.PutUint32(b, uint32(uint64(i)>>32))
+		binary.LittleEndian.PutUint32(b[4:], uint32(i))
+		return b, nil
+	case SQLDecimal, SQLNumeric:
+		return encodeDecimal(v)
+	case SQLDateTime, SQLDateTim4, SQLDate, SQLTime, SQLDateTime2, SQLDateTimeOffset:
+		if t, ok := v.(time.Time); ok {
+			return encodeTime(fld, t)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported host data type %s", fld.HostType)
+	}
+	return nil, fmt.Errorf("cannot write %T as %s", v, fld.HostType)
+}
+
+func toInt64(v interface{}) (int64, bool) {
+	switch v := v.(type) {
+	case int64:
+		return v, true
+	case int:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case uint8:
+		return int64(v), true
+	case bool:
+		if v {
+			return 1, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+func toFloat64(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	}
+	if i, ok := toInt64(v); ok {
+		return float64(i), true
+	}
+	return 0, false
+}
+
+// parseDecimal returns the coefficient and the scale of the decimal in s.
+func parseDecimal(s string) (*big.Int, int, error) {
+	s = strings.TrimSpace(s)
+	digits, scale := s, 0
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		digits = s[:i] + s[i+1:]
+		scale = len(s) - i - 1
+	}
+	c, ok := new(big.Int).SetString(digits, 10)
+	if !ok || scale > 38 {
+		return nil, 0, fmt.Errorf("invalid decimal %q", s)
+	}
+	return c, scale, nil
+}
+
+// scaledValue returns v multiplied by 10^scale, failing when v has more
+// decimal places.
+func scaledValue(v interface{}, scale int) (*big.Int, error) {
+	s, err := decimalString(v)
+	if err != nil {
+		return nil, err
+	}
+	c, sc, err := parseDecimal(s)
+	if err != nil {
+		return nil, err
+	}
+	if sc > scale {
+		return nil, fmt.Errorf("%s has more than %d decimal places", s, scale)
+	}
+	return c.Mul(c, new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(scale-sc)), nil)), nil
+}
+
+// decimalString returns the decimal representation of v.
+func decimalString(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return string(v), nil
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'f', -1, 32), nil
+	}
+	i, ok := toInt64(v)
+	if !ok {
+		return "", fmt.Errorf("cannot write %T as a decimal", v)
+	}
+	return strconv.FormatInt(i, 10), nil
+}
+
+func encodeDecimal(v interface{}) ([]byte, error) {
+	s, err := decimalString(v)
+	if err != nil {
+		return nil, err
+	}
+	c, scale, err := parseDecimal(s)
+	if err != nil {
+		return nil, err
+	}
+	mag := new(big.Int).Abs(c).Bytes()
+	if len(mag) > 16 || len(new(big.Int).Abs(c).String()) > 38 {
+		return nil, fmt.Errorf("%s is out of range for a decimal", s)
+	}
+	b := make([]byte, 19)
+	b[0] = 38
+	b[1] = byte(scale)
+	if c.Sign() >= 0 {
+		b[2] = 1
+	}
+	for i, j := 3, len(mag)-1; j >= 0; i, j = i+1, j-1 {
+		b[i] = mag[j]
+	}
+	return b, nil
+}
+
+func encodeTime(fld Field, t time.Time) ([]byte, error) {
+	switch fld.HostType {
+	case SQLDateTime:
+		days := daysSince(t, 1900)
+		if days < math.MinInt32 || days > math.MaxInt32 {
+			return nil, fmt.Errorf("%v is out of range for %s", t, fld.HostType)
+		}
+		ns := int64(t.Hour())*int64(time.Hour) + int64(t.Minute())*int64(time.Minute) +
+			int64(t.Second())*int64(time.Second) + int64(t.Nanosecond())
+		// 1/300 of a second, rounded
+		ticks := (ns*3/int64(time.Millisecond) + 5) / 10
+		b := make([]byte, 8)
+		binary.LittleEndian.PutUint32(b, uint32(int32(days)))
+		binary.LittleEndian.PutUint32(b[4:], uint32(ticks))
+		return b, nil
+	case SQLDateTim4:
+		days := daysSince(t, 1900)
+		if days < 0 || days > math.MaxUint16 {
+			return nil, fmt.Errorf("%v is out of range for %s", t, fld.HostType)
+		}
+		b := make([]byte, 4)
+		binary.LittleEndian.PutUint16(b, uint16(days))
+		binary.LittleEndian.PutUint16(b[2:], uint16(t.Hour()*60+t.Minute()))
+		return b, nil
+	case SQLDate:
+		return encodeDate(t), nil
+	case SQLTime:
+		return encodeClock(t, fieldTimeSize(fld, 5))
+	case SQLDateTime2:
+		b, err := encodeClock(t, fieldTimeSize(fld, 8)-3)
+		if err != nil {
+			return nil, err
+		}
+		return append(b, encodeDate(t)...), nil
+	case SQLDateTimeOffset:
+		_, offset := t.Zone()
+		u := t.UTC()
+		b, err := encodeClock(u, fieldTimeSize(fld, 10)-5)
+		if err != nil {
+			return nil, err
+		}
+		b = append(b, encodeDate(u)...)
+		return append(b, byte(offset/60), byte((offset/60)>>8)), nil
+	}
+	return nil, fmt.Errorf("cannot write time.Time as %s", fld.HostType)
+}
+
+// fieldTimeSize returns the data length of fld, or def when the field has
+// none.
+func fieldTimeSize(fld Field, def int) int {
+	if fld.DataLength > 0 {
+		return fld.DataLength
+	}
+	return def
+}
+
+// daysSince returns the number of days from January 1 of year to the
+// date of t.
+func daysSince(t time.Time, year int) int64 {
+	u := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	return (u.Unix() - time.Date(year, 1, 1, 0, 0, 0, 0, time.UTC).Unix()) / (24 * 60 * 60)
+}
+
+func encodeDate(t time.Time) []byte {
+	days := daysSince(t, 1)
+	return []byte{byte(days), byte(days >> 8), byte(days >> 16)}
+}
+
+func encodeClock(t time.Time, size int) ([]byte, error) {
+	scale, err := timeScale(size)
+	if err != nil {
+		return nil, err
+	}
+	ns := uint64(t.Hour())*uint64(time.Hour) + uint64(t.Minute())*uint64(time.Minute) +
+		uint64(t.Second())*uint64(time.Second) + uint64(t.Nanosecond())
+	v := ns / uint64(math.Pow10(9-scale))
+	b := make([]byte, size)
+	for i := range b {
+		b[i] = byte(v >> (8 * uint(i)))
+	}
+	return b, nil
+}
@@ -0,0 +1,91 @@
+package mssql
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/microsoft/go-mssqldb/msdsn"
+)
+
+// browserCacheKey identifies the instance data returned by the SQL Server
+// Browser of a host for an instance.
+type browserCacheKey struct {
+	host     string
+	instance string
+	msg      msdsn.BrowserMsg
+}
+
+type browserCacheEntry struct {
+	data    msdsn.BrowserData
+	expires time.Time
+}
+
+// browserCache holds the instance data returned by the SQL Server Browser,
+// shared by the connections with a positive msdsn.Config.BrowserCacheTTL.
+type browserCache struct {
+	mu      sync.Mutex
+	entries map[browserCacheKey]browserCacheEntry
+}
+
+var instanceCache = &browserCache{entries: make(map[browserCacheKey]browserCacheEntry)}
+
+func newBrowserCacheKey(p *msdsn.Config) browserCacheKey {
+	return browserCacheKey{
+		host:     strings.ToLower(p.Host),
+		instance: strings.ToUpper(p.Instance),
+		msg:      p.BrowserMessage,
+	}
+}
+
+// get returns the data cached for key when it has not expired at now.
+func (b *browserCache) get(key browserCacheKey, now time.Time) (msdsn.BrowserData, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e, ok := b.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !now.Before(e.expires) {
+		delete(b.entries, key)
+		return nil, false
+	}
+	return e.data, true
+}
+
+func (b *browserCache) put(key browserCacheKey, data msdsn.BrowserData, expires time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.entries[key] = browserCacheEntry{data: data, expires: expires}
+}
+
+func (b *browserCache) remove(key browserCacheKey) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	delete(b.entries, key)
+}
+
+// browserData returns the instance data of the SQL Server Browser for the
+// instance of p. It is taken from the cache, with cached set, while the
+// data queried earlier is younger than p.BrowserCacheTTL. Otherwise the
+// browser is queried and, when it answers, its data is cached.
+func (c *Connector) browserData(ctx context.Context, p *msdsn.Config, logger ContextLogger) (data msdsn.BrowserData, cached bool) {
+	key := newBrowserCacheKey(p)
+	if p.BrowserCacheTTL > 0 {
+		if data, ok := instanceCache.get(key, time.Now()); ok {
+			return data, true
+		}
+	}
+	d := c.getDialer(p)
+	data, err := getInstances(ctx, d, c.browserHost(ctx, p.Host), p.BrowserMessage, p.Instance)
+	if err != nil && logger != nil && uint64(p.LogFlags)&logErrors != 0 {
+		e := fmt.Sprintf("unable to get instances from Sql Server Browser on host %v: %v", p.Host, err.Error())
+		logger.Log(ctx, msdsn.Log(logErrors), e)
+	}
+	if p.BrowserCacheTTL > 0 && len(data) > 0 {
+		instanceCache.put(key, data, time.Now().Add(p.BrowserCacheTTL))
+	}
+	return data, false
+}
@@ -0,0 +1,88 @@
+package mssql
+
+import (
+	"context"
+	"errors"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/microsoft/go-mssqldb/msdsn"
+)
+
+func TestBrowserCache(t *testing.T) {
+	b := &browserCache{entries: make(map[browserCacheKey]browserCacheEntry)}
+	key := newBrowserCacheKey(&msdsn.Config{Host: "SQL1", Instance: "inst"})
+	if key != newBrowserCacheKey(&msdsn.Config{Host: "sql1", Instance: "INST"}) {
+		t.Error("the key depends on the case of the host and instance")
+	}
+	now := time.Now()
+	data := msdsn.BrowserData{"INST": {"InstanceName": "INST", "tcp": "50000"}}
+	b.put(key, data, now.Add(time.Minute))
+	if got, ok := b.get(key, now); !ok || !reflect.DeepEqual(got, data) {
+		t.Errorf("got %v, %t", got, ok)
+	}
+	if _, ok := b.get(key, now.Add(time.Minute)); ok {
+		t.Error("got expired data")
+	}
+	if _, ok := b.get(key, now); ok {
+		t.Error("expired data was kept")
+	}
+	b.put(key, data, now.Add(time.Minute))
+	b.remove(key)
+	if _, ok := b.get(key, now); ok {
+		t.Error("got removed data")
+	}
+}
+
+// recordingDialer records the addresses dialed, connecting only to those
+// in open.
+type recordingDialer struct {
+	open  map[string]bool
+	addrs []string
+}
+
+func (d *recordingDialer) DialContext(ctx context.Context, network string, addr string) (net.Conn, error) {
+	d.addrs = append(d.addrs, network+" "+addr)
+	if !d.open[addr] {
+		return nil, errors.New("connection refused")
+	}
+	c, s := net.Pipe()
+	s.Close()
+	return c, nil
+}
+
+func TestDialConnectionBrowserFallback(t *testing.T) {
+	p := msdsn.Config{Host: "127.0.0.1", Instance: "INST", Protocols: []string{"tcp"}, BrowserCacheTTL: time.Minute}
+	key := newBrowserCacheKey(&p)
+	defer instanceCache.remove(key)
+	instanceCache.put(key, msdsn.BrowserData{"INST": {"InstanceName": "INST", "tcp": "50000"}}, time.Now().Add(time.Minute))
+
+	// The cached port is refused and the browser does not answer, so the
+	// default port is dialed.
+	d := &recordingDialer{open: map[string]bool{"127.0.0.1:1433": true}}
+	c := &Connector{Dialer: d}
+	conn, err := dialConnection(context.Background(), c, &p, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	want := []string{"tcp 127.0.0.1:50000", "udp 127.0.0.1:1434", "tcp 127.0.0.1:1433"}
+	if !reflect.DeepEqual(d.addrs, want) {
+		t.Errorf("dialed %v, want %v", d.addrs, want)
+	}
+	if _, ok := instanceCache.get(key, time.Now()); ok {
+		t.Error("the refused port is still cached")
+	}
+
+	// Without a cache the browser is required.
+	p = msdsn.Config{Host: "127.0.0.1", Instance: "INST", Protocols: []string{"tcp"}}
+	d.addrs = nil
+	if _, err = dialConnection(context.Background(), c, &p, nil); err == nil {
+		t.Error("connected without an answer from the browser")
+	}
+	if want := []string{"udp 127.0.0.1:1434"}; !reflect.DeepEqual(d.addrs, want) {
+		t.Errorf("dialed %v, want %v", d.addrs, want)
+	}
+}
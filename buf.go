@@ -1,6 +1,8 @@
 package mssql
 
 import (
+	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
 	"io"
@@ -18,6 +20,12 @@ type header struct {
 	Pad        uint8
 }
 
+// Status bits of the packet header.
+const (
+	statusEOM    = 0x01
+	statusIgnore = 0x02
+)
+
 // bufpool provides buffers which are used for reading and writing in the tdsBuffer instances
 var bufpool = sync.Pool{
 	New: func() interface{} {
@@ -28,10 +36,22 @@ var bufpool = sync.Pool{
 	},
 }
 
+// plpPool provides the scratch buffers that large text values are read
+// into before they are decoded into strings.
+var plpPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// maxPooledPLP is the capacity above which a scratch buffer is left to the
+// garbage collector instead of being kept in plpPool.
+const maxPooledPLP = 1 << 20
+
 // tdsBuffer reads and writes TDS packets of data to the transport.
 // The write and read buffers are separate to make sending attn signals
-// possible without locks. Currently attn signals are only sent during
-// reads, not writes.
+// possible without locks. A write canceled through sendCtx ends its
+// message before the attn signal is sent.
 type tdsBuffer struct {
 	transport io.ReadWriteCloser
 
@@ -45,6 +65,9 @@ type tdsBuffer struct {
 	wpos        int
 	wPacketSeq  byte
 	wPacketType packetType
+	// wsize, when positive, is the size of the packets of the message
+	// being written instead of packetSize, see BulkOptions.PacketSize.
+	wsize int
 
 	// Read fields.
 	rbuf        []byte
@@ -53,6 +76,25 @@ type tdsBuffer struct {
 	final       bool
 	rPacketType packetType
 
+	// coalesce makes flush hold back non-final packets of a message in
+	// pending so the whole message goes out in a single transport write.
+	coalesce bool
+	pending  []byte
+
+	// noPLPPool makes readPLPType allocate a new buffer for each text
+	// value instead of reusing one from plpPool.
+	noPLPPool bool
+
+	// arena, when set, holds the binary and character values of the row
+	// being read, see WithRawBytes.
+	arena *rowArena
+
+	// sendCtx, when set, is checked before each non-final packet of a
+	// message is written. Once it is done the message is ended with the
+	// ignore status and sendErr is returned until the next message.
+	sendCtx context.Context
+	sendErr error
+
 	// afterFirst is assigned to right after tdsBuffer is created and
 	// before the first use. It is executed after the first packet is
 	// written and then removed.
@@ -82,14 +124,42 @@ func (w *tdsBuffer) PackageSize() int {
 	return w.packetSize
 }
 
+// SetWriteSize sets the size of the packets of the message being written,
+// up to the packet size of the connection. BeginPacket restores it.
+func (w *tdsBuffer) SetWriteSize(size int) {
+	if size > w.packetSize {
+		size = w.packetSize
+	}
+	w.wsize = size
+}
+
+func (w *tdsBuffer) writeSize() int {
+	if w.wsize > 0 {
+		return w.wsize
+	}
+	return w.packetSize
+}
+
 func (w *tdsBuffer) flush() (err error) {
+	if w.sendErr != nil {
+		return w.sendErr
+	}
+	if w.sendCtx != nil && w.wbuf[1]&statusEOM == 0 {
+		if err = w.sendCtx.Err(); err != nil {
+			if werr := w.AbortPacket(); werr != nil {
+				return werr
+			}
+			w.sendErr = sendCanceledError{err}
+			return w.sendErr
+		}
+	}
 	// Write packet size.
 	w.wbuf[0] = byte(w.wPacketType)
 	binary.BigEndian.PutUint16(w.wbuf[2:], uint16(w.wpos))
 	w.wbuf[6] = w.wPacketSeq
 
 	// Write packet into underlying transport.
-	if _, err = w.transport.Write(w.wbuf[:w.wpos]); err != nil {
+	if err = w.writePacket(w.wbuf[:w.wpos]); err != nil {
 		return err
 	}
 	// It is possible to create a whole new buffer after a flush.
@@ -107,9 +177,43 @@ func (w *tdsBuffer) flush() (err error) {
 	return nil
 }
 
+// coalesceLimit bounds how many bytes of a message are held back when
+// coalescing writes, so large messages such as bulk loads are still
+// streamed instead of buffered in full.
+const coalesceLimit = 1 << 16
+
+// SetCoalesce enables or disables coalescing of the packets of a message
+// into a single write to the transport, or one write per coalesceLimit
+// bytes for larger messages. Each message is still written when it is
+// finished, as its response must be read before the next one is sent;
+// several procedure calls are merged into one message by sendRpcBatch.
+func (w *tdsBuffer) SetCoalesce(coalesce bool) {
+	w.coalesce = coalesce
+}
+
+func (w *tdsBuffer) writePacket(packet []byte) error {
+	final := packet[1]&statusEOM != 0
+	if !w.coalesce {
+		_, err := w.transport.Write(packet)
+		return err
+	}
+	if !final && len(w.pending)+len(packet) <= coalesceLimit {
+		w.pending = append(w.pending, packet...)
+		return nil
+	}
+	if len(w.pending) == 0 {
+		_, err := w.transport.Write(packet)
+		return err
+	}
+	w.pending = append(w.pending, packet...)
+	_, err := w.transport.Write(w.pending)
+	w.pending = w.pending[:0]
+	return err
+}
+
 func (w *tdsBuffer) Write(p []byte) (total int, err error) {
 	for {
-		copied := copy(w.wbuf[w.wpos:w.packetSize], p)
+		copied := copy(w.wbuf[w.wpos:w.writeSize()], p)
 		w.wpos += copied
 		total += copied
 		if copied == len(p) {
@@ -123,7 +227,7 @@ func (w *tdsBuffer) Write(p []byte) (total int, err error) {
 }
 
 func (w *tdsBuffer) WriteByte(b byte) error {
-	if int(w.wpos) == len(w.wbuf) || w.wpos == w.packetSize {
+	if int(w.wpos) == len(w.wbuf) || w.wpos >= w.writeSize() {
 		if err := w.flush(); err != nil {
 			return err
 		}
@@ -144,15 +248,51 @@ func (w *tdsBuffer) BeginPacket(packetType packetType, resetSession bool) {
 	}
 	w.wbuf[1] = status // Packet is incomplete. This byte is set again in FinishPacket.
 	w.wpos = 8
+	w.sendErr = nil
 	w.wPacketSeq = 1
 	w.wPacketType = packetType
+	w.wsize = 0
+	// Packets held back from a message that was not finished, such as one
+	// an attention interrupts, go out before the new message.
+	if len(w.pending) > 0 {
+		if _, err := w.transport.Write(w.pending); err != nil {
+			w.sendErr = err
+		}
+		w.pending = w.pending[:0]
+	}
 }
 
 func (w *tdsBuffer) FinishPacket() error {
-	w.wbuf[1] |= 1 // Mark this as the last packet in the message.
+	w.wbuf[1] |= statusEOM // Mark this as the last packet in the message.
 	return w.flush()
 }
 
+// AbortPacket ends the message being written with a last packet that has
+// the ignore status, so the server discards the whole message. It does
+// nothing when the message was already ended by a canceled send.
+func (w *tdsBuffer) AbortPacket() error {
+	if w.sendErr != nil {
+		return nil
+	}
+	w.wbuf[1] |= statusEOM | statusIgnore
+	return w.flush()
+}
+
+// sendCanceledError is returned by the writes of a tdsBuffer whose sendCtx
+// is done. The message was ended with the ignore status, so the connection
+// can be reused once an attention is confirmed.
+type sendCanceledError struct {
+	err error
+}
+
+func (e sendCanceledError) Error() string {
+	return e.err.Error()
+}
+
+func (e sendCanceledError) Unwrap() error {
+	return e.err
+}
+
 var headerSize = binary.Size(header{})
 
 func (r *tdsBuffer) readNextPacket() error {
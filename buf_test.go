@@ -2,6 +2,7 @@ package mssql
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
 	"testing"
@@ -31,6 +32,44 @@ func (failBuffer) Close() error {
 	return nil
 }
 
+// replyTransport records the packets written to it and serves reads from
+// reply.
+type replyTransport struct {
+	reply *bytes.Buffer
+	sent  bytes.Buffer
+}
+
+func (t *replyTransport) Read(p []byte) (int, error) {
+	return t.reply.Read(p)
+}
+
+func (t *replyTransport) Write(p []byte) (int, error) {
+	return t.sent.Write(p)
+}
+
+func (t *replyTransport) Close() error {
+	return nil
+}
+
+// packets splits the bytes written to the transport into packets.
+func (t *replyTransport) packets() [][]byte {
+	var res [][]byte
+	for b := t.sent.Bytes(); len(b) >= 8; {
+		size := int(binary.BigEndian.Uint16(b[2:]))
+		res = append(res, b[:size])
+		b = b[size:]
+	}
+	return res
+}
+
+// attentionReply returns a reply confirming an attention.
+func attentionReply() *bytes.Buffer {
+	return bytes.NewBuffer([]byte{
+		byte(packReply), statusEOM, 0, 21, 0, 0, 1, 0,
+		byte(tokenDone), doneAttn, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	})
+}
+
 func makeBuf(bufSize uint16, testData []byte) *tdsBuffer {
 	buffer := closableBuffer{bytes.NewBuffer(testData)}
 	return newTdsBuffer(bufSize, &buffer)
@@ -392,6 +431,79 @@ func TestWrite(t *testing.T) {
 	}
 }
 
+type countingBuffer struct {
+	closableBuffer
+	writes int
+}
+
+func (b *countingBuffer) Write(p []byte) (int, error) {
+	b.writes++
+	return b.closableBuffer.Write(p)
+}
+
+func TestWriteCoalesce(t *testing.T) {
+	memBuf := &countingBuffer{closableBuffer: closableBuffer{bytes.NewBuffer([]byte{})}}
+	buf := newTdsBuffer(11, memBuf)
+	buf.SetCoalesce(true)
+	buf.BeginPacket(2, false)
+	_, err := buf.Write([]byte{3, 4, 5, 6, 7, 8, 9})
+	if err != nil {
+		t.Fatal("Write failed:", err.Error())
+	}
+	err = buf.FinishPacket()
+	if err != nil {
+		t.Fatal("FinishPacket failed:", err.Error())
+	}
+	expectedBuf := []byte{
+		2, 0, 0, 11, 0, 0, 1, 0, 3, 4, 5, // packet 1
+		2, 0, 0, 11, 0, 0, 2, 0, 6, 7, 8, // packet 2
+		2, 1, 0, 9, 0, 0, 3, 0, 9, // packet 3
+	}
+	if !bytes.Equal(memBuf.Bytes(), expectedBuf) {
+		t.Fatalf("Written buffer has invalid content:\n got: %v\nwant: %v", memBuf.Bytes(), expectedBuf)
+	}
+	if memBuf.writes != 1 {
+		t.Fatalf("Expected the message to be written at once, got %d writes", memBuf.writes)
+	}
+
+	buf.SetCoalesce(false)
+	buf.BeginPacket(2, false)
+	_, err = buf.Write([]byte{3, 4, 5, 6})
+	if err != nil {
+		t.Fatal("Write failed:", err.Error())
+	}
+	err = buf.FinishPacket()
+	if err != nil {
+		t.Fatal("FinishPacket failed:", err.Error())
+	}
+	if memBuf.writes != 3 {
+		t.Fatalf("Expected one write per packet without coalescing, got %d writes", memBuf.writes)
+	}
+}
+
+func TestWriteCoalesceBeginPacketSendsPending(t *testing.T) {
+	memBuf := &countingBuffer{closableBuffer: closableBuffer{bytes.NewBuffer([]byte{})}}
+	buf := newTdsBuffer(11, memBuf)
+	buf.SetCoalesce(true)
+	buf.BeginPacket(2, false)
+	if _, err := buf.Write([]byte{3, 4, 5, 6}); err != nil {
+		t.Fatal("Write failed:", err.Error())
+	}
+	if memBuf.writes != 0 {
+		t.Fatalf("the first packet should be held back, got %d writes", memBuf.writes)
+	}
+	if err := sendAttention(buf); err != nil {
+		t.Fatal("sendAttention failed:", err.Error())
+	}
+	expectedBuf := []byte{
+		2, 0, 0, 11, 0, 0, 1, 0, 3, 4, 5, // packet held back
+		byte(packAttention), 1, 0, 8, 0, 0, 1, 0, // attention
+	}
+	if !bytes.Equal(memBuf.Bytes(), expectedBuf) {
+		t.Fatalf("Written buffer has invalid content:\n got: %v\nwant: %v", memBuf.Bytes(), expectedBuf)
+	}
+}
+
 func TestWriteErrors(t *testing.T) {
 	// write should fail if underlying transport fails
 	buf := newTdsBuffer(uint16(headerSize)+1, failBuffer{})
@@ -557,3 +669,38 @@ func TestReadBVarCharOrPanic(t *testing.T) {
 	_ = readBVarCharOrPanic(memBuf)
 	t.Fatal("readBVarCharOrPanic() should panic on empty buffer, but it didn't")
 }
+
+func TestSendCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	transport := &replyTransport{}
+	buf := newTdsBuffer(512, transport)
+	buf.BeginPacket(packRPCRequest, false)
+	buf.sendCtx = ctx
+	if _, err := buf.Write(make([]byte, 600)); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	_, err := buf.Write(make([]byte, 600))
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	if _, err = buf.Write(make([]byte, 600)); !errors.Is(err, context.Canceled) {
+		t.Errorf("got %v after the cancellation, want context.Canceled", err)
+	}
+	if err = buf.AbortPacket(); err != nil {
+		t.Errorf("aborting a canceled message failed with %v", err)
+	}
+	packets := transport.packets()
+	if len(packets) != 2 {
+		t.Fatalf("got %d packets, want 2", len(packets))
+	}
+	if packets[0][1] != 0 || packets[1][1] != statusEOM|statusIgnore {
+		t.Errorf("got statuses %#x and %#x, want 0 and %#x", packets[0][1], packets[1][1], statusEOM|statusIgnore)
+	}
+
+	buf.sendCtx = nil
+	buf.BeginPacket(packAttention, false)
+	if err = buf.FinishPacket(); err != nil {
+		t.Errorf("the next message failed with %v", err)
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"context"
 	"database/sql/driver"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"math"
 	"reflect"
@@ -33,15 +34,71 @@ type Bulk struct {
 	headerSent bool
 	Options    BulkOptions
 	Debug      bool
+
+	// NotifyAfter is the number of rows between two calls of the progress
+	// handler set with SetProgressHandler.
+	NotifyAfter int
+	progress    func(rowsCopied int64)
+
+	// canceled is the context error returned by AddRow and Done once the
+	// copy was canceled.
+	canceled error
+
+	// target is the destination table when the rows are copied into a
+	// staging table first, for ReturnIdentity.
+	target     string
+	identities []int64
 }
 type BulkOptions struct {
-	CheckConstraints  bool
-	FireTriggers      bool
+	CheckConstraints bool
+	// FireTriggers runs the insert triggers of the destination table.
+	FireTriggers bool
+	// KeepNulls keeps NULL values in the destination instead of replacing
+	// them with the column defaults.
 	KeepNulls         bool
 	KilobytesPerBatch int
 	RowsPerBatch      int
-	Order             []string
-	Tablock           bool
+	// PacketSize, when positive, is the size of the TDS packets the rows
+	// are sent in, from 512 bytes up to the packet size of the connection.
+	// Zero sends them in packets of the size negotiated at login from the
+	// "packet size" connection string parameter; set that parameter to
+	// 16384 or more on the connections used for bulk loads to send larger
+	// packets than the default 4096 bytes.
+	PacketSize int
+	// Order is the ORDER hint as raw column expressions, such as "id DESC".
+	// It is sent as is; prefer OrderColumns, which is validated.
+	Order []string
+	// OrderColumns is the ORDER hint, the columns the rows are sorted on.
+	// Each column must be one of the copied columns and appear only once.
+	// Order and OrderColumns cannot both be set.
+	OrderColumns []OrderColumn
+	// ColumnCollations overrides the collation of character columns, by
+	// column name, for the data sent by the bulk copy.
+	ColumnCollations map[string]string
+	Tablock          bool
+	// CaseInsensitiveColumns matches the names of the copied columns to the
+	// columns of the destination table ignoring case.
+	CaseInsensitiveColumns bool
+	// SkipGeneratedColumns leaves out the identity, computed and rowversion
+	// columns of the destination table when no columns are listed, in which
+	// case every column of the table is copied in table order.
+	SkipGeneratedColumns bool
+	// ReturnIdentity copies the rows into a temporary staging table, then
+	// inserts them into the destination table with a MERGE statement
+	// whose OUTPUT clause returns the identity value generated for each
+	// row, which Bulk.Identities returns in the order the rows were added.
+	// The destination table must have an identity column, which is not
+	// one of the copied columns. Columns given NULL are set to NULL rather
+	// than to their default. The temporary tables are dropped when the
+	// copy fails. Only a Bulk created with CreateBulkContext can return the
+	// identities; CopyIn rejects the option.
+	ReturnIdentity bool
+}
+
+// OrderColumn is a column of the ORDER hint of a bulk copy.
+type OrderColumn struct {
+	Name       string
+	Descending bool
 }
 
 type DataValue interface{}
@@ -72,25 +129,19 @@ func (b *Bulk) sendBulkCommand(ctx context.Context) (err error) {
 	}
 
 	//match the columns
-	for _, colname := range b.columnsName {
-		var bulkCol *columnStruct
+	if err = b.matchColumns(ctx); err != nil {
+		return err
+	}
 
-		for _, m := range b.metadata {
-			if m.ColName == colname {
-				bulkCol = &m
-				break
-			}
+	if b.Options.ReturnIdentity {
+		if err = b.useStaging(ctx); err != nil {
+			return err
 		}
-		if bulkCol != nil {
+	}
 
-			if bulkCol.ti.TypeId == typeUdt {
-				//send udt as binary
-				bulkCol.ti.TypeId = typeBigVarBin
-			}
-			b.bulkColumns = append(b.bulkColumns, *bulkCol)
-			b.dlogf(ctx, "Adding column %s %s %#x", colname, bulkCol.ColName, bulkCol.ti.TypeId)
-		} else {
-			return fmt.Errorf("column %s does not exist in destination table %s", colname, b.tablename)
+	if len(b.Options.ColumnCollations) > 0 {
+		if err = b.applyCollations(ctx); err != nil {
+			return err
 		}
 	}
 
@@ -103,35 +154,14 @@ func (b *Bulk) sendBulkCommand(ctx context.Context) (err error) {
 			col_defs.WriteString(", ")
 		}
 		col_defs.WriteString("[" + col.ColName + "] " + makeDecl(col.ti))
+		if collation, ok := b.columnCollation(col.ColName); ok {
+			col_defs.WriteString(" COLLATE " + collation)
+		}
 	}
 
-	//options
-	var with_opts []string
-
-	if b.Options.CheckConstraints {
-		with_opts = append(with_opts, "CHECK_CONSTRAINTS")
-	}
-	if b.Options.FireTriggers {
-		with_opts = append(with_opts, "FIRE_TRIGGERS")
-	}
-	if b.Options.KeepNulls {
-		with_opts = append(with_opts, "KEEP_NULLS")
-	}
-	if b.Options.KilobytesPerBatch > 0 {
-		with_opts = append(with_opts, fmt.Sprintf("KILOBYTES_PER_BATCH = %d", b.Options.KilobytesPerBatch))
-	}
-	if b.Options.RowsPerBatch > 0 {
-		with_opts = append(with_opts, fmt.Sprintf("ROWS_PER_BATCH = %d", b.Options.RowsPerBatch))
-	}
-	if len(b.Options.Order) > 0 {
-		with_opts = append(with_opts, fmt.Sprintf("ORDER(%s)", strings.Join(b.Options.Order, ",")))
-	}
-	if b.Options.Tablock {
-		with_opts = append(with_opts, "TABLOCK")
-	}
-	var with_part string
-	if len(with_opts) > 0 {
-		with_part = fmt.Sprintf("WITH (%s)", strings.Join(with_opts, ","))
+	with_part, err := b.makeHints()
+	if err != nil {
+		return err
 	}
 
 	query := fmt.Sprintf("INSERT BULK %s (%s) %s", b.tablename, col_defs.String(), with_part)
@@ -151,27 +181,82 @@ func (b *Bulk) sendBulkCommand(ctx context.Context) (err error) {
 
 	var buf = b.cn.sess.buf
 	buf.BeginPacket(packBulkLoadBCP, false)
+	buf.SetWriteSize(b.packetSize())
+	buf.sendCtx = b.ctx
 
 	// Send the columns metadata.
 	columnMetadata := b.createColMetadata()
 	_, err = buf.Write(columnMetadata)
+	if err != nil && b.ctx.Err() != nil {
+		return b.cancel()
+	}
 
 	return
 }
 
+// packetSize returns the size of the packets the rows are sent in, zero
+// for the packet size of the connection. SetWriteSize bounds it by the
+// packet size of the connection.
+func (b *Bulk) packetSize() int {
+	size := b.Options.PacketSize
+	if size > 0 && size < 512 {
+		size = 512
+	}
+	return size
+}
+
+// cancel aborts the bulk load once its context is done. The rows message
+// is ended with the ignore status so the server discards it, and an
+// attention is confirmed: none of the rows are committed and the
+// connection can be reused.
+func (b *Bulk) cancel() error {
+	b.canceled = b.ctx.Err()
+	buf := b.cn.sess.buf
+	buf.sendCtx = nil
+	err := buf.AbortPacket()
+	if err == nil {
+		err = confirmAttention(b.ctx, b.cn.sess)
+	}
+	if err != nil {
+		b.dlogf(b.ctx, "failed to cancel the bulk load: %v", err)
+		b.cn.connectionGood = false
+	}
+	return b.canceled
+}
+
 // AddRow immediately writes the row to the destination table.
 // The arguments are the row values in the order they were specified.
 func (b *Bulk) AddRow(row []interface{}) (err error) {
+	if b.canceled != nil {
+		return b.canceled
+	}
+	defer func() {
+		// the copy cannot go on once it is canceled or its command failed
+		if err != nil && (b.canceled != nil || !b.headerSent) {
+			b.dropStaging()
+		}
+	}()
 	if !b.headerSent {
 		err = b.sendBulkCommand(b.ctx)
 		if err != nil {
 			return
 		}
 	}
+	if b.ctx.Err() != nil {
+		return b.cancel()
+	}
 
-	if len(row) != len(b.bulkColumns) {
+	columns := len(b.bulkColumns)
+	if b.target != "" {
+		// the last column is the index of the row in the staging table
+		columns--
+	}
+	if len(row) != columns {
 		return fmt.Errorf("row does not have the same number of columns than the destination table %d %d",
-			len(row), len(b.bulkColumns))
+			len(row), columns)
+	}
+	if b.target != "" {
+		row = append(row[:len(row):len(row)], int64(b.numRows))
 	}
 
 	bytes, err := b.makeRowData(row)
@@ -181,13 +266,31 @@ func (b *Bulk) AddRow(row []interface{}) (err error) {
 
 	_, err = b.cn.sess.buf.Write(bytes)
 	if err != nil {
+		if b.ctx.Err() != nil {
+			return b.cancel()
+		}
 		return
 	}
 
 	b.numRows = b.numRows + 1
+	if b.progress != nil && b.NotifyAfter > 0 && b.numRows%b.NotifyAfter == 0 {
+		b.progress(int64(b.numRows))
+		if b.ctx.Err() != nil {
+			return b.cancel()
+		}
+	}
 	return
 }
 
+// SetProgressHandler sets a function called with the number of rows added
+// so far every NotifyAfter rows. The context of the bulk copy is checked
+// after each call, so the handler can stop a long copy by canceling it:
+// AddRow then returns the context error and the copy is aborted, none of
+// its rows are committed.
+func (b *Bulk) SetProgressHandler(handler func(rowsCopied int64)) {
+	b.progress = handler
+}
+
 func (b *Bulk) makeRowData(row []interface{}) ([]byte, error) {
 	buf := new(bytes.Buffer)
 	buf.WriteByte(byte(tokenRow))
@@ -219,10 +322,21 @@ func (b *Bulk) makeRowData(row []interface{}) ([]byte, error) {
 }
 
 func (b *Bulk) Done() (rowcount int64, err error) {
+	if b.canceled != nil {
+		return 0, b.canceled
+	}
+	defer func() {
+		if err != nil {
+			b.dropStaging()
+		}
+	}()
 	if !b.headerSent {
 		//no rows had been sent
 		return 0, nil
 	}
+	if b.ctx.Err() != nil {
+		return 0, b.cancel()
+	}
 	var buf = b.cn.sess.buf
 	buf.WriteByte(byte(tokenDone))
 
@@ -235,13 +349,20 @@ func (b *Bulk) Done() (rowcount int64, err error) {
 		binary.Write(buf, binary.LittleEndian, uint32(0)) //rowcount 0
 	}
 
-	buf.FinishPacket()
+	err = buf.FinishPacket()
+	buf.sendCtx = nil
+	if err != nil && b.ctx.Err() != nil {
+		return 0, b.cancel()
+	}
 
 	reader := startReading(b.cn.sess, b.ctx, outputs{})
 	err = reader.iterateResponse()
 	if err != nil {
 		return 0, b.cn.checkBadConn(b.ctx, err, false)
 	}
+	if b.target != "" {
+		return b.insertFromStaging(b.ctx)
+	}
 
 	return reader.rowCount, nil
 }
@@ -315,6 +436,210 @@ func (b *Bulk) getMetadata(ctx context.Context) (err error) {
 	return rows.Close()
 }
 
+// makeHints returns the WITH clause of the INSERT BULK statement.
+func (b *Bulk) makeHints() (string, error) {
+	var with_opts []string
+
+	if b.Options.CheckConstraints {
+		with_opts = append(with_opts, "CHECK_CONSTRAINTS")
+	}
+	if b.Options.FireTriggers {
+		with_opts = append(with_opts, "FIRE_TRIGGERS")
+	}
+	if b.Options.KeepNulls {
+		with_opts = append(with_opts, "KEEP_NULLS")
+	}
+	if b.Options.KilobytesPerBatch > 0 {
+		with_opts = append(with_opts, fmt.Sprintf("KILOBYTES_PER_BATCH = %d", b.Options.KilobytesPerBatch))
+	}
+	if b.Options.RowsPerBatch > 0 {
+		with_opts = append(with_opts, fmt.Sprintf("ROWS_PER_BATCH = %d", b.Options.RowsPerBatch))
+	}
+	if len(b.Options.Order) > 0 && len(b.Options.OrderColumns) > 0 {
+		return "", errors.New("mssql: bulk copy Order and OrderColumns cannot both be set")
+	}
+	if len(b.Options.Order) > 0 {
+		with_opts = append(with_opts, fmt.Sprintf("ORDER(%s)", strings.Join(b.Options.Order, ",")))
+	}
+	if len(b.Options.OrderColumns) > 0 {
+		order := make([]string, len(b.Options.OrderColumns))
+		seen := make(map[string]bool, len(order))
+		for i, oc := range b.Options.OrderColumns {
+			if !b.hasColumn(oc.Name) {
+				return "", fmt.Errorf("mssql: bulk copy order column %s is not one of the copied columns", oc.Name)
+			}
+			if seen[oc.Name] {
+				return "", fmt.Errorf("mssql: bulk copy order column %s is repeated", oc.Name)
+			}
+			seen[oc.Name] = true
+			order[i] = TSQLQuoter{}.ID(oc.Name)
+			if oc.Descending {
+				order[i] += " DESC"
+			} else {
+				order[i] += " ASC"
+			}
+		}
+		with_opts = append(with_opts, fmt.Sprintf("ORDER(%s)", strings.Join(order, ",")))
+	}
+	if b.Options.Tablock {
+		with_opts = append(with_opts, "TABLOCK")
+	}
+	if len(with_opts) == 0 {
+		return "", nil
+	}
+	return fmt.Sprintf("WITH (%s)", strings.Join(with_opts, ",")), nil
+}
+
+func (b *Bulk) hasColumn(name string) bool {
+	for _, col := range b.bulkColumns {
+		if b.sameColumn(col.ColName, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameColumn reports whether the column names x and y refer to the same
+// column, ignoring case when CaseInsensitiveColumns is set.
+func (b *Bulk) sameColumn(x, y string) bool {
+	if b.Options.CaseInsensitiveColumns {
+		return strings.EqualFold(x, y)
+	}
+	return x == y
+}
+
+func (b *Bulk) columnCollation(name string) (string, bool) {
+	for col, collation := range b.Options.ColumnCollations {
+		if b.sameColumn(col, name) {
+			return collation, true
+		}
+	}
+	return "", false
+}
+
+// matchColumns sets the columns of the bulk copy from the destination
+// table metadata. Without column names every column is copied, except the
+// generated ones when SkipGeneratedColumns is set.
+func (b *Bulk) matchColumns(ctx context.Context) error {
+	if len(b.columnsName) == 0 {
+		for _, m := range b.metadata {
+			if b.Options.SkipGeneratedColumns && isGeneratedColumn(m) {
+				b.dlogf(ctx, "Skipping generated column %s", m.ColName)
+				continue
+			}
+			b.columnsName = append(b.columnsName, m.ColName)
+		}
+	}
+
+	var unmatched []string
+	for _, colname := range b.columnsName {
+		var bulkCol *columnStruct
+
+		for i := range b.metadata {
+			if b.sameColumn(b.metadata[i].ColName, colname) {
+				m := b.metadata[i]
+				bulkCol = &m
+				break
+			}
+		}
+		if bulkCol != nil {
+
+			if bulkCol.ti.TypeId == typeUdt {
+				//send udt as binary
+				bulkCol.ti.TypeId = typeBigVarBin
+			}
+			b.bulkColumns = append(b.bulkColumns, *bulkCol)
+			b.dlogf(ctx, "Adding column %s %s %#x", colname, bulkCol.ColName, bulkCol.ti.TypeId)
+		} else {
+			unmatched = append(unmatched, colname)
+		}
+	}
+	if len(unmatched) > 0 {
+		return BulkColumnError{Table: b.tablename, Columns: unmatched}
+	}
+	return nil
+}
+
+// isGeneratedColumn reports whether the server generates the values of
+// col: identity, computed and rowversion columns.
+func isGeneratedColumn(col columnStruct) bool {
+	return col.Flags&(colFlagIdentity|colFlagComputed) != 0 || col.UserType == userTypeTimestamp
+}
+
+// BulkColumnError is returned by a bulk copy when some of its columns do
+// not exist in the destination table.
+type BulkColumnError struct {
+	Table string
+	// Columns are the names of the unmatched columns.
+	Columns []string
+}
+
+func (e BulkColumnError) Error() string {
+	if len(e.Columns) == 1 {
+		return fmt.Sprintf("column %s does not exist in destination table %s", e.Columns[0], e.Table)
+	}
+	return fmt.Sprintf("columns %s do not exist in destination table %s", strings.Join(e.Columns, ", "), e.Table)
+}
+
+// applyCollations replaces the collation of the copied columns listed in
+// ColumnCollations. The collations are looked up on the server, which
+// reports an unknown collation name.
+func (b *Bulk) applyCollations(ctx context.Context) error {
+	var (
+		exprs   []string
+		indexes []int
+	)
+	for name, collation := range b.Options.ColumnCollations {
+		if !validCollationName(collation) {
+			return fmt.Errorf("mssql: invalid collation name %q for bulk copy column %s", collation, name)
+		}
+		i := -1
+		for j, col := range b.bulkColumns {
+			if b.sameColumn(col.ColName, name) {
+				i = j
+				break
+			}
+		}
+		if i < 0 {
+			return fmt.Errorf("mssql: bulk copy collation column %s is not one of the copied columns", name)
+		}
+		switch b.bulkColumns[i].ti.TypeId {
+		case typeVarChar, typeBigVarChar, typeText, typeChar, typeBigChar,
+			typeNVarChar, typeNChar, typeNText:
+		default:
+			return fmt.Errorf("mssql: bulk copy column %s is not a character column and has no collation", name)
+		}
+		exprs = append(exprs, "cast(null as varchar(1)) collate "+collation)
+		indexes = append(indexes, i)
+	}
+	stmt, err := b.cn.prepareContext(ctx, "select "+strings.Join(exprs, ", "))
+	if err != nil {
+		return err
+	}
+	rows, err := stmt.QueryContext(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("get collations failed: %v", err)
+	}
+	for k, col := range rows.(*Rows).cols {
+		b.bulkColumns[indexes[k]].ti.Collation = col.ti.Collation
+	}
+	return rows.Close()
+}
+
+// validCollationName reports whether name can be used as a collation name
+// in a statement, collation names only have letters, digits and underscores.
+func validCollationName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_') {
+			return false
+		}
+	}
+	return true
+}
+
 func (b *Bulk) makeParam(val DataValue, col columnStruct) (res param, err error) {
 	res.ti.Size = col.ti.Size
 	res.ti.TypeId = col.ti.TypeId
@@ -337,6 +662,11 @@ func (b *Bulk) makeParam(val DataValue, col columnStruct) (res param, err error)
 		return
 	}
 
+	if v, ok := val.(Vector); ok && col.ti.TypeId != typeVector {
+		// without native vector support vector columns are described as text
+		val = v.String()
+	}
+
 	switch col.ti.TypeId {
 
 	case typeInt1, typeInt2, typeInt4, typeInt8, typeIntN:
@@ -535,28 +865,44 @@ func (b *Bulk) makeParam(val DataValue, col columnStruct) (res param, err error)
 			err = fmt.Errorf("mssql: invalid type for time column: %T %s", val, val)
 			return
 		}
-	// case typeMoney, typeMoney4, typeMoneyN:
+	case typeMoney, typeMoney4, typeMoneyN:
+		var m Money
+		if v, ok := val.(Money); ok {
+			m = v
+		} else if err = m.Scan(val); err != nil {
+			return
+		}
+		var p param
+		if p, err = makeMoneyParam(m); err != nil {
+			return
+		}
+		if col.ti.Size == 4 {
+			// smallmoney is the low 32 bits of the money value
+			v := int64(binary.LittleEndian.Uint32(p.buffer))<<32 | int64(binary.LittleEndian.Uint32(p.buffer[4:]))
+			if v < math.MinInt32 || v > math.MaxInt32 {
+				return res, fmt.Errorf("mssql: %s is out of range for smallmoney", m.Decimal)
+			}
+			res.buffer = p.buffer[4:8]
+		} else {
+			res.buffer = p.buffer
+		}
+		res.ti.Size = len(res.buffer)
 	case typeDecimal, typeDecimalN, typeNumeric, typeNumericN:
 		prec := col.ti.Prec
 		scale := col.ti.Scale
 		var dec decimal.Decimal
 		switch v := val.(type) {
-		case int:
-			dec = decimal.Int64ToDecimalScale(int64(v), 0)
-		case int8:
-			dec = decimal.Int64ToDecimalScale(int64(v), 0)
-		case int16:
-			dec = decimal.Int64ToDecimalScale(int64(v), 0)
-		case int32:
-			dec = decimal.Int64ToDecimalScale(int64(v), 0)
-		case int64:
-			dec = decimal.Int64ToDecimalScale(int64(v), 0)
+		case int, int8, int16, int32, int64:
+			// integers are scaled to the column like the other values
+			dec, err = decimal.StringToDecimalScale(fmt.Sprint(v), scale)
 		case float32:
 			dec, err = decimal.Float64ToDecimalScale(float64(v), scale)
 		case float64:
 			dec, err = decimal.Float64ToDecimalScale(float64(v), scale)
 		case string:
 			dec, err = decimal.StringToDecimalScale(v, scale)
+		case Decimal:
+			dec, err = decimal.StringToDecimalScale(v.String(), scale)
 		default:
 			return res, fmt.Errorf("unknown value for decimal: %T %#v", v, v)
 		}
@@ -617,6 +963,28 @@ func (b *Bulk) makeParam(val DataValue, col columnStruct) (res param, err error)
 			err = fmt.Errorf("mssql: invalid type for Guid column: %T %s", val, val)
 			return
 		}
+	case typeVector:
+		var v Vector
+		switch val := val.(type) {
+		case Vector:
+			v = val
+		case []float32:
+			v.Data = val
+		case string:
+			if err = v.Scan(val); err != nil {
+				return
+			}
+		default:
+			err = fmt.Errorf("mssql: invalid type for vector column: %T %s", val, val)
+			return
+		}
+		v.ElementType = VectorElementType(col.ti.Scale)
+		res.buffer = v.encode()
+		if len(res.buffer) != col.ti.Size {
+			err = fmt.Errorf("mssql: vector of %d dimensions for a vector(%d) column", len(v.Data), vectorDimensions(col.ti))
+			return
+		}
+		res.ti.Size = len(res.buffer)
 
 	default:
 		err = fmt.Errorf("mssql: type %x not implemented", col.ti.TypeId)
@@ -0,0 +1,185 @@
+package mssql
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// bulkRowColumn is the column of the staging table of ReturnIdentity
+// holding the index of each row.
+const bulkRowColumn = "mssql$row"
+
+// Identities returns the identity values generated for the rows, in the
+// order they were added, once Done returned, when Options.ReturnIdentity
+// is set.
+func (b *Bulk) Identities() []int64 {
+	return b.identities
+}
+
+// useStaging makes the bulk copy load a temporary table with the columns
+// of the copy and the index of each row, from which insertFromStaging
+// inserts the rows into the destination table.
+func (b *Bulk) useStaging(ctx context.Context) error {
+	hasIdentity := false
+	for _, col := range b.metadata {
+		hasIdentity = hasIdentity || col.Flags&colFlagIdentity != 0
+	}
+	if !hasIdentity {
+		return fmt.Errorf("mssql: cannot return identities, %s has no identity column", b.tablename)
+	}
+	names := make([]string, len(b.bulkColumns))
+	for i, col := range b.bulkColumns {
+		if col.Flags&colFlagIdentity != 0 {
+			return fmt.Errorf("mssql: cannot return identities when copying the identity column %s", col.ColName)
+		}
+		names[i] = col.ColName
+	}
+	suffix := make([]byte, 8)
+	if _, err := rand.Read(suffix); err != nil {
+		return err
+	}
+	staging := "#bulk_" + hex.EncodeToString(suffix)
+	query := fmt.Sprintf("select top 0 %s into %s from %s; alter table %s add %s int not null",
+		quotedColumns("", names), staging, b.tablename, staging, TSQLQuoter{}.ID(bulkRowColumn))
+	stmt, err := b.cn.prepareContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	if _, err = stmt.ExecContext(ctx, nil); err != nil {
+		return err
+	}
+	b.dlogf(ctx, query)
+
+	b.target, b.tablename = b.tablename, staging
+	b.columnsName = append(names, bulkRowColumn)
+	b.bulkColumns = nil
+	if err = b.getMetadata(ctx); err != nil {
+		return err
+	}
+	return b.matchColumns(ctx)
+}
+
+// insertFromStaging inserts the rows of the staging table into the
+// destination table, drops the staging table and records the identity
+// generated for each row. It returns the number of rows inserted. The
+// identities are output into a temporary table and selected from it, since
+// an OUTPUT clause without INTO fails on tables with triggers.
+func (b *Bulk) insertFromStaging(ctx context.Context) (int64, error) {
+	names := make([]string, 0, len(b.bulkColumns)-1)
+	for _, col := range b.bulkColumns {
+		if col.ColName != bulkRowColumn {
+			names = append(names, col.ColName)
+		}
+	}
+	hint := ""
+	if b.Options.Tablock {
+		hint = " with (tablock)"
+	}
+	query := fmt.Sprintf(`create table %s (%s int not null, [identity] bigint not null);
+merge %s%s using %s as s on 1 = 0
+when not matched then insert (%s) values (%s)
+output s.%s, inserted.$identity into %s;
+drop table %s;
+select %s, [identity] from %s;
+drop table %s`,
+		b.identityTable(), TSQLQuoter{}.ID(bulkRowColumn),
+		b.target, hint, b.tablename, quotedColumns("", names), quotedColumns("s.", names),
+		TSQLQuoter{}.ID(bulkRowColumn), b.identityTable(),
+		b.tablename,
+		TSQLQuoter{}.ID(bulkRowColumn), b.identityTable(),
+		b.identityTable())
+	b.dlogf(ctx, query)
+	stmt, err := b.cn.prepareContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	rows, err := stmt.queryContext(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	identities := make([]int64, b.numRows)
+	var n int64
+	row := make([]driver.Value, 2)
+	for {
+		err = rows.Next(row)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return n, err
+		}
+		i, ok := row[0].(int64)
+		if !ok || i < 0 || i >= int64(len(identities)) {
+			return n, fmt.Errorf("mssql: bulk copy returned an identity for row %v of %d", row[0], len(identities))
+		}
+		if identities[i], err = identityValue(row[1]); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if err = rows.Close(); err != nil {
+		return n, err
+	}
+	b.identities = identities
+	return n, nil
+}
+
+// identityTable returns the name of the temporary table the identities are
+// output into, named after the staging table.
+func (b *Bulk) identityTable() string {
+	return b.tablename + "_identity"
+}
+
+// dropStaging drops the staging table and the identity table of
+// ReturnIdentity after the copy failed, when the connection can still run
+// statements, so they do not stay in the session.
+func (b *Bulk) dropStaging() {
+	if b.target == "" || !b.cn.connectionGood {
+		return
+	}
+	var query strings.Builder
+	for _, name := range []string{b.tablename, b.identityTable()} {
+		fmt.Fprintf(&query, "if object_id('tempdb..%s') is not null drop table %s;\n", name, name)
+	}
+	ctx := context.Background()
+	b.dlogf(ctx, query.String())
+	stmt, err := b.cn.prepareContext(ctx, query.String())
+	if err == nil {
+		_, err = stmt.ExecContext(ctx, nil)
+	}
+	if err != nil {
+		b.dlogf(ctx, "failed to drop the staging table: %v", err)
+	}
+}
+
+// identityValue converts the value of an identity column, an integer or a
+// decimal or numeric with a scale of 0, to an int64.
+func identityValue(v driver.Value) (int64, error) {
+	switch v := v.(type) {
+	case int64:
+		return v, nil
+	case []byte:
+		return strconv.ParseInt(string(v), 10, 64)
+	case nil:
+		return 0, errors.New("mssql: bulk copy returned a NULL identity")
+	}
+	return 0, fmt.Errorf("mssql: bulk copy returned an identity of type %T", v)
+}
+
+// quotedColumns returns the names quoted and separated by commas, each
+// with prefix.
+func quotedColumns(prefix string, names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = prefix + TSQLQuoter{}.ID(name)
+	}
+	return strings.Join(quoted, ", ")
+}
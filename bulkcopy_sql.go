@@ -32,6 +32,9 @@ func (c *Conn) prepareCopyIn(ctx context.Context, query string) (_ driver.Stmt,
 		return
 	}
 
+	if bulkconfig.Options.ReturnIdentity {
+		return nil, errors.New("mssql: CopyIn cannot return identities, use a Bulk created with Conn.CreateBulkContext")
+	}
 	bulkcopy := c.CreateBulkContext(ctx, bulkconfig.TableName, bulkconfig.ColumnsName)
 	bulkcopy.Options = bulkconfig.Options
 
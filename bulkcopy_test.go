@@ -1,13 +1,17 @@
-//go:build go1.9 && !386
-// +build go1.9,!386
+//go:build go1.9
+// +build go1.9
 
 package mssql
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"encoding/hex"
+	"errors"
+	"fmt"
 	"math"
+	"math/big"
 	"reflect"
 	"strings"
 	"testing"
@@ -159,7 +163,7 @@ func TestBulkcopy(t *testing.T) {
 		{"test_smallint", 32767, nil},
 		{"test_smallintn", nil, nil},
 		{"test_int", 2147483647, nil},
-		{"test_bigint", 9223372036854775807, nil},
+		{"test_bigint", int64(9223372036854775807), nil},
 		{"test_bigintn", nil, nil},
 		{"test_intf", 1234.56, 1234},
 		{"test_intf32", float32(1234.56), 1234},
@@ -170,7 +174,7 @@ func TestBulkcopy(t *testing.T) {
 		{"test_nullstring", sql.NullString{"abcdefg", true}, "abcdefg"},
 		{"test_nullbyte", sql.NullByte{0x01, true}, 1},
 		{"test_nullbool", sql.NullBool{true, true}, true},
-		{"test_nullint64", sql.NullInt64{9223372036854775807, true}, 9223372036854775807},
+		{"test_nullint64", sql.NullInt64{9223372036854775807, true}, int64(9223372036854775807)},
 		{"test_nullint32", sql.NullInt32{2147483647, true}, 2147483647},
 		{"test_nullint16", sql.NullInt16{32767, true}, 32767},
 		{"test_nulltime", sql.NullTime{time.Date(2010, 11, 12, 13, 14, 15, 120000000, time.UTC), true}, time.Date(2010, 11, 12, 13, 14, 15, 120000000, time.UTC)},
@@ -179,7 +183,7 @@ func TestBulkcopy(t *testing.T) {
 		{"test_decimal_18_0", 1234.0001, "1234"},
 		{"test_decimal_9_2", -1234.560001, "-1234.56"},
 		{"test_decimal_20_0", 1234, "1234"},
-		{"test_decimal_20_0_2", math.MinInt64, "-9223372036854775808"},
+		{"test_decimal_20_0_2", int64(math.MinInt64), "-9223372036854775808"},
 		{"test_decimal_20_10", "1234.1", "1234.1000000000"},
 		{"test_numeric_30_10", "66666666666666666666.6666666666", nil},
 		{"test_varbinary", []byte("1"), nil},
@@ -438,3 +442,383 @@ func setupTable(ctx context.Context, t *testing.T, conn *sql.Conn, tableName str
 	}
 	return
 }
+
+func TestBulkHints(t *testing.T) {
+	b := &Bulk{bulkColumns: []columnStruct{{ColName: "id"}, {ColName: "na]me"}}}
+	b.Options = BulkOptions{
+		KeepNulls:    true,
+		FireTriggers: true,
+		OrderColumns: []OrderColumn{{Name: "id"}, {Name: "na]me", Descending: true}},
+	}
+	hints, err := b.makeHints()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "WITH (FIRE_TRIGGERS,KEEP_NULLS,ORDER([id] ASC,[na]]me] DESC))"; hints != want {
+		t.Errorf("got %q, want %q", hints, want)
+	}
+
+	invalid := []BulkOptions{
+		{OrderColumns: []OrderColumn{{Name: "missing"}}},
+		{OrderColumns: []OrderColumn{{Name: "id"}, {Name: "id", Descending: true}}},
+		{Order: []string{"id"}, OrderColumns: []OrderColumn{{Name: "id"}}},
+	}
+	for _, opts := range invalid {
+		b.Options = opts
+		if _, err = b.makeHints(); err == nil {
+			t.Errorf("hints for %+v should fail", opts)
+		}
+	}
+
+	b.Options = BulkOptions{}
+	if hints, err = b.makeHints(); hints != "" || err != nil {
+		t.Errorf("no options got %q, %v", hints, err)
+	}
+}
+
+func TestValidCollationName(t *testing.T) {
+	for _, name := range []string{"Latin1_General_100_CI_AS_SC_UTF8", "SQL_Latin1_General_CP1_CI_AS"} {
+		if !validCollationName(name) {
+			t.Errorf("%s should be valid", name)
+		}
+	}
+	for _, name := range []string{"", "Latin1 General", "x; drop table t"} {
+		if validCollationName(name) {
+			t.Errorf("%q should be invalid", name)
+		}
+	}
+}
+
+func TestBulkProgressHandler(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	transport := &replyTransport{reply: attentionReply()}
+	cn := &Conn{connectionGood: true, sess: &tdsSession{buf: newTdsBuffer(defaultPacketSize, transport)}}
+	b := cn.CreateBulkContext(ctx, "t", []string{"id"})
+	b.headerSent = true
+	cn.sess.buf.BeginPacket(packBulkLoadBCP, false)
+	cn.sess.buf.sendCtx = ctx
+	b.bulkColumns = []columnStruct{{ColName: "id", ti: typeInfo{TypeId: typeIntN, Size: 4, Writer: writeByteLenType}}}
+	b.NotifyAfter = 2
+	var calls []int64
+	b.SetProgressHandler(func(rowsCopied int64) {
+		calls = append(calls, rowsCopied)
+		if rowsCopied == 4 {
+			cancel()
+		}
+	})
+	var err error
+	for i := 0; i < 5 && err == nil; i++ {
+		err = b.AddRow([]interface{}{int64(i)})
+	}
+	if err != context.Canceled {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+	if !reflect.DeepEqual(calls, []int64{2, 4}) {
+		t.Errorf("handler called with %v, want [2 4]", calls)
+	}
+	if !cn.connectionGood {
+		t.Error("canceling a bulk copy should keep the connection")
+	}
+	packets := transport.packets()
+	if len(packets) != 2 || packets[0][0] != byte(packBulkLoadBCP) || packets[0][1] != statusEOM|statusIgnore ||
+		packets[1][0] != byte(packAttention) {
+		t.Errorf("got packets %x, want an ignored bulk load and an attention", packets)
+	}
+	if err = b.AddRow([]interface{}{int64(5)}); err != context.Canceled {
+		t.Errorf("AddRow after the cancellation got %v, want context.Canceled", err)
+	}
+	if _, err = b.Done(); err != context.Canceled {
+		t.Errorf("Done after the cancellation got %v, want context.Canceled", err)
+	}
+}
+
+func TestBulkMatchColumns(t *testing.T) {
+	metadata := []columnStruct{
+		{ColName: "ID", Flags: colFlagIdentity},
+		{ColName: "Name"},
+		{ColName: "Total", Flags: colFlagComputed},
+		{ColName: "Version", UserType: userTypeTimestamp},
+		{ColName: "Created"},
+	}
+	names := func(cols []columnStruct) []string {
+		var res []string
+		for _, col := range cols {
+			res = append(res, col.ColName)
+		}
+		return res
+	}
+
+	b := &Bulk{metadata: metadata, Options: BulkOptions{SkipGeneratedColumns: true}}
+	if err := b.matchColumns(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(b.bulkColumns); !reflect.DeepEqual(got, []string{"Name", "Created"}) {
+		t.Errorf("automatic mapping got %v", got)
+	}
+
+	b = &Bulk{metadata: metadata, columnsName: []string{"name", "CREATED"}, Options: BulkOptions{CaseInsensitiveColumns: true}}
+	if err := b.matchColumns(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if got := names(b.bulkColumns); !reflect.DeepEqual(got, []string{"Name", "Created"}) {
+		t.Errorf("case insensitive mapping got %v", got)
+	}
+
+	b = &Bulk{tablename: "t", metadata: metadata, columnsName: []string{"name", "Created", "missing"}}
+	err := b.matchColumns(context.Background())
+	var colErr BulkColumnError
+	if !errors.As(err, &colErr) {
+		t.Fatalf("got %v, want a BulkColumnError", err)
+	}
+	if !reflect.DeepEqual(colErr.Columns, []string{"name", "missing"}) || colErr.Table != "t" {
+		t.Errorf("got %+v", colErr)
+	}
+	if err.Error() != "columns name, missing do not exist in destination table t" {
+		t.Errorf("unexpected message %q", err)
+	}
+}
+
+func TestBulkMoneyParam(t *testing.T) {
+	b := &Bulk{}
+	col := columnStruct{ti: typeInfo{TypeId: typeMoneyN, Size: 8}}
+	p, err := b.makeParam("-1.5", col)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// -15000 as the high and the low 32 bits
+	if want := []byte{0xff, 0xff, 0xff, 0xff, 0x68, 0xc5, 0xff, 0xff}; !reflect.DeepEqual(p.buffer, want) {
+		t.Errorf("money got %x, want %x", p.buffer, want)
+	}
+	col.ti.Size = 4
+	if p, err = b.makeParam(int64(2), col); err != nil || !reflect.DeepEqual(p.buffer, []byte{0x20, 0x4e, 0, 0}) {
+		t.Errorf("smallmoney got %x, %v", p.buffer, err)
+	}
+	if _, err = b.makeParam("300000", col); err == nil {
+		t.Error("300000 is out of range for smallmoney")
+	}
+	if _, err = b.makeParam("1.00001", col); err == nil {
+		t.Error("money has only 4 decimal places")
+	}
+}
+
+func TestBulkIntParam(t *testing.T) {
+	b := &Bulk{}
+	col := columnStruct{ti: typeInfo{TypeId: typeIntN, Size: 8}}
+	p, err := b.makeParam(int64(math.MinInt64), col)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0, 0, 0, 0, 0, 0, 0, 0x80}; !reflect.DeepEqual(p.buffer, want) {
+		t.Errorf("bigint got %x, want %x", p.buffer, want)
+	}
+	col.ti.Size = 4
+	if p, err = b.makeParam(math.MaxInt32, col); err != nil || !reflect.DeepEqual(p.buffer, []byte{0xff, 0xff, 0xff, 0x7f}) {
+		t.Errorf("int got %x, %v", p.buffer, err)
+	}
+}
+
+func TestBulkDecimalParam(t *testing.T) {
+	b := &Bulk{}
+	tests := []struct {
+		prec, scale uint8
+		in          interface{}
+		want        string
+	}{
+		{20, 0, int64(math.MinInt64), "-9223372036854775808"},
+		{20, 0, int64(math.MaxInt64), "9223372036854775807"},
+		{20, 10, 1234, "1234.0000000000"},
+		{9, 2, int32(-5), "-5.00"},
+		{9, 2, int8(7), "7.00"},
+		{38, 10, "66666666666666666666.6666666666", "66666666666666666666.6666666666"},
+		{18, 4, Decimal{Coefficient: big.NewInt(-123456), Scale: 3}, "-123.4560"},
+		{9, 2, -1234.56, "-1234.56"},
+	}
+	for _, tst := range tests {
+		col := columnStruct{ti: typeInfo{TypeId: typeDecimalN, Prec: tst.prec, Scale: tst.scale}}
+		p, err := b.makeParam(tst.in, col)
+		if err != nil {
+			t.Errorf("%T %v: %v", tst.in, tst.in, err)
+			continue
+		}
+		if p.ti.Size != len(p.buffer) {
+			t.Errorf("%T %v: size %d for %d bytes", tst.in, tst.in, p.ti.Size, len(p.buffer))
+		}
+		if got := string(decodeDecimal(tst.prec, tst.scale, p.buffer)); got != tst.want {
+			t.Errorf("%T %v: got %s, want %s", tst.in, tst.in, got, tst.want)
+		}
+	}
+	col := columnStruct{ti: typeInfo{TypeId: typeDecimalN, Prec: 9, Scale: 2}}
+	if _, err := b.makeParam("1.234", col); err == nil {
+		t.Error("1.234 has more decimal places than decimal(9, 2)")
+	}
+}
+
+func TestBulkDateTimeParam(t *testing.T) {
+	b := &Bulk{}
+	in := time.Date(2010, 11, 12, 13, 14, 15, 120000000, time.UTC)
+	col := columnStruct{ti: typeInfo{TypeId: typeDateTimeN, Size: 8}}
+	p, err := b.makeParam(in, col)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := decodeDateTime(p.buffer); !got.Equal(in) {
+		t.Errorf("datetime got %v, want %v", got, in)
+	}
+	col = columnStruct{ti: typeInfo{TypeId: typeDateTime2N, Scale: 7}}
+	in = time.Date(9999, 12, 31, 23, 59, 59, 999999900, time.UTC)
+	if p, err = b.makeParam(in, col); err != nil {
+		t.Fatal(err)
+	}
+	if got := decodeDateTime2(7, p.buffer); !got.Equal(in) {
+		t.Errorf("datetime2 got %v, want %v", got, in)
+	}
+}
+
+func TestBulkReturnIdentityRows(t *testing.T) {
+	ctx := context.Background()
+	transport := &replyTransport{reply: &bytes.Buffer{}}
+	cn := &Conn{connectionGood: true, sess: &tdsSession{buf: newTdsBuffer(defaultPacketSize, transport)}}
+	b := cn.CreateBulkContext(ctx, "#bulk_1", nil)
+	b.headerSent = true
+	b.target = "t"
+	b.bulkColumns = []columnStruct{
+		{ColName: "name", ti: typeInfo{TypeId: typeIntN, Size: 4, Writer: writeByteLenType}},
+		{ColName: bulkRowColumn, ti: typeInfo{TypeId: typeIntN, Size: 4, Writer: writeByteLenType}},
+	}
+	cn.sess.buf.BeginPacket(packBulkLoadBCP, false)
+	for i := 0; i < 2; i++ {
+		if err := b.AddRow([]interface{}{int64(10 + i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := b.AddRow([]interface{}{int64(1), int64(2)}); err == nil {
+		t.Error("a row with the index column was accepted")
+	}
+	cn.sess.buf.FinishPacket()
+	packets := transport.packets()
+	want := []byte{byte(tokenRow), 4, 10, 0, 0, 0, 4, 0, 0, 0, 0, byte(tokenRow), 4, 11, 0, 0, 0, 4, 1, 0, 0, 0}
+	if len(packets) != 1 || !bytes.Equal(packets[0][8:], want) {
+		t.Errorf("got packets %x, want rows %x with their index", packets, want)
+	}
+
+	b = &Bulk{tablename: "t", metadata: []columnStruct{{ColName: "name"}}, bulkColumns: []columnStruct{{ColName: "name"}}}
+	if err := b.useStaging(ctx); err == nil {
+		t.Error("a table without an identity column was accepted")
+	}
+	b.metadata = []columnStruct{{ColName: "id", Flags: colFlagIdentity}}
+	b.bulkColumns = b.metadata
+	if err := b.useStaging(ctx); err == nil {
+		t.Error("copying the identity column was accepted")
+	}
+	if _, err := cn.prepareCopyIn(ctx, CopyIn("t", BulkOptions{ReturnIdentity: true}, "name")); err == nil {
+		t.Error("CopyIn accepted ReturnIdentity")
+	}
+}
+
+func TestBulkReturnIdentityDropsStaging(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	reply := attentionReply()
+	reply.Write([]byte{
+		byte(packReply), statusEOM, 0, 21, 0, 0, 1, 0,
+		byte(tokenDone), 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	})
+	transport := &replyTransport{reply: reply}
+	cn := &Conn{connectionGood: true, sess: &tdsSession{buf: newTdsBuffer(defaultPacketSize, transport), logger: optionalLogger{}}}
+	b := cn.CreateBulkContext(ctx, "#bulk_1", nil)
+	b.headerSent = true
+	b.target = "t"
+	b.bulkColumns = []columnStruct{
+		{ColName: "name", ti: typeInfo{TypeId: typeIntN, Size: 4, Writer: writeByteLenType}},
+		{ColName: bulkRowColumn, ti: typeInfo{TypeId: typeIntN, Size: 4, Writer: writeByteLenType}},
+	}
+	cn.sess.buf.BeginPacket(packBulkLoadBCP, false)
+	cancel()
+	if err := b.AddRow([]interface{}{int64(1)}); err != context.Canceled {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	packets := transport.packets()
+	if len(packets) == 0 {
+		t.Fatal("nothing was sent")
+	}
+	last := packets[len(packets)-1]
+	want := str2ucs2("if object_id('tempdb..#bulk_1') is not null drop table #bulk_1;")
+	if packetType(last[0]) != packSQLBatch || !bytes.Contains(last, want) {
+		t.Errorf("got last packet %x, want a batch dropping the staging table", last)
+	}
+}
+
+func TestBulkReturnIdentity(t *testing.T) {
+	pool, logger := open(t)
+	defer pool.Close()
+	defer logger.StopLogging()
+
+	ctx := context.Background()
+	conn, err := pool.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err = conn.ExecContext(ctx, "create table #ids (id int identity(100, 5) primary key, name nvarchar(20) not null)"); err != nil {
+		t.Fatal(err)
+	}
+	var identities []int64
+	err = conn.Raw(func(driverConn interface{}) error {
+		b := driverConn.(*Conn).CreateBulkContext(ctx, "#ids", []string{"name"})
+		b.Options.ReturnIdentity = true
+		for _, name := range []string{"a", "b", "c"} {
+			if err := b.AddRow([]interface{}{name}); err != nil {
+				return err
+			}
+		}
+		n, err := b.Done()
+		if err == nil && n != 3 {
+			err = fmt.Errorf("inserted %d rows, want 3", n)
+		}
+		identities = b.Identities()
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, name := range []string{"a", "b", "c"} {
+		var got string
+		if err = conn.QueryRowContext(ctx, "select name from #ids where id = @p1", identities[i]).Scan(&got); err != nil {
+			t.Fatal(err)
+		}
+		if got != name {
+			t.Errorf("identity %d holds %s, want %s", identities[i], got, name)
+		}
+	}
+}
+
+func TestBulkPacketSize(t *testing.T) {
+	for _, tst := range []struct {
+		connSize, option, want int
+	}{
+		{32767, 0, 32767},
+		{defaultPacketSize, 0, defaultPacketSize},
+		{32767, 8192, 8192},
+		{defaultPacketSize, 8192, defaultPacketSize},
+		{32767, 100, 512},
+	} {
+		transport := &replyTransport{reply: &bytes.Buffer{}}
+		cn := &Conn{connectionGood: true, sess: &tdsSession{buf: newTdsBuffer(uint16(tst.connSize), transport)}}
+		b := cn.CreateBulkContext(context.Background(), "t", []string{"id"})
+		b.Options.PacketSize = tst.option
+		b.headerSent = true
+		b.bulkColumns = []columnStruct{{ColName: "id", ti: typeInfo{TypeId: typeIntN, Size: 4, Writer: writeByteLenType}}}
+		cn.sess.buf.BeginPacket(packBulkLoadBCP, false)
+		cn.sess.buf.SetWriteSize(b.packetSize())
+		for i := 0; i < 10000; i++ {
+			if err := b.AddRow([]interface{}{int64(i)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		cn.sess.buf.FinishPacket()
+		packets := transport.packets()
+		if len(packets) < 2 || len(packets[0]) != tst.want {
+			t.Errorf("packet size %d with option %d: got %d packets of %d bytes, want %d bytes", tst.connSize, tst.option, len(packets), len(packets[0]), tst.want)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package mssql
+
+import (
+	"database/sql/driver"
+	"strings"
+
+	"github.com/microsoft/go-mssqldb/internal/cp"
+	"golang.org/x/text/encoding"
+)
+
+// Collation is the collation of a character column, as described by the
+// column metadata sent by the server.
+type Collation struct {
+	// LCID is the Windows locale identifier of the collation.
+	LCID uint32
+	// SortID is the sort order of SQL collations, such as 52 for
+	// SQL_Latin1_General_CP1_CI_AS, and zero for Windows collations.
+	SortID uint8
+	// Version is the version of the collation, such as 1 for the _90
+	// collations and 2 for the _100 collations.
+	Version uint8
+
+	IgnoreCase   bool
+	IgnoreAccent bool
+	IgnoreKana   bool
+	IgnoreWidth  bool
+	Binary       bool
+	Binary2      bool
+	UTF8         bool
+}
+
+// Collation flags stored above the LCID.
+const (
+	collationIgnoreCase   = 0x00100000
+	collationIgnoreAccent = 0x00200000
+	collationIgnoreWidth  = 0x00400000
+	collationIgnoreKana   = 0x00800000
+	collationBinary       = 0x01000000
+	collationBinary2      = 0x02000000
+	collationUTF8         = 0x04000000
+)
+
+// utf8Collation is Latin1_General_100_CI_AS_SC_UTF8, the collation of the
+// varchar parameters sent once the server acknowledged UTF-8 support, so
+// their UTF-8 bytes are read as such.
+var utf8Collation = cp.Collation{
+	LcidAndFlags: 2<<28 | collationUTF8 | collationIgnoreWidth | collationIgnoreKana | collationIgnoreCase | 0x0409,
+}
+
+// varcharCollation returns the collation of the varchar parameters of c:
+// utf8Collation when the server acknowledged UTF-8 support, otherwise none,
+// which leaves the server to use the default collation of the database.
+func (c *Conn) varcharCollation() cp.Collation {
+	if c == nil || c.sess == nil || !c.sess.features.Has(FeatureUTF8Support) {
+		return cp.Collation{}
+	}
+	return utf8Collation
+}
+
+func newCollation(c cp.Collation) Collation {
+	return Collation{
+		LCID:         c.LcidAndFlags & 0x000fffff,
+		SortID:       c.SortId,
+		Version:      uint8(c.LcidAndFlags >> 28),
+		IgnoreCase:   c.LcidAndFlags&collationIgnoreCase != 0,
+		IgnoreAccent: c.LcidAndFlags&collationIgnoreAccent != 0,
+		IgnoreKana:   c.LcidAndFlags&collationIgnoreKana != 0,
+		IgnoreWidth:  c.LcidAndFlags&collationIgnoreWidth != 0,
+		Binary:       c.LcidAndFlags&collationBinary != 0,
+		Binary2:      c.LcidAndFlags&collationBinary2 != 0,
+		UTF8:         c.LcidAndFlags&collationUTF8 != 0,
+	}
+}
+
+// CodePage returns the Windows code page of the char, varchar and text data
+// of collation c, such as 1252 for SQL_Latin1_General_CP1_CI_AS, 65001 for
+// the UTF-8 collations and 0 for the Unicode-only collations.
+func (c Collation) CodePage() int {
+	col := cp.Collation{LcidAndFlags: c.LCID & 0x000fffff, SortId: c.SortID}
+	if c.UTF8 {
+		col.LcidAndFlags |= collationUTF8
+	}
+	return cp.CodePage(col)
+}
+
+// RegisterCodePage makes the driver decode the char, varchar and text data
+// of the collations of code page codePage with enc, such as an encoding of
+// golang.org/x/text/encoding/charmap. It replaces the built-in table of the
+// code page if there is one, so it can also correct how a code page is
+// read. A nil enc restores the built-in decoding.
+//
+// Data of a code page the driver has no table for is otherwise returned as
+// is when it is valid UTF-8, with invalid bytes replaced by U+FFFD.
+func RegisterCodePage(codePage int, enc encoding.Encoding) {
+	if enc == nil {
+		cp.RegisterDecoder(codePage, nil)
+		return
+	}
+	cp.RegisterDecoder(codePage, func(b []byte) string {
+		s, err := enc.NewDecoder().Bytes(b)
+		if err != nil {
+			return strings.ToValidUTF8(string(b), "\uFFFD")
+		}
+		return string(s)
+	})
+}
+
+// RowsColumnTypeCollation is implemented by the rows of the driver.
+// ColumnTypeCollation returns the collation of a character column, ok is
+// false for other columns. The driver rows can be reached with
+// sql.Conn.Raw.
+type RowsColumnTypeCollation interface {
+	driver.Rows
+	ColumnTypeCollation(index int) (collation Collation, ok bool)
+}
+
+func columnCollation(ti typeInfo) (Collation, bool) {
+	switch ti.TypeId {
+	case typeChar, typeVarChar, typeBigChar, typeBigVarChar, typeText,
+		typeNChar, typeNVarChar, typeNText:
+		return newCollation(ti.Collation), true
+	}
+	return Collation{}, false
+}
+
+// columnNullable reports the nullability of col from its metadata flags.
+func columnNullable(col columnStruct) (nullable, ok bool) {
+	if col.Flags&colFlagNullableUnknown != 0 {
+		return false, false
+	}
+	return col.Flags&colFlagNullable != 0, true
+}
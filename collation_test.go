@@ -0,0 +1,137 @@
+package mssql
+
+import (
+	"testing"
+
+	"github.com/microsoft/go-mssqldb/internal/cp"
+	"golang.org/x/text/encoding/charmap"
+)
+
+func TestColumnTypeCollation(t *testing.T) {
+	cols := []columnStruct{
+		// SQL_Latin1_General_CP1_CI_AS
+		{ti: typeInfo{TypeId: typeBigVarChar, Collation: cp.Collation{LcidAndFlags: 0x00d00409, SortId: 52}}, Flags: colFlagNullable},
+		// Latin1_General_100_BIN2_UTF8
+		{ti: typeInfo{TypeId: typeNVarChar, Collation: cp.Collation{LcidAndFlags: 0x26000409}}},
+		{ti: typeInfo{TypeId: typeInt4}, Flags: colFlagNullableUnknown},
+		// width insensitive only
+		{ti: typeInfo{TypeId: typeNVarChar, Collation: cp.Collation{LcidAndFlags: 0x00500409}}},
+		// kana insensitive only
+		{ti: typeInfo{TypeId: typeNVarChar, Collation: cp.Collation{LcidAndFlags: 0x00900409}}},
+	}
+	var r RowsColumnTypeCollation = &Rows{cols: cols}
+	c, ok := r.ColumnTypeCollation(0)
+	want := Collation{LCID: 0x409, SortID: 52, IgnoreCase: true, IgnoreKana: true, IgnoreWidth: true}
+	if !ok || c != want {
+		t.Errorf("got %+v, %v, want %+v", c, ok, want)
+	}
+	c, ok = r.ColumnTypeCollation(1)
+	want = Collation{LCID: 0x409, Version: 2, Binary2: true, UTF8: true}
+	if !ok || c != want {
+		t.Errorf("got %+v, %v, want %+v", c, ok, want)
+	}
+	if _, ok = r.ColumnTypeCollation(2); ok {
+		t.Error("an int column has no collation")
+	}
+	c, _ = r.ColumnTypeCollation(3)
+	if want = (Collation{LCID: 0x409, IgnoreCase: true, IgnoreWidth: true}); c != want {
+		t.Errorf("got %+v, want %+v", c, want)
+	}
+	c, _ = r.ColumnTypeCollation(4)
+	if want = (Collation{LCID: 0x409, IgnoreCase: true, IgnoreKana: true}); c != want {
+		t.Errorf("got %+v, want %+v", c, want)
+	}
+	var rq RowsColumnTypeCollation = &Rowsq{cols: cols}
+	if c, ok = rq.ColumnTypeCollation(0); !ok || c.SortID != 52 {
+		t.Errorf("Rowsq got %+v, %v", c, ok)
+	}
+
+	rows := &Rows{cols: cols}
+	if nullable, ok := rows.ColumnTypeNullable(0); !nullable || !ok {
+		t.Errorf("column 0 should be nullable, got %v, %v", nullable, ok)
+	}
+	if nullable, ok := rows.ColumnTypeNullable(1); nullable || !ok {
+		t.Errorf("column 1 should not be nullable, got %v, %v", nullable, ok)
+	}
+	if _, ok := rows.ColumnTypeNullable(2); ok {
+		t.Error("the nullability of column 2 is unknown")
+	}
+}
+
+func TestUTF8Collation(t *testing.T) {
+	if got := newCollation(utf8Collation); !got.UTF8 || got.LCID != 0x409 || got.Version != 2 || !got.IgnoreCase || got.IgnoreAccent {
+		t.Errorf("utf8Collation is %+v", got)
+	}
+
+	// é in UTF-8 would read as two cp1252 characters without the UTF-8 flag.
+	buf := []byte("caf\xc3\xa9")
+	if s := decodeChar(utf8Collation, buf); s != "café" {
+		t.Errorf("UTF-8 collation decoded %q", s)
+	}
+	if s := decodeChar(cp.Collation{LcidAndFlags: 0x00d00409, SortId: 52}, buf); s != "cafÃ©" {
+		t.Errorf("cp1252 collation decoded %q", s)
+	}
+
+	c := &Conn{sess: &tdsSession{}}
+	s := &Stmt{c: c}
+	p, err := s.makeParam(VarChar("café"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ti.Collation != (cp.Collation{}) {
+		t.Errorf("varchar parameters should have no collation without UTF-8 support, got %+v", p.ti.Collation)
+	}
+	c.sess.features = FeatureUTF8Support
+	p, err = s.makeParam(VarCharMax("café"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ti.Collation != utf8Collation || string(p.buffer) != "café" {
+		t.Errorf("got collation %+v and buffer %q", p.ti.Collation, p.buffer)
+	}
+}
+
+func TestCollationCodePage(t *testing.T) {
+	tests := []struct {
+		col  Collation
+		want int
+	}{
+		{Collation{LCID: 0x409, SortID: 52}, 1252},
+		{Collation{LCID: 0x409, SortID: 30}, 437},
+		{Collation{LCID: 0x411}, 932},
+		{Collation{LCID: 0x804}, 936},
+		{Collation{LCID: 0x412}, 949},
+		{Collation{LCID: 0x404}, 950},
+		{Collation{LCID: 0x440}, 1251},
+		{Collation{LCID: 0x437}, 0},
+		{Collation{LCID: 0x439}, 0},
+		{Collation{LCID: 0x409, Version: 2, UTF8: true}, 65001},
+	}
+	for _, tst := range tests {
+		if got := tst.col.CodePage(); got != tst.want {
+			t.Errorf("code page of %+v: got %d, want %d", tst.col, got, tst.want)
+		}
+	}
+}
+
+func TestRegisterCodePage(t *testing.T) {
+	col := cp.Collation{LcidAndFlags: 0x00d00409, SortId: 52}
+	if s := decodeChar(col, []byte{0x80}); s != "€" {
+		t.Fatalf("cp1252 decoded %q", s)
+	}
+	RegisterCodePage(1252, charmap.ISO8859_1)
+	s := decodeChar(col, []byte{0x80})
+	RegisterCodePage(1252, nil)
+	if s != "\u0080" {
+		t.Errorf("registered encoding decoded %q", s)
+	}
+	if s = decodeChar(col, []byte{0x80}); s != "€" {
+		t.Errorf("built-in table not restored, decoded %q", s)
+	}
+
+	// Unicode-only collations have no table: invalid UTF-8 is replaced.
+	georgian := cp.Collation{LcidAndFlags: 0x0437}
+	if s = decodeChar(georgian, []byte("a\xffb")); s != "a�b" {
+		t.Errorf("decoded %q", s)
+	}
+}
@@ -0,0 +1,259 @@
+package mssql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// ColumnSet holds the values of the sparse columns of a row, by column
+// name, as read from or written to the column_set column of its table,
+// which gathers the sparse columns that are not NULL in an XML fragment
+// such as <Color>red</Color><Weight>1.5</Weight>.
+//
+// Scanning a column_set column into a ColumnSet keeps the values as
+// strings, since the fragment does not hold their types; use
+// ParseColumnSet with the types of SparseColumnTypes to get typed values.
+// As a parameter, a ColumnSet is sent as its fragment, so that
+//
+//	db.ExecContext(ctx, "update t set cs = @p1 where id = @p2", mssql.ColumnSet{"Color": "blue"}, id)
+//
+// sets Color and sets the other sparse columns of the row to NULL. Values
+// can be strings, integers, floats, bools, []byte, time.Time, Decimal,
+// DateTimeOffset, UniqueIdentifier or nil for NULL.
+type ColumnSet map[string]interface{}
+
+// SparseColumnTypes returns the types of the sparse columns of table, by
+// column name, in upper case as with ColumnType.DatabaseTypeName, such as
+// INT or NVARCHAR. table is passed to OBJECT_ID, so it can be qualified by
+// a schema.
+func SparseColumnTypes(ctx context.Context, conn *sql.Conn, table string) (map[string]string, error) {
+	rows, err := conn.QueryContext(ctx, `select c.name, upper(type_name(c.system_type_id))
+from sys.columns c
+where c.object_id = object_id(@p1) and c.is_sparse = 1`, table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	types := make(map[string]string)
+	for rows.Next() {
+		var name, typ string
+		if err = rows.Scan(&name, &typ); err != nil {
+			return nil, err
+		}
+		types[name] = typ
+	}
+	return types, rows.Err()
+}
+
+// ParseColumnSet expands the value of a column_set column. The values of
+// the columns named in types, which maps column names to type names as
+// returned by SparseColumnTypes, are converted to the Go types the driver
+// returns for columns of their type: int64, float64, bool, []byte,
+// time.Time, UniqueIdentifier or string, with Decimal for decimal, numeric
+// and money columns. The other values are kept as strings.
+func ParseColumnSet(columnSet string, types map[string]string) (ColumnSet, error) {
+	cs := make(ColumnSet)
+	d := xml.NewDecoder(strings.NewReader(columnSet))
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			return cs, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("mssql: invalid column set: %v", err)
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok {
+			continue
+		}
+		var text string
+		if err = d.DecodeElement(&text, &start); err != nil {
+			return nil, fmt.Errorf("mssql: invalid column set: %v", err)
+		}
+		name := decodeXMLName(start.Name.Local)
+		typ, ok := types[name]
+		if !ok {
+			cs[name] = text
+			continue
+		}
+		if cs[name], err = parseColumnSetValue(text, typ); err != nil {
+			return nil, fmt.Errorf("mssql: invalid value %q of sparse column %s: %v", text, name, err)
+		}
+	}
+}
+
+func parseColumnSetValue(text, typ string) (interface{}, error) {
+	switch strings.ToUpper(typ) {
+	case "TINYINT", "SMALLINT", "INT", "BIGINT":
+		return strconv.ParseInt(text, 10, 64)
+	case "REAL", "FLOAT":
+		return strconv.ParseFloat(text, 64)
+	case "BIT":
+		return text == "1" || strings.EqualFold(text, "true"), nil
+	case "DECIMAL", "NUMERIC", "MONEY", "SMALLMONEY":
+		r, ok := new(big.Rat).SetString(text)
+		if !ok {
+			return nil, errors.New("not a number")
+		}
+		return DecimalFromRat(r)
+	case "DATE":
+		return time.Parse("2006-01-02", text)
+	case "TIME":
+		return time.Parse("15:04:05.999999999", text)
+	case "DATETIME", "DATETIME2", "SMALLDATETIME":
+		return time.Parse("2006-01-02T15:04:05.999999999", text)
+	case "DATETIMEOFFSET":
+		return time.Parse(time.RFC3339Nano, text)
+	case "BINARY", "VARBINARY":
+		return base64.StdEncoding.DecodeString(text)
+	case "UNIQUEIDENTIFIER":
+		var u UniqueIdentifier
+		err := u.Scan(text)
+		return u, err
+	}
+	return text, nil
+}
+
+// XML returns the column_set fragment of cs, with the columns in the
+// order of their names and the NULL ones left out.
+func (cs ColumnSet) XML() (string, error) {
+	names := make([]string, 0, len(cs))
+	for name := range cs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var sb strings.Builder
+	for _, name := range names {
+		if cs[name] == nil {
+			continue
+		}
+		text, err := formatColumnSetValue(cs[name])
+		if err != nil {
+			return "", fmt.Errorf("mssql: cannot write sparse column %s: %v", name, err)
+		}
+		elem := encodeXMLName(name)
+		sb.WriteString("<" + elem + ">")
+		if err = xml.EscapeText(&sb, []byte(text)); err != nil {
+			return "", err
+		}
+		sb.WriteString("</" + elem + ">")
+	}
+	return sb.String(), nil
+}
+
+func formatColumnSetValue(v interface{}) (string, error) {
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case []byte:
+		return base64.StdEncoding.EncodeToString(v), nil
+	case bool:
+		if v {
+			return "1", nil
+		}
+		return "0", nil
+	case int:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int8:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int16:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int32:
+		return strconv.FormatInt(int64(v), 10), nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	case uint8:
+		return strconv.FormatUint(uint64(v), 10), nil
+	case float32:
+		return strconv.FormatFloat(float64(v), 'g', -1, 32), nil
+	case float64:
+		return strconv.FormatFloat(v, 'g', -1, 64), nil
+	case Decimal:
+		return v.String(), nil
+	case time.Time:
+		return v.Format("2006-01-02T15:04:05.9999999"), nil
+	case DateTimeOffset:
+		return time.Time(v).Format("2006-01-02T15:04:05.9999999Z07:00"), nil
+	case UniqueIdentifier:
+		return v.String(), nil
+	}
+	return "", fmt.Errorf("unsupported type %T", v)
+}
+
+// Scan reads the fragment of a column_set column, keeping the values as
+// strings.
+func (cs *ColumnSet) Scan(v interface{}) error {
+	var s string
+	switch vt := v.(type) {
+	case string:
+		s = vt
+	case []byte:
+		s = string(vt)
+	case nil:
+	default:
+		return fmt.Errorf("mssql: cannot convert %T to ColumnSet", v)
+	}
+	parsed, err := ParseColumnSet(s, nil)
+	if err != nil {
+		return err
+	}
+	*cs = parsed
+	return nil
+}
+
+// Value returns the fragment of cs.
+func (cs ColumnSet) Value() (driver.Value, error) {
+	return cs.XML()
+}
+
+// encodeXMLName encodes name as an XML element name the way SQL Server
+// does, replacing the characters an XML name cannot hold with _xHHHH_.
+func encodeXMLName(name string) string {
+	var sb strings.Builder
+	for i, r := range name {
+		valid := r == '_' || unicode.IsLetter(r)
+		if i > 0 {
+			valid = valid || r == '-' || r == '.' || unicode.IsDigit(r)
+		}
+		if r == '_' && strings.HasPrefix(name[i:], "_x") {
+			valid = false
+		}
+		if valid {
+			sb.WriteRune(r)
+		} else {
+			fmt.Fprintf(&sb, "_x%04X_", r)
+		}
+	}
+	return sb.String()
+}
+
+// decodeXMLName reverses encodeXMLName.
+func decodeXMLName(name string) string {
+	if !strings.Contains(name, "_x") {
+		return name
+	}
+	var sb strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] == '_' && i+7 <= len(name) && name[i+1] == 'x' && name[i+6] == '_' {
+			if r, err := strconv.ParseUint(name[i+2:i+6], 16, 32); err == nil {
+				sb.WriteRune(rune(r))
+				i += 6
+				continue
+			}
+		}
+		sb.WriteByte(name[i])
+	}
+	return sb.String()
+}
@@ -0,0 +1,122 @@
+package mssql
+
+import (
+	"context"
+	"database/sql/driver"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseColumnSet(t *testing.T) {
+	const fragment = `<Color>red &amp; blue</Color><Weight>1.5</Weight><Qty>12</Qty><Active>1</Active>` +
+		`<Made>2024-03-01T10:20:30.123</Made><Blob>AQID</Blob><Unit_x0020_Name>kg</Unit_x0020_Name><Note>n</Note>`
+	types := map[string]string{
+		"Color": "NVARCHAR", "Weight": "DECIMAL", "Qty": "INT", "Active": "BIT",
+		"Made": "DATETIME", "Blob": "VARBINARY", "Unit Name": "VARCHAR",
+	}
+	cs, err := ParseColumnSet(fragment, types)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := ColumnSet{
+		"Color":     "red & blue",
+		"Qty":       int64(12),
+		"Active":    true,
+		"Made":      time.Date(2024, 3, 1, 10, 20, 30, 123000000, time.UTC),
+		"Blob":      []byte{1, 2, 3},
+		"Unit Name": "kg",
+		"Note":      "n",
+	}
+	if d, ok := cs["Weight"].(Decimal); !ok || d.String() != "1.5" {
+		t.Errorf("got weight %#v, want the decimal 1.5", cs["Weight"])
+	}
+	delete(cs, "Weight")
+	if !reflect.DeepEqual(cs, want) {
+		t.Errorf("got %#v, want %#v", cs, want)
+	}
+
+	if _, err = ParseColumnSet("<Qty>many</Qty>", types); err == nil {
+		t.Error("an invalid integer was accepted")
+	}
+	if _, err = ParseColumnSet("<Qty>1", types); err == nil {
+		t.Error("an unterminated element was accepted")
+	}
+}
+
+func TestColumnSetXML(t *testing.T) {
+	cs := ColumnSet{
+		"Color":     "a<b",
+		"Qty":       12,
+		"Active":    false,
+		"Blob":      []byte{1, 2, 3},
+		"Made":      time.Date(2024, 3, 1, 10, 20, 30, 500000000, time.UTC),
+		"Unit Name": "kg",
+		"Gone":      nil,
+	}
+	got, err := cs.XML()
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = `<Active>0</Active><Blob>AQID</Blob><Color>a&lt;b</Color><Made>2024-03-01T10:20:30.5</Made><Qty>12</Qty><Unit_x0020_Name>kg</Unit_x0020_Name>`
+	if got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if _, err = (ColumnSet{"x": struct{}{}}).XML(); err == nil {
+		t.Error("an unsupported value was accepted")
+	}
+
+	var scanned ColumnSet
+	if err = scanned.Scan(got); err != nil {
+		t.Fatal(err)
+	}
+	if scanned["Unit Name"] != "kg" || scanned["Color"] != "a<b" || len(scanned) != 6 {
+		t.Errorf("scanned %#v", scanned)
+	}
+	if v, err := cs.Value(); err != nil || v != driver.Value(want) {
+		t.Errorf("got value %v, %v", v, err)
+	}
+	if encodeXMLName("1_x") != "_x0031__x005F_x" || decodeXMLName("_x0031__x005F_x") != "1_x" {
+		t.Errorf("got %s", encodeXMLName("1_x"))
+	}
+}
+
+func TestColumnSetRoundTrip(t *testing.T) {
+	pool, logger := open(t)
+	defer pool.Close()
+	defer logger.StopLogging()
+
+	ctx := context.Background()
+	conn, err := pool.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, err = conn.ExecContext(ctx, "create table dbo.test_column_set (id int primary key, color nvarchar(20) sparse null, qty int sparse null, cs xml column_set for all_sparse_columns)")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.ExecContext(ctx, "drop table dbo.test_column_set")
+
+	if _, err = conn.ExecContext(ctx, "insert into dbo.test_column_set (id, cs) values (1, @p1)", ColumnSet{"color": "red", "qty": 3}); err != nil {
+		t.Fatal(err)
+	}
+	types, err := SparseColumnTypes(ctx, conn, "dbo.test_column_set")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if types["color"] != "NVARCHAR" || types["qty"] != "INT" || len(types) != 2 {
+		t.Errorf("got sparse column types %v", types)
+	}
+	var fragment string
+	if err = conn.QueryRowContext(ctx, "select cs from dbo.test_column_set where id = 1").Scan(&fragment); err != nil {
+		t.Fatal(err)
+	}
+	cs, err := ParseColumnSet(fragment, types)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (ColumnSet{"color": "red", "qty": int64(3)}); !reflect.DeepEqual(cs, want) {
+		t.Errorf("got %#v, want %#v", cs, want)
+	}
+}
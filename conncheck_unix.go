@@ -0,0 +1,34 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package mssql
+
+import (
+	"net"
+	"syscall"
+)
+
+// connAlive reports whether conn, idle between two requests, is still
+// open. It peeks at the socket without waiting: a healthy connection has
+// nothing to read, while the end of the stream or data sent unprompted,
+// such as the error of a killed session, mean the server or a middlebox
+// has closed it. Connections that do not expose their socket are assumed
+// to be alive.
+func connAlive(conn net.Conn) bool {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return true
+	}
+	rc, err := sc.SyscallConn()
+	if err != nil {
+		return true
+	}
+	alive := true
+	err = rc.Read(func(fd uintptr) bool {
+		var b [1]byte
+		_, _, err := syscall.Recvfrom(int(fd), b[:], syscall.MSG_PEEK|syscall.MSG_DONTWAIT)
+		alive = err == syscall.EAGAIN || err == syscall.EWOULDBLOCK || err == syscall.EINTR
+		return true
+	})
+	return alive && err == nil
+}
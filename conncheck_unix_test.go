@@ -0,0 +1,88 @@
+//go:build linux || darwin || freebsd || netbsd || openbsd || dragonfly
+// +build linux darwin freebsd netbsd openbsd dragonfly
+
+package mssql
+
+import (
+	"context"
+	"database/sql/driver"
+	"net"
+	"testing"
+	"time"
+)
+
+// tcpPair returns the two ends of a loopback TCP connection.
+func tcpPair(t *testing.T) (client, server net.Conn) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("cannot listen on loopback:", err)
+	}
+	defer l.Close()
+	client, err = net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err = l.Accept()
+	if err != nil {
+		client.Close()
+		t.Fatal(err)
+	}
+	return client, server
+}
+
+// waitDead waits for connAlive to notice what the server end did.
+func waitDead(conn net.Conn) bool {
+	for i := 0; i < 100; i++ {
+		if !connAlive(conn) {
+			return true
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	return false
+}
+
+func TestConnAlive(t *testing.T) {
+	client, server := tcpPair(t)
+	defer client.Close()
+	if !connAlive(client) {
+		t.Fatal("an idle connection should be alive")
+	}
+	server.Close()
+	if !waitDead(client) {
+		t.Error("a connection closed by the server should not be alive")
+	}
+
+	client, server = tcpPair(t)
+	defer client.Close()
+	defer server.Close()
+	if _, err := server.Write([]byte{0xaa}); err != nil {
+		t.Fatal(err)
+	}
+	if !waitDead(client) {
+		t.Error("a connection with unprompted data should not be alive")
+	}
+
+	if !connAlive(nil) {
+		t.Error("a connection without a socket should be assumed alive")
+	}
+}
+
+func TestResetSessionClosedConn(t *testing.T) {
+	client, server := tcpPair(t)
+	defer client.Close()
+	c := &Conn{sess: &tdsSession{conn: client}, connectionGood: true}
+	if err := c.ResetSession(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	server.Close()
+	if !waitDead(client) {
+		t.Fatal("the close was not seen")
+	}
+	if err := c.ResetSession(context.Background()); err != driver.ErrBadConn {
+		t.Errorf("got %v, want driver.ErrBadConn", err)
+	}
+	if c.IsValid() {
+		t.Error("the connection should no longer be valid")
+	}
+}
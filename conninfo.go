@@ -0,0 +1,101 @@
+package mssql
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/microsoft/go-mssqldb/msdsn"
+)
+
+// ConnectionInfo describes what a connection negotiated with the server
+// while logging in, as returned by Conn.ConnectionInfo.
+type ConnectionInfo struct {
+	// TDSVersion is the TDS version acknowledged by the server at login,
+	// such as 0x74000004 for TDS 7.4 or 0x08000000 for TDS 8.0.
+	TDSVersion uint32
+	// ServerVersion is the version of the server sent in its prelogin
+	// response, such as "16.0.1000".
+	ServerVersion string
+	// Encryption is the encryption in effect: EncryptionStrict for TDS 8.0,
+	// EncryptionRequired when the whole connection is encrypted,
+	// EncryptionOff when only the login packet is and EncryptionDisabled
+	// when nothing is.
+	Encryption msdsn.Encryption
+	// Instance is the named instance the connection asked for, which the
+	// server accepted in its prelogin response. It is empty for the default
+	// instance.
+	Instance string
+	// ThreadID is the thread id sent by the server in its prelogin
+	// response, usually zero as servers leave it out.
+	ThreadID uint32
+	// FedAuthRequired is set when the prelogin response of the server asked
+	// for federated authentication to be acknowledged at login.
+	FedAuthRequired bool
+	// RoutedFrom is the "host:port" address of the server dialed when its
+	// login routed the connection to RoutedTo, as the gateways of Azure SQL
+	// Database and Managed Instance do under the redirect connection
+	// policy. Both are empty when the connection is to the server dialed,
+	// as under the proxy policy.
+	RoutedFrom string
+	RoutedTo   string
+}
+
+// tdsVersionString returns v in the major.minor form, such as "7.4".
+func tdsVersionString(v uint32) string {
+	if v == verTDS80 {
+		return "8.0"
+	}
+	return fmt.Sprintf("%d.%d", v>>28, (v>>24)&0xf)
+}
+
+// String formats the main facts of i on one line, for logs and health
+// checks.
+func (i ConnectionInfo) String() string {
+	s := fmt.Sprintf("TDS %s, server %s, encryption %s, fedauth required %t",
+		tdsVersionString(i.TDSVersion), i.ServerVersion, encryptionName(i.Encryption), i.FedAuthRequired)
+	if i.RoutedFrom != "" {
+		s += fmt.Sprintf(", routed from %s to %s", i.RoutedFrom, i.RoutedTo)
+	}
+	return s
+}
+
+func encryptionName(e msdsn.Encryption) string {
+	switch e {
+	case msdsn.EncryptionOff:
+		return "login only"
+	case msdsn.EncryptionRequired:
+		return "on"
+	case msdsn.EncryptionDisabled:
+		return "off"
+	case msdsn.EncryptionStrict:
+		return "strict"
+	}
+	return fmt.Sprintf("unknown (%d)", e)
+}
+
+// preloginInfo returns the ConnectionInfo of the prelogin response fields
+// of the server, with the encrypt option it answered. strict is set when
+// the connection was encrypted before the prelogin.
+func preloginInfo(p msdsn.Config, fields map[uint8][]byte, encrypt byte, strict bool) ConnectionInfo {
+	info := ConnectionInfo{Instance: p.Instance}
+	if v := fields[preloginVERSION]; len(v) >= 4 {
+		info.ServerVersion = fmt.Sprintf("%d.%d.%d", v[0], v[1], binary.BigEndian.Uint16(v[2:]))
+	}
+	if v := fields[preloginTHREADID]; len(v) == 4 {
+		info.ThreadID = binary.BigEndian.Uint32(v)
+	}
+	if v := fields[preloginFEDAUTHREQUIRED]; len(v) == 1 {
+		info.FedAuthRequired = v[0] != 0
+	}
+	switch {
+	case strict:
+		info.Encryption = msdsn.EncryptionStrict
+	case encrypt == encryptNotSup:
+		info.Encryption = msdsn.EncryptionDisabled
+	case encrypt == encryptOff:
+		info.Encryption = msdsn.EncryptionOff
+	default:
+		info.Encryption = msdsn.EncryptionRequired
+	}
+	return info
+}
@@ -0,0 +1,49 @@
+package mssql
+
+import (
+	"testing"
+
+	"github.com/microsoft/go-mssqldb/msdsn"
+)
+
+func TestPreloginInfo(t *testing.T) {
+	fields := map[uint8][]byte{
+		preloginVERSION:         {16, 0, 0x03, 0xe8, 0, 0},
+		preloginTHREADID:        {0, 0, 0x12, 0x34},
+		preloginFEDAUTHREQUIRED: {0},
+	}
+	info := preloginInfo(msdsn.Config{Instance: "SQLEXPRESS"}, fields, encryptOn, false)
+	want := ConnectionInfo{
+		ServerVersion: "16.0.1000",
+		Encryption:    msdsn.EncryptionRequired,
+		Instance:      "SQLEXPRESS",
+		ThreadID:      0x1234,
+	}
+	if info != want {
+		t.Errorf("got %+v, want %+v", info, want)
+	}
+
+	encryptions := []struct {
+		encrypt byte
+		strict  bool
+		want    msdsn.Encryption
+	}{
+		{encryptOff, false, msdsn.EncryptionOff},
+		{encryptReq, false, msdsn.EncryptionRequired},
+		{encryptNotSup, false, msdsn.EncryptionDisabled},
+		{encryptStrict, true, msdsn.EncryptionStrict},
+	}
+	for _, e := range encryptions {
+		if got := preloginInfo(msdsn.Config{}, nil, e.encrypt, e.strict).Encryption; got != e.want {
+			t.Errorf("encrypt %d: got %d, want %d", e.encrypt, got, e.want)
+		}
+	}
+
+	info = ConnectionInfo{TDSVersion: verTDS74, ServerVersion: "16.0.1000", Encryption: msdsn.EncryptionRequired}
+	if s := info.String(); s != "TDS 7.4, server 16.0.1000, encryption on, fedauth required false" {
+		t.Errorf("got %q", s)
+	}
+	if s := tdsVersionString(verTDS80); s != "8.0" {
+		t.Errorf("got TDS version %q, want 8.0", s)
+	}
+}
@@ -0,0 +1,64 @@
+package mssql
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+)
+
+// ContextInfoSize is the largest CONTEXT_INFO a session can hold, in bytes.
+const ContextInfoSize = 128
+
+// WithContextInfo returns a context that runs the statements executed with
+// it after SET CONTEXT_INFO info, so that Extended Events sessions capturing
+// the sqlserver.context_info action, as well as sys.dm_exec_requests and
+// sys.dm_exec_sessions, can tell which client request each statement
+// belongs to. info holds up to ContextInfoSize bytes, such as the trace and
+// span ids of TraceContextInfo; a longer info fails the statements. To tag
+// the statements of a transaction, run them with the same ctx.
+//
+// The context info stays set on the connection after the statement, as the
+// session context of WithRequestID does. Like the other statement options,
+// it cannot be applied to a stored procedure call. An empty info removes the context info of ctx.
+func WithContextInfo(ctx context.Context, info []byte) context.Context {
+	opts := queryOptionsFromContext(ctx)
+	opts.contextInfo = append([]byte(nil), info...)
+	return context.WithValue(ctx, queryOptionsKey{}, opts)
+}
+
+// TraceContextInfo returns the context info of the W3C trace context
+// traceparent, such as
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", for
+// WithContextInfo: the 16 bytes of the trace id followed by the 8 bytes of
+// the span id, which T-SQL reads with substring(context_info(), 1, 16) and
+// substring(context_info(), 17, 8).
+func TraceContextInfo(traceparent string) ([]byte, error) {
+	tc, err := parseTraceParent(traceparent)
+	if err != nil {
+		return nil, err
+	}
+	info := make([]byte, 0, len(tc.traceID)+len(tc.spanID))
+	info = append(info, tc.traceID[:]...)
+	return append(info, tc.spanID[:]...), nil
+}
+
+// ParseTraceContextInfo returns the trace and span ids of a context info
+// made by TraceContextInfo, such as that captured by an Extended Events
+// session. The server pads the context info with zeros to ContextInfoSize
+// bytes. ok is false when info is too short or holds zero ids.
+func ParseTraceContextInfo(info []byte) (traceID [16]byte, spanID [8]byte, ok bool) {
+	if len(info) < len(traceID)+len(spanID) {
+		return traceID, spanID, false
+	}
+	copy(traceID[:], info)
+	copy(spanID[:], info[len(traceID):])
+	return traceID, spanID, traceID != [16]byte{} && spanID != [8]byte{}
+}
+
+// contextInfoStatement returns the statement setting the context info.
+func contextInfoStatement(info []byte) (string, error) {
+	if len(info) > ContextInfoSize {
+		return "", fmt.Errorf("mssql: context info of %d bytes is longer than %d bytes", len(info), ContextInfoSize)
+	}
+	return "SET CONTEXT_INFO 0x" + hex.EncodeToString(info) + ";", nil
+}
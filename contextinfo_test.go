@@ -0,0 +1,73 @@
+package mssql
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"testing"
+)
+
+func TestTraceContextInfo(t *testing.T) {
+	info, err := TraceContextInfo(testTraceParent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "4bf92f3577b34da6a3ce929d0e0e473600f067aa0ba902b7"; hex.EncodeToString(info) != want {
+		t.Errorf("got %x, want %s", info, want)
+	}
+	if _, err = TraceContextInfo("bad"); err == nil {
+		t.Error("an invalid traceparent was accepted")
+	}
+
+	padded := append(info, make([]byte, ContextInfoSize-len(info))...)
+	traceID, spanID, ok := ParseTraceContextInfo(padded)
+	if !ok || !bytes.Equal(traceID[:], info[:16]) || !bytes.Equal(spanID[:], info[16:]) {
+		t.Errorf("got trace id %x, span id %x, %v", traceID, spanID, ok)
+	}
+	if _, _, ok = ParseTraceContextInfo(info[:20]); ok {
+		t.Error("a short context info was parsed")
+	}
+	if _, _, ok = ParseTraceContextInfo(make([]byte, ContextInfoSize)); ok {
+		t.Error("a context info of zeros was parsed")
+	}
+}
+
+func TestWithContextInfoCopies(t *testing.T) {
+	info := []byte{1, 2}
+	ctx := WithContextInfo(context.Background(), info)
+	info[0] = 9
+	if got := queryOptionsFromContext(ctx).contextInfo; !bytes.Equal(got, []byte{1, 2}) {
+		t.Errorf("context info changed with the caller's slice: %x", got)
+	}
+}
+
+func TestContextInfo(t *testing.T) {
+	conn, logger := open(t)
+	defer conn.Close()
+	defer logger.StopLogging()
+
+	ctx := context.Background()
+	c, err := conn.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	info, err := TraceContextInfo(testTraceParent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []byte
+	err = c.QueryRowContext(WithContextInfo(ctx, info), "select context_info from sys.dm_exec_requests where session_id = @@SPID").Scan(&got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	traceID, spanID, ok := ParseTraceContextInfo(got)
+	if !ok || !bytes.Equal(traceID[:], info[:16]) || !bytes.Equal(spanID[:], info[16:]) {
+		t.Errorf("got context info %x, want %x", got, info)
+	}
+
+	if _, err = c.ExecContext(WithContextInfo(ctx, info), "sp_who"); err == nil {
+		t.Error("expected an error for a context info on a stored procedure call")
+	}
+}
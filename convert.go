@@ -18,6 +18,7 @@ import (
 	"database/sql"
 	"database/sql/driver"
 	"fmt"
+	"math/big"
 	"reflect"
 	"strconv"
 	"time"
@@ -78,6 +79,15 @@ func convertAssign(dest, src interface{}) error {
 			}
 			*d = s
 			return nil
+		case *big.Rat:
+			// decimal and numeric values
+			if d == nil {
+				return errNilPtr
+			}
+			if _, ok := d.SetString(string(s)); !ok {
+				return fmt.Errorf("converting %q to a *big.Rat", s)
+			}
+			return nil
 		}
 	case time.Time:
 		switch d := dest.(type) {
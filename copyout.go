@@ -0,0 +1,136 @@
+package mssql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+)
+
+// CopyOutColumn describes a column of the result of CopyOut.
+type CopyOutColumn struct {
+	Name string
+	// DatabaseTypeName is the name of the type of the column, as returned
+	// by sql.ColumnType.DatabaseTypeName.
+	DatabaseTypeName string
+	// Length is the length of variable length columns, as returned by
+	// sql.ColumnType.Length, and zero for other columns.
+	Length   int64
+	Nullable bool
+}
+
+// RowWriter receives the result of CopyOut.
+type RowWriter interface {
+	// WriteColumns is called once with the columns of the result, before
+	// the first row.
+	WriteColumns(cols []CopyOutColumn) error
+	// WriteRow is called for each row. The values are those the driver
+	// returns to database/sql, such as int64, float64, bool, string,
+	// []byte and time.Time, with nil for NULL, except that varbinary,
+	// binary, varchar and char values are read as with WithRawBytes: into
+	// buffers reused from row to row, the varchar and char values as
+	// []byte holding UTF-8 text. The row and the []byte values in it are
+	// only valid until WriteRow returns.
+	WriteRow(row []driver.Value) error
+}
+
+// CopyOut runs query on conn and streams its first result set to w, and
+// returns the number of rows written. The values of each row are passed
+// as decoded by the driver, without the conversions of sql.Rows.Scan, in
+// a slice reused for every row, and binary and character values are not
+// allocated or converted to strings one by one, see RowWriter. Errors
+// returned by w stop the query: it is canceled rather than read to the
+// end.
+func CopyOut(ctx context.Context, conn *sql.Conn, w RowWriter, query string, args ...interface{}) (n int64, err error) {
+	err = conn.Raw(func(driverConn interface{}) error {
+		c, ok := driverConn.(*Conn)
+		if !ok {
+			return errors.New("mssql: CopyOut needs a connection of this driver")
+		}
+		n, err = c.copyOut(ctx, w, query, args)
+		return err
+	})
+	return n, err
+}
+
+func (c *Conn) copyOut(ctx context.Context, w RowWriter, query string, args []interface{}) (int64, error) {
+	defer c.clearOuts()
+	// canceled when w fails, so that closing the rows does not read the
+	// rest of the result
+	ctx, cancel := context.WithCancel(WithRawBytes(ctx))
+	defer cancel()
+	list, err := c.namedValues(args)
+	if err != nil {
+		return 0, err
+	}
+	stmt, err := c.prepareContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+	if !c.connectionGood {
+		return 0, driver.ErrBadConn
+	}
+	rows, err := stmt.queryContext(ctx, list)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+
+	names := rows.Columns()
+	cols := make([]CopyOutColumn, len(names))
+	for i, name := range names {
+		cols[i].Name = name
+		if r, ok := rows.(driver.RowsColumnTypeDatabaseTypeName); ok {
+			cols[i].DatabaseTypeName = r.ColumnTypeDatabaseTypeName(i)
+		}
+		if r, ok := rows.(driver.RowsColumnTypeLength); ok {
+			cols[i].Length, _ = r.ColumnTypeLength(i)
+		}
+		if r, ok := rows.(driver.RowsColumnTypeNullable); ok {
+			cols[i].Nullable, _ = r.ColumnTypeNullable(i)
+		}
+	}
+	if err = w.WriteColumns(cols); err != nil {
+		cancel()
+		return 0, err
+	}
+	var n int64
+	row := make([]driver.Value, len(cols))
+	for {
+		err = rows.Next(row)
+		if err == io.EOF {
+			return n, nil
+		}
+		if err != nil {
+			return n, err
+		}
+		if err = w.WriteRow(row); err != nil {
+			cancel()
+			return n, err
+		}
+		n++
+	}
+}
+
+// namedValues converts the arguments of a query given to a helper such as
+// CopyOut, which database/sql does not see, as database/sql would. The
+// arguments CheckNamedValue removes, such as *ReturnStatus, are left out.
+func (c *Conn) namedValues(args []interface{}) ([]namedValue, error) {
+	list := make([]namedValue, 0, len(args))
+	for _, arg := range args {
+		nv := driver.NamedValue{Ordinal: len(list) + 1, Value: arg}
+		if named, ok := arg.(sql.NamedArg); ok {
+			nv.Name, nv.Value = named.Name, named.Value
+		}
+		switch err := c.CheckNamedValue(&nv); err {
+		case nil:
+			list = append(list, namedValueFromDriverNamedValue(nv))
+		case driver.ErrRemoveArgument:
+		default:
+			return nil, err
+		}
+	}
+	return list, nil
+}
@@ -0,0 +1,138 @@
+package mssql
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type testRowWriter struct {
+	cols   []CopyOutColumn
+	rows   [][]driver.Value
+	failAt int
+}
+
+func (w *testRowWriter) WriteColumns(cols []CopyOutColumn) error {
+	w.cols = cols
+	return nil
+}
+
+func (w *testRowWriter) WriteRow(row []driver.Value) error {
+	if len(w.rows) == w.failAt {
+		return errors.New("write failed")
+	}
+	w.rows = append(w.rows, append([]driver.Value(nil), row...))
+	return nil
+}
+
+func TestNamedValuesRemoveArgument(t *testing.T) {
+	c := &Conn{}
+	var rs ReturnStatus
+	list, err := c.namedValues([]interface{}{int64(1), &rs, int64(2)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 2 || list[0].Ordinal != 1 || list[1].Ordinal != 2 || list[1].Value != int64(2) {
+		t.Errorf("got arguments %+v, want the two values without the return status", list)
+	}
+	if c.outs.returnStatus != &rs {
+		t.Error("the return status destination was not set")
+	}
+}
+
+func TestCopyOutRawBytes(t *testing.T) {
+	var tokens bytes.Buffer
+	tokens.WriteByte(byte(tokenColMetadata))
+	_ = binary.Write(&tokens, binary.LittleEndian, uint16(1))
+	_ = binary.Write(&tokens, binary.LittleEndian, uint32(0)) // user type
+	_ = binary.Write(&tokens, binary.LittleEndian, uint16(1)) // nullable
+	tokens.Write([]byte{typeBigVarChar, 10, 0, 0x09, 0x04, 0xd0, 0x00, 0x34})
+	tokens.Write([]byte{1, 's', 0})
+	for _, v := range []string{"ab", "cd"} {
+		tokens.WriteByte(byte(tokenRow))
+		_ = binary.Write(&tokens, binary.LittleEndian, uint16(len(v)))
+		tokens.WriteString(v)
+	}
+	tokens.WriteByte(byte(tokenDone))
+	_ = binary.Write(&tokens, binary.LittleEndian, []uint16{doneCount, 0})
+	_ = binary.Write(&tokens, binary.LittleEndian, uint64(2))
+	reply := bytes.NewBuffer([]byte{byte(packReply), statusEOM, 0, byte(8 + tokens.Len()), 0, 0, 1, 0})
+	reply.Write(tokens.Bytes())
+	c := &Conn{
+		connectionGood: true,
+		sess: &tdsSession{
+			buf:      newTdsBuffer(defaultPacketSize, &replyTransport{reply: reply}),
+			logger:   optionalLogger{},
+			loginAck: loginAckStruct{TDSVersion: verTDS74},
+		},
+	}
+	w := &testRowWriter{failAt: -1}
+	n, err := c.copyOut(context.Background(), w, "select s from t", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("wrote %d rows, want 2", n)
+	}
+	want := [][]driver.Value{{[]byte("ab")}, {[]byte("cd")}}
+	if !reflect.DeepEqual(w.rows, want) {
+		t.Errorf("got rows %#v, want the varchar values as bytes %#v", w.rows, want)
+	}
+}
+
+func TestCopyOut(t *testing.T) {
+	pool, logger := open(t)
+	defer pool.Close()
+	defer logger.StopLogging()
+
+	ctx := context.Background()
+	conn, err := pool.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	query := "select n, cast(n as nvarchar(10)) as s, cast(null as int) as z from (values (1), (2), (3)) v(n) where n >= @p1 order by n"
+	w := &testRowWriter{failAt: -1}
+	n, err := CopyOut(ctx, conn, w, query, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("copied %d rows, want 2", n)
+	}
+	wantCols := []CopyOutColumn{
+		{Name: "n", DatabaseTypeName: "INT"},
+		{Name: "s", DatabaseTypeName: "NVARCHAR", Length: 10},
+		{Name: "z", DatabaseTypeName: "INT", Nullable: true},
+	}
+	if len(w.cols) != len(wantCols) {
+		t.Fatalf("got columns %+v", w.cols)
+	}
+	for i, col := range w.cols {
+		// only the nullability of the NULL column is certain
+		if i != 2 {
+			col.Nullable = false
+		}
+		if col != wantCols[i] {
+			t.Errorf("column %d: got %+v, want %+v", i, col, wantCols[i])
+		}
+	}
+	wantRows := [][]driver.Value{{int64(2), "2", nil}, {int64(3), "3", nil}}
+	if !reflect.DeepEqual(w.rows, wantRows) {
+		t.Errorf("got rows %v", w.rows)
+	}
+
+	w = &testRowWriter{failAt: 1}
+	if n, err = CopyOut(ctx, conn, w, query, 1); err == nil || n != 1 {
+		t.Errorf("a failed write should stop the copy, got %d rows, %v", n, err)
+	}
+	var one int
+	if err = conn.QueryRowContext(ctx, "select 1").Scan(&one); err != nil {
+		t.Errorf("connection unusable after a failed copy: %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+//go:build go1.9
+// +build go1.9
+
+package mssql
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"time"
+)
+
+// NullDateTimeOffset represents a DateTimeOffset that may be null.
+// NullDateTimeOffset implements the Scanner interface so
+// it can be used as a scan destination, similar to sql.NullTime.
+// As a parameter a null value is sent as a null datetimeoffset.
+type NullDateTimeOffset struct {
+	DateTimeOffset DateTimeOffset
+	Valid          bool // Valid is true if DateTimeOffset is not NULL
+}
+
+// Scan implements the sql.Scanner interface. datetimeoffset columns and
+// output parameters keep the offset stored in the database, whatever the
+// time zone of the client. Strings are parsed in the RFC 3339 format.
+func (d *DateTimeOffset) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case time.Time:
+		*d = DateTimeOffset(v)
+	case string:
+		return d.parse(v)
+	case []byte:
+		return d.parse(string(v))
+	default:
+		return fmt.Errorf("mssql: cannot scan %T into DateTimeOffset", src)
+	}
+	return nil
+}
+
+func (d *DateTimeOffset) parse(s string) error {
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return fmt.Errorf("mssql: cannot scan %q into DateTimeOffset: %v", s, err)
+	}
+	*d = DateTimeOffset(t)
+	return nil
+}
+
+// Scan implements the sql.Scanner interface.
+func (n *NullDateTimeOffset) Scan(src interface{}) error {
+	if src == nil {
+		n.DateTimeOffset, n.Valid = DateTimeOffset{}, false
+		return nil
+	}
+	n.Valid = true
+	return n.DateTimeOffset.Scan(src)
+}
+
+// Value implements the driver.Valuer interface.
+func (n NullDateTimeOffset) Value() (driver.Value, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	return time.Time(n.DateTimeOffset), nil
+}
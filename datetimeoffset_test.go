@@ -0,0 +1,93 @@
+package mssql
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+)
+
+func TestDateTimeOffsetScan(t *testing.T) {
+	buf := encodeDateTimeOffset(time.Date(2006, 1, 2, 22, 4, 5, 787001500, time.FixedZone("", -7*60*60)), 7)
+	var d DateTimeOffset
+	if err := d.Scan(decodeDateTimeOffset(7, buf)); err != nil {
+		t.Fatal(err)
+	}
+	tm := time.Time(d)
+	if _, offset := tm.Zone(); offset != -7*60*60 {
+		t.Errorf("offset %d was not preserved", offset)
+	}
+	if got := tm.Format(time.RFC3339Nano); got != "2006-01-02T22:04:05.7870015-07:00" {
+		t.Errorf("got %s", got)
+	}
+
+	if err := d.Scan("2006-01-02T22:04:05+05:30"); err != nil {
+		t.Fatal(err)
+	}
+	if _, offset := time.Time(d).Zone(); offset != 5*60*60+30*60 {
+		t.Errorf("offset %d of the string was not preserved", offset)
+	}
+	if err := d.Scan(int64(1)); err == nil {
+		t.Error("scanning an int should fail")
+	}
+
+	var n NullDateTimeOffset
+	if err := n.Scan(nil); err != nil || n.Valid {
+		t.Errorf("NULL should scan into an invalid NullDateTimeOffset, got %+v, %v", n, err)
+	}
+	if err := n.Scan(time.Time(d)); err != nil || !n.Valid || !time.Time(n.DateTimeOffset).Equal(time.Time(d)) {
+		t.Errorf("got %+v, %v", n, err)
+	}
+}
+
+func TestMakeNullDateTimeOffsetParam(t *testing.T) {
+	s := &Stmt{}
+	p, err := s.makeParam(NullDateTimeOffset{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ti.TypeId != typeDateTimeOffsetN || len(p.buffer) != 0 || makeDecl(p.ti) != "datetimeoffset(7)" {
+		t.Errorf("NULL should be sent as a null datetimeoffset, got %+v", p.ti)
+	}
+	tm := time.Date(2020, 5, 6, 7, 8, 9, 0, time.FixedZone("", 3600))
+	p, err = s.makeParam(NullDateTimeOffset{DateTimeOffset: DateTimeOffset(tm), Valid: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ti.TypeId != typeDateTimeOffsetN || !decodeDateTimeOffset(p.ti.Scale, p.buffer).Equal(tm) {
+		t.Errorf("unexpected parameter %+v", p.ti)
+	}
+}
+
+func TestNullDateTimeOffsetOutParam(t *testing.T) {
+	conn, logger := open(t)
+	defer conn.Close()
+	defer logger.StopLogging()
+
+	var col DateTimeOffset
+	var null NullDateTimeOffset
+	err := conn.QueryRowContext(context.Background(),
+		"select cast('2006-01-02 22:04:05.7870015 +09:00' as datetimeoffset), cast(NULL as datetimeoffset)").Scan(&col, &null)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, offset := time.Time(col).Zone(); offset != 9*60*60 {
+		t.Errorf("offset %d was not preserved", offset)
+	}
+	if null.Valid {
+		t.Error("NULL should scan into an invalid NullDateTimeOffset")
+	}
+
+	var out NullDateTimeOffset
+	_, err = conn.ExecContext(context.Background(), "set @out = cast('2006-01-02 22:04:05 -03:00' as datetimeoffset)",
+		sql.Named("out", sql.Out{Dest: &out}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !out.Valid {
+		t.Fatal("output parameter should be valid")
+	}
+	if _, offset := time.Time(out.DateTimeOffset).Zone(); offset != -3*60*60 {
+		t.Errorf("output parameter offset %d was not preserved", offset)
+	}
+}
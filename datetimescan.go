@@ -0,0 +1,120 @@
+package mssql
+
+import (
+	"database/sql/driver"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/golang-sql/civil"
+	"github.com/microsoft/go-mssqldb/msdsn"
+)
+
+func (c *Conn) dateTimeScan() string {
+	if c.connector == nil || c.connector.params.Encoding.DateTimeScan == "" {
+		return msdsn.DateTimeScanTime
+	}
+	return c.connector.params.Encoding.DateTimeScan
+}
+
+// timezone returns the time zone of the date and time values of a
+// statement run with opts: that of WithTimezone, else that of the
+// connection string. Nil is UTC.
+func (c *Conn) timezone(opts queryOptions) *time.Location {
+	if opts.timezone != nil {
+		return opts.timezone
+	}
+	if c.connector == nil {
+		return nil
+	}
+	return c.connector.params.Encoding.Timezone
+}
+
+// setTimezone moves the time.Time values of the columns without a time
+// zone to loc, keeping the wall clock read from the server.
+func setTimezone(cols []columnStruct, dest []driver.Value, loc *time.Location) {
+	for i, v := range dest {
+		t, ok := v.(time.Time)
+		if !ok {
+			continue
+		}
+		switch cols[i].originalTypeInfo().TypeId {
+		case typeDateTime, typeDateTim4, typeDateTimeN, typeDateN, typeTimeN, typeDateTime2N:
+			dest[i] = time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), loc)
+		}
+	}
+}
+
+// inTimezone returns t in loc, or t when loc is nil. The server keeps only
+// the wall clock of the time.Time parameters stored in columns without a
+// time zone.
+func inTimezone(t time.Time, loc *time.Location) time.Time {
+	if loc == nil {
+		return t
+	}
+	return t.In(loc)
+}
+
+// convertDateTimes replaces the time.Time values of date, time and
+// datetime2 columns by civil values or strings, following the
+// datetimescan connection parameter. These types have no time zone, so
+// the values are returned without one.
+func convertDateTimes(cols []columnStruct, dest []driver.Value, mode string) {
+	for i, v := range dest {
+		t, ok := v.(time.Time)
+		if !ok {
+			continue
+		}
+		ti := cols[i].originalTypeInfo()
+		switch ti.TypeId {
+		case typeDateN:
+			if mode == msdsn.DateTimeScanCivil {
+				dest[i] = civil.DateOf(t)
+			} else {
+				dest[i] = t.Format("2006-01-02")
+			}
+		case typeTimeN:
+			if mode == msdsn.DateTimeScanCivil {
+				dest[i] = civil.TimeOf(t)
+			} else {
+				dest[i] = t.Format("15:04:05" + fractionLayout(ti.Scale))
+			}
+		case typeDateTime2N:
+			if mode == msdsn.DateTimeScanCivil {
+				dest[i] = civil.DateTimeOf(t)
+			} else {
+				dest[i] = t.Format("2006-01-02 15:04:05" + fractionLayout(ti.Scale))
+			}
+		}
+	}
+}
+
+// fractionLayout returns the time layout of scale fractional digits of a second.
+func fractionLayout(scale uint8) string {
+	if scale == 0 {
+		return ""
+	}
+	return "." + strings.Repeat("0", int(scale))
+}
+
+// dateTimeScanType returns the scan type of date, time and datetime2
+// columns for the datetimescan mode, or nil for the default.
+func dateTimeScanType(typeId uint8, mode string) reflect.Type {
+	switch mode {
+	case msdsn.DateTimeScanCivil:
+		switch typeId {
+		case typeDateN:
+			return reflect.TypeOf(civil.Date{})
+		case typeTimeN:
+			return reflect.TypeOf(civil.Time{})
+		case typeDateTime2N:
+			return reflect.TypeOf(civil.DateTime{})
+		}
+	case msdsn.DateTimeScanString:
+		switch typeId {
+		case typeDateN, typeTimeN, typeDateTime2N:
+			return reflect.TypeOf("")
+		}
+	}
+	return nil
+}
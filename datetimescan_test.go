@@ -0,0 +1,122 @@
+package mssql
+
+import (
+	"context"
+	"database/sql/driver"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang-sql/civil"
+	"github.com/microsoft/go-mssqldb/msdsn"
+)
+
+func TestConvertDateTimes(t *testing.T) {
+	tm := time.Date(2023, 4, 5, 13, 14, 15, 123456700, time.UTC)
+	cols := []columnStruct{
+		{ti: typeInfo{TypeId: typeDateN}},
+		{ti: typeInfo{TypeId: typeTimeN, Scale: 3}},
+		{ti: typeInfo{TypeId: typeDateTime2N, Scale: 7}},
+		{ti: typeInfo{TypeId: typeDateTime2N, Scale: 0}},
+		{ti: typeInfo{TypeId: typeDateTimeN}},
+		{ti: typeInfo{TypeId: typeDateN}},
+	}
+	row := func() []driver.Value {
+		return []driver.Value{tm, tm, tm, tm, tm, nil}
+	}
+
+	dest := row()
+	convertDateTimes(cols, dest, msdsn.DateTimeScanCivil)
+	want := []driver.Value{
+		civil.Date{Year: 2023, Month: 4, Day: 5},
+		civil.Time{Hour: 13, Minute: 14, Second: 15, Nanosecond: 123456700},
+		civil.DateTime{Date: civil.Date{Year: 2023, Month: 4, Day: 5}, Time: civil.Time{Hour: 13, Minute: 14, Second: 15, Nanosecond: 123456700}},
+		civil.DateTime{Date: civil.Date{Year: 2023, Month: 4, Day: 5}, Time: civil.Time{Hour: 13, Minute: 14, Second: 15, Nanosecond: 123456700}},
+		tm,
+		nil,
+	}
+	if !reflect.DeepEqual(dest, want) {
+		t.Errorf("civil: got %v, want %v", dest, want)
+	}
+
+	dest = row()
+	convertDateTimes(cols, dest, msdsn.DateTimeScanString)
+	want = []driver.Value{"2023-04-05", "13:14:15.123", "2023-04-05 13:14:15.1234567", "2023-04-05 13:14:15", tm, nil}
+	if !reflect.DeepEqual(dest, want) {
+		t.Errorf("string: got %v, want %v", dest, want)
+	}
+}
+
+func TestDateTimeScanType(t *testing.T) {
+	c := &Conn{connector: &Connector{}}
+	col := columnStruct{ti: typeInfo{TypeId: typeDateTime2N}}
+	if got := c.columnScanType(col); got != reflect.TypeOf(time.Time{}) {
+		t.Errorf("default scan type is %v", got)
+	}
+	c.connector.params.Encoding.DateTimeScan = msdsn.DateTimeScanCivil
+	if got := c.columnScanType(col); got != reflect.TypeOf(civil.DateTime{}) {
+		t.Errorf("civil scan type is %v", got)
+	}
+	c.connector.params.Encoding.DateTimeScan = msdsn.DateTimeScanString
+	if got := c.columnScanType(col); got != reflect.TypeOf("") {
+		t.Errorf("string scan type is %v", got)
+	}
+}
+
+func TestSetTimezone(t *testing.T) {
+	tm := time.Date(2023, 4, 5, 13, 14, 15, 0, time.UTC)
+	loc := time.FixedZone("UTC-5", -5*60*60)
+	cols := []columnStruct{
+		{ti: typeInfo{TypeId: typeDateTime2N}},
+		{ti: typeInfo{TypeId: typeDateTimeN}},
+		{ti: typeInfo{TypeId: typeDateTimeOffsetN}},
+		{ti: typeInfo{TypeId: typeDateTime2N}},
+	}
+	dest := []driver.Value{tm, tm, tm, nil}
+	(&Conn{}).convertRow(cols, dest, loc)
+	wall := time.Date(2023, 4, 5, 13, 14, 15, 0, loc)
+	want := []driver.Value{wall, wall, tm, nil}
+	if !reflect.DeepEqual(dest, want) {
+		t.Errorf("got %v, want %v", dest, want)
+	}
+}
+
+func TestConnTimezone(t *testing.T) {
+	c := &Conn{connector: &Connector{}}
+	if loc := c.timezone(queryOptions{}); loc != nil {
+		t.Errorf("default time zone is %v, want nil", loc)
+	}
+	conn := time.FixedZone("conn", 60*60)
+	c.connector.params.Encoding.Timezone = conn
+	if loc := c.timezone(queryOptions{}); loc != conn {
+		t.Errorf("got time zone %v, want that of the connection", loc)
+	}
+	ctx := time.FixedZone("ctx", 2*60*60)
+	opts := queryOptionsFromContext(WithTimezone(context.Background(), ctx))
+	if loc := c.timezone(opts); loc != ctx {
+		t.Errorf("got time zone %v, want that of the context", loc)
+	}
+}
+
+func TestTimezoneParam(t *testing.T) {
+	loc := time.FixedZone("UTC+2", 2*60*60)
+	tm := time.Date(2023, 4, 5, 11, 0, 0, 0, time.UTC)
+	s := &Stmt{c: &Conn{sess: &tdsSession{}}, timezone: loc}
+
+	res, err := s.makeParam(DateTime1(tm))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := encodeDateTime(time.Date(2023, 4, 5, 13, 0, 0, 0, loc)); !reflect.DeepEqual(res.buffer, want) {
+		t.Errorf("DateTime1 sent as %x, want %x", res.buffer, want)
+	}
+
+	s.c.sess.loginAck.TDSVersion = verTDS74
+	res, err = s.makeParam(tm)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := encodeDateTimeOffset(tm.In(loc), 7); !reflect.DeepEqual(res.buffer, want) {
+		t.Errorf("time.Time sent as %x, want %x", res.buffer, want)
+	}
+}
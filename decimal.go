@@ -0,0 +1,196 @@
+package mssql
+
+import (
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// maxDecimalPrecision is the largest precision of decimal and numeric types.
+const maxDecimalPrecision = 38
+
+// Decimal is an exact decimal or numeric value equal to
+// Coefficient × 10^-Scale. A nil Coefficient is zero.
+//
+// As a parameter it is sent as decimal(p, s) with the precision and scale
+// of the value, so no digits are lost on the way to the server. Decimal
+// columns and output parameters can be scanned into it. An output parameter
+// is declared with a precision of 38 and the scale of its initial value.
+// Output parameters and the parameters of Scan can also be a *big.Rat.
+//
+// Values with Coefficient() *big.Int and Exponent() int32 methods, such as
+// github.com/shopspring/decimal.Decimal, and *big.Rat values with a finite
+// decimal expansion are sent as decimal parameters the same way.
+type Decimal struct {
+	Coefficient *big.Int
+	Scale       uint8
+}
+
+// decimalCoefficient is implemented by arbitrary precision decimal
+// types, such as github.com/shopspring/decimal.Decimal.
+type decimalCoefficient interface {
+	Coefficient() *big.Int
+	Exponent() int32
+}
+
+var bigTen = big.NewInt(10)
+
+// DecimalFromRat returns the Decimal equal to r. It fails if r has no
+// finite decimal expansion, like 1/3, or needs a scale above 38.
+func DecimalFromRat(r *big.Rat) (Decimal, error) {
+	// The expansion is finite when the denominator only has the factors 2 and 5.
+	rest := new(big.Int).Set(r.Denom())
+	scale := 0
+	for _, f := range []int64{2, 5} {
+		factor := big.NewInt(f)
+		count := 0
+		for {
+			q, m := new(big.Int).QuoRem(rest, factor, new(big.Int))
+			if m.Sign() != 0 {
+				break
+			}
+			rest = q
+			count++
+		}
+		if count > scale {
+			scale = count
+		}
+	}
+	if !rest.IsInt64() || rest.Int64() != 1 {
+		return Decimal{}, fmt.Errorf("mssql: %s has no exact decimal representation", r.RatString())
+	}
+	if scale > maxDecimalPrecision {
+		return Decimal{}, fmt.Errorf("mssql: %s needs a scale above %d", r.RatString(), maxDecimalPrecision)
+	}
+	coef := new(big.Int).Exp(bigTen, big.NewInt(int64(scale)), nil)
+	coef.Mul(coef, r.Num())
+	coef.Quo(coef, r.Denom())
+	return Decimal{Coefficient: coef, Scale: uint8(scale)}, nil
+}
+
+// decimalFromCoefficient converts a value like shopspring's decimal.Decimal.
+func decimalFromCoefficient(v decimalCoefficient) (Decimal, error) {
+	exp := v.Exponent()
+	coef := v.Coefficient()
+	if exp >= 0 {
+		pow := new(big.Int).Exp(bigTen, big.NewInt(int64(exp)), nil)
+		return Decimal{Coefficient: pow.Mul(pow, coef)}, nil
+	}
+	if -exp > maxDecimalPrecision {
+		return Decimal{}, fmt.Errorf("mssql: decimal value with %d fractional digits exceeds the maximum scale of %d", -exp, maxDecimalPrecision)
+	}
+	return Decimal{Coefficient: coef, Scale: uint8(-exp)}, nil
+}
+
+func (d Decimal) coefficient() *big.Int {
+	if d.Coefficient == nil {
+		return new(big.Int)
+	}
+	return d.Coefficient
+}
+
+// Rat returns the value of d as a *big.Rat.
+func (d Decimal) Rat() *big.Rat {
+	denom := new(big.Int).Exp(bigTen, big.NewInt(int64(d.Scale)), nil)
+	return new(big.Rat).SetFrac(d.coefficient(), denom)
+}
+
+// String formats d with exactly Scale fractional digits.
+func (d Decimal) String() string {
+	coef := d.coefficient()
+	digits := new(big.Int).Abs(coef).String()
+	if d.Scale > 0 {
+		if len(digits) <= int(d.Scale) {
+			digits = strings.Repeat("0", int(d.Scale)-len(digits)+1) + digits
+		}
+		point := len(digits) - int(d.Scale)
+		digits = digits[:point] + "." + digits[point:]
+	}
+	if coef.Sign() < 0 {
+		return "-" + digits
+	}
+	return digits
+}
+
+// Value implements the driver.Valuer interface. The driver itself sends
+// Decimal values as decimal parameters.
+func (d Decimal) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+// Scan implements the sql.Scanner interface.
+func (d *Decimal) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case []byte:
+		return d.parse(string(v))
+	case string:
+		return d.parse(v)
+	case int64:
+		*d = Decimal{Coefficient: big.NewInt(v)}
+		return nil
+	case float64:
+		return d.parse(strconv.FormatFloat(v, 'f', -1, 64))
+	case Decimal:
+		*d = v
+		return nil
+	case nil:
+		return errors.New("mssql: cannot scan NULL into Decimal")
+	default:
+		return fmt.Errorf("mssql: cannot scan %T into Decimal", src)
+	}
+}
+
+func (d *Decimal) parse(s string) error {
+	s = strings.TrimSpace(s)
+	digits := s
+	scale := 0
+	if i := strings.IndexByte(s, '.'); i >= 0 {
+		digits = s[:i] + s[i+1:]
+		scale = len(s) - i - 1
+	}
+	if scale > maxDecimalPrecision {
+		return fmt.Errorf("mssql: cannot scan %q into Decimal: scale above %d", s, maxDecimalPrecision)
+	}
+	coef, ok := new(big.Int).SetString(digits, 10)
+	if !ok {
+		return fmt.Errorf("mssql: cannot scan %q into Decimal", s)
+	}
+	*d = Decimal{Coefficient: coef, Scale: uint8(scale)}
+	return nil
+}
+
+// precision returns the number of digits of the coefficient, but at
+// least the scale and at least one.
+func (d Decimal) precision() int {
+	prec := len(new(big.Int).Abs(d.coefficient()).String())
+	if prec < int(d.Scale) {
+		prec = int(d.Scale)
+	}
+	return prec
+}
+
+// makeDecimalParam encodes d as a decimal(p, s) parameter.
+func makeDecimalParam(d Decimal) (res param, err error) {
+	prec := d.precision()
+	if prec > maxDecimalPrecision || d.Scale > maxDecimalPrecision {
+		return res, fmt.Errorf("mssql: decimal %s exceeds the maximum precision of %d", d, maxDecimalPrecision)
+	}
+	res.ti.TypeId = typeDecimalN
+	res.ti.Prec = uint8(prec)
+	res.ti.Scale = d.Scale
+	coef := d.coefficient()
+	res.buffer = make([]byte, 17)
+	if coef.Sign() >= 0 {
+		res.buffer[0] = 1
+	}
+	mag := new(big.Int).Abs(coef).Bytes()
+	// the magnitude is sent little-endian
+	for i, j := 1, len(mag)-1; j >= 0; i, j = i+1, j-1 {
+		res.buffer[i] = mag[j]
+	}
+	res.ti.Size = len(res.buffer)
+	return res, nil
+}
@@ -0,0 +1,198 @@
+package mssql
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"math/big"
+	"testing"
+)
+
+// coefDecimal has the methods of github.com/shopspring/decimal.Decimal
+// used by the driver.
+type coefDecimal struct {
+	coef *big.Int
+	exp  int32
+}
+
+func (d coefDecimal) Coefficient() *big.Int { return d.coef }
+func (d coefDecimal) Exponent() int32       { return d.exp }
+
+func TestDecimalString(t *testing.T) {
+	tests := []struct {
+		d    Decimal
+		want string
+	}{
+		{Decimal{}, "0"},
+		{Decimal{Coefficient: big.NewInt(12345), Scale: 2}, "123.45"},
+		{Decimal{Coefficient: big.NewInt(-5), Scale: 3}, "-0.005"},
+		{Decimal{Coefficient: big.NewInt(7)}, "7"},
+		{Decimal{Coefficient: big.NewInt(0), Scale: 2}, "0.00"},
+	}
+	for _, tst := range tests {
+		if got := tst.d.String(); got != tst.want {
+			t.Errorf("String of %v/%d: got %q, want %q", tst.d.Coefficient, tst.d.Scale, got, tst.want)
+		}
+	}
+}
+
+func TestDecimalScan(t *testing.T) {
+	tests := []struct {
+		src  interface{}
+		want string
+	}{
+		{[]byte("123.4500"), "123.4500"},
+		{"-0.01", "-0.01"},
+		{int64(42), "42"},
+		{float64(2.5), "2.5"},
+		{[]byte("12345678901234567890123456789012345678"), "12345678901234567890123456789012345678"},
+	}
+	for _, tst := range tests {
+		var d Decimal
+		if err := d.Scan(tst.src); err != nil {
+			t.Errorf("Scan(%v) failed: %v", tst.src, err)
+			continue
+		}
+		if got := d.String(); got != tst.want {
+			t.Errorf("Scan(%v): got %q, want %q", tst.src, got, tst.want)
+		}
+	}
+	var d Decimal
+	for _, src := range []interface{}{nil, "abc", []byte("1.2.3"), true} {
+		if err := d.Scan(src); err == nil {
+			t.Errorf("Scan(%v) should fail", src)
+		}
+	}
+}
+
+func TestDecimalFromRat(t *testing.T) {
+	tests := []struct {
+		rat  string
+		want string
+	}{
+		{"1/4", "0.25"},
+		{"-3/8", "-0.375"},
+		{"10", "10"},
+		{"7/50", "0.14"},
+	}
+	for _, tst := range tests {
+		r, _ := new(big.Rat).SetString(tst.rat)
+		d, err := DecimalFromRat(r)
+		if err != nil {
+			t.Errorf("DecimalFromRat(%s) failed: %v", tst.rat, err)
+			continue
+		}
+		if got := d.String(); got != tst.want {
+			t.Errorf("DecimalFromRat(%s): got %q, want %q", tst.rat, got, tst.want)
+		}
+		if d.Rat().Cmp(r) != 0 {
+			t.Errorf("Rat of DecimalFromRat(%s) is %s", tst.rat, d.Rat().RatString())
+		}
+	}
+	if _, err := DecimalFromRat(big.NewRat(1, 3)); err == nil {
+		t.Error("DecimalFromRat(1/3) should fail")
+	}
+}
+
+func TestConvertInputParameterDecimal(t *testing.T) {
+	tests := []struct {
+		val  interface{}
+		want string
+	}{
+		{coefDecimal{big.NewInt(12345), -3}, "12.345"},
+		{coefDecimal{big.NewInt(12), 2}, "1200"},
+		{big.NewRat(5, 2), "2.5"},
+		{*big.NewRat(-1, 8), "-0.125"},
+	}
+	for _, tst := range tests {
+		conv, err := convertInputParameter(tst.val)
+		if err != nil {
+			t.Errorf("convertInputParameter(%v) failed: %v", tst.val, err)
+			continue
+		}
+		d, ok := conv.(Decimal)
+		if !ok {
+			t.Errorf("convertInputParameter(%v) returned %T, want Decimal", tst.val, conv)
+			continue
+		}
+		if got := d.String(); got != tst.want {
+			t.Errorf("convertInputParameter(%v): got %q, want %q", tst.val, got, tst.want)
+		}
+	}
+}
+
+func TestMakeDecimalParam(t *testing.T) {
+	s := &Stmt{}
+	p, err := s.makeParam(Decimal{Coefficient: big.NewInt(-12345), Scale: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ti.TypeId != typeDecimalN || p.ti.Prec != 5 || p.ti.Scale != 2 {
+		t.Errorf("unexpected type info %+v", p.ti)
+	}
+	want := []byte{0, 0x39, 0x30, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	if !bytes.Equal(p.buffer, want) {
+		t.Errorf("unexpected buffer %v", p.buffer)
+	}
+	if decl := makeDecl(p.ti); decl != "decimal(5, 2)" {
+		t.Errorf("unexpected declaration %s", decl)
+	}
+	if got := string(decodeDecimal(p.ti.Prec, p.ti.Scale, p.buffer)); got != "-123.45" {
+		t.Errorf("decoded %s", got)
+	}
+
+	p, err = s.makeParam(sql.Out{Dest: Decimal{Coefficient: big.NewInt(1), Scale: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ti.Prec != maxDecimalPrecision || p.ti.Scale != 2 {
+		t.Errorf("output parameter should use the maximum precision, got %+v", p.ti)
+	}
+
+	digits39 := new(big.Int).Exp(big.NewInt(10), big.NewInt(38), nil)
+	if _, err = s.makeParam(Decimal{Coefficient: digits39}); err == nil {
+		t.Error("expected an error for a value above the maximum precision")
+	}
+}
+
+func TestConvertAssignBigRat(t *testing.T) {
+	var r big.Rat
+	if err := convertAssign(&r, []byte("-12.50")); err != nil {
+		t.Fatal(err)
+	}
+	if r.Cmp(big.NewRat(-25, 2)) != 0 {
+		t.Errorf("got %s", r.RatString())
+	}
+}
+
+func TestDecimalRoundTrip(t *testing.T) {
+	conn, logger := open(t)
+	defer conn.Close()
+	defer logger.StopLogging()
+
+	in := Decimal{Coefficient: new(big.Int).SetBytes([]byte{0x12, 0x34, 0x56, 0x78, 0x9a, 0xbc, 0xde, 0xf0, 0x12, 0x34}), Scale: 10}
+	var typ string
+	var out Decimal
+	err := conn.QueryRowContext(context.Background(),
+		"select convert(sysname, sql_variant_property(convert(sql_variant, @p1), 'BaseType')), @p1", in).Scan(&typ, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ != "decimal" {
+		t.Errorf("parameter sent as %s", typ)
+	}
+	if out.String() != in.String() {
+		t.Errorf("got %s, want %s", out, in)
+	}
+
+	// the scale of the output parameter is the scale of its initial value
+	res := Decimal{Scale: 3}
+	_, err = conn.ExecContext(context.Background(), "set @out = @in * 2",
+		sql.Named("in", big.NewRat(5, 4)), sql.Named("out", sql.Out{Dest: &res}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.String() != "2.500" {
+		t.Errorf("output parameter got %s", res)
+	}
+}
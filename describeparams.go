@@ -0,0 +1,119 @@
+package mssql
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/microsoft/go-mssqldb/msdsn"
+)
+
+// describeParameters asks the server for the types it expects for the
+// parameters of the statement with sp_describe_undeclared_parameters.
+// The types are used to declare the parameters when the statement is run,
+// instead of types derived from the Go values.
+//
+// Statements the server cannot describe, such as those referencing
+// temporary tables that do not exist yet, keep the derived types.
+func (s *Stmt) describeParameters(ctx context.Context) {
+	q := Stmt{c: s.c,
+		paramCount:     -1,
+		query:          "sp_describe_undeclared_parameters",
+		skipEncryption: true,
+	}
+	oldouts := s.c.outs
+	s.c.clearOuts()
+	defer func() { s.c.outs = oldouts }()
+
+	rows, err := q.queryContext(ctx, []namedValue{{Name: "tsql", Ordinal: 1, Value: s.query}})
+	if err == nil {
+		s.paramTypes, err = processDescribeUndeclaredParameters(rows)
+		rows.Close()
+	}
+	if err != nil && s.c.sess.logFlags&logDebug != 0 {
+		s.c.sess.logger.Log(ctx, msdsn.LogDebug, fmt.Sprintf("sp_describe_undeclared_parameters failed, using parameter types of the values: %v", err))
+	}
+}
+
+// hasNamedParameters reports whether query holds an @name outside of its
+// strings, quoted identifiers and comments, not counting @@ functions such
+// as @@ROWCOUNT. Queries without one have no parameter to describe.
+func hasNamedParameters(query string) bool {
+	for i := 0; i < len(query); i++ {
+		switch c := query[i]; {
+		case c == '\'' || c == '"' || c == '[':
+			end := byte(c)
+			if c == '[' {
+				end = ']'
+			}
+			j := strings.IndexByte(query[i+1:], end)
+			if j < 0 {
+				return false
+			}
+			i += j + 1
+		case strings.HasPrefix(query[i:], "--"):
+			j := strings.IndexByte(query[i:], '\n')
+			if j < 0 {
+				return false
+			}
+			i += j
+		case strings.HasPrefix(query[i:], "/*"):
+			j := strings.Index(query[i+2:], "*/")
+			if j < 0 {
+				return false
+			}
+			i += j + 3
+		case c == '@':
+			if i+1 < len(query) && query[i+1] == '@' {
+				i++
+				for i+1 < len(query) && isIdentifierByte(query[i+1]) {
+					i++
+				}
+				continue
+			}
+			if i+1 < len(query) && isIdentifierByte(query[i+1]) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func isIdentifierByte(c byte) bool {
+	return c == '_' || c == '#' || c == '$' || c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= 0x80
+}
+
+// processDescribeUndeclaredParameters maps parameter names to the
+// suggested_system_type_name column of sp_describe_undeclared_parameters.
+func processDescribeUndeclaredParameters(rows driver.Rows) (map[string]string, error) {
+	nameCol, typeCol := -1, -1
+	for i, col := range rows.Columns() {
+		switch col {
+		case "name":
+			nameCol = i
+		case "suggested_system_type_name":
+			typeCol = i
+		}
+	}
+	if nameCol < 0 || typeCol < 0 {
+		return nil, fmt.Errorf("unexpected sp_describe_undeclared_parameters columns %v", rows.Columns())
+	}
+	types := make(map[string]string)
+	values := make([]driver.Value, len(rows.Columns()))
+	for {
+		err := rows.Next(values)
+		if err == io.EOF {
+			return types, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		name, ok1 := values[nameCol].(string)
+		typ, ok2 := values[typeCol].(string)
+		if ok1 && ok2 {
+			types[name] = typ
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package mssql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"strings"
+	"testing"
+)
+
+func TestMakeRPCParamsUsesDescribedTypes(t *testing.T) {
+	var outparam string
+	s := &Stmt{paramTypes: map[string]string{
+		"@p1":    "decimal(10,2)",
+		"@name":  "varchar(50)",
+		"@pout":  "int",
+		"@other": "bit",
+	}}
+	args := []namedValue{
+		{Ordinal: 1, Value: float64(1.5)},
+		{Name: "name", Ordinal: 2, Value: "widget"},
+		{Ordinal: 3, Value: int64(7)},
+		{Name: "pout", Ordinal: 4, Value: sql.Out{Dest: outparam}},
+	}
+	_, decls, err := s.makeRPCParams(args, false, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "@p1 decimal(10,2),@name varchar(50),@p3 bigint,@pout nvarchar(max) output"
+	if actual := strings.Join(decls, ","); actual != expected {
+		t.Errorf("Incorrect declarations. Expected: %s. Got: %s", expected, actual)
+	}
+}
+
+func TestHasNamedParameters(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"select 1", false},
+		{"create table t (id int)", false},
+		{"select @@ROWCOUNT, @@SPID", false},
+		{"select @p1", true},
+		{"select * from t where name = @name", true},
+		{"select '@p1', [@x], \"@y\"", false},
+		{"select 'it''s @x'", false},
+		{"select 1 -- @x\n", false},
+		{"select 1 /* @x */", false},
+		{"select 1 /* @x */ + @_y", true},
+		{"select @@ROWCOUNT + @n", true},
+		{"select 'open @x", false},
+	}
+	for _, tst := range tests {
+		if got := hasNamedParameters(tst.query); got != tst.want {
+			t.Errorf("hasNamedParameters(%q) = %v, want %v", tst.query, got, tst.want)
+		}
+	}
+}
+
+func TestUnpreparedStmt(t *testing.T) {
+	c := &Conn{connector: &Connector{}}
+	if _, err := c.unpreparedStmt(context.Background(), "select 1", 0); err != driver.ErrSkip {
+		t.Errorf("without DescribeParameters got %v, want driver.ErrSkip", err)
+	}
+	c.connector.params.DescribeParameters = true
+	if _, err := c.unpreparedStmt(context.Background(), "insertbulk t", 0); err != driver.ErrSkip {
+		t.Errorf("for a bulk copy got %v, want driver.ErrSkip", err)
+	}
+	stmt, err := c.unpreparedStmt(context.Background(), "select @p1", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stmt.paramTypes != nil {
+		t.Error("a statement run without Prepare described its parameters")
+	}
+	c.processQueryText = true
+	if _, err = c.unpreparedStmt(context.Background(), "select ?", 2); err == nil {
+		t.Error("expected an error for the wrong number of arguments")
+	}
+}
+
+func TestDescribeParameters(t *testing.T) {
+	checkConnStr(t)
+	connStr := makeConnStr(t)
+	q := connStr.Query()
+	q.Set("describeparameters", "true")
+	connStr.RawQuery = q.Encode()
+	conn, err := sql.Open("sqlserver", connStr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	ctx := context.Background()
+	// Without describing the parameter an int64 value is declared as bigint.
+	stmt, err := conn.PrepareContext(ctx, "select @p1 / 3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stmt.Close()
+	rows, err := stmt.QueryContext(ctx, int64(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	colTypes, err := rows.ColumnTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ := colTypes[0].DatabaseTypeName(); typ != "INT" {
+		t.Errorf("expected the parameter to be declared as int, got %s", typ)
+	}
+}
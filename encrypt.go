@@ -133,7 +133,7 @@ func (s *Stmt) prepareEncryptionQuery(isProc bool, q string, args []namedValue)
 }
 
 func (s *Stmt) buildParametersForColumnEncryption(args []namedValue) (parameters string, err error) {
-	_, decls, err := s.makeRPCParams(args, false)
+	_, decls, err := s.makeRPCParams(args, false, nil)
 	if err != nil {
 		return
 	}
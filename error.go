@@ -2,9 +2,94 @@ package mssql
 
 import (
 	"database/sql/driver"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"strings"
 )
 
+// Errors that classify the errors returned by the driver. Test for them
+// with errors.Is; the SQL Server error itself, with its number and state,
+// is still available with errors.As and a pointer to an mssql.Error variable.
+var (
+	// ErrLoginFailed matches errors that rejected the login.
+	ErrLoginFailed = errors.New("mssql: login failed")
+	// ErrPasswordExpired matches login errors caused by a password that
+	// has expired or must be changed. See PasswordExpiredError.
+	ErrPasswordExpired = errors.New("mssql: password expired")
+	// ErrDatabaseUnavailable matches errors about a database that cannot be
+	// opened or is not currently available.
+	ErrDatabaseUnavailable = errors.New("mssql: database unavailable")
+	// ErrReadOnlyRouting matches errors about an availability group database
+	// that needs a different application intent to be reached.
+	ErrReadOnlyRouting = errors.New("mssql: read-only routing failed")
+	// ErrQueryCancelled matches errors reported by the server for a cancelled
+	// query. Queries cancelled through their context return the context's error.
+	ErrQueryCancelled = errors.New("mssql: query cancelled")
+	// ErrTransientConnection matches errors that are expected to go away when
+	// the connection or the request is retried after a short delay.
+	ErrTransientConnection = errors.New("mssql: transient connection error")
+	// ErrResultsPending matches the errors of requests made on a connection
+	// while the rows of an earlier query on it were not closed. See
+	// ResultsPendingError.
+	ErrResultsPending = errors.New("mssql: results pending")
+	// ErrReadOnlyTx matches the errors of BeginTx with the ReadOnly option
+	// on a connection to a database that can be written to. SQL Server has
+	// no read-only transactions, so they are only accepted in read-only
+	// databases, such as those of a readable secondary replica.
+	ErrReadOnlyTx = errors.New("mssql: read-only transaction in a writable database")
+	// ErrRawTransaction matches the errors of statements that began or
+	// ended a transaction with T-SQL in a way database/sql cannot track.
+	// See Connector.FailOnRawTransactions.
+	ErrRawTransaction = errors.New("mssql: transaction begun or ended by a statement")
+	// ErrServerBusy matches the errors of Ping on a connection whose server
+	// did not answer before the context ended, but confirmed the
+	// cancellation: the connection is alive and can still be used.
+	ErrServerBusy = errors.New("mssql: server busy")
+	// ErrShutdown matches the errors of Connect on a Connector that was
+	// shut down. See Connector.Shutdown.
+	ErrShutdown = errors.New("mssql: connector shut down")
+
+	errDeadlock  = errors.New("mssql: deadlock")
+	errRetryable = errors.New("mssql: retryable")
+)
+
+// errorCategories maps SQL Server error numbers to the errors they match.
+var errorCategories = map[int32][]error{
+	20:    {ErrTransientConnection},
+	64:    {ErrTransientConnection},
+	233:   {ErrTransientConnection},
+	976:   {ErrDatabaseUnavailable},
+	978:   {ErrReadOnlyRouting},
+	979:   {ErrReadOnlyRouting},
+	983:   {ErrDatabaseUnavailable},
+	1205:  {errDeadlock, errRetryable},
+	1222:  {errRetryable},
+	3617:  {ErrQueryCancelled},
+	4060:  {ErrLoginFailed, ErrDatabaseUnavailable, ErrTransientConnection},
+	4221:  {ErrTransientConnection},
+	10053: {ErrTransientConnection},
+	10054: {ErrTransientConnection},
+	10060: {ErrTransientConnection},
+	10928: {ErrTransientConnection},
+	10929: {ErrTransientConnection},
+	18452: {ErrLoginFailed},
+	18456: {ErrLoginFailed},
+	18470: {ErrLoginFailed},
+	18486: {ErrLoginFailed},
+	18487: {ErrLoginFailed, ErrPasswordExpired},
+	18488: {ErrLoginFailed, ErrPasswordExpired},
+	40143: {ErrTransientConnection},
+	40197: {ErrTransientConnection},
+	40501: {ErrTransientConnection},
+	40540: {ErrTransientConnection},
+	40613: {ErrDatabaseUnavailable, ErrTransientConnection},
+	41839: {errRetryable},
+	49918: {ErrTransientConnection},
+	49919: {ErrTransientConnection},
+	49920: {ErrTransientConnection},
+}
+
 // Error represents an SQL Server error. This
 // type includes methods for reading the contents
 // of the struct, which allows calling programs
@@ -19,7 +104,8 @@ type Error struct {
 	ProcName   string
 	LineNo     int32
 	// All lists all errors that were received from first to last.
-	// This includes the last one, which is described in the other members.
+	// This includes the one described in the other members and, when
+	// later statements of the same batch failed too, their errors.
 	All []Error
 }
 
@@ -27,10 +113,114 @@ func (e Error) Error() string {
 	return "mssql: " + e.Message
 }
 
+// IsDeadlock reports whether err, or an error it wraps, reports that the
+// request was chosen as the victim of a deadlock (error 1205).
+func IsDeadlock(err error) bool {
+	return errors.Is(err, errDeadlock)
+}
+
+// IsRetryable reports whether the request that returned err can be retried
+// as is: deadlocks, lock request timeouts and transient connection errors
+// such as Azure SQL throttling or failovers. Retry a failed transaction from
+// its beginning, since the server has rolled it back.
+func IsRetryable(err error) bool {
+	return errors.Is(err, errRetryable) || errors.Is(err, ErrTransientConnection)
+}
+
+// Is reports whether target is one of the errors, such as ErrLoginFailed,
+// matched by the number of this error or of any error in All.
+func (e Error) Is(target error) bool {
+	if matchesCategory(e.Number, target) {
+		return true
+	}
+	for _, err := range e.All {
+		if matchesCategory(err.Number, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesCategory(number int32, target error) bool {
+	for _, c := range errorCategories[number] {
+		if c == target {
+			return true
+		}
+	}
+	return false
+}
+
+// As sets target to the errors of the request when it is a *BatchErrors,
+// and to the first resource governance error of the request when it is a
+// *ThrottleError.
+func (e Error) As(target interface{}) bool {
+	switch t := target.(type) {
+	case *BatchErrors:
+		t.Errors = e.all()
+		return true
+	case *ThrottleError:
+		te, ok := throttleError(e.all())
+		if ok {
+			*t = te
+		}
+		return ok
+	}
+	return false
+}
+
+func (e Error) all() []Error {
+	if len(e.All) == 0 {
+		return []Error{e}
+	}
+	all := make([]Error, len(e.All))
+	copy(all, e.All)
+	return all
+}
+
 func (e Error) String() string {
 	return e.Message
 }
 
+// errorJSON is the JSON form of an Error. The names are kept stable for
+// logging pipelines that index them.
+type errorJSON struct {
+	Number     int32       `json:"number"`
+	State      uint8       `json:"state"`
+	Class      uint8       `json:"class"`
+	Message    string      `json:"message"`
+	ServerName string      `json:"serverName,omitempty"`
+	ProcName   string      `json:"procName,omitempty"`
+	LineNo     int32       `json:"lineNo"`
+	All        []errorJSON `json:"all,omitempty"`
+}
+
+func newErrorJSON(e Error) errorJSON {
+	return errorJSON{
+		Number:     e.Number,
+		State:      e.State,
+		Class:      e.Class,
+		Message:    e.Message,
+		ServerName: e.ServerName,
+		ProcName:   e.ProcName,
+		LineNo:     e.LineNo,
+	}
+}
+
+// MarshalJSON implements json.Marshaler. The error is written as an
+// object with the number, state, class, message, serverName, procName and
+// lineNo fields. When the request sent more than one error, all of them
+// are listed in the all field, without a nested all field of their own.
+func (e Error) MarshalJSON() ([]byte, error) {
+	j := newErrorJSON(e)
+	if len(e.All) > 1 {
+		j.All = make([]errorJSON, len(e.All))
+		for i, err := range e.All {
+			j.All[i] = newErrorJSON(err)
+		}
+	}
+	return json.Marshal(j)
+}
+
 // SQLErrorNumber returns the SQL Server error number.
 func (e Error) SQLErrorNumber() int32 {
 	return e.Number
@@ -60,6 +250,50 @@ func (e Error) SQLErrorLineNo() int32 {
 	return e.LineNo
 }
 
+// BatchErrors lists every error the server sent for a request,
+// in the order they were received. Use errors.As with a pointer to
+// a BatchErrors variable to get them from an error returned by the driver.
+type BatchErrors struct {
+	Errors []Error
+}
+
+func (e BatchErrors) Error() string {
+	if len(e.Errors) == 0 {
+		return "mssql: no errors"
+	}
+	msgs := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		msgs[i] = err.Message
+	}
+	return "mssql: " + strings.Join(msgs, "; ")
+}
+
+// Unwrap returns the last error, which the driver reports for the request,
+// with All set to the errors. It lets errors.Is and errors.As reach the
+// errors of a BatchErrors that is passed on as an error.
+func (e BatchErrors) Unwrap() error {
+	n := len(e.Errors)
+	if n == 0 {
+		return nil
+	}
+	err := e.Errors[n-1]
+	err.All = make([]Error, n)
+	copy(err.All, e.Errors)
+	return err
+}
+
+// MarshalJSON implements json.Marshaler. The errors are written as an
+// object with an errors field listing them as Error.MarshalJSON does.
+func (e BatchErrors) MarshalJSON() ([]byte, error) {
+	errs := make([]errorJSON, len(e.Errors))
+	for i, err := range e.Errors {
+		errs[i] = newErrorJSON(err)
+	}
+	return json.Marshal(struct {
+		Errors []errorJSON `json:"errors"`
+	}{errs})
+}
+
 type StreamError struct {
 	InnerError error
 }
@@ -94,6 +328,107 @@ func (e ServerError) Unwrap() error {
 	return e.sqlError
 }
 
+// PasswordExpiredError is returned by the login when the password of
+// the SQL Server login has expired (error 18488) or has to be changed
+// before the login can be used (error 18487).
+//
+// Reconnect with the "new password" connection string parameter
+// (or msdsn.Config.ChangePassword) set to change the password as part
+// of the login. Unwrap this error or call errors.As with a pointer to an
+// mssql.Error variable to get the error sent by the server.
+type PasswordExpiredError struct {
+	sqlError Error
+}
+
+func (e PasswordExpiredError) Error() string {
+	return e.sqlError.Error()
+}
+
+func (e PasswordExpiredError) Unwrap() error {
+	return e.sqlError
+}
+
+// isPasswordExpired reports whether any error in err requires the
+// login's password to be changed.
+func isPasswordExpired(err Error) bool {
+	return err.Is(ErrPasswordExpired)
+}
+
+// LoginTimeoutError is returned when connecting fails because the dial
+// timeout, the login timeout or the deadline of the context expired. Phase
+// tells which phase of the connection stalled: PhaseDial, PhasePrelogin,
+// PhaseTLSHandshake, PhaseFedAuthToken or PhaseLogin, the wait for the
+// login acknowledgement. Err is context.DeadlineExceeded, or the error of
+// the dial.
+type LoginTimeoutError struct {
+	Phase string
+	Err   error
+}
+
+func (e LoginTimeoutError) Error() string {
+	return "mssql: login timeout expired during " + e.Phase + ": " + e.Err.Error()
+}
+
+func (e LoginTimeoutError) Unwrap() error {
+	return e.Err
+}
+
+// ResultsPendingError is returned by a request on a connection that is
+// still receiving the rows of an earlier query, because they were neither
+// read to the end nor closed. The connection can only carry one request at
+// a time: close the rows of Pending before running Op, or set
+// Connector.DrainPendingResults to have them closed.
+type ResultsPendingError struct {
+	// Pending is the query whose rows are still open.
+	Pending string
+	// Op is the request that was refused: the query, or "begin
+	// transaction", "commit" or "rollback".
+	Op string
+}
+
+func (e ResultsPendingError) Error() string {
+	return fmt.Sprintf("mssql: cannot run %q while the rows of %q are open; close them first", e.Op, e.Pending)
+}
+
+func (e ResultsPendingError) Unwrap() error {
+	return ErrResultsPending
+}
+
+// ExecRowsError is returned by Exec, when Connector.FailExecWithRows is
+// set, for a statement that returned rows, such as an INSERT, UPDATE,
+// DELETE or MERGE with an OUTPUT clause, since Exec discards them. The
+// statement did run: RowsAffected is the count Exec would have returned.
+// Run such statements with Query, or with ExecWithOutput to get the rows
+// along with the count of rows affected.
+type ExecRowsError struct {
+	// Query is the statement that returned rows.
+	Query string
+	// Rows is the number of rows the statement returned.
+	Rows int64
+	// RowsAffected is the number of rows the statement affected.
+	RowsAffected int64
+}
+
+func (e ExecRowsError) Error() string {
+	return fmt.Sprintf("mssql: Exec discarded the %d rows returned by %q, which affected %d rows; use Query or ExecWithOutput", e.Rows, e.Query, e.RowsAffected)
+}
+
+// UnsupportedTDSVersionError is returned when connecting to a server that
+// acknowledged a TDS version below 7.4, the first with the feature
+// extensions the options in Options need: "fedauth", for the federated
+// authentication of the Azure AD methods and access tokens,
+// "columnencryption", "utf8support" and "vectorsupport". Such servers,
+// SQL Server 2008 R2 and earlier, can only be used without them.
+type UnsupportedTDSVersionError struct {
+	// TDSVersion is the version acknowledged by the server.
+	TDSVersion uint32
+	Options    []string
+}
+
+func (e UnsupportedTDSVersionError) Error() string {
+	return fmt.Sprintf("mssql: the server only supports TDS %s, below the 7.4 needed by %s", tdsVersionString(e.TDSVersion), strings.Join(e.Options, ", "))
+}
+
 // RetryableError is returned when an error was caused by a bad
 // connection at the start of a query and can be safely retried
 // using database/sql's automatic retry logic.
@@ -117,5 +452,5 @@ func (r RetryableError) Unwrap() error {
 }
 
 func (r RetryableError) Is(err error) bool {
-	return err == driver.ErrBadConn
+	return err == driver.ErrBadConn || err == ErrTransientConnection
 }
@@ -1,6 +1,11 @@
 package mssql_test
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+
+	mssql "github.com/microsoft/go-mssqldb"
+)
 
 func ExampleError_SQLErrorNumber() {
 	// call a function that might return a mssql error
@@ -33,6 +38,32 @@ func ExampleError_SQLErrorMessage() {
 	}
 }
 
+func ExampleError_Is() {
+	// call a function that might return a mssql error
+	err := callUsingMSSQL()
+
+	switch {
+	case errors.Is(err, mssql.ErrPasswordExpired):
+		fmt.Println("reconnect with the new password parameter set")
+	case errors.Is(err, mssql.ErrTransientConnection):
+		fmt.Println("retry after a short delay")
+	}
+}
+
+func ExampleIsRetryable() {
+	var err error
+	for attempt := 0; attempt < 3; attempt++ {
+		// call a function that runs a transaction
+		err = callUsingMSSQL()
+		if !mssql.IsRetryable(err) {
+			break
+		}
+		if mssql.IsDeadlock(err) {
+			fmt.Println("deadlock, retrying")
+		}
+	}
+}
+
 func callUsingMSSQL() error {
 	return nil
 }
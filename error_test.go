@@ -2,6 +2,8 @@ package mssql
 
 import (
 	"database/sql/driver"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"strings"
 	"testing"
@@ -25,6 +27,84 @@ func TestServerError(t *testing.T) {
 	}
 }
 
+func TestPasswordExpiredError(t *testing.T) {
+	loginErr := Error{Number: 18456, Message: "login error: Login failed for user 'sa'.", All: []Error{
+		{Number: 18488, Message: "Login failed for user 'sa'. Reason: The password of the account has expired."},
+		{Number: 18456, Message: "Login failed for user 'sa'."},
+	}}
+	if !isPasswordExpired(loginErr) {
+		t.Fatal("isPasswordExpired did not find error 18488")
+	}
+	if isPasswordExpired(Error{Number: 18456}) {
+		t.Fatal("isPasswordExpired reported an expired password for a plain login failure")
+	}
+
+	var err error = PasswordExpiredError{sqlError: loginErr}
+	if err.Error() != loginErr.Error() {
+		t.Fatalf("PasswordExpiredError returned wrong message. Got '%s', wanted '%s'", err.Error(), loginErr.Error())
+	}
+	var sqlErr Error
+	if !errors.As(err, &sqlErr) || sqlErr.Number != 18456 {
+		t.Fatalf("PasswordExpiredError did not preserve wrapped error. Got '%+v'", sqlErr)
+	}
+}
+
+func TestErrorIs(t *testing.T) {
+	tests := []struct {
+		err    error
+		target error
+		want   bool
+	}{
+		{Error{Number: 18456}, ErrLoginFailed, true},
+		{Error{Number: 18456}, ErrPasswordExpired, false},
+		{Error{Number: 18456, All: []Error{{Number: 18488}, {Number: 18456}}}, ErrPasswordExpired, true},
+		{PasswordExpiredError{sqlError: Error{Number: 18488}}, ErrPasswordExpired, true},
+		{Error{Number: 4060}, ErrDatabaseUnavailable, true},
+		{Error{Number: 978}, ErrReadOnlyRouting, true},
+		{Error{Number: 3617}, ErrQueryCancelled, true},
+		{Error{Number: 40613}, ErrTransientConnection, true},
+		{ServerError{sqlError: Error{Number: 40501}}, ErrTransientConnection, true},
+		{RetryableError{err: driver.ErrBadConn}, ErrTransientConnection, true},
+		{Error{Number: 102}, ErrTransientConnection, false},
+		{fmt.Errorf("wrapped: %w", Error{Number: 10928}), ErrTransientConnection, true},
+	}
+	for _, tst := range tests {
+		if got := errors.Is(tst.err, tst.target); got != tst.want {
+			t.Errorf("errors.Is(%#v, %v) = %v, want %v", tst.err, tst.target, got, tst.want)
+		}
+	}
+}
+
+func TestIsRetryableAndIsDeadlock(t *testing.T) {
+	tests := []struct {
+		err       error
+		retryable bool
+		deadlock  bool
+	}{
+		{Error{Number: 1205}, true, true},
+		{fmt.Errorf("exec: %w", Error{Number: 1205}), true, true},
+		{Error{Number: 1222}, true, false},
+		{Error{Number: 40613}, true, false},
+		{Error{Number: 40197}, true, false},
+		{Error{Number: 40501}, true, false},
+		{Error{Number: 10928}, true, false},
+		{Error{Number: 10929}, true, false},
+		{Error{Number: 4060}, true, false},
+		{RetryableError{err: driver.ErrBadConn}, true, false},
+		{Error{Number: 2627}, false, false},
+		{errors.New("other"), false, false},
+		{nil, false, false},
+	}
+	for _, tst := range tests {
+		if got := IsRetryable(tst.err); got != tst.retryable {
+			t.Errorf("IsRetryable(%v) = %v, want %v", tst.err, got, tst.retryable)
+		}
+		if got := IsDeadlock(tst.err); got != tst.deadlock {
+			t.Errorf("IsDeadlock(%v) = %v, want %v", tst.err, got, tst.deadlock)
+		}
+	}
+}
+
 func TestRetryableError(t *testing.T) {
 
 	originalErr := driver.ErrBadConn
@@ -85,3 +165,56 @@ func TestBadStreamPanicf(t *testing.T) {
 
 	t.Fatalf("badStreamPanicf did not panic as expected when passed %s", expectedMsg)
 }
+
+func TestErrorJSON(t *testing.T) {
+	first := Error{Number: 8134, State: 1, Class: 16, Message: "Divide by zero error encountered.", ServerName: "srv", LineNo: 1}
+	last := Error{Number: 50000, State: 2, Class: 16, Message: "failed", ServerName: "srv", ProcName: "dbo.p", LineNo: 7}
+	err := last
+	err.All = []Error{first, last}
+
+	b, jerr := json.Marshal(err)
+	if jerr != nil {
+		t.Fatal(jerr)
+	}
+	want := `{"number":50000,"state":2,"class":16,"message":"failed","serverName":"srv","procName":"dbo.p","lineNo":7,"all":[` +
+		`{"number":8134,"state":1,"class":16,"message":"Divide by zero error encountered.","serverName":"srv","lineNo":1},` +
+		`{"number":50000,"state":2,"class":16,"message":"failed","serverName":"srv","procName":"dbo.p","lineNo":7}]}`
+	if string(b) != want {
+		t.Errorf("got %s, want %s", b, want)
+	}
+
+	b, jerr = json.Marshal(first)
+	if jerr != nil {
+		t.Fatal(jerr)
+	}
+	if want = `{"number":8134,"state":1,"class":16,"message":"Divide by zero error encountered.","serverName":"srv","lineNo":1}`; string(b) != want {
+		t.Errorf("got %s, want %s", b, want)
+	}
+
+	b, jerr = json.Marshal(BatchErrors{Errors: []Error{first}})
+	if jerr != nil {
+		t.Fatal(jerr)
+	}
+	if want = `{"errors":[{"number":8134,"state":1,"class":16,"message":"Divide by zero error encountered.","serverName":"srv","lineNo":1}]}`; string(b) != want {
+		t.Errorf("got %s, want %s", b, want)
+	}
+}
+
+func TestBatchErrorsUnwrap(t *testing.T) {
+	batch := BatchErrors{Errors: []Error{{Number: 1205, Message: "deadlock"}, {Number: 3621, Message: "terminated"}}}
+	wrapped := fmt.Errorf("saving order: %w", batch)
+
+	var sqlErr Error
+	if !errors.As(wrapped, &sqlErr) {
+		t.Fatal("errors.As did not find the Error in a BatchErrors")
+	}
+	if sqlErr.Number != 3621 || len(sqlErr.All) != 2 {
+		t.Errorf("got error %+v, want the last error with All set", sqlErr)
+	}
+	if !IsDeadlock(wrapped) {
+		t.Error("IsDeadlock should match an error of the batch")
+	}
+	if (BatchErrors{}).Unwrap() != nil {
+		t.Error("an empty BatchErrors should unwrap to nil")
+	}
+}
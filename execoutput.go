@@ -0,0 +1,76 @@
+package mssql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+)
+
+// ExecOutput is the result of ExecWithOutput.
+type ExecOutput struct {
+	// RowsAffected is the number of rows affected by the statement, as
+	// returned by Result.RowsAffected.
+	RowsAffected int64
+	// Columns are the names of the columns of the first result set.
+	Columns []string
+	// Rows are the rows returned by the statement, such as those of its
+	// OUTPUT clause, with the values the driver returns to database/sql:
+	// int64, float64, bool, string, []byte and time.Time, with nil for
+	// NULL.
+	Rows [][]driver.Value
+}
+
+// ExecWithOutput runs query on conn, typically an INSERT, UPDATE, DELETE
+// or MERGE statement with an OUTPUT clause, and returns both the number of
+// rows it affected and the rows it returned, which Exec discards and Query
+// does not count. The rows of all the result sets are kept, in order, so
+// the query should return a single one.
+func ExecWithOutput(ctx context.Context, conn *sql.Conn, query string, args ...interface{}) (out *ExecOutput, err error) {
+	err = conn.Raw(func(driverConn interface{}) error {
+		c, ok := driverConn.(*Conn)
+		if !ok {
+			return errors.New("mssql: ExecWithOutput needs a connection of this driver")
+		}
+		out, err = c.execWithOutput(ctx, query, args)
+		return err
+	})
+	return out, err
+}
+
+func (c *Conn) execWithOutput(ctx context.Context, query string, args []interface{}) (*ExecOutput, error) {
+	list, err := c.namedValues(args)
+	if err != nil {
+		return nil, err
+	}
+	stmt, err := c.prepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	out := &ExecOutput{}
+	loc := c.timezone(queryOptionsFromContext(ctx))
+	stmt.outputRows = func(cols []columnStruct, row []interface{}) {
+		if out.Columns == nil {
+			out.Columns = make([]string, len(cols))
+			for i, col := range cols {
+				out.Columns[i] = col.ColName
+			}
+		}
+		values := make([]driver.Value, len(row))
+		for i, v := range row {
+			if b, ok := v.([]byte); ok {
+				v = append([]byte(nil), b...)
+			}
+			values[i] = v
+		}
+		c.convertRow(cols, values, loc)
+		out.Rows = append(out.Rows, values)
+	}
+	res, err := stmt.exec(ctx, list)
+	if err != nil {
+		return nil, err
+	}
+	out.RowsAffected, _ = res.RowsAffected()
+	return out, nil
+}
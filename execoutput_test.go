@@ -0,0 +1,77 @@
+package mssql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestIterateResponseRows(t *testing.T) {
+	cols := []columnStruct{{ColName: "id", ti: typeInfo{TypeId: typeIntN, Size: 4}}}
+	tokChan := make(chan tokenStruct, 5)
+	tokChan <- cols
+	tokChan <- []interface{}{int64(1)}
+	tokChan <- []interface{}{int64(2)}
+	tokChan <- doneStruct{Status: doneCount, RowCount: 2}
+	close(tokChan)
+	tp := &tokenProcessor{tokChan: tokChan, ctx: context.Background(), sess: &tdsSession{}}
+	var got [][]interface{}
+	tp.onRow = func(c []columnStruct, row []interface{}) {
+		if len(c) != 1 || c[0].ColName != "id" {
+			t.Errorf("got columns %+v", c)
+		}
+		got = append(got, row)
+	}
+	if err := tp.iterateResponse(); err != nil {
+		t.Fatal(err)
+	}
+	if tp.rowsReturned != 2 || tp.rowCount != 2 || !reflect.DeepEqual(got, [][]interface{}{{int64(1)}, {int64(2)}}) {
+		t.Errorf("got %d rows returned, %d affected and rows %v", tp.rowsReturned, tp.rowCount, got)
+	}
+}
+
+func TestExecWithOutput(t *testing.T) {
+	checkConnStr(t)
+	connector, err := NewConnector(makeConnStr(t).String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	connector.FailExecWithRows = true
+	db := sql.OpenDB(connector)
+	defer db.Close()
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err = conn.ExecContext(ctx, "create table #out (id int identity, name nvarchar(10))"); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = conn.ExecContext(ctx, "insert into #out (name) output inserted.id values (@p1)", "a")
+	var rowsErr ExecRowsError
+	if !errors.As(err, &rowsErr) || rowsErr.Rows != 1 || rowsErr.RowsAffected != 1 {
+		t.Fatalf("got error %v, want an ExecRowsError for 1 row", err)
+	}
+
+	out, err := ExecWithOutput(ctx, conn, "insert into #out (name) output inserted.id, inserted.name values (@p1), (@p2)", "b", "c")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &ExecOutput{
+		RowsAffected: 2,
+		Columns:      []string{"id", "name"},
+		Rows:         [][]driver.Value{{int64(2), "b"}, {int64(3), "c"}},
+	}
+	if !reflect.DeepEqual(out, want) {
+		t.Errorf("got %+v, want %+v", out, want)
+	}
+	if err = conn.PingContext(ctx); err != nil {
+		t.Errorf("ping failed with FailExecWithRows: %v", err)
+	}
+}
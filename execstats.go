@@ -0,0 +1,174 @@
+package mssql
+
+import (
+	"context"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Numbers of the informational messages sent under SET STATISTICS IO and
+// SET STATISTICS TIME.
+const (
+	msgStatisticsExecTime    = 3612
+	msgStatisticsCompileTime = 3613
+	msgStatisticsIO          = 3615
+)
+
+// ExecutionStats holds the statistics the server reported for a statement
+// run with a context from WithExecutionStats. The reads and times are the
+// sums of those of the statements of the query.
+type ExecutionStats struct {
+	// Tables holds the I/O statistics of the tables the query read, one
+	// entry for each SET STATISTICS IO message, in the order they came.
+	Tables []TableIOStats
+	// LogicalReads, PhysicalReads and ReadAheadReads are the sums of
+	// the data page reads of Tables.
+	LogicalReads   int64
+	PhysicalReads  int64
+	ReadAheadReads int64
+	// CPUTime and ElapsedTime are the CPU and elapsed times spent running
+	// the statements.
+	CPUTime     time.Duration
+	ElapsedTime time.Duration
+	// CompileCPUTime and CompileElapsedTime are those spent parsing and
+	// compiling them.
+	CompileCPUTime     time.Duration
+	CompileElapsedTime time.Duration
+}
+
+// TableIOStats holds the I/O statistics reported for a table.
+type TableIOStats struct {
+	Table             string
+	ScanCount         int64
+	LogicalReads      int64
+	PhysicalReads     int64
+	ReadAheadReads    int64
+	LOBLogicalReads   int64
+	LOBPhysicalReads  int64
+	LOBReadAheadReads int64
+}
+
+// WithExecutionStats returns a context that runs the statements executed
+// with it under SET STATISTICS IO, TIME ON and collects the statistics the
+// server sends into stats, for performance tests. stats is cleared when a
+// statement starts; the statistics of a query are complete once its rows
+// are closed, and those of an Exec when it returns. The same stats are
+// returned by the ExecutionStats method of the Rows and Result of the
+// driver. A nil stats turns the option off.
+//
+// As with the other options, SET is run with the statement only, and it
+// cannot be used when the query is the name of a stored procedure. The
+// messages are parsed as the server sends them in English, so stats stays
+// empty for sessions in other languages. stats must not be shared by
+// statements running at the same time.
+func WithExecutionStats(ctx context.Context, stats *ExecutionStats) context.Context {
+	opts := queryOptionsFromContext(ctx)
+	opts.stats = stats
+	return context.WithValue(ctx, queryOptionsKey{}, opts)
+}
+
+// ExecutionStats returns the statistics collected for the query when it ran
+// with a context from WithExecutionStats, and nil otherwise.
+func (rc *Rows) ExecutionStats() *ExecutionStats {
+	return rc.reader.outs.stats
+}
+
+// ExecutionStats returns the statistics collected for the statement when it
+// ran with a context from WithExecutionStats, and nil otherwise.
+func (r *Result) ExecutionStats() *ExecutionStats {
+	return r.stats
+}
+
+// addMessage adds the statistics of info, when it is one of the messages
+// of SET STATISTICS IO or TIME.
+func (s *ExecutionStats) addMessage(info Error) {
+	switch info.Number {
+	case msgStatisticsIO:
+		if t, ok := parseTableIOStats(info.Message); ok {
+			s.Tables = append(s.Tables, t)
+			s.LogicalReads += t.LogicalReads
+			s.PhysicalReads += t.PhysicalReads
+			s.ReadAheadReads += t.ReadAheadReads
+		}
+	case msgStatisticsExecTime:
+		cpu, elapsed := parseStatisticsTime(info.Message)
+		s.CPUTime += cpu
+		s.ElapsedTime += elapsed
+	case msgStatisticsCompileTime:
+		cpu, elapsed := parseStatisticsTime(info.Message)
+		s.CompileCPUTime += cpu
+		s.CompileElapsedTime += elapsed
+	}
+}
+
+// parseTableIOStats parses a message such as
+//
+//	Table 'orders'. Scan count 1, logical reads 3, physical reads 0, ...
+//
+// Counters it does not know, such as the page server reads of recent
+// versions, are skipped.
+func parseTableIOStats(msg string) (TableIOStats, bool) {
+	var t TableIOStats
+	if !strings.HasPrefix(msg, "Table '") {
+		return t, false
+	}
+	end := strings.LastIndex(msg, "'. ")
+	if end < len("Table '") {
+		return t, false
+	}
+	t.Table = msg[len("Table '"):end]
+	for _, item := range strings.Split(strings.TrimSuffix(msg[end+len("'. "):], "."), ",") {
+		item = strings.TrimSpace(item)
+		i := strings.LastIndexByte(item, ' ')
+		if i < 0 {
+			continue
+		}
+		n, err := strconv.ParseInt(item[i+1:], 10, 64)
+		if err != nil {
+			continue
+		}
+		switch item[:i] {
+		case "Scan count":
+			t.ScanCount = n
+		case "logical reads":
+			t.LogicalReads = n
+		case "physical reads":
+			t.PhysicalReads = n
+		case "read-ahead reads":
+			t.ReadAheadReads = n
+		case "lob logical reads":
+			t.LOBLogicalReads = n
+		case "lob physical reads":
+			t.LOBPhysicalReads = n
+		case "lob read-ahead reads":
+			t.LOBReadAheadReads = n
+		}
+	}
+	return t, true
+}
+
+// parseStatisticsTime parses the times of a message such as
+//
+//	SQL Server Execution Times:
+//	   CPU time = 16 ms,  elapsed time = 20 ms.
+func parseStatisticsTime(msg string) (cpu, elapsed time.Duration) {
+	return statisticsTime(msg, "CPU time = "), statisticsTime(msg, "elapsed time = ")
+}
+
+func statisticsTime(msg, label string) time.Duration {
+	i := strings.Index(msg, label)
+	if i < 0 {
+		return 0
+	}
+	msg = msg[i+len(label):]
+	end := strings.IndexFunc(msg, func(r rune) bool { return r < '0' || r > '9' })
+	if end < 0 {
+		end = len(msg)
+	}
+	ms, err := strconv.ParseInt(msg[:end], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(ms) * time.Millisecond
+}
@@ -0,0 +1,102 @@
+package mssql
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestParseTableIOStats(t *testing.T) {
+	tests := []struct {
+		msg  string
+		want TableIOStats
+		ok   bool
+	}{
+		{
+			"Table 'orders'. Scan count 1, logical reads 3, physical reads 2, read-ahead reads 8, lob logical reads 4, lob physical reads 5, lob read-ahead reads 6.",
+			TableIOStats{Table: "orders", ScanCount: 1, LogicalReads: 3, PhysicalReads: 2, ReadAheadReads: 8, LOBLogicalReads: 4, LOBPhysicalReads: 5, LOBReadAheadReads: 6},
+			true,
+		},
+		{
+			"Table 'Worktable'. Scan count 0, logical reads 0, physical reads 0, page server reads 0, read-ahead reads 0, page server read-ahead reads 0, lob logical reads 0, lob physical reads 0, lob page server reads 0, lob read-ahead reads 0, lob page server read-ahead reads 0.",
+			TableIOStats{Table: "Worktable"},
+			true,
+		},
+		{
+			"Table 'it's'. Scan count 2, logical reads 7.",
+			TableIOStats{Table: "it's", ScanCount: 2, LogicalReads: 7},
+			true,
+		},
+		{"Changed database context to 'master'.", TableIOStats{}, false},
+		{"Table 'x", TableIOStats{}, false},
+	}
+	for _, tst := range tests {
+		got, ok := parseTableIOStats(tst.msg)
+		if ok != tst.ok || got != tst.want {
+			t.Errorf("parseTableIOStats(%q) = %+v, %v; want %+v, %v", tst.msg, got, ok, tst.want, tst.ok)
+		}
+	}
+}
+
+func TestExecutionStatsAddMessage(t *testing.T) {
+	var stats ExecutionStats
+	for _, info := range []Error{
+		{Number: msgStatisticsCompileTime, Message: "SQL Server parse and compile time: \n   CPU time = 2 ms, elapsed time = 3 ms."},
+		{Number: msgStatisticsIO, Message: "Table 'a'. Scan count 1, logical reads 10, physical reads 1, read-ahead reads 4."},
+		{Number: msgStatisticsExecTime, Message: "\n SQL Server Execution Times:\n   CPU time = 15 ms,  elapsed time = 20 ms."},
+		{Number: msgStatisticsIO, Message: "Table 'b'. Scan count 2, logical reads 5, physical reads 0, read-ahead reads 0."},
+		{Number: msgStatisticsExecTime, Message: "\n SQL Server Execution Times:\n   CPU time = 1 ms,  elapsed time = 2 ms."},
+		{Number: 5701, Message: "Changed database context to 'master'."},
+	} {
+		stats.addMessage(info)
+	}
+	want := ExecutionStats{
+		Tables: []TableIOStats{
+			{Table: "a", ScanCount: 1, LogicalReads: 10, PhysicalReads: 1, ReadAheadReads: 4},
+			{Table: "b", ScanCount: 2, LogicalReads: 5},
+		},
+		LogicalReads:       15,
+		PhysicalReads:      1,
+		ReadAheadReads:     4,
+		CPUTime:            16 * time.Millisecond,
+		ElapsedTime:        22 * time.Millisecond,
+		CompileCPUTime:     2 * time.Millisecond,
+		CompileElapsedTime: 3 * time.Millisecond,
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("got %+v, want %+v", stats, want)
+	}
+}
+
+func TestExecutionStats(t *testing.T) {
+	conn, logger := open(t)
+	defer conn.Close()
+	defer logger.StopLogging()
+
+	var stats ExecutionStats
+	statsCtx := WithExecutionStats(context.Background(), &stats)
+	rows, err := conn.QueryContext(statsCtx, "select name from sys.objects where object_id = @p1", 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for rows.Next() {
+	}
+	if err = rows.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if len(stats.Tables) == 0 || stats.LogicalReads == 0 {
+		t.Errorf("expected the I/O statistics of the query, got %+v", stats)
+	}
+
+	if _, err = conn.ExecContext(statsCtx, "declare @n int; select @n = count(*) from sys.objects"); err != nil {
+		t.Fatal(err)
+	}
+	if len(stats.Tables) == 0 {
+		t.Errorf("expected the I/O statistics of the statement, got %+v", stats)
+	}
+
+	if _, err = conn.ExecContext(statsCtx, "sp_who"); err == nil {
+		t.Error("expected an error for execution statistics on a stored procedure call")
+	}
+}
@@ -0,0 +1,75 @@
+package mssql
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/microsoft/go-mssqldb/msdsn"
+)
+
+// failoverPartner holds the failover partner of the database of a
+// Connector as the server last reported it, for database mirroring. It
+// takes the place of the failoverpartner of the connection string: after a
+// failover the new principal names the former one, so the connector keeps
+// following the database whatever the DNS entry of the server says.
+type failoverPartner struct {
+	mu      sync.Mutex
+	partner string
+}
+
+func (f *failoverPartner) set(partner string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.partner = partner
+}
+
+func (f *failoverPartner) get() string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.partner
+}
+
+// FailoverPartner returns the server connected to when the server of the
+// connection string cannot be reached: the failover partner of the
+// database last reported by a server, for database mirroring, or the
+// failoverpartner of the connection string until one is.
+func (c *Connector) FailoverPartner() string {
+	if c.failover != nil {
+		if partner := c.failover.get(); partner != "" {
+			return partner
+		}
+	}
+	return c.params.FailOverPartner
+}
+
+// partnerParams returns params changed to connect to partner, a server
+// name such as "host", "host\instance" or "host,port". The failoverport
+// of params applies when partner has neither an instance nor a port. The
+// TLS handshake with partner sends its host name, and checks its
+// certificate for it, unless hostnameincertificate was given.
+func partnerParams(params msdsn.Config, partner string) msdsn.Config {
+	host, port := partner, params.FailOverPort
+	if i := strings.LastIndexByte(host, ','); i >= 0 {
+		if p, err := strconv.ParseUint(strings.TrimSpace(host[i+1:]), 10, 16); err == nil {
+			port = p
+		}
+		host = host[:i]
+	} else if strings.Contains(host, `\`) {
+		// found through the SQL Server Browser
+		port = 0
+	}
+	if i := strings.IndexByte(host, '\\'); i >= 0 {
+		params.Instance = host[i+1:]
+		host = host[:i]
+		params.Port = port
+	} else if port != 0 {
+		params.Port = port
+	}
+	params.Host = host
+	if !params.HostInCertificateProvided && params.TLSConfig != nil {
+		params.TLSConfig = params.TLSConfig.Clone()
+		params.TLSConfig.ServerName = host
+	}
+	return params
+}
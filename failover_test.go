@@ -0,0 +1,70 @@
+package mssql
+
+import (
+	"context"
+	"crypto/tls"
+	"testing"
+
+	"github.com/microsoft/go-mssqldb/msdsn"
+)
+
+func TestPartnerParams(t *testing.T) {
+	base := msdsn.Config{Host: "primary", Instance: "inst", Port: 1500}
+	tests := []struct {
+		partner      string
+		failoverPort uint64
+		host         string
+		instance     string
+		port         uint64
+	}{
+		{"mirror", 0, "mirror", "inst", 1500},
+		{"mirror", 1600, "mirror", "inst", 1600},
+		{`mirror\other`, 0, "mirror", "other", 0},
+		{`mirror\other`, 1600, "mirror", "other", 0},
+		{"mirror,1700", 1600, "mirror", "inst", 1700},
+		{`mirror\other,1700`, 0, "mirror", "other", 1700},
+	}
+	for _, tt := range tests {
+		params := base
+		params.FailOverPort = tt.failoverPort
+		got := partnerParams(params, tt.partner)
+		if got.Host != tt.host || got.Instance != tt.instance || got.Port != tt.port {
+			t.Errorf("%q with failover port %d: got %s\\%s,%d, want %s\\%s,%d", tt.partner, tt.failoverPort,
+				got.Host, got.Instance, got.Port, tt.host, tt.instance, tt.port)
+		}
+	}
+}
+
+func TestPartnerParamsTLS(t *testing.T) {
+	p := msdsn.Config{Host: "primary", TLSConfig: &tls.Config{ServerName: "primary"}}
+	got := partnerParams(p, `mirror\inst`)
+	if got.TLSConfig.ServerName != "mirror" {
+		t.Errorf("the TLS server name is %q, want the partner host", got.TLSConfig.ServerName)
+	}
+	if p.TLSConfig.ServerName != "primary" {
+		t.Error("the TLS configuration of the connection string was changed")
+	}
+
+	p.HostInCertificateProvided = true
+	if got = partnerParams(p, "mirror"); got.TLSConfig.ServerName != "primary" {
+		t.Errorf("the TLS server name is %q, want that of hostnameincertificate", got.TLSConfig.ServerName)
+	}
+}
+
+func TestProcessEnvChgMirrorPartner(t *testing.T) {
+	connector := newConnector(msdsn.Config{FailOverPartner: "configured"}, driverInstanceNoProcess)
+	if got := connector.FailoverPartner(); got != "configured" {
+		t.Errorf("got partner %q before the server reported one, want the configured one", got)
+	}
+
+	partner := `mirror\inst`
+	data := []byte{envDatabaseMirrorPartner, byte(len(partner))}
+	data = append(data, str2ucs2(partner)...)
+	data = append(data, 0)
+	b := append([]byte{byte(len(data)), 0}, data...)
+	sess := &tdsSession{buf: &tdsBuffer{packetSize: 4096, rbuf: b, rsize: len(b)}, failover: connector.failover}
+	processEnvChg(context.Background(), sess)
+	if got := connector.FailoverPartner(); got != partner {
+		t.Errorf("got partner %q, want %q reported by the server", got, partner)
+	}
+}
@@ -0,0 +1,101 @@
+package mssql
+
+import (
+	"strconv"
+	"strings"
+)
+
+// FeatureSet is a set of optional protocol features that the server
+// acknowledged for a session during login, as returned by Conn.Features.
+// Applications can check it before relying on a feature, for example
+//
+//	if c.Features().Has(mssql.FeatureUTF8Support) {
+//		// use UTF-8 collations
+//	}
+type FeatureSet uint32
+
+const (
+	// FeatureColumnEncryption is set when Always Encrypted is enabled.
+	FeatureColumnEncryption FeatureSet = 1 << iota
+	// FeatureUTF8Support is set when the server accepted UTF-8 collations.
+	FeatureUTF8Support
+	// FeatureJSONSupport is set when the server sends json columns in the
+	// native json type, requested with the jsonsupport parameter.
+	FeatureJSONSupport
+	// FeatureFedAuth is set when the login used federated authentication.
+	FeatureFedAuth
+	// FeatureVectorSupport is set when the server can exchange vectors in
+	// the native binary format.
+	FeatureVectorSupport
+	// FeatureDNSCaching is set when Azure SQL Database allows the client to
+	// cache the address it resolved for the server. The driver asks for it
+	// when connecting to an Azure SQL Database host name.
+	FeatureDNSCaching
+)
+
+var featureNames = []struct {
+	feature FeatureSet
+	name    string
+}{
+	{FeatureColumnEncryption, "ColumnEncryption"},
+	{FeatureUTF8Support, "UTF8Support"},
+	{FeatureJSONSupport, "JSONSupport"},
+	{FeatureFedAuth, "FedAuth"},
+	{FeatureVectorSupport, "VectorSupport"},
+	{FeatureDNSCaching, "DNSCaching"},
+}
+
+// Has reports whether all features in f are present in s.
+func (s FeatureSet) Has(f FeatureSet) bool {
+	return s&f == f
+}
+
+// String lists the features in the set separated by "|", or returns
+// "None" for an empty set.
+func (s FeatureSet) String() string {
+	if s == 0 {
+		return "None"
+	}
+	names := make([]string, 0, len(featureNames))
+	for _, fn := range featureNames {
+		if s.Has(fn.feature) {
+			names = append(names, fn.name)
+			s &^= fn.feature
+		}
+	}
+	if s != 0 {
+		names = append(names, "0x"+strings.ToUpper(strconv.FormatUint(uint64(s), 16)))
+	}
+	return strings.Join(names, "|")
+}
+
+// features returns the features acknowledged in a FEATUREEXTACK token.
+func (ack featureExtAck) features() (s FeatureSet) {
+	for id, v := range ack {
+		switch id {
+		case featExtCOLUMNENCRYPTION:
+			if colAck, ok := v.(colAckStruct); ok && colAck.Version > 0 && colAck.Version <= 2 {
+				s |= FeatureColumnEncryption
+			}
+		case featExtFEDAUTH:
+			s |= FeatureFedAuth
+		case featExtUTF8SUPPORT:
+			if data, ok := v.([]byte); ok && len(data) > 0 && data[0] != 0 {
+				s |= FeatureUTF8Support
+			}
+		case featExtJSONSUPPORT:
+			if data, ok := v.([]byte); ok && len(data) > 0 && data[0] != 0 {
+				s |= FeatureJSONSupport
+			}
+		case featExtAZURESQLDNSCACHING:
+			if data, ok := v.([]byte); ok && len(data) > 0 && data[0] != 0 {
+				s |= FeatureDNSCaching
+			}
+		case featExtVECTORSUPPORT:
+			if data, ok := v.([]byte); ok && len(data) > 0 && data[0] != 0 {
+				s |= FeatureVectorSupport
+			}
+		}
+	}
+	return s
+}
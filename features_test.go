@@ -0,0 +1,112 @@
+package mssql
+
+import (
+	"context"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/microsoft/go-mssqldb/msdsn"
+)
+
+func TestFeatureExtAckFeatures(t *testing.T) {
+	tests := []struct {
+		ack  string
+		want FeatureSet
+	}{
+		{"FF", 0},
+		{"0401000000 01 FF", FeatureColumnEncryption},
+		{"0401000000 03 FF", 0},
+		{"0200000000 0A0100000001 FF", FeatureFedAuth | FeatureUTF8Support},
+		{"0A0100000000 FF", 0},
+		{"0D0100000001 0100000000 FF", FeatureJSONSupport},
+		{"0D0100000000 FF", 0},
+		{"0E0100000002 FF", FeatureVectorSupport},
+		{"0E0100000000 FF", 0},
+		{"0B0100000001 FF", FeatureDNSCaching},
+		{"0B0100000000 FF", 0},
+	}
+	for _, tst := range tests {
+		b, err := hex.DecodeString(strings.ReplaceAll(tst.ack, " ", ""))
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := &tdsBuffer{
+			packetSize: len(b),
+			rbuf:       b,
+			rpos:       0,
+			rsize:      len(b),
+		}
+		got := parseFeatureExtAck(r).features()
+		if got != tst.want {
+			t.Errorf("features of %q: got %v, want %v", tst.ack, got, tst.want)
+		}
+	}
+}
+
+func TestFeatureSetString(t *testing.T) {
+	tests := []struct {
+		set  FeatureSet
+		want string
+	}{
+		{0, "None"},
+		{FeatureColumnEncryption, "ColumnEncryption"},
+		{FeatureFedAuth | FeatureUTF8Support, "UTF8Support|FedAuth"},
+		{FeatureVectorSupport | 0x100, "VectorSupport|0x100"},
+	}
+	for _, tst := range tests {
+		if got := tst.set.String(); got != tst.want {
+			t.Errorf("String of %d: got %q, want %q", uint32(tst.set), got, tst.want)
+		}
+	}
+	if !(FeatureFedAuth | FeatureUTF8Support).Has(FeatureFedAuth) {
+		t.Error("Has should report a feature that is in the set")
+	}
+	if FeatureFedAuth.Has(FeatureFedAuth | FeatureUTF8Support) {
+		t.Error("Has should require every feature in the argument")
+	}
+}
+
+func TestLoginRequestsDNSCaching(t *testing.T) {
+	for host, want := range map[string]bool{
+		"myserver.database.windows.net":      true,
+		"MyServer.Database.ChinaCloudAPI.cn": true,
+		"localhost":                          false,
+		"database.windows.net.example":       false,
+	} {
+		fe := &featureExtFedAuth{FedAuthLibrary: FedAuthLibraryReserved}
+		l, err := prepareLogin(context.Background(), &Connector{}, msdsn.Config{Host: host}, driverInstanceNoProcess.logger, nil, fe, defaultPacketSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, got := l.FeatureExt.features[featExtAZURESQLDNSCACHING]; got != want {
+			t.Errorf("%s: DNS caching requested %t, want %t", host, got, want)
+		}
+	}
+}
+
+func TestLoginRequestsJSONSupport(t *testing.T) {
+	for _, want := range []bool{false, true} {
+		fe := &featureExtFedAuth{FedAuthLibrary: FedAuthLibraryReserved}
+		l, err := prepareLogin(context.Background(), &Connector{}, msdsn.Config{Host: "localhost", JSONSupport: want}, driverInstanceNoProcess.logger, nil, fe, defaultPacketSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, got := l.FeatureExt.features[featExtJSONSUPPORT]; got != want {
+			t.Errorf("JSON support requested %t, want %t", got, want)
+		}
+	}
+}
+
+func TestLoginRequestsUTF8Support(t *testing.T) {
+	for _, want := range []bool{false, true} {
+		fe := &featureExtFedAuth{FedAuthLibrary: FedAuthLibraryReserved}
+		l, err := prepareLogin(context.Background(), &Connector{}, msdsn.Config{Host: "localhost", UTF8Support: want}, driverInstanceNoProcess.logger, nil, fe, defaultPacketSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, got := l.FeatureExt.features[featExtUTF8SUPPORT]; got != want {
+			t.Errorf("UTF-8 support requested %t, want %t", got, want)
+		}
+	}
+}
@@ -11,6 +11,10 @@ var (
 	providers           map[string]Provider
 	DefaultProviderName string
 
+	// TrustedConnectionProviderNames lists, in order of preference, the providers used
+	// when the connection string requests a trusted connection without naming an authenticator.
+	TrustedConnectionProviderNames []string
+
 	ErrProviderCannotBeNil         = errors.New("provider cannot be nil")
 	ErrProviderNameMustBePopulated = errors.New("provider name must be populated")
 )
@@ -20,15 +24,22 @@ func init() {
 }
 
 // GetIntegratedAuthenticator calls the authProvider specified in the 'authenticator' connection string parameter, if supplied.
+// If the connection string requests a trusted connection, the first registered provider in
+// TrustedConnectionProviderNames is used.
 // Otherwise fails back to the DefaultProviderName implementation for the platform.
 func GetIntegratedAuthenticator(config msdsn.Config) (IntegratedAuthenticator, error) {
-	authenticatorName, ok := config.Parameters["authenticator"]
-	if !ok {
-		provider, err := getProvider(DefaultProviderName)
-		if err != nil {
-			return nil, err
-		}
+	authenticatorName, _, err := ChooseProvider(config)
+	if err != nil {
+		return nil, err
+	}
+
+	provider, err := getProvider(authenticatorName)
+	if err != nil {
+		return nil, err
+	}
 
+	_, explicit := config.Parameters["authenticator"]
+	if !explicit && !config.TrustedConnection {
 		p, err := provider.GetIntegratedAuthenticator(config)
 		// we ignore the error in this case to force a fallback to sqlserver authentication.
 		// this preserves the original behaviour
@@ -39,12 +50,26 @@ func GetIntegratedAuthenticator(config msdsn.Config) (IntegratedAuthenticator, e
 		return p, nil
 	}
 
-	provider, err := getProvider(authenticatorName)
-	if err != nil {
-		return nil, err
+	return provider.GetIntegratedAuthenticator(config)
+}
+
+// ChooseProvider returns the name of the provider GetIntegratedAuthenticator uses for
+// the given config, along with a human readable reason for the choice.
+func ChooseProvider(config msdsn.Config) (name string, reason string, err error) {
+	if authenticatorName, ok := config.Parameters["authenticator"]; ok {
+		return authenticatorName, "the authenticator connection string parameter names it", nil
 	}
 
-	return provider.GetIntegratedAuthenticator(config)
+	if config.TrustedConnection {
+		for _, name := range TrustedConnectionProviderNames {
+			if _, ok := providers[name]; ok {
+				return name, fmt.Sprintf("a trusted connection was requested and %v is the preferred registered provider for this platform", name), nil
+			}
+		}
+		return "", "", fmt.Errorf("a trusted connection was requested but none of the providers %v is registered; import the package implementing one of them", TrustedConnectionProviderNames)
+	}
+
+	return DefaultProviderName, "it is the default provider for this platform", nil
 }
 
 func getProvider(name string) (Provider, error) {
@@ -3,6 +3,7 @@ package integratedauth
 import (
 	"errors"
 	"fmt"
+	"strings"
 	"testing"
 
 	"github.com/microsoft/go-mssqldb/msdsn"
@@ -198,6 +199,92 @@ func TestGetIntegratedAuthenticatorToErrorWhenNoSpecifiedProviderFound(t *testin
 	}
 }
 
+func TestGetIntegratedAuthenticatorUsesTrustedConnectionProvider(t *testing.T) {
+	removeStubProvider()
+	defer removeStubProvider()
+
+	err := SetIntegratedAuthenticationProvider(providerName, ProviderFunc(getAuth))
+	if err != nil {
+		t.Errorf("SetIntegratedAuthenticationProvider() returned unexpected err %v", err)
+	}
+
+	DefaultProviderName = "DEFAULT_PROVIDER"
+	TrustedConnectionProviderNames = []string{"NONEXISTANT_PROVIDER", providerName}
+	defer func() {
+		DefaultProviderName = ""
+		TrustedConnectionProviderNames = nil
+	}()
+
+	config, err := msdsn.Parse("trusted_connection=yes;user id=username")
+	if err != nil {
+		t.Errorf("msdsn.Parse : Unexpected error %v", err)
+		return
+	}
+
+	name, reason, err := ChooseProvider(config)
+	if err != nil {
+		t.Errorf("expected ChooseProvider() to return ok, found %v", err)
+	}
+	if name != providerName || reason == "" {
+		t.Errorf("expected ChooseProvider() to pick %v with a reason, found %v (%v)", providerName, name, reason)
+	}
+
+	result, err := GetIntegratedAuthenticator(config)
+	if err != nil {
+		t.Errorf("expected GetIntegratedAuthenticator() to return ok, found %v", err)
+	}
+	if _, ok := result.(*stubAuth); !ok {
+		t.Errorf("expected result of GetIntegratedAuthenticator() to be an instance of stubAuth")
+	}
+}
+
+func TestGetIntegratedAuthenticatorErrorsWhenNoTrustedConnectionProviderRegistered(t *testing.T) {
+	removeStubProvider()
+
+	TrustedConnectionProviderNames = []string{"NONEXISTANT_PROVIDER"}
+	defer func() { TrustedConnectionProviderNames = nil }()
+
+	config, err := msdsn.Parse("integrated security=true")
+	if err != nil {
+		t.Errorf("msdsn.Parse : Unexpected error %v", err)
+		return
+	}
+
+	result, err := GetIntegratedAuthenticator(config)
+	if err == nil || !strings.Contains(err.Error(), "NONEXISTANT_PROVIDER") {
+		t.Errorf("expected GetIntegratedAuthenticator() to return an error naming the missing provider, found %v", err)
+	}
+	if result != nil {
+		t.Errorf("expected GetIntegratedAuthenticator() to return nill provider, found %v", result)
+	}
+}
+
+func TestGetIntegratedAuthenticatorTrustedConnectionDoesNotHideErrors(t *testing.T) {
+	removeStubProvider()
+	defer removeStubProvider()
+
+	TrustedConnectionProviderNames = []string{providerName}
+	defer func() { TrustedConnectionProviderNames = nil }()
+
+	err := SetIntegratedAuthenticationProvider(providerName, ProviderFunc(func(config msdsn.Config) (IntegratedAuthenticator, error) {
+		return nil, errors.New("authenticator cant continue")
+	}))
+	if err != nil {
+		t.Errorf("SetIntegratedAuthenticationProvider() returned unexpected err %v", err)
+	}
+
+	config, err := msdsn.Parse("trusted_connection=yes")
+	if err != nil {
+		t.Errorf("msdsn.Parse : Unexpected error %v", err)
+		return
+	}
+
+	_, err = GetIntegratedAuthenticator(config)
+	if err == nil {
+		t.Error("expected GetIntegratedAuthenticator() to return the provider error for a trusted connection")
+	}
+}
+
 func removeStubProvider() {
 	delete(providers, providerName)
 }
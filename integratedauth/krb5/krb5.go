@@ -160,6 +160,17 @@ func readKrb5Config(cfg msdsn.Config) (*krb5Login, error) {
 	if len(login.CredCacheFile) == 0 {
 		login.CredCacheFile = os.Getenv("KRB5CCNAME")
 	}
+	// KRB5CCNAME may include the cache type, only file caches are supported
+	login.CredCacheFile = strings.TrimPrefix(login.CredCacheFile, "FILE:")
+
+	// Finally use the default MIT credential cache location left by kinit
+	if len(login.CredCacheFile) == 0 && len(login.KeytabFile) == 0 && len(login.Password) == 0 {
+		if cc := defaultCredCacheFile(); cc != "" {
+			if ok, _ := fileExists(cc, nil); ok {
+				login.CredCacheFile = cc
+			}
+		}
+	}
 
 	// read optional parameters
 	val, ok := cfg.Parameters[dnsLookupKDC]
@@ -182,6 +193,15 @@ func readKrb5Config(cfg msdsn.Config) (*krb5Login, error) {
 	return login, nil
 }
 
+// defaultCredCacheFile returns the credential cache kinit uses when KRB5CCNAME is not set.
+func defaultCredCacheFile() string {
+	uid := os.Getuid()
+	if uid < 0 {
+		return ""
+	}
+	return fmt.Sprintf("/tmp/krb5cc_%d", uid)
+}
+
 func validateKrb5LoginParams(krbLoginParams *krb5Login) error {
 	switch {
 	// using explicit credentials
@@ -133,6 +133,22 @@ func TestReadKrb5ConfigHappyPath(t *testing.T) {
 				}
 			},
 		},
+		{
+			name:      "cache type prefix removed from environment",
+			confPath:  `/etc/my.config`,
+			cachePath: `FILE:/tmp/mycache`,
+			cfg: msdsn.Config{
+				ServerSPN: "serverspn",
+				Parameters: map[string]string{
+					"krb5-realm": "krb5-realm",
+				},
+			},
+			validate: func(t testing.TB, cfg msdsn.Config, actual *krb5Login) {
+				if actual.CredCacheFile != `/tmp/mycache` {
+					t.Errorf("Expected cache file from env var without the FILE: prefix. Got: %s", actual.CredCacheFile)
+				}
+			},
+		},
 	}
 	revert := mockFileExists()
 	defer revert()
@@ -169,6 +185,39 @@ func TestReadKrb5ConfigHappyPath(t *testing.T) {
 	}
 }
 
+func TestReadKrb5ConfigUsesDefaultCredCache(t *testing.T) {
+	if os.Getuid() < 0 {
+		t.Skip("default credential cache location requires a uid")
+	}
+	revertConfig := mockDefaultConfig()
+	defer revertConfig()
+
+	cc := os.Getenv("KRB5CCNAME")
+	os.Unsetenv("KRB5CCNAME")
+	defer os.Setenv("KRB5CCNAME", cc)
+
+	fileExists = func(filename string, errWhenFileNotFound error) (bool, error) {
+		return filename == defaultCredCacheFile(), errWhenFileNotFound
+	}
+	defer func() { fileExists = fileExistsOS }()
+
+	actual, err := readKrb5Config(msdsn.Config{ServerSPN: "serverspn", Parameters: map[string]string{}})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if actual.CredCacheFile != defaultCredCacheFile() {
+		t.Errorf("Expected default cache file %s. Got: %s", defaultCredCacheFile(), actual.CredCacheFile)
+	}
+
+	actual, err = readKrb5Config(msdsn.Config{User: "username", Password: "placeholderpassword", Parameters: map[string]string{}})
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if actual.CredCacheFile != "" {
+		t.Errorf("Expected no cache file when a password is supplied. Got: %s", actual.CredCacheFile)
+	}
+}
+
 func basicConfigMatch(t testing.TB, config msdsn.Config, actual *krb5Login) {
 	if actual.Krb5ConfigFile != config.Parameters[keytabConfigFile] {
 		t.Errorf("Expected Krb5ConfigFile %v, found %v", config.Parameters[keytabConfigFile], actual.Krb5ConfigFile)
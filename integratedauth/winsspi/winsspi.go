@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"strings"
 	"syscall"
+	"unicode/utf16"
 	"unsafe"
 
 	"github.com/microsoft/go-mssqldb/integratedauth"
@@ -119,7 +120,10 @@ type Auth struct {
 }
 
 // getAuth returns an authentication handle Auth to provide authentication content
-// to mssql.connect
+// to mssql.connect.
+// When the user id is in the DOMAIN\user format the supplied password is passed
+// to the Negotiate package as explicit credentials, otherwise the identity of
+// the current process is used.
 func getAuth(config msdsn.Config) (integratedauth.IntegratedAuthenticator, error) {
 	if config.User == "" {
 		return &Auth{Service: config.ServerSPN}, nil
@@ -136,17 +140,23 @@ func getAuth(config msdsn.Config) (integratedauth.IntegratedAuthenticator, error
 	}, nil
 }
 
+// utf16Len returns the number of UTF-16 code units in s, which is the
+// length SEC_WINNT_AUTH_IDENTITY expects for unicode strings.
+func utf16Len(s string) uint32 {
+	return uint32(len(utf16.Encode([]rune(s))))
+}
+
 func (auth *Auth) InitialBytes() ([]byte, error) {
 	var identity *SEC_WINNT_AUTH_IDENTITY
 	if auth.UserName != "" {
 		identity = &SEC_WINNT_AUTH_IDENTITY{
 			Flags:          SEC_WINNT_AUTH_IDENTITY_UNICODE,
 			Password:       syscall.StringToUTF16Ptr(auth.Password),
-			PasswordLength: uint32(len(auth.Password)),
+			PasswordLength: utf16Len(auth.Password),
 			Domain:         syscall.StringToUTF16Ptr(auth.Domain),
-			DomainLength:   uint32(len(auth.Domain)),
+			DomainLength:   utf16Len(auth.Domain),
 			User:           syscall.StringToUTF16Ptr(auth.UserName),
-			UserLength:     uint32(len(auth.UserName)),
+			UserLength:     utf16Len(auth.UserName),
 		}
 	}
 	var ts TimeStamp
@@ -0,0 +1,37 @@
+//go:build windows
+// +build windows
+
+package winsspi
+
+import (
+	"testing"
+
+	"github.com/microsoft/go-mssqldb/msdsn"
+)
+
+func TestGetAuthWithExplicitCredentials(t *testing.T) {
+	config := msdsn.Config{User: `CONTOSO\jdoe`, Password: "päss", ServerSPN: "MSSQLSvc/host:1433"}
+	a, err := getAuth(config)
+	if err != nil {
+		t.Fatalf("getAuth returned unexpected error %v", err)
+	}
+	auth := a.(*Auth)
+	if auth.Domain != "CONTOSO" || auth.UserName != "jdoe" || auth.Password != "päss" || auth.Service != config.ServerSPN {
+		t.Errorf("unexpected Auth %+v", auth)
+	}
+}
+
+func TestGetAuthWithoutDomainFails(t *testing.T) {
+	_, err := getAuth(msdsn.Config{User: "sa", Password: "secret"})
+	if err == nil {
+		t.Error("expected an error for a user id without a domain")
+	}
+}
+
+func TestUtf16Len(t *testing.T) {
+	for s, l := range map[string]uint32{"": 0, "abc": 3, "päss": 4, "😀": 2} {
+		if got := utf16Len(s); got != l {
+			t.Errorf("utf16Len(%q) = %d, want %d", s, got, l)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package mssql
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+)
+
+// Interceptor observes, rewrites or blocks the statements run through
+// database/sql on the connections of a Connector. Register interceptors in
+// Connector.Interceptors.
+type Interceptor interface {
+	// BeforeQuery is called before the statement is sent. It can change
+	// q.Query, such as to add a comment, and return a context carrying
+	// values for AfterQuery, which the statement also runs with. An error
+	// stops the statement, which fails with that error.
+	BeforeQuery(ctx context.Context, q *QueryInfo) (context.Context, error)
+	// AfterQuery is called once the statement ran, with q.Duration and
+	// q.Err set, and the context returned by BeforeQuery. For queries it is
+	// called when the first result set is ready, before the rows are read.
+	AfterQuery(ctx context.Context, q *QueryInfo)
+}
+
+// QueryInfo describes a statement passed to an Interceptor.
+type QueryInfo struct {
+	// Query is the text of the statement, or the name of the procedure.
+	Query string
+	// Exec is set for statements run with Exec rather than Query.
+	Exec bool
+	// ArgsDigest is a hash of the names, types and values of the
+	// arguments, which tells calls with the same arguments apart without
+	// logging their values. It is empty without arguments.
+	ArgsDigest string
+	// Duration is how long the statement took, set for AfterQuery.
+	Duration time.Duration
+	// Err is the error of the statement, set for AfterQuery.
+	Err error
+}
+
+// intercept calls BeforeQuery on the interceptors of the connector of s,
+// in order. It returns the context and statement to run, which holds the
+// query the interceptors set, and the function calling AfterQuery, in the
+// reverse order, with the error of the statement. When an interceptor
+// fails, the ones called before it get AfterQuery with its error, which is
+// returned.
+func (s *Stmt) intercept(ctx context.Context, args []namedValue, exec bool) (context.Context, *Stmt, func(error), error) {
+	if s.c.connector == nil || len(s.c.connector.Interceptors) == 0 {
+		return ctx, s, func(error) {}, nil
+	}
+	interceptors := s.c.connector.Interceptors
+	q := &QueryInfo{Query: s.query, Exec: exec, ArgsDigest: argsDigest(args)}
+	start := time.Now()
+	ctxs := make([]context.Context, 0, len(interceptors))
+	after := func(err error) {
+		q.Duration = time.Since(start)
+		q.Err = err
+		for i := len(ctxs) - 1; i >= 0; i-- {
+			interceptors[i].AfterQuery(ctxs[i], q)
+		}
+	}
+	for _, ic := range interceptors {
+		next, err := ic.BeforeQuery(ctx, q)
+		if err != nil {
+			after(err)
+			return ctx, s, nil, err
+		}
+		if next != nil {
+			ctx = next
+		}
+		ctxs = append(ctxs, ctx)
+	}
+	if q.Query != s.query {
+		if s.declTypes == nil {
+			// Share the declarations of the parameters with the copy.
+			s.declTypes = make(map[string]typeInfo)
+		}
+		rewritten := *s
+		rewritten.query = q.Query
+		s = &rewritten
+	}
+	return ctx, s, after, nil
+}
+
+// argsDigest returns the first 8 bytes of the SHA-256 of the names, types
+// and values of args, in hexadecimal.
+func argsDigest(args []namedValue) string {
+	if len(args) == 0 {
+		return ""
+	}
+	h := sha256.New()
+	for _, arg := range args {
+		fmt.Fprintf(h, "%s\x00%T\x00%v\x00", arg.Name, arg.Value, arg.Value)
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
@@ -0,0 +1,143 @@
+package mssql
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type testInterceptor struct {
+	name   string
+	calls  *[]string
+	before func(q *QueryInfo) error
+	after  func(ctx context.Context, q *QueryInfo)
+}
+
+type interceptorKey struct{}
+
+func (i testInterceptor) BeforeQuery(ctx context.Context, q *QueryInfo) (context.Context, error) {
+	*i.calls = append(*i.calls, "before "+i.name)
+	if i.before != nil {
+		if err := i.before(q); err != nil {
+			return nil, err
+		}
+	}
+	return context.WithValue(ctx, interceptorKey{}, i.name), nil
+}
+
+func (i testInterceptor) AfterQuery(ctx context.Context, q *QueryInfo) {
+	*i.calls = append(*i.calls, "after "+i.name)
+	if i.after != nil {
+		i.after(ctx, q)
+	}
+}
+
+func TestInterceptorsRewriteQuery(t *testing.T) {
+	var calls []string
+	var got QueryInfo
+	var gotCtx interface{}
+	interceptors := []Interceptor{
+		testInterceptor{name: "audit", calls: &calls, after: func(ctx context.Context, q *QueryInfo) {
+			got = *q
+			gotCtx = ctx.Value(interceptorKey{})
+		}},
+		testInterceptor{name: "comment", calls: &calls, before: func(q *QueryInfo) error {
+			q.Query = "/* app */ " + q.Query
+			return nil
+		}},
+	}
+
+	var tokens bytes.Buffer
+	tokens.WriteByte(byte(tokenDone))
+	_ = binary.Write(&tokens, binary.LittleEndian, []uint16{doneCount, 0})
+	_ = binary.Write(&tokens, binary.LittleEndian, uint64(1))
+	reply := bytes.NewBuffer([]byte{byte(packReply), statusEOM, 0, byte(8 + tokens.Len()), 0, 0, 1, 0})
+	reply.Write(tokens.Bytes())
+	transport := &replyTransport{reply: reply}
+	c := &Conn{
+		connectionGood: true,
+		connector:      &Connector{Interceptors: interceptors},
+		sess: &tdsSession{
+			buf:    newTdsBuffer(defaultPacketSize, transport),
+			logger: optionalLogger{},
+		},
+	}
+	s := &Stmt{c: c, query: "delete from t"}
+	res, err := s.ExecContext(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n, _ := res.RowsAffected(); n != 1 {
+		t.Errorf("got %d rows affected, want 1", n)
+	}
+
+	want := []string{"before audit", "before comment", "after comment", "after audit"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Errorf("got calls %v, want %v", calls, want)
+	}
+	if got.Query != "/* app */ delete from t" || !got.Exec || got.Err != nil || got.Duration < 0 {
+		t.Errorf("AfterQuery got %+v", got)
+	}
+	if gotCtx != "audit" {
+		t.Errorf("AfterQuery got the context of %v, want the one of audit", gotCtx)
+	}
+	if s.query != "delete from t" {
+		t.Errorf("the statement was changed to %q", s.query)
+	}
+	if sent := transport.sent.Bytes(); !bytes.Contains(sent, str2ucs2("/* app */ delete from t")) {
+		t.Errorf("the rewritten query was not sent: %x", sent)
+	}
+}
+
+func TestInterceptorBlocksQuery(t *testing.T) {
+	var calls []string
+	var afterErr error
+	blocked := errors.New("blocked")
+	c := &Conn{
+		connectionGood: true,
+		connector: &Connector{Interceptors: []Interceptor{
+			testInterceptor{name: "audit", calls: &calls, after: func(ctx context.Context, q *QueryInfo) { afterErr = q.Err }},
+			testInterceptor{name: "guard", calls: &calls, before: func(q *QueryInfo) error {
+				if strings.HasPrefix(q.Query, "drop") {
+					return blocked
+				}
+				return nil
+			}},
+		}},
+		sess: &tdsSession{logger: optionalLogger{}},
+	}
+	s := &Stmt{c: c, query: "drop table t"}
+	if _, err := s.QueryContext(context.Background(), nil); err != blocked {
+		t.Fatalf("got %v, want the error of the interceptor", err)
+	}
+	if want := []string{"before audit", "before guard", "after audit"}; !reflect.DeepEqual(calls, want) {
+		t.Errorf("got calls %v, want %v", calls, want)
+	}
+	if afterErr != blocked {
+		t.Errorf("AfterQuery got %v, want the error of the interceptor", afterErr)
+	}
+	if !c.connectionGood {
+		t.Error("a blocked statement should keep the connection")
+	}
+}
+
+func TestArgsDigest(t *testing.T) {
+	args := []namedValue{{Name: "id", Value: int64(1)}, {Ordinal: 2, Value: "x"}}
+	digest := argsDigest(args)
+	if len(digest) != 16 {
+		t.Fatalf("got digest %q, want 16 hexadecimal digits", digest)
+	}
+	if argsDigest([]namedValue{{Name: "id", Value: int64(1)}, {Ordinal: 2, Value: "x"}}) != digest {
+		t.Error("the digest of the same arguments differs")
+	}
+	if argsDigest([]namedValue{{Name: "id", Value: "1"}, {Ordinal: 2, Value: "x"}}) == digest {
+		t.Error("arguments of another type have the same digest")
+	}
+	if argsDigest(nil) != "" {
+		t.Error("the digest of no arguments is not empty")
+	}
+}
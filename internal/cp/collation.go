@@ -18,3 +18,13 @@ func (c Collation) getFlags() uint32 {
 func (c Collation) getVersion() uint32 {
 	return (c.LcidAndFlags & 0xf0000000) >> 28
 }
+
+// flagUTF8 is the flag of the UTF-8 collations, such as
+// Latin1_General_100_CI_AS_SC_UTF8, in the flags returned by getFlags.
+const flagUTF8 = 0x40
+
+// IsUTF8 reports whether c is a UTF-8 collation, whose char data is already
+// UTF-8. The server only sends them once it acknowledged UTF-8 support.
+func (c Collation) IsUTF8() bool {
+	return c.getFlags()&flagUTF8 != 0
+}
@@ -0,0 +1,62 @@
+//go:build go1.18
+// +build go1.18
+
+package mssql
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// JSONOf holds a value of type T stored as a JSON document, in a json
+// column or in an nvarchar column. Scanning unmarshals the document into V
+// as it is read from the column value, without copying it first. As a
+// parameter V is marshaled and sent as nvarchar. JSONOf can be null, like
+// sql.NullString.
+type JSONOf[T any] struct {
+	V     T
+	Valid bool // Valid is true if V is not NULL
+}
+
+// Scan implements the sql.Scanner interface.
+func (j *JSONOf[T]) Scan(src interface{}) error {
+	var zero T
+	j.V, j.Valid = zero, false
+	var r io.Reader
+	switch v := src.(type) {
+	case nil:
+		return nil
+	case string:
+		r = strings.NewReader(v)
+	case []byte:
+		r = bytes.NewReader(v)
+	default:
+		return fmt.Errorf("mssql: cannot scan %T into JSONOf[%T]", src, zero)
+	}
+	dec := json.NewDecoder(r)
+	if err := dec.Decode(&j.V); err != nil {
+		return fmt.Errorf("mssql: invalid JSON document: %v", err)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return errors.New("mssql: invalid JSON document: data after the top-level value")
+	}
+	j.Valid = true
+	return nil
+}
+
+// Value implements the driver.Valuer interface.
+func (j JSONOf[T]) Value() (driver.Value, error) {
+	if !j.Valid {
+		return nil, nil
+	}
+	b, err := json.Marshal(j.V)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
@@ -0,0 +1,71 @@
+//go:build go1.18
+// +build go1.18
+
+package mssql
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+type jsonTestDoc struct {
+	Name string   `json:"name"`
+	Tags []string `json:"tags"`
+}
+
+func TestJSONOfScan(t *testing.T) {
+	want := jsonTestDoc{Name: "a", Tags: []string{"x", "y"}}
+	for _, src := range []interface{}{`{"name":"a","tags":["x","y"]}`, []byte(` {"name":"a","tags":["x","y"]} `)} {
+		var j JSONOf[jsonTestDoc]
+		if err := j.Scan(src); err != nil {
+			t.Fatal(err)
+		}
+		if !j.Valid || !reflect.DeepEqual(j.V, want) {
+			t.Errorf("scanning %v got %+v", src, j)
+		}
+	}
+
+	j := JSONOf[jsonTestDoc]{V: want, Valid: true}
+	if err := j.Scan(nil); err != nil {
+		t.Fatal(err)
+	}
+	if j.Valid || j.V.Name != "" {
+		t.Errorf("NULL should reset the value, got %+v", j)
+	}
+	for _, bad := range []interface{}{`{"name":`, `{"name":"a"} {}`, `{"name":1}`, 42} {
+		if err := j.Scan(bad); err == nil {
+			t.Errorf("scanning %v should fail", bad)
+		}
+	}
+}
+
+func TestJSONOfValue(t *testing.T) {
+	v, err := JSONOf[jsonTestDoc]{V: jsonTestDoc{Name: "a"}, Valid: true}.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v != `{"name":"a","tags":null}` {
+		t.Errorf("got %v", v)
+	}
+	if v, err = (JSONOf[jsonTestDoc]{}).Value(); v != nil || err != nil {
+		t.Errorf("invalid value should be NULL, got %v, %v", v, err)
+	}
+}
+
+func TestJSONOfRoundTrip(t *testing.T) {
+	conn, logger := open(t)
+	defer conn.Close()
+	defer logger.StopLogging()
+
+	in := JSONOf[jsonTestDoc]{V: jsonTestDoc{Name: "doc", Tags: []string{"t"}}, Valid: true}
+	var out JSONOf[jsonTestDoc]
+	var name string
+	err := conn.QueryRowContext(context.Background(), "select @p1, json_value(@p1, '$.name')", in).Scan(&out, &name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(out, in) || name != "doc" {
+		t.Errorf("got %+v and %q", out, name)
+	}
+}
@@ -0,0 +1,92 @@
+package mssql
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// Phases of a connection reported by LoginTimeoutError.
+const (
+	PhaseDial         = "dial"
+	PhasePrelogin     = "prelogin"
+	PhaseTLSHandshake = "TLS handshake"
+	PhaseFedAuthToken = "fedauth token"
+	PhaseLogin        = "login"
+)
+
+// loginWatch bounds the login of a dialed connection by the login timeout
+// and the context, and records the phase the login is in. Reads of the
+// prelogin and the TLS handshake do not watch the context, so the
+// connection is closed when it expires to unblock them.
+type loginWatch struct {
+	ctx   context.Context
+	phase string
+	conn  net.Conn
+
+	mu       sync.Mutex
+	finished bool
+	closed   bool
+	done     chan struct{}
+	cancel   func()
+}
+
+func watchLogin(ctx context.Context, timeout time.Duration, conn net.Conn) *loginWatch {
+	w := &loginWatch{ctx: ctx, phase: PhasePrelogin, conn: conn, cancel: func() {}}
+	if timeout > 0 {
+		w.ctx, w.cancel = context.WithTimeout(ctx, timeout)
+	}
+	if w.ctx.Done() == nil {
+		return w
+	}
+	w.done = make(chan struct{})
+	go func() {
+		select {
+		case <-w.ctx.Done():
+			w.mu.Lock()
+			if !w.finished {
+				w.closed = true
+				w.conn.Close()
+			}
+			w.mu.Unlock()
+		case <-w.done:
+		}
+	}()
+	return w
+}
+
+// finish stops watching the login and returns err, or the error to return
+// in its place. When the login timeout or the deadline of the context
+// expired, that is a LoginTimeoutError naming the phase that stalled. The
+// connection is closed when the login failed.
+func (w *loginWatch) finish(err error) error {
+	if w == nil {
+		return err
+	}
+	w.mu.Lock()
+	alreadyFinished := w.finished
+	w.finished = true
+	closed := w.closed
+	w.mu.Unlock()
+	if alreadyFinished {
+		return err
+	}
+	if w.done != nil {
+		close(w.done)
+	}
+	defer w.cancel()
+
+	if err == nil && !closed {
+		return nil
+	}
+	if !closed {
+		w.conn.Close()
+	}
+	if ctxErr := w.ctx.Err(); ctxErr == context.DeadlineExceeded {
+		return LoginTimeoutError{Phase: w.phase, Err: ctxErr}
+	} else if ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
@@ -0,0 +1,97 @@
+package mssql
+
+import (
+	"database/sql/driver"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+)
+
+// moneyScale is the number of decimal places of money and smallmoney.
+const moneyScale = 4
+
+// Money is a money or smallmoney value. As a parameter it is sent as
+// money, and money columns and output parameters scan into it exactly.
+// After Scan the value always has a scale of 4.
+type Money struct {
+	Decimal
+}
+
+// NullMoney represents a Money that may be null.
+// NullMoney implements the Scanner interface so
+// it can be used as a scan destination, similar to sql.NullString.
+type NullMoney struct {
+	Money Money
+	Valid bool // Valid is true if Money is not NULL
+}
+
+// Scan implements the sql.Scanner interface.
+func (m *Money) Scan(src interface{}) error {
+	var d Decimal
+	if err := d.Scan(src); err != nil {
+		return err
+	}
+	var err error
+	m.Decimal, err = d.rescale(moneyScale)
+	return err
+}
+
+// Scan implements the sql.Scanner interface.
+func (n *NullMoney) Scan(src interface{}) error {
+	if src == nil {
+		n.Money, n.Valid = Money{}, false
+		return nil
+	}
+	n.Valid = true
+	return n.Money.Scan(src)
+}
+
+// Value implements the driver.Valuer interface.
+func (n NullMoney) Value() (driver.Value, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	return n.Money.Value()
+}
+
+// moneyValuer is implemented by MoneyOf, which is sent as a money
+// parameter.
+type moneyValuer interface {
+	nullMoney() (NullMoney, error)
+}
+
+// rescale returns d with the given scale. It fails if that would drop
+// non-zero digits.
+func (d Decimal) rescale(scale uint8) (Decimal, error) {
+	coef := new(big.Int).Set(d.coefficient())
+	switch {
+	case d.Scale < scale:
+		coef.Mul(coef, new(big.Int).Exp(bigTen, big.NewInt(int64(scale-d.Scale)), nil))
+	case d.Scale > scale:
+		var rem big.Int
+		coef.QuoRem(coef, new(big.Int).Exp(bigTen, big.NewInt(int64(d.Scale-scale)), nil), &rem)
+		if rem.Sign() != 0 {
+			return Decimal{}, fmt.Errorf("mssql: %s has more than %d decimal places", d, scale)
+		}
+	}
+	return Decimal{Coefficient: coef, Scale: scale}, nil
+}
+
+// makeMoneyParam encodes m as a money parameter.
+func makeMoneyParam(m Money) (res param, err error) {
+	d, err := m.rescale(moneyScale)
+	if err != nil {
+		return res, err
+	}
+	if !d.Coefficient.IsInt64() {
+		return res, fmt.Errorf("mssql: %s is out of range for money", d)
+	}
+	v := uint64(d.Coefficient.Int64())
+	res.ti.TypeId = typeMoneyN
+	res.buffer = make([]byte, 8)
+	// money is sent as the high 32 bits followed by the low 32 bits
+	binary.LittleEndian.PutUint32(res.buffer[0:4], uint32(v>>32))
+	binary.LittleEndian.PutUint32(res.buffer[4:8], uint32(v))
+	res.ti.Size = len(res.buffer)
+	return res, nil
+}
@@ -0,0 +1,83 @@
+//go:build go1.18
+// +build go1.18
+
+package mssql
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"strconv"
+)
+
+// MoneyAmount is the types of the amounts MoneyOf can hold.
+type MoneyAmount interface {
+	Decimal | string | float64
+}
+
+// MoneyOf holds an amount of type T stored in a money or smallmoney
+// column. Scanning gives the amount exactly, with 4 decimal places, as a
+// Decimal or as a string such as "12.3400", or rounded to a float64. As a
+// parameter the amount is sent as money, and fails if it has more than 4
+// decimal places. MoneyOf can be null, like sql.NullString.
+type MoneyOf[T MoneyAmount] struct {
+	V     T
+	Valid bool // Valid is true if V is not NULL
+}
+
+// Scan implements the sql.Scanner interface.
+func (m *MoneyOf[T]) Scan(src interface{}) error {
+	var zero T
+	m.V, m.Valid = zero, false
+	if src == nil {
+		return nil
+	}
+	var money Money
+	if err := money.Scan(src); err != nil {
+		return err
+	}
+	switch v := interface{}(&m.V).(type) {
+	case *Decimal:
+		*v = money.Decimal
+	case *string:
+		*v = money.String()
+	case *float64:
+		*v, _ = money.Rat().Float64()
+	}
+	m.Valid = true
+	return nil
+}
+
+// Value implements the driver.Valuer interface. The driver itself sends
+// MoneyOf values as money parameters.
+func (m MoneyOf[T]) Value() (driver.Value, error) {
+	n, err := m.nullMoney()
+	if err != nil {
+		return nil, err
+	}
+	return n.Value()
+}
+
+// nullMoney implements moneyValuer.
+func (m MoneyOf[T]) nullMoney() (NullMoney, error) {
+	if !m.Valid {
+		return NullMoney{}, nil
+	}
+	var d Decimal
+	switch v := interface{}(m.V).(type) {
+	case Decimal:
+		d = v
+	case string:
+		if err := d.Scan(v); err != nil {
+			return NullMoney{}, err
+		}
+	case float64:
+		if err := d.Scan(strconv.FormatFloat(v, 'f', -1, 64)); err != nil {
+			return NullMoney{}, fmt.Errorf("mssql: %v is not a money amount", v)
+		}
+	}
+	d, err := d.rescale(moneyScale)
+	if err != nil {
+		return NullMoney{}, err
+	}
+	return NullMoney{Money: Money{d}, Valid: true}, nil
+}
@@ -0,0 +1,78 @@
+//go:build go1.18
+// +build go1.18
+
+package mssql
+
+import (
+	"math/big"
+	"testing"
+)
+
+func TestMoneyOfScan(t *testing.T) {
+	var d MoneyOf[Decimal]
+	if err := d.Scan([]byte("-12.3400")); err != nil {
+		t.Fatal(err)
+	}
+	if !d.Valid || d.V.String() != "-12.3400" {
+		t.Errorf("got %+v", d)
+	}
+	var s MoneyOf[string]
+	if err := s.Scan(int64(5)); err != nil {
+		t.Fatal(err)
+	}
+	if !s.Valid || s.V != "5.0000" {
+		t.Errorf("got %+v", s)
+	}
+	var f MoneyOf[float64]
+	if err := f.Scan([]byte("0.2500")); err != nil {
+		t.Fatal(err)
+	}
+	if !f.Valid || f.V != 0.25 {
+		t.Errorf("got %+v", f)
+	}
+	if err := f.Scan(nil); err != nil || f.Valid || f.V != 0 {
+		t.Errorf("Scan(nil) = %v, got %+v", err, f)
+	}
+	if err := s.Scan("1.23456"); err == nil {
+		t.Error("expected an error for more than 4 decimal places")
+	}
+}
+
+func TestMoneyOfParam(t *testing.T) {
+	s := &Stmt{}
+	for _, v := range []interface{}{
+		MoneyOf[Decimal]{V: Decimal{Coefficient: big.NewInt(-123456), Scale: 2}, Valid: true},
+		MoneyOf[string]{V: "-1234.56", Valid: true},
+		MoneyOf[float64]{V: -1234.56, Valid: true},
+	} {
+		conv, err := convertInputParameter(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p, err := s.makeParam(conv)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.ti.TypeId != typeMoneyN || string(decodeMoney(p.buffer)) != "-1234.5600" {
+			t.Errorf("%+v: got type %#x, value %s", v, p.ti.TypeId, decodeMoney(p.buffer))
+		}
+	}
+
+	conv, err := convertInputParameter(MoneyOf[string]{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := s.makeParam(conv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ti.TypeId != typeMoneyN || len(p.buffer) != 0 {
+		t.Errorf("NULL: got type %#x, buffer %x", p.ti.TypeId, p.buffer)
+	}
+	if _, err = convertInputParameter(MoneyOf[float64]{V: 0.00001, Valid: true}); err == nil {
+		t.Error("expected an error for more than 4 decimal places")
+	}
+	if v, err := (MoneyOf[string]{V: "2.5", Valid: true}).Value(); err != nil || v != "2.5000" {
+		t.Errorf("Value() = %v, %v", v, err)
+	}
+}
@@ -0,0 +1,104 @@
+package mssql
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"math/big"
+	"testing"
+)
+
+func TestMoneyScan(t *testing.T) {
+	var m Money
+	if err := m.Scan([]byte("-12.3400")); err != nil {
+		t.Fatal(err)
+	}
+	if m.String() != "-12.3400" {
+		t.Errorf("got %s", m)
+	}
+	if err := m.Scan(int64(5)); err != nil {
+		t.Fatal(err)
+	}
+	if m.String() != "5.0000" {
+		t.Errorf("got %s", m)
+	}
+	if err := m.Scan("1.23456"); err == nil {
+		t.Error("expected an error for more than 4 decimal places")
+	}
+
+	var n NullMoney
+	if err := n.Scan(nil); err != nil || n.Valid {
+		t.Errorf("Scan(nil) = %v, valid %v", err, n.Valid)
+	}
+	if err := n.Scan([]byte("0.0100")); err != nil || !n.Valid || n.Money.String() != "0.0100" {
+		t.Errorf("Scan = %v, valid %v, value %s", err, n.Valid, n.Money)
+	}
+}
+
+func TestMakeMoneyParam(t *testing.T) {
+	s := &Stmt{}
+	p, err := s.makeParam(Money{Decimal{Coefficient: big.NewInt(-123456), Scale: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ti.TypeId != typeMoneyN || p.ti.Size != 8 || makeDecl(p.ti) != "money" {
+		t.Errorf("unexpected type info %+v", p.ti)
+	}
+	if got := string(decodeMoney(p.buffer)); got != "-1234.5600" {
+		t.Errorf("decoded %s", got)
+	}
+
+	p, err = s.makeParam(NullMoney{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ti.TypeId != typeMoneyN || len(p.buffer) != 0 {
+		t.Errorf("unexpected NULL money parameter %+v", p)
+	}
+
+	p, err = s.makeParam(NullMoney{Money: Money{Decimal{Coefficient: big.NewInt(1)}}, Valid: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(p.buffer, []byte{0, 0, 0, 0, 0x10, 0x27, 0, 0}) {
+		t.Errorf("unexpected buffer %v", p.buffer)
+	}
+
+	if _, err = s.makeParam(Money{Decimal{Coefficient: big.NewInt(1), Scale: 5}}); err == nil {
+		t.Error("expected an error for more than 4 decimal places")
+	}
+}
+
+func TestMoneyRoundTrip(t *testing.T) {
+	conn, logger := open(t)
+	defer conn.Close()
+	defer logger.StopLogging()
+
+	in := Money{Decimal{Coefficient: big.NewInt(922337203685477), Scale: 2}}
+	var typ string
+	var out Money
+	var small NullMoney
+	err := conn.QueryRowContext(context.Background(),
+		"select convert(sysname, sql_variant_property(convert(sql_variant, @p1), 'BaseType')), @p1, convert(smallmoney, -0.5)", in).Scan(&typ, &out, &small)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ != "money" {
+		t.Errorf("parameter sent as %s", typ)
+	}
+	if out.String() != "9223372036854.7700" {
+		t.Errorf("got %s", out)
+	}
+	if !small.Valid || small.Money.String() != "-0.5000" {
+		t.Errorf("got %v %s", small.Valid, small.Money)
+	}
+
+	out = Money{}
+	_, err = conn.ExecContext(context.Background(), "set @out = @in / 4", sql.Named("in", in), sql.Named("out", sql.Out{Dest: &out}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "2305843009213.6925" {
+		t.Errorf("output parameter got %s", out)
+	}
+}
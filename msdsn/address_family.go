@@ -0,0 +1,52 @@
+package msdsn
+
+import (
+	"fmt"
+	"strings"
+)
+
+// AddressFamily selects the resolved addresses of the server that are
+// dialed, and their order, with the ipaddressfamily parameter.
+type AddressFamily int
+
+const (
+	// AddressFamilyAny dials the addresses in the order they are resolved.
+	AddressFamilyAny AddressFamily = iota
+	// AddressFamilyIPv4 only dials IPv4 addresses.
+	AddressFamilyIPv4
+	// AddressFamilyIPv6 only dials IPv6 addresses.
+	AddressFamilyIPv6
+	// AddressFamilyPreferIPv4 dials the IPv4 addresses before the IPv6 ones.
+	AddressFamilyPreferIPv4
+	// AddressFamilyPreferIPv6 dials the IPv6 addresses before the IPv4 ones.
+	AddressFamilyPreferIPv6
+)
+
+var addressFamilyNames = []string{"any", "ipv4", "ipv6", "preferipv4", "preferipv6"}
+
+// String returns the value of the ipaddressfamily parameter for f.
+func (f AddressFamily) String() string {
+	if f < 0 || int(f) >= len(addressFamilyNames) {
+		return fmt.Sprintf("AddressFamily(%d)", int(f))
+	}
+	return addressFamilyNames[f]
+}
+
+// parseAddressFamily reads the value of the ipaddressfamily parameter,
+// which also takes the values of the "IP Address Preference" keyword of
+// SqlClient: IPv4First, IPv6First and UsePlatformDefault.
+func parseAddressFamily(v string) (AddressFamily, error) {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case "", "any", "useplatformdefault":
+		return AddressFamilyAny, nil
+	case "ipv4":
+		return AddressFamilyIPv4, nil
+	case "ipv6":
+		return AddressFamilyIPv6, nil
+	case "preferipv4", "ipv4first":
+		return AddressFamilyPreferIPv4, nil
+	case "preferipv6", "ipv6first":
+		return AddressFamilyPreferIPv6, nil
+	}
+	return AddressFamilyAny, fmt.Errorf("invalid ipaddressfamily value '%s': must be any, ipv4, ipv6, preferipv4 or preferipv6", v)
+}
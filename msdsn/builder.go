@@ -0,0 +1,253 @@
+package msdsn
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConfigBuilder builds a Config from typed settings instead of a
+// connection string, so values such as passwords need no escaping. Each
+// With method sets a connection string parameter and returns the builder:
+//
+//	config, err := msdsn.NewConfig().
+//		WithHost("myserver").
+//		WithDatabase("sales").
+//		WithUser("app", password).
+//		WithEncryption(msdsn.EncryptionRequired).
+//		Config()
+type ConfigBuilder struct {
+	params map[string]string
+	err    error
+}
+
+// NewConfig returns an empty ConfigBuilder.
+func NewConfig() *ConfigBuilder {
+	return &ConfigBuilder{params: map[string]string{}}
+}
+
+// WithHost sets the name or address of the server.
+func (b *ConfigBuilder) WithHost(host string) *ConfigBuilder {
+	server := host
+	if _, instance := b.server(); instance != "" {
+		server += `\` + instance
+	}
+	return b.WithParameter(Server, server)
+}
+
+// WithInstance sets the name of the SQL Server instance, whose port is
+// then looked up with the SQL Server Browser.
+func (b *ConfigBuilder) WithInstance(instance string) *ConfigBuilder {
+	host, _ := b.server()
+	if instance != "" {
+		host += `\` + instance
+	}
+	return b.WithParameter(Server, host)
+}
+
+func (b *ConfigBuilder) server() (host, instance string) {
+	parts := strings.SplitN(b.params[Server], `\`, 2)
+	if len(parts) > 1 {
+		return parts[0], parts[1]
+	}
+	return parts[0], ""
+}
+
+// WithPort sets the TCP port of the server.
+func (b *ConfigBuilder) WithPort(port uint16) *ConfigBuilder {
+	return b.WithParameter(Port, strconv.Itoa(int(port)))
+}
+
+// WithDatabase sets the initial database of the connections.
+func (b *ConfigBuilder) WithDatabase(database string) *ConfigBuilder {
+	return b.WithParameter(Database, database)
+}
+
+// WithUser sets the login and password of SQL Server authentication.
+func (b *ConfigBuilder) WithUser(user, password string) *ConfigBuilder {
+	return b.WithParameter(UserID, user).WithParameter(Password, password)
+}
+
+// WithEncryption sets the encryption mode of the connections.
+func (b *ConfigBuilder) WithEncryption(encryption Encryption) *ConfigBuilder {
+	switch encryption {
+	case EncryptionOff:
+		return b.WithParameter(Encrypt, "false")
+	case EncryptionRequired:
+		return b.WithParameter(Encrypt, "true")
+	case EncryptionDisabled:
+		return b.WithParameter(Encrypt, "disable")
+	case EncryptionStrict:
+		return b.WithParameter(Encrypt, "strict")
+	}
+	if b.err == nil {
+		b.err = ConfigError{[]string{Encrypt}, fmt.Sprintf("unknown encryption mode %d", encryption)}
+	}
+	return b
+}
+
+// WithTrustServerCertificate sets whether the certificate of the server
+// is accepted without being verified.
+func (b *ConfigBuilder) WithTrustServerCertificate(trust bool) *ConfigBuilder {
+	return b.WithParameter(TrustServerCertificate, strconv.FormatBool(trust))
+}
+
+// WithCertificate sets the path of the certificate file used to verify the
+// certificate of the server.
+func (b *ConfigBuilder) WithCertificate(path string) *ConfigBuilder {
+	return b.WithParameter(Certificate, path)
+}
+
+// WithHostNameInCertificate sets the host name expected in the
+// certificate of the server, when it differs from the host.
+func (b *ConfigBuilder) WithHostNameInCertificate(name string) *ConfigBuilder {
+	return b.WithParameter(HostNameInCertificate, name)
+}
+
+// WithTLSMin sets the lowest TLS version accepted, such as "1.2".
+func (b *ConfigBuilder) WithTLSMin(version string) *ConfigBuilder {
+	return b.WithParameter(TLSMin, version)
+}
+
+// WithFedAuth sets the Microsoft Entra authentication method, such as
+// ActiveDirectoryDefault, used by the connectors of the azuread package.
+func (b *ConfigBuilder) WithFedAuth(method string) *ConfigBuilder {
+	return b.WithParameter("fedauth", method)
+}
+
+// WithAppName sets the application name the server reports for the
+// connections.
+func (b *ConfigBuilder) WithAppName(name string) *ConfigBuilder {
+	return b.WithParameter(AppName, name)
+}
+
+// WithWorkloadGroup sets the workload group hint sent at login with the
+// application name.
+func (b *ConfigBuilder) WithWorkloadGroup(group string) *ConfigBuilder {
+	return b.WithParameter(WorkloadGroup, group)
+}
+
+// WithPacketSize sets the requested size of the TDS packets.
+func (b *ConfigBuilder) WithPacketSize(size uint16) *ConfigBuilder {
+	return b.WithParameter(PacketSize, strconv.Itoa(int(size)))
+}
+
+// WithDialTimeout sets the timeout of dialing each protocol, rounded down
+// to the second.
+func (b *ConfigBuilder) WithDialTimeout(timeout time.Duration) *ConfigBuilder {
+	return b.WithParameter(DialTimeout, strconv.FormatInt(int64(timeout/time.Second), 10))
+}
+
+// WithConnectionTimeout sets the timeout of logging in, rounded down to
+// the second.
+func (b *ConfigBuilder) WithConnectionTimeout(timeout time.Duration) *ConfigBuilder {
+	return b.WithParameter(ConnectionTimeout, strconv.FormatInt(int64(timeout/time.Second), 10))
+}
+
+// WithLoginTimeout sets the timeout of the login once the connection is
+// dialed, rounded down to the second.
+func (b *ConfigBuilder) WithLoginTimeout(timeout time.Duration) *ConfigBuilder {
+	return b.WithParameter(LoginTimeout, strconv.FormatInt(int64(timeout/time.Second), 10))
+}
+
+// WithCommandTimeout sets the deadline given to statements run with a
+// context that has none, rounded down to the second.
+func (b *ConfigBuilder) WithCommandTimeout(timeout time.Duration) *ConfigBuilder {
+	return b.WithParameter(CommandTimeout, strconv.FormatInt(int64(timeout/time.Second), 10))
+}
+
+// WithKeepAlive sets the idle time before the first TCP keepalive probe,
+// the time between two probes and the number of unanswered probes after
+// which the connection is dropped, rounded down to the second. Zero leaves
+// a setting as is; the interval and the count are only applied on Linux.
+func (b *ConfigBuilder) WithKeepAlive(idle, interval time.Duration, count int) *ConfigBuilder {
+	if idle > 0 {
+		b.WithParameter(KeepAlive, strconv.FormatInt(int64(idle/time.Second), 10))
+	}
+	if interval > 0 {
+		b.WithParameter(KeepAliveInterval, strconv.FormatInt(int64(interval/time.Second), 10))
+	}
+	if count > 0 {
+		b.WithParameter(KeepAliveCount, strconv.Itoa(count))
+	}
+	return b
+}
+
+// WithTCPUserTimeout sets the longest time data sent may stay
+// unacknowledged before the connection is dropped, rounded down to the
+// second. It is only applied on Linux.
+func (b *ConfigBuilder) WithTCPUserTimeout(timeout time.Duration) *ConfigBuilder {
+	return b.WithParameter(TCPUserTimeout, strconv.FormatInt(int64(timeout/time.Second), 10))
+}
+
+// WithIPAddressFamily selects which resolved addresses of the server are
+// dialed and in what order.
+func (b *ConfigBuilder) WithIPAddressFamily(family AddressFamily) *ConfigBuilder {
+	return b.WithParameter(IPAddressFamily, family.String())
+}
+
+// WithReadOnlyIntent sets the application intent to ReadOnly, so
+// availability group listeners route the connections to readable
+// secondary replicas.
+func (b *ConfigBuilder) WithReadOnlyIntent() *ConfigBuilder {
+	return b.WithParameter(ApplicationIntent, "ReadOnly")
+}
+
+// WithParameter sets any connection string parameter, such as LogParam or
+// the session options. Names are case insensitive.
+func (b *ConfigBuilder) WithParameter(name, value string) *ConfigBuilder {
+	b.params[strings.ToLower(name)] = value
+	return b
+}
+
+// Config returns the Config of the parameters set, checked with Validate.
+func (b *ConfigBuilder) Config() (Config, error) {
+	if b.err != nil {
+		return Config{}, b.err
+	}
+	params := make(map[string]string, len(b.params))
+	for k, v := range b.params {
+		params[k] = v
+	}
+	p, err := parseParams(params)
+	if err != nil {
+		return p, err
+	}
+	return p, p.Validate()
+}
+
+// URL returns the connection string of the parameters set in the URL
+// format. The server, port, instance and credentials are in the URL itself
+// and the other parameters in its query, sorted by name.
+func (b *ConfigBuilder) URL() *url.URL {
+	u := &url.URL{Scheme: "sqlserver"}
+	host, instance := b.server()
+	if port, ok := b.params[Port]; ok {
+		host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") && !strings.HasPrefix(host, "[") {
+		// an IPv6 address
+		host = "[" + host + "]"
+	}
+	u.Host = host
+	if instance != "" {
+		u.Path = "/" + instance
+	}
+	if password, ok := b.params[Password]; ok {
+		u.User = url.UserPassword(b.params[UserID], password)
+	} else if user, ok := b.params[UserID]; ok {
+		u.User = url.User(user)
+	}
+	q := url.Values{}
+	for k, v := range b.params {
+		switch k {
+		case Server, Port, UserID, Password:
+		default:
+			q.Set(k, v)
+		}
+	}
+	u.RawQuery = q.Encode()
+	return u
+}
@@ -0,0 +1,190 @@
+package msdsn
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ADOString returns p as an ADO connection string, which Parse reads back
+// into an equivalent Config. Values holding a semicolon, leading or
+// trailing white space or a leading quote are quoted the way ADO.NET
+// reads them.
+//
+// The parameters come from p.Parameters, updated with the fields of p.
+// TLSConfig and ProtocolParameters cannot be written in a connection
+// string and are left out.
+func (p Config) ADOString() string {
+	return p.formatParams(quoteADOValue)
+}
+
+// ODBCString returns p as an ODBC connection string, with the odbc:
+// prefix, which Parse reads back into an equivalent Config. Values that
+// need it are enclosed in braces. See ADOString for the parameters
+// written.
+func (p Config) ODBCString() string {
+	return "odbc:" + p.formatParams(quoteODBCValue)
+}
+
+func (p Config) formatParams(quote func(string) string) string {
+	params := p.connectionParams()
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(';')
+		}
+		b.WriteString(k)
+		b.WriteByte('=')
+		b.WriteString(quote(params[k]))
+	}
+	return b.String()
+}
+
+// connectionParams returns the connection string parameters of p: those
+// of p.Parameters, with the ones backed by a field of p set from it.
+// Fields holding their default value are only written when the parameter
+// was given.
+func (p Config) connectionParams() map[string]string {
+	params := make(map[string]string, len(p.Parameters)+8)
+	for k, v := range p.Parameters {
+		params[k] = v
+	}
+	setString := func(name, value string) {
+		if value != "" {
+			params[name] = value
+		} else {
+			delete(params, name)
+		}
+	}
+	setUint := func(name string, value uint64) {
+		if value != 0 {
+			params[name] = strconv.FormatUint(value, 10)
+		}
+	}
+	setBool := func(name string, value, def bool) {
+		if _, ok := params[name]; ok || value != def {
+			params[name] = strconv.FormatBool(value)
+		}
+	}
+
+	if p.Host != "" {
+		server := p.Host
+		if p.Instance != "" {
+			server += `\` + p.Instance
+		}
+		params[Server] = server
+	}
+	setUint(Port, p.Port)
+	setString(Database, p.Database)
+	setString(UserID, p.User)
+	setString(Password, p.Password)
+	setString(ChangePassword, p.ChangePassword)
+	setString(FailoverPartner, p.FailOverPartner)
+	setUint(FailOverPort, p.FailOverPort)
+	setString(ServerSpn, p.ServerSPN)
+	if p.Workstation != "" {
+		params[WorkstationID] = p.Workstation
+	}
+	if p.AppName != "" {
+		params[AppName] = p.AppName
+	}
+	setString(WorkloadGroup, p.WorkloadGroup)
+	if p.ReadOnlyIntent {
+		params[ApplicationIntent] = "ReadOnly"
+	}
+
+	switch p.Encryption {
+	case EncryptionRequired:
+		params[Encrypt] = "true"
+	case EncryptionDisabled:
+		params[Encrypt] = "disable"
+	case EncryptionStrict:
+		params[Encrypt] = "strict"
+	default:
+		if _, ok := params[Encrypt]; ok {
+			params[Encrypt] = "false"
+		}
+	}
+
+	setUint(PacketSize, uint64(p.PacketSize))
+	setUint(LogParam, uint64(p.LogFlags))
+	setUint(ConnectionTimeout, uint64(p.ConnTimeout.Seconds()))
+	setUint(DialTimeout, uint64(p.DialTimeout.Seconds()))
+	setUint(LoginTimeout, uint64(p.LoginTimeout.Seconds()))
+	setUint(KeepAlive, uint64(p.KeepAlive.Seconds()))
+	setUint(KeepAliveInterval, uint64(p.KeepAliveInterval.Seconds()))
+	setUint(KeepAliveCount, uint64(p.KeepAliveCount))
+	setUint(TCPUserTimeout, uint64(p.TCPUserTimeout.Seconds()))
+	setUint(ServerlessResumeTimeout, uint64(p.ServerlessResumeTimeout.Seconds()))
+	setUint(BrowserCacheTTL, uint64(p.BrowserCacheTTL.Seconds()))
+	if p.IPAddressFamily != AddressFamilyAny {
+		params[IPAddressFamily] = p.IPAddressFamily.String()
+	}
+	if p.CommandTimeout != 0 {
+		delete(params, QueryTimeout)
+		params[CommandTimeout] = strconv.FormatUint(uint64(p.CommandTimeout.Seconds()), 10)
+	}
+	params[DisableRetry] = strconv.FormatBool(p.DisableRetry)
+	setBool("columnencryption", p.ColumnEncryption, false)
+	setBool(RetryReadOnly, p.RetryReadOnly, false)
+	setBool(AzureRetry, p.AzureRetry, false)
+	setBool(MultiSubnetFailover, p.MultiSubnetFailover, true)
+	setUint(MultiSubnetFailoverDelay, uint64(p.MultiSubnetFailoverDelay.Milliseconds()))
+	setBool(TrustedConnection, p.TrustedConnection, false)
+	setBool(CoalesceWrites, p.CoalesceWrites, false)
+	setBool(DescribeParameters, p.DescribeParameters, false)
+	if len(p.ParameterSizeBuckets) > 0 {
+		buckets := make([]string, len(p.ParameterSizeBuckets))
+		for i, n := range p.ParameterSizeBuckets {
+			buckets[i] = strconv.Itoa(n)
+		}
+		params[ParameterSizeBuckets] = strings.Join(buckets, ",")
+	}
+	setBool(GUIDConversion, p.Encoding.GUIDConversion, false)
+	setBool(TypedVariants, p.Encoding.TypedVariants, false)
+	setBool(VectorSupport, p.VectorSupport, false)
+	setBool(UTF8Support, p.UTF8Support, false)
+	setBool(JSONSupport, p.JSONSupport, false)
+	setBool(DisableBufferPool, p.DisableBufferPool, false)
+	if s := p.Encoding.DateTimeScan; s != "" && s != DateTimeScanTime {
+		params[DateTimeScan] = s
+	}
+	if p.Encoding.Timezone != nil {
+		params[Timezone] = p.Encoding.Timezone.String()
+	}
+	return params
+}
+
+// quoteADOValue encloses v in quotes, as ADO.NET reads them, when the ADO
+// format cannot hold it as is. The quote character is doubled inside the
+// value.
+func quoteADOValue(v string) string {
+	if !needsADOQuotes(v) {
+		return v
+	}
+	if !strings.ContainsRune(v, '"') {
+		return `"` + v + `"`
+	}
+	if !strings.ContainsRune(v, '\'') {
+		return `'` + v + `'`
+	}
+	return `"` + strings.ReplaceAll(v, `"`, `""`) + `"`
+}
+
+// quoteODBCValue encloses v in braces when the ODBC format cannot hold it
+// as is. Closing braces are doubled inside the value.
+func quoteODBCValue(v string) string {
+	if v == "" {
+		return v
+	}
+	if !strings.ContainsRune(v, ';') && v[0] != '{' && strings.TrimFunc(v, unicode.IsSpace) == v {
+		return v
+	}
+	return "{" + strings.ReplaceAll(v, "}", "}}") + "}"
+}
@@ -6,6 +6,7 @@ import (
 	"io"
 	"os"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
@@ -19,13 +20,46 @@ func TestInvalidConnectionString(t *testing.T) {
 		"packet size=invalid",
 		"connection timeout=invalid",
 		"dial timeout=invalid",
+		"command timeout=-1",
+		"query timeout=soon",
 		"keepalive=invalid",
+		"keepaliveinterval=-1",
+		"keepalivecount=300",
+		"tcpusertimeout=soon",
+		"tcpusertimeout=2147484",
+		"ipaddressfamily=ipv5",
+		"login timeout=-3",
 		"encrypt=invalid",
 		"trustservercertificate=invalid",
 		"failoverport=invalid",
 		"applicationintent=ReadOnly",
 		"disableretry=invalid",
 		"multisubnetfailover=invalid",
+		"trusted_connection=invalid",
+		"coalescewrites=maybe",
+		"describeparameters=maybe",
+		"parametersizebuckets=maybe",
+		"parametersizebuckets=500,100",
+		"parametersizebuckets=0,100",
+		"parametersizebuckets=9000",
+		"guid conversion=maybe",
+		"typedvariants=maybe",
+		"datetimescan=local",
+		"timezone=Mars/Olympus_Mons",
+		"serverlessresumetimeout=soon",
+		"browsercachettl=-1",
+		"multisubnetfailoverdelay=soon",
+		"vectorsupport=maybe",
+		"utf8support=maybe",
+		"jsonsupport=maybe",
+		"retryreadonly=maybe",
+		"azureretry=maybe",
+		"disablebufferpool=x",
+		"arithabort=sometimes",
+		"lock_timeout=-5",
+		"lock_timeout=soon",
+		"deadlock_priority=11",
+		"deadlock_priority=urgent",
 
 		// ODBC mode
 		"odbc:password={",
@@ -91,8 +125,21 @@ func TestValidConnectionString(t *testing.T) {
 		{"encrypt=optional", func(p Config) bool { return p.Encryption == EncryptionOff }},
 		{"encrypt=strict", func(p Config) bool { return p.Encryption == EncryptionStrict }},
 		{"connection timeout=3;dial timeout=4;keepalive=5", func(p Config) bool {
-			return p.ConnTimeout == 3*time.Second && p.DialTimeout == 4*time.Second && p.KeepAlive == 5*time.Second
+			return p.ConnTimeout == 3*time.Second && p.DialTimeout == 4*time.Second && p.KeepAlive == 5*time.Second && p.LoginTimeout == 0
 		}},
+		{"dial timeout=4;login timeout=10", func(p Config) bool {
+			return p.DialTimeout == 4*time.Second && p.LoginTimeout == 10*time.Second
+		}},
+		{"keepaliveinterval=5;keepalivecount=3;tcpusertimeout=20", func(p Config) bool {
+			return p.KeepAliveInterval == 5*time.Second && p.KeepAliveCount == 3 && p.TCPUserTimeout == 20*time.Second
+		}},
+		{"ipaddressfamily=IPv6", func(p Config) bool { return p.IPAddressFamily == AddressFamilyIPv6 }},
+		{"IP Address Preference=IPv4First", func(p Config) bool { return p.IPAddressFamily == AddressFamilyPreferIPv4 }},
+		{"odbc:ipaddressfamily=preferipv6", func(p Config) bool { return p.IPAddressFamily == AddressFamilyPreferIPv6 }},
+		{"server=somehost", func(p Config) bool { return p.IPAddressFamily == AddressFamilyAny }},
+		{"command timeout=30", func(p Config) bool { return p.CommandTimeout == 30*time.Second }},
+		{"odbc:query timeout=45", func(p Config) bool { return p.CommandTimeout == 45*time.Second }},
+		{"command timeout=0;query timeout=45", func(p Config) bool { return p.CommandTimeout == 0 }},
 		{"log=63", func(p Config) bool { return p.LogFlags == 63 && p.Port == 0 }},
 		{"log=63;port=1000", func(p Config) bool { return p.LogFlags == 63 && p.Port == 1000 }},
 		{"log=64", func(p Config) bool { return p.LogFlags == 64 }},
@@ -107,6 +154,42 @@ func TestValidConnectionString(t *testing.T) {
 		{"", func(p Config) bool { return p.DisableRetry == disableRetryDefault }},
 		{"MultiSubnetFailover=true", func(p Config) bool { return p.MultiSubnetFailover }},
 		{"MultiSubnetFailover=false", func(p Config) bool { return !p.MultiSubnetFailover }},
+		{"multisubnetfailoverdelay=150", func(p Config) bool { return p.MultiSubnetFailoverDelay == 150*time.Millisecond }},
+		{"trusted_connection=yes", func(p Config) bool { return p.TrustedConnection }},
+		{"Integrated Security=SSPI", func(p Config) bool { return p.TrustedConnection }},
+		{"integrated security=true", func(p Config) bool { return p.TrustedConnection }},
+		{"trusted_connection=no", func(p Config) bool { return !p.TrustedConnection }},
+		{"coalescewrites=true", func(p Config) bool { return p.CoalesceWrites }},
+		{"describeparameters=true", func(p Config) bool { return p.DescribeParameters }},
+		{"parametersizebuckets=true", func(p Config) bool { return reflect.DeepEqual(p.ParameterSizeBuckets, []int{100, 500, 4000}) }},
+		{"parametersizebuckets=false", func(p Config) bool { return p.ParameterSizeBuckets == nil }},
+		{"parametersizebuckets=255, 4000", func(p Config) bool { return reflect.DeepEqual(p.ParameterSizeBuckets, []int{255, 4000}) }},
+		{"guid conversion=true", func(p Config) bool { return p.Encoding.GUIDConversion }},
+		{"datetimescan=Civil", func(p Config) bool { return p.Encoding.DateTimeScan == DateTimeScanCivil }},
+		{"datetimescan=string", func(p Config) bool { return p.Encoding.DateTimeScan == DateTimeScanString }},
+		{"server=localhost", func(p Config) bool { return p.Encoding.DateTimeScan == DateTimeScanTime }},
+		{"serverlessresumetimeout=90", func(p Config) bool { return p.ServerlessResumeTimeout == 90*time.Second }},
+		{"browsercachettl=300", func(p Config) bool { return p.BrowserCacheTTL == 5*time.Minute }},
+		{"timezone=UTC", func(p Config) bool { return p.Encoding.Timezone == time.UTC }},
+		{"server=localhost", func(p Config) bool { return p.Encoding.Timezone == nil }},
+		{"typedvariants=true", func(p Config) bool { return p.Encoding.TypedVariants }},
+		{"vectorsupport=true", func(p Config) bool { return p.VectorSupport }},
+		{"utf8support=true", func(p Config) bool { return p.UTF8Support }},
+		{"jsonsupport=true", func(p Config) bool { return p.JSONSupport }},
+		{"azureretry=true", func(p Config) bool { return p.AzureRetry }},
+		{"applicationintent=ReadOnly;database=sales;retryreadonly=true", func(p Config) bool { return p.ReadOnlyIntent && p.RetryReadOnly }},
+		{"disablebufferpool=true", func(p Config) bool { return p.DisableBufferPool }},
+		{"arithabort=true;ansi_warnings=off;lock_timeout=5000;deadlock_priority=low", func(p Config) bool {
+			return reflect.DeepEqual(p.SessionSettings, []string{"SET ARITHABORT ON", "SET ANSI_WARNINGS OFF", "SET LOCK_TIMEOUT 5000", "SET DEADLOCK_PRIORITY LOW"})
+		}},
+		{"sqlserver://somehost?xact_abort=1&nocount=on&deadlock_priority=-5", func(p Config) bool {
+			return reflect.DeepEqual(p.SessionSettings, []string{"SET XACT_ABORT ON", "SET NOCOUNT ON", "SET DEADLOCK_PRIORITY -5"})
+		}},
+		{"server=somehost", func(p Config) bool { return len(p.SessionSettings) == 0 }},
+		{"new password=n3w;password=old", func(p Config) bool { return p.ChangePassword == "n3w" && p.Password == "old" }},
+		{"sqlserver://someuser@somehost?change+password=n3w", func(p Config) bool { return p.ChangePassword == "n3w" }},
+		{"server=somehost", func(p Config) bool { return !p.CoalesceWrites }},
+		{"server=somehost", func(p Config) bool { return !p.TrustedConnection }},
 
 		// those are supported currently, but maybe should not be
 		{"someparam", func(p Config) bool { return true }},
@@ -164,6 +247,9 @@ func TestValidConnectionString(t *testing.T) {
 		{"odbc:server=somehost;user id=someuser;password=somepass; disableretry =  1 ", func(p Config) bool {
 			return p.Host == "somehost" && p.User == "someuser" && p.Password == "somepass" && p.DisableRetry
 		}},
+		{"odbc:server=somehost;Trusted_Connection=Yes", func(p Config) bool {
+			return p.Host == "somehost" && p.TrustedConnection
+		}},
 
 		// URL mode
 		{"sqlserver://somehost?connection+timeout=30", func(p Config) bool {
@@ -323,3 +409,293 @@ func TestReadCertificate(t *testing.T) {
 	assert.NotNil(t, err, "Expected error while reading certificate, found nil")
 	assert.Nil(t, cert, "Expected certificate to be nil, found %v", cert)
 }
+
+func TestValidate(t *testing.T) {
+	valid := []string{
+		"server=somehost",
+		"server=somehost;encrypt=disable",
+		"server=somehost;encrypt=true;tlsmin=1.2;hostnameincertificate=other",
+		"server=somehost;encrypt=true;trustservercertificate=true",
+	}
+	for _, dsn := range valid {
+		p, err := Parse(dsn)
+		if err != nil {
+			t.Fatalf("%s: %v", dsn, err)
+		}
+		if err = p.Validate(); err != nil {
+			t.Errorf("%s: %v", dsn, err)
+		}
+	}
+
+	invalid := []struct {
+		dsn      string
+		settings []string
+	}{
+		{"server=somehost;encrypt=disable;tlsmin=1.2", []string{Encrypt, TLSMin}},
+		{"server=somehost;encrypt=disable;hostnameincertificate=other", []string{Encrypt, HostNameInCertificate}},
+		{"server=somehost;encrypt=true;tlsmin=1.4", []string{TLSMin}},
+		{"server=somehost;retryreadonly=true", []string{RetryReadOnly, ApplicationIntent}},
+	}
+	for _, tst := range invalid {
+		p, err := Parse(tst.dsn)
+		if err != nil {
+			t.Fatalf("%s: %v", tst.dsn, err)
+		}
+		err = p.Validate()
+		cerr, ok := err.(ConfigError)
+		if !ok || !reflect.DeepEqual(cerr.Settings, tst.settings) {
+			t.Errorf("%s: got %v, want a ConfigError for %v", tst.dsn, err, tst.settings)
+		}
+	}
+
+	for _, p := range []Config{
+		{Encryption: 2},
+		{Encryption: EncryptionDisabled, TLSConfig: &tls.Config{}},
+		{PacketSize: 100},
+		{IPAddressFamily: 7},
+		{Port: 70000},
+		{FailOverPort: 70000},
+		{TCPUserTimeout: 30 * 24 * time.Hour},
+		{ReadOnlyIntent: true},
+		{Parameters: map[string]string{TrustServerCertificate: "true", Certificate: "ca.pem"}},
+	} {
+		if _, ok := p.Validate().(ConfigError); !ok {
+			t.Errorf("%+v should not be valid", p)
+		}
+	}
+
+	// with encrypt=strict the certificate is verified even when trusted
+	strict := Config{Encryption: EncryptionStrict, Parameters: map[string]string{TrustServerCertificate: "true", Certificate: "ca.pem"}}
+	if err := strict.Validate(); err != nil {
+		t.Errorf("%+v: %v", strict, err)
+	}
+}
+
+func TestClone(t *testing.T) {
+	p, err := Parse("server=somehost;encrypt=true;arithabort=on")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := p.Clone()
+	if !reflect.DeepEqual(c, p) {
+		t.Fatalf("got %+v, want %+v", c, p)
+	}
+	c.Parameters[Database] = "other"
+	c.TLSConfig.ServerName = "other"
+	c.SessionSettings[0] = "SET NOCOUNT ON;"
+	if p.Parameters[Database] != "" || p.TLSConfig.ServerName != "somehost" || p.SessionSettings[0] == c.SessionSettings[0] {
+		t.Errorf("changing the clone changed the original config %+v", p)
+	}
+}
+
+func TestConfigBuilder(t *testing.T) {
+	const password = `p@ss:w/rd;{x}=?&"`
+	b := NewConfig().
+		WithInstance("inst").
+		WithHost("somehost").
+		WithPort(1500).
+		WithDatabase("sales db").
+		WithUser(`domain\user`, password).
+		WithEncryption(EncryptionRequired).
+		WithTLSMin("1.2").
+		WithAppName("app").
+		WithPacketSize(8192).
+		WithDialTimeout(5*time.Second).
+		WithCommandTimeout(30*time.Second).
+		WithLoginTimeout(8*time.Second).
+		WithKeepAlive(10*time.Second, 2*time.Second, 4).
+		WithTCPUserTimeout(15*time.Second).
+		WithIPAddressFamily(AddressFamilyPreferIPv6).
+		WithParameter("ArithAbort", "on")
+	p, err := b.Config()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Host != "somehost" || p.Instance != "inst" || p.Port != 1500 || p.Database != "sales db" ||
+		p.User != `domain\user` || p.Password != password || p.Encryption != EncryptionRequired ||
+		p.TLSConfig.MinVersion != tls.VersionTLS12 || p.AppName != "app" || p.PacketSize != 8192 ||
+		p.DialTimeout != 5*time.Second || p.CommandTimeout != 30*time.Second || len(p.SessionSettings) != 1 ||
+		p.KeepAlive != 10*time.Second || p.KeepAliveInterval != 2*time.Second || p.KeepAliveCount != 4 || p.TCPUserTimeout != 15*time.Second ||
+		p.IPAddressFamily != AddressFamilyPreferIPv6 || p.LoginTimeout != 8*time.Second {
+		t.Errorf("got config %+v", p)
+	}
+
+	u := b.URL()
+	back, err := Parse(u.String())
+	if err != nil {
+		t.Fatalf("%s: %v", u, err)
+	}
+	back.Parameters, p.Parameters = nil, nil
+	back.TLSConfig, p.TLSConfig = nil, nil
+	if !reflect.DeepEqual(back, p) {
+		t.Errorf("parsing %s got %+v, want %+v", u, back, p)
+	}
+
+	for _, tst := range []struct {
+		b    *ConfigBuilder
+		want string
+	}{
+		{NewConfig().WithHost("::1"), "[::1]"},
+		{NewConfig().WithHost("::1").WithPort(1500), "[::1]:1500"},
+		{NewConfig().WithHost("[::1]"), "[::1]"},
+	} {
+		u := tst.b.URL()
+		if u.Host != tst.want {
+			t.Errorf("got URL host %q, want %q", u.Host, tst.want)
+		}
+		if back, err := Parse(u.String()); err != nil || back.Host != "::1" {
+			t.Errorf("parsing %s got host %q, %v", u, back.Host, err)
+		}
+	}
+
+	if _, err = NewConfig().WithHost("somehost").WithEncryption(EncryptionDisabled).WithTLSMin("1.2").Config(); err == nil {
+		t.Error("conflicting settings should fail")
+	}
+	if _, err = NewConfig().WithEncryption(2).Config(); err == nil {
+		t.Error("an unknown encryption mode should fail")
+	}
+}
+
+func TestADOAndODBCString(t *testing.T) {
+	for _, pwd := range []string{`plain`, `a;b`, ` spaced `, `"quoted"`, `it's "both";`, `{braced}}`, `'`} {
+		// ADO values cannot hold semicolons or surrounding white space
+		adoSafe := !strings.ContainsRune(pwd, ';') && strings.TrimSpace(pwd) == pwd
+		p := Config{
+			Host:                 "somehost",
+			Instance:             "inst",
+			Port:                 1500,
+			Database:             "sales",
+			User:                 "sa",
+			Password:             pwd,
+			AppName:              "app",
+			Encryption:           EncryptionRequired,
+			PacketSize:           8192,
+			DialTimeout:          5 * time.Second,
+			CommandTimeout:       30 * time.Second,
+			KeepAliveInterval:    5 * time.Second,
+			KeepAliveCount:       3,
+			TCPUserTimeout:       20 * time.Second,
+			IPAddressFamily:      AddressFamilyIPv4,
+			KeepAlive:            30 * time.Second,
+			MultiSubnetFailover:  false,
+			ParameterSizeBuckets: []int{255, 4000},
+			Parameters:           map[string]string{ArithAbort: "on", TLSMin: "1.2"},
+		}
+		strs := []string{p.ODBCString()}
+		if adoSafe {
+			strs = append(strs, p.ADOString())
+		}
+		for _, s := range strs {
+			back, err := Parse(s)
+			if err != nil {
+				t.Errorf("%s: %v", s, err)
+				continue
+			}
+			if back.Host != p.Host || back.Instance != p.Instance || back.Port != p.Port || back.Database != p.Database ||
+				back.User != p.User || back.Password != pwd || back.AppName != p.AppName || back.Encryption != p.Encryption ||
+				back.PacketSize != p.PacketSize || back.DialTimeout != p.DialTimeout || back.CommandTimeout != p.CommandTimeout || back.MultiSubnetFailover ||
+				back.KeepAliveInterval != p.KeepAliveInterval || back.KeepAliveCount != p.KeepAliveCount || back.TCPUserTimeout != p.TCPUserTimeout ||
+				back.IPAddressFamily != p.IPAddressFamily || !reflect.DeepEqual(back.ParameterSizeBuckets, p.ParameterSizeBuckets) ||
+				len(back.SessionSettings) != 1 || back.TLSConfig.MinVersion != tls.VersionTLS12 {
+				t.Errorf("%s: got %+v", s, back)
+			}
+		}
+	}
+
+	p, err := Parse("server=somehost;database=sales;describeparameters=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	back, err := Parse(p.ADOString())
+	if err != nil {
+		t.Fatal(err)
+	}
+	back.Parameters, p.Parameters = nil, nil
+	back.TLSConfig, p.TLSConfig = nil, nil
+	if !reflect.DeepEqual(back, p) {
+		t.Errorf("got %+v, want %+v", back, p)
+	}
+}
+
+func TestADOStringQuotes(t *testing.T) {
+	// quotes are part of ADO values for Parse
+	p, err := Parse(`server=somehost;password="abc"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Password != `"abc"` {
+		t.Errorf("got password %q, want %q", p.Password, `"abc"`)
+	}
+	for _, tst := range []struct{ in, want string }{
+		{`plain`, `plain`},
+		{`"abc"`, `'"abc"'`},
+		{`a;b`, `"a;b"`},
+		{` spaced `, `" spaced "`},
+		{`say "hi";`, `'say "hi";'`},
+		{`it's "both";`, `"it's ""both"";"`},
+	} {
+		if got := quoteADOValue(tst.in); got != tst.want {
+			t.Errorf("quoteADOValue(%q) = %q, want %q", tst.in, got, tst.want)
+		}
+	}
+
+	for _, password := range []string{`plain`, `"abc"`, `a;b`, ` spaced `, `  `, `say "hi";`, `it's "both";`, `" x "`, `'`, `""`, `a=b;c`} {
+		p := Config{Host: "somehost", Password: password, User: "u"}
+		back, err := Parse(p.ADOString())
+		if err != nil {
+			t.Fatalf("%q: %v", p.ADOString(), err)
+		}
+		if back.Password != password || back.User != "u" || back.Host != "somehost" {
+			t.Errorf("%q read back as password %q, user %q, host %q", p.ADOString(), back.Password, back.User, back.Host)
+		}
+	}
+	p, err = Parse(`server=somehost;password = "a;b" ;user id=u;database='it''s'`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Password != "a;b" || p.User != "u" || p.Database != "'it''s'" {
+		t.Errorf("got password %q, user %q, database %q", p.Password, p.User, p.Database)
+	}
+}
+
+func TestWorkloadGroup(t *testing.T) {
+	p, err := Parse("server=somehost;app name=orders;workload group=reporting")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := p.LoginAppName(); got != "orders [reporting]" {
+		t.Errorf("got application name %q", got)
+	}
+	if err = p.Validate(); err != nil {
+		t.Error(err)
+	}
+	if back, err := Parse(p.ADOString()); err != nil || back.WorkloadGroup != "reporting" {
+		t.Errorf("got %q, %v after a round trip", back.WorkloadGroup, err)
+	}
+
+	p.WorkloadGroup = "a]b"
+	if err = p.Validate(); err == nil {
+		t.Error("brackets in the workload group should fail")
+	}
+	p.WorkloadGroup = strings.Repeat("w", 120)
+	if err = p.Validate(); err == nil {
+		t.Error("a login application name over 128 characters should fail")
+	}
+	p.WorkloadGroup = ""
+	if got := p.LoginAppName(); got != "orders" {
+		t.Errorf("got application name %q without a workload group", got)
+	}
+}
+
+func TestLocalDBNeedsNamedPipes(t *testing.T) {
+	p := Config{}
+	if err := (tcpParser{Prefix: "tcp"}).ParseServer(`(LocalDB)\MSSQLLocalDB`, &p); err == nil {
+		t.Error("tcp accepted a LocalDB server")
+	}
+	if p.Host != "(LocalDB)" || p.Instance != "MSSQLLocalDB" {
+		t.Errorf("got host %q and instance %q", p.Host, p.Instance)
+	}
+	if _, err := Parse(`server=(localdb)\MSSQLLocalDB;protocol=tcp`); err == nil {
+		t.Error("a LocalDB server parsed with the tcp protocol")
+	}
+}
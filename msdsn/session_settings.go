@@ -0,0 +1,88 @@
+package msdsn
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Connection string parameters for session SET options.
+const (
+	ArithAbort           = "arithabort"
+	AnsiNulls            = "ansi_nulls"
+	AnsiPadding          = "ansi_padding"
+	AnsiWarnings         = "ansi_warnings"
+	ConcatNullYieldsNull = "concat_null_yields_null"
+	QuotedIdentifier     = "quoted_identifier"
+	XactAbort            = "xact_abort"
+	NoCount              = "nocount"
+	LockTimeout          = "lock_timeout"
+	DeadlockPriority     = "deadlock_priority"
+)
+
+// onOffSessionSettings lists the ON/OFF session options in the order
+// their SET statements are generated.
+var onOffSessionSettings = []string{
+	ArithAbort,
+	AnsiNulls,
+	AnsiPadding,
+	AnsiWarnings,
+	ConcatNullYieldsNull,
+	QuotedIdentifier,
+	XactAbort,
+	NoCount,
+}
+
+// parseSessionSettings returns the SET statements for the session
+// options found in params.
+func parseSessionSettings(params map[string]string) ([]string, error) {
+	var settings []string
+	for _, name := range onOffSessionSettings {
+		v, ok := params[name]
+		if !ok {
+			continue
+		}
+		on, err := parseOnOff(v)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s '%v': %v", name, v, err.Error())
+		}
+		state := "OFF"
+		if on {
+			state = "ON"
+		}
+		settings = append(settings, fmt.Sprintf("SET %s %s", strings.ToUpper(name), state))
+	}
+
+	if v, ok := params[LockTimeout]; ok {
+		ms, err := strconv.ParseInt(v, 10, 32)
+		if err != nil || ms < -1 {
+			return nil, fmt.Errorf("invalid lock_timeout '%v': expected milliseconds or -1", v)
+		}
+		settings = append(settings, fmt.Sprintf("SET LOCK_TIMEOUT %d", ms))
+	}
+
+	if v, ok := params[DeadlockPriority]; ok {
+		priority := strings.ToUpper(v)
+		switch priority {
+		case "LOW", "NORMAL", "HIGH":
+		default:
+			n, err := strconv.ParseInt(v, 10, 8)
+			if err != nil || n < -10 || n > 10 {
+				return nil, fmt.Errorf("invalid deadlock_priority '%v': expected low, normal, high or a number from -10 to 10", v)
+			}
+			priority = strconv.FormatInt(n, 10)
+		}
+		settings = append(settings, "SET DEADLOCK_PRIORITY "+priority)
+	}
+	return settings, nil
+}
+
+func parseOnOff(v string) (bool, error) {
+	switch strings.ToLower(v) {
+	case "on":
+		return true, nil
+	case "off":
+		return false, nil
+	}
+	return strconv.ParseBool(v)
+}
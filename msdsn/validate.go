@@ -0,0 +1,131 @@
+package msdsn
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// ConfigError reports a setting of a Config that is invalid or conflicts
+// with another one. Settings holds the connection string parameters
+// involved.
+type ConfigError struct {
+	Settings []string
+	Reason   string
+}
+
+func (e ConfigError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", strings.Join(e.Settings, " with "), e.Reason)
+}
+
+// Validate checks p for invalid and conflicting settings, such as TLS
+// options given while encryption is disabled, and returns a ConfigError
+// for the first one found. Parse does not call it, so the settings of a
+// connection string can be inspected before they are rejected; the
+// connectors of the driver return its error.
+func (p Config) Validate() error {
+	switch p.Encryption {
+	case EncryptionOff, EncryptionRequired, EncryptionDisabled, EncryptionStrict:
+	default:
+		return ConfigError{[]string{Encrypt}, fmt.Sprintf("unknown encryption mode %d", p.Encryption)}
+	}
+	if p.Encryption == EncryptionDisabled {
+		for _, name := range []string{TLSMin, Certificate, HostNameInCertificate} {
+			if p.Parameters[name] != "" {
+				return ConfigError{[]string{Encrypt, name}, "TLS options cannot be used when encryption is disabled"}
+			}
+		}
+		if p.TLSConfig != nil {
+			return ConfigError{[]string{Encrypt}, "a TLS configuration cannot be used when encryption is disabled"}
+		}
+	}
+	if v := p.Parameters[TLSMin]; v != "" && TLSVersionFromString(v) == 0 {
+		return ConfigError{[]string{TLSMin}, fmt.Sprintf("unknown TLS version %q", v)}
+	}
+	// with encrypt=strict the server certificate is always verified
+	if p.Parameters[Certificate] != "" && p.Encryption != EncryptionStrict {
+		if trust, _ := strconv.ParseBool(p.Parameters[TrustServerCertificate]); trust {
+			return ConfigError{[]string{TrustServerCertificate, Certificate}, "the certificate is not verified when the server certificate is trusted"}
+		}
+	}
+	if p.IPAddressFamily < AddressFamilyAny || p.IPAddressFamily > AddressFamilyPreferIPv6 {
+		return ConfigError{[]string{IPAddressFamily}, fmt.Sprintf("unknown address family %d", p.IPAddressFamily)}
+	}
+	if p.PacketSize != 0 && (p.PacketSize < 512 || p.PacketSize > 32767) {
+		return ConfigError{[]string{PacketSize}, fmt.Sprintf("%d is outside the range of 512 to 32767 bytes", p.PacketSize)}
+	}
+	if p.Port > 65535 {
+		return ConfigError{[]string{Port}, fmt.Sprintf("%d is not a TCP port", p.Port)}
+	}
+	if p.FailOverPort > 65535 {
+		return ConfigError{[]string{FailOverPort}, fmt.Sprintf("%d is not a TCP port", p.FailOverPort)}
+	}
+	if p.TCPUserTimeout > maxTCPUserTimeout {
+		return ConfigError{[]string{TCPUserTimeout}, fmt.Sprintf("%v is longer than %v", p.TCPUserTimeout, maxTCPUserTimeout)}
+	}
+	if strings.ContainsAny(p.WorkloadGroup, "[]") {
+		return ConfigError{[]string{WorkloadGroup}, "brackets are not allowed in the workload group"}
+	}
+	if n := utf8.RuneCountInString(p.LoginAppName()); n > maxAppNameLength {
+		return ConfigError{[]string{AppName, WorkloadGroup}, fmt.Sprintf("the application name sent at login has %d characters, more than %d", n, maxAppNameLength)}
+	}
+	if p.ReadOnlyIntent && p.Database == "" {
+		return ConfigError{[]string{ApplicationIntent, Database}, "database must be specified when ApplicationIntent is ReadOnly"}
+	}
+	if p.RetryReadOnly && !p.ReadOnlyIntent {
+		return ConfigError{[]string{RetryReadOnly, ApplicationIntent}, "statements are only retried when ApplicationIntent is ReadOnly"}
+	}
+	return nil
+}
+
+// maxTCPUserTimeout is the longest TCPUserTimeout, whose milliseconds the
+// system takes as a 32-bit integer.
+const maxTCPUserTimeout = math.MaxInt32 * time.Millisecond
+
+// maxAppNameLength is the size of the application name the server keeps,
+// returned by APP_NAME().
+const maxAppNameLength = 128
+
+// LoginAppName returns the application name sent at login, which
+// APP_NAME() and the program_name column of sys.dm_exec_sessions return.
+// It is AppName, followed by WorkloadGroup in brackets when it is set, as
+// in "orders [reporting]", so the classifier function of Resource
+// Governor can route the sessions to a workload group.
+func (p Config) LoginAppName() string {
+	if p.WorkloadGroup == "" {
+		return p.AppName
+	}
+	return p.AppName + " [" + p.WorkloadGroup + "]"
+}
+
+// Clone returns a copy of p that shares no maps, slices or TLS
+// configuration with it. The values of ProtocolParameters are copied as
+// they are.
+func (p Config) Clone() Config {
+	c := p
+	if p.TLSConfig != nil {
+		c.TLSConfig = p.TLSConfig.Clone()
+	}
+	if p.Parameters != nil {
+		c.Parameters = make(map[string]string, len(p.Parameters))
+		for k, v := range p.Parameters {
+			c.Parameters[k] = v
+		}
+	}
+	if p.ProtocolParameters != nil {
+		c.ProtocolParameters = make(map[string]interface{}, len(p.ProtocolParameters))
+		for k, v := range p.ProtocolParameters {
+			c.ProtocolParameters[k] = v
+		}
+	}
+	if p.Protocols != nil {
+		c.Protocols = append(make([]string, 0, len(p.Protocols)), p.Protocols...)
+	}
+	if p.SessionSettings != nil {
+		c.SessionSettings = append(make([]string, 0, len(p.SessionSettings)), p.SessionSettings...)
+	}
+	return c
+}
@@ -0,0 +1,190 @@
+package mssql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/golang-sql/sqlexp"
+)
+
+// MessageQueue receives the messages of a query run with a pointer to it
+// among its arguments, as a sqlexp.ReturnMessage does, and returns them as
+// the typed messages of this package. Besides the messages of sqlexp, it
+// receives the return status of procedures and the changes of the
+// session, such as of the database or the transaction.
+//
+//	var q mssql.MessageQueue
+//	rows, err := db.QueryContext(ctx, batch, &q)
+//	...
+//	err = q.Each(ctx, rows, func(m mssql.Message) error {
+//		switch m := m.(type) {
+//		case mssql.InfoMessage:
+//			log.Print(m.Info.Message)
+//		case mssql.NextMessage:
+//			for rows.Next() {
+//				...
+//			}
+//		}
+//		return nil
+//	})
+type MessageQueue struct {
+	q sqlexp.ReturnMessage
+}
+
+// Message is a message of a MessageQueue: ErrorMessage, InfoMessage,
+// RowCountMessage, ReturnStatusMessage, EnvChangeMessage, NextMessage or
+// NextResultSetMessage.
+type Message interface {
+	isMessage()
+}
+
+// ErrorMessage holds an error of the query.
+type ErrorMessage struct {
+	// Err is the error as the driver returns it.
+	Err error
+	// SQLError is the SQL Server error in Err. Its Number is zero when Err
+	// did not come from the server, such as an error reading the response.
+	SQLError Error
+}
+
+// InfoMessage holds an informational message, such as the output of PRINT
+// or of RAISERROR with a severity up to 10.
+type InfoMessage struct {
+	Info Error
+}
+
+// RowCountMessage holds the number of rows affected by a statement.
+type RowCountMessage struct {
+	Count int64
+}
+
+// ReturnStatusMessage holds the return status of a procedure.
+type ReturnStatusMessage struct {
+	Status ReturnStatus
+}
+
+// EnvChangeMessage reports a change of the session made by the query.
+// Name is "database", "language", "packet size" or "transaction", whose
+// values are the transaction descriptors in hexadecimal, empty outside of
+// a transaction.
+type EnvChangeMessage struct {
+	Name     string
+	OldValue string
+	NewValue string
+}
+
+// NextMessage tells that a result set is ready to be read with rows.Next.
+type NextMessage struct{}
+
+// NextResultSetMessage tells that the result set ended: call
+// rows.NextResultSet, and stop reading messages when it returns false.
+type NextResultSetMessage struct{}
+
+func (ErrorMessage) isMessage()         {}
+func (InfoMessage) isMessage()          {}
+func (RowCountMessage) isMessage()      {}
+func (ReturnStatusMessage) isMessage()  {}
+func (EnvChangeMessage) isMessage()     {}
+func (NextMessage) isMessage()          {}
+func (NextResultSetMessage) isMessage() {}
+
+// TypedMessage returns the Message of raw, a message of a
+// sqlexp.ReturnMessage passed to a query, or nil when raw is of a type
+// the driver does not send.
+func TypedMessage(raw sqlexp.RawMessage) Message {
+	switch m := raw.(type) {
+	case sqlexp.MsgError:
+		em := ErrorMessage{Err: m.Error}
+		errors.As(m.Error, &em.SQLError)
+		return em
+	case sqlexp.MsgNotice:
+		if info, ok := m.Message.(Error); ok {
+			return InfoMessage{Info: info}
+		}
+		return InfoMessage{Info: Error{Message: m.Message.String()}}
+	case sqlexp.MsgRowsAffected:
+		return RowCountMessage{Count: m.Count}
+	case sqlexp.MsgNext:
+		return NextMessage{}
+	case sqlexp.MsgNextResultSet:
+		return NextResultSetMessage{}
+	case Message:
+		return m
+	}
+	return nil
+}
+
+// Next returns the next message of the query. It returns a
+// NextResultSetMessage when ctx is done.
+func (q *MessageQueue) Next(ctx context.Context) Message {
+	return TypedMessage(q.q.Message(ctx))
+}
+
+// Each calls fn with the messages of rows, returned by the query run with
+// q, until the last result set. On each NextResultSetMessage, after fn, it
+// moves rows to the next result set, so fn only reads the rows of the
+// current one on NextMessage. The errors of the query are passed to fn as
+// ErrorMessage; the first error returned by fn stops Each and is returned,
+// as is the error of ctx when it is done.
+func (q *MessageQueue) Each(ctx context.Context, rows *sql.Rows, fn func(Message) error) error {
+	for {
+		m := q.Next(ctx)
+		if err := fn(m); err != nil {
+			return err
+		}
+		if _, ok := m.(NextResultSetMessage); ok {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			if !rows.NextResultSet() {
+				return nil
+			}
+		}
+	}
+}
+
+// sessionEnv holds the parts of a session an ENVCHANGE token reported in
+// an EnvChangeMessage can change.
+type sessionEnv struct {
+	database   string
+	language   string
+	packetSize int
+	tranid     uint64
+}
+
+func envOf(sess *tdsSession) sessionEnv {
+	return sessionEnv{
+		database:   sess.database,
+		language:   sess.language,
+		packetSize: sess.buf.packetSize,
+		tranid:     sess.tranid,
+	}
+}
+
+// changes returns the messages of the changes from e to now.
+func (e sessionEnv) changes(now sessionEnv) []EnvChangeMessage {
+	var msgs []EnvChangeMessage
+	if now.database != e.database {
+		msgs = append(msgs, EnvChangeMessage{Name: "database", OldValue: e.database, NewValue: now.database})
+	}
+	if now.language != e.language {
+		msgs = append(msgs, EnvChangeMessage{Name: "language", OldValue: e.language, NewValue: now.language})
+	}
+	if now.packetSize != e.packetSize {
+		msgs = append(msgs, EnvChangeMessage{Name: "packet size", OldValue: strconv.Itoa(e.packetSize), NewValue: strconv.Itoa(now.packetSize)})
+	}
+	if now.tranid != e.tranid {
+		msgs = append(msgs, EnvChangeMessage{Name: "transaction", OldValue: tranName(e.tranid), NewValue: tranName(now.tranid)})
+	}
+	return msgs
+}
+
+func tranName(tranid uint64) string {
+	if tranid == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%016x", tranid)
+}
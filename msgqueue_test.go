@@ -0,0 +1,111 @@
+package mssql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/golang-sql/sqlexp"
+)
+
+func TestTypedMessage(t *testing.T) {
+	sqlErr := Error{Number: 50000, Message: "failed"}
+	readErr := errors.New("read failed")
+	tests := []struct {
+		raw  sqlexp.RawMessage
+		want Message
+	}{
+		{sqlexp.MsgError{Error: sqlErr}, ErrorMessage{Err: sqlErr, SQLError: sqlErr}},
+		{sqlexp.MsgError{Error: readErr}, ErrorMessage{Err: readErr}},
+		{sqlexp.MsgNotice{Message: Error{Number: 0, Message: "msg"}}, InfoMessage{Info: Error{Message: "msg"}}},
+		{sqlexp.MsgRowsAffected{Count: 3}, RowCountMessage{Count: 3}},
+		{sqlexp.MsgNext{}, NextMessage{}},
+		{sqlexp.MsgNextResultSet{}, NextResultSetMessage{}},
+		{ReturnStatusMessage{Status: 7}, ReturnStatusMessage{Status: 7}},
+		{sqlexp.MsgLastInsertID{Value: 1}, nil},
+	}
+	for _, tst := range tests {
+		if got := TypedMessage(tst.raw); !reflect.DeepEqual(got, tst.want) {
+			t.Errorf("TypedMessage(%#v) = %#v, want %#v", tst.raw, got, tst.want)
+		}
+	}
+}
+
+func TestSessionEnvChanges(t *testing.T) {
+	before := sessionEnv{database: "master", language: "us_english", packetSize: 4096}
+	now := sessionEnv{database: "sales", language: "us_english", packetSize: 8000, tranid: 0x1f}
+	want := []EnvChangeMessage{
+		{Name: "database", OldValue: "master", NewValue: "sales"},
+		{Name: "packet size", OldValue: "4096", NewValue: "8000"},
+		{Name: "transaction", OldValue: "", NewValue: "000000000000001f"},
+	}
+	if got := before.changes(now); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if got := now.changes(now); len(got) != 0 {
+		t.Errorf("got %v without changes", got)
+	}
+}
+
+func TestMessageQueueTyped(t *testing.T) {
+	db, logger := open(t)
+	defer db.Close()
+	defer logger.StopLogging()
+	ctx := context.Background()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err = conn.ExecContext(ctx, "CREATE PROC #five AS RETURN 5"); err != nil {
+		t.Fatal(err)
+	}
+
+	var q MessageQueue
+	rows, err := conn.QueryContext(ctx, "use master; use tempdb; print 'msg'; select 1 as a; exec #five", &q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var got []string
+	err = q.Each(ctx, rows, func(m Message) error {
+		switch m := m.(type) {
+		case EnvChangeMessage:
+			// One of the USE statements changes the database.
+			if m.Name == "database" && m.NewValue == "tempdb" {
+				got = append(got, "env database")
+			}
+		case InfoMessage:
+			if m.Info.Message == "msg" {
+				got = append(got, "info")
+			}
+		case NextMessage:
+			for rows.Next() {
+				got = append(got, "row")
+			}
+		case ReturnStatusMessage:
+			got = append(got, fmt.Sprintf("status %d", m.Status))
+		case ErrorMessage:
+			return m.Err
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"env database", "info", "row", "status 5"}
+	var filtered []string
+	for _, g := range got {
+		for _, w := range want {
+			if g == w {
+				filtered = append(filtered, g)
+			}
+		}
+	}
+	if !reflect.DeepEqual(filtered, want) {
+		t.Errorf("got messages %v, want %v in order", got, want)
+	}
+}
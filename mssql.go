@@ -12,12 +12,14 @@ import (
 	"math/bits"
 	"net"
 	"reflect"
+	"sort"
 	"strings"
 	"time"
 	"unicode"
 
 	"github.com/golang-sql/sqlexp"
 	"github.com/microsoft/go-mssqldb/aecmk"
+	"github.com/microsoft/go-mssqldb/internal/cp"
 	"github.com/microsoft/go-mssqldb/internal/querytext"
 	"github.com/microsoft/go-mssqldb/msdsn"
 )
@@ -41,7 +43,7 @@ func init() {
 		if ka == 0 {
 			ka = 30 * time.Second
 		}
-		return netDialer{&net.Dialer{KeepAlive: ka}}
+		return netDialer{nd: &net.Dialer{KeepAlive: ka}, p: p}
 	}
 	msdsn.ProtocolDialers["tcp"] = *tcpDialerInstance
 	msdsn.ProtocolDialers["admin"] = *tcpDialerInstance
@@ -51,10 +53,21 @@ var createDialer func(p *msdsn.Config) Dialer
 
 type netDialer struct {
 	nd *net.Dialer
+	p  *msdsn.Config
 }
 
 func (d netDialer) DialContext(ctx context.Context, network string, addr string) (net.Conn, error) {
-	return d.nd.DialContext(ctx, network, addr)
+	conn, err := d.nd.DialContext(ctx, network, addr)
+	if err != nil || d.p == nil {
+		return conn, err
+	}
+	// The options are set once the connection is made, since the dialer
+	// sets the keepalive interval to the idle time itself.
+	if err = setTCPOptions(conn, d.p); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
 }
 
 type Driver struct {
@@ -69,6 +82,9 @@ func (d *Driver) OpenConnector(dsn string) (*Connector, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err = params.Validate(); err != nil {
+		return nil, err
+	}
 
 	return newConnector(params, d), nil
 }
@@ -120,6 +136,9 @@ func NewConnector(dsn string) (*Connector, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err = params.Validate(); err != nil {
+		return nil, err
+	}
 	c := newConnector(params, driverInstanceNoProcess)
 
 	return c, nil
@@ -141,8 +160,13 @@ func NewConnectorWithAccessTokenProvider(dsn string, tokenProvider func(ctx cont
 
 // NewConnectorConfig creates a new Connector for a DSN Config struct.
 // The returned connector may be used with sql.OpenDB.
+// The connector keeps a copy of config, so later changes to its maps and
+// TLS configuration do not affect it. When config.Validate fails, every
+// Connect returns the msdsn.ConfigError.
 func NewConnectorConfig(config msdsn.Config) *Connector {
-	return newConnector(config, driverInstanceNoProcess)
+	c := newConnector(config.Clone(), driverInstanceNoProcess)
+	c.configErr = config.Validate()
+	return c
 }
 
 func newConnector(config msdsn.Config, driver *Driver) *Connector {
@@ -150,6 +174,8 @@ func newConnector(config msdsn.Config, driver *Driver) *Connector {
 		params:       config,
 		driver:       driver,
 		keyProviders: make(aecmk.ColumnEncryptionKeyProviderMap),
+		conns:        newConnRegistry(),
+		failover:     &failoverPartner{},
 	}
 }
 
@@ -169,6 +195,11 @@ type Connector struct {
 	// callback that can provide a security token during login
 	securityTokenProvider func(ctx context.Context) (string, error)
 
+	// callback that can provide a security token for the server and
+	// database of the login, used instead of securityTokenProvider when set
+	accessTokenProvider AccessTokenProvider
+	accessTokenState    *accessTokenState
+
 	// callback that can provide a security token during ADAL login
 	adalTokenProvider func(ctx context.Context, serverSPN, stsURL string) (string, error)
 
@@ -193,15 +224,99 @@ type Connector struct {
 	//
 	// SessionInitSQL is optional. The session will be reset even if
 	// SessionInitSQL is empty.
+	//
+	// Session options from the connection string, such as arithabort or
+	// lock_timeout, are run in the same batch before SessionInitSQL.
 	SessionInitSQL string
 
+	// DisableSessionReset keeps the session of a pooled connection as the
+	// previous user left it: no sp_reset_connection is requested when the
+	// connection is reused, so temporary tables, SET options and the
+	// current database carry over. SessionInitSQL and SessionResetHook
+	// still run.
+	DisableSessionReset bool
+
+	// SessionResetHook, when set, is called each time a connection is
+	// handed out by the pool, including new connections, after
+	// SessionInitSQL and InitialSessionContext. Statements it runs on conn, through
+	// conn.PrepareContext, run in the reset session, so it can reapply SET
+	// options or create temporary tables. An error discards the
+	// connection.
+	SessionResetHook func(ctx context.Context, conn *Conn) error
+
+	// InitialSessionContext holds the keys and values set with
+	// sp_set_session_context after login and each time the session is
+	// reset, after SessionInitSQL, so row-level security predicates reading
+	// SESSION_CONTEXT, such as a tenant ID, hold on every pooled connection.
+	InitialSessionContext map[string]string
+
+	// ParameterSizeBuckets, when set, are the lengths, in ascending order,
+	// the varchar, nvarchar and varbinary parameters of statements are
+	// declared with: a value is declared with the first length that holds
+	// it, and as max beyond the last one, such as nvarchar(100),
+	// nvarchar(500), nvarchar(4000) and nvarchar(max) for 100, 500 and
+	// 4000. The lengths are in characters for varchar and nvarchar and in
+	// bytes for varbinary. Fewer distinct declarations mean fewer plans
+	// cached by the server for the same statement.
+	//
+	// It takes precedence over the "parametersizebuckets" of the connection
+	// string, and WithParameterSizeBuckets over both for a statement.
+	ParameterSizeBuckets []int
+
+	// Interceptors are called around the statements run through
+	// database/sql on the connections, in order before a statement and in
+	// the reverse order after it. See Interceptor.
+	Interceptors []Interceptor
+
+	// FailExecWithRows, when set, makes Exec fail with an ExecRowsError
+	// when its statement returned rows, such as those of an OUTPUT clause,
+	// which Exec discards.
+	FailExecWithRows bool
+
+	// DrainPendingResults, when set, closes the rows of a query that were
+	// not closed, discarding their remaining rows, before the next request
+	// on the connection, instead of failing that request with a
+	// ResultsPendingError.
+	DrainPendingResults bool
+
+	// FailOnRawTransactions, when set, makes Exec fail with an error
+	// matching ErrRawTransaction when its statement began a transaction
+	// outside of a database/sql transaction, such as with BEGIN
+	// TRANSACTION or SET IMPLICIT_TRANSACTIONS ON, which is then rolled
+	// back rather than left open on the connection for the next user of
+	// the pool, or when it committed or rolled back the transaction of
+	// BeginTx. A BEGIN TRANSACTION nested in a transaction goes
+	// unnoticed; see TransactionCount.
+	FailOnRawTransactions bool
+
 	// Dialer sets a custom dialer for all network operations, except DNS resolution unless
 	// the dialer implements the HostDialer.
 	//
 	// If Dialer is not set, normal net dialers are used.
 	Dialer Dialer
 
+	// Resolver, when set, looks up the addresses of the server, and of
+	// the host queried for the port of a named instance, instead of DNS.
+	// The host name of the connection string is still the one the TLS
+	// certificate is checked against and the SPN is made of, so the
+	// logical name of a server reached through a private endpoint or a
+	// split-horizon DNS can be dialed at another address. See
+	// StaticResolver for a fixed mapping. A Dialer implementing
+	// HostDialer resolves names itself and bypasses Resolver.
+	Resolver func(ctx context.Context, host string) ([]net.IP, error)
+
 	keyProviders aecmk.ColumnEncryptionKeyProviderMap
+
+	// configErr is the error of validating the config of
+	// NewConnectorConfig, returned by Connect.
+	configErr error
+
+	// conns are the open connections made by Connect, see Shutdown.
+	conns *connRegistry
+
+	// failover is the failover partner reported by the server, see
+	// FailoverPartner.
+	failover *failoverPartner
 }
 
 type Dialer interface {
@@ -222,6 +337,92 @@ func (c *Connector) getDialer(p *msdsn.Config) Dialer {
 	return createDialer(p)
 }
 
+// StaticResolver returns a Connector.Resolver that maps the host names of
+// hosts, compared case-insensitively, to their addresses and looks up the
+// other names with DNS.
+func StaticResolver(hosts map[string][]net.IP) func(ctx context.Context, host string) ([]net.IP, error) {
+	static := make(map[string][]net.IP, len(hosts))
+	for name, ips := range hosts {
+		static[strings.ToLower(name)] = ips
+	}
+	return func(ctx context.Context, host string) ([]net.IP, error) {
+		if ips, ok := static[strings.ToLower(host)]; ok {
+			return ips, nil
+		}
+		return lookupIP(ctx, host)
+	}
+}
+
+// lookupIP looks up the addresses of host with DNS.
+func lookupIP(ctx context.Context, host string) ([]net.IP, error) {
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	ips := make([]net.IP, len(addrs))
+	for i, addr := range addrs {
+		ips[i] = addr.IP
+	}
+	return ips, nil
+}
+
+// resolve returns the addresses of host, from Resolver when it is set.
+func (c *Connector) resolve(ctx context.Context, host string) ([]net.IP, error) {
+	if c != nil && c.Resolver != nil {
+		ips, err := c.Resolver(ctx, host)
+		if err == nil && len(ips) == 0 {
+			err = fmt.Errorf("no address found for host %s", host)
+		}
+		return ips, err
+	}
+	return net.LookupIP(host)
+}
+
+// browserHost returns the address the SQL Server Browser of host is
+// queried at: its first address from Resolver when it is set, and host
+// itself otherwise.
+func (c *Connector) browserHost(ctx context.Context, host string) string {
+	if c == nil || c.Resolver == nil || net.ParseIP(host) != nil {
+		return host
+	}
+	if ips, err := c.resolve(ctx, host); err == nil {
+		return ips[0].String()
+	}
+	return host
+}
+
+// sessionInitSQL returns the batch run when a session is reset: the SET
+// statements from the connection string followed by SessionInitSQL.
+func (c *Connector) sessionInitSQL() string {
+	if len(c.params.SessionSettings) == 0 {
+		return c.SessionInitSQL
+	}
+	initSQL := strings.Join(c.params.SessionSettings, ";\n") + ";"
+	if len(c.SessionInitSQL) > 0 {
+		initSQL += "\n" + c.SessionInitSQL
+	}
+	return initSQL
+}
+
+// sessionContextBatch returns the batch setting InitialSessionContext and
+// its parameters. The keys are set in sorted order.
+func (c *Connector) sessionContextBatch() (string, []namedValue) {
+	keys := make([]string, 0, len(c.InitialSessionContext))
+	for k := range c.InitialSessionContext {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	args := make([]namedValue, 0, 2*len(keys))
+	for i, k := range keys {
+		fmt.Fprintf(&b, "EXEC sp_set_session_context @p%d, @p%d;\n", 2*i+1, 2*i+2)
+		args = append(args,
+			namedValue{Ordinal: 2*i + 1, Value: k},
+			namedValue{Ordinal: 2*i + 2, Value: c.InitialSessionContext[k]})
+	}
+	return b.String(), args
+}
+
 // RegisterCekProvider associates the given provider with the named key store. If an entry of the given name already exists, that entry is overwritten
 func (c *Connector) RegisterCekProvider(name string, provider aecmk.ColumnEncryptionKeyProvider) {
 	c.keyProviders[name] = aecmk.NewCekProvider(provider)
@@ -237,19 +438,130 @@ type Conn struct {
 	connectionGood   bool
 
 	outs outputs
+
+	// pending is the query whose rows are still open, if any.
+	pending *pendingResults
+	// inTx is set while a transaction begun with BeginTx is open.
+	inTx bool
 }
 
 type outputs struct {
 	params       map[string]interface{}
 	returnStatus *ReturnStatus
 	msgq         *sqlexp.ReturnMessage
+	// typedMsgs is set when msgq is that of a MessageQueue, which also
+	// receives return statuses and session changes.
+	typedMsgs bool
+	// raw also passes informational messages and return values on the
+	// token channel, for the TokenStream of a RawConn.
+	raw bool
+	// arena holds the values of the rows when WithRawBytes is set.
+	arena *rowArena
+	// readAhead is the number of tokens the reader of the response can
+	// read ahead of the rows, set by WithReadAhead.
+	readAhead int
+	// timezone is the time zone of the date and time columns, see
+	// WithTimezone.
+	timezone *time.Location
+	// stats collects the statistics of WithExecutionStats.
+	stats *ExecutionStats
 }
 
 // IsValid satisfies the driver.Validator interface.
+// database/sql calls it when the connection is returned to the pool.
 func (c *Conn) IsValid() bool {
+	if c.connector != nil && c.connector.conns != nil && !c.connector.conns.setInUse(c, false) {
+		return false
+	}
 	return c.connectionGood
 }
 
+// LoginMessages returns the informational messages the server sent while
+// the connection was logging in, such as database and language context
+// changes, redirect notices or deprecation warnings.
+// Use sql.Conn.Raw to reach the underlying *mssql.Conn.
+func (c *Conn) LoginMessages() []Error {
+	if c.sess == nil || len(c.sess.loginMessages) == 0 {
+		return nil
+	}
+	msgs := make([]Error, len(c.sess.loginMessages))
+	copy(msgs, c.sess.loginMessages)
+	return msgs
+}
+
+// Features returns the optional protocol features the server acknowledged
+// when the connection logged in.
+// Use sql.Conn.Raw to reach the underlying *mssql.Conn.
+func (c *Conn) Features() FeatureSet {
+	if c.sess == nil {
+		return 0
+	}
+	return c.sess.features
+}
+
+// ConnectionInfo returns what the connection negotiated with the server
+// while logging in, such as the TDS version and the encryption in effect,
+// so health checks can verify it. Reach it with sql.Conn.Raw and an
+// interface assertion:
+//
+//	err := conn.Raw(func(dc interface{}) error {
+//		if c, ok := dc.(interface{ ConnectionInfo() mssql.ConnectionInfo }); ok {
+//			info = c.ConnectionInfo()
+//		}
+//		return nil
+//	})
+func (c *Conn) ConnectionInfo() ConnectionInfo {
+	if c.sess == nil {
+		return ConnectionInfo{}
+	}
+	return c.sess.info
+}
+
+// PacketSize returns the size of the TDS packets of the connection. It is
+// the packet size requested in the connection string unless the server
+// changed it during login, for example to 16383 bytes for encrypted
+// connections.
+// Use sql.Conn.Raw to reach the underlying *mssql.Conn.
+func (c *Conn) PacketSize() int {
+	if c.sess == nil || c.sess.buf == nil {
+		return 0
+	}
+	return c.sess.buf.PackageSize()
+}
+
+// Database returns the current database of the connection, as last
+// reported by the server when the connection logged in or ran a USE
+// statement. Pooled connections keep the database they were left in until
+// their session is reset.
+// Use sql.Conn.Raw to reach the underlying *mssql.Conn.
+func (c *Conn) Database() string {
+	if c.sess == nil {
+		return ""
+	}
+	return c.sess.database
+}
+
+// Language returns the current language of the connection, as last
+// reported by the server, for example after SET LANGUAGE.
+// Use sql.Conn.Raw to reach the underlying *mssql.Conn.
+func (c *Conn) Language() string {
+	if c.sess == nil {
+		return ""
+	}
+	return c.sess.language
+}
+
+// Collation returns the default collation of the current database of the
+// connection, as last reported by the server. ok is false when the server
+// did not report one.
+// Use sql.Conn.Raw to reach the underlying *mssql.Conn.
+func (c *Conn) Collation() (collation Collation, ok bool) {
+	if c.sess == nil || c.sess.collation == (cp.Collation{}) {
+		return Collation{}, false
+	}
+	return newCollation(c.sess.collation), true
+}
+
 // checkBadConn marks the connection as bad based on the characteristics
 // of the supplied error. Bad connections will be dropped from the connection
 // pool rather than reused.
@@ -310,6 +622,10 @@ func (c *Conn) Commit() error {
 	if !c.connectionGood {
 		return driver.ErrBadConn
 	}
+	if err := c.checkPending("commit"); err != nil {
+		return err
+	}
+	c.inTx = false
 	if err := c.sendCommitRequest(); err != nil {
 		return c.checkBadConn(c.transactionCtx, err, true)
 	}
@@ -337,6 +653,10 @@ func (c *Conn) Rollback() error {
 	if !c.connectionGood {
 		return driver.ErrBadConn
 	}
+	if err := c.checkPending("rollback"); err != nil {
+		return err
+	}
+	c.inTx = false
 	if err := c.sendRollbackRequest(); err != nil {
 		return c.checkBadConn(c.transactionCtx, err, true)
 	}
@@ -368,6 +688,9 @@ func (c *Conn) begin(ctx context.Context, tdsIsolation isoLevel) (tx driver.Tx,
 	if !c.connectionGood {
 		return nil, driver.ErrBadConn
 	}
+	if err = c.checkPending("begin transaction"); err != nil {
+		return nil, err
+	}
 	err = c.sendBeginRequest(ctx, tdsIsolation)
 	if err != nil {
 		return nil, c.checkBadConn(ctx, err, true)
@@ -376,6 +699,7 @@ func (c *Conn) begin(ctx context.Context, tdsIsolation isoLevel) (tx driver.Tx,
 	if err != nil {
 		return nil, err
 	}
+	c.inTx = true
 	return
 }
 
@@ -411,25 +735,24 @@ func (d *Driver) open(ctx context.Context, dsn string) (*Conn, error) {
 	if err != nil {
 		return nil, err
 	}
+	if err = params.Validate(); err != nil {
+		return nil, err
+	}
 	c := newConnector(params, nil)
 	return d.connect(ctx, c, params)
 }
 
 // connect to the server, using the provided context for dialing only.
 func (d *Driver) connect(ctx context.Context, c *Connector, params msdsn.Config) (*Conn, error) {
-	sess, err := connect(ctx, c, d.logger, params)
+	sess, err := d.connectResuming(ctx, c, params)
 	if err != nil {
 		// main server failed, try fail-over partner
-		if params.FailOverPartner == "" {
+		partner := c.FailoverPartner()
+		if partner == "" {
 			return nil, err
 		}
 
-		params.Host = params.FailOverPartner
-		if params.FailOverPort != 0 {
-			params.Port = params.FailOverPort
-		}
-
-		sess, err = connect(ctx, c, d.logger, params)
+		sess, err = d.connectResuming(ctx, c, partnerParams(params, partner))
 		if err != nil {
 			// fail-over partner also failed, now fail
 			return nil, err
@@ -448,16 +771,40 @@ func (d *Driver) connect(ctx context.Context, c *Connector, params msdsn.Config)
 }
 
 func (c *Conn) Close() error {
+	if c.connector != nil && c.connector.conns != nil {
+		c.connector.conns.remove(c)
+	}
 	c.sess.buf.bufClose()
 	return c.sess.buf.transport.Close()
 }
 
+// closeTransport closes the network connection of c for Shutdown, while
+// database/sql may still hold c: its buffers are released by Close.
+func (c *Conn) closeTransport() {
+	_ = c.sess.buf.transport.Close()
+}
+
 type Stmt struct {
 	c              *Conn
 	query          string
 	paramCount     int
 	notifSub       *queryNotifSub
 	skipEncryption bool
+	// paramTypes maps parameter names to the types reported by
+	// sp_describe_undeclared_parameters when DescribeParameters is set.
+	paramTypes map[string]string
+	// declTypes holds the types the parameters were declared with by the
+	// previous runs of the statement, see stableDeclType.
+	declTypes map[string]typeInfo
+	// outputRows, when set, receives the rows returned to an Exec of the
+	// statement, which are otherwise discarded.
+	outputRows func(cols []columnStruct, row []interface{})
+	// timezone is the time zone the time.Time parameters are converted
+	// to, see WithTimezone.
+	timezone *time.Location
+	// completed is set when a statement of the last failed request
+	// completed before the error, see tokenProcessor.completed.
+	completed bool
 }
 
 type queryNotifSub struct {
@@ -481,7 +828,7 @@ func (c *Conn) prepareContext(ctx context.Context, query string) (*Stmt, error)
 	if c.processQueryText {
 		query, paramCount = querytext.ParseParams(query)
 	}
-	return &Stmt{c, query, paramCount, nil, false}, nil
+	return &Stmt{c: c, query: query, paramCount: paramCount}, nil
 }
 
 func (s *Stmt) Close() error {
@@ -522,6 +869,12 @@ func (s *Stmt) sendQuery(ctx context.Context, args []namedValue) (err error) {
 	}
 
 	conn := s.c
+	if err = conn.checkPending(s.query); err != nil {
+		return err
+	}
+	if hdr, ok := conn.sess.traceActivityHeader(ctx); ok {
+		headers = append(headers, hdr)
+	}
 
 	// no need to check number of parameters here, it is checked by database/sql
 	if conn.sess.logFlags&logSQL != 0 {
@@ -537,14 +890,39 @@ func (s *Stmt) sendQuery(ctx context.Context, args []namedValue) (err error) {
 		}
 	}
 
+	// SET options from the context are run inside sp_executesql so the
+	// server restores the previous values when the statement completes.
+	opts := queryOptionsFromContext(ctx)
+	s.timezone = conn.timezone(opts)
+	setOptions, err := opts.setStatements()
+	if err != nil {
+		return err
+	}
+	optionClause, err := opts.optionClause()
+	if err != nil {
+		return err
+	}
+	isProc := isProc(s.query)
+	if (setOptions != "" || optionClause != "") && isProc {
+		return errors.New("mssql: statement options, such as the isolation level, lock timeout, database, request ID, query hints, execution statistics or context info, cannot be applied to a stored procedure call")
+	}
+
+	// Large batches and RPCs, such as those with table-valued parameters,
+	// take many packets; the send stops between two of them when ctx is
+	// done.
+	conn.sess.buf.sendCtx = ctx
+	defer func() { conn.sess.buf.sendCtx = nil }()
+
 	reset := conn.resetSession
 	conn.resetSession = false
-	isProc := isProc(s.query)
-	if len(args) == 0 && !isProc {
+	if len(args) == 0 && !isProc && setOptions == "" && optionClause == "" {
 		if err = sendSqlBatch72(conn.sess.buf, s.query, headers, reset); err != nil {
 			if conn.sess.logFlags&logErrors != 0 {
 				conn.sess.logger.Log(ctx, msdsn.LogErrors, fmt.Sprintf("Failed to send SqlBatch with %v", err))
 			}
+			if ctxErr := conn.cancelSend(ctx, err, reset); ctxErr != nil {
+				return ctxErr
+			}
 			conn.connectionGood = false
 			return fmt.Errorf("failed to send SQL Batch: %v", err)
 		}
@@ -553,23 +931,26 @@ func (s *Stmt) sendQuery(ctx context.Context, args []namedValue) (err error) {
 		var params []param
 		if isProc {
 			proc.name = s.query
-			params, _, err = s.makeRPCParams(args, true)
+			params, _, err = s.makeRPCParams(args, true, nil)
 			if err != nil {
 				return
 			}
 		} else {
 			var decls []string
-			params, decls, err = s.makeRPCParams(args, false)
+			params, decls, err = s.makeRPCParams(args, false, conn.parameterSizeBuckets(opts))
 			if err != nil {
 				return
 			}
-			params[0] = makeStrParam(s.query)
+			params[0] = makeStrParam(setOptions + withOptionClause(s.query, optionClause))
 			params[1] = makeStrParam(strings.Join(decls, ","))
 		}
 		if err = sendRpc(conn.sess.buf, headers, proc, 0, params, reset); err != nil {
 			if conn.sess.logFlags&logErrors != 0 {
 				conn.sess.logger.Log(ctx, msdsn.LogErrors, fmt.Sprintf("Failed to send Rpc with %v", err))
 			}
+			if ctxErr := conn.cancelSend(ctx, err, reset); ctxErr != nil {
+				return ctxErr
+			}
 			conn.connectionGood = false
 			return fmt.Errorf("failed to send RPC: %v", err)
 		}
@@ -577,6 +958,27 @@ func (s *Stmt) sendQuery(ctx context.Context, args []namedValue) (err error) {
 	return
 }
 
+// cancelSend recovers the connection after the send of a request failed
+// with err. When the send was canceled by its context, the server ignores
+// the partial request; the attention that follows it is confirmed, and the
+// context error is returned with the connection still usable. The session
+// reset the request carried is requested again on the next one. It returns
+// nil when the connection cannot be recovered.
+func (c *Conn) cancelSend(ctx context.Context, err error, reset bool) error {
+	var canceled sendCanceledError
+	if !errors.As(err, &canceled) {
+		return nil
+	}
+	if err := confirmAttention(ctx, c.sess); err != nil {
+		if c.sess.logFlags&logErrors != 0 {
+			c.sess.logger.Log(ctx, msdsn.LogErrors, fmt.Sprintf("Failed to cancel the request with %v", err))
+		}
+		return nil
+	}
+	c.resetSession = c.resetSession || reset
+	return canceled.err
+}
+
 // isProc takes the query text in s and determines if it is a stored proc name
 // or SQL text.
 func isProc(s string) bool {
@@ -638,7 +1040,10 @@ func isProc(s string) bool {
 	return true
 }
 
-func (s *Stmt) makeRPCParams(args []namedValue, isProc bool) ([]param, []string, error) {
+// makeRPCParams returns the parameters of the RPC running the statement
+// with args and, unless isProc, their declarations, with the lengths of
+// buckets, see stableDeclType.
+func (s *Stmt) makeRPCParams(args []namedValue, isProc bool, buckets []int) ([]param, []string, error) {
 	var err error
 	var offset int
 	if !isProc {
@@ -681,7 +1086,14 @@ func (s *Stmt) makeRPCParams(args []namedValue, isProc bool) ([]param, []string,
 			params[i+offset].ti.Size = 0
 		}
 
-		decls[i] = fmt.Sprintf("%s %s%s", name, makeDecl(tiDecl), output)
+		if !isProc && s.c != nil && !s.doEncryption() {
+			tiDecl = s.stableDeclType(name, tiDecl, len(params[i+offset].buffer), buckets)
+		}
+		decl := makeDecl(tiDecl)
+		if typ, ok := s.paramTypes[name]; ok && output == "" && val.encrypt == nil {
+			decl = typ
+		}
+		decls[i] = fmt.Sprintf("%s %s%s", name, decl, output)
 
 	}
 	return params, decls, nil
@@ -722,6 +1134,7 @@ func (s *Stmt) queryContext(ctx context.Context, args []namedValue) (rows driver
 	if !s.c.connectionGood {
 		return nil, driver.ErrBadConn
 	}
+	s.completed = false
 	if s.doEncryption() && len(args) > 0 {
 		args, err = s.encryptArgs(ctx, args)
 	}
@@ -736,12 +1149,24 @@ func (s *Stmt) queryContext(ctx context.Context, args []namedValue) (rows driver
 
 func (s *Stmt) processQueryResponse(ctx context.Context) (res driver.Rows, err error) {
 	ctx, cancel := context.WithCancel(ctx)
-	reader := startReading(s.c.sess, ctx, s.c.outs)
+	outs := s.c.outs
+	opts := queryOptionsFromContext(ctx)
+	outs.readAhead = opts.readAhead
+	outs.timezone = s.c.timezone(opts)
+	outs.stats = opts.stats
+	if outs.stats != nil {
+		*outs.stats = ExecutionStats{}
+	}
+	if outs.msgq == nil && opts.rawBytes {
+		outs.arena = newRowArena(outs.readAheadSize())
+	}
+	reader := startReading(s.c.sess, ctx, outs)
 	s.c.clearOuts()
 	// For apps using a message queue, return right away and let Rowsq do all the work
 	if reader.outs.msgq != nil {
-		res = &Rowsq{stmt: s, reader: reader, cols: nil, cancel: cancel}
-		return res, nil
+		rq := &Rowsq{stmt: s, reader: reader, cols: nil, cancel: cancel}
+		s.c.setPending(s.query, reader, rq.Close)
+		return rq, nil
 	}
 	// process metadata
 	var cols []columnStruct
@@ -763,12 +1188,17 @@ loop:
 				case []columnStruct:
 					cols = token
 					break loop
+				case doneInProcStruct:
+					reader.noteDone(token.Status)
 				case doneStruct:
 					if token.isError() {
 						// need to cleanup cancellable context
 						cancel()
-						return nil, s.c.checkBadConn(ctx, token.getError(), false)
+						s.completed = reader.completed
+						err = token.getError()
+						return nil, s.c.checkBadConn(ctx, err, s.retryReadOnly(err))
 					}
+					reader.noteDone(token.Status)
 				case ReturnStatus:
 					if reader.outs.returnStatus != nil {
 						*reader.outs.returnStatus = token
@@ -778,11 +1208,13 @@ loop:
 		} else {
 			// need to cleanup cancellable context
 			cancel()
-			return nil, s.c.checkBadConn(ctx, err, false)
+			s.completed = reader.completed
+			return nil, s.c.checkBadConn(ctx, err, s.retryReadOnly(err))
 		}
 	}
-	res = &Rows{stmt: s, reader: reader, cols: cols, cancel: cancel}
-	return
+	rows := &Rows{stmt: s, reader: reader, cols: cols, cancel: cancel}
+	s.c.setPending(s.query, reader, rows.Close)
+	return rows, nil
 }
 
 func (s *Stmt) Exec(args []driver.Value) (driver.Result, error) {
@@ -795,6 +1227,7 @@ func (s *Stmt) exec(ctx context.Context, args []namedValue) (res driver.Result,
 	if !s.c.connectionGood {
 		return nil, driver.ErrBadConn
 	}
+	s.completed = false
 	if s.doEncryption() && len(args) > 0 {
 		args, err = s.encryptArgs(ctx, args)
 	}
@@ -811,13 +1244,26 @@ func (s *Stmt) exec(ctx context.Context, args []namedValue) (res driver.Result,
 }
 
 func (s *Stmt) processExec(ctx context.Context) (res driver.Result, err error) {
-	reader := startReading(s.c.sess, ctx, s.c.outs)
+	outs := s.c.outs
+	outs.stats = queryOptionsFromContext(ctx).stats
+	if outs.stats != nil {
+		*outs.stats = ExecutionStats{}
+	}
+	reader := startReading(s.c.sess, ctx, outs)
 	s.c.clearOuts()
+	reader.onRow = s.outputRows
 	err = reader.iterateResponse()
 	if err != nil {
+		s.completed = reader.completed
 		return nil, s.c.checkBadConn(ctx, err, false)
 	}
-	return &Result{s.c, reader.rowCount}, nil
+	if reader.rowsReturned > 0 && s.outputRows == nil && s.c.connector != nil && s.c.connector.FailExecWithRows {
+		return nil, ExecRowsError{Query: s.query, Rows: reader.rowsReturned, RowsAffected: reader.rowCount}
+	}
+	if err = s.c.checkRawTransaction(s.query); err != nil {
+		return nil, err
+	}
+	return &Result{c: s.c, rowsAffected: reader.rowCount, stats: outs.stats}, nil
 }
 
 // Rows represents the non-experimental data/sql model for Query and QueryContext
@@ -827,12 +1273,18 @@ type Rows struct {
 	reader   *tokenProcessor
 	nextCols []columnStruct
 	cancel   func()
+
+	// done is the first DONE token read after the rows of the current
+	// result set, when doneRead is set.
+	done     doneStruct
+	doneRead bool
 }
 
 func (rc *Rows) Close() error {
 	// need to add a test which returns lots of rows
 	// and check closing after reading only few rows
 	rc.cancel()
+	defer rc.stmt.c.clearPending(rc.reader)
 
 	for {
 		tok, err := rc.reader.nextToken()
@@ -873,6 +1325,7 @@ func (rc *Rows) Next(dest []driver.Value) error {
 		tok, err := rc.reader.nextToken()
 		if err == nil {
 			if tok == nil {
+				rc.stmt.c.clearPending(rc.reader)
 				return io.EOF
 			} else {
 				switch tokdata := tok.(type) {
@@ -884,11 +1337,15 @@ func (rc *Rows) Next(dest []driver.Value) error {
 					for i := range dest {
 						dest[i] = tokdata[i]
 					}
+					rc.stmt.c.convertRow(rc.cols, dest, rc.reader.outs.timezone)
 					return nil
 				case doneStruct:
 					if tokdata.isError() {
 						return rc.stmt.c.checkBadConn(rc.reader.ctx, tokdata.getError(), false)
 					}
+					if !rc.doneRead {
+						rc.done, rc.doneRead = tokdata, true
+					}
 				case ReturnStatus:
 					if rc.reader.outs.returnStatus != nil {
 						*rc.reader.outs.returnStatus = tokdata
@@ -902,6 +1359,39 @@ func (rc *Rows) Next(dest []driver.Value) error {
 	}
 }
 
+// convertRow applies the connection parameters that change the values of
+// uniqueidentifier, sql_variant, date, time and datetime2 columns, and
+// moves the values of the columns without a time zone to loc.
+func (c *Conn) convertRow(cols []columnStruct, dest []driver.Value, loc *time.Location) {
+	if c.guidConversion() {
+		convertGUIDs(cols, dest)
+	}
+	if !c.typedVariants() {
+		unwrapVariants(dest)
+	}
+	if mode := c.dateTimeScan(); mode != msdsn.DateTimeScanTime {
+		convertDateTimes(cols, dest, mode)
+	} else if loc != nil {
+		setTimezone(cols, dest, loc)
+	}
+}
+
+// columnScanType returns the scan type of col, taking into account the
+// connection parameters applied by convertRow.
+func (c *Conn) columnScanType(col columnStruct) reflect.Type {
+	ti := col.originalTypeInfo()
+	switch {
+	case ti.TypeId == typeGuid && c.guidConversion():
+		return reflect.TypeOf("")
+	case ti.TypeId == typeVariant && c.typedVariants():
+		return variantType
+	}
+	if t := dateTimeScanType(ti.TypeId, c.dateTimeScan()); t != nil {
+		return t
+	}
+	return makeGoLangScanType(ti)
+}
+
 func (rc *Rows) HasNextResultSet() bool {
 	return rc.nextCols != nil
 }
@@ -909,17 +1399,56 @@ func (rc *Rows) HasNextResultSet() bool {
 func (rc *Rows) NextResultSet() error {
 	rc.cols = rc.nextCols
 	rc.nextCols = nil
+	rc.done, rc.doneRead = doneStruct{}, false
 	if rc.cols == nil {
 		return io.EOF
 	}
 	return nil
 }
 
+// ResultSetInfo describes how a result set ended.
+type ResultSetInfo struct {
+	// Done is true once the DONE token ending the result set was read,
+	// which happens when Next returns io.EOF for it. The other fields are
+	// only meaningful then.
+	Done bool
+	// Select is true when the result set came from a SELECT statement.
+	Select bool
+	// RowCount is the number of rows the server reported for the result
+	// set when RowCountValid is true.
+	RowCount      int64
+	RowCountValid bool
+	// MoreResults is true when another result set follows.
+	MoreResults bool
+}
+
+// RowsResultSetInfo is implemented by the rows of the driver, when the
+// sqlexp messages model is not used. ResultSetInfo describes the current
+// result set, it is meant to be called once Next returned io.EOF and
+// before NextResultSet. The driver rows can be reached with sql.Conn.Raw.
+type RowsResultSetInfo interface {
+	driver.RowsNextResultSet
+	ResultSetInfo() ResultSetInfo
+}
+
+func (rc *Rows) ResultSetInfo() ResultSetInfo {
+	if !rc.doneRead {
+		return ResultSetInfo{}
+	}
+	return ResultSetInfo{
+		Done:          true,
+		Select:        rc.done.CurCmd == cmdSelect,
+		RowCount:      int64(rc.done.RowCount),
+		RowCountValid: rc.done.Status&doneCount != 0,
+		MoreResults:   rc.nextCols != nil,
+	}
+}
+
 // It should return
 // the value type that can be used to scan types into. For example, the database
 // column type "bigint" this should return "reflect.TypeOf(int64(0))".
 func (r *Rows) ColumnTypeScanType(index int) reflect.Type {
-	return makeGoLangScanType(r.cols[index].originalTypeInfo())
+	return r.stmt.c.columnScanType(r.cols[index])
 }
 
 // RowsColumnTypeDatabaseTypeName may be implemented by Rows. It should return the
@@ -963,9 +1492,22 @@ func (r *Rows) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
 // to be not nullable.
 // If the column nullability is unknown, ok should be false.
 func (r *Rows) ColumnTypeNullable(index int) (nullable, ok bool) {
-	nullable = r.cols[index].Flags&colFlagNullable != 0
-	ok = true
-	return
+	return columnNullable(r.cols[index])
+}
+
+// ColumnTypeCollation implements RowsColumnTypeCollation.
+func (r *Rows) ColumnTypeCollation(index int) (Collation, bool) {
+	return columnCollation(r.cols[index].originalTypeInfo())
+}
+
+// ColumnTypeVectorElementType implements RowsColumnTypeVectorElementType.
+func (r *Rows) ColumnTypeVectorElementType(index int) (VectorElementType, bool) {
+	return vectorElementType(r.cols[index].originalTypeInfo())
+}
+
+// ColumnTypeUDT implements RowsColumnTypeUDT.
+func (r *Rows) ColumnTypeUDT(index int) (UDTType, bool) {
+	return columnUDT(r.cols[index].originalTypeInfo())
 }
 
 func makeStrParam(val string) (res param) {
@@ -998,6 +1540,26 @@ func (s *Stmt) makeParam(val driver.Value) (res param, err error) {
 		}
 	case UniqueIdentifier:
 	case NullUniqueIdentifier:
+	case RowVersion:
+	case UDTValue:
+	case Decimal:
+	case Money:
+	case NullMoney:
+		if valuer.Valid {
+			return s.makeParam(valuer.Money)
+		}
+	case NullXML:
+		if valuer.Valid {
+			return s.makeParam(valuer.XML)
+		}
+	case NullDateTimeOffset:
+		if valuer.Valid {
+			return s.makeParam(valuer.DateTimeOffset)
+		}
+	case NullVector:
+		if valuer.Valid {
+			return s.makeParam(valuer.Vector)
+		}
 	default:
 		break
 	case driver.Valuer:
@@ -1012,11 +1574,45 @@ func (s *Stmt) makeParam(val driver.Value) (res param, err error) {
 		}
 	}
 	switch val := val.(type) {
+	case Decimal:
+		return makeDecimalParam(val)
+	case Variant:
+		return s.makeVariantParam(val)
+	case Money:
+		return makeMoneyParam(val)
+	case NullMoney:
+		// only NULL values get here
+		res.ti.TypeId = typeMoneyN
+		res.ti.Size = 8
+		res.buffer = []byte{}
+	case XML:
+		return makeXMLParam(val), nil
+	case NullXML:
+		// only NULL values get here
+		res.ti.TypeId = typeXml
+		res.buffer = nil
+	case Vector:
+		return s.makeVectorParam(val)
+	case NullVector:
+		// only NULL values get here
+		return s.makeParam(nil)
+	case NullDateTimeOffset:
+		// only NULL values get here
+		res.ti.TypeId = typeDateTimeOffsetN
+		res.ti.Scale = 7
+		res.ti.Size = 10
+		res.buffer = []byte{}
 	case UniqueIdentifier:
 		res.ti.TypeId = typeGuid
 		res.ti.Size = 16
 		guid, _ := val.Value()
 		res.buffer = guid.([]byte)
+	case UDTValue:
+		return makeUDTParam(val)
+	case RowVersion:
+		res.ti.TypeId = typeBigBinary
+		res.ti.Size = len(val)
+		res.buffer = append([]byte(nil), val[:]...)
 	case NullUniqueIdentifier:
 		res.ti.TypeId = typeGuid
 		res.ti.Size = 16
@@ -1127,11 +1723,11 @@ func (s *Stmt) makeParam(val driver.Value) (res param, err error) {
 		if s.c.sess.loginAck.TDSVersion >= verTDS73 {
 			res.ti.TypeId = typeDateTimeOffsetN
 			res.ti.Scale = 7
-			res.buffer = encodeDateTimeOffset(val, int(res.ti.Scale))
+			res.buffer = encodeDateTimeOffset(inTimezone(val, s.timezone), int(res.ti.Scale))
 			res.ti.Size = len(res.buffer)
 		} else {
 			res.ti.TypeId = typeDateTimeN
-			res.buffer = encodeDateTime(val)
+			res.buffer = encodeDateTime(inTimezone(val, s.timezone))
 			res.ti.Size = len(res.buffer)
 		}
 	case sql.NullTime: // only null values reach here
@@ -1155,6 +1751,7 @@ func (s *Stmt) makeParam(val driver.Value) (res param, err error) {
 type Result struct {
 	c            *Conn
 	rowsAffected int64
+	stats        *ExecutionStats
 }
 
 func (r *Result) RowsAffected() (int64, error) {
@@ -1164,15 +1761,69 @@ func (r *Result) RowsAffected() (int64, error) {
 var _ driver.Pinger = &Conn{}
 
 // Ping is used to check if the remote server is available and satisfies the Pinger interface.
+// It sends a batch without statements, which does not carry the session
+// reset requested by ResetSession: that is left to the next statement. A
+// connection that is closed or does not answer is reported with
+// driver.ErrBadConn, so database/sql discards it, while a server that has
+// not answered before ctx ends but confirms the cancellation is busy: the
+// error matches both ErrServerBusy and the error of ctx, and the
+// connection is kept.
 func (c *Conn) Ping(ctx context.Context) error {
 	if !c.connectionGood {
 		return driver.ErrBadConn
 	}
-	stmt := &Stmt{c, `select 1;`, 0, nil, true}
-	_, err := stmt.ExecContext(ctx, nil)
+	if err := c.checkPending("ping"); err != nil {
+		return err
+	}
+	headers := []headerStruct{
+		{hdrtype: dataStmHdrTransDescr,
+			data: transDescrHdr{c.sess.tranid, 1}.pack()},
+	}
+	if err := sendSqlBatch72(c.sess.buf, pingBatch, headers, false); err != nil {
+		if c.sess.logFlags&logErrors != 0 {
+			c.sess.logger.Log(ctx, msdsn.LogErrors, fmt.Sprintf("Failed to send ping with %v", err))
+		}
+		c.connectionGood = false
+		return driver.ErrBadConn
+	}
+	reader := startReading(c.sess, ctx, outputs{})
+	err := reader.iterateResponse()
+	if err == nil {
+		return nil
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil && err == ctxErr {
+		// the server confirmed the attention sent once ctx ended
+		return serverBusyError{err}
+	}
+	if err = c.checkBadConn(ctx, err, false); !c.connectionGood {
+		return driver.ErrBadConn
+	}
 	return err
 }
 
+// pingBatch is the batch sent by Ping, a comment that the server parses
+// and answers with a DONE token alone.
+const pingBatch = "-- ping"
+
+// serverBusyError is returned by Ping when the server did not answer
+// before the context ended. It matches ErrServerBusy and wraps the error
+// of the context.
+type serverBusyError struct {
+	err error
+}
+
+func (e serverBusyError) Error() string {
+	return fmt.Sprintf("%v: %v", ErrServerBusy, e.err)
+}
+
+func (e serverBusyError) Is(target error) bool {
+	return target == ErrServerBusy
+}
+
+func (e serverBusyError) Unwrap() error {
+	return e.err
+}
+
 var _ driver.ConnBeginTx = &Conn{}
 
 func convertIsolationLevel(level sql.IsolationLevel) (isoLevel, error) {
@@ -1203,14 +1854,16 @@ func (c *Conn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, e
 	if !c.connectionGood {
 		return nil, driver.ErrBadConn
 	}
-	if opts.ReadOnly {
-		return nil, errors.New("read-only transactions are not supported")
-	}
 
 	tdsIsolation, err := convertIsolationLevel(sql.IsolationLevel(opts.Isolation))
 	if err != nil {
 		return nil, err
 	}
+	if opts.ReadOnly {
+		if err = c.checkReadOnlyDatabase(ctx); err != nil {
+			return nil, err
+		}
+	}
 	return c.begin(ctx, tdsIsolation)
 }
 
@@ -1222,7 +1875,59 @@ func (c *Conn) PrepareContext(ctx context.Context, query string) (driver.Stmt, e
 		return c.prepareCopyIn(ctx, query)
 	}
 
-	return c.prepareContext(ctx, query)
+	stmt, err := c.prepareContext(ctx, query)
+	if err == nil && c.describesParameters() && !isProc(stmt.query) && hasNamedParameters(stmt.query) {
+		stmt.describeParameters(ctx)
+	}
+	return stmt, err
+}
+
+var (
+	_ driver.QueryerContext = &Conn{}
+	_ driver.ExecerContext  = &Conn{}
+)
+
+// QueryContext runs query without preparing it when DescribeParameters is
+// set, so that only the statements prepared by the application describe
+// their parameters. Otherwise it returns driver.ErrSkip and database/sql
+// prepares the statement as usual.
+func (c *Conn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	stmt, err := c.unpreparedStmt(ctx, query, len(args))
+	if err != nil {
+		return nil, err
+	}
+	return stmt.QueryContext(ctx, args)
+}
+
+// ExecContext runs query without preparing it when DescribeParameters is
+// set, as QueryContext does.
+func (c *Conn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	stmt, err := c.unpreparedStmt(ctx, query, len(args))
+	if err != nil {
+		return nil, err
+	}
+	return stmt.ExecContext(ctx, args)
+}
+
+// unpreparedStmt returns the statement of a query run without Prepare,
+// or driver.ErrSkip to let database/sql prepare it.
+func (c *Conn) unpreparedStmt(ctx context.Context, query string, numArgs int) (*Stmt, error) {
+	if !c.describesParameters() || len(query) > 10 && strings.EqualFold(query[:10], "INSERTBULK") {
+		return nil, driver.ErrSkip
+	}
+	stmt, err := c.prepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	// database/sql only checks the number of arguments of prepared statements
+	if stmt.paramCount >= 0 && stmt.paramCount != numArgs {
+		return nil, fmt.Errorf("mssql: expected %d arguments, got %d", stmt.paramCount, numArgs)
+	}
+	return stmt, nil
+}
+
+func (c *Conn) describesParameters() bool {
+	return c.connector != nil && c.connector.params.DescribeParameters
 }
 
 func (s *Stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
@@ -1235,7 +1940,34 @@ func (s *Stmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driv
 	for i, nv := range args {
 		list[i] = namedValueFromDriverNamedValue(nv)
 	}
-	return s.queryContext(ctx, list)
+	ctx, cancel := s.c.commandContext(ctx)
+	ctx, stmt, after, err := s.intercept(ctx, list, false)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	outs := s.c.outs
+	rows, err := stmt.queryContext(ctx, list)
+	for attempt := 1; err != nil && stmt.retryThrottled(ctx, err, attempt); attempt++ {
+		s.c.outs = outs
+		rows, err = stmt.queryContext(ctx, list)
+	}
+	after(err)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	// The deadline covers reading the rows, so it is released when they
+	// are closed.
+	switch r := rows.(type) {
+	case *Rows:
+		r.cancel = chainCancel(r.cancel, cancel)
+	case *Rowsq:
+		r.cancel = chainCancel(r.cancel, cancel)
+	default:
+		cancel()
+	}
+	return rows, nil
 }
 
 func (s *Stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
@@ -1248,7 +1980,48 @@ func (s *Stmt) ExecContext(ctx context.Context, args []driver.NamedValue) (drive
 	for i, nv := range args {
 		list[i] = namedValueFromDriverNamedValue(nv)
 	}
-	return s.exec(ctx, list)
+	ctx, cancel := s.c.commandContext(ctx)
+	defer cancel()
+	ctx, stmt, after, err := s.intercept(ctx, list, true)
+	if err != nil {
+		return nil, err
+	}
+	outs := s.c.outs
+	res, err := stmt.exec(ctx, list)
+	for attempt := 1; err != nil && stmt.retryThrottled(ctx, err, attempt); attempt++ {
+		s.c.outs = outs
+		res, err = stmt.exec(ctx, list)
+	}
+	after(err)
+	return res, err
+}
+
+// commandContext returns ctx with the deadline of the command timeout,
+// from WithCommandTimeout or else the "command timeout" of the connection
+// string, when ctx has no deadline and the timeout is positive. Otherwise
+// ctx is returned as is.
+func (c *Conn) commandContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok {
+		return ctx, func() {}
+	}
+	var timeout time.Duration
+	if c.connector != nil {
+		timeout = c.connector.params.CommandTimeout
+	}
+	if opts := queryOptionsFromContext(ctx); opts.hasCommandTimeout {
+		timeout = opts.commandTimeout
+	}
+	if timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, timeout)
+}
+
+func chainCancel(first, second func()) func() {
+	return func() {
+		first()
+		second()
+	}
 }
 
 func namedValueFromDriverNamedValue(v driver.NamedValue) namedValue {
@@ -1268,6 +2041,7 @@ type Rowsq struct {
 
 func (rc *Rowsq) Close() error {
 	rc.cancel()
+	defer rc.stmt.c.clearPending(rc.reader)
 
 	for {
 		tok, err := rc.reader.nextToken()
@@ -1343,6 +2117,7 @@ func (rc *Rowsq) Next(dest []driver.Value) error {
 					for i := range dest {
 						dest[i] = tokdata[i]
 					}
+					rc.stmt.c.convertRow(rc.cols, dest, rc.reader.outs.timezone)
 					return nil
 				case doneStruct:
 					if tokdata.Status&doneMore == 0 {
@@ -1445,7 +2220,7 @@ scan:
 // the value type that can be used to scan types into. For example, the database
 // column type "bigint" this should return "reflect.TypeOf(int64(0))".
 func (r *Rowsq) ColumnTypeScanType(index int) reflect.Type {
-	return makeGoLangScanType(r.cols[index].originalTypeInfo())
+	return r.stmt.c.columnScanType(r.cols[index])
 }
 
 // RowsColumnTypeDatabaseTypeName may be implemented by Rows. It should return the
@@ -1489,7 +2264,20 @@ func (r *Rowsq) ColumnTypePrecisionScale(index int) (int64, int64, bool) {
 // to be not nullable.
 // If the column nullability is unknown, ok should be false.
 func (r *Rowsq) ColumnTypeNullable(index int) (nullable, ok bool) {
-	nullable = r.cols[index].Flags&colFlagNullable != 0
-	ok = true
-	return
+	return columnNullable(r.cols[index])
+}
+
+// ColumnTypeCollation implements RowsColumnTypeCollation.
+func (r *Rowsq) ColumnTypeCollation(index int) (Collation, bool) {
+	return columnCollation(r.cols[index].originalTypeInfo())
+}
+
+// ColumnTypeVectorElementType implements RowsColumnTypeVectorElementType.
+func (r *Rowsq) ColumnTypeVectorElementType(index int) (VectorElementType, bool) {
+	return vectorElementType(r.cols[index].originalTypeInfo())
+}
+
+// ColumnTypeUDT implements RowsColumnTypeUDT.
+func (r *Rowsq) ColumnTypeUDT(index int) (UDTType, bool) {
+	return columnUDT(r.cols[index].originalTypeInfo())
 }
@@ -6,6 +6,7 @@ import (
 	"context"
 	"database/sql/driver"
 	"errors"
+	"fmt"
 )
 
 var _ driver.Connector = &Connector{}
@@ -15,31 +16,97 @@ func (c *Conn) ResetSession(ctx context.Context) error {
 	if !c.connectionGood {
 		return driver.ErrBadConn
 	}
-	c.resetSession = true
-
-	if c.connector == nil || len(c.connector.SessionInitSQL) == 0 {
+	if c.connector != nil && c.connector.conns != nil && !c.connector.conns.setInUse(c, true) {
+		// the connector is shut down
+		return driver.ErrBadConn
+	}
+	// Catch connections closed while they sat in the pool, during a
+	// failover or by an idle timeout of a load balancer, before they fail
+	// the next query.
+	if c.sess != nil && !connAlive(c.sess.conn) {
+		c.connectionGood = false
+		return driver.ErrBadConn
+	}
+	if c.connector == nil {
+		c.resetSession = true
 		return nil
 	}
+	c.resetSession = c.resetSession || !c.connector.DisableSessionReset
 
-	s, err := c.prepareContext(ctx, c.connector.SessionInitSQL)
-	if err != nil {
-		return driver.ErrBadConn
+	if initSQL := c.connector.sessionInitSQL(); len(initSQL) > 0 {
+		s, err := c.prepareContext(ctx, initSQL)
+		if err != nil {
+			return driver.ErrBadConn
+		}
+		_, err = s.exec(ctx, nil)
+		if err != nil {
+			return driver.ErrBadConn
+		}
 	}
-	_, err = s.exec(ctx, nil)
-	if err != nil {
-		return driver.ErrBadConn
+
+	if len(c.connector.InitialSessionContext) > 0 {
+		query, args := c.connector.sessionContextBatch()
+		s, err := c.prepareContext(ctx, query)
+		if err != nil {
+			return driver.ErrBadConn
+		}
+		_, err = s.exec(ctx, args)
+		if err != nil {
+			return driver.ErrBadConn
+		}
 	}
 
+	if hook := c.connector.SessionResetHook; hook != nil {
+		if err := hook(ctx, c); err != nil {
+			c.connectionGood = false
+			return sessionResetError{err: err}
+		}
+	}
 	return nil
 }
 
+// sessionResetError is returned by ResetSession when SessionResetHook
+// fails. It wraps the error of the hook and matches driver.ErrBadConn, so
+// that database/sql discards the connection.
+type sessionResetError struct {
+	err error
+}
+
+func (e sessionResetError) Error() string {
+	return fmt.Sprintf("mssql: session reset hook failed: %v", e.err)
+}
+
+func (e sessionResetError) Is(target error) bool {
+	return target == driver.ErrBadConn
+}
+
+func (e sessionResetError) Unwrap() error {
+	return e.err
+}
+
 // Connect to the server and return a TDS connection.
 func (c *Connector) Connect(ctx context.Context) (driver.Conn, error) {
+	if c.configErr != nil {
+		return nil, c.configErr
+	}
+	if c.conns != nil && c.conns.isShutdown() {
+		return nil, ErrShutdown
+	}
 	conn, err := c.driver.connect(ctx, c, c.params)
-	if err == nil {
-		err = conn.ResetSession(ctx)
+	if err == nil && c.conns != nil {
+		if err = c.conns.add(conn); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = conn.ResetSession(ctx); err != nil {
+		conn.Close()
+		return nil, err
 	}
-	return conn, err
+	return conn, nil
 }
 
 // Driver underlying the Connector.
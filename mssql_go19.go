@@ -4,10 +4,12 @@
 package mssql
 
 import (
+	"bytes"
 	"database/sql"
 	"database/sql/driver"
 	"errors"
 	"fmt"
+	"math/big"
 	"reflect"
 	"time"
 
@@ -48,6 +50,9 @@ type DateTime1 time.Time
 type DateTimeOffset time.Time
 
 func convertInputParameter(val interface{}) (interface{}, error) {
+	if conv, ok := convertUUIDParameter(val); ok {
+		return conv, nil
+	}
 	switch v := val.(type) {
 	case int, int16, int32, int64, int8:
 		return val, nil
@@ -65,6 +70,8 @@ func convertInputParameter(val interface{}) (interface{}, error) {
 		return val, nil
 	case DateTimeOffset:
 		return val, nil
+	case NullDateTimeOffset:
+		return val, nil
 	case civil.Date:
 		return val, nil
 	case civil.DateTime:
@@ -75,6 +82,33 @@ func convertInputParameter(val interface{}) (interface{}, error) {
 	// 	return nil
 	case float32:
 		return val, nil
+	case Decimal:
+		return val, nil
+	case Variant:
+		return val, nil
+	case Money:
+		return val, nil
+	case NullMoney:
+		return val, nil
+	case moneyValuer:
+		return v.nullMoney()
+	case XML:
+		return val, nil
+	case NullXML:
+		return val, nil
+	case Vector:
+		return val, nil
+	case NullVector:
+		return val, nil
+	case decimalCoefficient:
+		return decimalFromCoefficient(v)
+	case *big.Rat:
+		if v == nil {
+			return nil, nil
+		}
+		return DecimalFromRat(v)
+	case big.Rat:
+		return DecimalFromRat(&v)
 	case driver.Valuer:
 		return val, nil
 	default:
@@ -137,6 +171,11 @@ func (c *Conn) CheckNamedValue(nv *driver.NamedValue) error {
 		sqlexp.ReturnMessageInit(v)
 		c.outs.msgq = v
 		return driver.ErrRemoveArgument
+	case *MessageQueue:
+		sqlexp.ReturnMessageInit(&v.q)
+		c.outs.msgq = &v.q
+		c.outs.typedMsgs = true
+		return driver.ErrRemoveArgument
 	default:
 		var err error
 		nv.Value, err = convertInputParameter(nv.Value)
@@ -148,10 +187,12 @@ func (s *Stmt) makeParamExtra(val driver.Value) (res param, err error) {
 	switch val := val.(type) {
 	case VarChar:
 		res.ti.TypeId = typeBigVarChar
+		res.ti.Collation = s.c.varcharCollation()
 		res.buffer = []byte(val)
 		res.ti.Size = len(res.buffer)
 	case VarCharMax:
 		res.ti.TypeId = typeBigVarChar
+		res.ti.Collation = s.c.varcharCollation()
 		res.buffer = []byte(val)
 		res.ti.Size = 0 // currently zero forces varchar(max)
 	case NVarCharMax:
@@ -163,7 +204,7 @@ func (s *Stmt) makeParamExtra(val driver.Value) (res param, err error) {
 		res.buffer = str2ucs2(string(val))
 		res.ti.Size = len(res.buffer)
 	case DateTime1:
-		t := time.Time(val)
+		t := inTimezone(time.Time(val), s.timezone)
 		res.ti.TypeId = typeDateTimeN
 		res.buffer = encodeDateTime(t)
 		res.ti.Size = len(res.buffer)
@@ -189,6 +230,15 @@ func (s *Stmt) makeParamExtra(val driver.Value) (res param, err error) {
 	case sql.Out:
 		res, err = s.makeParam(val.Dest)
 		res.Flags = fByRevValue
+		if res.ti.TypeId == typeDecimalN {
+			// leave room for any value the server returns
+			res.ti.Prec = maxDecimalPrecision
+		}
+		if isVarLenType(res.ti.TypeId) {
+			// declared as max, so values longer than the initial one
+			// are not truncated
+			res.ti.Size = 0
+		}
 	case TVP:
 		err = val.check()
 		if err != nil {
@@ -206,9 +256,20 @@ func (s *Stmt) makeParamExtra(val driver.Value) (res param, err error) {
 			err = errCalTypes
 			return
 		}
-		res.buffer, err = val.encode(schema, name, columnStr, tvpFieldIndexes)
-		if err != nil {
-			return
+		if _, ok := val.Value.(TVPRows); ok {
+			var metadata *bytes.Buffer
+			if metadata, err = val.encodeMetadata(schema, name, columnStr, tvpFieldIndexes); err != nil {
+				return
+			}
+			res.buffer = metadata.Bytes()
+			res.stream = func(w *tdsBuffer) error {
+				return val.writeRows(w, columnStr, tvpFieldIndexes)
+			}
+		} else {
+			res.buffer, err = val.encode(schema, name, columnStr, tvpFieldIndexes)
+			if err != nil {
+				return
+			}
 		}
 		res.ti.Size = len(res.buffer)
 
@@ -219,6 +280,14 @@ func (s *Stmt) makeParamExtra(val driver.Value) (res param, err error) {
 }
 
 func scanIntoOut(name string, fromServer, scanInto interface{}) error {
+	if v, ok := fromServer.(Variant); ok {
+		if _, ok := scanInto.(*Variant); !ok {
+			fromServer = v.Value
+		}
+	}
+	if ok, err := scanUUID(scanInto, fromServer); ok {
+		return err
+	}
 	return convertAssign(scanInto, fromServer)
 }
 
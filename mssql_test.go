@@ -4,10 +4,12 @@ import (
 	"context"
 	"database/sql"
 	"database/sql/driver"
+	"errors"
 	"fmt"
 	"io"
 	"net"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/microsoft/go-mssqldb/msdsn"
@@ -23,6 +25,109 @@ func TestBadOpen(t *testing.T) {
 	}
 }
 
+func TestConnectorSessionInitSQL(t *testing.T) {
+	c, err := NewConnector("server=somehost;arithabort=on;lock_timeout=100")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "SET ARITHABORT ON;\nSET LOCK_TIMEOUT 100;"
+	if got := c.sessionInitSQL(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+	c.SessionInitSQL = "SET TEXTSIZE -1;"
+	want += "\nSET TEXTSIZE -1;"
+	if got := c.sessionInitSQL(); got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	c, err = NewConnector("server=somehost")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.SessionInitSQL = "SET TEXTSIZE -1;"
+	if got := c.sessionInitSQL(); got != c.SessionInitSQL {
+		t.Errorf("got %q, want %q", got, c.SessionInitSQL)
+	}
+}
+
+func TestConnectorValidatesConfig(t *testing.T) {
+	if _, err := NewConnector("server=somehost;encrypt=disable;tlsmin=1.2"); !errors.As(err, new(msdsn.ConfigError)) {
+		t.Errorf("got %v, want a msdsn.ConfigError", err)
+	}
+	if _, err := (&Driver{}).OpenConnector("server=somehost;workload group=[batch]"); !errors.As(err, new(msdsn.ConfigError)) {
+		t.Errorf("got %v, want a msdsn.ConfigError", err)
+	}
+
+	config := msdsn.Config{Host: "somehost", PacketSize: 100, Parameters: map[string]string{"app name": "test"}}
+	c := NewConnectorConfig(config)
+	config.Parameters["app name"] = "changed"
+	if c.params.Parameters["app name"] != "test" {
+		t.Error("the connector should keep a copy of the config")
+	}
+	if _, err := c.Connect(context.Background()); !errors.As(err, new(msdsn.ConfigError)) {
+		t.Errorf("got %v, want a msdsn.ConfigError", err)
+	}
+}
+
+func TestSessionContextBatch(t *testing.T) {
+	c := &Connector{InitialSessionContext: map[string]string{"tenant_id": "42", "region": "eu"}}
+	query, args := c.sessionContextBatch()
+	want := "EXEC sp_set_session_context @p1, @p2;\nEXEC sp_set_session_context @p3, @p4;\n"
+	if query != want {
+		t.Errorf("got %q, want %q", query, want)
+	}
+	wantArgs := []namedValue{{Ordinal: 1, Value: "region"}, {Ordinal: 2, Value: "eu"}, {Ordinal: 3, Value: "tenant_id"}, {Ordinal: 4, Value: "42"}}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("got %+v, want %+v", args, wantArgs)
+	}
+}
+
+func TestResetSessionHook(t *testing.T) {
+	var calls int
+	connector := &Connector{
+		SessionResetHook: func(ctx context.Context, conn *Conn) error {
+			calls++
+			if !conn.resetSession {
+				t.Error("the hook should run after the reset is requested")
+			}
+			return nil
+		},
+	}
+	c := &Conn{connector: connector, connectionGood: true}
+	if err := c.ResetSession(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 1 {
+		t.Errorf("hook called %d times, want 1", calls)
+	}
+
+	connector.DisableSessionReset = true
+	hookErr := errors.New("setup failed")
+	connector.SessionResetHook = func(ctx context.Context, conn *Conn) error {
+		return hookErr
+	}
+	c = &Conn{connector: connector, connectionGood: true}
+	err := c.ResetSession(context.Background())
+	if !errors.Is(err, driver.ErrBadConn) || !errors.Is(err, hookErr) {
+		t.Errorf("got %v, want an error wrapping the hook error and matching driver.ErrBadConn", err)
+	}
+	if c.connectionGood {
+		t.Error("a failed hook should mark the connection bad")
+	}
+	if c.resetSession {
+		t.Error("DisableSessionReset should not request a session reset")
+	}
+
+	connector.SessionResetHook = nil
+	c = &Conn{connector: connector, connectionGood: true, resetSession: true}
+	if err := c.ResetSession(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !c.resetSession {
+		t.Error("DisableSessionReset should keep a reset that is already pending")
+	}
+}
+
 func TestIsProc(t *testing.T) {
 	list := []struct {
 		s  string
@@ -178,6 +283,34 @@ func TestCheckBadConn(t *testing.T) {
 // That instructs the database/sql connection pool logic to discard the
 // bad connection and, if appropriate, attempt to retry the operation
 // with another connection.
+func TestSendQueryCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	transport := &replyTransport{reply: attentionReply()}
+	c := &Conn{
+		connectionGood: true,
+		resetSession:   true,
+		sess: &tdsSession{
+			buf:    newTdsBuffer(defaultPacketSize, transport),
+			logger: optionalLogger{},
+		},
+	}
+	s := &Stmt{c: c, query: "select '" + strings.Repeat("x", 2*defaultPacketSize) + "'"}
+	if err := s.sendQuery(ctx, nil); err != context.Canceled {
+		t.Fatalf("got %v, want context.Canceled", err)
+	}
+	if !c.connectionGood {
+		t.Error("canceling a send should keep the connection")
+	}
+	if !c.resetSession {
+		t.Error("the session reset of the canceled request should be kept for the next one")
+	}
+	packets := transport.packets()
+	if len(packets) != 2 || packets[0][1] != statusEOM|statusIgnore|0x8 || packets[1][0] != byte(packAttention) {
+		t.Errorf("got packets %x, want an ignored batch and an attention", packets)
+	}
+}
+
 func TestBadConnRejection(t *testing.T) {
 
 	c := Conn{connectionGood: false}
@@ -247,3 +380,46 @@ func TestBadConnRejection(t *testing.T) {
 	}
 
 }
+
+func TestRowsResultSetInfo(t *testing.T) {
+	cols := []columnStruct{{ColName: "n", ti: typeInfo{TypeId: typeInt4, Size: 4}}}
+	tokChan := make(chan tokenStruct, 10)
+	tokChan <- []interface{}{int64(1)}
+	tokChan <- doneStruct{Status: doneMore | doneCount, CurCmd: cmdSelect, RowCount: 1}
+	tokChan <- doneStruct{Status: doneMore | doneCount, CurCmd: 0xc3, RowCount: 5}
+	tokChan <- cols
+	tokChan <- doneStruct{CurCmd: cmdSelect}
+	close(tokChan)
+	rows := &Rows{
+		stmt:   &Stmt{c: &Conn{connectionGood: true}},
+		cols:   cols,
+		reader: &tokenProcessor{tokChan: tokChan, ctx: context.Background(), sess: &tdsSession{}},
+	}
+	var r RowsResultSetInfo = rows
+
+	dest := make([]driver.Value, 1)
+	if err := r.Next(dest); err != nil {
+		t.Fatal(err)
+	}
+	if info := r.ResultSetInfo(); info.Done {
+		t.Errorf("result set should not be done before its DONE token, got %+v", info)
+	}
+	if err := r.Next(dest); err != io.EOF {
+		t.Fatalf("got %v, want io.EOF", err)
+	}
+	want := ResultSetInfo{Done: true, Select: true, RowCount: 1, RowCountValid: true, MoreResults: true}
+	if info := r.ResultSetInfo(); info != want {
+		t.Errorf("first result set got %+v, want %+v", info, want)
+	}
+
+	if err := r.NextResultSet(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Next(dest); err != io.EOF {
+		t.Fatalf("got %v, want io.EOF", err)
+	}
+	want = ResultSetInfo{Done: true, Select: true}
+	if info := r.ResultSetInfo(); info != want {
+		t.Errorf("second result set got %+v, want %+v", info, want)
+	}
+}
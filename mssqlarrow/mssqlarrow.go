@@ -0,0 +1,330 @@
+// Package mssqlarrow streams the results of SQL Server queries into Apache
+// Arrow records, for the analytics libraries that read Arrow.
+//
+// The values of each row are appended as decoded by the driver, through
+// mssql.CopyOut, without the conversions of sql.Rows.Scan. Integers, floats,
+// dates and times go straight into the fixed width buffers of the records,
+// and character columns can be dictionary encoded so each distinct string is
+// stored once per record.
+//
+// The package is a separate module so the driver does not depend on Arrow.
+package mssqlarrow
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	mssql "github.com/microsoft/go-mssqldb"
+)
+
+// DefaultBatchSize is the number of rows of the records when
+// Options.BatchSize is zero.
+const DefaultBatchSize = 64 * 1024
+
+// TypeMetadataKey is the key of the field metadata holding the SQL type of
+// the column, such as "NVARCHAR".
+const TypeMetadataKey = "mssql.type"
+
+// Options are the options of Query and NewWriter.
+type Options struct {
+	// BatchSize is the largest number of rows of a record.
+	BatchSize int
+	// DictionaryColumns are the names of the character columns encoded as
+	// dictionaries of strings with int32 indices. Names are case
+	// insensitive.
+	DictionaryColumns []string
+	// Allocator allocates the buffers of the records,
+	// memory.DefaultAllocator when nil.
+	Allocator memory.Allocator
+}
+
+// Query runs query on conn and calls fn with the records of its first
+// result set, each holding up to opts.BatchSize rows, and returns the
+// number of rows read. A record is released when fn returns, so fn must
+// retain it to keep it. Errors returned by fn stop the query.
+//
+// The columns map to Arrow types as follows:
+//
+//	bit                                 bool
+//	tinyint                             uint8
+//	smallint, int, bigint               int16, int32, int64
+//	real, float                         float32, float64
+//	date                                date32
+//	time                                time64[ns]
+//	smalldatetime, datetime, datetime2  timestamp[us]
+//	datetimeoffset                      timestamp[us, tz=UTC]
+//	uniqueidentifier                    fixed_size_binary[16]
+//	binary, varbinary, image            binary
+//	char, varchar, nchar, nvarchar,     utf8, or dictionary<int32, utf8>
+//	text, ntext, xml                    for the DictionaryColumns
+//
+// decimal, numeric and money columns, and the columns of other types, are
+// utf8 holding the text of the values, so no precision is lost. Timestamps
+// are truncated to the microsecond so the whole range of datetime2 fits.
+// The SQL type of each column is in the metadata of its field, under
+// TypeMetadataKey.
+func Query(ctx context.Context, conn *sql.Conn, opts Options, fn func(arrow.Record) error, query string, args ...interface{}) (int64, error) {
+	w := NewWriter(opts, fn)
+	defer w.Release()
+	n, err := mssql.CopyOut(ctx, conn, w, query, args...)
+	if err != nil {
+		return n, err
+	}
+	return n, w.Flush()
+}
+
+// Writer is an mssql.RowWriter building Arrow records from the rows it is
+// given, for use with mssql.CopyOut when Query does not fit.
+type Writer struct {
+	opts    Options
+	fn      func(arrow.Record) error
+	schema  *arrow.Schema
+	builder *array.RecordBuilder
+	appends []appendFunc
+	rows    int
+}
+
+// appendFunc appends a value that is not nil to the builder of a column.
+type appendFunc func(b array.Builder, v driver.Value) bool
+
+// NewWriter returns a Writer calling fn with each record of
+// opts.BatchSize rows, and with the last rows on Flush. Release the Writer
+// once done.
+func NewWriter(opts Options, fn func(arrow.Record) error) *Writer {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.Allocator == nil {
+		opts.Allocator = memory.DefaultAllocator
+	}
+	return &Writer{opts: opts, fn: fn}
+}
+
+// Schema returns the schema of the records, or nil before WriteColumns.
+func (w *Writer) Schema() *arrow.Schema {
+	return w.schema
+}
+
+// WriteColumns sets the schema of the records from the columns.
+func (w *Writer) WriteColumns(cols []mssql.CopyOutColumn) error {
+	if w.builder != nil {
+		w.builder.Release()
+	}
+	fields := make([]arrow.Field, len(cols))
+	w.appends = make([]appendFunc, len(cols))
+	for i, col := range cols {
+		dict := false
+		for _, name := range w.opts.DictionaryColumns {
+			if strings.EqualFold(name, col.Name) {
+				dict = true
+			}
+		}
+		fields[i] = arrow.Field{
+			Name:     col.Name,
+			Nullable: col.Nullable,
+			Metadata: arrow.NewMetadata([]string{TypeMetadataKey}, []string{col.DatabaseTypeName}),
+		}
+		fields[i].Type, w.appends[i] = columnType(col.DatabaseTypeName, dict)
+	}
+	w.schema = arrow.NewSchema(fields, nil)
+	w.builder = array.NewRecordBuilder(w.opts.Allocator, w.schema)
+	w.rows = 0
+	return nil
+}
+
+// WriteRow appends row to the record being built, and passes the record
+// on once it holds BatchSize rows.
+func (w *Writer) WriteRow(row []driver.Value) error {
+	if w.builder == nil {
+		return fmt.Errorf("mssqlarrow: WriteRow called before WriteColumns")
+	}
+	for i, v := range row {
+		b := w.builder.Field(i)
+		if v == nil {
+			b.AppendNull()
+			continue
+		}
+		if !w.appends[i](b, v) {
+			f := w.schema.Field(i)
+			return fmt.Errorf("mssqlarrow: cannot append %T to column %s of type %s", v, f.Name, f.Type)
+		}
+	}
+	w.rows++
+	if w.rows >= w.opts.BatchSize {
+		return w.Flush()
+	}
+	return nil
+}
+
+// Flush passes on the rows appended since the last record, if any.
+func (w *Writer) Flush() error {
+	if w.builder == nil || w.rows == 0 {
+		return nil
+	}
+	rec := w.builder.NewRecord()
+	defer rec.Release()
+	w.rows = 0
+	return w.fn(rec)
+}
+
+// Release frees the buffers of the rows not flushed.
+func (w *Writer) Release() {
+	if w.builder != nil {
+		w.builder.Release()
+		w.builder = nil
+	}
+}
+
+// columnType returns the Arrow type of the columns of the SQL type
+// typeName and the function appending their values.
+func columnType(typeName string, dict bool) (arrow.DataType, appendFunc) {
+	switch typeName {
+	case "BIT":
+		return arrow.FixedWidthTypes.Boolean, func(b array.Builder, v driver.Value) bool {
+			x, ok := v.(bool)
+			if ok {
+				b.(*array.BooleanBuilder).Append(x)
+			}
+			return ok
+		}
+	case "TINYINT":
+		return arrow.PrimitiveTypes.Uint8, func(b array.Builder, v driver.Value) bool {
+			x, ok := v.(int64)
+			if ok {
+				b.(*array.Uint8Builder).Append(uint8(x))
+			}
+			return ok
+		}
+	case "SMALLINT":
+		return arrow.PrimitiveTypes.Int16, func(b array.Builder, v driver.Value) bool {
+			x, ok := v.(int64)
+			if ok {
+				b.(*array.Int16Builder).Append(int16(x))
+			}
+			return ok
+		}
+	case "INT":
+		return arrow.PrimitiveTypes.Int32, func(b array.Builder, v driver.Value) bool {
+			x, ok := v.(int64)
+			if ok {
+				b.(*array.Int32Builder).Append(int32(x))
+			}
+			return ok
+		}
+	case "BIGINT":
+		return arrow.PrimitiveTypes.Int64, func(b array.Builder, v driver.Value) bool {
+			x, ok := v.(int64)
+			if ok {
+				b.(*array.Int64Builder).Append(x)
+			}
+			return ok
+		}
+	case "REAL":
+		return arrow.PrimitiveTypes.Float32, func(b array.Builder, v driver.Value) bool {
+			switch x := v.(type) {
+			case float32:
+				b.(*array.Float32Builder).Append(x)
+			case float64:
+				b.(*array.Float32Builder).Append(float32(x))
+			default:
+				return false
+			}
+			return true
+		}
+	case "FLOAT":
+		return arrow.PrimitiveTypes.Float64, func(b array.Builder, v driver.Value) bool {
+			switch x := v.(type) {
+			case float64:
+				b.(*array.Float64Builder).Append(x)
+			case float32:
+				b.(*array.Float64Builder).Append(float64(x))
+			default:
+				return false
+			}
+			return true
+		}
+	case "DATE":
+		return arrow.FixedWidthTypes.Date32, func(b array.Builder, v driver.Value) bool {
+			t, ok := v.(time.Time)
+			if ok {
+				y, m, d := t.Date()
+				days := time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix() / (24 * 60 * 60)
+				b.(*array.Date32Builder).Append(arrow.Date32(days))
+			}
+			return ok
+		}
+	case "TIME":
+		return arrow.FixedWidthTypes.Time64ns, func(b array.Builder, v driver.Value) bool {
+			t, ok := v.(time.Time)
+			if ok {
+				h, m, s := t.Clock()
+				ns := (int64(h)*3600+int64(m)*60+int64(s))*int64(time.Second) + int64(t.Nanosecond())
+				b.(*array.Time64Builder).Append(arrow.Time64(ns))
+			}
+			return ok
+		}
+	case "SMALLDATETIME", "DATETIME", "DATETIME2":
+		// The values have no time zone: their wall clock is kept.
+		return &arrow.TimestampType{Unit: arrow.Microsecond}, func(b array.Builder, v driver.Value) bool {
+			t, ok := v.(time.Time)
+			if ok {
+				wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), time.UTC)
+				b.(*array.TimestampBuilder).Append(arrow.Timestamp(wall.UnixMicro()))
+			}
+			return ok
+		}
+	case "DATETIMEOFFSET":
+		return &arrow.TimestampType{Unit: arrow.Microsecond, TimeZone: "UTC"}, func(b array.Builder, v driver.Value) bool {
+			t, ok := v.(time.Time)
+			if ok {
+				b.(*array.TimestampBuilder).Append(arrow.Timestamp(t.UnixMicro()))
+			}
+			return ok
+		}
+	case "UNIQUEIDENTIFIER":
+		return &arrow.FixedSizeBinaryType{ByteWidth: 16}, func(b array.Builder, v driver.Value) bool {
+			x, ok := v.([]byte)
+			if ok = ok && len(x) == 16; ok {
+				b.(*array.FixedSizeBinaryBuilder).Append(x)
+			}
+			return ok
+		}
+	case "BINARY", "VARBINARY", "IMAGE":
+		return arrow.BinaryTypes.Binary, func(b array.Builder, v driver.Value) bool {
+			x, ok := v.([]byte)
+			if ok {
+				b.(*array.BinaryBuilder).Append(x)
+			}
+			return ok
+		}
+	case "CHAR", "VARCHAR", "NCHAR", "NVARCHAR", "TEXT", "NTEXT", "XML":
+		if dict {
+			typ := &arrow.DictionaryType{IndexType: arrow.PrimitiveTypes.Int32, ValueType: arrow.BinaryTypes.String}
+			return typ, func(b array.Builder, v driver.Value) bool {
+				x, ok := v.(string)
+				if ok {
+					ok = b.(*array.BinaryDictionaryBuilder).AppendString(x) == nil
+				}
+				return ok
+			}
+		}
+	}
+	return arrow.BinaryTypes.String, func(b array.Builder, v driver.Value) bool {
+		switch x := v.(type) {
+		case string:
+			b.(*array.StringBuilder).Append(x)
+		case []byte:
+			b.(*array.StringBuilder).BinaryBuilder.Append(x)
+		default:
+			b.(*array.StringBuilder).Append(fmt.Sprint(x))
+		}
+		return true
+	}
+}
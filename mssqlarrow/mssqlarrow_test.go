@@ -0,0 +1,145 @@
+package mssqlarrow
+
+import (
+	"database/sql/driver"
+	"testing"
+	"time"
+
+	"github.com/apache/arrow-go/v18/arrow"
+	"github.com/apache/arrow-go/v18/arrow/array"
+	"github.com/apache/arrow-go/v18/arrow/memory"
+	mssql "github.com/microsoft/go-mssqldb"
+)
+
+func TestWriter(t *testing.T) {
+	mem := memory.NewCheckedAllocator(memory.NewGoAllocator())
+	defer mem.AssertSize(t, 0)
+
+	var records []arrow.Record
+	w := NewWriter(Options{BatchSize: 2, DictionaryColumns: []string{"City"}, Allocator: mem}, func(rec arrow.Record) error {
+		rec.Retain()
+		records = append(records, rec)
+		return nil
+	})
+	defer w.Release()
+	defer func() {
+		for _, rec := range records {
+			rec.Release()
+		}
+	}()
+
+	cols := []mssql.CopyOutColumn{
+		{Name: "id", DatabaseTypeName: "INT"},
+		{Name: "price", DatabaseTypeName: "DECIMAL", Nullable: true},
+		{Name: "ratio", DatabaseTypeName: "REAL"},
+		{Name: "at", DatabaseTypeName: "DATETIME2"},
+		{Name: "city", DatabaseTypeName: "NVARCHAR", Nullable: true},
+	}
+	if err := w.WriteColumns(cols); err != nil {
+		t.Fatal(err)
+	}
+	at := time.Date(2024, 5, 6, 7, 8, 9, 123456789, time.UTC)
+	rows := [][]driver.Value{
+		{int64(1), []byte("12.50"), float32(0.5), at, "Oslo"},
+		{int64(2), nil, float32(1.5), at, "Oslo"},
+		{int64(3), []byte("7.00"), float32(2), at, nil},
+	}
+	for _, row := range rows {
+		if err := w.WriteRow(row); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(records) != 2 || records[0].NumRows() != 2 || records[1].NumRows() != 1 {
+		t.Fatalf("got %d records, want 2 of 2 and 1 rows", len(records))
+	}
+	schema := w.Schema()
+	wantTypes := []arrow.DataType{
+		arrow.PrimitiveTypes.Int32,
+		arrow.BinaryTypes.String,
+		arrow.PrimitiveTypes.Float32,
+		&arrow.TimestampType{Unit: arrow.Microsecond},
+		&arrow.DictionaryType{IndexType: arrow.PrimitiveTypes.Int32, ValueType: arrow.BinaryTypes.String},
+	}
+	for i, want := range wantTypes {
+		if got := schema.Field(i).Type; !arrow.TypeEqual(got, want) {
+			t.Errorf("column %d is %s, want %s", i, got, want)
+		}
+	}
+	if typ, _ := schema.Field(1).Metadata.GetValue(TypeMetadataKey); typ != "DECIMAL" {
+		t.Errorf("metadata of price is %q, want DECIMAL", typ)
+	}
+
+	first := records[0]
+	if got := first.Column(0).(*array.Int32).Int32Values(); got[0] != 1 || got[1] != 2 {
+		t.Errorf("ids are %v", got)
+	}
+	price := first.Column(1).(*array.String)
+	if price.Value(0) != "12.50" || !price.IsNull(1) {
+		t.Errorf("prices are %v", price)
+	}
+	if got := first.Column(3).(*array.Timestamp).Value(0); got != arrow.Timestamp(at.UnixMicro()) {
+		t.Errorf("timestamp is %d, want %d", got, at.UnixMicro())
+	}
+	city := first.Column(4).(*array.Dictionary)
+	if city.Dictionary().Len() != 1 || city.GetValueIndex(0) != city.GetValueIndex(1) {
+		t.Errorf("cities are not dictionary encoded: %v", city)
+	}
+	if !records[1].Column(4).IsNull(0) {
+		t.Error("city of the last row is not null")
+	}
+}
+
+func TestWriterTypeMismatch(t *testing.T) {
+	w := NewWriter(Options{}, func(arrow.Record) error { return nil })
+	defer w.Release()
+	if err := w.WriteColumns([]mssql.CopyOutColumn{{Name: "id", DatabaseTypeName: "BIGINT"}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteRow([]driver.Value{"one"}); err == nil {
+		t.Error("WriteRow accepted a string for a bigint column")
+	}
+}
+
+func TestColumnTypeTimes(t *testing.T) {
+	mem := memory.NewCheckedAllocator(memory.NewGoAllocator())
+	defer mem.AssertSize(t, 0)
+
+	tm := time.Date(1, 1, 1, 13, 14, 15, 500, time.UTC)
+	day := time.Date(1969, 12, 31, 0, 0, 0, 0, time.UTC)
+	offset := time.Date(2024, 1, 2, 3, 4, 5, 0, time.FixedZone("", 2*60*60))
+	tests := []struct {
+		typeName string
+		value    time.Time
+		want     interface{}
+	}{
+		{"TIME", tm, arrow.Time64((13*3600+14*60+15)*int64(time.Second) + 500)},
+		{"DATE", day, arrow.Date32(-1)},
+		{"DATETIMEOFFSET", offset, arrow.Timestamp(offset.UnixMicro())},
+	}
+	for _, tt := range tests {
+		typ, appendValue := columnType(tt.typeName, false)
+		b := array.NewBuilder(mem, typ)
+		if !appendValue(b, tt.value) {
+			t.Fatalf("%s: value not appended", tt.typeName)
+		}
+		arr := b.NewArray()
+		var got interface{}
+		switch a := arr.(type) {
+		case *array.Time64:
+			got = a.Value(0)
+		case *array.Date32:
+			got = a.Value(0)
+		case *array.Timestamp:
+			got = a.Value(0)
+		}
+		if got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.typeName, got, tt.want)
+		}
+		arr.Release()
+		b.Release()
+	}
+}
@@ -0,0 +1,455 @@
+package mssqlgeo
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Serialization properties of the CLR format described in [MS-SSCLRT].
+const (
+	propHasZ        = 0x01
+	propHasM        = 0x02
+	propIsValid     = 0x04
+	propSinglePoint = 0x08
+	propSingleLine  = 0x10
+)
+
+// Figure attributes of serialization version 1.
+const (
+	figureInteriorRing = 0
+	figureStroke       = 1
+	figureExteriorRing = 2
+)
+
+type figure struct {
+	attribute byte
+	offset    int32
+}
+
+type shapeRecord struct {
+	parent int32
+	figure int32
+	typ    byte
+}
+
+var errShortCLR = errors.New("mssqlgeo: spatial value is too short")
+
+// clrReader reads the CLR serialization format.
+type clrReader struct {
+	b   []byte
+	pos int
+	err error
+}
+
+func (r *clrReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if len(r.b)-r.pos < n {
+		r.err = errShortCLR
+		return nil
+	}
+	b := r.b[r.pos : r.pos+n]
+	r.pos += n
+	return b
+}
+
+func (r *clrReader) byte() byte {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *clrReader) int32() int32 {
+	if b := r.next(4); b != nil {
+		return int32(binary.LittleEndian.Uint32(b))
+	}
+	return 0
+}
+
+func (r *clrReader) float64() float64 {
+	if b := r.next(8); b != nil {
+		return math.Float64frombits(binary.LittleEndian.Uint64(b))
+	}
+	return 0
+}
+
+// count reads a number of items each at least size bytes long.
+func (r *clrReader) count(size int) int {
+	n := r.int32()
+	if n < 0 || int(n) > (len(r.b)-r.pos)/size {
+		if r.err == nil {
+			r.err = errShortCLR
+		}
+		return 0
+	}
+	return int(n)
+}
+
+// deserialize parses the CLR serialization format of geometry and
+// geography values. Geography points are stored latitude first.
+func deserialize(b []byte, geography bool) (Geometry, error) {
+	r := clrReader{b: b}
+	var g Geometry
+	g.SRID = r.int32()
+	version := r.byte()
+	props := r.byte()
+	if r.err != nil {
+		return g, r.err
+	}
+	if version != 1 && version != 2 {
+		return g, fmt.Errorf("mssqlgeo: unknown serialization version %d", version)
+	}
+	g.HasZ = props&propHasZ != 0
+	g.HasM = props&propHasM != 0
+
+	var npoints int
+	switch {
+	case props&propSinglePoint != 0:
+		npoints = 1
+	case props&propSingleLine != 0:
+		npoints = 2
+	default:
+		npoints = r.count(16)
+	}
+	points := make([]Point, npoints)
+	for i := range points {
+		a, b := r.float64(), r.float64()
+		if geography {
+			points[i].X, points[i].Y = b, a
+		} else {
+			points[i].X, points[i].Y = a, b
+		}
+	}
+	if g.HasZ {
+		for i := range points {
+			points[i].Z = r.float64()
+		}
+	}
+	if g.HasM {
+		for i := range points {
+			points[i].M = r.float64()
+		}
+	}
+
+	var figures []figure
+	var shapes []shapeRecord
+	switch {
+	case props&propSinglePoint != 0:
+		figures = []figure{{figureStroke, 0}}
+		shapes = []shapeRecord{{-1, 0, typePoint}}
+	case props&propSingleLine != 0:
+		figures = []figure{{figureStroke, 0}}
+		shapes = []shapeRecord{{-1, 0, typeLineString}}
+	default:
+		figures = make([]figure, r.count(5))
+		for i := range figures {
+			figures[i].attribute = r.byte()
+			figures[i].offset = r.int32()
+			if version == 2 && figures[i].attribute > figureStroke {
+				// arcs and composite curves
+				return g, errors.New("mssqlgeo: curves are not supported")
+			}
+		}
+		shapes = make([]shapeRecord, r.count(9))
+		for i := range shapes {
+			shapes[i].parent = r.int32()
+			shapes[i].figure = r.int32()
+			shapes[i].typ = r.byte()
+		}
+		if version == 2 && r.err == nil && r.pos < len(r.b) {
+			if segments := r.int32(); segments != 0 {
+				return g, errors.New("mssqlgeo: curves are not supported")
+			}
+		}
+	}
+	if r.err != nil {
+		return g, r.err
+	}
+	if r.pos != len(r.b) {
+		return g, fmt.Errorf("mssqlgeo: %d unexpected bytes after spatial value", len(r.b)-r.pos)
+	}
+	if len(shapes) == 0 || shapes[0].parent != -1 {
+		return g, errors.New("mssqlgeo: spatial value has no shape")
+	}
+	d := clrDecoder{points: points, figures: figures, shapes: shapes}
+	var err error
+	g.Shape, err = d.shape(0)
+	return g, err
+}
+
+type clrDecoder struct {
+	points  []Point
+	figures []figure
+	shapes  []shapeRecord
+}
+
+// figureRange returns the figures of the shape at index i.
+func (d *clrDecoder) figureRange(i int) (int, int, error) {
+	start := int(d.shapes[i].figure)
+	if start < 0 {
+		return 0, 0, nil
+	}
+	end := len(d.figures)
+	for _, s := range d.shapes[i+1:] {
+		if s.figure >= 0 {
+			end = int(s.figure)
+			break
+		}
+	}
+	if start > end || end > len(d.figures) {
+		return 0, 0, errors.New("mssqlgeo: invalid figure offset")
+	}
+	return start, end, nil
+}
+
+// figurePoints returns the points of figure f.
+func (d *clrDecoder) figurePoints(f int) (LineString, error) {
+	start := int(d.figures[f].offset)
+	end := len(d.points)
+	if f+1 < len(d.figures) {
+		end = int(d.figures[f+1].offset)
+	}
+	if start < 0 || start > end || end > len(d.points) {
+		return nil, errors.New("mssqlgeo: invalid point offset")
+	}
+	return LineString(d.points[start:end:end]), nil
+}
+
+func (d *clrDecoder) shape(i int) (Shape, error) {
+	rec := d.shapes[i]
+	switch rec.typ {
+	case typePoint, typeLineString, typePolygon:
+		start, end, err := d.figureRange(i)
+		if err != nil {
+			return nil, err
+		}
+		var rings Polygon
+		for f := start; f < end; f++ {
+			ring, err := d.figurePoints(f)
+			if err != nil {
+				return nil, err
+			}
+			rings = append(rings, ring)
+		}
+		switch rec.typ {
+		case typePoint:
+			if len(rings) != 1 || len(rings[0]) != 1 {
+				return nil, errors.New("mssqlgeo: empty points are not supported")
+			}
+			return rings[0][0], nil
+		case typeLineString:
+			if len(rings) > 1 {
+				return nil, errors.New("mssqlgeo: line string with more than one figure")
+			}
+			if len(rings) == 0 {
+				return LineString{}, nil
+			}
+			return rings[0], nil
+		default:
+			if rings == nil {
+				rings = Polygon{}
+			}
+			return rings, nil
+		}
+	case typeMultiPoint, typeMultiLineString, typeMultiPolygon, typeGeometryCollection:
+		var children []Shape
+		for j := i + 1; j < len(d.shapes); j++ {
+			if int(d.shapes[j].parent) != i {
+				continue
+			}
+			child, err := d.shape(j)
+			if err != nil {
+				return nil, err
+			}
+			children = append(children, child)
+		}
+		return collect(rec.typ, children)
+	default:
+		return nil, fmt.Errorf("mssqlgeo: shape type %d is not supported", rec.typ)
+	}
+}
+
+// collect builds a collection of type typ from its members.
+func collect(typ byte, members []Shape) (Shape, error) {
+	switch typ {
+	case typeMultiPoint:
+		c := MultiPoint{}
+		for _, m := range members {
+			p, ok := m.(Point)
+			if !ok {
+				return nil, fmt.Errorf("mssqlgeo: %T in MULTIPOINT", m)
+			}
+			c = append(c, p)
+		}
+		return c, nil
+	case typeMultiLineString:
+		c := MultiLineString{}
+		for _, m := range members {
+			l, ok := m.(LineString)
+			if !ok {
+				return nil, fmt.Errorf("mssqlgeo: %T in MULTILINESTRING", m)
+			}
+			c = append(c, l)
+		}
+		return c, nil
+	case typeMultiPolygon:
+		c := MultiPolygon{}
+		for _, m := range members {
+			p, ok := m.(Polygon)
+			if !ok {
+				return nil, fmt.Errorf("mssqlgeo: %T in MULTIPOLYGON", m)
+			}
+			c = append(c, p)
+		}
+		return c, nil
+	default:
+		return append(GeometryCollection{}, members...), nil
+	}
+}
+
+// clrEncoder flattens shapes into the points, figures and shapes of the
+// CLR serialization format.
+type clrEncoder struct {
+	points  []Point
+	figures []figure
+	shapes  []shapeRecord
+}
+
+func (e *clrEncoder) addFigure(attribute byte, points []Point) {
+	e.figures = append(e.figures, figure{attribute, int32(len(e.points))})
+	e.points = append(e.points, points...)
+}
+
+func (e *clrEncoder) add(s Shape, parent int32) error {
+	if s == nil {
+		return errors.New("mssqlgeo: nil shape")
+	}
+	index := len(e.shapes)
+	e.shapes = append(e.shapes, shapeRecord{parent: parent, figure: -1, typ: s.shapeType()})
+	firstFigure := len(e.figures)
+	var err error
+	switch v := s.(type) {
+	case Point:
+		e.addFigure(figureStroke, []Point{v})
+	case LineString:
+		if len(v) > 0 {
+			e.addFigure(figureStroke, v)
+		}
+	case Polygon:
+		for i, ring := range v {
+			if i == 0 {
+				e.addFigure(figureExteriorRing, ring)
+			} else {
+				e.addFigure(figureInteriorRing, ring)
+			}
+		}
+	case MultiPoint:
+		for _, p := range v {
+			if err = e.add(p, int32(index)); err != nil {
+				return err
+			}
+		}
+	case MultiLineString:
+		for _, l := range v {
+			if err = e.add(l, int32(index)); err != nil {
+				return err
+			}
+		}
+	case MultiPolygon:
+		for _, p := range v {
+			if err = e.add(p, int32(index)); err != nil {
+				return err
+			}
+		}
+	case GeometryCollection:
+		for _, m := range v {
+			if err = e.add(m, int32(index)); err != nil {
+				return err
+			}
+		}
+	default:
+		return fmt.Errorf("mssqlgeo: unsupported shape %T", s)
+	}
+	if len(e.figures) > firstFigure {
+		e.shapes[index].figure = int32(firstFigure)
+	}
+	return nil
+}
+
+// serialize encodes g in the CLR serialization format, version 1.
+func serialize(g Geometry, geography bool) ([]byte, error) {
+	var e clrEncoder
+	if err := e.add(g.Shape, -1); err != nil {
+		return nil, err
+	}
+	props := byte(propIsValid)
+	if g.HasZ {
+		props |= propHasZ
+	}
+	if g.HasM {
+		props |= propHasM
+	}
+	single := false
+	switch v := g.Shape.(type) {
+	case Point:
+		props |= propSinglePoint
+		single = true
+	case LineString:
+		if len(v) == 2 {
+			props |= propSingleLine
+			single = true
+		}
+	}
+
+	b := make([]byte, 0, 6+len(e.points)*32+len(e.figures)*5+len(e.shapes)*9+12)
+	b = appendInt32(b, g.SRID)
+	b = append(b, 1, props)
+	if !single {
+		b = appendInt32(b, int32(len(e.points)))
+	}
+	for _, p := range e.points {
+		if geography {
+			b = appendFloat64(appendFloat64(b, p.Y), p.X)
+		} else {
+			b = appendFloat64(appendFloat64(b, p.X), p.Y)
+		}
+	}
+	if g.HasZ {
+		for _, p := range e.points {
+			b = appendFloat64(b, p.Z)
+		}
+	}
+	if g.HasM {
+		for _, p := range e.points {
+			b = appendFloat64(b, p.M)
+		}
+	}
+	if single {
+		return b, nil
+	}
+	b = appendInt32(b, int32(len(e.figures)))
+	for _, f := range e.figures {
+		b = appendInt32(append(b, f.attribute), f.offset)
+	}
+	b = appendInt32(b, int32(len(e.shapes)))
+	for _, s := range e.shapes {
+		b = append(appendInt32(appendInt32(b, s.parent), s.figure), s.typ)
+	}
+	return b, nil
+}
+
+func appendInt32(b []byte, v int32) []byte {
+	var buf [4]byte
+	binary.LittleEndian.PutUint32(buf[:], uint32(v))
+	return append(b, buf[:]...)
+}
+
+func appendFloat64(b []byte, v float64) []byte {
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], math.Float64bits(v))
+	return append(b, buf[:]...)
+}
@@ -0,0 +1,184 @@
+// Package mssqlgeo reads and writes the SQL Server geometry and geography
+// types.
+//
+// Geometry and Geography values scan from spatial columns, which the driver
+// returns in the CLR serialization format of SQL Server, and from the results
+// of STAsText and STAsBinary. As parameters they are sent in the CLR
+// serialization format, which SQL Server converts to the spatial type of the
+// column or variable it is assigned to.
+//
+// Curves, such as CIRCULARSTRING or CURVEPOLYGON, are not supported.
+package mssqlgeo
+
+import (
+	"database/sql/driver"
+	"fmt"
+)
+
+// DefaultGeographySRID is the SRID sent for a Geography without one, WGS 84.
+const DefaultGeographySRID = 4326
+
+// Shape is one of Point, LineString, Polygon, MultiPoint, MultiLineString,
+// MultiPolygon and GeometryCollection.
+type Shape interface {
+	shapeType() byte
+}
+
+// Point is a position. For geography values X is the longitude and Y is
+// the latitude. Z and M are only meaningful when the value has them.
+type Point struct {
+	X, Y, Z, M float64
+}
+
+// LineString is a sequence of points.
+type LineString []Point
+
+// Polygon is an exterior ring followed by any number of interior rings.
+// Each ring is closed, its last point is equal to its first point.
+type Polygon []LineString
+
+// MultiPoint is a collection of points.
+type MultiPoint []Point
+
+// MultiLineString is a collection of line strings.
+type MultiLineString []LineString
+
+// MultiPolygon is a collection of polygons.
+type MultiPolygon []Polygon
+
+// GeometryCollection is a collection of shapes of any type.
+type GeometryCollection []Shape
+
+// OpenGIS type codes, used by both the CLR serialization and WKB.
+const (
+	typePoint              = 1
+	typeLineString         = 2
+	typePolygon            = 3
+	typeMultiPoint         = 4
+	typeMultiLineString    = 5
+	typeMultiPolygon       = 6
+	typeGeometryCollection = 7
+)
+
+func (Point) shapeType() byte              { return typePoint }
+func (LineString) shapeType() byte         { return typeLineString }
+func (Polygon) shapeType() byte            { return typePolygon }
+func (MultiPoint) shapeType() byte         { return typeMultiPoint }
+func (MultiLineString) shapeType() byte    { return typeMultiLineString }
+func (MultiPolygon) shapeType() byte       { return typeMultiPolygon }
+func (GeometryCollection) shapeType() byte { return typeGeometryCollection }
+
+// Geometry is a value of the geometry type.
+type Geometry struct {
+	SRID  int32
+	Shape Shape
+	// HasZ and HasM tell whether the points have Z and M values.
+	HasZ bool
+	HasM bool
+}
+
+// Geography is a value of the geography type. Its points hold the
+// longitude in X and the latitude in Y, in the order used by WKT.
+type Geography Geometry
+
+// ParseWKT parses a value in the well-known text format, as returned by
+// STAsText. Z and M values can be given as extra coordinates, as SQL Server
+// writes them, or with the Z, M and ZM tags. The SRID of the result is zero.
+func ParseWKT(s string) (Geometry, error) {
+	p := wktParser{s: s}
+	return p.parse()
+}
+
+// ParseWKB parses a value in the well-known binary format, as returned by
+// STAsBinary. The SRID of the result is zero.
+func ParseWKB(b []byte) (Geometry, error) {
+	r := wkbReader{b: b}
+	return r.parse()
+}
+
+// WKT formats g in the well-known text format, the way STAsText does.
+func (g Geometry) WKT() string {
+	return formatWKT(g)
+}
+
+// WKB encodes g in the little-endian well-known binary format.
+func (g Geometry) WKB() []byte {
+	return appendWKB(nil, g)
+}
+
+// String returns the well-known text of g.
+func (g Geometry) String() string {
+	return g.WKT()
+}
+
+// Scan implements the sql.Scanner interface. It accepts the CLR
+// serialization format of geometry columns, well-known binary and
+// well-known text. Scanning well-known text or binary leaves SRID unchanged.
+func (g *Geometry) Scan(src interface{}) error {
+	return scan(g, src, false)
+}
+
+// Value implements the driver.Valuer interface. The value is sent in the
+// CLR serialization format, as a varbinary that converts to geometry.
+func (g Geometry) Value() (driver.Value, error) {
+	return serialize(g, false)
+}
+
+// WKT formats g in the well-known text format, the way STAsText does.
+func (g Geography) WKT() string {
+	return formatWKT(Geometry(g))
+}
+
+// WKB encodes g in the little-endian well-known binary format.
+func (g Geography) WKB() []byte {
+	return appendWKB(nil, Geometry(g))
+}
+
+// String returns the well-known text of g.
+func (g Geography) String() string {
+	return g.WKT()
+}
+
+// Scan implements the sql.Scanner interface. It accepts the CLR
+// serialization format of geography columns, well-known binary and
+// well-known text. Scanning well-known text or binary leaves SRID unchanged.
+func (g *Geography) Scan(src interface{}) error {
+	return scan((*Geometry)(g), src, true)
+}
+
+// Value implements the driver.Valuer interface. The value is sent in the
+// CLR serialization format, as a varbinary that converts to geography.
+// A zero SRID is sent as DefaultGeographySRID.
+func (g Geography) Value() (driver.Value, error) {
+	if g.SRID == 0 {
+		g.SRID = DefaultGeographySRID
+	}
+	return serialize(Geometry(g), true)
+}
+
+func scan(g *Geometry, src interface{}, geography bool) error {
+	var (
+		parsed Geometry
+		err    error
+	)
+	switch v := src.(type) {
+	case []byte:
+		if parsed, err = deserialize(v, geography); err == nil {
+			*g = parsed
+			return nil
+		}
+		if wkb, wkbErr := ParseWKB(v); wkbErr == nil {
+			parsed, err = wkb, nil
+		}
+	case string:
+		parsed, err = ParseWKT(v)
+	default:
+		return fmt.Errorf("mssqlgeo: cannot scan %T", src)
+	}
+	if err != nil {
+		return err
+	}
+	parsed.SRID = g.SRID
+	*g = parsed
+	return nil
+}
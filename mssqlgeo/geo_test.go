@@ -0,0 +1,222 @@
+package mssqlgeo
+
+import (
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+)
+
+func mustHex(t *testing.T, s string) []byte {
+	t.Helper()
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestSerializeKnownValues(t *testing.T) {
+	tests := []struct {
+		name      string
+		g         Geometry
+		geography bool
+		want      string
+	}{
+		{
+			// select geometry::Point(1, 2, 0)
+			"point", Geometry{Shape: Point{X: 1, Y: 2}}, false,
+			"00000000010c000000000000f03f0000000000000040",
+		},
+		{
+			// select geography::Point(47.651, -122.349, 4326)
+			"geography point", Geometry{SRID: 4326, Shape: Point{X: -122.349, Y: 47.651}}, true,
+			"e6100000010c17d9cef753d347407593180456965ec0",
+		},
+		{
+			// select geometry::STGeomFromText('LINESTRING (1 1, 2 4, 3 9)', 0)
+			"line string", Geometry{Shape: LineString{{X: 1, Y: 1}, {X: 2, Y: 4}, {X: 3, Y: 9}}}, false,
+			"00000000010403000000000000000000f03f000000000000f03f0000000000000040000000000000104000000000000008400000000000002240" +
+				"01000000010000000001000000ffffffff0000000002",
+		},
+	}
+	for _, tst := range tests {
+		got, err := serialize(tst.g, tst.geography)
+		if err != nil {
+			t.Errorf("%s: %v", tst.name, err)
+			continue
+		}
+		if hex.EncodeToString(got) != tst.want {
+			t.Errorf("%s: got %x, want %s", tst.name, got, tst.want)
+		}
+		back, err := deserialize(got, tst.geography)
+		if err != nil {
+			t.Errorf("%s: deserialize failed: %v", tst.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(back, tst.g) {
+			t.Errorf("%s: deserialized %#v, want %#v", tst.name, back, tst.g)
+		}
+	}
+}
+
+func TestWKTRoundTrip(t *testing.T) {
+	tests := []string{
+		"POINT (1 2)",
+		"POINT (1.5 -2.25 3)",
+		"POINT (1 2 NULL 4)",
+		"POINT (1 2 3 4)",
+		"LINESTRING (0 0, 1 1)",
+		"LINESTRING EMPTY",
+		"POLYGON ((0 0, 10 0, 10 10, 0 10, 0 0), (2 2, 3 2, 3 3, 2 2))",
+		"MULTIPOINT ((1 2), (3 4))",
+		"MULTILINESTRING ((0 0, 1 1), (2 2, 3 3, 4 4))",
+		"MULTIPOLYGON (((0 0, 1 0, 1 1, 0 0)), ((5 5, 6 5, 6 6, 5 5)))",
+		"GEOMETRYCOLLECTION (POINT (1 2), LINESTRING EMPTY, POLYGON ((0 0, 1 0, 1 1, 0 0)), MULTIPOINT ((7 8)))",
+		"GEOMETRYCOLLECTION EMPTY",
+	}
+	for _, wkt := range tests {
+		g, err := ParseWKT(wkt)
+		if err != nil {
+			t.Errorf("ParseWKT(%q) failed: %v", wkt, err)
+			continue
+		}
+		if got := g.WKT(); got != wkt {
+			t.Errorf("ParseWKT(%q).WKT() = %q", wkt, got)
+		}
+		clr, err := g.Value()
+		if err != nil {
+			t.Errorf("Value of %q failed: %v", wkt, err)
+			continue
+		}
+		var back Geometry
+		if err := back.Scan(clr); err != nil {
+			t.Errorf("Scan of %q failed: %v", wkt, err)
+			continue
+		}
+		if !reflect.DeepEqual(back, g) {
+			t.Errorf("CLR round trip of %q: got %#v, want %#v", wkt, back, g)
+		}
+		wkb, err := ParseWKB(g.WKB())
+		if err != nil {
+			t.Errorf("ParseWKB of %q failed: %v", wkt, err)
+			continue
+		}
+		if !reflect.DeepEqual(wkb, g) {
+			t.Errorf("WKB round trip of %q: got %#v, want %#v", wkt, wkb, g)
+		}
+	}
+}
+
+func TestParseWKTVariants(t *testing.T) {
+	tests := []struct {
+		wkt  string
+		want string
+	}{
+		{"point(1 2)", "POINT (1 2)"},
+		{"POINT Z (1 2 3)", "POINT (1 2 3)"},
+		{"POINT M (1 2 3)", "POINT (1 2 NULL 3)"},
+		{"POINT ZM (1 2 3 4)", "POINT (1 2 3 4)"},
+		{"MULTIPOINT (1 2, 3 4)", "MULTIPOINT ((1 2), (3 4))"},
+		{" LINESTRING ( 1 2 ,3 4 ) ", "LINESTRING (1 2, 3 4)"},
+	}
+	for _, tst := range tests {
+		g, err := ParseWKT(tst.wkt)
+		if err != nil {
+			t.Errorf("ParseWKT(%q) failed: %v", tst.wkt, err)
+			continue
+		}
+		if got := g.WKT(); got != tst.want {
+			t.Errorf("ParseWKT(%q).WKT() = %q, want %q", tst.wkt, got, tst.want)
+		}
+	}
+	for _, wkt := range []string{
+		"",
+		"CIRCULARSTRING (0 0, 1 1, 2 0)",
+		"POINT (1)",
+		"POINT (1 2",
+		"POINT (1 2) x",
+		"POINT EMPTY",
+		"LINESTRING (1 2, 3 4 5)",
+		"POINT (a b)",
+	} {
+		if _, err := ParseWKT(wkt); err == nil {
+			t.Errorf("ParseWKT(%q) should fail", wkt)
+		}
+	}
+}
+
+func TestParseWKBBigEndian(t *testing.T) {
+	// POINT (1 2) in big-endian WKB
+	b := mustHex(t, "00000000013ff00000000000004000000000000000")
+	g, err := ParseWKB(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.WKT() != "POINT (1 2)" {
+		t.Errorf("got %s", g)
+	}
+	// POINT Z (1 2 3) with the EWKB flag
+	b = mustHex(t, "0101000080000000000000f03f00000000000000400000000000000840")
+	g, err = ParseWKB(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.WKT() != "POINT (1 2 3)" {
+		t.Errorf("got %s", g)
+	}
+	if _, err = ParseWKB(b[:10]); err == nil {
+		t.Error("truncated WKB should fail")
+	}
+}
+
+func TestGeographyScanAndValue(t *testing.T) {
+	clr := mustHex(t, "e6100000010c17d9cef753d347407593180456965ec0")
+	var g Geography
+	if err := g.Scan(clr); err != nil {
+		t.Fatal(err)
+	}
+	if g.SRID != 4326 || g.WKT() != "POINT (-122.349 47.651)" {
+		t.Errorf("got SRID %d %s", g.SRID, g)
+	}
+
+	g = Geography{}
+	if err := g.Scan("POINT (-122.349 47.651)"); err != nil {
+		t.Fatal(err)
+	}
+	v, err := g.Value()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(v.([]byte), clr) {
+		t.Errorf("a zero SRID should be sent as 4326, got %x", v)
+	}
+
+	var geom Geometry
+	geom.SRID = 3857
+	if err := geom.Scan(Geometry{Shape: Point{X: 1, Y: 2}}.WKB()); err != nil {
+		t.Fatal(err)
+	}
+	if geom.SRID != 3857 || geom.WKT() != "POINT (1 2)" {
+		t.Errorf("scanning WKB got SRID %d %s", geom.SRID, geom)
+	}
+	if err := geom.Scan(42); err == nil {
+		t.Error("scanning an int should fail")
+	}
+}
+
+func TestDeserializeErrors(t *testing.T) {
+	tests := map[string]string{
+		"short":    "00000000010c000000000000f03f",
+		"version":  "00000000030c000000000000f03f0000000000000040",
+		"trailing": "00000000010c000000000000f03f000000000000004000",
+		// version 2 CIRCULARSTRING (0 0, 1 1, 2 0) with an arc figure
+		"curve": "0000000002040300000000000000000000000000000000000000000000000000f03f000000000000f03f0000000000000040" +
+			"000000000000000001000000020000000001000000ffffffff000000000800000000",
+	}
+	for name, h := range tests {
+		if _, err := deserialize(mustHex(t, h), false); err == nil {
+			t.Errorf("%s: deserialize should fail", name)
+		}
+	}
+}
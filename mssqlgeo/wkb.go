@@ -0,0 +1,268 @@
+package mssqlgeo
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+)
+
+// Flags of extended WKB, as written by PostGIS, next to the ISO type
+// offsets of 1000 for Z, 2000 for M and 3000 for ZM.
+const (
+	ewkbZ = 0x80000000
+	ewkbM = 0x40000000
+)
+
+var errShortWKB = errors.New("mssqlgeo: WKB value is too short")
+
+func appendWKB(b []byte, g Geometry) []byte {
+	if g.Shape == nil {
+		g.Shape = GeometryCollection{}
+	}
+	w := wkbWriter{hasZ: g.HasZ, hasM: g.HasM}
+	return w.shape(b, g.Shape)
+}
+
+type wkbWriter struct {
+	hasZ, hasM bool
+}
+
+func (w wkbWriter) header(b []byte, typ byte) []byte {
+	code := uint32(typ)
+	if w.hasZ {
+		code += 1000
+	}
+	if w.hasM {
+		code += 2000
+	}
+	return appendInt32(append(b, 1), int32(code))
+}
+
+func (w wkbWriter) point(b []byte, p Point) []byte {
+	b = appendFloat64(appendFloat64(b, p.X), p.Y)
+	if w.hasZ {
+		b = appendFloat64(b, p.Z)
+	}
+	if w.hasM {
+		b = appendFloat64(b, p.M)
+	}
+	return b
+}
+
+func (w wkbWriter) points(b []byte, l []Point) []byte {
+	b = appendInt32(b, int32(len(l)))
+	for _, p := range l {
+		b = w.point(b, p)
+	}
+	return b
+}
+
+func (w wkbWriter) shape(b []byte, s Shape) []byte {
+	b = w.header(b, s.shapeType())
+	switch v := s.(type) {
+	case Point:
+		b = w.point(b, v)
+	case LineString:
+		b = w.points(b, v)
+	case Polygon:
+		b = appendInt32(b, int32(len(v)))
+		for _, ring := range v {
+			b = w.points(b, ring)
+		}
+	case MultiPoint:
+		b = appendInt32(b, int32(len(v)))
+		for _, p := range v {
+			b = w.shape(b, p)
+		}
+	case MultiLineString:
+		b = appendInt32(b, int32(len(v)))
+		for _, l := range v {
+			b = w.shape(b, l)
+		}
+	case MultiPolygon:
+		b = appendInt32(b, int32(len(v)))
+		for _, p := range v {
+			b = w.shape(b, p)
+		}
+	case GeometryCollection:
+		b = appendInt32(b, int32(len(v)))
+		for _, m := range v {
+			b = w.shape(b, m)
+		}
+	}
+	return b
+}
+
+// wkbReader parses well-known binary in either byte order.
+type wkbReader struct {
+	b          []byte
+	pos        int
+	order      binary.ByteOrder
+	dims       int
+	hasZ, hasM bool
+}
+
+func (r *wkbReader) next(n int) ([]byte, error) {
+	if len(r.b)-r.pos < n {
+		return nil, errShortWKB
+	}
+	b := r.b[r.pos : r.pos+n]
+	r.pos += n
+	return b, nil
+}
+
+func (r *wkbReader) uint32() (uint32, error) {
+	b, err := r.next(4)
+	if err != nil {
+		return 0, err
+	}
+	return r.order.Uint32(b), nil
+}
+
+// count reads a number of items each at least size bytes long.
+func (r *wkbReader) count(size int) (int, error) {
+	n, err := r.uint32()
+	if err != nil {
+		return 0, err
+	}
+	if int64(n) > int64(len(r.b)-r.pos)/int64(size) {
+		return 0, errShortWKB
+	}
+	return int(n), nil
+}
+
+func (r *wkbReader) parse() (Geometry, error) {
+	s, err := r.shape()
+	if err != nil {
+		return Geometry{}, err
+	}
+	if r.pos != len(r.b) {
+		return Geometry{}, fmt.Errorf("mssqlgeo: %d unexpected bytes after WKB value", len(r.b)-r.pos)
+	}
+	return Geometry{Shape: s, HasZ: r.hasZ, HasM: r.hasM}, nil
+}
+
+// header reads the byte order and type of a shape.
+func (r *wkbReader) header() (byte, error) {
+	b, err := r.next(1)
+	if err != nil {
+		return 0, err
+	}
+	switch b[0] {
+	case 0:
+		r.order = binary.BigEndian
+	case 1:
+		r.order = binary.LittleEndian
+	default:
+		return 0, fmt.Errorf("mssqlgeo: invalid WKB byte order %d", b[0])
+	}
+	code, err := r.uint32()
+	if err != nil {
+		return 0, err
+	}
+	hasZ := code&ewkbZ != 0
+	hasM := code&ewkbM != 0
+	code &^= ewkbZ | ewkbM
+	switch code / 1000 {
+	case 1:
+		hasZ = true
+	case 2:
+		hasM = true
+	case 3:
+		hasZ, hasM = true, true
+	}
+	typ := code % 1000
+	if typ < typePoint || typ > typeGeometryCollection || code/1000 > 3 {
+		return 0, fmt.Errorf("mssqlgeo: WKB type %d is not supported", code)
+	}
+	dims := 2
+	if hasZ {
+		dims++
+	}
+	if hasM {
+		dims++
+	}
+	if r.dims == 0 {
+		r.dims, r.hasZ, r.hasM = dims, hasZ, hasM
+	} else if r.hasZ != hasZ || r.hasM != hasM {
+		return 0, errors.New("mssqlgeo: WKB shapes with different dimensions")
+	}
+	return byte(typ), nil
+}
+
+func (r *wkbReader) point() (Point, error) {
+	b, err := r.next(8 * r.dims)
+	if err != nil {
+		return Point{}, err
+	}
+	coord := func(i int) float64 {
+		return math.Float64frombits(r.order.Uint64(b[8*i:]))
+	}
+	p := Point{X: coord(0), Y: coord(1)}
+	if r.hasZ {
+		p.Z = coord(2)
+	}
+	if r.hasM {
+		p.M = coord(r.dims - 1)
+	}
+	return p, nil
+}
+
+func (r *wkbReader) points() (LineString, error) {
+	n, err := r.count(8 * r.dims)
+	if err != nil {
+		return nil, err
+	}
+	l := make(LineString, n)
+	for i := range l {
+		if l[i], err = r.point(); err != nil {
+			return nil, err
+		}
+	}
+	return l, nil
+}
+
+func (r *wkbReader) shape() (Shape, error) {
+	typ, err := r.header()
+	if err != nil {
+		return nil, err
+	}
+	switch typ {
+	case typePoint:
+		p, err := r.point()
+		if err != nil {
+			return nil, err
+		}
+		if math.IsNaN(p.X) && math.IsNaN(p.Y) {
+			return nil, errors.New("mssqlgeo: empty points are not supported")
+		}
+		return p, nil
+	case typeLineString:
+		return r.points()
+	case typePolygon:
+		n, err := r.count(4)
+		if err != nil {
+			return nil, err
+		}
+		poly := make(Polygon, n)
+		for i := range poly {
+			if poly[i], err = r.points(); err != nil {
+				return nil, err
+			}
+		}
+		return poly, nil
+	default:
+		n, err := r.count(5)
+		if err != nil {
+			return nil, err
+		}
+		members := make([]Shape, n)
+		for i := range members {
+			if members[i], err = r.shape(); err != nil {
+				return nil, err
+			}
+		}
+		return collect(typ, members)
+	}
+}
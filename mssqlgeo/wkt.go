@@ -0,0 +1,340 @@
+package mssqlgeo
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var wktNames = map[byte]string{
+	typePoint:              "POINT",
+	typeLineString:         "LINESTRING",
+	typePolygon:            "POLYGON",
+	typeMultiPoint:         "MULTIPOINT",
+	typeMultiLineString:    "MULTILINESTRING",
+	typeMultiPolygon:       "MULTIPOLYGON",
+	typeGeometryCollection: "GEOMETRYCOLLECTION",
+}
+
+func formatWKT(g Geometry) string {
+	if g.Shape == nil {
+		return "GEOMETRYCOLLECTION EMPTY"
+	}
+	w := wktWriter{hasZ: g.HasZ, hasM: g.HasM}
+	w.shape(g.Shape)
+	return w.b.String()
+}
+
+type wktWriter struct {
+	b          strings.Builder
+	hasZ, hasM bool
+}
+
+func (w *wktWriter) shape(s Shape) {
+	w.b.WriteString(wktNames[s.shapeType()])
+	w.b.WriteByte(' ')
+	w.body(s)
+}
+
+// body writes s without its type name.
+func (w *wktWriter) body(s Shape) {
+	n := 0
+	var member func(i int)
+	switch v := s.(type) {
+	case Point:
+		w.b.WriteByte('(')
+		w.point(v)
+		w.b.WriteByte(')')
+		return
+	case LineString:
+		n, member = len(v), func(i int) { w.point(v[i]) }
+	case Polygon:
+		n, member = len(v), func(i int) { w.body(v[i]) }
+	case MultiPoint:
+		n, member = len(v), func(i int) { w.body(v[i]) }
+	case MultiLineString:
+		n, member = len(v), func(i int) { w.body(v[i]) }
+	case MultiPolygon:
+		n, member = len(v), func(i int) { w.body(v[i]) }
+	case GeometryCollection:
+		n, member = len(v), func(i int) { w.shape(v[i]) }
+	}
+	if n == 0 {
+		w.b.WriteString("EMPTY")
+		return
+	}
+	w.b.WriteByte('(')
+	for i := 0; i < n; i++ {
+		if i > 0 {
+			w.b.WriteString(", ")
+		}
+		member(i)
+	}
+	w.b.WriteByte(')')
+}
+
+func (w *wktWriter) point(p Point) {
+	w.number(p.X)
+	w.b.WriteByte(' ')
+	w.number(p.Y)
+	if w.hasZ {
+		w.b.WriteByte(' ')
+		w.number(p.Z)
+	} else if w.hasM {
+		w.b.WriteString(" NULL")
+	}
+	if w.hasM {
+		w.b.WriteByte(' ')
+		w.number(p.M)
+	}
+}
+
+func (w *wktWriter) number(f float64) {
+	w.b.WriteString(strconv.FormatFloat(f, 'f', -1, 64))
+}
+
+// wktParser parses well-known text.
+type wktParser struct {
+	s   string
+	pos int
+	// dims is the number of coordinates of the points, once known.
+	dims       int
+	hasZ, hasM bool
+}
+
+func (p *wktParser) parse() (Geometry, error) {
+	s, err := p.shape()
+	if err != nil {
+		return Geometry{}, err
+	}
+	if tok := p.next(); tok != "" {
+		return Geometry{}, p.errorf("unexpected %q after shape", tok)
+	}
+	return Geometry{Shape: s, HasZ: p.hasZ, HasM: p.hasM}, nil
+}
+
+func (p *wktParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("mssqlgeo: invalid WKT at offset %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+// next returns the next token: a word, a number, a parenthesis or a comma.
+func (p *wktParser) next() string {
+	for p.pos < len(p.s) && strings.IndexByte(" \t\r\n", p.s[p.pos]) >= 0 {
+		p.pos++
+	}
+	if p.pos == len(p.s) {
+		return ""
+	}
+	start := p.pos
+	if strings.IndexByte("(),", p.s[p.pos]) >= 0 {
+		p.pos++
+		return p.s[start:p.pos]
+	}
+	for p.pos < len(p.s) && strings.IndexByte(" \t\r\n(),", p.s[p.pos]) < 0 {
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+func (p *wktParser) peek() string {
+	pos := p.pos
+	tok := p.next()
+	p.pos = pos
+	return tok
+}
+
+func (p *wktParser) expect(tok string) error {
+	if got := p.next(); got != tok {
+		return p.errorf("expected %q, got %q", tok, got)
+	}
+	return nil
+}
+
+// shape parses a tagged shape such as POINT (1 2).
+func (p *wktParser) shape() (Shape, error) {
+	name := strings.ToUpper(p.next())
+	var typ byte
+	for t, n := range wktNames {
+		if n == name {
+			typ = t
+		}
+	}
+	if typ == 0 {
+		return nil, p.errorf("unknown shape %q", name)
+	}
+	switch strings.ToUpper(p.peek()) {
+	case "Z":
+		p.next()
+		p.setDims(3, true, false)
+	case "M":
+		p.next()
+		p.setDims(3, false, true)
+	case "ZM":
+		p.next()
+		p.setDims(4, true, true)
+	}
+	return p.body(typ)
+}
+
+func (p *wktParser) setDims(dims int, hasZ, hasM bool) {
+	p.dims, p.hasZ, p.hasM = dims, hasZ, hasM
+}
+
+// list parses an EMPTY or parenthesized, comma separated list of members.
+func (p *wktParser) list(member func() error) error {
+	if strings.ToUpper(p.peek()) == "EMPTY" {
+		p.next()
+		return nil
+	}
+	if err := p.expect("("); err != nil {
+		return err
+	}
+	for {
+		if err := member(); err != nil {
+			return err
+		}
+		switch tok := p.next(); tok {
+		case ",":
+		case ")":
+			return nil
+		default:
+			return p.errorf("expected \",\" or \")\", got %q", tok)
+		}
+	}
+}
+
+// body parses the shape of type typ after its name.
+func (p *wktParser) body(typ byte) (Shape, error) {
+	switch typ {
+	case typePoint:
+		var pts LineString
+		err := p.list(func() error {
+			if len(pts) > 0 {
+				return p.errorf("point with more than one position")
+			}
+			pt, err := p.point()
+			pts = append(pts, pt)
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(pts) == 0 {
+			return nil, p.errorf("empty points are not supported")
+		}
+		return pts[0], nil
+	case typeLineString:
+		return p.lineString()
+	case typePolygon:
+		return p.polygon()
+	case typeMultiPoint:
+		c := MultiPoint{}
+		err := p.list(func() error {
+			// both MULTIPOINT ((1 2), (3 4)) and MULTIPOINT (1 2, 3 4) are used
+			var pt Point
+			var err error
+			if p.peek() == "(" {
+				var s Shape
+				s, err = p.body(typePoint)
+				if err == nil {
+					pt = s.(Point)
+				}
+			} else {
+				pt, err = p.point()
+			}
+			c = append(c, pt)
+			return err
+		})
+		return c, err
+	case typeMultiLineString:
+		c := MultiLineString{}
+		err := p.list(func() error {
+			l, err := p.lineString()
+			c = append(c, l)
+			return err
+		})
+		return c, err
+	case typeMultiPolygon:
+		c := MultiPolygon{}
+		err := p.list(func() error {
+			poly, err := p.polygon()
+			c = append(c, poly)
+			return err
+		})
+		return c, err
+	default:
+		c := GeometryCollection{}
+		err := p.list(func() error {
+			s, err := p.shape()
+			c = append(c, s)
+			return err
+		})
+		return c, err
+	}
+}
+
+func (p *wktParser) lineString() (LineString, error) {
+	l := LineString{}
+	err := p.list(func() error {
+		pt, err := p.point()
+		l = append(l, pt)
+		return err
+	})
+	return l, err
+}
+
+func (p *wktParser) polygon() (Polygon, error) {
+	poly := Polygon{}
+	err := p.list(func() error {
+		l, err := p.lineString()
+		poly = append(poly, l)
+		return err
+	})
+	return poly, err
+}
+
+// point parses the coordinates of a position. Without a tag a third
+// coordinate is Z and a fourth is M. SQL Server writes positions with M
+// but no Z as X Y NULL M.
+func (p *wktParser) point() (Point, error) {
+	var coords [4]float64
+	var present [4]bool
+	n := 0
+	for n < 4 {
+		tok := p.peek()
+		if tok == "" || tok == "," || tok == ")" {
+			break
+		}
+		p.next()
+		if strings.ToUpper(tok) != "NULL" {
+			f, err := strconv.ParseFloat(tok, 64)
+			if err != nil {
+				return Point{}, p.errorf("invalid number %q", tok)
+			}
+			coords[n], present[n] = f, true
+		}
+		n++
+	}
+	if n < 2 || !present[0] || !present[1] {
+		return Point{}, p.errorf("a position needs X and Y")
+	}
+	if p.dims == 0 {
+		p.setDims(n, n > 2 && present[2], n > 3 && present[3])
+		if n == 3 && !present[2] {
+			return Point{}, p.errorf("NULL Z without M")
+		}
+	}
+	if n != p.dims {
+		return Point{}, p.errorf("positions have %d and %d coordinates", p.dims, n)
+	}
+	pt := Point{X: coords[0], Y: coords[1]}
+	switch {
+	case p.hasZ && p.hasM:
+		pt.Z, pt.M = coords[2], coords[3]
+	case p.hasZ:
+		pt.Z = coords[2]
+	case p.hasM:
+		pt.M = coords[n-1]
+	}
+	return pt, nil
+}
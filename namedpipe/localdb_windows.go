@@ -0,0 +1,151 @@
+package namedpipe
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"unsafe"
+
+	"golang.org/x/sys/windows"
+	"golang.org/x/sys/windows/registry"
+)
+
+// defaultLocalDBInstance is the automatic instance of LocalDB created
+// for each user, used when the server is just "(localdb)".
+const defaultLocalDBInstance = "MSSQLLocalDB"
+
+// localDBVersionsKey lists the installed versions of LocalDB, each with
+// the path of its instance API DLL.
+const localDBVersionsKey = `SOFTWARE\Microsoft\Microsoft SQL Server Local DB\Installed Versions`
+
+// maxLocalDBConnection is LOCALDB_MAX_SQLCONNECTION_BUFFER_SIZE, the size
+// of the buffer receiving the pipe name of an instance.
+const maxLocalDBConnection = 260
+
+// localDBData names the LocalDB instance of a "(localdb)\instance" server,
+// whose pipe is only known once the instance is started.
+type localDBData struct {
+	Instance string
+}
+
+// localDBPipe starts the LocalDB instance, unless it is running, and
+// returns the name of its pipe. It calls the instance API of the newest
+// version of LocalDB installed, and runs the sqllocaldb command line tool
+// when the API cannot be loaded.
+func localDBPipe(ctx context.Context, instance string) (string, error) {
+	pipe, err := localDBAPIPipe(instance)
+	if err == nil {
+		return pipe, nil
+	}
+	pipe, cliErr := localDBCLIPipe(ctx, instance)
+	if cliErr != nil {
+		return "", fmt.Errorf("unable to start LocalDB instance '%s': %v; sqllocaldb: %v", instance, err, cliErr)
+	}
+	return pipe, nil
+}
+
+// localDBAPIPipe starts instance with LocalDBStartInstance.
+func localDBAPIPipe(instance string) (string, error) {
+	path, err := localDBAPIPath()
+	if err != nil {
+		return "", err
+	}
+	dll, err := windows.LoadDLL(path)
+	if err != nil {
+		return "", err
+	}
+	defer dll.Release()
+	start, err := dll.FindProc("LocalDBStartInstance")
+	if err != nil {
+		return "", err
+	}
+	name, err := windows.UTF16PtrFromString(instance)
+	if err != nil {
+		return "", err
+	}
+	buf := make([]uint16, maxLocalDBConnection)
+	size := uint32(len(buf))
+	hr, _, _ := start.Call(uintptr(unsafe.Pointer(name)), 0, uintptr(unsafe.Pointer(&buf[0])), uintptr(unsafe.Pointer(&size)))
+	if int32(hr) < 0 {
+		return "", fmt.Errorf("LocalDBStartInstance failed with HRESULT 0x%08x", uint32(hr))
+	}
+	return trimPipeName(windows.UTF16ToString(buf)), nil
+}
+
+// localDBAPIPath returns the path of the instance API DLL of the newest
+// version of LocalDB installed.
+func localDBAPIPath() (string, error) {
+	k, err := registry.OpenKey(registry.LOCAL_MACHINE, localDBVersionsKey, registry.ENUMERATE_SUB_KEYS)
+	if err != nil {
+		return "", fmt.Errorf("LocalDB is not installed: %v", err)
+	}
+	defer k.Close()
+	versions, err := k.ReadSubKeyNames(-1)
+	if err != nil {
+		return "", err
+	}
+	newest := ""
+	for _, v := range versions {
+		if newest == "" || newerVersion(v, newest) {
+			newest = v
+		}
+	}
+	if newest == "" {
+		return "", fmt.Errorf("no version of LocalDB is installed")
+	}
+	vk, err := registry.OpenKey(k, newest, registry.QUERY_VALUE)
+	if err != nil {
+		return "", err
+	}
+	defer vk.Close()
+	path, _, err := vk.GetStringValue("InstanceAPIPath")
+	return path, err
+}
+
+// newerVersion reports whether the "major.minor" version a is newer than b.
+func newerVersion(a, b string) bool {
+	pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(pa) && i < len(pb); i++ {
+		na, _ := strconv.Atoi(pa[i])
+		nb, _ := strconv.Atoi(pb[i])
+		if na != nb {
+			return na > nb
+		}
+	}
+	return len(pa) > len(pb)
+}
+
+// localDBCLIPipe starts instance with sqllocaldb and reads its pipe name
+// from the information the tool prints about it.
+func localDBCLIPipe(ctx context.Context, instance string) (string, error) {
+	if out, err := exec.CommandContext(ctx, "sqllocaldb", "start", instance).CombinedOutput(); err != nil {
+		return "", fmt.Errorf("%v: %s", err, bytes.TrimSpace(out))
+	}
+	out, err := exec.CommandContext(ctx, "sqllocaldb", "info", instance).Output()
+	if err != nil {
+		return "", err
+	}
+	return parseLocalDBInfo(out)
+}
+
+// parseLocalDBInfo returns the pipe name in the output of sqllocaldb info,
+// the only value of the form np:\\.\pipe\... whatever the language of
+// the labels.
+func parseLocalDBInfo(out []byte) (string, error) {
+	s := bufio.NewScanner(bytes.NewReader(out))
+	for s.Scan() {
+		if i := strings.Index(s.Text(), `np:\\`); i >= 0 {
+			return trimPipeName(strings.TrimSpace(s.Text()[i:])), nil
+		}
+	}
+	return "", fmt.Errorf("no pipe name in the output of sqllocaldb info: the instance is not running")
+}
+
+// trimPipeName removes the np: prefix of the pipe names returned by LocalDB.
+func trimPipeName(pipe string) string {
+	return strings.TrimPrefix(pipe, "np:")
+}
@@ -0,0 +1,49 @@
+package namedpipe
+
+import (
+	"testing"
+
+	"github.com/microsoft/go-mssqldb/msdsn"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseLocalDBServer(t *testing.T) {
+	n := &namedPipeDialer{}
+	for server, instance := range map[string]string{
+		`(localdb)\MSSQLLocalDB`: "MSSQLLocalDB",
+		`(LocalDB)\projects`:     "projects",
+		`(localdb)`:              defaultLocalDBInstance,
+	} {
+		c := &msdsn.Config{
+			Host:               "(localdb)",
+			Parameters:         make(map[string]string),
+			ProtocolParameters: make(map[string]interface{}),
+		}
+		err := n.ParseServer(server, c)
+		assert.NoError(t, err, "ParseServer %s", server)
+		assert.Equal(t, instance, c.Instance, "Config Instance with server == %s", server)
+		assert.Equal(t, localDBData{Instance: instance}, c.ProtocolParameters[n.Protocol()], "ProtocolParameters with server == %s", server)
+		assert.False(t, n.CallBrowser(c), "LocalDB needs no browser")
+	}
+}
+
+func TestParseLocalDBInfo(t *testing.T) {
+	out := "Name:               MSSQLLocalDB\r\n" +
+		"Version:            15.0.4153.1\r\n" +
+		"Shared name:\r\n" +
+		"Owner:              DOMAIN\\user\r\n" +
+		"Auto-create:        Yes\r\n" +
+		"State:              Running\r\n" +
+		"Last start time:    5/1/2024 9:12:31 AM\r\n" +
+		"Instance pipe name: np:\\\\.\\pipe\\LOCALDB#5E3A1B2C\\tsql\\query\r\n"
+	pipe, err := parseLocalDBInfo([]byte(out))
+	assert.NoError(t, err)
+	assert.Equal(t, `\\.\pipe\LOCALDB#5E3A1B2C\tsql\query`, pipe)
+
+	_, err = parseLocalDBInfo([]byte("Name: MSSQLLocalDB\r\nState: Stopped\r\nInstance pipe name:\r\n"))
+	assert.Error(t, err, "a stopped instance has no pipe")
+
+	assert.True(t, newerVersion("15.0", "13.0"))
+	assert.True(t, newerVersion("16.0", "15.10"))
+	assert.False(t, newerVersion("11.0", "13.0"))
+}
@@ -30,6 +30,16 @@ func (n namedPipeDialer) ParseServer(server string, p *msdsn.Config) error {
 		p.ProtocolParameters[n.Protocol()] = namedPipeData{PipeName: server}
 		return nil
 	}
+	if parts := strings.SplitN(server, `\`, 2); msdsn.IsLocalDB(parts[0]) {
+		// The pipe of a LocalDB instance is only known once it is started.
+		p.Host = parts[0]
+		p.Instance = defaultLocalDBInstance
+		if len(parts) > 1 && parts[1] != "" {
+			p.Instance = parts[1]
+		}
+		p.ProtocolParameters[n.Protocol()] = localDBData{Instance: p.Instance}
+		return nil
+	}
 	pipeHost := "."
 	if p.Host == "" { // if the string specifies np:host\instance, tcpParser won't have filled in p.Host
 		parts := strings.SplitN(server, `\`, 2)
@@ -99,6 +109,17 @@ func (n namedPipeDialer) DialConnection(ctx context.Context, p *msdsn.Config) (c
 			p.ServerSPN = serverSPN
 		}
 		return
+	case localDBData:
+		pipe, err := localDBPipe(ctx, d.Instance)
+		if err != nil {
+			return nil, err
+		}
+		serverSPN := p.ServerSPN
+		conn, serverSPN, err = np.DialConnection(ctx, pipe, "localhost", d.Instance, serverSPN)
+		if err == nil && p.ServerSPN == "" {
+			p.ServerSPN = serverSPN
+		}
+		return conn, err
 	}
 	return nil, fmt.Errorf("Unexpected protocol data specified for connection: %v", reflect.TypeOf(data))
 }
@@ -0,0 +1,104 @@
+package mssql
+
+import "math"
+
+// stableDeclType returns the type declaring the parameter name of a
+// statement run with sp_executesql, for a value of type ti holding size
+// bytes. The server caches a plan for each distinct text of declarations,
+// so declaring each value by its own length, as nvarchar(3) then
+// nvarchar(4), fills the plan cache with copies of the same plan.
+//
+// The types declared by earlier runs of the statement are kept: a value of
+// the same type takes the widest length, precision and scale declared so
+// far, so declarations only change when a value does not fit them. The
+// lengths are also rounded up to buckets.
+func (s *Stmt) stableDeclType(name string, ti typeInfo, size int, buckets []int) typeInfo {
+	prev, ok := s.declTypes[name]
+	if ok && ti.TypeId == prev.TypeId {
+		switch ti.TypeId {
+		case typeBigVarChar, typeNVarChar, typeBigVarBin:
+			if size == 0 || declSize(prev) >= declSize(ti) {
+				return prev
+			}
+		case typeDecimalN, typeNumericN:
+			intDigits := maxUint8(prev.Prec-prev.Scale, ti.Prec-ti.Scale)
+			scale := maxUint8(prev.Scale, ti.Scale)
+			if int(intDigits)+int(scale) <= maxDecimalPrecision {
+				ti.Prec, ti.Scale = intDigits+scale, scale
+			}
+		}
+	} else if size == 0 && isVarLenType(ti.TypeId) {
+		// A zero length value, declared as max, does not tell the length
+		// of the next values.
+		return ti
+	}
+	ti = bucketDeclType(ti, buckets)
+	if s.declTypes == nil {
+		s.declTypes = make(map[string]typeInfo)
+	}
+	s.declTypes[name] = ti
+	return ti
+}
+
+// parameterSizeBuckets returns the lengths the parameters of a statement
+// run with opts are declared with: those of WithParameterSizeBuckets, else
+// those of Connector.ParameterSizeBuckets, else those of the connection
+// string.
+func (c *Conn) parameterSizeBuckets(opts queryOptions) []int {
+	if opts.hasSizeBuckets {
+		return opts.sizeBuckets
+	}
+	if c.connector == nil {
+		return nil
+	}
+	if c.connector.ParameterSizeBuckets != nil {
+		return c.connector.ParameterSizeBuckets
+	}
+	return c.connector.params.ParameterSizeBuckets
+}
+
+// declSize returns the length of the declaration of the variable length
+// type ti, in bytes, with the max types the longest.
+func declSize(ti typeInfo) int {
+	if ti.Size == 0 || ti.Size > 8000 {
+		return math.MaxInt32
+	}
+	return ti.Size
+}
+
+func isVarLenType(typeID uint8) bool {
+	return typeID == typeBigVarChar || typeID == typeNVarChar || typeID == typeBigVarBin
+}
+
+// bucketDeclType rounds the length of the variable length type ti up to
+// the first of buckets, in characters for varchar and nvarchar and in
+// bytes for varbinary, that holds it. Lengths beyond the last bucket, or
+// beyond the limit of the type, are declared as max.
+func bucketDeclType(ti typeInfo, buckets []int) typeInfo {
+	if len(buckets) == 0 || !isVarLenType(ti.TypeId) || ti.Size == 0 || ti.Size > 8000 {
+		return ti
+	}
+	unit, limit := 1, 8000
+	if ti.TypeId == typeNVarChar {
+		unit, limit = 2, 4000
+	}
+	length := ti.Size / unit
+	for _, b := range buckets {
+		if b >= length {
+			if b > limit {
+				break
+			}
+			ti.Size = b * unit
+			return ti
+		}
+	}
+	ti.Size = 0
+	return ti
+}
+
+func maxUint8(a, b uint8) uint8 {
+	if a > b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,109 @@
+package mssql
+
+import (
+	"context"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestStableParameterDeclarations(t *testing.T) {
+	s := &Stmt{c: &Conn{sess: &tdsSession{}}}
+	tests := []struct {
+		values []interface{}
+		want   string
+	}{
+		{[]interface{}{"abc", []byte{1, 2}}, "@p1 nvarchar(3),@p2 varbinary(2)"},
+		{[]interface{}{"abcd", []byte{1}}, "@p1 nvarchar(4),@p2 varbinary(2)"},
+		{[]interface{}{"ab", []byte{1, 2, 3}}, "@p1 nvarchar(4),@p2 varbinary(3)"},
+		{[]interface{}{"", []byte{}}, "@p1 nvarchar(4),@p2 varbinary(3)"},
+		{[]interface{}{int64(1), []byte{1}}, "@p1 bigint,@p2 varbinary(3)"},
+		{[]interface{}{"a", []byte{1}}, "@p1 nvarchar(1),@p2 varbinary(3)"},
+	}
+	for i, tt := range tests {
+		args := make([]namedValue, len(tt.values))
+		for j, v := range tt.values {
+			args[j] = namedValue{Ordinal: j + 1, Value: v}
+		}
+		_, decls, err := s.makeRPCParams(args, false, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.Join(decls, ","); got != tt.want {
+			t.Errorf("run %d: got %s, want %s", i, got, tt.want)
+		}
+	}
+}
+
+func TestStableDecimalDeclarations(t *testing.T) {
+	s := &Stmt{c: &Conn{sess: &tdsSession{}}}
+	for _, tt := range []struct {
+		value string
+		want  string
+	}{
+		{"1.5", "@p1 decimal(2, 1)"},
+		{"123.25", "@p1 decimal(5, 2)"},
+		{"0.125", "@p1 decimal(6, 3)"},
+	} {
+		r, _ := new(big.Rat).SetString(tt.value)
+		d, err := DecimalFromRat(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, decls, err := s.makeRPCParams([]namedValue{{Ordinal: 1, Value: d}}, false, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if decls[0] != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.value, decls[0], tt.want)
+		}
+	}
+}
+
+func TestParameterSizeBuckets(t *testing.T) {
+	buckets := []int{100, 500, 4000}
+	for _, tt := range []struct {
+		value interface{}
+		want  string
+	}{
+		{"abc", "nvarchar(100)"},
+		{strings.Repeat("x", 101), "nvarchar(500)"},
+		{strings.Repeat("x", 3000), "nvarchar(4000)"},
+		{strings.Repeat("x", 5000), "nvarchar(max)"},
+		{VarChar(strings.Repeat("x", 4001)), "varchar(max)"},
+		{make([]byte, 500), "varbinary(500)"},
+		{int64(1), "bigint"},
+	} {
+		s := &Stmt{c: &Conn{connector: &Connector{ParameterSizeBuckets: buckets}, sess: &tdsSession{}}}
+		_, decls, err := s.makeRPCParams([]namedValue{{Ordinal: 1, Value: tt.value}}, false, s.c.parameterSizeBuckets(queryOptions{}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "@p1 " + tt.want; decls[0] != want {
+			t.Errorf("got %s, want %s", decls[0], want)
+		}
+	}
+}
+
+func TestParameterSizeBucketsPrecedence(t *testing.T) {
+	connector, err := NewConnector("sqlserver://localhost?parametersizebuckets=true")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &Conn{connector: connector}
+	ctx := context.Background()
+	if got := c.parameterSizeBuckets(queryOptionsFromContext(ctx)); !reflect.DeepEqual(got, []int{100, 500, 4000}) {
+		t.Errorf("got buckets %v from the connection string, want 100, 500 and 4000", got)
+	}
+	connector.ParameterSizeBuckets = []int{255}
+	if got := c.parameterSizeBuckets(queryOptionsFromContext(ctx)); !reflect.DeepEqual(got, []int{255}) {
+		t.Errorf("got buckets %v, want those of the connector", got)
+	}
+	if got := c.parameterSizeBuckets(queryOptionsFromContext(WithParameterSizeBuckets(ctx, 50))); !reflect.DeepEqual(got, []int{50}) {
+		t.Errorf("got buckets %v, want those of the context", got)
+	}
+	if got := c.parameterSizeBuckets(queryOptionsFromContext(WithParameterSizeBuckets(ctx))); len(got) != 0 {
+		t.Errorf("got buckets %v, want none for the statement", got)
+	}
+}
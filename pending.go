@@ -0,0 +1,44 @@
+package mssql
+
+// pendingResults is a query whose rows are open on a connection.
+type pendingResults struct {
+	query  string
+	reader *tokenProcessor
+	close  func() error
+}
+
+// setPending records that the rows of query, read by reader and closed
+// with closeRows, are open on the connection.
+func (c *Conn) setPending(query string, reader *tokenProcessor, closeRows func() error) {
+	c.pending = &pendingResults{query: query, reader: reader, close: closeRows}
+}
+
+// clearPending records that the rows read by reader were closed or read to
+// the end. The rows of a later query are left as they are.
+func (c *Conn) clearPending(reader *tokenProcessor) {
+	if c.pending != nil && c.pending.reader == reader {
+		c.pending = nil
+	}
+}
+
+// checkPending makes sure the request op can be sent on the connection. It
+// fails with a ResultsPendingError while the response of a query whose
+// rows are open is still being received, unless DrainPendingResults is
+// set on the connector, in which case the rows are closed. Rows whose
+// response was read in full do not hold up the connection; their
+// remaining rows can still be read.
+func (c *Conn) checkPending(op string) error {
+	p := c.pending
+	if p == nil {
+		return nil
+	}
+	if p.reader.responseRead() {
+		c.pending = nil
+		return nil
+	}
+	if c.connector == nil || !c.connector.DrainPendingResults {
+		return ResultsPendingError{Pending: p.query, Op: op}
+	}
+	c.pending = nil
+	return p.close()
+}
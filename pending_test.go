@@ -0,0 +1,67 @@
+package mssql
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestResultsPending(t *testing.T) {
+	transport := &replyTransport{reply: &bytes.Buffer{}}
+	c := &Conn{
+		connector:      &Connector{},
+		connectionGood: true,
+		sess: &tdsSession{
+			buf:    newTdsBuffer(defaultPacketSize, transport),
+			logger: optionalLogger{},
+		},
+	}
+	reading := &tokenProcessor{done: make(chan struct{})}
+	closed := 0
+	c.setPending("select * from big", reading, func() error { closed++; return nil })
+
+	s := &Stmt{c: c, query: "update t set x = 1"}
+	err := s.sendQuery(context.Background(), nil)
+	var pendingErr ResultsPendingError
+	if !errors.As(err, &pendingErr) || !errors.Is(err, ErrResultsPending) {
+		t.Fatalf("got error %v, want a ResultsPendingError", err)
+	}
+	if pendingErr.Pending != "select * from big" || pendingErr.Op != "update t set x = 1" {
+		t.Errorf("got %+v", pendingErr)
+	}
+	if _, err = c.begin(context.Background(), isolationUseCurrent); !errors.Is(err, ErrResultsPending) {
+		t.Errorf("begin got error %v, want ErrResultsPending", err)
+	}
+	if len(transport.packets()) != 0 || closed != 0 {
+		t.Fatal("a request was sent or the rows were closed while the results were pending")
+	}
+
+	c.connector.DrainPendingResults = true
+	if err = s.sendQuery(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if closed != 1 || c.pending != nil || len(transport.packets()) != 1 {
+		t.Errorf("the pending rows were closed %d times before the request", closed)
+	}
+
+	// Rows whose response was read in full do not hold up the connection.
+	c.connector.DrainPendingResults = false
+	read := &tokenProcessor{done: make(chan struct{})}
+	close(read.done)
+	c.setPending("select 1", read, func() error { closed++; return nil })
+	if err = c.checkPending("commit"); err != nil || closed != 1 {
+		t.Errorf("got error %v and %d closes for rows read in full", err, closed)
+	}
+
+	// Closing earlier rows leaves those of a later query pending.
+	c.setPending("select 2", reading, nil)
+	c.clearPending(read)
+	if c.pending == nil {
+		t.Error("closing other rows cleared the pending rows")
+	}
+	c.clearPending(reading)
+	if c.pending != nil {
+		t.Error("the pending rows were not cleared")
+	}
+}
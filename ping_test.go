@@ -0,0 +1,92 @@
+package mssql
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// readPacket reads a whole packet sent by the client on server.
+func readPacket(server net.Conn) ([]byte, error) {
+	packet := make([]byte, 8)
+	if _, err := io.ReadFull(server, packet); err != nil {
+		return nil, err
+	}
+	rest := make([]byte, int(binary.BigEndian.Uint16(packet[2:]))-8)
+	if _, err := io.ReadFull(server, rest); err != nil {
+		return nil, err
+	}
+	return append(packet, rest...), nil
+}
+
+func TestPingKeepsSessionReset(t *testing.T) {
+	sess, server := pipeSession()
+	defer server.Close()
+	c := &Conn{sess: sess, connectionGood: true, resetSession: true}
+
+	sent := make(chan []byte, 1)
+	go func() {
+		packet, err := readPacket(server)
+		if err != nil {
+			return
+		}
+		sent <- packet
+		_, _ = server.Write([]byte{
+			byte(packReply), statusEOM, 0, 21, 0, 0, 1, 0,
+			byte(tokenDone), 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+		})
+	}()
+	if err := c.Ping(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	packet := <-sent
+	if packet[0] != byte(packSQLBatch) || packet[1] != statusEOM {
+		t.Errorf("ping sent a packet of type %d with status %#x, want a batch without reset", packet[0], packet[1])
+	}
+	if !c.resetSession {
+		t.Error("the session reset should be left to the next request")
+	}
+}
+
+func TestPingServerBusy(t *testing.T) {
+	sess, server := pipeSession()
+	defer server.Close()
+	c := &Conn{sess: sess, connectionGood: true}
+
+	go func() {
+		if _, err := readPacket(server); err != nil {
+			return
+		}
+		serveAttention(server, true)
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := c.Ping(ctx)
+	if !errors.Is(err, ErrServerBusy) || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want ErrServerBusy and context.DeadlineExceeded", err)
+	}
+	if !c.connectionGood {
+		t.Error("the connection of a busy server should be kept")
+	}
+}
+
+func TestPingClosedConnection(t *testing.T) {
+	sess, server := pipeSession()
+	c := &Conn{sess: sess, connectionGood: true}
+
+	go func() {
+		_, _ = readPacket(server)
+		server.Close()
+	}()
+	if err := c.Ping(context.Background()); err != driver.ErrBadConn {
+		t.Fatalf("got %v, want driver.ErrBadConn", err)
+	}
+	if c.connectionGood {
+		t.Error("the connection should be marked bad")
+	}
+}
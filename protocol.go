@@ -7,6 +7,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/microsoft/go-mssqldb/msdsn"
 )
@@ -80,13 +81,16 @@ func (t tcpDialer) DialSqlConnection(ctx context.Context, c *Connector, p *msdsn
 			return d.DialContext(ctx, "tcp", addr)
 		}
 
-		ips, err = net.LookupIP(p.Host)
+		ips, err = c.resolve(ctx, p.Host)
 		if err != nil {
 			return
 		}
 	} else {
 		ips = []net.IP{ip}
 	}
+	if ips = addressesOfFamily(ips, p.IPAddressFamily); len(ips) == 0 {
+		return nil, fmt.Errorf("no address of %s matches ipaddressfamily=%s", p.Host, p.IPAddressFamily)
+	}
 
 	if len(ips) == 1 || !p.MultiSubnetFailover {
 		// Try to connect to IPs sequentially until one is successful per MultiSubnetFailover false rules
@@ -100,52 +104,130 @@ func (t tcpDialer) DialSqlConnection(ctx context.Context, c *Connector, p *msdsn
 		}
 	} else {
 		//Try Dials in parallel to avoid waiting for timeouts.
-		connChan := make(chan net.Conn, len(ips))
-		errChan := make(chan error, len(ips))
-
-		for _, ip := range ips {
-			go func(ip net.IP) {
-				d := c.getDialer(p)
-				addr := net.JoinHostPort(ip.String(), portStr)
-				conn, err := d.DialContext(ctx, "tcp", addr)
-				if err == nil {
-					connChan <- conn
-				} else {
-					errChan <- err
+		conn, err = dialParallel(ctx, c, p, ips, portStr)
+	}
+	// Can't do the usual err != nil check, as it is possible to have gotten an error before a successful connection
+	if conn == nil {
+		return nil, wrapConnErr(p, err)
+	}
+	if p.ServerSPN == "" {
+		p.ServerSPN = generateSpn(p.Host, instanceOrPort(p.Instance, p.Port))
+	}
+	p.Port = resolveServerPort(p.Port)
+	return conn, err
+}
+
+// dialParallel dials ips in parallel, as MultiSubnetFailover asks, and
+// returns the first connection made. The dials start
+// p.MultiSubnetFailoverDelay apart, or as soon as the one before failed.
+// Once a connection is made the dials still in progress are cancelled,
+// those not started yet never are, and the connections made anyway are
+// closed, so the other replicas are not left with half-open connections.
+func dialParallel(ctx context.Context, c *Connector, p *msdsn.Config, ips []net.IP, port string) (net.Conn, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	results := make(chan result, len(ips))
+	started := 0
+	start := func() {
+		ip := ips[started]
+		started++
+		go func() {
+			d := c.getDialer(p)
+			conn, err := d.DialContext(ctx, "tcp", net.JoinHostPort(ip.String(), port))
+			results <- result{conn, err}
+		}()
+	}
+
+	var stagger <-chan time.Time
+	var timer *time.Timer
+	startNext := func() {
+		start()
+		if p.MultiSubnetFailoverDelay <= 0 {
+			for started < len(ips) {
+				start()
+			}
+		}
+		if started == len(ips) {
+			stagger = nil
+			return
+		}
+		if timer == nil {
+			timer = time.NewTimer(p.MultiSubnetFailoverDelay)
+		} else {
+			if !timer.Stop() {
+				select {
+				case <-timer.C:
+				default:
 				}
-			}(ip)
+			}
+			timer.Reset(p.MultiSubnetFailoverDelay)
+		}
+		stagger = timer.C
+	}
+	defer func() {
+		if timer != nil {
+			timer.Stop()
 		}
-		// Wait for either the *first* successful connection, or all the errors
-	wait_loop:
-		for i := range ips {
-			select {
-			case conn = <-connChan:
-				// Got a connection to use, close any others
+	}()
+
+	startNext()
+	var err error
+	for done := 0; done < len(ips); {
+		select {
+		case r := <-results:
+			done++
+			if r.err == nil {
+				cancel()
+				// Close the connections the dials started made anyway.
 				go func(n int) {
 					for i := 0; i < n; i++ {
-						select {
-						case conn := <-connChan:
-							conn.Close()
-						case <-errChan:
+						if r := <-results; r.conn != nil {
+							r.conn.Close()
 						}
 					}
-				}(len(ips) - i - 1)
-				// Remove any earlier errors we may have collected
-				err = nil
-				break wait_loop
-			case err = <-errChan:
+				}(started - done)
+				return r.conn, nil
+			}
+			err = r.err
+			if started < len(ips) {
+				startNext()
 			}
+		case <-stagger:
+			startNext()
 		}
 	}
-	// Can't do the usual err != nil check, as it is possible to have gotten an error before a successful connection
-	if conn == nil {
-		return nil, wrapConnErr(p, err)
+	return nil, err
+}
+
+// addressesOfFamily returns the addresses of ips to dial for family, in
+// the order to dial them. The order of the resolver is kept within each
+// family.
+func addressesOfFamily(ips []net.IP, family msdsn.AddressFamily) []net.IP {
+	if family == msdsn.AddressFamilyAny {
+		return ips
 	}
-	if p.ServerSPN == "" {
-		p.ServerSPN = generateSpn(p.Host, instanceOrPort(p.Instance, p.Port))
+	var v4, v6 []net.IP
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			v4 = append(v4, ip)
+		} else {
+			v6 = append(v6, ip)
+		}
+	}
+	switch family {
+	case msdsn.AddressFamilyIPv4:
+		return v4
+	case msdsn.AddressFamilyIPv6:
+		return v6
+	case msdsn.AddressFamilyPreferIPv6:
+		return append(v6, v4...)
+	default:
+		return append(v4, v6...)
 	}
-	p.Port = resolveServerPort(p.Port)
-	return conn, err
 }
 
 func (t tcpDialer) CallBrowser(p *msdsn.Config) bool {
@@ -0,0 +1,159 @@
+package mssql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/microsoft/go-mssqldb/msdsn"
+)
+
+func TestAddressesOfFamily(t *testing.T) {
+	v4a, v4b := net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2")
+	v6a, v6b := net.ParseIP("fd00::1"), net.ParseIP("fd00::2")
+	ips := []net.IP{v6a, v4a, v6b, v4b}
+	tests := []struct {
+		family msdsn.AddressFamily
+		want   []net.IP
+	}{
+		{msdsn.AddressFamilyAny, []net.IP{v6a, v4a, v6b, v4b}},
+		{msdsn.AddressFamilyIPv4, []net.IP{v4a, v4b}},
+		{msdsn.AddressFamilyIPv6, []net.IP{v6a, v6b}},
+		{msdsn.AddressFamilyPreferIPv4, []net.IP{v4a, v4b, v6a, v6b}},
+		{msdsn.AddressFamilyPreferIPv6, []net.IP{v6a, v6b, v4a, v4b}},
+	}
+	for _, tst := range tests {
+		if got := addressesOfFamily(ips, tst.family); !reflect.DeepEqual(got, tst.want) {
+			t.Errorf("%s: got %v, want %v", tst.family, got, tst.want)
+		}
+	}
+	if got := addressesOfFamily([]net.IP{v4a}, msdsn.AddressFamilyIPv6); len(got) != 0 {
+		t.Errorf("got %v, want no address", got)
+	}
+}
+
+func TestDialWithResolver(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("cannot listen on loopback:", err)
+	}
+	defer l.Close()
+	go func() {
+		if conn, err := l.Accept(); err == nil {
+			conn.Close()
+		}
+	}()
+
+	var looked []string
+	static := StaticResolver(map[string][]net.IP{"SQL.example.internal": {net.ParseIP("127.0.0.1")}})
+	c := &Connector{Resolver: func(ctx context.Context, host string) ([]net.IP, error) {
+		looked = append(looked, host)
+		return static(ctx, host)
+	}}
+	port := uint64(l.Addr().(*net.TCPAddr).Port)
+	p := &msdsn.Config{Host: "sql.example.internal", Port: port}
+	conn, err := tcpDialer{}.DialSqlConnection(context.Background(), c, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if !reflect.DeepEqual(looked, []string{"sql.example.internal"}) {
+		t.Errorf("looked up %v", looked)
+	}
+	if want := fmt.Sprintf("MSSQLSvc/sql.example.internal:%d", port); p.ServerSPN != want {
+		t.Errorf("got SPN %q, want %q for the logical host", p.ServerSPN, want)
+	}
+	if got := c.browserHost(context.Background(), "sql.example.internal"); got != "127.0.0.1" {
+		t.Errorf("got browser host %q", got)
+	}
+
+	c.Resolver = func(ctx context.Context, host string) ([]net.IP, error) { return nil, nil }
+	_, err = tcpDialer{}.DialSqlConnection(context.Background(), c, &msdsn.Config{Host: "sql.example.internal", Port: port})
+	if err == nil {
+		t.Error("a resolver returning no address should fail the dial")
+	}
+	if got := c.browserHost(context.Background(), "sql.example.internal"); got != "sql.example.internal" {
+		t.Errorf("got browser host %q when the resolver fails", got)
+	}
+}
+
+// scriptedDialer answers dials to 10.0.0.1 with an error and to 10.0.0.3
+// with a connection, and blocks those to other addresses until their
+// context is done.
+type scriptedDialer struct {
+	mu        sync.Mutex
+	dialed    []string
+	cancelled chan string
+}
+
+func (d *scriptedDialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	d.mu.Lock()
+	d.dialed = append(d.dialed, addr)
+	d.mu.Unlock()
+	switch addr {
+	case "10.0.0.1:1433":
+		return nil, errors.New("connection refused")
+	case "10.0.0.3:1433":
+		c, s := net.Pipe()
+		s.Close()
+		return c, nil
+	}
+	<-ctx.Done()
+	d.cancelled <- addr
+	return nil, ctx.Err()
+}
+
+func TestDialParallelStaggered(t *testing.T) {
+	ips := []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("10.0.0.2"), net.ParseIP("10.0.0.3"), net.ParseIP("10.0.0.4")}
+	d := &scriptedDialer{cancelled: make(chan string, len(ips))}
+	c := &Connector{Dialer: d}
+	p := &msdsn.Config{MultiSubnetFailover: true, MultiSubnetFailoverDelay: 100 * time.Millisecond}
+
+	start := time.Now()
+	conn, err := dialParallel(context.Background(), c, p, ips, "1433")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if elapsed := time.Since(start); elapsed < p.MultiSubnetFailoverDelay {
+		t.Errorf("connected after %v, before the third address was due", elapsed)
+	}
+	// The failure of the first address starts the second right away, the
+	// third starts after the delay and wins before the fourth is due.
+	d.mu.Lock()
+	dialed := d.dialed
+	d.mu.Unlock()
+	if want := []string{"10.0.0.1:1433", "10.0.0.2:1433", "10.0.0.3:1433"}; !reflect.DeepEqual(dialed, want) {
+		t.Errorf("dialed %v, want %v", dialed, want)
+	}
+	select {
+	case addr := <-d.cancelled:
+		if addr != "10.0.0.2:1433" {
+			t.Errorf("cancelled the dial of %s", addr)
+		}
+	case <-time.After(time.Second):
+		t.Error("the losing dial was not cancelled")
+	}
+
+	// Without a delay every address is dialed at once, so the two that
+	// block are both cancelled.
+	d = &scriptedDialer{cancelled: make(chan string, len(ips))}
+	c.Dialer = d
+	p.MultiSubnetFailoverDelay = 0
+	if conn, err = dialParallel(context.Background(), c, p, ips, "1433"); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	for i := 0; i < 2; i++ {
+		select {
+		case <-d.cancelled:
+		case <-time.After(time.Second):
+			t.Fatal("the losing dials were not all cancelled")
+		}
+	}
+}
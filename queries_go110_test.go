@@ -54,6 +54,32 @@ select Options = @@OPTIONS;
 	}
 }
 
+func TestInitialSessionContext(t *testing.T) {
+	checkConnStr(t)
+	connector, err := NewConnector(makeConnStr(t).String())
+	if err != nil {
+		t.Fatal("unable to open connector", err)
+	}
+	connector.InitialSessionContext = map[string]string{"tenant_id": "42"}
+
+	pool := sql.OpenDB(connector)
+	defer pool.Close()
+	pool.SetMaxOpenConns(1)
+	for i := 0; i < 2; i++ {
+		var tenant string
+		err = pool.QueryRow(`select cast(SESSION_CONTEXT(N'tenant_id') as nvarchar(10))`).Scan(&tenant)
+		if err != nil {
+			t.Fatal("failed to run query", err)
+		}
+		if tenant != "42" {
+			t.Fatalf("got tenant %q, want 42", tenant)
+		}
+		if _, err = pool.Exec(`EXEC sp_set_session_context N'tenant_id', N'7'`); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
 func TestParameterTypes(t *testing.T) {
 	checkConnStr(t)
 	pool, err := sql.Open("sqlserver", makeConnStr(t).String())
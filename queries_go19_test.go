@@ -58,6 +58,35 @@ func TestOutputParam(t *testing.T) {
 			t.Error("Got incorrect NullString of length:", len(nullstr.String))
 		}
 	})
+	t.Run("nvarchar(max) and varbinary(max) larger than a packet", func(t *testing.T) {
+		var str string
+		var bin []byte
+		_, err := db.ExecContext(ctx, "set @str = replicate(cast(N'a' as nvarchar(max)), 100000); set @bin = cast(@str as varbinary(max))",
+			sql.Named("str", sql.Out{Dest: &str}),
+			sql.Named("bin", sql.Out{Dest: &bin}),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if str != strings.Repeat("a", 100000) {
+			t.Error("Got incorrect string of length:", len(str))
+		}
+		if len(bin) != 200000 {
+			t.Error("Got incorrect binary of length:", len(bin))
+		}
+	})
+	t.Run("nvarchar(max) longer than the input value", func(t *testing.T) {
+		str := "a"
+		_, err := db.ExecContext(ctx, "set @str = replicate(cast(@str as nvarchar(max)), 9000)",
+			sql.Named("str", sql.Out{Dest: &str}),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if str != strings.Repeat("a", 9000) {
+			t.Error("Got incorrect string of length:", len(str))
+		}
+	})
 	t.Run("sp with rows", func(t *testing.T) {
 		sqltextcreate := `
 CREATE PROCEDURE spwithrows
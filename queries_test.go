@@ -1876,6 +1876,14 @@ func TestBeginTxtReadOnlyNotSupported(t *testing.T) {
 	if err == nil {
 		t.Error("BeginTx expected to fail for read only transaction because MSSQL doesn't support it, but it succeeded")
 	}
+	if !errors.Is(err, ErrReadOnlyTx) {
+		t.Errorf("BeginTx failed with %v, want an error matching ErrReadOnlyTx", err)
+	}
+	// The connection is still usable.
+	var n int
+	if err = conn.QueryRow("select 1").Scan(&n); err != nil {
+		t.Error(err)
+	}
 }
 
 func TestConn_BeginTx(t *testing.T) {
@@ -2365,7 +2373,7 @@ func TestDisconnect1(t *testing.T) {
 	defer cancel()
 
 	createDialer = func(p *msdsn.Config) Dialer {
-		nd := netDialer{&net.Dialer{Timeout: p.DialTimeout, KeepAlive: p.KeepAlive}}
+		nd := netDialer{nd: &net.Dialer{Timeout: p.DialTimeout, KeepAlive: p.KeepAlive}}
 		di := &dialerInterrupt{nd: nd}
 		go func() {
 			<-waitDisrupt
@@ -2432,7 +2440,7 @@ func TestDisconnect2(t *testing.T) {
 		defer cancel()
 
 		createDialer = func(p *msdsn.Config) Dialer {
-			nd := netDialer{&net.Dialer{Timeout: p.DialTimeout, KeepAlive: p.KeepAlive}}
+			nd := netDialer{nd: &net.Dialer{Timeout: p.DialTimeout, KeepAlive: p.KeepAlive}}
 			di := &dialerInterrupt{nd: nd}
 			go func() {
 				<-waitDisrupt
@@ -2504,7 +2512,7 @@ func TestDisconnect3(t *testing.T) {
 	makeInterruptDialers := true
 	disconnect := make(chan bool)
 	createDialer = func(p *msdsn.Config) Dialer {
-		nd := netDialer{&net.Dialer{Timeout: p.DialTimeout, KeepAlive: p.KeepAlive}}
+		nd := netDialer{nd: &net.Dialer{Timeout: p.DialTimeout, KeepAlive: p.KeepAlive}}
 		mu.Lock()
 		defer mu.Unlock()
 		if makeInterruptDialers {
@@ -2598,7 +2606,7 @@ func TestDisconnect4(t *testing.T) {
 	makeInterruptDialers := true
 	disconnect := make(chan bool)
 	createDialer = func(p *msdsn.Config) Dialer {
-		nd := netDialer{&net.Dialer{Timeout: p.DialTimeout, KeepAlive: p.KeepAlive}}
+		nd := netDialer{nd: &net.Dialer{Timeout: p.DialTimeout, KeepAlive: p.KeepAlive}}
 		mu.Lock()
 		defer mu.Unlock()
 		if makeInterruptDialers {
@@ -0,0 +1,319 @@
+package mssql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode"
+)
+
+type queryOptionsKey struct{}
+
+// queryOptions holds the SET options applied to the statements run with
+// a context from WithIsolationLevel or WithLockTimeout, the database from
+// WithDatabase, the query hints from WithQueryHints, the command
+// timeout from WithCommandTimeout, the statistics of WithExecutionStats
+// and the context info of WithContextInfo.
+type queryOptions struct {
+	database          string
+	isolation         sql.IsolationLevel
+	hasIsolation      bool
+	lockTimeout       time.Duration
+	hasLockTimeout    bool
+	commandTimeout    time.Duration
+	hasCommandTimeout bool
+	hints             []string
+	statisticsXML     bool
+	sizeBuckets       []int
+	hasSizeBuckets    bool
+	rawBytes          bool
+	readAhead         int
+	timezone          *time.Location
+	requestID         string
+	stats             *ExecutionStats
+	contextInfo       []byte
+}
+
+func queryOptionsFromContext(ctx context.Context) queryOptions {
+	opts, _ := ctx.Value(queryOptionsKey{}).(queryOptions)
+	return opts
+}
+
+// WithIsolationLevel returns a context that runs the statements executed
+// with it at the given transaction isolation level. The level is set
+// for the statement only and the connection's level is left unchanged.
+//
+// sql.LevelDefault leaves the isolation level as is. The option cannot be
+// used when the query is the name of a stored procedure.
+func WithIsolationLevel(ctx context.Context, level sql.IsolationLevel) context.Context {
+	opts := queryOptionsFromContext(ctx)
+	opts.isolation = level
+	opts.hasIsolation = true
+	return context.WithValue(ctx, queryOptionsKey{}, opts)
+}
+
+// WithLockTimeout returns a context that makes the statements executed
+// with it wait at most d for a lock before failing with error 1222.
+// A zero duration fails as soon as a lock is held by another session and
+// a negative one waits forever. The timeout is set for the statement only
+// and the connection's timeout is left unchanged.
+//
+// The option cannot be used when the query is the name of a stored procedure.
+func WithLockTimeout(ctx context.Context, d time.Duration) context.Context {
+	opts := queryOptionsFromContext(ctx)
+	opts.lockTimeout = d
+	opts.hasLockTimeout = true
+	return context.WithValue(ctx, queryOptionsKey{}, opts)
+}
+
+// WithDatabase returns a context that runs the statements executed with
+// it in the database name, as if they started with USE [name]. The USE
+// runs in the same call to sp_executesql as the statement, so the server
+// switches back to the database of the connection when the statement
+// completes, even when it fails, and the connection goes back to the pool
+// as it was. An empty name runs the statements in the database of the
+// connection.
+//
+// The option cannot be used when the query is the name of a stored procedure.
+func WithDatabase(ctx context.Context, name string) context.Context {
+	opts := queryOptionsFromContext(ctx)
+	opts.database = name
+	return context.WithValue(ctx, queryOptionsKey{}, opts)
+}
+
+// WithCommandTimeout returns a context that gives the statements executed
+// with it a deadline of d, in place of the "command timeout" of the
+// connection string. A zero or negative duration runs them without a
+// deadline. As with the connection string setting, the timeout only
+// applies when ctx has no deadline of its own; for queries it covers
+// reading the rows until they are closed.
+func WithCommandTimeout(ctx context.Context, d time.Duration) context.Context {
+	opts := queryOptionsFromContext(ctx)
+	opts.commandTimeout = d
+	opts.hasCommandTimeout = true
+	return context.WithValue(ctx, queryOptionsKey{}, opts)
+}
+
+// WithQueryHints returns a context that appends an OPTION clause with the
+// hints to the statements executed with it, so that
+//
+//	ctx = mssql.WithQueryHints(ctx, "RECOMPILE", "MAXDOP 1")
+//
+// runs "select ... OPTION (RECOMPILE, MAXDOP 1)". Hints given by earlier
+// calls are kept. Any query hint can be used, including USE HINT and
+// USE PLAN, but a hint cannot hold a semicolon or a comment, or leave a
+// parenthesis or a string open; such hints fail the statement.
+//
+// The clause is added after the query text, which must be a single
+// statement without an OPTION clause of its own. The option cannot be
+// used when the query is the name of a stored procedure.
+func WithQueryHints(ctx context.Context, hints ...string) context.Context {
+	opts := queryOptionsFromContext(ctx)
+	opts.hints = append(opts.hints[:len(opts.hints):len(opts.hints)], hints...)
+	return context.WithValue(ctx, queryOptionsKey{}, opts)
+}
+
+// WithParameterSizeBuckets returns a context that declares the varchar,
+// nvarchar and varbinary parameters of the statements executed with it
+// with the lengths of buckets, in place of Connector.ParameterSizeBuckets
+// and the "parametersizebuckets" of the connection string. No buckets
+// declares the lengths of the values.
+func WithParameterSizeBuckets(ctx context.Context, buckets ...int) context.Context {
+	opts := queryOptionsFromContext(ctx)
+	opts.sizeBuckets = buckets
+	opts.hasSizeBuckets = true
+	return context.WithValue(ctx, queryOptionsKey{}, opts)
+}
+
+// WithRawBytes returns a context that reads the varbinary, binary, varchar
+// and char values of the rows of the queries run with it into buffers
+// reused from row to row, instead of allocating each value. Scanning such
+// values into *sql.RawBytes then copies nothing, the bytes being those of
+// the driver, valid until the next call to Next, NextResultSet or Close of
+// the rows, as database/sql documents for RawBytes.
+//
+// The varchar and char values are returned as []byte holding UTF-8 text
+// rather than as strings. Scanning them into *string, *[]byte or
+// sql.NullString works as before, but values scanned into *interface{}
+// are []byte. Scanners receive the buffers of the driver and must copy
+// what they keep. The max types, the values of encrypted columns and
+// queries with a message queue are read as usual.
+func WithRawBytes(ctx context.Context) context.Context {
+	opts := queryOptionsFromContext(ctx)
+	opts.rawBytes = true
+	return context.WithValue(ctx, queryOptionsKey{}, opts)
+}
+
+// WithReadAhead returns a context that lets the driver read up to rows
+// rows of the queries run with it ahead of the application. The response
+// of a query is received and decoded by a goroutine of its own, which
+// waits once it is a few rows ahead of Next; a larger read-ahead keeps it
+// receiving while the application processes the rows, overlapping the
+// network latency of large result sets with their processing, at the cost
+// of holding more decoded rows in memory. A rows of zero or less restores
+// the default, and a rows above MaxReadAhead reads MaxReadAhead rows ahead.
+func WithReadAhead(ctx context.Context, rows int) context.Context {
+	opts := queryOptionsFromContext(ctx)
+	opts.readAhead = rows
+	if rows < 0 {
+		opts.readAhead = 0
+	} else if rows > MaxReadAhead {
+		opts.readAhead = MaxReadAhead
+	}
+	return context.WithValue(ctx, queryOptionsKey{}, opts)
+}
+
+// MaxReadAhead is the largest number of rows WithReadAhead lets the driver
+// read ahead of the application.
+const MaxReadAhead = 10000
+
+// WithTimezone returns a context that sets the time zone of the datetime,
+// smalldatetime, datetime2, date and time values of the statements run
+// with it, overriding the timezone connection parameter, see
+// msdsn.EncodeParameters.Timezone. Their columns are returned as times of
+// loc, and time.Time parameters are converted to loc, so that columns
+// without a time zone store the wall clock of loc. A nil loc restores the
+// zone of the connection.
+func WithTimezone(ctx context.Context, loc *time.Location) context.Context {
+	opts := queryOptionsFromContext(ctx)
+	opts.timezone = loc
+	return context.WithValue(ctx, queryOptionsKey{}, opts)
+}
+
+// optionClause returns the OPTION clause of the query hints, on a line of
+// its own so that a comment ending the query does not swallow it.
+func (o queryOptions) optionClause() (string, error) {
+	if len(o.hints) == 0 {
+		return "", nil
+	}
+	hints := make([]string, len(o.hints))
+	for i, h := range o.hints {
+		h = strings.TrimSpace(h)
+		if err := checkQueryHint(h); err != nil {
+			return "", err
+		}
+		hints[i] = h
+	}
+	return "\nOPTION (" + strings.Join(hints, ", ") + ")", nil
+}
+
+// checkQueryHint makes sure h cannot end the OPTION clause it is put in.
+func checkQueryHint(h string) error {
+	if h == "" {
+		return errors.New("mssql: empty query hint")
+	}
+	depth := 0
+	inString := false
+	for i := 0; i < len(h); i++ {
+		c := h[i]
+		if inString {
+			if c == '\'' {
+				inString = false
+			}
+			continue
+		}
+		switch {
+		case c == '\'':
+			inString = true
+		case c == '(':
+			depth++
+		case c == ')':
+			depth--
+			if depth < 0 {
+				return fmt.Errorf("mssql: query hint %q closes a parenthesis it did not open", h)
+			}
+		case c == ';':
+			return fmt.Errorf("mssql: query hint %q holds a semicolon", h)
+		case strings.HasPrefix(h[i:], "--"), strings.HasPrefix(h[i:], "/*"):
+			return fmt.Errorf("mssql: query hint %q holds a comment", h)
+		}
+	}
+	if inString || depth != 0 {
+		return fmt.Errorf("mssql: query hint %q leaves a string or a parenthesis open", h)
+	}
+	return nil
+}
+
+// withOptionClause returns query followed by the OPTION clause, without
+// the semicolon that may end query.
+func withOptionClause(query, clause string) string {
+	if clause == "" {
+		return query
+	}
+	query = strings.TrimRightFunc(query, unicode.IsSpace)
+	query = strings.TrimSuffix(query, ";")
+	return query + clause
+}
+
+// setStatements returns the SET statements for the options. They are
+// kept on one line so that line numbers in error messages still match
+// the query text.
+func (o queryOptions) setStatements() (string, error) {
+	var sb strings.Builder
+	if o.requestID != "" {
+		stmts, err := requestIDStatements(o.requestID)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(stmts)
+	}
+	if len(o.contextInfo) > 0 {
+		stmt, err := contextInfoStatement(o.contextInfo)
+		if err != nil {
+			return "", err
+		}
+		sb.WriteString(stmt)
+	}
+	if o.database != "" {
+		sb.WriteString("USE ")
+		sb.WriteString(TSQLQuoter{}.ID(o.database))
+		sb.WriteString(";")
+	}
+	if o.hasIsolation {
+		level, err := isolationLevelName(o.isolation)
+		if err != nil {
+			return "", err
+		}
+		if level != "" {
+			sb.WriteString("SET TRANSACTION ISOLATION LEVEL ")
+			sb.WriteString(level)
+			sb.WriteString(";")
+		}
+	}
+	if o.hasLockTimeout {
+		ms := o.lockTimeout.Milliseconds()
+		if o.lockTimeout < 0 {
+			ms = -1
+		}
+		fmt.Fprintf(&sb, "SET LOCK_TIMEOUT %d;", ms)
+	}
+	if o.statisticsXML {
+		sb.WriteString("SET STATISTICS XML ON;")
+	}
+	if o.stats != nil {
+		sb.WriteString("SET STATISTICS IO, TIME ON;")
+	}
+	return sb.String(), nil
+}
+
+func isolationLevelName(level sql.IsolationLevel) (string, error) {
+	switch level {
+	case sql.LevelDefault:
+		return "", nil
+	case sql.LevelReadUncommitted:
+		return "READ UNCOMMITTED", nil
+	case sql.LevelReadCommitted:
+		return "READ COMMITTED", nil
+	case sql.LevelRepeatableRead:
+		return "REPEATABLE READ", nil
+	case sql.LevelSnapshot:
+		return "SNAPSHOT", nil
+	case sql.LevelSerializable:
+		return "SERIALIZABLE", nil
+	default:
+		return "", errors.New("isolation level is not supported or unknown")
+	}
+}
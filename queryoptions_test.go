@@ -0,0 +1,359 @@
+package mssql
+
+import (
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestQueryOptionsSetStatements(t *testing.T) {
+	bg := context.Background()
+	tests := []struct {
+		ctx  context.Context
+		want string
+	}{
+		{bg, ""},
+		{WithIsolationLevel(bg, sql.LevelDefault), ""},
+		{WithIsolationLevel(bg, sql.LevelSerializable), "SET TRANSACTION ISOLATION LEVEL SERIALIZABLE;"},
+		{WithLockTimeout(bg, 5*time.Second), "SET LOCK_TIMEOUT 5000;"},
+		{WithLockTimeout(bg, -1), "SET LOCK_TIMEOUT -1;"},
+		{WithDatabase(bg, "db2"), "USE [db2];"},
+		{WithDatabase(bg, "my]db"), "USE [my]]db];"},
+		{WithDatabase(WithDatabase(bg, "db2"), ""), ""},
+		{WithLockTimeout(WithDatabase(bg, "db2"), 0), "USE [db2];SET LOCK_TIMEOUT 0;"},
+		{context.WithValue(bg, queryOptionsKey{}, queryOptions{statisticsXML: true}), "SET STATISTICS XML ON;"},
+		{WithExecutionStats(bg, &ExecutionStats{}), "SET STATISTICS IO, TIME ON;"},
+		{WithContextInfo(bg, []byte{0x01, 0xab}), "SET CONTEXT_INFO 0x01ab;"},
+		{WithContextInfo(WithContextInfo(bg, []byte{1}), nil), ""},
+		{WithExecutionStats(WithExecutionStats(bg, &ExecutionStats{}), nil), ""},
+		{WithRequestID(bg, "order-42"), "/*request_id='order-42'*/EXEC sys.sp_set_session_context N'mssql_request_id', N'order-42';"},
+		{WithRequestID(bg, "o'42"), "/*request_id='o''42'*/EXEC sys.sp_set_session_context N'mssql_request_id', N'o''42';"},
+		{WithRequestID(WithRequestID(bg, "a"), ""), ""},
+		{
+			WithLockTimeout(WithIsolationLevel(bg, sql.LevelReadUncommitted), 0),
+			"SET TRANSACTION ISOLATION LEVEL READ UNCOMMITTED;SET LOCK_TIMEOUT 0;",
+		},
+		{
+			WithIsolationLevel(WithIsolationLevel(bg, sql.LevelReadUncommitted), sql.LevelSnapshot),
+			"SET TRANSACTION ISOLATION LEVEL SNAPSHOT;",
+		},
+	}
+	for i, tst := range tests {
+		got, err := queryOptionsFromContext(tst.ctx).setStatements()
+		if err != nil {
+			t.Errorf("test %d: unexpected error %v", i, err)
+			continue
+		}
+		if got != tst.want {
+			t.Errorf("test %d: got %q, want %q", i, got, tst.want)
+		}
+	}
+
+	_, err := queryOptionsFromContext(WithIsolationLevel(bg, sql.LevelLinearizable)).setStatements()
+	if err == nil {
+		t.Error("expected an error for an unsupported isolation level")
+	}
+	_, err = queryOptionsFromContext(WithRequestID(bg, "a*/b")).setStatements()
+	if err == nil {
+		t.Error("expected an error for a request ID ending the comment")
+	}
+	_, err = queryOptionsFromContext(WithContextInfo(bg, make([]byte, ContextInfoSize+1))).setStatements()
+	if err == nil {
+		t.Error("expected an error for a context info longer than ContextInfoSize")
+	}
+}
+
+func TestQueryOptionsAreScopedToStatement(t *testing.T) {
+	conn, logger := open(t)
+	defer conn.Close()
+	defer logger.StopLogging()
+
+	ctx := context.Background()
+	c, err := conn.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	const query = "select transaction_isolation_level, @@LOCK_TIMEOUT from sys.dm_exec_sessions where session_id = @@SPID"
+	var level int16
+	var lockTimeout int32
+	optCtx := WithLockTimeout(WithIsolationLevel(ctx, sql.LevelSerializable), 1500*time.Millisecond)
+	if err = c.QueryRowContext(optCtx, query).Scan(&level, &lockTimeout); err != nil {
+		t.Fatal(err)
+	}
+	if level != 4 || lockTimeout != 1500 {
+		t.Errorf("options were not applied: isolation level %d, lock timeout %d", level, lockTimeout)
+	}
+
+	if err = c.QueryRowContext(ctx, query).Scan(&level, &lockTimeout); err != nil {
+		t.Fatal(err)
+	}
+	if level != 2 || lockTimeout != -1 {
+		t.Errorf("options were not restored: isolation level %d, lock timeout %d", level, lockTimeout)
+	}
+
+	if _, err = c.ExecContext(optCtx, "sp_who"); err == nil {
+		t.Error("expected an error for options on a stored procedure call")
+	}
+}
+
+func TestWithDatabaseIsScopedToStatement(t *testing.T) {
+	conn, logger := open(t)
+	defer conn.Close()
+	defer logger.StopLogging()
+
+	ctx := context.Background()
+	c, err := conn.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	var before, in, after string
+	if err = c.QueryRowContext(ctx, "select db_name()").Scan(&before); err != nil {
+		t.Fatal(err)
+	}
+	if err = c.QueryRowContext(WithDatabase(ctx, "tempdb"), "select db_name()").Scan(&in); err != nil {
+		t.Fatal(err)
+	}
+	if in != "tempdb" {
+		t.Errorf("the statement ran in %q, want tempdb", in)
+	}
+	if _, err = c.ExecContext(WithDatabase(ctx, "tempdb"), "select 1/0"); err == nil {
+		t.Error("expected a divide by zero error")
+	}
+	if err = c.QueryRowContext(ctx, "select db_name()").Scan(&after); err != nil {
+		t.Fatal(err)
+	}
+	if after != before {
+		t.Errorf("the connection was left in %q, want %q", after, before)
+	}
+}
+
+func TestCommandContext(t *testing.T) {
+	c := &Conn{connector: &Connector{}}
+	c.connector.params.CommandTimeout = 30 * time.Second
+	bg := context.Background()
+
+	ctx, cancel := c.commandContext(bg)
+	deadline, ok := ctx.Deadline()
+	if !ok || time.Until(deadline) > 30*time.Second || time.Until(deadline) < 29*time.Second {
+		t.Errorf("got deadline %v, %v from the connection string timeout", deadline, ok)
+	}
+	cancel()
+	if ctx.Err() == nil {
+		t.Error("cancel should release the command context")
+	}
+
+	ctx, cancel = c.commandContext(WithCommandTimeout(bg, time.Second))
+	deadline, ok = ctx.Deadline()
+	if !ok || time.Until(deadline) > time.Second {
+		t.Errorf("got deadline %v, %v from WithCommandTimeout", deadline, ok)
+	}
+	cancel()
+
+	for _, ctx := range []context.Context{WithCommandTimeout(bg, 0), WithCommandTimeout(bg, -1)} {
+		got, cancel := c.commandContext(ctx)
+		if got != ctx {
+			t.Error("a timeout that is not positive should leave the context as is")
+		}
+		cancel()
+	}
+
+	own, ownCancel := context.WithTimeout(bg, time.Hour)
+	defer ownCancel()
+	if got, cancel := c.commandContext(own); got != own {
+		t.Error("a context with a deadline should be left as is")
+	} else {
+		cancel()
+	}
+
+	c.connector.params.CommandTimeout = 0
+	if got, cancel := c.commandContext(bg); got != bg {
+		t.Error("no command timeout should leave the context as is")
+	} else {
+		cancel()
+	}
+}
+
+func TestCommandTimeout(t *testing.T) {
+	conn, logger := open(t)
+	defer conn.Close()
+	defer logger.StopLogging()
+
+	ctx := WithCommandTimeout(context.Background(), 200*time.Millisecond)
+	_, err := conn.ExecContext(ctx, "waitfor delay '00:00:05'")
+	if err != context.DeadlineExceeded {
+		t.Errorf("got error %v, want context.DeadlineExceeded", err)
+	}
+	var n int
+	if err = conn.QueryRowContext(ctx, "select 1").Scan(&n); err != nil || n != 1 {
+		t.Errorf("got %d, %v after the timeout", n, err)
+	}
+}
+
+func TestQueryOptionsOptionClause(t *testing.T) {
+	bg := context.Background()
+	tests := []struct {
+		ctx  context.Context
+		want string
+	}{
+		{bg, ""},
+		{WithQueryHints(bg), ""},
+		{WithQueryHints(bg, "RECOMPILE"), "\nOPTION (RECOMPILE)"},
+		{WithQueryHints(WithQueryHints(bg, " RECOMPILE "), "MAXDOP 1"), "\nOPTION (RECOMPILE, MAXDOP 1)"},
+		{
+			WithQueryHints(bg, "USE HINT('DISABLE_OPTIMIZED_NESTED_LOOP')", "TABLE HINT(t, INDEX(ix_t))"),
+			"\nOPTION (USE HINT('DISABLE_OPTIMIZED_NESTED_LOOP'), TABLE HINT(t, INDEX(ix_t)))",
+		},
+		{WithQueryHints(bg, "USE PLAN N'<a b=''c;)''/>'"), "\nOPTION (USE PLAN N'<a b=''c;)''/>')"},
+	}
+	for i, tst := range tests {
+		got, err := queryOptionsFromContext(tst.ctx).optionClause()
+		if err != nil {
+			t.Errorf("test %d: unexpected error %v", i, err)
+			continue
+		}
+		if got != tst.want {
+			t.Errorf("test %d: got %q, want %q", i, got, tst.want)
+		}
+	}
+
+	for _, hint := range []string{"", " ", "RECOMPILE); drop table t; --", "MAXDOP 1 -- x", "MAXDOP /* x */ 1", "RECOMPILE)", "USE HINT('x'", "USE HINT('x)"} {
+		if _, err := queryOptionsFromContext(WithQueryHints(bg, hint)).optionClause(); err == nil {
+			t.Errorf("hint %q should fail", hint)
+		}
+	}
+
+	// Hints added to a derived context are not seen by its parent.
+	parent := WithQueryHints(bg, "RECOMPILE", "MAXDOP 1")
+	WithQueryHints(parent, "FAST 10")
+	if got, _ := queryOptionsFromContext(parent).optionClause(); got != "\nOPTION (RECOMPILE, MAXDOP 1)" {
+		t.Errorf("parent hints changed to %q", got)
+	}
+}
+
+func TestWithOptionClause(t *testing.T) {
+	tests := []struct{ query, want string }{
+		{"select 1", "select 1\nOPTION (RECOMPILE)"},
+		{"select 1; \n", "select 1\nOPTION (RECOMPILE)"},
+		{"select 1 -- one", "select 1 -- one\nOPTION (RECOMPILE)"},
+	}
+	for _, tst := range tests {
+		if got := withOptionClause(tst.query, "\nOPTION (RECOMPILE)"); got != tst.want {
+			t.Errorf("%q: got %q, want %q", tst.query, got, tst.want)
+		}
+	}
+	if got := withOptionClause("select 1;", ""); got != "select 1;" {
+		t.Errorf("no clause should leave the query as is, got %q", got)
+	}
+}
+
+func TestQueryHints(t *testing.T) {
+	conn, logger := open(t)
+	defer conn.Close()
+	defer logger.StopLogging()
+
+	ctx := WithQueryHints(context.Background(), "RECOMPILE", "MAXDOP 1")
+	var n int
+	if err := conn.QueryRowContext(ctx, "select count(*) from sys.objects where object_id > @p1;", 0).Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n == 0 {
+		t.Error("expected objects to be counted")
+	}
+	if err := conn.QueryRowContext(ctx, "select 1").Scan(&n); err != nil || n != 1 {
+		t.Errorf("got %d, %v for a query without parameters", n, err)
+	}
+	if _, err := conn.ExecContext(ctx, "sp_who"); err == nil {
+		t.Error("expected an error for query hints on a stored procedure call")
+	}
+}
+
+func TestWithReadAhead(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		rows, want int
+	}{
+		{0, tokenChanSize},
+		{-1, tokenChanSize},
+		{1, 1},
+		{500, 500},
+		{MaxReadAhead + 1, MaxReadAhead},
+		{math.MaxInt32, MaxReadAhead},
+	} {
+		outs := outputs{readAhead: queryOptionsFromContext(WithReadAhead(ctx, tc.rows)).readAhead}
+		if got := outs.readAheadSize(); got != tc.want {
+			t.Errorf("WithReadAhead(%d): reading %d tokens ahead, want %d", tc.rows, got, tc.want)
+		}
+	}
+}
+
+func TestReadAheadRows(t *testing.T) {
+	conn, logger := open(t)
+	defer conn.Close()
+	defer logger.StopLogging()
+
+	ctx := WithRawBytes(WithReadAhead(context.Background(), 100))
+	rows, err := conn.QueryContext(ctx, `select top 5000 row_number() over (order by (select null)), convert(varbinary(8), row_number() over (order by (select null)))
+from sys.all_columns a cross join sys.all_columns b`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var n int64
+	for rows.Next() {
+		var i int64
+		var b sql.RawBytes
+		if err = rows.Scan(&i, &b); err != nil {
+			t.Fatal(err)
+		}
+		n++
+		if i != n || len(b) != 8 || int64(binary.BigEndian.Uint64(b)) != n {
+			t.Fatalf("row %d read as %d, %x", n, i, []byte(b))
+		}
+	}
+	if err = rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if n != 5000 {
+		t.Errorf("read %d rows, want 5000", n)
+	}
+}
+
+func TestRequestCommitted(t *testing.T) {
+	conn, logger := open(t)
+	defer conn.Close()
+	defer logger.StopLogging()
+
+	ctx := context.Background()
+	c, err := conn.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err = c.ExecContext(ctx, "create table ##requests (request_id nvarchar(100) not null default cast(session_context(N'mssql_request_id') as nvarchar(100)), n int)"); err != nil {
+		t.Fatal(err)
+	}
+	defer c.ExecContext(ctx, "drop table ##requests")
+
+	if _, err = c.ExecContext(WithRequestID(ctx, "req-1"), "insert into ##requests (n) values (@p1)", 1); err != nil {
+		t.Fatal(err)
+	}
+	for _, tc := range []struct {
+		id   string
+		want bool
+	}{{"req-1", true}, {"req-2", false}} {
+		got, err := RequestCommitted(ctx, conn, "##requests", "request_id", tc.id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tc.want {
+			t.Errorf("RequestCommitted(%q) = %t, want %t", tc.id, got, tc.want)
+		}
+	}
+}
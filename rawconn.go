@@ -0,0 +1,303 @@
+package mssql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/microsoft/go-mssqldb/msdsn"
+)
+
+// RawConn is a connection used without database/sql, for tools such as
+// query proxies and migration engines that need the responses of the
+// server token by token. It sends SQL batches and RPC requests and returns
+// a TokenStream over each response, which must be read to its end, or
+// closed, before the next request.
+//
+// A RawConn uses the same session as the database/sql driver: the login,
+// encryption, transactions started in batches and cancellation on context
+// end work the same way. It is not safe for concurrent use.
+type RawConn struct {
+	c      *Conn
+	stream *TokenStream
+}
+
+// ConnectRaw opens a connection with the settings of c outside of any
+// database/sql pool.
+func (c *Connector) ConnectRaw(ctx context.Context) (*RawConn, error) {
+	conn, err := c.Connect(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return &RawConn{c: conn.(*Conn)}, nil
+}
+
+// Conn returns the driver connection of r, for accessors such as
+// ConnectionInfo.
+func (r *RawConn) Conn() *Conn {
+	return r.c
+}
+
+// Close closes the connection.
+func (r *RawConn) Close() error {
+	return r.c.Close()
+}
+
+// ExecBatch sends batch, which can hold several statements, as a SQL batch
+// and returns the stream of its response.
+func (r *RawConn) ExecBatch(ctx context.Context, batch string) (*TokenStream, error) {
+	if err := r.begin(); err != nil {
+		return nil, err
+	}
+	c := r.c
+	if c.sess.logFlags&logSQL != 0 {
+		c.sess.logger.Log(ctx, msdsn.LogSQL, batch)
+	}
+	headers := []headerStruct{
+		{hdrtype: dataStmHdrTransDescr, data: transDescrHdr{c.sess.tranid, 1}.pack()},
+	}
+	if hdr, ok := c.sess.traceActivityHeader(ctx); ok {
+		headers = append(headers, hdr)
+	}
+	c.sess.buf.sendCtx = ctx
+	defer func() { c.sess.buf.sendCtx = nil }()
+	reset := c.resetSession
+	c.resetSession = false
+	if err := sendSqlBatch72(c.sess.buf, batch, headers, reset); err != nil {
+		return nil, r.sendFailed(ctx, err, reset, "SQL batch")
+	}
+	return r.read(ctx), nil
+}
+
+// RPC calls the stored procedure proc with args and returns the stream of
+// its response. The arguments are converted as those of a query, with
+// sql.Named for named parameters and sql.Out for output parameters, whose
+// values come back as ReturnValueToken rather than through the pointers.
+func (r *RawConn) RPC(ctx context.Context, proc string, args ...interface{}) (*TokenStream, error) {
+	return r.RPCBatch(ctx, RPCCall{Proc: proc, Args: args})
+}
+
+// RPCCall is a stored procedure call of RPCBatch.
+type RPCCall struct {
+	Proc string
+	Args []interface{}
+}
+
+// RPCBatch sends calls in a single RPC request, so a sequence of small
+// calls costs one round trip, and one network write with coalescewrites,
+// instead of one per call. The server runs the calls in order and the
+// stream returns their responses one after the other, each ended by a
+// DoneToken. The arguments are converted as those of RPC.
+func (r *RawConn) RPCBatch(ctx context.Context, calls ...RPCCall) (*TokenStream, error) {
+	if err := r.begin(); err != nil {
+		return nil, err
+	}
+	if len(calls) == 0 {
+		return nil, errors.New("mssql: RPCBatch needs a call")
+	}
+	c := r.c
+	// the destinations of sql.Out are not used, the values come back as
+	// tokens
+	defer c.clearOuts()
+	rpcCalls := make([]rpcCall, len(calls))
+	for i, call := range calls {
+		if call.Proc == "" {
+			return nil, errors.New("mssql: RPC needs a procedure name")
+		}
+		list, err := c.namedValues(call.Args)
+		if err != nil {
+			return nil, err
+		}
+		params, _, err := (&Stmt{c: c, query: call.Proc}).makeRPCParams(list, true, nil)
+		if err != nil {
+			return nil, err
+		}
+		rpcCalls[i] = rpcCall{proc: procId{name: call.Proc}, params: params}
+		if c.sess.logFlags&logSQL != 0 {
+			c.sess.logger.Log(ctx, msdsn.LogSQL, call.Proc)
+		}
+	}
+	headers := []headerStruct{
+		{hdrtype: dataStmHdrTransDescr, data: transDescrHdr{c.sess.tranid, 1}.pack()},
+	}
+	if hdr, ok := c.sess.traceActivityHeader(ctx); ok {
+		headers = append(headers, hdr)
+	}
+	batchFlag := byte(rpcBatchFlag)
+	if c.sess.loginAck.TDSVersion < verTDS72 {
+		batchFlag = rpcBatchFlag71
+	}
+	c.sess.buf.sendCtx = ctx
+	defer func() { c.sess.buf.sendCtx = nil }()
+	reset := c.resetSession
+	c.resetSession = false
+	if err := sendRpcBatch(c.sess.buf, headers, rpcCalls, batchFlag, reset); err != nil {
+		return nil, r.sendFailed(ctx, err, reset, "RPC")
+	}
+	return r.read(ctx), nil
+}
+
+// begin drains the response of the previous request, if any, before a
+// new one is sent.
+func (r *RawConn) begin() error {
+	if r.stream != nil {
+		r.stream.Close()
+		r.stream = nil
+	}
+	if !r.c.connectionGood {
+		return driver.ErrBadConn
+	}
+	return nil
+}
+
+func (r *RawConn) sendFailed(ctx context.Context, err error, reset bool, what string) error {
+	c := r.c
+	if c.sess.logFlags&logErrors != 0 {
+		c.sess.logger.Log(ctx, msdsn.LogErrors, fmt.Sprintf("Failed to send %s with %v", what, err))
+	}
+	if ctxErr := c.cancelSend(ctx, err, reset); ctxErr != nil {
+		return ctxErr
+	}
+	c.connectionGood = false
+	return fmt.Errorf("failed to send %s: %v", what, err)
+}
+
+func (r *RawConn) read(ctx context.Context) *TokenStream {
+	r.stream = &TokenStream{c: r.c, ctx: ctx, reader: startReading(r.c.sess, ctx, outputs{raw: true})}
+	return r.stream
+}
+
+// Token is a token of a response read from a TokenStream: ColumnsToken,
+// RowToken, DoneToken, ReturnStatus, ReturnValueToken or MessageToken.
+type Token interface {
+	isToken()
+}
+
+// RawColumn is a column of a ColumnsToken.
+type RawColumn struct {
+	Name string
+	// DatabaseTypeName is the name of the type of the column, as returned
+	// by sql.ColumnType.DatabaseTypeName.
+	DatabaseTypeName string
+	// Length is the length of variable length columns, as returned by
+	// sql.ColumnType.Length, and zero for other columns.
+	Length   int64
+	Nullable bool
+}
+
+// ColumnsToken holds the columns of the rows of the result set that
+// follow it.
+type ColumnsToken []RawColumn
+
+// RowToken holds the values of a row, as decoded by the driver, such as
+// int64, float64, bool, string, []byte and time.Time, with nil for NULL.
+type RowToken []interface{}
+
+// DoneToken ends a statement of a batch or a procedure.
+type DoneToken struct {
+	// More is set when more statements follow in the response.
+	More bool
+	// InProc is set when the statement ran inside a procedure.
+	InProc bool
+	// HasRowCount is set when RowCount holds the number of rows of the
+	// statement.
+	HasRowCount bool
+	RowCount    int64
+	// Errors are the errors the statement raised.
+	Errors []Error
+}
+
+// ReturnValueToken holds the value of an output parameter or the result
+// of a user defined function called with RPC.
+type ReturnValueToken struct {
+	// Name is the name of the parameter, without the leading "@".
+	Name  string
+	Value interface{}
+}
+
+// MessageToken is an informational message, such as the output of PRINT.
+type MessageToken Error
+
+func (ColumnsToken) isToken()     {}
+func (RowToken) isToken()         {}
+func (DoneToken) isToken()        {}
+func (ReturnStatus) isToken()     {}
+func (ReturnValueToken) isToken() {}
+func (MessageToken) isToken()     {}
+
+// TokenStream reads the tokens of the response to a request of a RawConn.
+type TokenStream struct {
+	c      *Conn
+	ctx    context.Context
+	reader *tokenProcessor
+	err    error
+}
+
+// Next returns the next token of the response, or io.EOF after the last
+// one. When the context of the request ends, the request is canceled and
+// the error of the context returned. Errors raised by statements are in
+// the Errors of their DoneToken, and do not end the stream.
+func (s *TokenStream) Next() (Token, error) {
+	for s.err == nil {
+		tok, err := s.reader.nextToken()
+		if err != nil {
+			s.err = s.c.checkBadConn(s.ctx, err, false)
+			break
+		}
+		switch tok := tok.(type) {
+		case nil:
+			s.err = io.EOF
+		case []columnStruct:
+			return rawColumns(tok), nil
+		case []interface{}:
+			return RowToken(tok), nil
+		case doneStruct:
+			return doneToken(tok, false), nil
+		case doneInProcStruct:
+			return doneToken(doneStruct(tok), true), nil
+		case ReturnStatus:
+			return tok, nil
+		case ReturnValueToken:
+			return tok, nil
+		case MessageToken:
+			return tok, nil
+		}
+	}
+	return nil, s.err
+}
+
+// Close reads the rest of the response.
+func (s *TokenStream) Close() error {
+	for {
+		if _, err := s.Next(); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+func rawColumns(cols []columnStruct) ColumnsToken {
+	res := make(ColumnsToken, len(cols))
+	for i, col := range cols {
+		ti := col.originalTypeInfo()
+		res[i].Name = col.ColName
+		res[i].DatabaseTypeName = makeGoLangTypeName(ti)
+		res[i].Length, _ = makeGoLangTypeLength(ti)
+		res[i].Nullable, _ = columnNullable(col)
+	}
+	return res
+}
+
+func doneToken(d doneStruct, inProc bool) DoneToken {
+	return DoneToken{
+		More:        d.Status&doneMore != 0,
+		InProc:      inProc,
+		HasRowCount: d.Status&doneCount != 0,
+		RowCount:    int64(d.RowCount),
+		Errors:      d.errors,
+	}
+}
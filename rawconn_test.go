@@ -0,0 +1,186 @@
+package mssql
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/binary"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestRawConnExecBatch(t *testing.T) {
+	var tokens bytes.Buffer
+	tokens.Write(makeInfoToken(0, 0, "hello"))
+	tokens.WriteByte(byte(tokenReturnStatus))
+	_ = binary.Write(&tokens, binary.LittleEndian, int32(3))
+	tokens.WriteByte(byte(tokenDone))
+	_ = binary.Write(&tokens, binary.LittleEndian, []uint16{doneCount, 0})
+	_ = binary.Write(&tokens, binary.LittleEndian, uint64(2))
+	reply := bytes.NewBuffer([]byte{byte(packReply), statusEOM, 0, byte(8 + tokens.Len()), 0, 0, 1, 0})
+	reply.Write(tokens.Bytes())
+
+	transport := &replyTransport{reply: reply}
+	r := &RawConn{c: &Conn{
+		connectionGood: true,
+		sess: &tdsSession{
+			buf:    newTdsBuffer(defaultPacketSize, transport),
+			logger: optionalLogger{},
+		},
+	}}
+	s, err := r.ExecBatch(context.Background(), "print 'hello'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []Token
+	for {
+		tok, err := s.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, tok)
+	}
+	if len(got) != 3 {
+		t.Fatalf("got tokens %#v, want a message, a return status and a done", got)
+	}
+	if msg, ok := got[0].(MessageToken); !ok || msg.Message != "hello" {
+		t.Errorf("got %#v, want the message hello", got[0])
+	}
+	if got[1] != ReturnStatus(3) {
+		t.Errorf("got %#v, want return status 3", got[1])
+	}
+	if done, ok := got[2].(DoneToken); !ok || done.More || !done.HasRowCount || done.RowCount != 2 {
+		t.Errorf("got %#v, want the last done of 2 rows", got[2])
+	}
+	if packets := transport.packets(); len(packets) != 1 || packets[0][0] != byte(packSQLBatch) {
+		t.Errorf("got packets %x, want a SQL batch", packets)
+	}
+}
+
+func TestRawConnRPCClearsOutputs(t *testing.T) {
+	var tokens bytes.Buffer
+	tokens.WriteByte(byte(tokenDone))
+	_ = binary.Write(&tokens, binary.LittleEndian, []uint16{0, 0})
+	_ = binary.Write(&tokens, binary.LittleEndian, uint64(0))
+	reply := bytes.NewBuffer([]byte{byte(packReply), statusEOM, 0, byte(8 + tokens.Len()), 0, 0, 1, 0})
+	reply.Write(tokens.Bytes())
+	r := &RawConn{c: &Conn{
+		connectionGood: true,
+		sess: &tdsSession{
+			buf:    newTdsBuffer(defaultPacketSize, &replyTransport{reply: reply}),
+			logger: optionalLogger{},
+		},
+	}}
+	var out int64
+	s, err := r.RPC(context.Background(), "sp_test", sql.Named("out", sql.Out{Dest: &out}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if r.c.outs.params != nil {
+		t.Errorf("the output destinations %v were kept after the RPC", r.c.outs.params)
+	}
+}
+
+func TestRawConnRPCBatch(t *testing.T) {
+	var tokens bytes.Buffer
+	for _, status := range []uint16{doneMore, 0} {
+		tokens.WriteByte(byte(tokenDoneProc))
+		_ = binary.Write(&tokens, binary.LittleEndian, []uint16{status, 0})
+		_ = binary.Write(&tokens, binary.LittleEndian, uint64(0))
+	}
+	reply := bytes.NewBuffer([]byte{byte(packReply), statusEOM, 0, byte(8 + tokens.Len()), 0, 0, 1, 0})
+	reply.Write(tokens.Bytes())
+	transport := &countingTransport{replyTransport: replyTransport{reply: reply}}
+	r := &RawConn{c: &Conn{
+		connectionGood: true,
+		sess: &tdsSession{
+			buf:      newTdsBuffer(defaultPacketSize, transport),
+			logger:   optionalLogger{},
+			loginAck: loginAckStruct{TDSVersion: verTDS74},
+		},
+	}}
+	r.c.sess.buf.SetCoalesce(true)
+	s, err := r.RPCBatch(context.Background(), RPCCall{Proc: "sp_a", Args: []interface{}{int64(1)}}, RPCCall{Proc: "sp_b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dones int
+	for {
+		tok, err := s.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, ok := tok.(DoneToken); ok {
+			dones++
+		}
+	}
+	if dones != 2 {
+		t.Errorf("got %d done tokens, want one per call", dones)
+	}
+	if transport.writes != 1 {
+		t.Errorf("got %d writes, want the calls in one write", transport.writes)
+	}
+	packets := transport.packets()
+	if len(packets) != 1 || packets[0][0] != byte(packRPCRequest) {
+		t.Fatalf("got packets %x, want one RPC request", packets)
+	}
+	second := append([]byte{rpcBatchFlag, 4, 0}, str2ucs2("sp_b")...)
+	if !bytes.Contains(packets[0], second) {
+		t.Errorf("got packet %x, want sp_b after the batch flag", packets[0])
+	}
+
+	if _, err = r.RPCBatch(context.Background()); err == nil {
+		t.Error("a batch without calls was accepted")
+	}
+}
+
+type countingTransport struct {
+	replyTransport
+	writes int
+}
+
+func (t *countingTransport) Write(p []byte) (int, error) {
+	t.writes++
+	return t.replyTransport.Write(p)
+}
+
+func TestTokenStreamNext(t *testing.T) {
+	tokChan := make(chan tokenStruct, 5)
+	tokChan <- []columnStruct{{ColName: "id", Flags: colFlagNullable, ti: typeInfo{TypeId: typeIntN, Size: 4}}}
+	tokChan <- []interface{}{int64(1)}
+	tokChan <- doneStruct{Status: doneMore | doneError, errors: []Error{{Number: 547}}}
+	tokChan <- doneInProcStruct{Status: doneCount, RowCount: 1}
+	close(tokChan)
+	c := &Conn{connectionGood: true, sess: &tdsSession{}}
+	s := &TokenStream{c: c, ctx: context.Background(), reader: &tokenProcessor{tokChan: tokChan, ctx: context.Background(), sess: c.sess}}
+
+	want := []Token{
+		ColumnsToken{{Name: "id", DatabaseTypeName: "INT", Nullable: true}},
+		RowToken{int64(1)},
+		DoneToken{More: true, Errors: []Error{{Number: 547}}},
+		DoneToken{InProc: true, HasRowCount: true, RowCount: 1},
+	}
+	for i, w := range want {
+		tok, err := s.Next()
+		if err != nil {
+			t.Fatalf("token %d: %v", i, err)
+		}
+		if !reflect.DeepEqual(tok, w) {
+			t.Errorf("token %d is %#v, want %#v", i, tok, w)
+		}
+	}
+	if _, err := s.Next(); err != io.EOF {
+		t.Errorf("got %v after the last token, want io.EOF", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Errorf("Close after the last token failed: %v", err)
+	}
+}
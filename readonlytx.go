@@ -0,0 +1,42 @@
+package mssql
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+)
+
+// checkReadOnlyDatabase returns an error matching ErrReadOnlyTx unless the
+// current database of the connection is read-only, such as a database of
+// a readable secondary replica reached with ApplicationIntent=ReadOnly, a
+// database set READ_ONLY or a database snapshot. SQL Server has no
+// read-only transactions, so a transaction can only be held to reads by
+// the database it runs in.
+func (c *Conn) checkReadOnlyDatabase(ctx context.Context) error {
+	q := Stmt{c: c,
+		paramCount:     -1,
+		query:          "select db_name(), convert(nvarchar(60), databasepropertyex(db_name(), 'Updateability'))",
+		skipEncryption: true,
+	}
+	oldouts := c.outs
+	c.clearOuts()
+	defer func() { c.outs = oldouts }()
+
+	rows, err := q.queryContext(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	values := make([]driver.Value, 2)
+	if err = rows.Next(values); err != nil {
+		if err == io.EOF {
+			err = fmt.Errorf("mssql: cannot read the updateability of the database: %w", ErrReadOnlyTx)
+		}
+		return err
+	}
+	if values[1] == "READ_ONLY" {
+		return nil
+	}
+	return fmt.Errorf("mssql: cannot begin a read-only transaction in database %v, which is %v; connect with ApplicationIntent=ReadOnly to a readable secondary replica: %w", values[0], values[1], ErrReadOnlyTx)
+}
@@ -0,0 +1,66 @@
+package mssql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strings"
+)
+
+// RequestIDKey is the key of the session context value holding the
+// request ID of WithRequestID, read in T-SQL with
+// SESSION_CONTEXT(N'mssql_request_id').
+const RequestIDKey = "mssql_request_id"
+
+// WithRequestID returns a context that tags the statements run with it
+// with id, an application-supplied token identifying a request, so that
+// a mutation whose outcome is unknown, because its connection broke or its
+// context expired before the server answered, can be looked up instead of
+// being retried blindly. The text of each statement starts with a
+// /*request_id='...'*/ comment, visible in the DMVs, Query Store and
+// traces, and the statement first sets the RequestIDKey session context
+// value to id, so that the mutation can record it in the same transaction,
+// such as with
+//
+//	insert into dbo.requests (request_id) values (cast(session_context(N'mssql_request_id') as nvarchar(100)))
+//
+// or a default constraint of the same expression. RequestCommitted then
+// tells whether it committed. The session context value stays set on the
+// connection until the next statement with a request ID.
+//
+// Like the other statement options, a request ID cannot be applied to a
+// stored procedure call; call it with EXEC in the statement instead. An
+// empty id removes the request ID of ctx.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	opts := queryOptionsFromContext(ctx)
+	opts.requestID = id
+	return context.WithValue(ctx, queryOptionsKey{}, opts)
+}
+
+// requestIDStatements returns the comment and the statement setting the
+// session context of the request ID id.
+func requestIDStatements(id string) (string, error) {
+	if strings.Contains(id, "*/") || strings.Contains(id, "/*") {
+		return "", errors.New("mssql: a request ID cannot contain /* or */")
+	}
+	return "/*request_id=" + sqlString(id) + "*/" +
+		"EXEC sys.sp_set_session_context N'" + RequestIDKey + "', N" + sqlString(id) + ";", nil
+}
+
+// RequestCommitted reports whether a row with the request ID id in column
+// of table has committed, for a mutation run with WithRequestID that
+// recorded its request ID in table. table and column are written as is in
+// the query, so they can be qualified and must be trusted.
+//
+// The row is read with the READCOMMITTEDLOCK hint: when the mutation is
+// still running, RequestCommitted waits for it to commit or roll back,
+// even on a database with read committed snapshot isolation, whose reads
+// would not see an uncommitted row. Bound the wait with ctx.
+func RequestCommitted(ctx context.Context, db *sql.DB, table, column, id string) (bool, error) {
+	var n int
+	err := db.QueryRowContext(ctx, "select count(*) from "+table+" with (readcommittedlock) where "+column+" = @p1", id).Scan(&n)
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
@@ -0,0 +1,113 @@
+package mssql
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// roleChangeErrors are the numbers of the errors returned by an
+// availability replica that changed role, or is changing role, during a
+// failover.
+var roleChangeErrors = map[int32]bool{
+	976:  true, // the replica is not in the PRIMARY or SECONDARY role
+	978:  true, // the database only accepts read-only intent connections
+	983:  true, // the replica role is RESOLVING
+	3948: true, // the transaction was ended by the replica state change
+}
+
+// retryReadOnly reports whether the query of s, which failed with err
+// before returning rows, is retried on a new connection: the retryreadonly
+// parameter is set with a read-only application intent, the connection
+// is outside of a transaction and the query is a single SELECT statement.
+// The connection is marked bad when err reports a role change of the
+// replica, so it leaves the pool and the new one is routed again.
+func (s *Stmt) retryReadOnly(err error) bool {
+	c := s.c
+	if c.connector == nil || c.sess == nil {
+		return false
+	}
+	p := c.connector.params
+	if !p.ReadOnlyIntent || !p.RetryReadOnly || c.sess.tranid != 0 || !isSelectStatement(s.query) {
+		return false
+	}
+	var sqlErr Error
+	if errors.As(err, &sqlErr) && roleChangeErrors[sqlErr.Number] {
+		c.connectionGood = false
+	}
+	return !c.connectionGood
+}
+
+// isSelectStatement reports whether query is a single SELECT statement,
+// which can run again without side effects. Statements that write, such as
+// SELECT ... INTO, and batches of several statements are not.
+func isSelectStatement(query string) bool {
+	words := sqlWords(query)
+	if len(words) == 0 || words[0] != "select" {
+		return false
+	}
+	for _, w := range words[1:] {
+		switch w {
+		case "into", ";":
+			return false
+		}
+	}
+	return true
+}
+
+// sqlWords returns the lower case keywords and identifiers of query, and
+// ";" for each statement separator but a trailing one, leaving out
+// comments, string literals and quoted identifiers.
+func sqlWords(query string) []string {
+	var words []string
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case strings.HasPrefix(query[i:], "--"):
+			if n := strings.IndexByte(query[i:], '\n'); n >= 0 {
+				i += n + 1
+			} else {
+				i = len(query)
+			}
+		case strings.HasPrefix(query[i:], "/*"):
+			if n := strings.Index(query[i+2:], "*/"); n >= 0 {
+				i += n + 4
+			} else {
+				i = len(query)
+			}
+		case c == '\'' || c == '"' || c == '[':
+			end := byte(']')
+			if c != '[' {
+				end = c
+			}
+			i++
+			for i < len(query) {
+				if query[i] == end {
+					// A doubled closing character stands for itself.
+					if i+1 < len(query) && query[i+1] == end {
+						i += 2
+						continue
+					}
+					break
+				}
+				i++
+			}
+			i++
+		case c == ';':
+			if strings.TrimFunc(query[i+1:], unicode.IsSpace) != "" {
+				words = append(words, ";")
+			}
+			i++
+		case c == '_' || c == '@' || c == '#' || unicode.IsLetter(rune(c)):
+			start := i
+			for i < len(query) && (query[i] == '_' || query[i] == '@' || query[i] == '#' || query[i] == '$' ||
+				unicode.IsLetter(rune(query[i])) || unicode.IsDigit(rune(query[i]))) {
+				i++
+			}
+			words = append(words, strings.ToLower(query[start:i]))
+		default:
+			i++
+		}
+	}
+	return words
+}
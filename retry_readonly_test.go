@@ -0,0 +1,71 @@
+package mssql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/microsoft/go-mssqldb/msdsn"
+)
+
+func TestIsSelectStatement(t *testing.T) {
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"select 1", true},
+		{"  -- totals\n SELECT id, name FROM dbo.orders WHERE note = 'into; x';", true},
+		{"/* into */ select [into] from t", true},
+		{"select * into #copy from t", false},
+		{"select 1; delete from t", false},
+		{"with c as (select 1 as n) select n from c", false},
+		{"update t set a = 1", false},
+		{"sp_who", false},
+		{"", false},
+	}
+	for _, tst := range tests {
+		if got := isSelectStatement(tst.query); got != tst.want {
+			t.Errorf("isSelectStatement(%q) = %t, want %t", tst.query, got, tst.want)
+		}
+	}
+}
+
+func TestRetryReadOnly(t *testing.T) {
+	newStmt := func(query string, retry bool) *Stmt {
+		connector := &Connector{params: msdsn.Config{ReadOnlyIntent: true, RetryReadOnly: retry}}
+		return &Stmt{c: &Conn{connector: connector, sess: &tdsSession{}, connectionGood: true}, query: query}
+	}
+
+	s := newStmt("select 1", true)
+	if s.retryReadOnly(Error{Number: 208}) {
+		t.Error("an error on a good connection should not be retried")
+	}
+	if !s.retryReadOnly(Error{Number: 983}) || s.c.connectionGood {
+		t.Error("a role change should be retried on a new connection")
+	}
+
+	s = newStmt("select 1", true)
+	s.c.connectionGood = false
+	if !s.retryReadOnly(io.EOF) {
+		t.Error("a broken connection should be retried")
+	}
+	if err := s.c.checkBadConn(context.Background(), io.EOF, true); !errors.Is(err, driver.ErrBadConn) {
+		t.Errorf("got %v, want an error database/sql retries", err)
+	}
+
+	for _, s := range []*Stmt{
+		newStmt("select 1", false),
+		newStmt("delete from t", true),
+	} {
+		if s.retryReadOnly(Error{Number: 983}) {
+			t.Errorf("%q should not be retried", s.query)
+		}
+	}
+	s = newStmt("select 1", true)
+	s.c.sess.tranid = 1
+	if s.retryReadOnly(Error{Number: 983}) {
+		t.Error("a statement in a transaction should not be retried")
+	}
+}
@@ -0,0 +1,53 @@
+package mssql
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+
+	"github.com/microsoft/go-mssqldb/msdsn"
+)
+
+// maxRoutings is the number of times a connection follows the routing
+// ENVCHANGE of a login before giving up, so that misconfigured servers
+// routing to each other do not loop forever.
+const maxRoutings = 10
+
+// routedConfig returns p pointed at the server a login routed the
+// connection to with a routing ENVCHANGE: server, in the "host" or
+// "host\instance" form, listening on port. Gateways under the redirect
+// connection policy of Azure SQL Database and Managed Instance route to
+// the node hosting the database, on a port from 11000 to 11999, and
+// read-only routing listeners to a readable secondary replica. The TLS
+// handshake with the new server sends its host name, and checks its
+// certificate for it, unless hostnameincertificate was given.
+func routedConfig(p msdsn.Config, server string, port uint16) msdsn.Config {
+	parts := strings.SplitN(server, "\\", 2)
+	p.Host = parts[0]
+	p.Instance = ""
+	if len(parts) == 2 {
+		p.Instance = parts[1]
+	}
+	p.Port = uint64(port)
+	if !p.HostInCertificateProvided && p.TLSConfig != nil {
+		p.TLSConfig = p.TLSConfig.Clone()
+		p.TLSConfig.ServerName = p.Host
+	}
+	return p
+}
+
+// serverAddress returns the "host:port" address of the server of p, with
+// the default port when none is set.
+func serverAddress(p msdsn.Config) string {
+	return net.JoinHostPort(p.Host, strconv.FormatUint(resolveServerPort(p.Port), 10))
+}
+
+// routedDialError wraps err, the error dialing the server at addr that
+// the server at from routed the connection to.
+func routedDialError(addr, from string, port uint64, err error) error {
+	if port >= 11000 && port <= 11999 {
+		return fmt.Errorf("mssql: unable to reach %s, where %s redirected the connection; the redirect connection policy needs outbound access to ports 11000 to 11999: %w", addr, from, err)
+	}
+	return fmt.Errorf("mssql: unable to reach %s, where %s routed the connection: %w", addr, from, err)
+}
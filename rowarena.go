@@ -0,0 +1,64 @@
+package mssql
+
+// rowArena holds the binary and character values of the rows read with
+// WithRawBytes, the values of each row in one of a ring of slabs.
+type rowArena struct {
+	slabs [][]byte
+	next  int
+	cur   []byte
+}
+
+// newRowArena returns an arena for a reader that can be readAhead tokens
+// ahead of its consumer. The values of that many rows wait in the token
+// channel, with those of the row the reader blocks on while the channel is
+// full and of the current row of the consumer, so the slab of a row is
+// reused for the row readAhead+2 rows later, when the consumer has moved
+// past it.
+func newRowArena(readAhead int) *rowArena {
+	return &rowArena{slabs: make([][]byte, readAhead+2)}
+}
+
+// beginRow starts the values of a new row and returns a. It does nothing
+// on a nil arena.
+func (a *rowArena) beginRow() *rowArena {
+	if a == nil {
+		return nil
+	}
+	if a.cur != nil {
+		a.slabs[a.next] = a.cur[:0]
+		a.next = (a.next + 1) % len(a.slabs)
+	}
+	a.cur = a.slabs[a.next][:0]
+	return a
+}
+
+// alloc returns n bytes of the current slab, which cannot be appended to
+// without copying.
+func (a *rowArena) alloc(n int) []byte {
+	l := len(a.cur)
+	if l+n > cap(a.cur) {
+		// The values already read keep the previous array, which is
+		// left to the garbage collector.
+		size := 2 * cap(a.cur)
+		if size < n {
+			size = n
+		}
+		if size < 512 {
+			size = 512
+		}
+		a.cur, l = make([]byte, 0, size), 0
+	}
+	a.cur = a.cur[:l+n]
+	return a.cur[l : l+n : l+n]
+}
+
+// isASCII reports whether b holds only ASCII characters, which read the
+// same in the code pages of the collations as in UTF-8.
+func isASCII(b []byte) bool {
+	for _, c := range b {
+		if c >= 0x80 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,79 @@
+package mssql
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/binary"
+	"testing"
+)
+
+func TestRowArenaKeepsRowsInFlight(t *testing.T) {
+	const readAhead = 3
+	a := newRowArena(readAhead)
+	var rows [][]byte
+	for i := 0; i < 10*readAhead; i++ {
+		a.beginRow()
+		v := a.alloc(4)
+		binary.BigEndian.PutUint32(v, uint32(i))
+		rows = append(rows, v)
+		// The rows the reader can be ahead of the consumer by must be
+		// intact.
+		first := i - readAhead - 1
+		if first < 0 {
+			first = 0
+		}
+		for j := first; j <= i; j++ {
+			if got := binary.BigEndian.Uint32(rows[j]); got != uint32(j) {
+				t.Fatalf("row %d holds %d after reading row %d", j, got, i)
+			}
+		}
+	}
+	if cap(rows[0]) != 4 {
+		t.Errorf("alloc returned a slice of capacity %d, want 4", cap(rows[0]))
+	}
+}
+
+func TestRowArenaGrows(t *testing.T) {
+	a := newRowArena(tokenChanSize)
+	a.beginRow()
+	small := a.alloc(10)
+	copy(small, "0123456789")
+	big := a.alloc(4000)
+	if len(big) != 4000 {
+		t.Fatalf("got %d bytes, want 4000", len(big))
+	}
+	if string(small) != "0123456789" {
+		t.Errorf("growing the arena changed an earlier value to %q", small)
+	}
+}
+
+func TestReadShortLenTypeWithArena(t *testing.T) {
+	data := []byte{3, 0, 'a', 'b', 'c', 2, 0, 0xe9, 0x01}
+	r := &tdsBuffer{rbuf: data, rsize: len(data), arena: newRowArena(tokenChanSize).beginRow()}
+	latin1 := typeInfo{TypeId: typeBigVarChar, Size: 10, Buffer: make([]byte, 10)}
+	latin1.Collation.LcidAndFlags = 0x0409
+	latin1.Collation.SortId = 52
+
+	v := readShortLenType(&latin1, r, nil)
+	b, ok := v.([]byte)
+	if !ok || string(b) != "abc" {
+		t.Fatalf("got %#v, want []byte(\"abc\")", v)
+	}
+	// Non-ASCII text is decoded from the code page of the column.
+	v = readShortLenType(&latin1, r, nil)
+	if b, ok := v.([]byte); !ok || !bytes.Equal(b, []byte("é\x01")) {
+		t.Fatalf("got %#v, want []byte(\"é\\x01\")", v)
+	}
+
+	var raw sql.RawBytes
+	bin := typeInfo{TypeId: typeBigVarBin, Size: 4, Buffer: make([]byte, 4)}
+	data = []byte{2, 0, 0xca, 0xfe}
+	r.rbuf, r.rpos, r.rsize = data, 0, len(data)
+	raw = readShortLenType(&bin, r, nil).([]byte)
+	if !bytes.Equal(raw, []byte{0xca, 0xfe}) {
+		t.Fatalf("got %x, want cafe", raw)
+	}
+	if &raw[0] != &r.arena.cur[len(r.arena.cur)-2] {
+		t.Error("varbinary value was not read into the arena")
+	}
+}
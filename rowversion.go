@@ -0,0 +1,70 @@
+package mssql
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/binary"
+	"fmt"
+)
+
+// RowVersion is the value of a rowversion, or timestamp, column: a number
+// the database increases each time a row is inserted or updated. Scan the
+// column into a RowVersion and pass it back as a parameter to update a row
+// only when it did not change since it was read:
+//
+//	var rv mssql.RowVersion
+//	err := db.QueryRowContext(ctx, "select name, rv from t where id = @p1", id).Scan(&name, &rv)
+//	...
+//	res, err := db.ExecContext(ctx, "update t set name = @p1 where id = @p2 and rv = @p3", name, id, rv)
+//
+// and check that the update affected a row. It is sent as binary(8).
+type RowVersion [8]byte
+
+// RowVersionFromUint64 returns the RowVersion of n.
+func RowVersionFromUint64(n uint64) RowVersion {
+	var rv RowVersion
+	binary.BigEndian.PutUint64(rv[:], n)
+	return rv
+}
+
+// Uint64 returns rv as a number, which is what the bigint obtained by
+// casting the column holds.
+func (rv RowVersion) Uint64() uint64 {
+	return binary.BigEndian.Uint64(rv[:])
+}
+
+// Compare returns -1, 0 or 1 when rv was written before, at the same time
+// as or after other. Comparing them as []byte values with == does not
+// work, and neither does comparing them as strings of another byte order.
+func (rv RowVersion) Compare(other RowVersion) int {
+	return bytes.Compare(rv[:], other[:])
+}
+
+// String returns rv in hexadecimal, the way SQL Server shows it, such as
+// 0x00000000000007D1.
+func (rv RowVersion) String() string {
+	return fmt.Sprintf("0x%X", rv[:])
+}
+
+// Scan reads a rowversion or binary(8) column, or a bigint obtained by
+// casting one.
+func (rv *RowVersion) Scan(v interface{}) error {
+	switch vt := v.(type) {
+	case []byte:
+		if len(vt) != len(rv) {
+			return fmt.Errorf("mssql: invalid RowVersion length %d", len(vt))
+		}
+		copy(rv[:], vt)
+		return nil
+	case int64:
+		*rv = RowVersionFromUint64(uint64(vt))
+		return nil
+	default:
+		return fmt.Errorf("mssql: cannot convert %T to RowVersion", v)
+	}
+}
+
+// Value returns the bytes of rv.
+func (rv RowVersion) Value() (driver.Value, error) {
+	return rv[:], nil
+}
@@ -0,0 +1,38 @@
+package mssql
+
+import (
+	"testing"
+)
+
+func TestRowVersion(t *testing.T) {
+	var rv RowVersion
+	if err := rv.Scan([]byte{0, 0, 0, 0, 0, 0, 0x07, 0xd1}); err != nil {
+		t.Fatal(err)
+	}
+	if rv.Uint64() != 2001 || rv.String() != "0x00000000000007D1" {
+		t.Errorf("got %d, %s", rv.Uint64(), rv)
+	}
+	if rv != RowVersionFromUint64(2001) {
+		t.Error("RowVersionFromUint64 does not match the scanned value")
+	}
+	earlier := RowVersionFromUint64(0x100)
+	if rv.Compare(earlier) != 1 || earlier.Compare(rv) != -1 || rv.Compare(rv) != 0 {
+		t.Error("Compare does not order the versions")
+	}
+	if err := rv.Scan(int64(0x100)); err != nil || rv != earlier {
+		t.Errorf("got %s, %v scanning a bigint", rv, err)
+	}
+	for _, v := range []interface{}{[]byte{1, 2}, "0x01", nil} {
+		if err := rv.Scan(v); err == nil {
+			t.Errorf("scanning %#v did not fail", v)
+		}
+	}
+
+	p, err := (&Stmt{}).makeParam(earlier)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decl := makeDecl(p.ti); decl != "binary(8)" || string(p.buffer) != string(earlier[:]) {
+		t.Errorf("got parameter %s %x", decl, p.buffer)
+	}
+}
@@ -23,6 +23,9 @@ type param struct {
 	buffer     []byte
 	tiOriginal typeInfo
 	cipherInfo []byte
+	// stream, when set, writes the rest of the value after buffer while
+	// the request is sent, such as the rows of a TVP read from TVPRows.
+	stream func(w *tdsBuffer) error
 }
 
 var (
@@ -42,10 +45,44 @@ var (
 	sp_Unprepare       = procId{15, ""}
 )
 
+// rpcCall is one of the procedure calls of an RPC request.
+type rpcCall struct {
+	proc   procId
+	flags  uint16
+	params []param
+}
+
+// Separators of the calls of an RPC request holding several calls.
+const (
+	rpcBatchFlag   = 0xff
+	rpcBatchFlag71 = 0x80 // before TDS 7.2
+)
+
 // http://msdn.microsoft.com/en-us/library/dd357576.aspx
 func sendRpc(buf *tdsBuffer, headers []headerStruct, proc procId, flags uint16, params []param, resetSession bool) (err error) {
+	return sendRpcBatch(buf, headers, []rpcCall{{proc, flags, params}}, rpcBatchFlag, resetSession)
+}
+
+// sendRpcBatch sends calls in a single RPC request, separated by
+// batchFlag. The server runs them in order and answers with the response
+// of each one, ended by its DONEPROC.
+func sendRpcBatch(buf *tdsBuffer, headers []headerStruct, calls []rpcCall, batchFlag byte, resetSession bool) (err error) {
 	buf.BeginPacket(packRPCRequest, resetSession)
 	writeAllHeaders(buf, headers)
+	for i, call := range calls {
+		if i > 0 {
+			if err = buf.WriteByte(batchFlag); err != nil {
+				return
+			}
+		}
+		if err = writeRpcCall(buf, call.proc, call.flags, call.params); err != nil {
+			return
+		}
+	}
+	return buf.FinishPacket()
+}
+
+func writeRpcCall(buf *tdsBuffer, proc procId, flags uint16, params []param) (err error) {
 	if len(proc.name) == 0 {
 		var idswitch uint16 = 0xffff
 		err = binary.Write(buf, binary.LittleEndian, &idswitch)
@@ -81,6 +118,11 @@ func sendRpc(buf *tdsBuffer, headers []headerStruct, proc procId, flags uint16,
 		if err != nil {
 			return
 		}
+		if param.stream != nil {
+			if err = param.stream(buf); err != nil {
+				return
+			}
+		}
 		if (param.Flags & fEncrypted) == fEncrypted {
 			err = writeTypeInfo(buf, &param.tiOriginal, false)
 			if err != nil {
@@ -91,5 +133,5 @@ func sendRpc(buf *tdsBuffer, headers []headerStruct, proc procId, flags uint16,
 			}
 		}
 	}
-	return buf.FinishPacket()
+	return nil
 }
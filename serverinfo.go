@@ -0,0 +1,122 @@
+package mssql
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"io"
+)
+
+// Engine editions returned by SERVERPROPERTY('EngineEdition').
+const (
+	engineEditionAzureSQLDatabase  = 5
+	engineEditionAzureSynapse      = 6
+	engineEditionManagedInstance   = 8
+	engineEditionSynapseServerless = 11
+)
+
+// ServerVersion is the version of SQL Server, such as 16.0.4085 for
+// SQL Server 2022.
+type ServerVersion struct {
+	Major uint8
+	Minor uint8
+	Build uint16
+}
+
+func (v ServerVersion) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Build)
+}
+
+// serverVersion returns the version of the ProgVer field of a login
+// acknowledgement.
+func serverVersion(progVer uint32) ServerVersion {
+	return ServerVersion{
+		Major: uint8(progVer >> 24),
+		Minor: uint8(progVer >> 16),
+		Build: uint16(progVer),
+	}
+}
+
+// ServerInfo describes the server of a connection, as returned by
+// Conn.ServerInfo.
+type ServerInfo struct {
+	// Version is the version of the server sent in its login
+	// acknowledgement.
+	Version ServerVersion
+	// ProductVersion is SERVERPROPERTY('ProductVersion'), the full version
+	// of the server, such as "16.0.4085.2".
+	ProductVersion string
+	// ProductLevel is SERVERPROPERTY('ProductLevel'), such as "RTM" or
+	// "SP1".
+	ProductLevel string
+	// Edition is SERVERPROPERTY('Edition'), such as "Enterprise Edition:
+	// Core-based Licensing (64-bit)" or "SQL Azure".
+	Edition string
+	// EngineEdition is SERVERPROPERTY('EngineEdition'), such as 3 for the
+	// Enterprise and Developer editions or 5 for Azure SQL Database.
+	EngineEdition int
+	// IsAzure is set for the Azure SQL services: Azure SQL Database, Azure
+	// SQL Managed Instance and Azure Synapse Analytics.
+	IsAzure bool
+	// IsManagedInstance is set for Azure SQL Managed Instance.
+	IsManagedInstance bool
+}
+
+const serverInfoQuery = "select cast(serverproperty('ProductVersion') as nvarchar(128)), " +
+	"cast(serverproperty('ProductLevel') as nvarchar(128)), " +
+	"cast(serverproperty('Edition') as nvarchar(128)), " +
+	"cast(serverproperty('EngineEdition') as int)"
+
+// ServerInfo returns the version, edition and engine of the server of the
+// connection, so applications can check what the server supports. The
+// server properties are queried the first time it is called and kept for
+// the life of the connection.
+// Use sql.Conn.Raw to reach the underlying *mssql.Conn.
+func (c *Conn) ServerInfo(ctx context.Context) (ServerInfo, error) {
+	if c.sess == nil || !c.connectionGood {
+		return ServerInfo{}, driver.ErrBadConn
+	}
+	if c.sess.serverInfo != nil {
+		return *c.sess.serverInfo, nil
+	}
+	stmt, err := c.prepareContext(ctx, serverInfoQuery)
+	if err != nil {
+		return ServerInfo{}, err
+	}
+	defer stmt.Close()
+	rows, err := stmt.queryContext(ctx, nil)
+	if err != nil {
+		return ServerInfo{}, err
+	}
+	defer rows.Close()
+	row := make([]driver.Value, 4)
+	if err = rows.Next(row); err != nil {
+		if err == io.EOF {
+			err = fmt.Errorf("mssql: the server properties query returned no row")
+		}
+		return ServerInfo{}, err
+	}
+	info := newServerInfo(c.sess.loginAck, row)
+	c.sess.serverInfo = &info
+	return info, nil
+}
+
+// newServerInfo returns the ServerInfo of the login acknowledgement and of
+// the row of serverInfoQuery.
+func newServerInfo(ack loginAckStruct, row []driver.Value) ServerInfo {
+	info := ServerInfo{Version: serverVersion(ack.ProgVer)}
+	info.ProductVersion, _ = row[0].(string)
+	info.ProductLevel, _ = row[1].(string)
+	info.Edition, _ = row[2].(string)
+	if e, ok := row[3].(int64); ok {
+		info.EngineEdition = int(e)
+	}
+	switch info.EngineEdition {
+	case engineEditionAzureSQLDatabase, engineEditionAzureSynapse, engineEditionSynapseServerless:
+		info.IsAzure = true
+	case engineEditionManagedInstance:
+		info.IsAzure = true
+		info.IsManagedInstance = true
+	}
+	return info
+}
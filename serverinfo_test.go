@@ -0,0 +1,71 @@
+package mssql
+
+import (
+	"context"
+	"database/sql/driver"
+	"strings"
+	"testing"
+)
+
+func TestNewServerInfo(t *testing.T) {
+	ack := loginAckStruct{ProgVer: 0x10000fa1}
+	info := newServerInfo(ack, []driver.Value{"16.0.4001.0", "RTM", "SQL Azure", int64(8)})
+	want := ServerInfo{
+		Version:           ServerVersion{Major: 16, Minor: 0, Build: 4001},
+		ProductVersion:    "16.0.4001.0",
+		ProductLevel:      "RTM",
+		Edition:           "SQL Azure",
+		EngineEdition:     8,
+		IsAzure:           true,
+		IsManagedInstance: true,
+	}
+	if info != want {
+		t.Errorf("got %+v, want %+v", info, want)
+	}
+	if s := info.Version.String(); s != "16.0.4001" {
+		t.Errorf("got version %q", s)
+	}
+
+	info = newServerInfo(ack, []driver.Value{"16.0.4001.0", "RTM", "Developer Edition (64-bit)", int64(3)})
+	if info.IsAzure || info.IsManagedInstance {
+		t.Errorf("a boxed server should not be Azure: %+v", info)
+	}
+	if info = newServerInfo(ack, []driver.Value{nil, nil, nil, int64(5)}); !info.IsAzure || info.IsManagedInstance {
+		t.Errorf("Azure SQL Database got %+v", info)
+	}
+}
+
+func TestConnServerInfo(t *testing.T) {
+	pool, logger := open(t)
+	defer pool.Close()
+	defer logger.StopLogging()
+
+	ctx := context.Background()
+	conn, err := pool.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var info, again ServerInfo
+	err = conn.Raw(func(dc interface{}) error {
+		c := dc.(*Conn)
+		if info, err = c.ServerInfo(ctx); err != nil {
+			return err
+		}
+		again, err = c.ServerInfo(ctx)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info != again {
+		t.Errorf("the second call got %+v, want %+v", again, info)
+	}
+	if !strings.HasPrefix(info.ProductVersion, info.Version.String()) {
+		t.Errorf("product version %q does not start with the version %s", info.ProductVersion, info.Version)
+	}
+	if info.Edition == "" || info.EngineEdition == 0 {
+		t.Errorf("got %+v", info)
+	}
+}
@@ -0,0 +1,68 @@
+package mssql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/microsoft/go-mssqldb/msdsn"
+)
+
+// The delays between the attempts to connect to a resuming database.
+const (
+	resumeFirstDelay = time.Second
+	resumeMaxDelay   = 10 * time.Second
+)
+
+// connectResuming connects to the server of params, retrying while the
+// database is unavailable for up to params.ServerlessResumeTimeout. When
+// ctx is done while waiting, the error wraps the context error.
+func (d *Driver) connectResuming(ctx context.Context, c *Connector, params msdsn.Config) (*tdsSession, error) {
+	var deadline time.Time
+	delay := resumeFirstDelay
+	for {
+		sess, err := connect(ctx, c, d.logger, params)
+		if err == nil || params.ServerlessResumeTimeout <= 0 || !isDatabaseResuming(err) {
+			return sess, err
+		}
+		if deadline.IsZero() {
+			deadline = time.Now().Add(params.ServerlessResumeTimeout)
+		}
+		if time.Now().Add(delay).After(deadline) {
+			return nil, err
+		}
+		if uint64(params.LogFlags)&logRetries != 0 {
+			d.logger.Log(ctx, msdsn.LogRetries, fmt.Sprintf("database unavailable, connecting again in %v: %v", delay, err))
+		}
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return nil, fmt.Errorf("%w while waiting for the database to resume: %v", ctx.Err(), err)
+		case <-t.C:
+		}
+		if delay *= 2; delay > resumeMaxDelay {
+			delay = resumeMaxDelay
+		}
+	}
+}
+
+// isDatabaseResuming reports whether err is error 40613, which Azure SQL
+// returns while a database is unavailable, such as a paused serverless
+// database being resumed by the attempt.
+func isDatabaseResuming(err error) bool {
+	var sqlErr Error
+	if !errors.As(err, &sqlErr) {
+		return false
+	}
+	if sqlErr.Number == 40613 {
+		return true
+	}
+	for _, e := range sqlErr.All {
+		if e.Number == 40613 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package mssql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+)
+
+// showplanColumn is the name of the single column of the result sets
+// holding the plans sent under SET STATISTICS XML ON.
+const showplanColumn = "Microsoft SQL Server 2005 XML Showplan"
+
+// ResultSet holds a result set read by QueryWithPlan.
+type ResultSet struct {
+	Columns []string
+	// Rows holds the values of the rows, as returned by the driver to
+	// database/sql, such as int64, string, []byte or time.Time, with nil
+	// for NULL.
+	Rows [][]driver.Value
+}
+
+// PlanResult is the result of QueryWithPlan.
+type PlanResult struct {
+	// ResultSets holds the result sets of the query, without the plans.
+	ResultSets []ResultSet
+	// Plans holds the actual execution plans of the statements of the
+	// query, as showplan XML documents, in the order they ran.
+	Plans []string
+}
+
+// QueryWithPlan runs query on conn with SET STATISTICS XML ON and returns
+// its result sets together with the actual execution plans the server
+// sent after them, in a single round trip. The option is set for the
+// query only, so the session does not return plans afterwards.
+//
+// All the rows are read into memory, so the helper is meant for diagnosing
+// queries, such as capturing the plan of a statement found to be slow,
+// rather than for reading large results. The query cannot be the name of a
+// stored procedure; use an EXEC statement instead.
+func QueryWithPlan(ctx context.Context, conn *sql.Conn, query string, args ...interface{}) (res *PlanResult, err error) {
+	err = conn.Raw(func(driverConn interface{}) error {
+		c, ok := driverConn.(*Conn)
+		if !ok {
+			return errors.New("mssql: QueryWithPlan needs a connection of this driver")
+		}
+		res, err = c.queryWithPlan(ctx, query, args)
+		return err
+	})
+	return res, err
+}
+
+func (c *Conn) queryWithPlan(ctx context.Context, query string, args []interface{}) (*PlanResult, error) {
+	if isProc(query) {
+		return nil, errors.New("mssql: QueryWithPlan cannot run a stored procedure by name, use an EXEC statement")
+	}
+	list, err := c.namedValues(args)
+	if err != nil {
+		return nil, err
+	}
+	stmt, err := c.prepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer stmt.Close()
+	if !c.connectionGood {
+		return nil, driver.ErrBadConn
+	}
+	opts := queryOptionsFromContext(ctx)
+	opts.statisticsXML = true
+	rows, err := stmt.queryContext(context.WithValue(ctx, queryOptionsKey{}, opts), list)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := &PlanResult{}
+	for {
+		cols := rows.Columns()
+		set := ResultSet{Columns: cols}
+		for {
+			row := make([]driver.Value, len(cols))
+			err = rows.Next(row)
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			for i, v := range row {
+				if b, ok := v.([]byte); ok {
+					row[i] = append([]byte(nil), b...)
+				}
+			}
+			set.Rows = append(set.Rows, row)
+		}
+		if len(cols) == 1 && cols[0] == showplanColumn {
+			for _, row := range set.Rows {
+				if plan, ok := row[0].(string); ok {
+					res.Plans = append(res.Plans, plan)
+				}
+			}
+		} else if len(cols) > 0 {
+			res.ResultSets = append(res.ResultSets, set)
+		}
+		next, ok := rows.(driver.RowsNextResultSet)
+		if !ok || !next.HasNextResultSet() {
+			return res, nil
+		}
+		if err = next.NextResultSet(); err != nil {
+			if err == io.EOF {
+				return res, nil
+			}
+			return nil, err
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package mssql
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestQueryWithPlan(t *testing.T) {
+	pool, logger := open(t)
+	defer pool.Close()
+	defer logger.StopLogging()
+
+	ctx := context.Background()
+	conn, err := pool.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	res, err := QueryWithPlan(ctx, conn, "select name from sys.objects where object_id = @p1; select @p2 as n", 3, "two")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.ResultSets) != 2 {
+		t.Fatalf("got %d result sets, want 2", len(res.ResultSets))
+	}
+	if cols := res.ResultSets[1].Columns; len(cols) != 1 || cols[0] != "n" {
+		t.Errorf("got columns %v", cols)
+	}
+	if rows := res.ResultSets[1].Rows; len(rows) != 1 || rows[0][0] != "two" {
+		t.Errorf("got rows %v", rows)
+	}
+	if len(res.Plans) != 2 {
+		t.Fatalf("got %d plans, want 2", len(res.Plans))
+	}
+	for _, plan := range res.Plans {
+		if !strings.Contains(plan, "<ShowPlanXML") {
+			t.Errorf("got plan %.100q", plan)
+		}
+	}
+
+	// The option is scoped to the query.
+	var n int
+	if err = conn.QueryRowContext(ctx, "select 1").Scan(&n); err != nil || n != 1 {
+		t.Errorf("got %d, %v after QueryWithPlan", n, err)
+	}
+
+	if _, err = QueryWithPlan(ctx, conn, "sp_who"); err == nil {
+		t.Error("expected an error for a stored procedure name")
+	}
+}
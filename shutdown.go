@@ -0,0 +1,134 @@
+package mssql
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// ShutdownError is returned by Connector.Shutdown when connections were
+// still in use when its context ended. Their network connections were
+// closed without waiting for their requests to end.
+type ShutdownError struct {
+	// ForceClosed is the number of connections closed while in use.
+	ForceClosed int
+	// Err is the error of the context of Shutdown.
+	Err error
+}
+
+func (e ShutdownError) Error() string {
+	return fmt.Sprintf("mssql: shutdown closed %d connections in use: %v", e.ForceClosed, e.Err)
+}
+
+func (e ShutdownError) Unwrap() error {
+	return e.Err
+}
+
+// connRegistry tracks the open connections of a Connector, and whether
+// database/sql has handed them out, for Shutdown. Connections are in use
+// from Connect or ResetSession, when the pool hands them out, until
+// IsValid, when they are returned to it.
+type connRegistry struct {
+	mu       sync.Mutex
+	conns    map[*Conn]bool
+	shutdown bool
+	// removed is closed, and replaced, each time a connection is removed.
+	removed chan struct{}
+}
+
+func newConnRegistry() *connRegistry {
+	return &connRegistry{
+		conns:   make(map[*Conn]bool),
+		removed: make(chan struct{}),
+	}
+}
+
+// add registers the new connection c as in use. It fails with ErrShutdown
+// once the connector is shut down.
+func (r *connRegistry) add(c *Conn) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.shutdown {
+		return ErrShutdown
+	}
+	r.conns[c] = true
+	return nil
+}
+
+func (r *connRegistry) isShutdown() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.shutdown
+}
+
+// remove forgets the closed connection c.
+func (r *connRegistry) remove(c *Conn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.conns[c]; !ok {
+		return
+	}
+	delete(r.conns, c)
+	close(r.removed)
+	r.removed = make(chan struct{})
+}
+
+// setInUse records that c was handed out by the pool or returned to it.
+// It returns false once the connector is shut down, so that database/sql
+// discards c.
+func (r *connRegistry) setInUse(c *Conn, inUse bool) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.conns[c]; ok {
+		r.conns[c] = inUse
+	}
+	return !r.shutdown
+}
+
+// Shutdown closes the connections of the connector for the end of the
+// process, such as during a deployment, without cutting off their work.
+// Connect fails with ErrShutdown from then on and the connections handed
+// out by the pool are discarded. The idle connections are closed at once,
+// and those in use once their work is done and they are returned to the
+// pool. When ctx ends first, the connections still in use are closed
+// underneath their requests and a ShutdownError reports them.
+//
+// Closing the pool with sql.DB.Close is still needed to release it.
+func (c *Connector) Shutdown(ctx context.Context) error {
+	r := c.conns
+	if r == nil {
+		return nil
+	}
+	r.mu.Lock()
+	r.shutdown = true
+	for conn, inUse := range r.conns {
+		if !inUse {
+			// the pool holds it until it is handed out, which fails, or
+			// closed with the pool
+			conn.closeTransport()
+			delete(r.conns, conn)
+		}
+	}
+	for len(r.conns) > 0 {
+		removed := r.removed
+		r.mu.Unlock()
+		select {
+		case <-removed:
+			r.mu.Lock()
+		case <-ctx.Done():
+			r.mu.Lock()
+			n := len(r.conns)
+			for conn := range r.conns {
+				conn.closeTransport()
+				delete(r.conns, conn)
+			}
+			r.mu.Unlock()
+			if n == 0 {
+				return nil
+			}
+			return ShutdownError{ForceClosed: n, Err: ctx.Err()}
+		}
+	}
+	r.mu.Unlock()
+	return nil
+}
@@ -0,0 +1,86 @@
+package mssql
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/microsoft/go-mssqldb/msdsn"
+)
+
+// registeredConn returns a connection of connector over a pipe, in use as
+// after Connect, and the server end of the pipe.
+func registeredConn(t *testing.T, connector *Connector) (*Conn, net.Conn) {
+	t.Helper()
+	sess, server := pipeSession()
+	c := &Conn{connector: connector, sess: sess, connectionGood: true}
+	if err := connector.conns.add(c); err != nil {
+		t.Fatal(err)
+	}
+	return c, server
+}
+
+// serverClosed reports whether the client end of the pipe of server was
+// closed.
+func serverClosed(server net.Conn) bool {
+	_ = server.SetReadDeadline(time.Now().Add(time.Second))
+	_, err := server.Read(make([]byte, 1))
+	return err != nil && !errors.Is(err, os.ErrDeadlineExceeded)
+}
+
+func TestShutdownWaitsForConnectionsInUse(t *testing.T) {
+	connector := newConnector(msdsn.Config{}, driverInstanceNoProcess)
+	idle, idleServer := registeredConn(t, connector)
+	if !idle.IsValid() {
+		t.Fatal("the connection returned to the pool should be valid")
+	}
+	busy, busyServer := registeredConn(t, connector)
+	defer busyServer.Close()
+
+	returned := make(chan bool)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		valid := busy.IsValid()
+		busy.Close()
+		returned <- valid
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := connector.Shutdown(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if <-returned {
+		t.Error("a connection returned to the pool after Shutdown should be discarded")
+	}
+	if !serverClosed(idleServer) {
+		t.Error("the idle connection should be closed")
+	}
+	if err := idle.ResetSession(ctx); err != driver.ErrBadConn {
+		t.Errorf("handing out a connection after Shutdown got %v, want driver.ErrBadConn", err)
+	}
+	idle.Close()
+	if _, err := connector.Connect(ctx); !errors.Is(err, ErrShutdown) {
+		t.Errorf("Connect after Shutdown got %v, want ErrShutdown", err)
+	}
+}
+
+func TestShutdownForceClosesConnectionsInUse(t *testing.T) {
+	connector := newConnector(msdsn.Config{}, driverInstanceNoProcess)
+	busy, busyServer := registeredConn(t, connector)
+	defer busy.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	err := connector.Shutdown(ctx)
+	var shutdownErr ShutdownError
+	if !errors.As(err, &shutdownErr) || shutdownErr.ForceClosed != 1 || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want a ShutdownError with one connection", err)
+	}
+	if !serverClosed(busyServer) {
+		t.Error("the connection in use should be closed")
+	}
+}
@@ -0,0 +1,54 @@
+package mssql
+
+import (
+	"math"
+	"net"
+	"time"
+
+	"github.com/microsoft/go-mssqldb/msdsn"
+	"golang.org/x/sys/unix"
+)
+
+// setTCPOptions sets the keepalive interval and count and the user timeout
+// of p on conn, when it is a TCP connection and they are not zero, so dead
+// peers are found within seconds instead of the system defaults.
+func setTCPOptions(conn net.Conn, p *msdsn.Config) error {
+	if p.KeepAliveInterval == 0 && p.KeepAliveCount == 0 && p.TCPUserTimeout == 0 {
+		return nil
+	}
+	tc, ok := conn.(*net.TCPConn)
+	if !ok {
+		return nil
+	}
+	rc, err := tc.SyscallConn()
+	if err != nil {
+		return err
+	}
+	var sockErr error
+	err = rc.Control(func(fd uintptr) {
+		set := func(opt, value int) {
+			if sockErr == nil {
+				sockErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_TCP, opt, value)
+			}
+		}
+		if p.KeepAliveInterval > 0 {
+			set(unix.TCP_KEEPINTVL, int(p.KeepAliveInterval/time.Second))
+		}
+		if p.KeepAliveCount > 0 {
+			set(unix.TCP_KEEPCNT, p.KeepAliveCount)
+		}
+		if p.TCPUserTimeout > 0 {
+			// in milliseconds, which overflow an int on 32-bit platforms
+			// past about 24 days
+			ms := p.TCPUserTimeout / time.Millisecond
+			if ms > math.MaxInt32 {
+				ms = math.MaxInt32
+			}
+			set(unix.TCP_USER_TIMEOUT, int(ms))
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
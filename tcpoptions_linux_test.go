@@ -0,0 +1,46 @@
+package mssql
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/microsoft/go-mssqldb/msdsn"
+	"golang.org/x/sys/unix"
+)
+
+func TestSetTCPOptions(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip("cannot listen on loopback:", err)
+	}
+	defer l.Close()
+
+	p := &msdsn.Config{KeepAlive: 10 * time.Second, KeepAliveInterval: 2 * time.Second, KeepAliveCount: 4, TCPUserTimeout: 15 * time.Second}
+	conn, err := createDialer(p).DialContext(context.Background(), "tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	rc, err := conn.(*net.TCPConn).SyscallConn()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[int]int{}
+	err = rc.Control(func(fd uintptr) {
+		for _, opt := range []int{unix.TCP_KEEPIDLE, unix.TCP_KEEPINTVL, unix.TCP_KEEPCNT, unix.TCP_USER_TIMEOUT} {
+			got[opt], _ = unix.GetsockoptInt(int(fd), unix.IPPROTO_TCP, opt)
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int]int{unix.TCP_KEEPIDLE: 10, unix.TCP_KEEPINTVL: 2, unix.TCP_KEEPCNT: 4, unix.TCP_USER_TIMEOUT: 15000}
+	for opt, v := range want {
+		if got[opt] != v {
+			t.Errorf("option %d is %d, want %d", opt, got[opt], v)
+		}
+	}
+}
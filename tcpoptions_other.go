@@ -0,0 +1,16 @@
+//go:build !linux
+// +build !linux
+
+package mssql
+
+import (
+	"net"
+
+	"github.com/microsoft/go-mssqldb/msdsn"
+)
+
+// setTCPOptions does nothing: the keepalive interval and count and the user
+// timeout are only set on Linux.
+func setTCPOptions(conn net.Conn, p *msdsn.Config) error {
+	return nil
+}
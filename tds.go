@@ -17,6 +17,7 @@ import (
 
 	"github.com/microsoft/go-mssqldb/aecmk"
 	"github.com/microsoft/go-mssqldb/integratedauth"
+	"github.com/microsoft/go-mssqldb/internal/cp"
 	"github.com/microsoft/go-mssqldb/msdsn"
 )
 
@@ -156,6 +157,9 @@ const (
 	featExtAZURESQLSUPPORT    byte = 0x08
 	featExtDATACLASSIFICATION byte = 0x09
 	featExtUTF8SUPPORT        byte = 0x0A
+	featExtAZURESQLDNSCACHING byte = 0x0B
+	featExtJSONSUPPORT        byte = 0x0D
+	featExtVECTORSUPPORT      byte = 0x0E
 	featExtTERMINATOR         byte = 0xFF
 )
 
@@ -163,6 +167,8 @@ type tdsSession struct {
 	buf             *tdsBuffer
 	loginAck        loginAckStruct
 	database        string
+	language        string
+	collation       cp.Collation
 	partner         string
 	columns         []columnStruct
 	tranid          uint64
@@ -172,6 +178,28 @@ type tdsSession struct {
 	routedPort      uint16
 	alwaysEncrypted bool
 	aeSettings      *alwaysEncryptedSettings
+	features        FeatureSet
+	// vectorVersion is the version of native vector support acknowledged
+	// by the server, zero when vectors are exchanged as JSON.
+	vectorVersion byte
+
+	// loginMessages holds the INFO messages sent by the server while
+	// loggingIn is true.
+	loginMessages []Error
+	loggingIn     bool
+
+	// conn is the connection dialed, below any TLS layer, which
+	// ResetSession checks before the session is reused.
+	conn net.Conn
+	// info holds what the prelogin and the login negotiated.
+	info ConnectionInfo
+	// serverInfo caches the result of Conn.ServerInfo.
+	serverInfo *ServerInfo
+	// activitySeq numbers the requests sent with a trace activity header.
+	activitySeq uint32
+	// failover, when set, receives the failover partner of the database
+	// reported by the server.
+	failover *failoverPartner
 }
 
 type alwaysEncryptedSettings struct {
@@ -568,11 +596,22 @@ type loginHeader struct {
 // done manually rather than using bytes and binary packages
 // for performance reasons
 func str2ucs2(s string) []byte {
-	res := utf16.Encode([]rune(s))
-	ucs2 := make([]byte, 2*len(res))
-	for i := 0; i < len(res); i++ {
-		ucs2[2*i] = byte(res[i])
-		ucs2[2*i+1] = byte(res[i] >> 8)
+	n := 0
+	for _, r := range s {
+		if r >= 0x10000 {
+			n += 4
+		} else {
+			n += 2
+		}
+	}
+	ucs2 := make([]byte, 0, n)
+	for _, r := range s {
+		if r >= 0x10000 {
+			r1, r2 := utf16.EncodeRune(r)
+			ucs2 = append(ucs2, byte(r1), byte(r1>>8), byte(r2), byte(r2>>8))
+		} else {
+			ucs2 = append(ucs2, byte(r), byte(r>>8))
+		}
 	}
 	return ucs2
 }
@@ -898,6 +937,21 @@ func (hdr transDescrHdr) pack() (res []byte) {
 	return res
 }
 
+// traceActivityHdr is the trace activity header, which the server reports
+// as the activity id of the events of the request.
+type traceActivityHdr struct {
+	activityID UniqueIdentifier
+	sequence   uint32
+}
+
+func (hdr traceActivityHdr) pack() (res []byte) {
+	res = make([]byte, 16+4)
+	id, _ := hdr.activityID.Value()
+	copy(res, id.([]byte))
+	binary.LittleEndian.PutUint32(res[16:], hdr.sequence)
+	return res
+}
+
 func writeAllHeaders(w io.Writer, headers []headerStruct) (err error) {
 	// Calculating total length.
 	var totallen uint32 = 4
@@ -948,21 +1002,52 @@ func sendAttention(buf *tdsBuffer) error {
 	return buf.FinishPacket()
 }
 
+// confirmAttention sends an attention and reads the responses of the
+// session until the server confirms it. The response to the request that
+// was interrupted, if any, is discarded.
+func confirmAttention(ctx context.Context, sess *tdsSession) error {
+	if err := sendAttention(sess.buf); err != nil {
+		return err
+	}
+	defer watchAttention(sess)()
+	// The confirmation is either in the current response or in the one
+	// right after it.
+	for i := 0; i < 2; i++ {
+		tokChan := make(chan tokenStruct, tokenChanSize)
+		go processSingleResponse(ctx, sess, tokChan, outputs{})
+		if readCancelConfirmation(tokChan) {
+			return nil
+		}
+	}
+	return ServerError{Error{Message: "did not get cancellation confirmation from the server"}}
+}
+
 // Makes an attempt to connect with each available protocol, in order, until one succeeds or the timeout elapses
+//
+// With a positive BrowserCacheTTL, the port of a named instance cached from
+// an earlier query of the SQL Server Browser is dialed first. When that
+// fails the browser is queried again, and when it does not answer the tcp
+// protocol dials the default port.
 func dialConnection(ctx context.Context, c *Connector, p *msdsn.Config, logger ContextLogger) (conn net.Conn, err error) {
 	var instances msdsn.BrowserData
-	for _, protocol := range p.Protocols {
+	cached := false
+	for i := 0; i < len(p.Protocols); i++ {
+		protocol := p.Protocols[i]
 		dialer := msdsn.ProtocolDialers[protocol]
-		if dialer.CallBrowser(p) {
+		browsed := dialer.CallBrowser(p)
+		port := p.Port
+		if browsed {
 			if instances == nil {
-				d := c.getDialer(p)
-				instances, err = getInstances(ctx, d, p.Host, p.BrowserMessage, p.Instance)
-				if err != nil && logger != nil && uint64(p.LogFlags)&logErrors != 0 {
-					e := fmt.Sprintf("unable to get instances from Sql Server Browser on host %v: %v", p.Host, err.Error())
-					logger.Log(ctx, msdsn.Log(logErrors), e)
-				}
+				instances, cached = c.browserData(ctx, p, logger)
 			}
 			err = dialer.ParseBrowserData(instances, p)
+			if err != nil && len(instances) == 0 && protocol == "tcp" && p.BrowserCacheTTL > 0 {
+				if logger != nil && uint64(p.LogFlags)&logDebug != 0 {
+					logger.Log(ctx, msdsn.LogDebug, "Sql Server Browser did not answer, dialing the default port")
+				}
+				p.Port = defaultServerPort
+				err = nil
+			}
 			if err != nil {
 				if logger != nil && uint64(p.LogFlags)&logErrors != 0 {
 					logger.Log(ctx, msdsn.Log(logErrors), "Skipping protocol "+protocol+". Error:"+err.Error())
@@ -988,6 +1073,14 @@ func dialConnection(ctx context.Context, c *Connector, p *msdsn.Config, logger C
 			}
 			return
 		}
+		if browsed && cached {
+			// The instance may have moved since the browser was queried,
+			// so query it again and retry the protocol.
+			instanceCache.remove(newBrowserCacheKey(p))
+			instances, cached = nil, false
+			p.Port = port
+			i--
+		}
 	}
 	return
 }
@@ -1079,7 +1172,7 @@ func prepareLogin(ctx context.Context, c *Connector, p msdsn.Config, logger Cont
 		OptionFlags1:   fUseDB | fSetLang,
 		HostName:       p.Workstation,
 		ServerName:     serverName,
-		AppName:        p.AppName,
+		AppName:        p.LoginAppName(),
 		TypeFlags:      typeFlags,
 		CtlIntName:     "go-mssqldb",
 		ClientProgVer:  getDriverVersion(driverVersion),
@@ -1088,13 +1181,25 @@ func prepareLogin(ctx context.Context, c *Connector, p msdsn.Config, logger Cont
 	if p.ColumnEncryption {
 		_ = l.FeatureExt.Add(&featureExtColumnEncryption{})
 	}
+	if p.VectorSupport {
+		_ = l.FeatureExt.Add(featureExtVectorSupport{})
+	}
+	if p.UTF8Support {
+		_ = l.FeatureExt.Add(featureExtUTF8Support{})
+	}
+	if p.JSONSupport {
+		_ = l.FeatureExt.Add(featureExtJSONSupport{})
+	}
+	if isAzureSQLHost(p.Host) {
+		_ = l.FeatureExt.Add(featureExtDNSCaching{})
+	}
 	switch {
 	case fe.FedAuthLibrary == FedAuthLibrarySecurityToken:
 		if uint64(p.LogFlags)&logDebug != 0 {
 			logger.Log(ctx, msdsn.LogDebug, "Starting federated authentication using security token")
 		}
 
-		fe.FedAuthToken, err = c.securityTokenProvider(ctx)
+		fe.FedAuthToken, err = c.securityToken(ctx, p)
 		if err != nil {
 			if uint64(p.LogFlags)&logDebug != 0 {
 				logger.Log(ctx, msdsn.LogDebug, fmt.Sprintf("Failed to retrieve service principal token for federated authentication security token library: %v", err))
@@ -1178,6 +1283,19 @@ func connect(ctx context.Context, c *Connector, logger ContextLogger, p msdsn.Co
 		packetSize = 32767
 	}
 
+	// login bounds the current attempt from the prelogin to the login
+	// acknowledgement and reports the phase a timeout stopped.
+	var login *loginWatch
+	defer func() {
+		if err = login.finish(err); err != nil {
+			res = nil
+		}
+	}()
+	// routedFrom is the address of the server dialed first when a login
+	// routed the connection elsewhere.
+	var routedFrom string
+	routings := 0
+
 initiate_connection:
 	dialCtx := ctx
 	if p.DialTimeout >= 0 {
@@ -1191,13 +1309,23 @@ initiate_connection:
 	}
 	conn, err := dialConnection(dialCtx, c, &p, logger)
 	if err != nil {
+		if dialCtx.Err() == context.DeadlineExceeded {
+			return nil, LoginTimeoutError{Phase: PhaseDial, Err: err}
+		}
+		if routedFrom != "" {
+			return nil, routedDialError(serverAddress(p), routedFrom, p.Port, err)
+		}
 		return nil, err
 	}
+	login = watchLogin(ctx, p.LoginTimeout, conn)
+	loginCtx := login.ctx
 
 	toconn := newTimeoutConn(conn, p.ConnTimeout)
 	outbuf := newTdsBuffer(packetSize, toconn)
+	outbuf.noPLPPool = p.DisableBufferPool
 
 	if p.Encryption == msdsn.EncryptionStrict {
+		login.phase = PhaseTLSHandshake
 		outbuf.transport, err = getTLSConn(toconn, p, "tds/8.0")
 		if err != nil {
 			return nil, err
@@ -1206,9 +1334,12 @@ initiate_connection:
 	}
 	sess := tdsSession{
 		buf:        outbuf,
+		conn:       conn,
 		logger:     logger,
 		logFlags:   uint64(p.LogFlags),
 		aeSettings: &alwaysEncryptedSettings{keyProviders: aecmk.GetGlobalCekProviders()},
+		loggingIn:  true,
+		failover:   c.failover,
 	}
 
 	for i, p := range c.keyProviders {
@@ -1223,6 +1354,7 @@ initiate_connection:
 	}
 
 	fields := preparePreloginFields(p, fedAuth)
+	login.phase = PhasePrelogin
 
 	err = writePrelogin(packPrelogin, outbuf, fields)
 	if err != nil {
@@ -1238,6 +1370,7 @@ initiate_connection:
 	if err != nil {
 		return nil, err
 	}
+	sess.info = preloginInfo(p, fields, encrypt, isTransportEncrypted)
 
 	//We need not perform TLS handshake if the communication channel is already encrypted (encrypt=strict)
 	if !isTransportEncrypted {
@@ -1267,6 +1400,7 @@ initiate_connection:
 			handshakeConn := tlsHandshakeConn{buf: outbuf}
 			passthrough := passthroughConn{c: &handshakeConn}
 			tlsConn := tls.Client(&passthrough, config)
+			login.phase = PhaseTLSHandshake
 			err = tlsConn.Handshake()
 			passthrough.c = toconn
 			outbuf.transport = tlsConn
@@ -1282,6 +1416,11 @@ initiate_connection:
 
 	}
 
+	if uint64(p.LogFlags)&logDebug != 0 {
+		if name, reason, err := integratedauth.ChooseProvider(p); err == nil {
+			logger.Log(ctx, msdsn.LogDebug, fmt.Sprintf("Integrated authenticator %s selected because %s", name, reason))
+		}
+	}
 	auth, err := integratedauth.GetIntegratedAuthenticator(p)
 	if err != nil {
 		if uint64(p.LogFlags)&logDebug != 0 {
@@ -1295,12 +1434,16 @@ initiate_connection:
 		defer auth.Free()
 	}
 
-	login, err := prepareLogin(ctx, c, p, logger, auth, fedAuth, uint32(outbuf.PackageSize()))
+	if c.fedAuthRequired {
+		login.phase = PhaseFedAuthToken
+	}
+	l, err := prepareLogin(loginCtx, c, p, logger, auth, fedAuth, uint32(outbuf.PackageSize()))
 	if err != nil {
 		return nil, err
 	}
 
-	err = sendLogin(outbuf, login)
+	login.phase = PhaseLogin
+	err = sendLogin(outbuf, l)
 	if err != nil {
 		return nil, err
 	}
@@ -1309,7 +1452,7 @@ initiate_connection:
 	// SSPI and federated authentication scenarios may require multiple
 	// packet exchanges to complete the login sequence.
 	for loginAck := false; !loginAck; {
-		reader := startReading(&sess, ctx, outputs{})
+		reader := startReading(&sess, loginCtx, outputs{})
 		// don't send attention or wait for cancel confirmation during login
 		reader.noAttn = true
 
@@ -1353,10 +1496,12 @@ initiate_connection:
 				}
 
 				// Request the AD token given the server SPN and STS URL
-				fedAuth.FedAuthToken, err = c.adalTokenProvider(ctx, token.ServerSPN, token.STSURL)
+				login.phase = PhaseFedAuthToken
+				fedAuth.FedAuthToken, err = c.adalTokenProvider(loginCtx, token.ServerSPN, token.STSURL)
 				if err != nil {
 					return nil, err
 				}
+				login.phase = PhaseLogin
 
 				// Now need to send the token as a FEDINFO packet
 				err = sendFedAuthInfo(outbuf, fedAuth)
@@ -1364,9 +1509,19 @@ initiate_connection:
 					return nil, err
 				}
 			case loginAckStruct:
+				if token.TDSVersion < verTDS74 {
+					if opts := tds74Options(p, fedAuth); len(opts) > 0 {
+						return nil, UnsupportedTDSVersionError{TDSVersion: token.TDSVersion, Options: opts}
+					}
+				}
 				sess.loginAck = token
+				sess.info.TDSVersion = token.TDSVersion
 				loginAck = true
 			case featureExtAck:
+				sess.features |= token.features()
+				if data, ok := token[featExtVECTORSUPPORT].([]byte); ok && len(data) > 0 {
+					sess.vectorVersion = data[0]
+				}
 				for _, v := range token {
 					switch v := v.(type) {
 					case colAckStruct:
@@ -1382,6 +1537,9 @@ initiate_connection:
 				if token.isError() {
 					tokenErr := token.getError()
 					tokenErr.Message = "login error: " + tokenErr.Message
+					if isPasswordExpired(tokenErr) {
+						return nil, PasswordExpiredError{sqlError: tokenErr}
+					}
 					return nil, tokenErr
 				}
 			case error:
@@ -1390,24 +1548,56 @@ initiate_connection:
 		}
 	}
 
+	sess.loggingIn = false
+	// Login packets are written one at a time since the transport can
+	// change after the first one, so coalescing only starts now.
+	outbuf.SetCoalesce(p.CoalesceWrites)
+
 	if sess.routedServer != "" {
+		_ = login.finish(nil)
 		toconn.Close()
-		// Need to handle case when routedServer is in "host\instance" format.
-		routedParts := strings.SplitN(sess.routedServer, "\\", 2)
-		p.Host = routedParts[0]
-		if len(routedParts) == 2 {
-			p.Instance = routedParts[1]
+		routings++
+		if routings > maxRoutings {
+			return nil, fmt.Errorf("mssql: the connection was routed more than %d times, last to %s", maxRoutings, sess.routedServer)
 		}
-		p.Port = uint64(sess.routedPort)
-		if !p.HostInCertificateProvided && p.TLSConfig != nil {
-			p.TLSConfig = p.TLSConfig.Clone()
-			p.TLSConfig.ServerName = p.Host
+		if routedFrom == "" {
+			routedFrom = serverAddress(p)
+		}
+		p = routedConfig(p, sess.routedServer, sess.routedPort)
+		if uint64(p.LogFlags)&logDebug != 0 {
+			logger.Log(ctx, msdsn.LogDebug, fmt.Sprintf("Routed from %s to %s", routedFrom, serverAddress(p)))
 		}
 		goto initiate_connection
 	}
+	if routedFrom != "" {
+		sess.info.RoutedFrom = routedFrom
+		sess.info.RoutedTo = serverAddress(p)
+	}
 	return &sess, nil
 }
 
+// tds74Options returns the options of p that request feature extensions,
+// which servers below TDS 7.4 do not support.
+func tds74Options(p msdsn.Config, fe *featureExtFedAuth) []string {
+	var opts []string
+	if fe.FedAuthLibrary != FedAuthLibraryReserved {
+		opts = append(opts, "fedauth")
+	}
+	if p.ColumnEncryption {
+		opts = append(opts, "columnencryption")
+	}
+	if p.UTF8Support {
+		opts = append(opts, msdsn.UTF8Support)
+	}
+	if p.VectorSupport {
+		opts = append(opts, msdsn.VectorSupport)
+	}
+	if p.JSONSupport {
+		opts = append(opts, msdsn.JSONSupport)
+	}
+	return opts
+}
+
 type featureExtColumnEncryption struct {
 }
 
@@ -1425,3 +1615,67 @@ func (f *featureExtColumnEncryption) toBytes() []byte {
 	*/
 	return []byte{0x01}
 }
+
+type featureExtVectorSupport struct{}
+
+func (featureExtVectorSupport) featureID() byte {
+	return featExtVECTORSUPPORT
+}
+
+func (featureExtVectorSupport) toBytes() []byte {
+	return []byte{vectorSupportVersion}
+}
+
+type featureExtUTF8Support struct{}
+
+func (featureExtUTF8Support) featureID() byte {
+	return featExtUTF8SUPPORT
+}
+
+func (featureExtUTF8Support) toBytes() []byte {
+	return nil
+}
+
+// jsonSupportVersion is the version of the JSON support feature extension
+// requested at login.
+const jsonSupportVersion = 0x01
+
+type featureExtJSONSupport struct{}
+
+func (featureExtJSONSupport) featureID() byte {
+	return featExtJSONSUPPORT
+}
+
+func (featureExtJSONSupport) toBytes() []byte {
+	return []byte{jsonSupportVersion}
+}
+
+// featureExtDNSCaching asks Azure SQL Database whether the client may cache
+// the address it resolved for the server.
+type featureExtDNSCaching struct{}
+
+func (featureExtDNSCaching) featureID() byte {
+	return featExtAZURESQLDNSCACHING
+}
+
+func (featureExtDNSCaching) toBytes() []byte {
+	return nil
+}
+
+// azureSQLDomains are the domains of the Azure SQL Database servers, which
+// support the DNS caching feature extension.
+var azureSQLDomains = []string{
+	".database.windows.net",
+	".database.chinacloudapi.cn",
+	".database.usgovcloudapi.net",
+}
+
+func isAzureSQLHost(host string) bool {
+	host = strings.ToLower(host)
+	for _, d := range azureSQLDomains {
+		if strings.HasSuffix(host, d) {
+			return true
+		}
+	}
+	return false
+}
@@ -886,6 +886,45 @@ func TestUcs22str(t *testing.T) {
 	ExerciseUCS2ToStringFunction("ucs22str", ucs22str, t)
 }
 
+func TestDecodeUTF16(t *testing.T) {
+	ExerciseUCS2ToStringFunction("decodeUTF16", func(b []byte) (string, error) { return decodeUTF16(b), nil }, t)
+
+	// unpaired surrogates, as accepted by nvarchar, decode like utf16.Decode does
+	for _, units := range [][]uint16{
+		{0xd83d},
+		{0xd83d, 0x61},
+		{0xde00, 0x61},
+		{0x61, 0xdbff, 0xdbff, 0xdfff},
+	} {
+		b := make([]byte, 0, 2*len(units))
+		for _, u := range units {
+			b = append(b, byte(u), byte(u>>8))
+		}
+		if got, want := decodeUTF16(b), string(utf16.Decode(units)); got != want {
+			t.Errorf("decodeUTF16(%x) = %q, want %q", units, got, want)
+		}
+	}
+}
+
+func TestStr2ucs2(t *testing.T) {
+	for _, s := range []string{"", "abc", "déjà vu", longEmoji, stringASCIIWithTrailingUnicode, "bad \xff utf-8"} {
+		want := make([]byte, 0)
+		for _, u := range utf16.Encode([]rune(s)) {
+			want = append(want, byte(u), byte(u>>8))
+		}
+		if got := str2ucs2(s); !bytes.Equal(got, want) {
+			t.Errorf("str2ucs2(%q) = %x, want %x", s, got, want)
+		}
+	}
+}
+
+func BenchmarkStr2ucs2(b *testing.B) {
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		str2ucs2(stringASCIIWithTrailingUnicode)
+	}
+}
+
 var sideeffect_varchar string
 
 // ucs22str benchmarks
@@ -924,6 +963,15 @@ func BenchmarkUcs22strTrailingUnicode(b *testing.B) {
 	}
 }
 
+func BenchmarkUcs22strLongerUnicode(b *testing.B) {
+	encoded := str2ucs2(strings.Repeat(stringASCIIWithTrailingUnicode, 50))
+	b.ReportAllocs()
+	for n := 0; n < b.N; n++ {
+		s, _ := ucs22str(encoded)
+		sideeffect_varchar = s
+	}
+}
+
 func BenchmarkUcs22strLongEmojis(b *testing.B) {
 	for n := 0; n < b.N; n++ {
 		s, _ := ucs22str(longEmojiBytes)
@@ -0,0 +1,349 @@
+package mssql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// columnTag is the struct tag naming the column of a field, optionally
+// followed by its SQL type after a comma, as in `mssql:"price,decimal(18,2)"`.
+// The name "-" leaves the field out.
+const columnTag = "mssql"
+
+// TempColumn is a column of a temporary table created by CreateTempTable.
+type TempColumn struct {
+	Name string
+	// Type is the SQL type of the column, such as "int" or "nvarchar(50)".
+	// Character types without a collation are created with the collation
+	// of the current database rather than that of tempdb, so that they
+	// compare with the columns of its tables.
+	Type     string
+	Nullable bool
+}
+
+// TempTable is a local temporary table, such as #staging, created with
+// CreateTempTable or CreateTempTableFor. A local temporary table only
+// exists in the session that created it, so the table holds a connection
+// of the pool for itself until Close.
+type TempTable struct {
+	// Conn is the connection holding the table. Run the statements that use
+	// the table, such as joins or merges, on it.
+	Conn *sql.Conn
+
+	name    string
+	columns []TempColumn
+}
+
+// CreateTempTable takes a connection from db and creates the local
+// temporary table name with columns on it. A "#" is added in front of name
+// when it does not start with one.
+func CreateTempTable(ctx context.Context, db *sql.DB, name string, columns []TempColumn) (*TempTable, error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	t, err := createTempTable(ctx, conn, name, columns)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// CreateTempTableFor is CreateTempTable with the columns of the exported
+// fields of the struct row, which can be a struct or a pointer to one.
+//
+// The column of a field is named after the field unless its mssql tag
+// gives a name, and its SQL type is derived from the Go type of the field
+// unless the tag gives one after a comma, as in `mssql:"price,decimal(18,2)"`.
+// Fields of pointer types and of the sql.Null types are nullable. A field
+// tagged `mssql:"-"` is left out.
+func CreateTempTableFor(ctx context.Context, db *sql.DB, name string, row interface{}) (*TempTable, error) {
+	fields, err := structColumns(reflect.TypeOf(row))
+	if err != nil {
+		return nil, err
+	}
+	columns := make([]TempColumn, len(fields))
+	for i, f := range fields {
+		columns[i] = f.column
+	}
+	return CreateTempTable(ctx, db, name, columns)
+}
+
+func createTempTable(ctx context.Context, conn *sql.Conn, name string, columns []TempColumn) (*TempTable, error) {
+	if strings.HasPrefix(name, "##") {
+		return nil, fmt.Errorf("mssql: %s is a global temporary table", name)
+	}
+	if !strings.HasPrefix(name, "#") {
+		name = "#" + name
+	}
+	if len(columns) == 0 {
+		return nil, errors.New("mssql: a temporary table needs columns")
+	}
+	defs := make([]string, len(columns))
+	for i, col := range columns {
+		if col.Name == "" || col.Type == "" {
+			return nil, fmt.Errorf("mssql: column %d of %s needs a name and a type", i, name)
+		}
+		defs[i] = col.definition()
+	}
+	t := &TempTable{Conn: conn, name: name, columns: append([]TempColumn(nil), columns...)}
+	_, err := conn.ExecContext(ctx, "create table "+t.Name()+" ("+strings.Join(defs, ", ")+")")
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// definition returns the column definition of col in a create table
+// statement.
+func (col TempColumn) definition() string {
+	def := TSQLQuoter{}.ID(col.Name) + " " + col.Type
+	if isCharType(col.Type) && !strings.Contains(strings.ToLower(col.Type), "collate") {
+		def += " collate database_default"
+	}
+	if col.Nullable {
+		return def + " null"
+	}
+	return def + " not null"
+}
+
+// isCharType reports whether the SQL type typ, such as "varchar(20)", is
+// one of the character types, which have a collation.
+func isCharType(typ string) bool {
+	name := strings.ToLower(strings.TrimSpace(typ))
+	if i := strings.IndexAny(name, "( "); i >= 0 {
+		name = name[:i]
+	}
+	switch name {
+	case "char", "varchar", "nchar", "nvarchar":
+		return true
+	}
+	return false
+}
+
+// Name returns the quoted name of the table, such as [#staging], to use in
+// the statements run on Conn.
+func (t *TempTable) Name() string {
+	return TSQLQuoter{}.ID(t.name)
+}
+
+// Columns returns the columns of the table.
+func (t *TempTable) Columns() []TempColumn {
+	return append([]TempColumn(nil), t.columns...)
+}
+
+// Load bulk copies rows into the table and returns the number of rows
+// copied. rows is either a [][]interface{} holding the values of all the
+// columns in order, or a slice of structs, or of pointers to structs, whose
+// fields are matched to the columns by name as in CreateTempTableFor.
+func (t *TempTable) Load(ctx context.Context, rows interface{}) (n int64, err error) {
+	var names []string
+	var values func(i int) []interface{}
+	var count int
+	if list, ok := rows.([][]interface{}); ok {
+		for _, col := range t.columns {
+			names = append(names, col.Name)
+		}
+		values = func(i int) []interface{} { return list[i] }
+		count = len(list)
+	} else {
+		v := reflect.ValueOf(rows)
+		if v.Kind() != reflect.Slice {
+			return 0, fmt.Errorf("mssql: cannot load %T into a table, it needs a slice", rows)
+		}
+		fields, err := structColumns(v.Type().Elem())
+		if err != nil {
+			return 0, err
+		}
+		for _, f := range fields {
+			names = append(names, f.column.Name)
+		}
+		values = func(i int) []interface{} { return structValues(v.Index(i), fields) }
+		count = v.Len()
+	}
+	if count == 0 {
+		return 0, nil
+	}
+	err = t.Conn.Raw(func(driverConn interface{}) error {
+		c, ok := driverConn.(*Conn)
+		if !ok {
+			return errors.New("mssql: TempTable needs a connection of this driver")
+		}
+		bulk := c.CreateBulkContext(ctx, t.Name(), names)
+		for i := 0; i < count; i++ {
+			if err := bulk.AddRow(values(i)); err != nil {
+				return err
+			}
+		}
+		n, err = bulk.Done()
+		return err
+	})
+	return n, err
+}
+
+// Close drops the table and returns its connection to the pool.
+func (t *TempTable) Close() error {
+	_, err := t.Conn.ExecContext(context.Background(), "drop table "+t.Name())
+	if cerr := t.Conn.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// structColumn is a field of a struct and the column it maps to.
+type structColumn struct {
+	index  []int
+	column TempColumn
+}
+
+// structColumns returns the columns of the exported fields of the struct
+// type t, which can be a pointer to a struct.
+func structColumns(t reflect.Type) ([]structColumn, error) {
+	if t != nil && t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == nil || t.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("mssql: %v is not a struct", t)
+	}
+	var cols []structColumn
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.PkgPath != "" {
+			continue
+		}
+		name, sqlType := f.Name, ""
+		if tag, ok := f.Tag.Lookup(columnTag); ok {
+			parts := strings.SplitN(tag, ",", 2)
+			if parts[0] == "-" {
+				continue
+			}
+			if parts[0] != "" {
+				name = parts[0]
+			}
+			if len(parts) > 1 {
+				sqlType = strings.TrimSpace(parts[1])
+			}
+		}
+		goType, nullable := f.Type, false
+		if goType.Kind() == reflect.Ptr {
+			goType, nullable = goType.Elem(), true
+		}
+		derived, nullType := sqlTypeOf(goType)
+		if sqlType == "" {
+			if derived == "" {
+				return nil, fmt.Errorf("mssql: no SQL type for field %s of type %v, give one in its %s tag", f.Name, f.Type, columnTag)
+			}
+			sqlType = derived
+		}
+		cols = append(cols, structColumn{
+			index:  f.Index,
+			column: TempColumn{Name: name, Type: sqlType, Nullable: nullable || nullType},
+		})
+	}
+	if len(cols) == 0 {
+		return nil, fmt.Errorf("mssql: %v has no exported fields", t)
+	}
+	return cols, nil
+}
+
+var (
+	timeType             = reflect.TypeOf(time.Time{})
+	uniqueIdentifierType = reflect.TypeOf(UniqueIdentifier{})
+	nullTypes            = map[reflect.Type]string{
+		reflect.TypeOf(sql.NullBool{}):    "bit",
+		reflect.TypeOf(sql.NullByte{}):    "tinyint",
+		reflect.TypeOf(sql.NullInt16{}):   "smallint",
+		reflect.TypeOf(sql.NullInt32{}):   "int",
+		reflect.TypeOf(sql.NullInt64{}):   "bigint",
+		reflect.TypeOf(sql.NullFloat64{}): "float",
+		reflect.TypeOf(sql.NullString{}):  "nvarchar(max)",
+		reflect.TypeOf(sql.NullTime{}):    "datetime2",
+	}
+)
+
+// sqlTypeOf returns the SQL type of the values of the Go type t, and
+// whether t is one of the sql.Null types. It returns "" for the types it
+// has no SQL type for.
+func sqlTypeOf(t reflect.Type) (sqlType string, nullType bool) {
+	if s, ok := nullTypes[t]; ok {
+		return s, true
+	}
+	switch t {
+	case timeType:
+		return "datetime2", false
+	case uniqueIdentifierType:
+		return "uniqueidentifier", false
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "bit", false
+	case reflect.Uint8:
+		return "tinyint", false
+	case reflect.Int8, reflect.Int16:
+		return "smallint", false
+	case reflect.Int32, reflect.Uint16:
+		return "int", false
+	case reflect.Int, reflect.Int64, reflect.Uint32:
+		return "bigint", false
+	case reflect.Float32:
+		return "real", false
+	case reflect.Float64:
+		return "float", false
+	case reflect.String:
+		return "nvarchar(max)", false
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "varbinary(max)", false
+		}
+	}
+	return "", false
+}
+
+// structValues returns the values of the fields of the struct, or pointer
+// to a struct, v, with nil for nil pointers.
+func structValues(v reflect.Value, fields []structColumn) []interface{} {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+	row := make([]interface{}, len(fields))
+	for i, f := range fields {
+		fv := v.FieldByIndex(f.index)
+		if fv.Kind() == reflect.Ptr {
+			if fv.IsNil() {
+				continue
+			}
+			fv = fv.Elem()
+		}
+		row[i] = fieldValue(fv)
+	}
+	return row
+}
+
+// fieldValue returns the value of a field in a type the bulk copy accepts,
+// converting the integers, floats and strings of other types, such as int16
+// or named string types, to int64, float64 and string.
+func fieldValue(v reflect.Value) interface{} {
+	if valuer, ok := v.Interface().(driver.Valuer); ok {
+		return valuer
+	}
+	switch v.Kind() {
+	case reflect.Bool:
+		return v.Bool()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.String:
+		return v.String()
+	}
+	return v.Interface()
+}
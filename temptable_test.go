@@ -0,0 +1,127 @@
+package mssql
+
+import (
+	"context"
+	"database/sql"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type tempTableRow struct {
+	ID      int32
+	Name    string  `mssql:"name,nvarchar(50)"`
+	Price   float64 `mssql:",decimal(18,2)"`
+	Note    *string
+	Seen    sql.NullTime
+	Skipped int `mssql:"-"`
+	hidden  int
+}
+
+func TestStructColumns(t *testing.T) {
+	fields, err := structColumns(reflect.TypeOf(&tempTableRow{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var cols []TempColumn
+	for _, f := range fields {
+		cols = append(cols, f.column)
+	}
+	want := []TempColumn{
+		{Name: "ID", Type: "int"},
+		{Name: "name", Type: "nvarchar(50)"},
+		{Name: "Price", Type: "decimal(18,2)"},
+		{Name: "Note", Type: "nvarchar(max)", Nullable: true},
+		{Name: "Seen", Type: "datetime2", Nullable: true},
+	}
+	if !reflect.DeepEqual(cols, want) {
+		t.Errorf("got columns %+v, want %+v", cols, want)
+	}
+
+	note := "n"
+	row := structValues(reflect.ValueOf(tempTableRow{ID: 3, Name: "a", Price: 1.5, Note: &note, hidden: 1}), fields)
+	if len(row) != 5 || row[0] != int64(3) || row[1] != "a" || row[2] != 1.5 || row[3] != "n" {
+		t.Errorf("got row %#v", row)
+	}
+	if _, ok := row[4].(sql.NullTime); !ok {
+		t.Errorf("got %T for a sql.NullTime field", row[4])
+	}
+	row = structValues(reflect.ValueOf(&tempTableRow{}), fields)
+	if row[3] != nil {
+		t.Errorf("a nil pointer should be NULL, got %#v", row[3])
+	}
+
+	for _, v := range []interface{}{
+		1,
+		struct{ C chan int }{},
+		struct{ hidden int }{},
+	} {
+		if _, err = structColumns(reflect.TypeOf(v)); err == nil {
+			t.Errorf("%T should have no columns", v)
+		}
+	}
+}
+
+func TestTempColumnDefinition(t *testing.T) {
+	for _, tst := range []struct {
+		col  TempColumn
+		want string
+	}{
+		{TempColumn{Name: "id", Type: "int"}, "[id] int not null"},
+		{TempColumn{Name: "name", Type: "nvarchar(50)"}, "[name] nvarchar(50) collate database_default not null"},
+		{TempColumn{Name: "note", Type: "VARCHAR(max)", Nullable: true}, "[note] VARCHAR(max) collate database_default null"},
+		{TempColumn{Name: "code", Type: "char (3)"}, "[code] char (3) collate database_default not null"},
+		{TempColumn{Name: "tag", Type: "nchar(2) collate Latin1_General_BIN2"}, "[tag] nchar(2) collate Latin1_General_BIN2 not null"},
+		{TempColumn{Name: "hash", Type: "varbinary(32)"}, "[hash] varbinary(32) not null"},
+		{TempColumn{Name: "at", Type: "datetime2", Nullable: true}, "[at] datetime2 null"},
+	} {
+		if got := tst.col.definition(); got != tst.want {
+			t.Errorf("got %q, want %q", got, tst.want)
+		}
+	}
+}
+
+func TestTempTable(t *testing.T) {
+	pool, logger := open(t)
+	defer pool.Close()
+	defer logger.StopLogging()
+
+	ctx := context.Background()
+	tt, err := CreateTempTableFor(ctx, pool, "staging", tempTableRow{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tt.Close()
+	if tt.Name() != "[#staging]" {
+		t.Errorf("got name %s", tt.Name())
+	}
+
+	note := "second"
+	n, err := tt.Load(ctx, []tempTableRow{
+		{ID: 1, Name: "one", Price: 1.25, Seen: sql.NullTime{Time: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), Valid: true}},
+		{ID: 2, Name: "two", Price: 2.5, Note: &note},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("copied %d rows, want 2", n)
+	}
+	n, err = tt.Load(ctx, [][]interface{}{{3, "three", "3.75", nil, nil}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Errorf("copied %d rows, want 1", n)
+	}
+
+	var count int
+	var total float64
+	err = tt.Conn.QueryRowContext(ctx, "select count(*), sum(Price) from "+tt.Name()+" where Note is null or Note = 'second'").Scan(&count, &total)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != 3 || total != 7.5 {
+		t.Errorf("got %d rows summing to %v", count, total)
+	}
+}
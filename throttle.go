@@ -0,0 +1,127 @@
+package mssql
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// throttleWaits are the waits recommended before retrying a request that
+// failed with the resource governance error of the same number.
+var throttleWaits = map[int32]time.Duration{
+	10928: 10 * time.Second, // a resource limit of the database or elastic pool is reached
+	10929: 10 * time.Second, // the minimum guarantee cannot be met under the current load
+	40501: 10 * time.Second, // the service is busy
+	41839: time.Second,      // too many commit dependencies
+}
+
+// maxThrottleRetries is the number of times the azureretry parameter has
+// a throttled statement run again before its error is returned.
+const maxThrottleRetries = 3
+
+var (
+	throttleIDRe    = regexp.MustCompile(`Resource ID\s*:\s*(\d+)`)
+	throttleLimitRe = regexp.MustCompile(`The (\w+) limit for the (?:database|elastic pool) is (\d+)`)
+	throttleUsageRe = regexp.MustCompile(`The (\w+) minimum guarantee is (\d+), maximum limit is (\d+) and the current usage for the (?:database|elastic pool) is (\d+)`)
+)
+
+// ThrottleError describes an error returned by Azure SQL when the database
+// or its elastic pool hit a resource limit: 10928, a limit such as that of
+// the sessions or workers is reached, 10929, the minimum guarantee of a
+// resource cannot be met, 40501, the service is busy, or 41839, too many
+// commit dependencies. Get it from an error returned by the driver with
+// errors.As and a pointer to a ThrottleError variable.
+//
+// The limits are those embedded in the message, and are zero when it does
+// not give them. Wait for RetryAfter before running the request again, or
+// set the "azureretry" connection string parameter to have statements run
+// outside of a transaction retried by the driver. The driver does not retry
+// a request when one of its statements completed before the error, but a
+// statement that is not idempotent, such as a procedure call without
+// NOCOUNT ON, may have had effects that the server does not report.
+type ThrottleError struct {
+	// Number is the number of the SQL Server error.
+	Number int32
+	// ResourceID identifies the resource that is limited, such as 1 for
+	// the worker threads and 2 for the sessions.
+	ResourceID int
+	// Resource is the name of the resource in the message, such as
+	// "session" or "worker".
+	Resource         string
+	Limit            int64
+	MinimumGuarantee int64
+	CurrentUsage     int64
+	// RetryAfter is the recommended wait before retrying the request.
+	RetryAfter time.Duration
+	// Err is the error sent by the server.
+	Err Error
+}
+
+func (e ThrottleError) Error() string {
+	return e.Err.Error()
+}
+
+func (e ThrottleError) Unwrap() error {
+	return e.Err
+}
+
+// throttleError returns the ThrottleError of the first resource governance
+// error in errs.
+func throttleError(errs []Error) (ThrottleError, bool) {
+	for _, err := range errs {
+		wait, ok := throttleWaits[err.Number]
+		if !ok {
+			continue
+		}
+		t := ThrottleError{Number: err.Number, RetryAfter: wait, Err: err}
+		if m := throttleIDRe.FindStringSubmatch(err.Message); m != nil {
+			t.ResourceID, _ = strconv.Atoi(m[1])
+		}
+		if m := throttleLimitRe.FindStringSubmatch(err.Message); m != nil {
+			t.Resource = m[1]
+			t.Limit, _ = strconv.ParseInt(m[2], 10, 64)
+		}
+		if m := throttleUsageRe.FindStringSubmatch(err.Message); m != nil {
+			t.Resource = m[1]
+			t.MinimumGuarantee, _ = strconv.ParseInt(m[2], 10, 64)
+			t.Limit, _ = strconv.ParseInt(m[3], 10, 64)
+			t.CurrentUsage, _ = strconv.ParseInt(m[4], 10, 64)
+		}
+		return t, true
+	}
+	return ThrottleError{}, false
+}
+
+// retryThrottled reports whether the statement of s, which failed with err
+// on its attempt-th run, runs again: the azureretry parameter is set, the
+// connection is good and outside of a transaction, err is a ThrottleError,
+// no statement of the request completed before it failed and fewer than
+// maxThrottleRetries retries were made. It waits for RetryAfter times
+// attempt first, and reports false if ctx is done sooner or when its
+// deadline, such as that of the command timeout, comes before the wait is
+// over.
+func (s *Stmt) retryThrottled(ctx context.Context, err error, attempt int) bool {
+	c := s.c
+	if c.connector == nil || !c.connector.params.AzureRetry || attempt > maxThrottleRetries ||
+		!c.connectionGood || c.sess == nil || c.sess.tranid != 0 || s.completed {
+		return false
+	}
+	var t ThrottleError
+	if !errors.As(err, &t) {
+		return false
+	}
+	wait := t.RetryAfter * time.Duration(attempt)
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) <= wait {
+		return false
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
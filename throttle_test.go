@@ -0,0 +1,149 @@
+package mssql
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"encoding/binary"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/microsoft/go-mssqldb/msdsn"
+)
+
+func TestThrottleError(t *testing.T) {
+	limit := Error{Number: 10928, Message: "Resource ID : 1. The request limit for the database is 200 and has been reached. See 'http://go.microsoft.com/fwlink/?LinkId=267637' for assistance."}
+	usage := Error{Number: 10929, Message: "Resource ID : 1. The request minimum guarantee is 20, maximum limit is 400 and the current usage for the elastic pool is 401. However, the server is currently too busy to support requests greater than 20 for this elastic pool. See 'http://go.microsoft.com/fwlink/?LinkId=267637' for assistance. Please retry later."}
+	tests := []struct {
+		err  error
+		want ThrottleError
+	}{
+		{limit, ThrottleError{Number: 10928, ResourceID: 1, Resource: "request", Limit: 200, RetryAfter: 10 * time.Second, Err: limit}},
+		{usage, ThrottleError{Number: 10929, ResourceID: 1, Resource: "request", Limit: 400, MinimumGuarantee: 20, CurrentUsage: 401, RetryAfter: 10 * time.Second, Err: usage}},
+		{Error{Number: 41839, Message: "Transaction exceeded the maximum number of commit dependencies."}, ThrottleError{Number: 41839, RetryAfter: time.Second}},
+		{Error{Number: 3621, All: []Error{{Number: 3621}, {Number: 40501, Message: "The service is currently busy."}}}, ThrottleError{Number: 40501, RetryAfter: 10 * time.Second}},
+	}
+	for _, tst := range tests {
+		var got ThrottleError
+		if !errors.As(tst.err, &got) {
+			t.Errorf("%v is not a ThrottleError", tst.err)
+			continue
+		}
+		if got.Err.Number != tst.want.Number {
+			t.Errorf("got the error %d for %v", got.Err.Number, tst.err)
+		}
+		got.Err, tst.want.Err = Error{}, Error{}
+		if !reflect.DeepEqual(got, tst.want) {
+			t.Errorf("got %#v, want %#v", got, tst.want)
+		}
+	}
+
+	var te ThrottleError
+	if errors.As(Error{Number: 208}, &te) {
+		t.Error("error 208 is a ThrottleError")
+	}
+	if !IsRetryable(Error{Number: 41839}) {
+		t.Error("error 41839 is not retryable")
+	}
+}
+
+// throttledReply returns a reply packet with error 10928 when throttled is
+// set, and one with an empty DONE token otherwise. The DONE tokens of the
+// statements that ran before, with the given statuses, come first.
+func throttledReply(throttled bool, before ...uint16) []byte {
+	var tokens bytes.Buffer
+	for _, status := range before {
+		tokens.WriteByte(byte(tokenDone))
+		_ = binary.Write(&tokens, binary.LittleEndian, []uint16{status, 0})
+		_ = binary.Write(&tokens, binary.LittleEndian, uint64(1))
+	}
+	status := uint16(0)
+	if throttled {
+		tok := makeInfoToken(10928, 16, "Resource ID : 2. The session limit for the database is 30 and has been reached.")
+		tok[0] = byte(tokenError)
+		tokens.Write(tok)
+		status = doneError
+	}
+	tokens.WriteByte(byte(tokenDone))
+	_ = binary.Write(&tokens, binary.LittleEndian, []uint16{status, 0})
+	_ = binary.Write(&tokens, binary.LittleEndian, uint64(0))
+	return append([]byte{byte(packReply), statusEOM, 0, byte(8 + tokens.Len()), 0, 0, 1, 0}, tokens.Bytes()...)
+}
+
+func TestAzureRetry(t *testing.T) {
+	defer func(wait time.Duration) { throttleWaits[10928] = wait }(throttleWaits[10928])
+	throttleWaits[10928] = time.Millisecond
+
+	newStmt := func(retry bool, replies ...bool) (*Stmt, *replyTransport) {
+		var reply bytes.Buffer
+		for _, throttled := range replies {
+			reply.Write(throttledReply(throttled))
+		}
+		transport := &replyTransport{reply: &reply}
+		c := &Conn{
+			connector:      &Connector{params: msdsn.Config{AzureRetry: retry}},
+			connectionGood: true,
+			sess: &tdsSession{
+				buf:    newTdsBuffer(defaultPacketSize, transport),
+				logger: optionalLogger{},
+			},
+		}
+		return &Stmt{c: c, query: "update t set x = 1", paramCount: -1}, transport
+	}
+	ctx := context.Background()
+
+	s, transport := newStmt(true, true, true, false)
+	if _, err := s.ExecContext(ctx, []driver.NamedValue{}); err != nil {
+		t.Fatalf("the throttled statement failed after retries: %v", err)
+	}
+	if n := len(transport.packets()); n != 3 {
+		t.Errorf("the statement was sent %d times, want 3", n)
+	}
+
+	s, transport = newStmt(false, true)
+	_, err := s.ExecContext(ctx, []driver.NamedValue{})
+	var te ThrottleError
+	if !errors.As(err, &te) || te.Resource != "session" || te.Limit != 30 {
+		t.Fatalf("got error %v without azureretry, want a ThrottleError", err)
+	}
+	if n := len(transport.packets()); n != 1 {
+		t.Errorf("the statement was sent %d times without azureretry, want 1", n)
+	}
+
+	for _, before := range []uint16{doneMore, doneMore | doneCount} {
+		s, transport = newStmt(true)
+		transport.reply.Write(throttledReply(true, before))
+		if _, err := s.ExecContext(ctx, []driver.NamedValue{}); !errors.As(err, &te) {
+			t.Fatalf("got error %v, want a ThrottleError", err)
+		}
+		if n := len(transport.packets()); n != 1 {
+			t.Errorf("a statement throttled after a DONE with status %d was sent %d times, want 1", before, n)
+		}
+	}
+
+	s, _ = newStmt(true)
+	s.c.sess.tranid = 1
+	if s.retryThrottled(ctx, err, 1) {
+		t.Error("a statement in a transaction is retried")
+	}
+	s.c.sess.tranid = 0
+	if s.retryThrottled(ctx, err, maxThrottleRetries+1) {
+		t.Errorf("a statement is retried more than %d times", maxThrottleRetries)
+	}
+	if s.retryThrottled(ctx, Error{Number: 208}, 1) {
+		t.Error("a statement that is not throttled is retried")
+	}
+	cancelled, cancel := context.WithCancel(ctx)
+	cancel()
+	throttleWaits[10928] = time.Hour
+	if s.retryThrottled(cancelled, err, 1) {
+		t.Error("a statement is retried after its context is done")
+	}
+	short, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	if s.retryThrottled(short, err, 1) {
+		t.Error("a statement is retried when the wait does not fit before its deadline")
+	}
+}
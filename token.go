@@ -9,9 +9,12 @@ import (
 	"io/ioutil"
 	"net"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/golang-sql/sqlexp"
 	"github.com/microsoft/go-mssqldb/aecmk"
+	"github.com/microsoft/go-mssqldb/internal/cp"
 	"github.com/microsoft/go-mssqldb/internal/github.com/swisscom/mssql-always-encrypted/pkg/algorithms"
 	"github.com/microsoft/go-mssqldb/internal/github.com/swisscom/mssql-always-encrypted/pkg/encryption"
 	"github.com/microsoft/go-mssqldb/internal/github.com/swisscom/mssql-always-encrypted/pkg/keys"
@@ -106,10 +109,17 @@ const (
 // https://msdn.microsoft.com/en-us/library/dd357363.aspx
 const (
 	colFlagNullable  = 1
+	colFlagIdentity  = 0x10
+	colFlagComputed  = 0x20
 	colFlagEncrypted = 0x0800
+	// the server could not tell whether the column is nullable
+	colFlagNullableUnknown = 0x8000
 	// TODO implement more flags
 )
 
+// user type of timestamp (rowversion) columns
+const userTypeTimestamp = 0x50
+
 // interface for all tokens
 type tokenStruct interface{}
 
@@ -168,9 +178,8 @@ func processEnvChg(ctx context.Context, sess *tdsSession) {
 				badStreamPanic(err)
 			}
 		case envTypLanguage:
-			// currently ignored
 			// new value
-			if _, err = readBVarChar(r); err != nil {
+			if sess.language, err = readBVarChar(r); err != nil {
 				badStreamPanic(err)
 			}
 			// old value
@@ -200,6 +209,9 @@ func processEnvChg(ctx context.Context, sess *tdsSession) {
 			if err != nil {
 				badStreamPanicf("Invalid Packet size value returned from server (%s): %s", packetsize, err.Error())
 			}
+			if packetsizei < 512 || packetsizei > 32767 {
+				badStreamPanicf("Packet size returned from server is out of range: %d", packetsizei)
+			}
 			sess.buf.ResizeBuffer(packetsizei)
 		case envSortId:
 			// currently ignored
@@ -222,7 +234,6 @@ func processEnvChg(ctx context.Context, sess *tdsSession) {
 				badStreamPanic(err)
 			}
 		case envSqlCollation:
-			// currently ignored
 			var collationSize uint8
 			err = binary.Read(r, binary.LittleEndian, &collationSize)
 			if err != nil {
@@ -247,6 +258,7 @@ func processEnvChg(ctx context.Context, sess *tdsSession) {
 			if err != nil {
 				badStreamPanic(err)
 			}
+			sess.collation = cp.Collation{LcidAndFlags: info, SortId: sortID}
 
 			// old value, should be 0
 			if _, err = readBVarChar(r); err != nil {
@@ -310,6 +322,9 @@ func processEnvChg(ctx context.Context, sess *tdsSession) {
 			if err != nil {
 				badStreamPanic(err)
 			}
+			if sess.failover != nil {
+				sess.failover.set(sess.partner)
+			}
 			_, err = readBVarChar(r)
 			if err != nil {
 				badStreamPanic(err)
@@ -588,6 +603,12 @@ func parseFeatureExtAck(r *tdsBuffer) featureExtAck {
 
 			}
 			ack[feature] = colAck
+		default:
+			// Keep the raw data so the acknowledgement is still visible.
+			data := make([]byte, length)
+			r.ReadFull(data)
+			ack[feature] = data
+			length = 0
 		}
 
 		// Skip unprocessed bytes
@@ -1001,6 +1022,9 @@ func processSingleResponse(ctx context.Context, sess *tdsSession, ch chan tokenS
 			return
 		case tokenReturnStatus:
 			returnStatus := parseReturnStatus(sess.buf)
+			if outs.typedMsgs {
+				_ = sqlexp.ReturnMessageEnqueue(ctx, outs.msgq, ReturnStatusMessage{Status: returnStatus})
+			}
 			ch <- returnStatus
 		case tokenLoginAck:
 			loginAck := parseLoginAck(sess.buf)
@@ -1042,7 +1066,7 @@ func processSingleResponse(ctx context.Context, sess *tdsSession, ch chan tokenS
 		case tokenDone, tokenDoneProc:
 			done := parseDone(sess.buf)
 			done.errors = errs
-			if outs.msgq != nil {
+			if outs.msgq != nil || outs.raw {
 				errs = make([]Error, 0, 5)
 			}
 			if sess.logFlags&logDebug != 0 {
@@ -1088,7 +1112,9 @@ func processSingleResponse(ctx context.Context, sess *tdsSession, ch chan tokenS
 
 		case tokenRow:
 			row := make([]interface{}, len(columns))
+			sess.buf.arena = outs.arena.beginRow()
 			err = parseRow(ctx, sess.buf, sess, columns, row)
+			sess.buf.arena = nil
 			if err != nil {
 				ch <- err
 				return
@@ -1096,14 +1122,24 @@ func processSingleResponse(ctx context.Context, sess *tdsSession, ch chan tokenS
 			ch <- row
 		case tokenNbcRow:
 			row := make([]interface{}, len(columns))
+			sess.buf.arena = outs.arena.beginRow()
 			err = parseNbcRow(ctx, sess.buf, sess, columns, row)
+			sess.buf.arena = nil
 			if err != nil {
 				ch <- err
 				return
 			}
 			ch <- row
 		case tokenEnvChange:
+			if !outs.typedMsgs {
+				processEnvChg(ctx, sess)
+				break
+			}
+			env := envOf(sess)
 			processEnvChg(ctx, sess)
+			for _, m := range env.changes(envOf(sess)) {
+				_ = sqlexp.ReturnMessageEnqueue(ctx, outs.msgq, m)
+			}
 		case tokenError:
 			err := parseError72(sess.buf)
 			if sess.logFlags&logDebug != 0 {
@@ -1124,11 +1160,23 @@ func processSingleResponse(ctx context.Context, sess *tdsSession, ch chan tokenS
 			if sess.logFlags&logMessages != 0 {
 				sess.logger.Log(ctx, msdsn.LogMessages, info.Message)
 			}
+			if sess.loggingIn {
+				sess.loginMessages = append(sess.loginMessages, info)
+			}
+			if outs.stats != nil {
+				outs.stats.addMessage(info)
+			}
 			if outs.msgq != nil {
 				_ = sqlexp.ReturnMessageEnqueue(ctx, outs.msgq, sqlexp.MsgNotice{Message: info})
 			}
+			if outs.raw {
+				ch <- MessageToken(info)
+			}
 		case tokenReturnValue:
 			nv := parseReturnValue(sess.buf, sess)
+			if outs.raw {
+				ch <- ReturnValueToken{Name: strings.TrimPrefix(nv.Name, "@"), Value: nv.Value}
+			}
 			if len(nv.Name) > 0 {
 				name := nv.Name[1:] // Remove the leading "@".
 				if ov, has := outs.params[name]; has {
@@ -1155,16 +1203,55 @@ type tokenProcessor struct {
 	firstError error
 	// whether to skip sending attention when ctx is done
 	noAttn bool
+	// rowsReturned counts the rows read by iterateResponse, which passes
+	// them to onRow when set.
+	rowsReturned int64
+	onRow        func(cols []columnStruct, row []interface{})
+	// done is closed once the whole response was read from the
+	// connection, though its tokens may still wait in tokChan.
+	done chan struct{}
+	// completed is set when a statement of the request completed, which
+	// a DONE token reports with a row count, or with DONE_MORE before the
+	// first error. Such a request is not run again when it fails.
+	completed bool
+}
+
+// tokenChanSize is the number of tokens the goroutine reading a response
+// can read ahead of their consumer, unless WithReadAhead sets another.
+const tokenChanSize = 5
+
+// readAheadSize returns the size of the token channel of a response.
+func (o outputs) readAheadSize() int {
+	if o.readAhead > 0 {
+		return o.readAhead
+	}
+	return tokenChanSize
 }
 
 func startReading(sess *tdsSession, ctx context.Context, outs outputs) *tokenProcessor {
-	tokChan := make(chan tokenStruct, 5)
-	go processSingleResponse(ctx, sess, tokChan, outs)
+	tokChan := make(chan tokenStruct, outs.readAheadSize())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		processSingleResponse(ctx, sess, tokChan, outs)
+	}()
 	return &tokenProcessor{
 		tokChan: tokChan,
 		ctx:     ctx,
 		sess:    sess,
 		outs:    outs,
+		done:    done,
+	}
+}
+
+// responseRead reports whether the whole response was read from the
+// connection, so that another request can be sent.
+func (t *tokenProcessor) responseRead() bool {
+	select {
+	case <-t.done:
+		return true
+	default:
+		return false
 	}
 }
 
@@ -1180,16 +1267,22 @@ func (t *tokenProcessor) iterateResponse() error {
 					t.sess.columns = token
 				case []interface{}:
 					t.lastRow = token
+					t.rowsReturned++
+					if t.onRow != nil {
+						t.onRow(t.sess.columns, token)
+					}
 				case doneInProcStruct:
+					t.noteDone(token.Status)
 					if token.Status&doneCount != 0 {
 						t.rowCount += int64(token.RowCount)
 					}
 				case doneStruct:
+					t.noteDone(token.Status)
 					if token.Status&doneCount != 0 {
 						t.rowCount += int64(token.RowCount)
 					}
-					if token.isError() && t.firstError == nil {
-						t.firstError = token.getError()
+					if token.isError() {
+						t.addError(token)
 					}
 				case ReturnStatus:
 					if t.outs.returnStatus != nil {
@@ -1207,6 +1300,37 @@ func (t *tokenProcessor) iterateResponse() error {
 	}
 }
 
+// noteDone sets completed when the DONE token of status reports a
+// completed statement.
+func (t *tokenProcessor) noteDone(status uint16) {
+	if status&doneCount != 0 || t.firstError == nil && status&(doneMore|doneError) == doneMore {
+		t.completed = true
+	}
+}
+
+// addError records the errors of a DONE token. The first failing
+// statement is reported, with the errors of later statements in the
+// same batch appended to its All list.
+func (t *tokenProcessor) addError(done doneStruct) {
+	first, ok := t.firstError.(Error)
+	if t.firstError == nil {
+		t.firstError = done.getError()
+		return
+	}
+	if !ok {
+		return
+	}
+	if t.outs.msgq == nil {
+		// Without a message queue errors accumulate across DONE tokens.
+		if len(done.errors) > len(first.All) {
+			first.All = append(first.All, done.errors[len(first.All):]...)
+		}
+	} else {
+		first.All = append(first.All, done.errors...)
+	}
+	t.firstError = first
+}
+
 func (t tokenProcessor) nextToken() (tokenStruct, error) {
 	// we do this separate non-blocking check on token channel to
 	// prioritize it over cancellation channel
@@ -1250,6 +1374,7 @@ func (t tokenProcessor) nextToken() (tokenStruct, error) {
 			// notify caller and close channel
 			return nil, err
 		}
+		defer watchAttention(t.sess)()
 
 		// now the server should send cancellation confirmation
 		// it is possible that we already received full response
@@ -1265,7 +1390,7 @@ func (t tokenProcessor) nextToken() (tokenStruct, error) {
 		}
 		// we did not get cancellation confirmation in the current response
 		// read one more response, it must be there
-		t.tokChan = make(chan tokenStruct, 5)
+		t.tokChan = make(chan tokenStruct, t.outs.readAheadSize())
 		go processSingleResponse(t.ctx, t.sess, t.tokChan, t.outs)
 		if readCancelConfirmation(t.tokChan) {
 			return nil, t.ctx.Err()
@@ -1276,6 +1401,29 @@ func (t tokenProcessor) nextToken() (tokenStruct, error) {
 	}
 }
 
+// attentionTimeout bounds the wait for the server to confirm an attention.
+// A server busy in a long WAITFOR confirms it at once, so one that does not
+// answer in time is unreachable and its connection is given up.
+var attentionTimeout = 30 * time.Second
+
+// watchAttention makes the reads of sess fail once attentionTimeout passed
+// after an attention was sent, so that waiting for its confirmation cannot
+// block forever on a connection that went away. It returns the function
+// that stops it once the confirmation is read.
+func watchAttention(sess *tdsSession) (stop func()) {
+	if sess.conn == nil {
+		return func() {}
+	}
+	timer := time.AfterFunc(attentionTimeout, func() {
+		_ = sess.conn.SetReadDeadline(time.Now())
+	})
+	return func() {
+		if !timer.Stop() {
+			_ = sess.conn.SetReadDeadline(time.Time{})
+		}
+	}
+}
+
 func readCancelConfirmation(tokChan chan tokenStruct) bool {
 	for tok := range tokChan {
 		switch tok := tok.(type) {
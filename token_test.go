@@ -1,7 +1,9 @@
 package mssql
 
 import (
+	"context"
 	"encoding/hex"
+	"errors"
 	"regexp"
 	"testing"
 )
@@ -40,3 +42,87 @@ func TestParseFeatureExtAck(t *testing.T) {
 		parseFeatureExtAck(r)
 	}
 }
+
+func TestIterateResponseCollectsBatchErrors(t *testing.T) {
+	first := Error{Number: 547, Message: "constraint conflict"}
+	second := Error{Number: 2627, Message: "duplicate key"}
+	tokChan := make(chan tokenStruct, 5)
+	// without a message queue errors accumulate across DONE tokens
+	tokChan <- doneStruct{Status: doneError | doneMore, errors: []Error{first}}
+	tokChan <- doneStruct{Status: doneMore | doneCount, RowCount: 1, errors: []Error{first}}
+	tokChan <- doneStruct{Status: doneError, errors: []Error{first, second}}
+	close(tokChan)
+	tp := tokenProcessor{tokChan: tokChan, ctx: context.Background(), sess: &tdsSession{}}
+
+	err := tp.iterateResponse()
+	var sqlErr Error
+	if !errors.As(err, &sqlErr) || sqlErr.Number != first.Number {
+		t.Fatalf("expected the first error to be returned, got %v", err)
+	}
+	var batchErrs BatchErrors
+	if !errors.As(err, &batchErrs) {
+		t.Fatalf("errors.As did not find BatchErrors in %v", err)
+	}
+	if len(batchErrs.Errors) != 2 || batchErrs.Errors[0].Number != 547 || batchErrs.Errors[1].Number != 2627 {
+		t.Fatalf("unexpected batch errors %+v", batchErrs.Errors)
+	}
+	if msg := batchErrs.Error(); msg != "mssql: constraint conflict; duplicate key" {
+		t.Errorf("unexpected BatchErrors message %q", msg)
+	}
+}
+
+func envChangePacketSize(newSize, oldSize string) []byte {
+	var data []byte
+	data = append(data, envTypPacketSize, byte(len(newSize)))
+	data = append(data, str2ucs2(newSize)...)
+	data = append(data, byte(len(oldSize)))
+	data = append(data, str2ucs2(oldSize)...)
+	return append([]byte{byte(len(data)), 0}, data...)
+}
+
+func TestProcessEnvChgSession(t *testing.T) {
+	var data []byte
+	for _, chg := range []struct {
+		typ      byte
+		new, old string
+	}{{envTypDatabase, "sales", "master"}, {envTypLanguage, "Deutsch", "us_english"}} {
+		data = append(data, chg.typ, byte(len(chg.new)))
+		data = append(data, str2ucs2(chg.new)...)
+		data = append(data, byte(len(chg.old)))
+		data = append(data, str2ucs2(chg.old)...)
+	}
+	// Latin1_General_CI_AS
+	data = append(data, envSqlCollation, 5, 0x09, 0x04, 0xd0, 0x00, 0x00, 0)
+	b := append([]byte{byte(len(data)), 0}, data...)
+	sess := &tdsSession{buf: &tdsBuffer{packetSize: 4096, rbuf: b, rsize: len(b)}}
+	c := &Conn{sess: sess}
+	if _, ok := c.Collation(); ok {
+		t.Error("a collation is reported before the server sent one")
+	}
+	processEnvChg(context.Background(), sess)
+	if c.Database() != "sales" || c.Language() != "Deutsch" {
+		t.Errorf("got database %q and language %q, want sales and Deutsch", c.Database(), c.Language())
+	}
+	col, ok := c.Collation()
+	if !ok || col.LCID != 0x0409 || !col.IgnoreCase || col.IgnoreAccent || !col.IgnoreKana || !col.IgnoreWidth {
+		t.Errorf("got collation %+v, %t", col, ok)
+	}
+}
+
+func TestProcessEnvChgPacketSize(t *testing.T) {
+	b := envChangePacketSize("8192", "4096")
+	sess := &tdsSession{buf: &tdsBuffer{packetSize: 4096, rbuf: b, rsize: len(b)}}
+	processEnvChg(context.Background(), sess)
+	if got := (&Conn{sess: sess}).PacketSize(); got != 8192 {
+		t.Errorf("packet size is %d, want 8192", got)
+	}
+
+	b = envChangePacketSize("65536", "8192")
+	sess.buf.rbuf, sess.buf.rpos, sess.buf.rsize = b, 0, len(b)
+	defer func() {
+		if recover() == nil {
+			t.Error("an out of range packet size should be rejected")
+		}
+	}()
+	processEnvChg(context.Background(), sess)
+}
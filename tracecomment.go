@@ -0,0 +1,137 @@
+package mssql
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"strings"
+)
+
+// traceContext is a W3C trace context, as in the traceparent header.
+type traceContext struct {
+	traceParent string
+	traceID     [16]byte
+	spanID      [8]byte
+}
+
+type traceContextKey struct{}
+
+// parseTraceParent parses a traceparent of the version 00 format, such as
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01".
+func parseTraceParent(s string) (traceContext, error) {
+	tc := traceContext{traceParent: strings.ToLower(s)}
+	parts := strings.Split(tc.traceParent, "-")
+	if len(parts) != 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return tc, errors.New("mssql: invalid traceparent " + s)
+	}
+	if _, err := hex.Decode(tc.traceID[:], []byte(parts[1])); err != nil {
+		return tc, errors.New("mssql: invalid trace id in traceparent " + s)
+	}
+	if _, err := hex.Decode(tc.spanID[:], []byte(parts[2])); err != nil {
+		return tc, errors.New("mssql: invalid span id in traceparent " + s)
+	}
+	if tc.traceID == [16]byte{} || tc.spanID == [8]byte{} {
+		return tc, errors.New("mssql: traceparent " + s + " has a zero id")
+	}
+	return tc, nil
+}
+
+// WithTraceParent returns a context whose statements carry the W3C trace
+// context traceparent, such as
+// "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01". The trace id
+// is sent as the activity id of the requests, which Extended Events
+// sessions record in attach_activity_id when TRACK_CAUSALITY is on, and
+// TraceComment adds the trace context to the text of the statements. An
+// invalid traceparent is ignored.
+func WithTraceParent(ctx context.Context, traceparent string) context.Context {
+	tc, err := parseTraceParent(traceparent)
+	if err != nil {
+		return ctx
+	}
+	return context.WithValue(ctx, traceContextKey{}, tc)
+}
+
+func traceContextFromContext(ctx context.Context) (traceContext, bool) {
+	tc, ok := ctx.Value(traceContextKey{}).(traceContext)
+	return tc, ok
+}
+
+// traceActivityHeader returns the trace activity header of the trace
+// context of ctx, if it has one.
+func (s *tdsSession) traceActivityHeader(ctx context.Context) (headerStruct, bool) {
+	tc, ok := traceContextFromContext(ctx)
+	if !ok {
+		return headerStruct{}, false
+	}
+	s.activitySeq++
+	hdr := traceActivityHdr{activityID: UniqueIdentifier(tc.traceID), sequence: s.activitySeq}
+	return headerStruct{hdrtype: dataStmHdrTraceActivity, data: hdr.pack()}, true
+}
+
+// DefaultTraceCommentTemplate is the comment added by TraceComment when
+// its Template is empty, in the format of sqlcommenter.
+const DefaultTraceCommentTemplate = "/*traceparent='{traceparent}'*/"
+
+// TraceComment is an Interceptor adding a comment with the trace context
+// of a statement to its text, so the statements captured on the server,
+// such as in Extended Events or the plan cache, can be matched with the
+// distributed traces they belong to. The trace context comes from
+// WithTraceParent, or else from TraceParent.
+//
+// Calls of stored procedures by name, which have no text to add the comment
+// to, are left as they are, as are statements without a trace context.
+//
+// The comment is part of the text the server caches plans by, so a
+// comment that changes with each call, as the traceparent does, compiles
+// and caches a new plan for every statement it is added to: this costs CPU
+// and fills the plan cache with single-use plans, and Query Store records
+// each text as a different query. Add it only where that is acceptable,
+// such as to sampled or infrequent statements, or use a Template naming
+// something stable. WithTraceParent alone sends the trace id as the
+// activity id of the request, outside the text, and adds no cost.
+type TraceComment struct {
+	// Template is the comment added on a line of its own at the end of the
+	// statement, DefaultTraceCommentTemplate when empty. These
+	// placeholders are replaced:
+	//
+	//	{traceparent}  the traceparent
+	//	{trace_id}     the trace id, in hexadecimal
+	//	{span_id}      the span id, in hexadecimal
+	//	{activity_id}  the trace id as the activity id GUID of the request
+	Template string
+	// TraceParent, when set, returns the traceparent of the statements run
+	// with ctx without WithTraceParent, such as that of the current span of
+	// a tracing library.
+	TraceParent func(ctx context.Context) string
+}
+
+// BeforeQuery adds the trace comment to q.Query, and returns ctx with the
+// trace context for the activity id of the request.
+func (t TraceComment) BeforeQuery(ctx context.Context, q *QueryInfo) (context.Context, error) {
+	tc, ok := traceContextFromContext(ctx)
+	if !ok && t.TraceParent != nil {
+		var err error
+		if tc, err = parseTraceParent(t.TraceParent(ctx)); err == nil {
+			ok = true
+			ctx = context.WithValue(ctx, traceContextKey{}, tc)
+		}
+	}
+	if !ok || isProc(q.Query) {
+		return ctx, nil
+	}
+	template := t.Template
+	if template == "" {
+		template = DefaultTraceCommentTemplate
+	}
+	comment := strings.NewReplacer(
+		"{traceparent}", tc.traceParent,
+		"{trace_id}", hex.EncodeToString(tc.traceID[:]),
+		"{span_id}", hex.EncodeToString(tc.spanID[:]),
+		"{activity_id}", UniqueIdentifier(tc.traceID).String(),
+	).Replace(template)
+	q.Query += "\n" + comment
+	return ctx, nil
+}
+
+// AfterQuery does nothing.
+func (TraceComment) AfterQuery(ctx context.Context, q *QueryInfo) {}
@@ -0,0 +1,104 @@
+package mssql
+
+import (
+	"bytes"
+	"context"
+	"testing"
+)
+
+const testTraceParent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestParseTraceParent(t *testing.T) {
+	tc, err := parseTraceParent(testTraceParent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tc.traceID[0] != 0x4b || tc.traceID[15] != 0x36 || tc.spanID[0] != 0x00 || tc.spanID[7] != 0xb7 {
+		t.Errorf("got trace id %x and span id %x", tc.traceID, tc.spanID)
+	}
+	for _, s := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+	} {
+		if _, err := parseTraceParent(s); err == nil {
+			t.Errorf("traceparent %q was accepted", s)
+		}
+	}
+	if ctx := WithTraceParent(context.Background(), "bad"); ctx != context.Background() {
+		t.Error("WithTraceParent kept an invalid traceparent")
+	}
+}
+
+func TestTraceComment(t *testing.T) {
+	ctx := WithTraceParent(context.Background(), testTraceParent)
+	tests := []struct {
+		template string
+		query    string
+		want     string
+	}{
+		{"", "select 1", "select 1\n/*traceparent='" + testTraceParent + "'*/"},
+		{"/* trace={trace_id} span={span_id} activity={activity_id} */", "select 1",
+			"select 1\n/* trace=4bf92f3577b34da6a3ce929d0e0e4736 span=00f067aa0ba902b7 activity=4BF92F35-77B3-4DA6-A3CE-929D0E0E4736 */"},
+		{"", "dbo.proc", "dbo.proc"},
+	}
+	for _, tt := range tests {
+		q := &QueryInfo{Query: tt.query}
+		if _, err := (TraceComment{Template: tt.template}).BeforeQuery(ctx, q); err != nil {
+			t.Fatal(err)
+		}
+		if q.Query != tt.want {
+			t.Errorf("got %q, want %q", q.Query, tt.want)
+		}
+	}
+
+	q := &QueryInfo{Query: "select 1"}
+	if _, err := (TraceComment{}).BeforeQuery(context.Background(), q); err != nil || q.Query != "select 1" {
+		t.Errorf("a statement without trace context became %q", q.Query)
+	}
+	tc := TraceComment{TraceParent: func(context.Context) string { return testTraceParent }}
+	next, err := tc.BeforeQuery(context.Background(), q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := traceContextFromContext(next); !ok {
+		t.Error("the trace context of TraceParent is not in the returned context")
+	}
+}
+
+func TestSendQueryTraceActivity(t *testing.T) {
+	transport := &replyTransport{reply: &bytes.Buffer{}}
+	c := &Conn{
+		connectionGood: true,
+		sess: &tdsSession{
+			buf:    newTdsBuffer(defaultPacketSize, transport),
+			logger: optionalLogger{},
+		},
+	}
+	s := &Stmt{c: c, query: "select 1"}
+	ctx := WithTraceParent(context.Background(), testTraceParent)
+	for i := 0; i < 2; i++ {
+		if err := s.sendQuery(ctx, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// The activity id is the trace id as a GUID, in the byte order of
+	// uniqueidentifier, followed by the sequence of the request.
+	header := []byte{
+		byte(dataStmHdrTraceActivity), 0,
+		0x35, 0x2f, 0xf9, 0x4b, 0xb3, 0x77, 0xa6, 0x4d,
+		0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36,
+	}
+	packets := transport.packets()
+	if len(packets) != 2 {
+		t.Fatalf("got %d packets, want 2", len(packets))
+	}
+	for i, p := range packets {
+		want := append(append([]byte(nil), header...), byte(i+1), 0, 0, 0)
+		if !bytes.Contains(p, want) {
+			t.Errorf("packet %d has no trace activity header of sequence %d: %x", i, i+1, p)
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package mssql
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// InTransaction reports whether a transaction is open on the connection,
+// whether it was begun with BeginTx or by a statement such as BEGIN
+// TRANSACTION, as told by the server when transactions begin and end. The
+// server only reports the outermost transaction: use TransactionCount for
+// the nesting depth. Use sql.Conn.Raw to reach the underlying *mssql.Conn.
+func (c *Conn) InTransaction() bool {
+	return c.sess.tranid != 0
+}
+
+// TransactionCount returns the number of BEGIN TRANSACTION statements
+// open on conn, @@TRANCOUNT, which is zero outside of a transaction and
+// counts the nested BEGIN TRANSACTION statements inside of one.
+func TransactionCount(ctx context.Context, conn *sql.Conn) (int, error) {
+	var n int
+	err := conn.QueryRowContext(ctx, "select @@trancount").Scan(&n)
+	return n, err
+}
+
+// checkRawTransaction returns an error matching ErrRawTransaction when the
+// statement query left the transaction state of the connection at odds
+// with that of database/sql: it began a transaction outside of one, which
+// is rolled back, or it ended the transaction of BeginTx.
+func (c *Conn) checkRawTransaction(query string) error {
+	if c.connector == nil || !c.connector.FailOnRawTransactions {
+		return nil
+	}
+	switch {
+	case !c.inTx && c.sess.tranid != 0:
+		if err := c.sendRollbackRequest(); err != nil {
+			return err
+		}
+		if err := c.simpleProcessResp(context.Background()); err != nil {
+			return err
+		}
+		return fmt.Errorf("mssql: %q began a transaction outside of BeginTx, which was rolled back: %w", query, ErrRawTransaction)
+	case c.inTx && c.sess.tranid == 0:
+		return fmt.Errorf("mssql: %q ended the transaction of BeginTx: %w", query, ErrRawTransaction)
+	}
+	return nil
+}
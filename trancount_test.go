@@ -0,0 +1,104 @@
+package mssql
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// tranReply returns a reply packet beginning (envtype envTypBeginTran) or
+// ending a transaction.
+func tranReply(envtype uint8) []byte {
+	var tokens bytes.Buffer
+	tokens.WriteByte(byte(tokenEnvChange))
+	_ = binary.Write(&tokens, binary.LittleEndian, uint16(11))
+	tokens.WriteByte(envtype)
+	id := []byte{8, 1, 2, 3, 4, 5, 6, 7, 8}
+	if envtype == envTypBeginTran {
+		tokens.Write(id)
+		tokens.WriteByte(0)
+	} else {
+		tokens.WriteByte(0)
+		tokens.Write(id)
+	}
+	tokens.WriteByte(byte(tokenDone))
+	_ = binary.Write(&tokens, binary.LittleEndian, []uint16{0, 0})
+	_ = binary.Write(&tokens, binary.LittleEndian, uint64(0))
+	return append([]byte{byte(packReply), statusEOM, 0, byte(8 + tokens.Len()), 0, 0, 1, 0}, tokens.Bytes()...)
+}
+
+func TestFailOnRawTransactions(t *testing.T) {
+	reply := bytes.NewBuffer(tranReply(envTypBeginTran))
+	reply.Write(tranReply(envTypRollbackTran))
+	transport := &replyTransport{reply: reply}
+	c := &Conn{
+		connector:      &Connector{FailOnRawTransactions: true},
+		connectionGood: true,
+		sess: &tdsSession{
+			buf:    newTdsBuffer(defaultPacketSize, transport),
+			logger: optionalLogger{},
+		},
+	}
+	s := &Stmt{c: c, query: "begin tran", paramCount: -1}
+	_, err := s.exec(context.Background(), nil)
+	if !errors.Is(err, ErrRawTransaction) {
+		t.Fatalf("got error %v, want ErrRawTransaction", err)
+	}
+	if c.InTransaction() {
+		t.Error("the transaction begun by the statement was not rolled back")
+	}
+	if packets := transport.packets(); len(packets) != 2 || packets[1][0] != byte(packTransMgrReq) {
+		t.Errorf("got %d packets, want the statement and a rollback", len(packets))
+	}
+
+	// The statements in a transaction of BeginTx are not affected, unless
+	// they end it.
+	c.inTx = true
+	c.sess.tranid = 1
+	if err = c.checkRawTransaction("update t set x = 1"); err != nil {
+		t.Error(err)
+	}
+	c.sess.tranid = 0
+	if err = c.checkRawTransaction("commit"); !errors.Is(err, ErrRawTransaction) {
+		t.Errorf("got error %v for a statement ending the transaction, want ErrRawTransaction", err)
+	}
+	c.connector.FailOnRawTransactions = false
+	if err = c.checkRawTransaction("commit"); err != nil {
+		t.Errorf("got error %v without FailOnRawTransactions", err)
+	}
+}
+
+func TestTransactionCount(t *testing.T) {
+	db, logger := open(t)
+	defer db.Close()
+	defer logger.StopLogging()
+
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err = conn.ExecContext(ctx, "begin tran; begin tran"); err != nil {
+		t.Fatal(err)
+	}
+	defer conn.ExecContext(ctx, "rollback")
+	n, err := TransactionCount(ctx, conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("got a transaction count of %d, want 2", n)
+	}
+	err = conn.Raw(func(driverConn interface{}) error {
+		if !driverConn.(*Conn).InTransaction() {
+			t.Error("InTransaction is false in a transaction")
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -6,9 +6,11 @@ package mssql
 import (
 	"bytes"
 	"database/sql"
+	"database/sql/driver"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"reflect"
 	"strings"
 	"time"
@@ -29,16 +31,43 @@ var (
 	ErrorSkip             = errors.New("all fields mustn't skip")
 	ErrorObjectName       = errors.New("wrong tvp name")
 	ErrorWrongTyping      = errors.New("the number of elements in columnStr and tvpFieldIndexes do not align")
+	ErrorTVPRows          = errors.New("TVPRows must have a struct Row and a Next function")
 )
 
+var valuerType = reflect.TypeOf((*driver.Valuer)(nil)).Elem()
+
 // TVP is driver type, which allows supporting Table Valued Parameters (TVP) in SQL Server
 type TVP struct {
 	//TypeName mustn't be default value
 	TypeName string
-	//Value must be the slice, mustn't be nil
+	//Value must be the slice, mustn't be nil, or a TVPRows. Fields of types
+	//implementing driver.Valuer, with a value or pointer receiver, are sent
+	//as their Value
 	Value interface{}
 }
 
+// TVPRows is the Value of a TVP whose rows are read from Next while the
+// parameter is sent, so that large TVPs are streamed to the server without
+// holding all of their rows in memory. The rows are read once; a statement
+// with such a TVP cannot be executed again.
+type TVPRows struct {
+	// Row is a struct of the type of the rows, its fields define the columns
+	// of the TVP as the elements of a slice Value do.
+	Row interface{}
+	// Next returns the next row, a struct of the type of Row, or io.EOF
+	// after the last one. Any other error aborts the request and is
+	// returned by it.
+	Next func() (interface{}, error)
+}
+
+// rowType returns the struct type of the rows of the TVP.
+func (tvp TVP) rowType() reflect.Type {
+	if rows, ok := tvp.Value.(TVPRows); ok {
+		return reflect.TypeOf(rows.Row)
+	}
+	return reflect.TypeOf(tvp.Value).Elem()
+}
+
 func (tvp TVP) check() error {
 	if len(tvp.TypeName) == 0 {
 		return ErrorEmptyTVPTypeName
@@ -49,6 +78,12 @@ func (tvp TVP) check() error {
 	if sepCount := getCountSQLSeparators(tvp.TypeName); sepCount > 1 {
 		return ErrorObjectName
 	}
+	if rows, ok := tvp.Value.(TVPRows); ok {
+		if rows.Next == nil || rows.Row == nil || reflect.TypeOf(rows.Row).Kind() != reflect.Struct {
+			return ErrorTVPRows
+		}
+		return nil
+	}
 	valueOf := reflect.ValueOf(tvp.Value)
 	if valueOf.Kind() != reflect.Slice {
 		return ErrorTypeSlice
@@ -63,6 +98,25 @@ func (tvp TVP) check() error {
 }
 
 func (tvp TVP) encode(schema, name string, columnStr []columnStruct, tvpFieldIndexes []int) ([]byte, error) {
+	buf, err := tvp.encodeMetadata(schema, name, columnStr, tvpFieldIndexes)
+	if err != nil {
+		return nil, err
+	}
+
+	stmt := newTVPStmt()
+	val := reflect.ValueOf(tvp.Value)
+	for i := 0; i < val.Len(); i++ {
+		if err = tvp.encodeRow(buf, stmt, val.Index(i), columnStr, tvpFieldIndexes); err != nil {
+			return nil, err
+		}
+	}
+	buf.WriteByte(_TVP_END_TOKEN)
+	return buf.Bytes(), nil
+}
+
+// encodeMetadata returns a buffer with the type name and the columns of the
+// TVP, to be followed by its rows.
+func (tvp TVP) encodeMetadata(schema, name string, columnStr []columnStruct, tvpFieldIndexes []int) (*bytes.Buffer, error) {
 	if len(columnStr) != len(tvpFieldIndexes) {
 		return nil, ErrorWrongTyping
 	}
@@ -85,58 +139,96 @@ func (tvp TVP) encode(schema, name string, columnStr []columnStruct, tvpFieldInd
 	}
 	// The returned error is always nil
 	buf.WriteByte(_TVP_END_TOKEN)
+	return buf, nil
+}
 
-	conn := new(Conn)
-	conn.sess = new(tdsSession)
-	conn.sess.loginAck = loginAckStruct{TDSVersion: verTDS73}
-	stmt := &Stmt{
-		c: conn,
-	}
+func (tvp TVP) encodeRow(buf *bytes.Buffer, stmt *Stmt, refStr reflect.Value, columnStr []columnStruct, tvpFieldIndexes []int) error {
+	buf.WriteByte(_TVP_ROW_TOKEN)
+	for columnStrIdx, fieldIdx := range tvpFieldIndexes {
+		if columnStr[columnStrIdx].Flags == fDefault {
+			continue
+		}
+		field := refStr.Field(fieldIdx)
+		if field.Kind() == reflect.Ptr && field.IsNil() {
+			// the NULL of the column type, such as a zero length for
+			// date, decimal or uniqueidentifier columns
+			columnStr[columnStrIdx].ti.Writer(buf, columnStr[columnStrIdx].ti, nil)
+			continue
+		}
+		if field.Kind() == reflect.Ptr && !field.Type().Elem().Implements(valuerType) {
+			// driver types such as civil.Date are only accepted by value
+			field = field.Elem()
+		}
+		tvpVal := field.Interface()
+		if valuer := tvpValuer(field); valuer != nil {
+			tvpVal = valuer
+		}
+		if tvp.verifyStandardTypeOnNull(buf, tvpVal) {
+			continue
+		}
+		valOf := reflect.ValueOf(tvpVal)
+		if valOf.Kind() == reflect.Slice && valOf.IsNil() {
+			binary.Write(buf, binary.LittleEndian, uint64(_PLP_NULL))
+			continue
+		}
 
-	val := reflect.ValueOf(tvp.Value)
-	for i := 0; i < val.Len(); i++ {
-		refStr := reflect.ValueOf(val.Index(i).Interface())
-		buf.WriteByte(_TVP_ROW_TOKEN)
-		for columnStrIdx, fieldIdx := range tvpFieldIndexes {
-			if columnStr[columnStrIdx].Flags == fDefault {
-				continue
-			}
-			field := refStr.Field(fieldIdx)
-			tvpVal := field.Interface()
-			if tvp.verifyStandardTypeOnNull(buf, tvpVal) {
-				continue
-			}
-			valOf := reflect.ValueOf(tvpVal)
-			elemKind := field.Kind()
-			if elemKind == reflect.Ptr && valOf.IsNil() {
-				switch tvpVal.(type) {
-				case *bool, *time.Time, *int8, *int16, *int32, *int64, *float32, *float64, *int,
-					*uint8, *uint16, *uint32, *uint64, *uint:
-					binary.Write(buf, binary.LittleEndian, uint8(0))
-					continue
-				default:
-					binary.Write(buf, binary.LittleEndian, uint64(_PLP_NULL))
-					continue
-				}
-			}
-			if elemKind == reflect.Slice && valOf.IsNil() {
-				binary.Write(buf, binary.LittleEndian, uint64(_PLP_NULL))
-				continue
-			}
+		cval, err := convertInputParameter(tvpVal)
+		if err != nil {
+			return fmt.Errorf("failed to convert tvp parameter row col: %s", err)
+		}
+		param, err := stmt.makeParam(cval)
+		if err != nil {
+			return fmt.Errorf("failed to make tvp parameter row col: %s", err)
+		}
+		columnStr[columnStrIdx].ti.Writer(buf, param.ti, param.buffer)
+	}
+	return nil
+}
 
-			cval, err := convertInputParameter(tvpVal)
-			if err != nil {
-				return nil, fmt.Errorf("failed to convert tvp parameter row col: %s", err)
-			}
-			param, err := stmt.makeParam(cval)
-			if err != nil {
-				return nil, fmt.Errorf("failed to make tvp parameter row col: %s", err)
+// writeRows writes the rows read from the TVPRows of the TVP, one at a
+// time, and the end of the TVP to w while the request is sent. When a row
+// cannot be read or encoded, the request is ended with the ignore status
+// so the server discards it, and the error is returned as a canceled send.
+func (tvp TVP) writeRows(w *tdsBuffer, columnStr []columnStruct, tvpFieldIndexes []int) error {
+	rows := tvp.Value.(TVPRows)
+	rowType := reflect.TypeOf(rows.Row)
+	stmt := newTVPStmt()
+	var buf bytes.Buffer
+	for {
+		row, err := rows.Next()
+		if err == io.EOF {
+			break
+		}
+		if err == nil && reflect.TypeOf(row) != rowType {
+			err = fmt.Errorf("mssql: TVP row of type %T, want %s", row, rowType)
+		}
+		if err == nil {
+			// addressable, for the fields with a Value method on the pointer
+			refStr := reflect.New(rowType).Elem()
+			refStr.Set(reflect.ValueOf(row))
+			buf.Reset()
+			err = tvp.encodeRow(&buf, stmt, refStr, columnStr, tvpFieldIndexes)
+		}
+		if err != nil {
+			if aerr := w.AbortPacket(); aerr != nil {
+				return aerr
 			}
-			columnStr[columnStrIdx].ti.Writer(buf, param.ti, param.buffer)
+			return sendCanceledError{err}
+		}
+		if _, err = w.Write(buf.Bytes()); err != nil {
+			return err
 		}
 	}
-	buf.WriteByte(_TVP_END_TOKEN)
-	return buf.Bytes(), nil
+	return w.WriteByte(_TVP_END_TOKEN)
+}
+
+func newTVPStmt() *Stmt {
+	conn := new(Conn)
+	conn.sess = new(tdsSession)
+	conn.sess.loginAck = loginAckStruct{TDSVersion: verTDS73}
+	return &Stmt{
+		c: conn,
+	}
 }
 
 func (tvp TVP) columnTypes() ([]columnStruct, []int, error) {
@@ -145,15 +237,7 @@ func (tvp TVP) columnTypes() ([]columnStruct, []int, error) {
 		isIdentity   bool
 	}
 
-	val := reflect.ValueOf(tvp.Value)
-	var firstRow interface{}
-	if val.Len() != 0 {
-		firstRow = val.Index(0).Interface()
-	} else {
-		firstRow = reflect.New(reflect.TypeOf(tvp.Value).Elem()).Elem().Interface()
-	}
-
-	tvpRow := reflect.TypeOf(firstRow)
+	tvpRow := tvp.rowType()
 	columnCount := tvpRow.NumField()
 	defaultValues := make([]fieldDetailStore, 0, columnCount)
 	tvpFieldIndexes := make([]int, 0, columnCount)
@@ -166,16 +250,29 @@ func (tvp TVP) columnTypes() ([]columnStruct, []int, error) {
 		}
 		tvpFieldIndexes = append(tvpFieldIndexes, i)
 		isIdentity := tvpTagValue == tvpIdentity
-		if field.Type.Kind() == reflect.Ptr {
-			v := reflect.New(field.Type.Elem())
+		fieldType := field.Type
+		if fieldType.Kind() == reflect.Ptr && !fieldType.Elem().Implements(valuerType) {
+			// driver types such as civil.Date are only accepted by value,
+			// nil pointers are sent as NULL of the type they point to
+			fieldType = fieldType.Elem()
+		}
+		if fieldType.Kind() == reflect.Ptr {
 			defaultValues = append(defaultValues, fieldDetailStore{
-				defaultValue: v.Interface(),
+				defaultValue: reflect.New(fieldType.Elem()).Interface(),
+				isIdentity:   isIdentity,
+			})
+			continue
+		}
+		if !fieldType.Implements(valuerType) && reflect.PtrTo(fieldType).Implements(valuerType) {
+			// Value has a pointer receiver
+			defaultValues = append(defaultValues, fieldDetailStore{
+				defaultValue: reflect.New(fieldType).Interface(),
 				isIdentity:   isIdentity,
 			})
 			continue
 		}
 		defaultValues = append(defaultValues, fieldDetailStore{
-			defaultValue: tvp.createZeroType(reflect.Zero(field.Type).Interface()),
+			defaultValue: tvp.createZeroType(reflect.Zero(fieldType).Interface()),
 			isIdentity:   isIdentity,
 		})
 	}
@@ -184,12 +281,7 @@ func (tvp TVP) columnTypes() ([]columnStruct, []int, error) {
 		return nil, nil, ErrorSkip
 	}
 
-	conn := new(Conn)
-	conn.sess = new(tdsSession)
-	conn.sess.loginAck = loginAckStruct{TDSVersion: verTDS73}
-	stmt := &Stmt{
-		c: conn,
-	}
+	stmt := newTVPStmt()
 
 	columnConfiguration := make([]columnStruct, 0, columnCount)
 	for index, val := range defaultValues {
@@ -201,6 +293,18 @@ func (tvp TVP) columnTypes() ([]columnStruct, []int, error) {
 		if err != nil {
 			return nil, nil, err
 		}
+		if param.ti.TypeId == typeNull {
+			// the zero value of the driver.Valuer is NULL, take the type
+			// from the first row with a value or send the column as
+			// nvarchar(max) when all of them are NULL
+			var rowVal interface{} = ""
+			if valuer := tvp.firstValuer(tvpFieldIndexes[index]); valuer != nil {
+				rowVal = valuer
+			}
+			if param, err = stmt.makeParam(rowVal); err != nil {
+				return nil, nil, err
+			}
+		}
 		column := columnStruct{
 			ti: param.ti,
 		}
@@ -217,6 +321,44 @@ func (tvp TVP) columnTypes() ([]columnStruct, []int, error) {
 	return columnConfiguration, tvpFieldIndexes, nil
 }
 
+// tvpValuer returns the driver.Valuer of a TVP row field, including the
+// fields whose Value method has a pointer receiver, or nil when the field is
+// not one or is a nil pointer.
+func tvpValuer(field reflect.Value) driver.Valuer {
+	if field.Kind() == reflect.Ptr && field.IsNil() {
+		return nil
+	}
+	if valuer, ok := field.Interface().(driver.Valuer); ok {
+		return valuer
+	}
+	if field.CanAddr() {
+		if valuer, ok := field.Addr().Interface().(driver.Valuer); ok {
+			return valuer
+		}
+	}
+	return nil
+}
+
+// firstValuer returns the driver.Valuer of the field at fieldIdx in the
+// first row where its Value is not NULL, or nil when there is none.
+func (tvp TVP) firstValuer(fieldIdx int) driver.Valuer {
+	if _, ok := tvp.Value.(TVPRows); ok {
+		// the rows are only read as they are sent
+		return nil
+	}
+	val := reflect.ValueOf(tvp.Value)
+	for i := 0; i < val.Len(); i++ {
+		valuer := tvpValuer(val.Index(i).Field(fieldIdx))
+		if valuer == nil {
+			continue
+		}
+		if v, err := valuer.Value(); err == nil && v != nil {
+			return valuer
+		}
+	}
+	return nil
+}
+
 func IsSkipField(tvpTagValue string, isTvpValue bool, jsonTagValue string, isJsonTagValue bool) bool {
 	if !isTvpValue && !isJsonTagValue {
 		return false
@@ -265,6 +407,9 @@ func (tvp TVP) createZeroType(fieldVal interface{}) interface{} {
 		defaultBool    = false
 		defaultFloat64 = float64(0)
 		defaultInt64   = int64(0)
+		defaultInt32   = int32(0)
+		defaultInt16   = int16(0)
+		defaultByte    = byte(0)
 		defaultString  = ""
 	)
 
@@ -275,14 +420,22 @@ func (tvp TVP) createZeroType(fieldVal interface{}) interface{} {
 		return defaultFloat64
 	case sql.NullInt64:
 		return defaultInt64
+	case sql.NullInt32:
+		return defaultInt32
+	case sql.NullInt16:
+		return defaultInt16
+	case sql.NullByte:
+		return defaultByte
 	case sql.NullString:
 		return defaultString
+	case sql.NullTime:
+		return time.Time{}
 	}
 	return fieldVal
 }
 
 // verify types https://golang.org/pkg/database/sql/
-func (tvp TVP) verifyStandardTypeOnNull(buf *bytes.Buffer, tvpVal interface{}) bool {
+func (tvp TVP) verifyStandardTypeOnNull(buf io.Writer, tvpVal interface{}) bool {
 	const (
 		defaultNull = uint8(0)
 	)
@@ -303,6 +456,26 @@ func (tvp TVP) verifyStandardTypeOnNull(buf *bytes.Buffer, tvpVal interface{}) b
 			binary.Write(buf, binary.LittleEndian, defaultNull)
 			return true
 		}
+	case sql.NullInt32:
+		if !val.Valid {
+			binary.Write(buf, binary.LittleEndian, defaultNull)
+			return true
+		}
+	case sql.NullInt16:
+		if !val.Valid {
+			binary.Write(buf, binary.LittleEndian, defaultNull)
+			return true
+		}
+	case sql.NullByte:
+		if !val.Valid {
+			binary.Write(buf, binary.LittleEndian, defaultNull)
+			return true
+		}
+	case sql.NullTime:
+		if !val.Valid {
+			binary.Write(buf, binary.LittleEndian, defaultNull)
+			return true
+		}
 	case sql.NullString:
 		if !val.Valid {
 			binary.Write(buf, binary.LittleEndian, uint64(_PLP_NULL))
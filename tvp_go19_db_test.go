@@ -6,6 +6,8 @@ package mssql
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"io"
 	"log"
 	"reflect"
 	"testing"
@@ -1474,3 +1476,78 @@ func TestTVPIdentity(t *testing.T) {
 		t.Fatal("TestTVPIdentity have to be same")
 	}
 }
+
+func TestTVPRows(t *testing.T) {
+	type TvpRowsExample struct {
+		ID      int64
+		Message string
+	}
+
+	const (
+		createTVP = `
+		CREATE TYPE tvpRowsExample AS TABLE
+		(
+			id bigint,
+			message nvarchar(100)
+		)`
+
+		dropTVP = `DROP TYPE tvpRowsExample;`
+
+		rowCount = 100000
+	)
+
+	checkConnStr(t)
+	tl := testLogger{t: t}
+	defer tl.StopLogging()
+	SetLogger(&tl)
+
+	conn, err := sql.Open("sqlserver", makeConnStr(t).String())
+	if err != nil {
+		log.Fatal("Open connection failed:", err.Error())
+	}
+	defer conn.Close()
+	conn.SetMaxOpenConns(1)
+
+	conn.Exec(dropTVP)
+	_, err = conn.Exec(createTVP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Exec(dropTVP)
+
+	rowsUntil := func(failAt int64) TVPRows {
+		var id int64
+		return TVPRows{
+			Row: TvpRowsExample{},
+			Next: func() (interface{}, error) {
+				if id == failAt {
+					return nil, errors.New("rows failed")
+				}
+				if id == rowCount {
+					return nil, io.EOF
+				}
+				id++
+				return TvpRowsExample{ID: id, Message: "row"}, nil
+			},
+		}
+	}
+
+	var count, sum int64
+	err = conn.QueryRow("select count(*), sum(id) from @p1",
+		TVP{TypeName: "tvpRowsExample", Value: rowsUntil(-1)}).Scan(&count, &sum)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != rowCount || sum != rowCount*(rowCount+1)/2 {
+		t.Errorf("got %d rows with a sum of %d", count, sum)
+	}
+
+	_, err = conn.Exec("select count(*) from @p1", TVP{TypeName: "tvpRowsExample", Value: rowsUntil(rowCount / 2)})
+	if err == nil || err.Error() != "rows failed" {
+		t.Fatalf("got %v, want the error of the rows", err)
+	}
+	// the connection is still usable after the aborted request
+	if err = conn.QueryRow("select 1").Scan(&count); err != nil {
+		t.Fatal(err)
+	}
+}
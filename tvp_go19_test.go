@@ -3,9 +3,18 @@
 package mssql
 
 import (
+	"bytes"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
+
+	"github.com/golang-sql/civil"
 )
 
 type TestFields struct {
@@ -213,6 +222,30 @@ func TestTVPType_check(t *testing.T) {
 			},
 			wantErr: false,
 		},
+		{
+			name: "Value is TVPRows",
+			fields: fields{
+				TVPName:  "Test",
+				TVPValue: TVPRows{Row: fields{}, Next: func() (interface{}, error) { return nil, io.EOF }},
+			},
+			wantErr: false,
+		},
+		{
+			name: "TVPRows without Next",
+			fields: fields{
+				TVPName:  "Test",
+				TVPValue: TVPRows{Row: fields{}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "TVPRows Row isn't struct",
+			fields: fields{
+				TVPName:  "Test",
+				TVPValue: TVPRows{Row: "", Next: func() (interface{}, error) { return nil, io.EOF }},
+			},
+			wantErr: true,
+		},
 		{
 			name: "Value is right",
 			fields: fields{
@@ -577,3 +610,189 @@ func TestTVP_encode(t *testing.T) {
 		})
 	}
 }
+
+type tvpTestID [4]byte
+
+func (id tvpTestID) Value() (driver.Value, error) {
+	return fmt.Sprintf("%x", id[:]), nil
+}
+
+type tvpTestNullID struct {
+	ID    tvpTestID
+	Valid bool
+}
+
+func (id tvpTestNullID) Value() (driver.Value, error) {
+	if !id.Valid {
+		return nil, nil
+	}
+	return id.ID.Value()
+}
+
+type tvpTestCount struct {
+	n int64
+}
+
+func (c *tvpTestCount) Value() (driver.Value, error) {
+	return c.n, nil
+}
+
+func TestTVP_valuerFields(t *testing.T) {
+	type row struct {
+		ID      tvpTestID
+		NullID  tvpTestNullID
+		Count   tvpTestCount
+		PtrID   *tvpTestID
+		NullInt sql.NullInt32
+	}
+	tvp := TVP{
+		TypeName: "tvptype",
+		Value: []row{
+			{},
+			{NullID: tvpTestNullID{ID: tvpTestID{1}, Valid: true}, Count: tvpTestCount{n: 2}, NullInt: sql.NullInt32{Int32: 3, Valid: true}},
+		},
+	}
+	columns, indexes, err := tvp.columnTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decls []string
+	for _, column := range columns {
+		decls = append(decls, makeDecl(column.ti))
+	}
+	want := []string{"nvarchar(max)", "nvarchar(max)", "bigint", "nvarchar(max)", "int"}
+	if !reflect.DeepEqual(decls, want) {
+		t.Errorf("column types %v, want %v", decls, want)
+	}
+	got, err := tvp.encode("", "tvptype", columns, indexes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the nil PtrID and the int NullInt of the last row, then the end token
+	wantEnd := []byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 4, 3, 0, 0, 0, _TVP_END_TOKEN}
+	if len(got) < len(wantEnd) || !reflect.DeepEqual(got[len(got)-len(wantEnd):], wantEnd) {
+		t.Errorf("unexpected encoding %v", got)
+	}
+}
+
+func TestTVP_nullFields(t *testing.T) {
+	type row struct {
+		Int32  sql.NullInt32
+		Int16  sql.NullInt16
+		Byte   sql.NullByte
+		Time   sql.NullTime
+		Date   *civil.Date
+		Int    *int64
+		String *string
+	}
+	date := civil.Date{Year: 2020, Month: 1, Day: 2}
+	n := int64(1)
+	tvp := TVP{
+		TypeName: "tvptype",
+		Value: []row{{
+			Int32: sql.NullInt32{Int32: 1, Valid: true},
+			Int16: sql.NullInt16{Int16: 1, Valid: true},
+			Byte:  sql.NullByte{Byte: 1, Valid: true},
+			Time:  sql.NullTime{Time: time.Now(), Valid: true},
+			Date:  &date,
+			Int:   &n,
+		}, {}},
+	}
+	columns, indexes, err := tvp.columnTypes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decls []string
+	for _, column := range columns {
+		decls = append(decls, makeDecl(column.ti))
+	}
+	want := []string{"int", "smallint", "tinyint", "datetimeoffset(7)", "date", "bigint", "nvarchar(max)"}
+	if !reflect.DeepEqual(decls, want) {
+		t.Errorf("column types %v, want %v", decls, want)
+	}
+	got, err := tvp.encode("", "tvptype", columns, indexes)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the last row has the NULL of each column type
+	wantEnd := []byte{_TVP_ROW_TOKEN, 0, 0, 0, 0, 0, 0, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, _TVP_END_TOKEN}
+	if len(got) < len(wantEnd) || !reflect.DeepEqual(got[len(got)-len(wantEnd):], wantEnd) {
+		t.Errorf("unexpected encoding %v", got)
+	}
+}
+
+func TestTVP_writeRows(t *testing.T) {
+	type row struct {
+		ID   int
+		Name string
+	}
+	var all []row
+	for i := 0; i < 100; i++ {
+		all = append(all, row{ID: i, Name: strings.Repeat("x", i)})
+	}
+	rowsFrom := func(next func(i int) (interface{}, error)) TVPRows {
+		i := 0
+		return TVPRows{Row: row{}, Next: func() (interface{}, error) {
+			i++
+			return next(i - 1)
+		}}
+	}
+
+	s := &Stmt{}
+	want, err := s.makeParam(TVP{TypeName: "tvptype", Value: all})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := s.makeParam(TVP{TypeName: "tvptype", Value: rowsFrom(func(i int) (interface{}, error) {
+		if i == len(all) {
+			return nil, io.EOF
+		}
+		return all[i], nil
+	})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport := &replyTransport{}
+	buf := newTdsBuffer(512, transport)
+	buf.BeginPacket(packRPCRequest, false)
+	if err = p.stream(buf); err != nil {
+		t.Fatal(err)
+	}
+	if err = buf.FinishPacket(); err != nil {
+		t.Fatal(err)
+	}
+	packets := transport.packets()
+	if len(packets) < 2 {
+		t.Errorf("the rows should be sent in several packets, got %d", len(packets))
+	}
+	got := p.buffer
+	for _, packet := range packets {
+		got = append(got, packet[8:]...)
+	}
+	if !bytes.Equal(got, want.buffer) {
+		t.Errorf("streamed rows differ from the rows of a slice\ngot  %v\nwant %v", got, want.buffer)
+	}
+
+	failed := errors.New("rows failed")
+	p, err = s.makeParam(TVP{TypeName: "tvptype", Value: rowsFrom(func(i int) (interface{}, error) {
+		if i == 50 {
+			return nil, failed
+		}
+		return all[i], nil
+	})})
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport = &replyTransport{}
+	buf = newTdsBuffer(512, transport)
+	buf.BeginPacket(packRPCRequest, false)
+	err = p.stream(buf)
+	var canceled sendCanceledError
+	if !errors.As(err, &canceled) || !errors.Is(err, failed) {
+		t.Fatalf("got %v, want a canceled send with the error of the rows", err)
+	}
+	packets = transport.packets()
+	if last := packets[len(packets)-1]; last[1] != statusEOM|statusIgnore {
+		t.Errorf("the request should end with the ignore status, got %#x", last[1])
+	}
+}
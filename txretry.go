@@ -0,0 +1,99 @@
+package mssql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// TxRetry is a policy for retrying the transactions of RunInTx.
+type TxRetry struct {
+	// MaxAttempts is the number of times the transaction is run before its
+	// last error is returned. Zero or less runs it once.
+	MaxAttempts int
+	// Backoff is the delay before the second attempt, doubled before each
+	// of the next ones up to MaxBackoff. The delays are jittered by up to
+	// half their length so that the transactions of a deadlock do not
+	// collide again.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultTxRetry is the policy of RunInTx.
+var DefaultTxRetry = TxRetry{
+	MaxAttempts: 5,
+	Backoff:     50 * time.Millisecond,
+	MaxBackoff:  2 * time.Second,
+}
+
+// RunInTx runs fn in a transaction begun with opts and commits it, with
+// DefaultTxRetry. See TxRetry.Run.
+func RunInTx(ctx context.Context, db *sql.DB, opts *sql.TxOptions, fn func(tx *sql.Tx) error) error {
+	return DefaultTxRetry.Run(ctx, db, opts, fn)
+}
+
+// Run runs fn in a transaction begun with opts and commits it. The
+// transaction is rolled back when fn returns an error, and the whole unit
+// is run again, on a connection that may be another one, when the error
+// of fn or of BeginTx is one IsRetryable accepts, such as a deadlock
+// (error 1205) or a transient connection error, or a broken connection,
+// up to r.MaxAttempts times. fn must therefore only have effects through
+// tx, or effects that can be repeated.
+//
+// An error of Commit is returned without retrying, since the transaction
+// may have committed before the connection failed; use WithRequestID and
+// RequestCommitted to find out. The error of the last attempt is returned,
+// or the error of ctx when it is done while waiting to retry.
+func (r TxRetry) Run(ctx context.Context, db *sql.DB, opts *sql.TxOptions, fn func(tx *sql.Tx) error) error {
+	for attempt := 1; ; attempt++ {
+		committing, err := runTx(ctx, db, opts, fn)
+		if err == nil || committing || attempt >= r.MaxAttempts || !retryTx(err) {
+			return err
+		}
+		t := time.NewTimer(r.delay(attempt))
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		case <-t.C:
+		}
+	}
+}
+
+// delay returns the jittered delay after the attempt-th attempt.
+func (r TxRetry) delay(attempt int) time.Duration {
+	d := r.Backoff
+	for i := 1; i < attempt && (r.MaxBackoff <= 0 || d < r.MaxBackoff); i++ {
+		d *= 2
+	}
+	if r.MaxBackoff > 0 && d > r.MaxBackoff {
+		d = r.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
+
+// runTx runs fn in a transaction, committing is true when the error is
+// that of Commit.
+func runTx(ctx context.Context, db *sql.DB, opts *sql.TxOptions, fn func(tx *sql.Tx) error) (committing bool, err error) {
+	tx, err := db.BeginTx(ctx, opts)
+	if err != nil {
+		return false, err
+	}
+	if err = fn(tx); err != nil {
+		_ = tx.Rollback()
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// retryTx reports whether a transaction that failed with err can be run
+// again.
+func retryTx(err error) bool {
+	return IsRetryable(err) || errors.Is(err, driver.ErrBadConn)
+}
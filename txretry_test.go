@@ -0,0 +1,90 @@
+package mssql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTxRetryDelay(t *testing.T) {
+	r := TxRetry{Backoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for _, tc := range []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{4, 800 * time.Millisecond},
+		{5, time.Second},
+		{50, time.Second},
+	} {
+		for i := 0; i < 20; i++ {
+			if d := r.delay(tc.attempt); d < tc.max/2 || d > tc.max {
+				t.Fatalf("delay after attempt %d is %v, want between %v and %v", tc.attempt, d, tc.max/2, tc.max)
+			}
+		}
+	}
+	if d := (TxRetry{}).delay(3); d != 0 {
+		t.Errorf("delay without backoff is %v", d)
+	}
+}
+
+func TestRunInTx(t *testing.T) {
+	conn, logger := open(t)
+	defer conn.Close()
+	defer logger.StopLogging()
+
+	ctx := context.Background()
+	if _, err := conn.ExecContext(ctx, "create table ##runintx (n int)"); err != nil {
+		t.Fatal(err)
+	}
+	defer conn.ExecContext(ctx, "drop table ##runintx")
+
+	r := TxRetry{MaxAttempts: 3, Backoff: time.Millisecond}
+	calls := 0
+	err := r.Run(ctx, conn, nil, func(tx *sql.Tx) error {
+		calls++
+		if _, err := tx.ExecContext(ctx, "insert into ##runintx values (@p1)", calls); err != nil {
+			return err
+		}
+		if calls < 3 {
+			return Error{Number: 1205, Message: "deadlock victim"}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if calls != 3 {
+		t.Errorf("fn was called %d times, want 3", calls)
+	}
+	var n, count int
+	if err = conn.QueryRowContext(ctx, "select max(n), count(*) from ##runintx").Scan(&n, &count); err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 || count != 1 {
+		t.Errorf("got rows up to %d, %d of them, want only the row of the last attempt", n, count)
+	}
+
+	calls = 0
+	failure := errors.New("not retryable")
+	err = r.Run(ctx, conn, nil, func(tx *sql.Tx) error {
+		calls++
+		return failure
+	})
+	if err != failure || calls != 1 {
+		t.Errorf("got %v after %d calls, want the error of the only call", err, calls)
+	}
+
+	calls = 0
+	err = r.Run(ctx, conn, nil, func(tx *sql.Tx) error {
+		calls++
+		return Error{Number: 1205, Message: "deadlock victim"}
+	})
+	if !IsDeadlock(err) || calls != 3 {
+		t.Errorf("got %v after %d calls, want a deadlock after 3 calls", err, calls)
+	}
+}
@@ -64,6 +64,8 @@ const (
 	typeXml        = 0xf1
 	typeUdt        = 0xf0
 	typeTvp        = 0xf3
+	typeJson       = 0xf4
+	typeVector     = 0xf5
 
 	// long length types
 	typeText    = 0x23
@@ -218,11 +220,20 @@ func writeVarLen(w io.Writer, ti *typeInfo, out bool) (err error) {
 			return
 		}
 		ti.Writer = writeByteLenType
+	case typeUdt:
+		// UDT_INFO_IN_RPC, the value follows in chunks
+		for _, name := range []string{ti.UdtInfo.DBName, ti.UdtInfo.SchemaName, ti.UdtInfo.TypeName} {
+			if err = writeBVarChar(w, name); err != nil {
+				return
+			}
+		}
+		ti.Writer = writePLPType
 	case typeBigVarBin, typeBigVarChar, typeBigBinary, typeBigChar,
-		typeNVarChar, typeNChar, typeXml, typeUdt:
+		typeNVarChar, typeNChar, typeXml:
 
-		// short len types
-		if ti.Size > 8000 || ti.Size == 0 || out {
+		// short len types, output parameters of the types with a max
+		// form are sent as PLP to receive values of any length
+		if ti.Size > 8000 || ti.Size == 0 || out && (isVarLenType(ti.TypeId) || ti.TypeId == typeXml) {
 			if err = binary.Write(w, binary.LittleEndian, uint16(0xffff)); err != nil {
 				return
 			}
@@ -243,7 +254,22 @@ func writeVarLen(w io.Writer, ti *typeInfo, out bool) (err error) {
 				return
 			}
 		}
-	case typeText, typeImage, typeNText, typeVariant:
+	case typeVector:
+		// USHORTLEN_TYPE followed by the element type
+		if err = binary.Write(w, binary.LittleEndian, uint16(ti.Size)); err != nil {
+			return
+		}
+		if err = binary.Write(w, binary.LittleEndian, ti.Scale); err != nil {
+			return
+		}
+		ti.Writer = writeShortLenType
+	case typeVariant:
+		// LONGLEN_TYPE without collation
+		if err = binary.Write(w, binary.LittleEndian, uint32(ti.Size)); err != nil {
+			return
+		}
+		ti.Writer = writeVariantType
+	case typeText, typeImage, typeNText:
 		// LONGLEN_TYPE
 		if err = binary.Write(w, binary.LittleEndian, uint32(ti.Size)); err != nil {
 			return
@@ -290,7 +316,8 @@ func encodeDateTime(t time.Time) (res []byte) {
 	basedays := gregorianDays(1900, 1)
 	// days since Jan 1st 1900 (same TZ as t)
 	days := gregorianDays(t.Year(), t.YearDay()) - basedays
-	tm := 300*(t.Second()+t.Minute()*60+t.Hour()*60*60) + t.Nanosecond()*300/1e9
+	// the nanoseconds are scaled in 64 bits, which int is not on 32-bit platforms
+	tm := 300*(t.Second()+t.Minute()*60+t.Hour()*60*60) + int(int64(t.Nanosecond())*300/1e9)
 	// minimum and maximum possible
 	mindays := gregorianDays(1753, 1) - basedays
 	maxdays := gregorianDays(9999, 365) - basedays
@@ -465,6 +492,21 @@ func readShortLenType(ti *typeInfo, r *tdsBuffer, c *cryptoMetadata) interface{}
 	if size == 0xffff {
 		return nil
 	}
+	if r.arena != nil && c == nil {
+		switch ti.TypeId {
+		case typeBigVarBin, typeBigBinary:
+			buf := r.arena.alloc(int(size))
+			r.ReadFull(buf)
+			return buf
+		case typeBigVarChar, typeBigChar:
+			buf := r.arena.alloc(int(size))
+			r.ReadFull(buf)
+			if ti.Collation.IsUTF8() || isASCII(buf) {
+				return buf
+			}
+			return []byte(cp.CharsetToUTF8(ti.Collation, buf))
+		}
+	}
 	r.ReadFull(ti.Buffer[:size])
 	buf := ti.Buffer[:size]
 	switch ti.TypeId {
@@ -481,6 +523,12 @@ func readShortLenType(ti *typeInfo, r *tdsBuffer, c *cryptoMetadata) interface{}
 		return decodeNChar(buf)
 	case typeUdt:
 		return decodeUdt(*ti, buf)
+	case typeVector:
+		var v Vector
+		if err := v.decode(buf); err != nil {
+			badStreamPanic(err)
+		}
+		return v
 	default:
 		badStreamPanicf("Invalid typeid")
 	}
@@ -585,87 +633,88 @@ func readVariantType(ti *typeInfo, r *tdsBuffer, c *cryptoMetadata) interface{}
 	}
 	vartype := r.byte()
 	propbytes := int32(r.byte())
+	v := Variant{TypeName: variantTypeNames[vartype]}
 	switch vartype {
 	case typeGuid:
 		buf := make([]byte, size-2-propbytes)
 		r.ReadFull(buf)
-		return buf
+		v.Value = buf
 	case typeBit:
-		return r.byte() != 0
+		v.Value = r.byte() != 0
 	case typeInt1:
-		return int64(r.byte())
+		v.Value = int64(r.byte())
 	case typeInt2:
-		return int64(int16(r.uint16()))
+		v.Value = int64(int16(r.uint16()))
 	case typeInt4:
-		return int64(r.int32())
+		v.Value = int64(r.int32())
 	case typeInt8:
-		return int64(r.uint64())
+		v.Value = int64(r.uint64())
 	case typeDateTime:
 		buf := make([]byte, size-2-propbytes)
 		r.ReadFull(buf)
-		return decodeDateTime(buf)
+		v.Value = decodeDateTime(buf)
 	case typeDateTim4:
 		buf := make([]byte, size-2-propbytes)
 		r.ReadFull(buf)
-		return decodeDateTim4(buf)
+		v.Value = decodeDateTim4(buf)
 	case typeFlt4:
-		return float64(math.Float32frombits(r.uint32()))
+		v.Value = float64(math.Float32frombits(r.uint32()))
 	case typeFlt8:
-		return math.Float64frombits(r.uint64())
+		v.Value = math.Float64frombits(r.uint64())
 	case typeMoney4:
 		buf := make([]byte, size-2-propbytes)
 		r.ReadFull(buf)
-		return decodeMoney4(buf)
+		v.Value = decodeMoney4(buf)
 	case typeMoney:
 		buf := make([]byte, size-2-propbytes)
 		r.ReadFull(buf)
-		return decodeMoney(buf)
+		v.Value = decodeMoney(buf)
 	case typeDateN:
 		buf := make([]byte, size-2-propbytes)
 		r.ReadFull(buf)
-		return decodeDate(buf)
+		v.Value = decodeDate(buf)
 	case typeTimeN:
-		scale := r.byte()
+		v.Scale = r.byte()
 		buf := make([]byte, size-2-propbytes)
 		r.ReadFull(buf)
-		return decodeTime(scale, buf)
+		v.Value = decodeTime(v.Scale, buf)
 	case typeDateTime2N:
-		scale := r.byte()
+		v.Scale = r.byte()
 		buf := make([]byte, size-2-propbytes)
 		r.ReadFull(buf)
-		return decodeDateTime2(scale, buf)
+		v.Value = decodeDateTime2(v.Scale, buf)
 	case typeDateTimeOffsetN:
-		scale := r.byte()
+		v.Scale = r.byte()
 		buf := make([]byte, size-2-propbytes)
 		r.ReadFull(buf)
-		return decodeDateTimeOffset(scale, buf)
+		v.Value = decodeDateTimeOffset(v.Scale, buf)
 	case typeBigVarBin, typeBigBinary:
-		r.uint16() // max length, ignoring
+		v.MaxLength = int(r.uint16())
 		buf := make([]byte, size-2-propbytes)
 		r.ReadFull(buf)
-		return buf
+		v.Value = buf
 	case typeDecimalN, typeNumericN:
-		prec := r.byte()
-		scale := r.byte()
+		v.Precision = r.byte()
+		v.Scale = r.byte()
 		buf := make([]byte, size-2-propbytes)
 		r.ReadFull(buf)
-		return decodeDecimal(prec, scale, buf)
+		v.Value = decodeDecimal(v.Precision, v.Scale, buf)
 	case typeBigVarChar, typeBigChar:
 		col := readCollation(r)
-		r.uint16() // max length, ignoring
+		v.MaxLength = int(r.uint16())
 		buf := make([]byte, size-2-propbytes)
 		r.ReadFull(buf)
-		return decodeChar(col, buf)
+		v.Value = decodeChar(col, buf)
 	case typeNVarChar, typeNChar:
 		_ = readCollation(r)
-		r.uint16() // max length, ignoring
+		v.MaxLength = int(r.uint16())
 		buf := make([]byte, size-2-propbytes)
 		r.ReadFull(buf)
-		return decodeNChar(buf)
+		v.Value = decodeNChar(buf)
 	default:
 		badStreamPanicf("Invalid variant typeid")
 	}
-	panic("shoulnd't get here")
+	return v
 }
 
 // partially length prefixed stream
@@ -675,11 +724,23 @@ func readPLPType(ti *typeInfo, r *tdsBuffer, c *cryptoMetadata) interface{} {
 	if c == nil {
 		size := r.uint64()
 		var buf *bytes.Buffer
-		switch size {
-		case _PLP_NULL:
+		switch {
+		case size == _PLP_NULL:
 			// null
 			return nil
-		case _UNKNOWN_PLP_LEN:
+		case !r.noPLPPool && plpDecodesToString(ti.TypeId):
+			// the bytes are only needed until they are decoded
+			buf = plpPool.Get().(*bytes.Buffer)
+			buf.Reset()
+			defer func() {
+				if buf.Cap() <= maxPooledPLP {
+					plpPool.Put(buf)
+				}
+			}()
+			if size != _UNKNOWN_PLP_LEN {
+				buf.Grow(int(size))
+			}
+		case size == _UNKNOWN_PLP_LEN:
 			// size unknown
 			buf = bytes.NewBuffer(make([]byte, 0, 1000))
 		default:
@@ -709,10 +770,22 @@ func readPLPType(ti *typeInfo, r *tdsBuffer, c *cryptoMetadata) interface{} {
 		return decodeNChar(bytesToDecode)
 	case typeUdt:
 		return decodeUdt(*ti, bytesToDecode)
+	case typeJson:
+		return string(bytesToDecode)
 	}
 	panic("shouldn't get here")
 }
 
+// plpDecodesToString reports whether PLP values of type typeId are
+// returned as strings, so their raw bytes are not kept.
+func plpDecodesToString(typeId uint8) bool {
+	switch typeId {
+	case typeXml, typeJson, typeBigVarChar, typeBigChar, typeText, typeNVarChar, typeNChar, typeNText:
+		return true
+	}
+	return false
+}
+
 func writePLPType(w io.Writer, ti typeInfo, buf []byte) (err error) {
 	if buf == nil {
 		err = binary.Write(w, binary.LittleEndian, uint64(_PLP_NULL))
@@ -787,6 +860,10 @@ func readVarLen(ti *typeInfo, r *tdsBuffer, c *cryptoMetadata) {
 			ti.XmlInfo.XmlSchemaCollection = r.UsVarChar()
 		}
 		ti.Reader = readPLPType
+	case typeJson:
+		// sent as PLP UTF-8 text, without a length or collation
+		ti.Size = 0xffff
+		ti.Reader = readPLPType
 	case typeUdt:
 		ti.Size = int(r.uint16())
 		ti.UdtInfo.DBName = r.BVarChar()
@@ -810,6 +887,12 @@ func readVarLen(ti *typeInfo, r *tdsBuffer, c *cryptoMetadata) {
 			ti.Buffer = make([]byte, ti.Size)
 			ti.Reader = readShortLenType
 		}
+	case typeVector:
+		// the element type is kept in Scale
+		ti.Size = int(r.uint16())
+		ti.Scale = r.byte()
+		ti.Buffer = make([]byte, ti.Size)
+		ti.Reader = readShortLenType
 	case typeText, typeImage, typeNText, typeVariant:
 		// LONGLEN_TYPE
 		ti.Size = int(r.int32())
@@ -1127,6 +1210,8 @@ func makeGoLangScanType(ti typeInfo) reflect.Type {
 		return reflect.TypeOf([]byte{})
 	case typeXml:
 		return reflect.TypeOf("")
+	case typeJson:
+		return reflect.TypeOf("")
 	case typeText:
 		return reflect.TypeOf("")
 	case typeNText:
@@ -1137,6 +1222,8 @@ func makeGoLangScanType(ti typeInfo) reflect.Type {
 		return reflect.TypeOf([]byte{})
 	case typeVariant:
 		return reflect.TypeOf(nil)
+	case typeVector:
+		return reflect.TypeOf(Vector{})
 	default:
 		panic(fmt.Sprintf("not implemented makeGoLangScanType for type %d", ti.TypeId))
 	}
@@ -1251,9 +1338,23 @@ func makeDecl(ti typeInfo) string {
 	case typeNText:
 		return "ntext"
 	case typeUdt:
-		return ti.UdtInfo.TypeName
+		if ti.UdtInfo.SchemaName != "" {
+			return TSQLQuoter{}.ID(ti.UdtInfo.SchemaName) + "." + TSQLQuoter{}.ID(ti.UdtInfo.TypeName)
+		}
+		return TSQLQuoter{}.ID(ti.UdtInfo.TypeName)
 	case typeGuid:
 		return "uniqueidentifier"
+	case typeVariant:
+		return "sql_variant"
+	case typeXml:
+		return "xml"
+	case typeJson:
+		return "json"
+	case typeVector:
+		if VectorElementType(ti.Scale) == VectorFloat16 {
+			return fmt.Sprintf("vector(%d, float16)", vectorDimensions(ti))
+		}
+		return fmt.Sprintf("vector(%d)", vectorDimensions(ti))
 	case typeTvp:
 		if ti.UdtInfo.SchemaName != "" {
 			return fmt.Sprintf("%s.%s READONLY", ti.UdtInfo.SchemaName, ti.UdtInfo.TypeName)
@@ -1356,6 +1457,8 @@ func makeGoLangTypeName(ti typeInfo) string {
 		return "UNIQUEIDENTIFIER"
 	case typeXml:
 		return "XML"
+	case typeJson:
+		return "JSON"
 	case typeText:
 		return "TEXT"
 	case typeNText:
@@ -1366,6 +1469,8 @@ func makeGoLangTypeName(ti typeInfo) string {
 		return "SQL_VARIANT"
 	case typeBigBinary:
 		return "BINARY"
+	case typeVector:
+		return "VECTOR"
 	default:
 		panic(fmt.Sprintf("not implemented makeGoLangTypeName for type %d", ti.TypeId))
 	}
@@ -1480,6 +1585,8 @@ func makeGoLangTypeLength(ti typeInfo) (int64, bool) {
 		return 0, false
 	case typeXml:
 		return 1073741822, true
+	case typeJson:
+		return 2147483647, true
 	case typeText:
 		return 2147483647, true
 	case typeNText:
@@ -1490,6 +1597,9 @@ func makeGoLangTypeLength(ti typeInfo) (int64, bool) {
 		return 0, false
 	case typeBigBinary:
 		return int64(ti.Size), true
+	case typeVector:
+		// the number of dimensions
+		return int64(vectorDimensions(ti)), true
 	default:
 		panic(fmt.Sprintf("not implemented makeGoLangTypeLength for type %d", ti.TypeId))
 	}
@@ -1592,6 +1702,8 @@ func makeGoLangTypePrecisionScale(ti typeInfo) (int64, int64, bool) {
 		return 0, 0, false
 	case typeXml:
 		return 0, 0, false
+	case typeJson:
+		return 0, 0, false
 	case typeText:
 		return 0, 0, false
 	case typeNText:
@@ -1602,6 +1714,8 @@ func makeGoLangTypePrecisionScale(ti typeInfo) (int64, int64, bool) {
 		return 0, 0, false
 	case typeBigBinary:
 		return 0, 0, false
+	case typeVector:
+		return 0, 0, false
 	default:
 		panic(fmt.Sprintf("not implemented makeGoLangTypePrecisionScale for type %d", ti.TypeId))
 	}
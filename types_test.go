@@ -1,7 +1,11 @@
 package mssql
 
 import (
+	"bytes"
+	"database/sql"
+	"encoding/binary"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 )
@@ -151,3 +155,101 @@ func handlePanic(t *testing.T) {
 		t.Errorf("recovered panic")
 	}
 }
+
+// plpValue returns data in the PLP format, split in chunks of chunk bytes.
+func plpValue(data []byte, chunk int) []byte {
+	b := make([]byte, 8, 8+len(data)+4*(len(data)/chunk+2))
+	binary.LittleEndian.PutUint64(b, uint64(len(data)))
+	var length [4]byte
+	for len(data) > 0 {
+		n := chunk
+		if n > len(data) {
+			n = len(data)
+		}
+		binary.LittleEndian.PutUint32(length[:], uint32(n))
+		b = append(append(b, length[:]...), data[:n]...)
+		data = data[n:]
+	}
+	return append(b, 0, 0, 0, 0)
+}
+
+func TestReadPLPTypePooled(t *testing.T) {
+	long := strings.Repeat("déjà vu ", 1000)
+	for _, noPool := range []bool{false, true} {
+		for _, want := range []string{"abc", long, "xyz"} {
+			data := plpValue(str2ucs2(want), 300)
+			r := &tdsBuffer{rbuf: data, rsize: len(data), packetSize: len(data), noPLPPool: noPool}
+			ti := typeInfo{TypeId: typeNVarChar}
+			if got := readPLPType(&ti, r, nil); got != want {
+				t.Errorf("noPLPPool=%v: got %d characters, want %d", noPool, len(got.(string)), len(want))
+			}
+		}
+	}
+	// binary values are returned to the caller and must not share a buffer
+	data := plpValue([]byte{1, 2, 3}, 2)
+	r := &tdsBuffer{rbuf: data, rsize: len(data), packetSize: len(data)}
+	first := readPLPType(&typeInfo{TypeId: typeBigVarBin}, r, nil).([]byte)
+	data = plpValue([]byte{4, 5, 6}, 2)
+	r = &tdsBuffer{rbuf: data, rsize: len(data), packetSize: len(data)}
+	readPLPType(&typeInfo{TypeId: typeBigVarBin}, r, nil)
+	if !bytes.Equal(first, []byte{1, 2, 3}) {
+		t.Errorf("binary value was overwritten: %v", first)
+	}
+}
+
+func TestReadJSONType(t *testing.T) {
+	const want = `{"name":"déjà vu"}`
+	data := plpValue([]byte(want), 7)
+	r := &tdsBuffer{rbuf: data, rsize: len(data), packetSize: len(data)}
+	ti := readTypeInfo(r, typeJson, nil)
+	if got := ti.Reader(&ti, r, nil); got != want {
+		t.Errorf("got %v, want %s", got, want)
+	}
+	if name := makeGoLangTypeName(ti); name != "JSON" {
+		t.Errorf("got type name %s, want JSON", name)
+	}
+}
+
+func BenchmarkReadPLPNVarChar(b *testing.B) {
+	data := plpValue(str2ucs2(strings.Repeat("abcdefgh", 1000)), 4000)
+	ti := typeInfo{TypeId: typeNVarChar}
+	r := &tdsBuffer{rbuf: data, rsize: len(data), packetSize: len(data)}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		r.rpos = 0
+		readPLPType(&ti, r, nil)
+	}
+}
+
+func TestWriteVarLenOutputMax(t *testing.T) {
+	s := &Stmt{}
+	for _, dest := range []interface{}{"abc", []byte{1, 2, 3}} {
+		p, err := s.makeParam(sql.Out{Dest: dest})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.ti.Size != 0 {
+			t.Errorf("output parameter %T should be declared as max, got size %d", dest, p.ti.Size)
+		}
+		if decl := makeDecl(p.ti); !strings.HasSuffix(decl, "(max)") {
+			t.Errorf("unexpected declaration %s", decl)
+		}
+		var buf bytes.Buffer
+		if err = writeVarLen(&buf, &p.ti, true); err != nil {
+			t.Fatal(err)
+		}
+		if binary.LittleEndian.Uint16(buf.Bytes()) != 0xffff {
+			t.Errorf("output parameter %T should be sent as PLP, got %v", dest, buf.Bytes())
+		}
+	}
+
+	// fixed length types have no max form and keep their length
+	ti := typeInfo{TypeId: typeBigBinary, Size: 16}
+	var buf bytes.Buffer
+	if err := writeVarLen(&buf, &ti, true); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), []byte{16, 0}) {
+		t.Errorf("unexpected type info bytes %v", buf.Bytes())
+	}
+}
@@ -0,0 +1,45 @@
+package mssql
+
+import (
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// decodeUTF16 decodes little-endian UTF-16 into a string in a single
+// allocation. Unpaired surrogates are replaced by U+FFFD. len(s) must be
+// even.
+func decodeUTF16(s []byte) string {
+	n := 0
+	for i := 0; i < len(s); i += 2 {
+		r, size := nextUTF16(s[i:])
+		n += utf8.RuneLen(r)
+		i += size - 2
+	}
+	var b strings.Builder
+	b.Grow(n)
+	for i := 0; i < len(s); i += 2 {
+		r, size := nextUTF16(s[i:])
+		if r < utf8.RuneSelf {
+			b.WriteByte(byte(r))
+		} else {
+			b.WriteRune(r)
+		}
+		i += size - 2
+	}
+	return b.String()
+}
+
+// nextUTF16 returns the first rune of s and the number of bytes it takes.
+func nextUTF16(s []byte) (rune, int) {
+	u := rune(s[0]) | rune(s[1])<<8
+	if !utf16.IsSurrogate(u) {
+		return u, 2
+	}
+	if len(s) >= 4 {
+		if r := utf16.DecodeRune(u, rune(s[2])|rune(s[3])<<8); r != utf8.RuneError {
+			return r, 4
+		}
+	}
+	return utf8.RuneError, 2
+}
@@ -4,18 +4,24 @@
 package mssql
 
 import (
-	"encoding/binary"
 	"fmt"
-	"unicode/utf16"
+	"strings"
 )
 
 func ucs22str(s []byte) (string, error) {
 	if len(s)%2 != 0 {
 		return "", fmt.Errorf("illegal UCS2 string length: %d", len(s))
 	}
-	buf := make([]uint16, len(s)/2)
+	// ASCII text only needs its even bytes copied
 	for i := 0; i < len(s); i += 2 {
-		buf[i/2] = binary.LittleEndian.Uint16(s[i:])
+		if s[i] >= 0x80 || s[i+1] != 0 {
+			return decodeUTF16(s), nil
+		}
 	}
-	return string(utf16.Decode(buf)), nil
+	var b strings.Builder
+	b.Grow(len(s) / 2)
+	for i := 0; i < len(s); i += 2 {
+		b.WriteByte(s[i])
+	}
+	return b.String(), nil
 }
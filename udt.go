@@ -0,0 +1,96 @@
+package mssql
+
+import (
+	"database/sql/driver"
+	"fmt"
+)
+
+// UDTType describes a CLR user-defined type, such as a type of a custom
+// assembly or one of the built-in geometry, geography and hierarchyid
+// types.
+type UDTType struct {
+	// DatabaseName is the database the type is defined in. It is empty
+	// for parameters of a type of the current database.
+	DatabaseName string
+	// SchemaName is the schema of the type, such as dbo or sys.
+	SchemaName string
+	// TypeName is the name of the type.
+	TypeName string
+	// AssemblyQualifiedName is the name of the CLR type implementing the
+	// type, with its assembly, as reported in column metadata. It is not
+	// sent with parameters.
+	AssemblyQualifiedName string
+}
+
+// UDTValue is a value of a CLR user-defined type, in the serialized form
+// of the type. The driver cannot decode the values of types it does not
+// know, which are returned as []byte; UDTValue carries their bytes along
+// with their type so they can be sent back unchanged.
+//
+// As a parameter, a UDTValue is declared with its type, qualified by its
+// schema, both quoted as identifiers, and a nil Bytes sends NULL. Scanning a column into a UDTValue
+// only sets Bytes; the type of the column is given by
+// RowsColumnTypeUDT.
+type UDTValue struct {
+	UDTType
+	Bytes []byte
+}
+
+// Scan sets the bytes of v.
+func (v *UDTValue) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case []byte:
+		v.Bytes = append([]byte(nil), s...)
+	case nil:
+		v.Bytes = nil
+	default:
+		return fmt.Errorf("mssql: cannot convert %T to UDTValue", src)
+	}
+	return nil
+}
+
+// Value returns the bytes of v. The driver sends a UDTValue with its type
+// rather than calling Value.
+func (v UDTValue) Value() (driver.Value, error) {
+	if v.Bytes == nil {
+		return nil, nil
+	}
+	return v.Bytes, nil
+}
+
+// RowsColumnTypeUDT is implemented by the rows of the driver.
+// ColumnTypeUDT returns the type of a column of a CLR user-defined type,
+// ok is false for other columns. The values of these columns are returned
+// as []byte. The driver rows can be reached with sql.Conn.Raw.
+type RowsColumnTypeUDT interface {
+	driver.Rows
+	ColumnTypeUDT(index int) (udt UDTType, ok bool)
+}
+
+func columnUDT(ti typeInfo) (UDTType, bool) {
+	if ti.TypeId != typeUdt {
+		return UDTType{}, false
+	}
+	return UDTType{
+		DatabaseName:          ti.UdtInfo.DBName,
+		SchemaName:            ti.UdtInfo.SchemaName,
+		TypeName:              ti.UdtInfo.TypeName,
+		AssemblyQualifiedName: ti.UdtInfo.AssemblyQualifiedName,
+	}, true
+}
+
+func makeUDTParam(v UDTValue) (res param, err error) {
+	if v.TypeName == "" {
+		return res, fmt.Errorf("mssql: UDTValue has no type name")
+	}
+	res.ti.TypeId = typeUdt
+	res.ti.UdtInfo = udtInfo{
+		DBName:     v.DatabaseName,
+		SchemaName: v.SchemaName,
+		TypeName:   v.TypeName,
+	}
+	// UDT parameters are sent in chunks, as max types.
+	res.ti.Size = 0
+	res.buffer = v.Bytes
+	return res, nil
+}
@@ -0,0 +1,75 @@
+package mssql
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestUDTParam(t *testing.T) {
+	v := UDTValue{UDTType: UDTType{SchemaName: "dbo", TypeName: "Point"}, Bytes: []byte{1, 2, 3}}
+	p, err := (&Stmt{}).makeParam(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decl := makeDecl(p.ti); decl != "[dbo].[Point]" {
+		t.Errorf("got declaration %s, want [dbo].[Point]", decl)
+	}
+	var buf bytes.Buffer
+	if err = writeTypeInfo(&buf, &p.ti, false); err != nil {
+		t.Fatal(err)
+	}
+	if err = p.ti.Writer(&buf, p.ti, p.buffer); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{typeUdt, 0, 3, 'd', 0, 'b', 0, 'o', 0, 5, 'P', 0, 'o', 0, 'i', 0, 'n', 0, 't', 0,
+		0xfe, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 3, 0, 0, 0, 1, 2, 3, 0, 0, 0, 0}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("got %x, want %x", buf.Bytes(), want)
+	}
+
+	p, err = (&Stmt{}).makeParam(UDTValue{UDTType: UDTType{TypeName: "Point"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.buffer != nil || makeDecl(p.ti) != "[Point]" {
+		t.Errorf("got %s %x for a NULL value", makeDecl(p.ti), p.buffer)
+	}
+	p, err = (&Stmt{}).makeParam(UDTValue{UDTType: UDTType{SchemaName: "geo data", TypeName: "Point]"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decl := makeDecl(p.ti); decl != "[geo data].[Point]]]" {
+		t.Errorf("got declaration %s, want [geo data].[Point]]]", decl)
+	}
+	if _, err = (&Stmt{}).makeParam(UDTValue{Bytes: []byte{1}}); err == nil {
+		t.Error("a value without a type name was accepted")
+	}
+}
+
+func TestColumnTypeUDT(t *testing.T) {
+	udt := columnStruct{ti: typeInfo{TypeId: typeUdt, UdtInfo: udtInfo{
+		DBName: "db", SchemaName: "dbo", TypeName: "Point", AssemblyQualifiedName: "Geo.Point, Geo",
+	}}}
+	rows := &Rows{cols: []columnStruct{udt, {ti: typeInfo{TypeId: typeIntN}}}}
+	var r RowsColumnTypeUDT = rows
+	got, ok := r.ColumnTypeUDT(0)
+	if want := (UDTType{"db", "dbo", "Point", "Geo.Point, Geo"}); !ok || got != want {
+		t.Errorf("got %+v, %t, want %+v", got, ok, want)
+	}
+	if _, ok = r.ColumnTypeUDT(1); ok {
+		t.Error("an int column was described as a UDT")
+	}
+
+	var v UDTValue
+	b := []byte{1, 2}
+	if err := v.Scan(b); err != nil || !bytes.Equal(v.Bytes, b) {
+		t.Errorf("got %x, %v", v.Bytes, err)
+	}
+	b[0] = 9
+	if v.Bytes[0] != 1 {
+		t.Error("Scan kept the buffer of the row")
+	}
+	if err := v.Scan(nil); err != nil || v.Bytes != nil {
+		t.Errorf("got %x, %v scanning NULL", v.Bytes, err)
+	}
+}
@@ -0,0 +1,211 @@
+package mssql
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// UpsertAction is what Upsert did with a row.
+type UpsertAction int
+
+const (
+	// UpsertUnchanged is the action of a row matching a row of the table
+	// when there are no columns to update.
+	UpsertUnchanged UpsertAction = iota
+	// UpsertInserted is the action of a row inserted into the table.
+	UpsertInserted
+	// UpsertUpdated is the action of a row that updated the row of the
+	// table with the same key.
+	UpsertUpdated
+)
+
+func (a UpsertAction) String() string {
+	switch a {
+	case UpsertUnchanged:
+		return "Unchanged"
+	case UpsertInserted:
+		return "Inserted"
+	case UpsertUpdated:
+		return "Updated"
+	}
+	return fmt.Sprintf("UpsertAction(%d)", int(a))
+}
+
+// UpsertOptions are the columns used by Upsert. Column names are those of
+// the fields of the rows, as described in CreateTempTableFor.
+type UpsertOptions struct {
+	// KeyColumns are the columns matching the rows to the rows of the
+	// table. At least one is needed.
+	KeyColumns []string
+	// UpdateColumns are the columns set on the rows of the table that
+	// match a row. All the columns but the keys when nil; an empty slice
+	// leaves the rows of the table that match as they are.
+	UpdateColumns []string
+	// InsertColumns are the columns set on the rows inserted. All the
+	// columns when nil.
+	InsertColumns []string
+}
+
+// upsertRowColumn is the column of the staging table holding the index of
+// each row.
+const upsertRowColumn = "mssql$row"
+
+// Upsert inserts rows, a slice of structs or of pointers to structs, into
+// table, or updates the rows of table with the same key, and returns what
+// it did with each row. The rows are bulk copied into a temporary table on
+// conn, which a MERGE statement then applies to table in one statement,
+// under a HOLDLOCK hint so concurrent upserts of the same keys do not fail.
+// The character columns of the temporary table have the collation of the
+// current database, and table may have triggers.
+//
+// The fields of the rows map to the columns of table as described in
+// CreateTempTableFor. table is used as is in the statement, so it must be
+// quoted when needed, as in "[sales].[order lines]". The keys must be
+// unique among the rows.
+func Upsert(ctx context.Context, conn *sql.Conn, table string, rows interface{}, opts UpsertOptions) ([]UpsertAction, error) {
+	v := reflect.ValueOf(rows)
+	if v.Kind() != reflect.Slice {
+		return nil, fmt.Errorf("mssql: cannot upsert %T, it needs a slice", rows)
+	}
+	fields, err := structColumns(v.Type().Elem())
+	if err != nil {
+		return nil, err
+	}
+	suffix := make([]byte, 8)
+	if _, err = rand.Read(suffix); err != nil {
+		return nil, err
+	}
+	stagingName := "#upsert_" + hex.EncodeToString(suffix)
+	stmt, err := upsertStatement(table, TSQLQuoter{}.ID(stagingName), fields, opts)
+	if err != nil {
+		return nil, err
+	}
+	if v.Len() == 0 {
+		return nil, nil
+	}
+
+	columns := make([]TempColumn, 0, len(fields)+1)
+	for _, f := range fields {
+		columns = append(columns, f.column)
+	}
+	columns = append(columns, TempColumn{Name: upsertRowColumn, Type: "int"})
+	staging, err := createTempTable(ctx, conn, stagingName, columns)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.ExecContext(context.Background(), "drop table "+staging.Name())
+
+	values := make([][]interface{}, v.Len())
+	for i := range values {
+		values[i] = append(structValues(v.Index(i), fields), int64(i))
+	}
+	if _, err = staging.Load(ctx, values); err != nil {
+		return nil, err
+	}
+
+	res, err := conn.QueryContext(ctx, stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Close()
+	actions := make([]UpsertAction, v.Len())
+	for res.Next() {
+		var action string
+		var i int
+		if err = res.Scan(&action, &i); err != nil {
+			return nil, err
+		}
+		if i < 0 || i >= len(actions) {
+			return nil, fmt.Errorf("mssql: upsert returned row %d of %d", i, len(actions))
+		}
+		switch action {
+		case "INSERT":
+			actions[i] = UpsertInserted
+		case "UPDATE":
+			actions[i] = UpsertUpdated
+		}
+	}
+	if err = res.Err(); err != nil {
+		return nil, err
+	}
+	return actions, nil
+}
+
+// upsertStatement returns the MERGE statement of Upsert, which reads the
+// rows from the staging table. The actions are output into a table
+// variable and selected from it, since an OUTPUT clause without INTO fails
+// on tables with triggers.
+func upsertStatement(table, staging string, fields []structColumn, opts UpsertOptions) (string, error) {
+	if table == "" {
+		return "", errors.New("mssql: upsert needs a table")
+	}
+	if len(opts.KeyColumns) == 0 {
+		return "", errors.New("mssql: upsert needs key columns")
+	}
+	all := make([]string, len(fields))
+	for i, f := range fields {
+		all[i] = f.column.Name
+	}
+	has := func(cols []string, name string) bool {
+		for _, c := range cols {
+			if strings.EqualFold(c, name) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, list := range [][]string{opts.KeyColumns, opts.UpdateColumns, opts.InsertColumns} {
+		for _, c := range list {
+			if !has(all, c) {
+				return "", fmt.Errorf("mssql: upsert column %s is not a field of the rows", c)
+			}
+		}
+	}
+	update := opts.UpdateColumns
+	if update == nil {
+		for _, c := range all {
+			if !has(opts.KeyColumns, c) {
+				update = append(update, c)
+			}
+		}
+	}
+	insert := opts.InsertColumns
+	if insert == nil {
+		insert = all
+	}
+	if len(insert) == 0 {
+		return "", errors.New("mssql: upsert needs columns to insert")
+	}
+
+	id := TSQLQuoter{}.ID
+	on := make([]string, len(opts.KeyColumns))
+	for i, c := range opts.KeyColumns {
+		on[i] = "t." + id(c) + " = s." + id(c)
+	}
+	var b strings.Builder
+	b.WriteString("declare @actions table ([action] nvarchar(10), [row] int);\n")
+	fmt.Fprintf(&b, "merge into %s with (holdlock) as t\nusing %s as s\non %s", table, staging, strings.Join(on, " and "))
+	if len(update) > 0 {
+		set := make([]string, len(update))
+		for i, c := range update {
+			set[i] = "t." + id(c) + " = s." + id(c)
+		}
+		b.WriteString("\nwhen matched then update set " + strings.Join(set, ", "))
+	}
+	cols := make([]string, len(insert))
+	vals := make([]string, len(insert))
+	for i, c := range insert {
+		cols[i] = id(c)
+		vals[i] = "s." + id(c)
+	}
+	fmt.Fprintf(&b, "\nwhen not matched by target then insert (%s) values (%s)", strings.Join(cols, ", "), strings.Join(vals, ", "))
+	b.WriteString("\noutput $action, s." + id(upsertRowColumn) + " into @actions;")
+	b.WriteString("\nselect [action], [row] from @actions;")
+	return b.String(), nil
+}
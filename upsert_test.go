@@ -0,0 +1,109 @@
+package mssql
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+type upsertRow struct {
+	ID    int32  `mssql:"id"`
+	Name  string `mssql:"name,nvarchar(50)"`
+	Stock int32  `mssql:"stock"`
+}
+
+func TestUpsertStatement(t *testing.T) {
+	fields, err := structColumns(reflect.TypeOf(upsertRow{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stmt, err := upsertStatement("dbo.items", "[#s]", fields, UpsertOptions{KeyColumns: []string{"id"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "declare @actions table ([action] nvarchar(10), [row] int);\n" +
+		"merge into dbo.items with (holdlock) as t\n" +
+		"using [#s] as s\n" +
+		"on t.[id] = s.[id]\n" +
+		"when matched then update set t.[name] = s.[name], t.[stock] = s.[stock]\n" +
+		"when not matched by target then insert ([id], [name], [stock]) values (s.[id], s.[name], s.[stock])\n" +
+		"output $action, s.[mssql$row] into @actions;\n" +
+		"select [action], [row] from @actions;"
+	if stmt != want {
+		t.Errorf("got\n%s\nwant\n%s", stmt, want)
+	}
+
+	stmt, err = upsertStatement("dbo.items", "[#s]", fields, UpsertOptions{
+		KeyColumns:    []string{"id"},
+		UpdateColumns: []string{},
+		InsertColumns: []string{"id", "name"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = "declare @actions table ([action] nvarchar(10), [row] int);\n" +
+		"merge into dbo.items with (holdlock) as t\n" +
+		"using [#s] as s\n" +
+		"on t.[id] = s.[id]\n" +
+		"when not matched by target then insert ([id], [name]) values (s.[id], s.[name])\n" +
+		"output $action, s.[mssql$row] into @actions;\n" +
+		"select [action], [row] from @actions;"
+	if stmt != want {
+		t.Errorf("got\n%s\nwant\n%s", stmt, want)
+	}
+
+	for _, opts := range []UpsertOptions{
+		{},
+		{KeyColumns: []string{"missing"}},
+		{KeyColumns: []string{"id"}, UpdateColumns: []string{"missing"}},
+		{KeyColumns: []string{"id"}, InsertColumns: []string{}},
+	} {
+		if _, err = upsertStatement("dbo.items", "[#s]", fields, opts); err == nil {
+			t.Errorf("%+v should fail", opts)
+		}
+	}
+}
+
+func TestUpsert(t *testing.T) {
+	pool, logger := open(t)
+	defer pool.Close()
+	defer logger.StopLogging()
+
+	ctx := context.Background()
+	conn, err := pool.Conn(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, err = conn.ExecContext(ctx, "create table #items (id int primary key, name nvarchar(50) not null, stock int not null)"+
+		"; insert into #items values (1, 'one', 10)")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	actions, err := Upsert(ctx, conn, "#items", []upsertRow{{1, "uno", 11}, {2, "two", 20}}, UpsertOptions{KeyColumns: []string{"id"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []UpsertAction{UpsertUpdated, UpsertInserted}; !reflect.DeepEqual(actions, want) {
+		t.Errorf("got actions %v, want %v", actions, want)
+	}
+
+	actions, err = Upsert(ctx, conn, "#items", []*upsertRow{{2, "deux", 0}, {3, "three", 30}},
+		UpsertOptions{KeyColumns: []string{"id"}, UpdateColumns: []string{}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []UpsertAction{UpsertUnchanged, UpsertInserted}; !reflect.DeepEqual(actions, want) {
+		t.Errorf("got actions %v, want %v", actions, want)
+	}
+
+	var names string
+	err = conn.QueryRowContext(ctx, "select string_agg(name, ',') within group (order by id) from #items").Scan(&names)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if names != "uno,two,three" {
+		t.Errorf("got names %s", names)
+	}
+}
@@ -0,0 +1,73 @@
+package mssql
+
+import (
+	"database/sql/driver"
+
+	"github.com/google/uuid"
+)
+
+// convertUUIDParameter makes uuid.UUID and uuid.NullUUID parameters
+// uniqueidentifier parameters. Both UniqueIdentifier and uuid.UUID hold the
+// bytes in the order they are written, so they convert directly. Only the
+// wire format is mixed-endian.
+func convertUUIDParameter(val interface{}) (interface{}, bool) {
+	switch v := val.(type) {
+	case uuid.UUID:
+		return UniqueIdentifier(v), true
+	case *uuid.UUID:
+		if v == nil {
+			return nil, true
+		}
+		return UniqueIdentifier(*v), true
+	case uuid.NullUUID:
+		return NullUniqueIdentifier{UUID: UniqueIdentifier(v.UUID), Valid: v.Valid}, true
+	}
+	return nil, false
+}
+
+// scanUUID stores a uniqueidentifier value read from the server in a
+// uuid.UUID or uuid.NullUUID destination. Their own Scan methods take the
+// 16 bytes as they are, which would leave the first three groups reversed.
+func scanUUID(dest, src interface{}) (bool, error) {
+	b, ok := src.([]byte)
+	if !ok || len(b) != 16 {
+		return false, nil
+	}
+	switch d := dest.(type) {
+	case *uuid.UUID:
+		var u UniqueIdentifier
+		if err := u.Scan(b); err != nil {
+			return true, err
+		}
+		*d = uuid.UUID(u)
+		return true, nil
+	case *uuid.NullUUID:
+		var u UniqueIdentifier
+		if err := u.Scan(b); err != nil {
+			return true, err
+		}
+		*d = uuid.NullUUID{UUID: uuid.UUID(u), Valid: true}
+		return true, nil
+	}
+	return false, nil
+}
+
+// convertGUIDs replaces the uniqueidentifier values of a row by their string
+// form when the guid conversion connection parameter is set, so that they
+// scan into uuid.UUID, UniqueIdentifier and string destinations alike.
+func convertGUIDs(cols []columnStruct, dest []driver.Value) {
+	for i, v := range dest {
+		b, ok := v.([]byte)
+		if !ok || len(b) != 16 || cols[i].originalTypeInfo().TypeId != typeGuid {
+			continue
+		}
+		var u UniqueIdentifier
+		if u.Scan(b) == nil {
+			dest[i] = u.String()
+		}
+	}
+}
+
+func (c *Conn) guidConversion() bool {
+	return c.connector != nil && c.connector.params.Encoding.GUIDConversion
+}
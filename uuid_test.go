@@ -0,0 +1,136 @@
+package mssql
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+var (
+	testUUID = uuid.MustParse("dd8fb695-3ab1-4f61-b3b8-e5db7d3f4fe5")
+	// testUUIDWire is testUUID in the byte order of the TDS protocol.
+	testUUIDWire = []byte{0x95, 0xb6, 0x8f, 0xdd, 0xb1, 0x3a, 0x61, 0x4f, 0xb3, 0xb8, 0xe5, 0xdb, 0x7d, 0x3f, 0x4f, 0xe5}
+)
+
+func TestConvertUUIDParameter(t *testing.T) {
+	tests := []struct {
+		val  interface{}
+		want interface{}
+	}{
+		{testUUID, UniqueIdentifier(testUUID)},
+		{&testUUID, UniqueIdentifier(testUUID)},
+		{(*uuid.UUID)(nil), nil},
+		{uuid.NullUUID{UUID: testUUID, Valid: true}, NullUniqueIdentifier{UUID: UniqueIdentifier(testUUID), Valid: true}},
+		{uuid.NullUUID{}, NullUniqueIdentifier{}},
+	}
+	for _, tst := range tests {
+		conv, err := convertInputParameter(tst.val)
+		if err != nil {
+			t.Errorf("convertInputParameter(%v) failed: %v", tst.val, err)
+			continue
+		}
+		if conv != tst.want {
+			t.Errorf("convertInputParameter(%v): got %v, want %v", tst.val, conv, tst.want)
+		}
+	}
+
+	s := &Stmt{}
+	conv, _ := convertInputParameter(testUUID)
+	p, err := s.makeParam(conv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ti.TypeId != typeGuid || !bytes.Equal(p.buffer, testUUIDWire) {
+		t.Errorf("unexpected parameter %+v %x", p.ti, p.buffer)
+	}
+}
+
+func TestScanIntoOutUUID(t *testing.T) {
+	var u uuid.UUID
+	if err := scanIntoOut("u", testUUIDWire, &u); err != nil {
+		t.Fatal(err)
+	}
+	if u != testUUID {
+		t.Errorf("got %s, want %s", u, testUUID)
+	}
+	var nu uuid.NullUUID
+	if err := scanIntoOut("nu", testUUIDWire, &nu); err != nil {
+		t.Fatal(err)
+	}
+	if !nu.Valid || nu.UUID != testUUID {
+		t.Errorf("got %+v, want %s", nu, testUUID)
+	}
+	if err := scanIntoOut("nu", nil, &nu); err != nil {
+		t.Fatal(err)
+	}
+	if nu.Valid {
+		t.Error("NULL should scan into an invalid NullUUID")
+	}
+}
+
+func TestConvertGUIDs(t *testing.T) {
+	cols := []columnStruct{
+		{ti: typeInfo{TypeId: typeGuid, Size: 16}},
+		{ti: typeInfo{TypeId: typeBigVarBin, Size: 16}},
+		{ti: typeInfo{TypeId: typeGuid, Size: 16}},
+	}
+	binary := append([]byte(nil), testUUIDWire...)
+	row := []driver.Value{append([]byte(nil), testUUIDWire...), binary, nil}
+	convertGUIDs(cols, row)
+	if row[0] != "DD8FB695-3AB1-4F61-B3B8-E5DB7D3F4FE5" {
+		t.Errorf("unexpected uniqueidentifier value %v", row[0])
+	}
+	if !bytes.Equal(row[1].([]byte), testUUIDWire) {
+		t.Errorf("binary value should not be converted, got %v", row[1])
+	}
+	if row[2] != nil {
+		t.Errorf("NULL value should stay nil, got %v", row[2])
+	}
+}
+
+func TestUUIDRoundTrip(t *testing.T) {
+	checkConnStr(t)
+	connStr := makeConnStr(t)
+	q := connStr.Query()
+	q.Set("guid conversion", "true")
+	connStr.RawQuery = q.Encode()
+	conn, err := sql.Open("sqlserver", connStr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var typ string
+	var u uuid.UUID
+	var ui UniqueIdentifier
+	var nu uuid.NullUUID
+	err = conn.QueryRowContext(context.Background(),
+		"select convert(sysname, sql_variant_property(convert(sql_variant, @p1), 'BaseType')), @p1, @p1, @p2",
+		testUUID, uuid.NullUUID{}).Scan(&typ, &u, &ui, &nu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if typ != "uniqueidentifier" {
+		t.Errorf("parameter sent as %s", typ)
+	}
+	if u != testUUID || uuid.UUID(ui) != testUUID {
+		t.Errorf("got %s and %s, want %s", u, ui, testUUID)
+	}
+	if nu.Valid {
+		t.Error("NULL should scan into an invalid NullUUID")
+	}
+
+	var out uuid.UUID
+	_, err = conn.ExecContext(context.Background(), "set @out = @in",
+		sql.Named("in", testUUID), sql.Named("out", sql.Out{Dest: &out}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != testUUID {
+		t.Errorf("output parameter got %s, want %s", out, testUUID)
+	}
+}
@@ -0,0 +1,225 @@
+package mssql
+
+import (
+	"bytes"
+	"database/sql/driver"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"reflect"
+)
+
+// maxVariantSize is the largest size of a sql_variant value, including
+// its base type and properties.
+const maxVariantSize = 8009
+
+// Variant is a sql_variant value together with its base type.
+//
+// sql_variant columns scan into a Variant when the typedvariants connection
+// parameter is set, and sql_variant output parameters always do. Otherwise
+// sql_variant columns return only Value.
+//
+// As a parameter, a Variant is sent as sql_variant holding Value. The base
+// type is chosen from the Go type of Value like for any other parameter, so
+// use the driver types such as VarChar, DateTime1 or Decimal to pick it.
+// TypeName, Precision, Scale and MaxLength are ignored for parameters.
+type Variant struct {
+	// Value is the value as it is returned for a column of the base type.
+	// It is nil for NULL.
+	Value interface{}
+	// TypeName is the base type, as returned by
+	// SQL_VARIANT_PROPERTY(v, 'BaseType'), such as "int" or "nvarchar".
+	TypeName string
+	// Precision and Scale are set for decimal and numeric values. Scale is
+	// also set for time, datetime2 and datetimeoffset values.
+	Precision uint8
+	Scale     uint8
+	// MaxLength is the maximum length in bytes of binary and character values.
+	MaxLength int
+}
+
+var variantTypeNames = map[uint8]string{
+	typeGuid:            "uniqueidentifier",
+	typeBit:             "bit",
+	typeInt1:            "tinyint",
+	typeInt2:            "smallint",
+	typeInt4:            "int",
+	typeInt8:            "bigint",
+	typeDateTime:        "datetime",
+	typeDateTim4:        "smalldatetime",
+	typeFlt4:            "real",
+	typeFlt8:            "float",
+	typeMoney4:          "smallmoney",
+	typeMoney:           "money",
+	typeDateN:           "date",
+	typeTimeN:           "time",
+	typeDateTime2N:      "datetime2",
+	typeDateTimeOffsetN: "datetimeoffset",
+	typeBigVarBin:       "varbinary",
+	typeBigBinary:       "binary",
+	typeDecimalN:        "decimal",
+	typeNumericN:        "numeric",
+	typeBigVarChar:      "varchar",
+	typeBigChar:         "char",
+	typeNVarChar:        "nvarchar",
+	typeNChar:           "nchar",
+}
+
+// variantType is the scan type of sql_variant columns when the
+// typedvariants connection parameter is set.
+var variantType = reflect.TypeOf(Variant{})
+
+// Scan implements the sql.Scanner interface. Values other than a Variant
+// only set Value.
+func (v *Variant) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case Variant:
+		*v = s
+	case *Variant:
+		*v = *s
+	default:
+		*v = Variant{Value: src}
+	}
+	return nil
+}
+
+// String formats the value of v.
+func (v Variant) String() string {
+	return fmt.Sprint(v.Value)
+}
+
+// unwrapVariants replaces the Variant values of a row by the values they hold.
+func unwrapVariants(dest []driver.Value) {
+	for i, val := range dest {
+		if v, ok := val.(Variant); ok {
+			dest[i] = v.Value
+		}
+	}
+}
+
+func (c *Conn) typedVariants() bool {
+	return c.connector != nil && c.connector.params.Encoding.TypedVariants
+}
+
+// makeVariantParam encodes v as a sql_variant parameter.
+func (s *Stmt) makeVariantParam(v Variant) (res param, err error) {
+	res.ti.TypeId = typeVariant
+	res.ti.Size = maxVariantSize
+	res.buffer = []byte{}
+	if v.Value == nil {
+		return res, nil
+	}
+	if _, ok := v.Value.(Variant); ok {
+		return res, fmt.Errorf("mssql: a Variant cannot hold a Variant")
+	}
+	val, err := convertInputParameter(v.Value)
+	if err != nil {
+		return res, err
+	}
+	if val == nil {
+		return res, nil
+	}
+	base, err := s.makeParam(val)
+	if err != nil {
+		return res, err
+	}
+	if base.buffer == nil || len(base.buffer) == 0 && !variantHasLength(base.ti.TypeId) {
+		// a null value of a Null type, such as sql.NullInt64
+		return res, nil
+	}
+	res.buffer, err = encodeVariant(base)
+	return res, err
+}
+
+// encodeVariant encodes the value of a parameter as sql_variant data:
+// the base type, the length of the properties, the properties and the value.
+func encodeVariant(p param) ([]byte, error) {
+	if len(p.buffer) > 8000 {
+		return nil, fmt.Errorf("mssql: %s value of %d bytes is too long for sql_variant", makeDecl(p.ti), len(p.buffer))
+	}
+	var props bytes.Buffer
+	base := variantBaseType(p.ti)
+	switch base {
+	case typeTimeN, typeDateTime2N, typeDateTimeOffsetN:
+		props.WriteByte(p.ti.Scale)
+	case typeDecimalN, typeNumericN:
+		props.WriteByte(p.ti.Prec)
+		props.WriteByte(p.ti.Scale)
+	case typeBigVarBin, typeBigBinary:
+		writeVariantMaxLength(&props, len(p.buffer))
+	case typeBigVarChar, typeBigChar, typeNVarChar, typeNChar:
+		if err := writeCollation(&props, p.ti.Collation); err != nil {
+			return nil, err
+		}
+		writeVariantMaxLength(&props, len(p.buffer))
+	}
+	if _, ok := variantTypeNames[base]; !ok {
+		return nil, fmt.Errorf("mssql: %s values cannot be sent as sql_variant", makeDecl(p.ti))
+	}
+	buf := make([]byte, 0, 2+props.Len()+len(p.buffer))
+	buf = append(buf, base, byte(props.Len()))
+	buf = append(buf, props.Bytes()...)
+	return append(buf, p.buffer...), nil
+}
+
+// variantBaseType returns the type sql_variant uses for values of type ti.
+// Values of nullable fixed length types are stored with the fixed length type.
+func variantBaseType(ti typeInfo) uint8 {
+	switch ti.TypeId {
+	case typeIntN:
+		switch ti.Size {
+		case 1:
+			return typeInt1
+		case 2:
+			return typeInt2
+		case 4:
+			return typeInt4
+		case 8:
+			return typeInt8
+		}
+	case typeBitN:
+		return typeBit
+	case typeFltN:
+		if ti.Size == 4 {
+			return typeFlt4
+		}
+		return typeFlt8
+	case typeMoneyN:
+		if ti.Size == 4 {
+			return typeMoney4
+		}
+		return typeMoney
+	case typeDateTimeN:
+		if ti.Size == 4 {
+			return typeDateTim4
+		}
+		return typeDateTime
+	}
+	return ti.TypeId
+}
+
+// variantHasLength reports whether empty values of type typeId are not null.
+func variantHasLength(typeId uint8) bool {
+	switch typeId {
+	case typeBigVarBin, typeBigBinary, typeBigVarChar, typeBigChar, typeNVarChar, typeNChar:
+		return true
+	}
+	return false
+}
+
+func writeVariantMaxLength(w *bytes.Buffer, n int) {
+	if n == 0 {
+		// zero length types do not exist, and two bytes fit one character of any type
+		n = 2
+	}
+	binary.Write(w, binary.LittleEndian, uint16(n))
+}
+
+// writeVariantType writes sql_variant data with its length.
+func writeVariantType(w io.Writer, ti typeInfo, buf []byte) (err error) {
+	if err = binary.Write(w, binary.LittleEndian, uint32(len(buf))); err != nil {
+		return
+	}
+	_, err = w.Write(buf)
+	return
+}
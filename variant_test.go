@@ -0,0 +1,140 @@
+package mssql
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/binary"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang-sql/civil"
+)
+
+func TestVariantParamRoundTrip(t *testing.T) {
+	s := &Stmt{c: &Conn{sess: &tdsSession{loginAck: loginAckStruct{TDSVersion: verTDS74}}}}
+	tests := []struct {
+		val  interface{}
+		want Variant
+	}{
+		{int32(-20), Variant{Value: int64(-20), TypeName: "int"}},
+		{int64(1) << 40, Variant{Value: int64(1) << 40, TypeName: "bigint"}},
+		{byte(10), Variant{Value: int64(10), TypeName: "tinyint"}},
+		{true, Variant{Value: true, TypeName: "bit"}},
+		{float64(0.125), Variant{Value: float64(0.125), TypeName: "float"}},
+		{float32(0.5), Variant{Value: float64(0.5), TypeName: "real"}},
+		{"abc", Variant{Value: "abc", TypeName: "nvarchar", MaxLength: 6}},
+		{"", Variant{Value: "", TypeName: "nvarchar", MaxLength: 2}},
+		{VarChar("abc"), Variant{Value: "abc", TypeName: "varchar", MaxLength: 3}},
+		{[]byte{0x12, 0x34}, Variant{Value: []byte{0x12, 0x34}, TypeName: "varbinary", MaxLength: 2}},
+		{Decimal{Coefficient: big.NewInt(-5), Scale: 1}, Variant{Value: []byte("-0.5"), TypeName: "decimal", Precision: 1, Scale: 1}},
+		{Money{Decimal{Coefficient: big.NewInt(12345), Scale: 4}}, Variant{Value: []byte("1.2345"), TypeName: "money"}},
+		{civil.Date{Year: 2000, Month: 1, Day: 2}, Variant{Value: time.Date(2000, 1, 2, 0, 0, 0, 0, time.UTC), TypeName: "date"}},
+		{DateTime1(time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)), Variant{Value: time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC), TypeName: "datetime"}},
+		{civil.DateTime{Date: civil.Date{Year: 2000, Month: 1, Day: 2}, Time: civil.Time{Hour: 3}}, Variant{Value: time.Date(2000, 1, 2, 3, 0, 0, 0, time.UTC), TypeName: "datetime2", Scale: 7}},
+		{UniqueIdentifier{1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16}, Variant{Value: []byte{4, 3, 2, 1, 6, 5, 8, 7, 9, 10, 11, 12, 13, 14, 15, 16}, TypeName: "uniqueidentifier"}},
+		{nil, Variant{}},
+		{sql.NullInt64{}, Variant{}},
+	}
+	for _, tst := range tests {
+		p, err := s.makeParam(Variant{Value: tst.val})
+		if err != nil {
+			t.Errorf("makeParam(%v) failed: %v", tst.val, err)
+			continue
+		}
+		if p.ti.TypeId != typeVariant || makeDecl(p.ti) != "sql_variant" {
+			t.Errorf("makeParam(%v) returned type %#x", tst.val, p.ti.TypeId)
+		}
+		var buf bytes.Buffer
+		if err := writeVariantType(&buf, p.ti, p.buffer); err != nil {
+			t.Fatal(err)
+		}
+		b := buf.Bytes()
+		r := &tdsBuffer{packetSize: len(b), rbuf: b, rpos: 0, rsize: len(b)}
+		got := readVariantType(&typeInfo{TypeId: typeVariant}, r, nil)
+		if tst.want.Value == nil {
+			if got != nil {
+				t.Errorf("Variant of %v: got %#v, want NULL", tst.val, got)
+			}
+			continue
+		}
+		if !reflect.DeepEqual(got, tst.want) {
+			t.Errorf("Variant of %v: got %#v, want %#v", tst.val, got, tst.want)
+		}
+	}
+
+	if _, err := s.makeParam(Variant{Value: Variant{Value: 1}}); err == nil {
+		t.Error("nested Variant should fail")
+	}
+	if _, err := s.makeParam(Variant{Value: make([]byte, 8001)}); err == nil {
+		t.Error("values above 8000 bytes should fail")
+	}
+}
+
+func TestWriteVariantTypeInfo(t *testing.T) {
+	var buf bytes.Buffer
+	ti := typeInfo{TypeId: typeVariant, Size: maxVariantSize}
+	if err := writeVarLen(&buf, &ti, false); err != nil {
+		t.Fatal(err)
+	}
+	if binary.LittleEndian.Uint32(buf.Bytes()) != maxVariantSize || buf.Len() != 4 {
+		t.Errorf("unexpected type info %v", buf.Bytes())
+	}
+}
+
+func TestUnwrapVariants(t *testing.T) {
+	row := []driver.Value{Variant{Value: int64(1), TypeName: "int"}, "x", nil}
+	unwrapVariants(row)
+	if !reflect.DeepEqual(row, []driver.Value{int64(1), "x", nil}) {
+		t.Errorf("got %v", row)
+	}
+
+	var v Variant
+	if err := scanIntoOut("v", Variant{Value: "abc", TypeName: "varchar", MaxLength: 3}, &v); err != nil {
+		t.Fatal(err)
+	}
+	if v.TypeName != "varchar" || v.Value != "abc" {
+		t.Errorf("got %#v", v)
+	}
+	var str string
+	if err := scanIntoOut("s", Variant{Value: "abc", TypeName: "varchar"}, &str); err != nil {
+		t.Fatal(err)
+	}
+	if str != "abc" {
+		t.Errorf("got %q", str)
+	}
+}
+
+func TestTypedVariants(t *testing.T) {
+	checkConnStr(t)
+	connStr := makeConnStr(t)
+	q := connStr.Query()
+	q.Set("typedvariants", "true")
+	connStr.RawQuery = q.Encode()
+	conn, err := sql.Open("sqlserver", connStr.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	var col, param, null Variant
+	err = conn.QueryRowContext(context.Background(),
+		"select cast(cast(-0.5 as decimal(18,1)) as sql_variant), @p1, cast(NULL as sql_variant)",
+		Variant{Value: VarChar("abc")}).Scan(&col, &param, &null)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Variant{Value: []byte("-0.5"), TypeName: "decimal", Precision: 18, Scale: 1}
+	if !reflect.DeepEqual(col, want) {
+		t.Errorf("got %#v, want %#v", col, want)
+	}
+	if param.TypeName != "varchar" || param.Value != "abc" {
+		t.Errorf("parameter came back as %#v", param)
+	}
+	if null.Value != nil {
+		t.Errorf("NULL came back as %#v", null)
+	}
+}
@@ -0,0 +1,304 @@
+package mssql
+
+import (
+	"database/sql/driver"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// VectorElementType is the type of the elements of a vector column.
+type VectorElementType uint8
+
+const (
+	// VectorFloat32 vectors hold single precision floating point numbers.
+	VectorFloat32 VectorElementType = 0
+	// VectorFloat16 vectors hold half precision floating point numbers.
+	VectorFloat16 VectorElementType = 1
+)
+
+// String returns the name of the element type used in vector declarations.
+func (t VectorElementType) String() string {
+	switch t {
+	case VectorFloat32:
+		return "float32"
+	case VectorFloat16:
+		return "float16"
+	default:
+		return fmt.Sprintf("VectorElementType(%d)", uint8(t))
+	}
+}
+
+func (t VectorElementType) size() int {
+	if t == VectorFloat16 {
+		return 2
+	}
+	return 4
+}
+
+// Version of the vector support feature extension requested at login.
+// Version 1 covers float32 vectors, version 2 adds float16 vectors.
+const vectorSupportVersion = 2
+
+// Header of the binary vector format.
+const (
+	vectorLayoutFormat  = 0xa9
+	vectorLayoutVersion = 0x01
+	vectorHeaderSize    = 8
+)
+
+// Vector is a value of the vector type. When the vectorsupport connection
+// parameter is set and the server acknowledged native vector support at
+// login, Vector parameters are sent in the binary vector format and vector
+// columns are returned as Vector values. Otherwise parameters are sent as
+// JSON arrays in nvarchar, which SQL Server converts to the vector type of
+// the column they are assigned to, and vector columns are returned as JSON
+// strings that scan into Vector as well.
+type Vector struct {
+	Data []float32
+	// ElementType is the type of the elements on the wire. Values of
+	// float16 vectors are rounded to half precision when sent.
+	ElementType VectorElementType
+}
+
+// NullVector represents a Vector that may be null.
+// NullVector implements the Scanner interface so
+// it can be used as a scan destination, similar to sql.NullString.
+type NullVector struct {
+	Vector Vector
+	Valid  bool // Valid is true if Vector is not NULL
+}
+
+// String returns the vector as a JSON array.
+func (v Vector) String() string {
+	var b strings.Builder
+	b.WriteByte('[')
+	for i, f := range v.Data {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatFloat(float64(f), 'g', -1, 32))
+	}
+	b.WriteByte(']')
+	return b.String()
+}
+
+// Scan implements the sql.Scanner interface. It accepts the binary vector
+// format and JSON arrays of numbers.
+func (v *Vector) Scan(src interface{}) error {
+	switch s := src.(type) {
+	case Vector:
+		v.Data = append([]float32(nil), s.Data...)
+		v.ElementType = s.ElementType
+		return nil
+	case []byte:
+		if len(s) > 0 && s[0] == vectorLayoutFormat {
+			return v.decode(s)
+		}
+		return v.parseJSON(s)
+	case string:
+		return v.parseJSON([]byte(s))
+	default:
+		return fmt.Errorf("mssql: cannot scan %T into Vector", src)
+	}
+}
+
+func (v *Vector) parseJSON(b []byte) error {
+	var data []float32
+	if err := json.Unmarshal(b, &data); err != nil {
+		return fmt.Errorf("mssql: invalid vector: %v", err)
+	}
+	if data == nil {
+		return errors.New("mssql: invalid vector: null")
+	}
+	v.Data = data
+	return nil
+}
+
+// decode reads the binary vector format.
+func (v *Vector) decode(b []byte) error {
+	if len(b) < vectorHeaderSize || b[0] != vectorLayoutFormat || b[1] != vectorLayoutVersion {
+		return errors.New("mssql: invalid binary vector header")
+	}
+	n := int(binary.LittleEndian.Uint16(b[2:]))
+	t := VectorElementType(b[4])
+	if t != VectorFloat32 && t != VectorFloat16 {
+		return fmt.Errorf("mssql: unsupported vector element type %d", b[4])
+	}
+	b = b[vectorHeaderSize:]
+	if len(b) != n*t.size() {
+		return fmt.Errorf("mssql: binary vector of %d elements has %d bytes of data", n, len(b))
+	}
+	data := make([]float32, n)
+	for i := range data {
+		if t == VectorFloat16 {
+			data[i] = float16ToFloat32(binary.LittleEndian.Uint16(b[2*i:]))
+		} else {
+			data[i] = math.Float32frombits(binary.LittleEndian.Uint32(b[4*i:]))
+		}
+	}
+	v.Data, v.ElementType = data, t
+	return nil
+}
+
+// encode writes v in the binary vector format.
+func (v Vector) encode() []byte {
+	size := v.ElementType.size()
+	b := make([]byte, vectorHeaderSize+len(v.Data)*size)
+	b[0] = vectorLayoutFormat
+	b[1] = vectorLayoutVersion
+	binary.LittleEndian.PutUint16(b[2:], uint16(len(v.Data)))
+	b[4] = byte(v.ElementType)
+	for i, f := range v.Data {
+		if v.ElementType == VectorFloat16 {
+			binary.LittleEndian.PutUint16(b[vectorHeaderSize+2*i:], float32ToFloat16(f))
+		} else {
+			binary.LittleEndian.PutUint32(b[vectorHeaderSize+4*i:], math.Float32bits(f))
+		}
+	}
+	return b
+}
+
+// Scan implements the sql.Scanner interface.
+func (n *NullVector) Scan(src interface{}) error {
+	if src == nil {
+		n.Vector, n.Valid = Vector{}, false
+		return nil
+	}
+	n.Valid = true
+	return n.Vector.Scan(src)
+}
+
+// Value implements the driver.Valuer interface.
+func (n NullVector) Value() (driver.Value, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	return n.Vector.String(), nil
+}
+
+// RowsColumnTypeVectorElementType is implemented by the rows of the driver.
+// ColumnTypeVectorElementType returns the element type of a vector column,
+// ok is false for other columns. Vector columns are only described as
+// vectors when the vectorsupport connection parameter is set and the server
+// acknowledged it, their DatabaseTypeName is then "VECTOR" and their Length
+// is the number of dimensions. The driver rows can be reached with
+// sql.Conn.Raw.
+type RowsColumnTypeVectorElementType interface {
+	driver.Rows
+	ColumnTypeVectorElementType(index int) (elementType VectorElementType, ok bool)
+}
+
+func vectorElementType(ti typeInfo) (VectorElementType, bool) {
+	if ti.TypeId != typeVector {
+		return 0, false
+	}
+	return VectorElementType(ti.Scale), true
+}
+
+// vectorDimensions returns the number of elements of a vector column
+// from its type info.
+func vectorDimensions(ti typeInfo) int {
+	return (ti.Size - vectorHeaderSize) / VectorElementType(ti.Scale).size()
+}
+
+// makeVectorParam encodes v in the binary vector format when the session
+// supports it for the element type of v, and as a JSON array otherwise.
+func (s *Stmt) makeVectorParam(v Vector) (res param, err error) {
+	if len(v.Data) == 0 {
+		return res, errors.New("mssql: a vector needs at least one element")
+	}
+	if v.ElementType != VectorFloat32 && v.ElementType != VectorFloat16 {
+		return res, fmt.Errorf("mssql: unsupported vector element type %d", uint8(v.ElementType))
+	}
+	if !s.c.vectorSupport(v.ElementType) {
+		return s.makeParam(v.String())
+	}
+	res.ti.TypeId = typeVector
+	res.ti.Scale = uint8(v.ElementType)
+	res.buffer = v.encode()
+	res.ti.Size = len(res.buffer)
+	return
+}
+
+// vectorSupport reports whether vectors of element type t can be sent in
+// the binary vector format on this connection.
+func (c *Conn) vectorSupport(t VectorElementType) bool {
+	if c == nil || c.sess == nil {
+		return false
+	}
+	switch t {
+	case VectorFloat32:
+		return c.sess.vectorVersion >= 1
+	case VectorFloat16:
+		return c.sess.vectorVersion >= 2
+	}
+	return false
+}
+
+// float32ToFloat16 converts f to the nearest IEEE 754 half precision
+// value, rounding ties to even.
+func float32ToFloat16(f float32) uint16 {
+	bits := math.Float32bits(f)
+	sign := uint16(bits>>16) & 0x8000
+	exp := int32(bits>>23) & 0xff
+	mant := bits & 0x7fffff
+	switch {
+	case exp == 0xff:
+		// infinity or NaN
+		if mant != 0 {
+			return sign | 0x7e00
+		}
+		return sign | 0x7c00
+	case exp-127 > 15:
+		return sign | 0x7c00
+	case exp-127 >= -14:
+		h := uint32(exp-127+15)<<10 | mant>>13
+		// round to nearest even, possibly carrying into the exponent
+		rem := mant & 0x1fff
+		if rem > 0x1000 || (rem == 0x1000 && h&1 != 0) {
+			h++
+		}
+		return sign | uint16(h)
+	case exp-127 >= -25:
+		// subnormal half precision value
+		mant |= 0x800000
+		shift := uint32(-14-(exp-127)) + 13
+		h := mant >> shift
+		rem := mant & (1<<shift - 1)
+		half := uint32(1) << (shift - 1)
+		if rem > half || (rem == half && h&1 != 0) {
+			h++
+		}
+		return sign | uint16(h)
+	default:
+		return sign
+	}
+}
+
+// float16ToFloat32 converts an IEEE 754 half precision value to float32.
+func float16ToFloat32(h uint16) float32 {
+	sign := uint32(h&0x8000) << 16
+	exp := uint32(h>>10) & 0x1f
+	mant := uint32(h & 0x3ff)
+	switch {
+	case exp == 0x1f:
+		return math.Float32frombits(sign | 0x7f800000 | mant<<13)
+	case exp != 0:
+		return math.Float32frombits(sign | (exp+127-15)<<23 | mant<<13)
+	case mant == 0:
+		return math.Float32frombits(sign)
+	default:
+		// subnormal, normalized for float32
+		exp = 127 - 14
+		for mant&0x400 == 0 {
+			mant <<= 1
+			exp--
+		}
+		return math.Float32frombits(sign | exp<<23 | (mant&0x3ff)<<13)
+	}
+}
@@ -0,0 +1,220 @@
+package mssql
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
+	"sync"
+	"time"
+)
+
+// VectorRow is a row inserted by VectorCopyIn, the key of the row and its
+// vector.
+type VectorRow struct {
+	Key    interface{}
+	Vector []float32
+}
+
+// VectorCopyOptions configures VectorCopyIn.
+type VectorCopyOptions struct {
+	// KeyColumn and VectorColumn are the columns the key and the vector of
+	// each row are inserted into.
+	KeyColumn    string
+	VectorColumn string
+	// BatchSize is the number of rows of each bulk copy, 1000 by default.
+	BatchSize int
+	// FlushInterval, when positive, sends a partial batch once its first row
+	// has waited that long, so rows that arrive slowly are not held back.
+	FlushInterval time.Duration
+	// Parallelism is the number of bulk copies run at the same time, each on
+	// its own connection, 1 by default. Tablock in Options serializes them.
+	Parallelism int
+	// Options are the options of each bulk copy.
+	Options BulkOptions
+}
+
+const defaultVectorBatchSize = 1000
+
+// VectorCopyIn inserts the rows received from rows into table with bulk
+// copies of opts.BatchSize rows, until rows is closed. Each batch is
+// committed in its own transaction. On the first error the remaining rows
+// are not inserted: VectorCopyIn keeps receiving them and discards them, so
+// the sender does not block, and once rows is closed it returns the number
+// of rows of the batches committed so far along with the error. The caller
+// must close rows, and should stop sending rows when ctx is canceled.
+func VectorCopyIn(ctx context.Context, db *sql.DB, table string, rows <-chan VectorRow, opts VectorCopyOptions) (int64, error) {
+	if opts.KeyColumn == "" || opts.VectorColumn == "" {
+		return 0, errors.New("mssql: VectorCopyIn needs a key and a vector column")
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultVectorBatchSize
+	}
+	if opts.Parallelism <= 0 {
+		opts.Parallelism = 1
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu       sync.Mutex
+		total    int64
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	fail := func(err error) {
+		mu.Lock()
+		if firstErr == nil {
+			firstErr = err
+		}
+		mu.Unlock()
+		cancel()
+	}
+	batches := make(chan []VectorRow)
+	for i := 0; i < opts.Parallelism; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for batch := range batches {
+				n, err := copyVectorBatch(ctx, db, table, batch, opts)
+				if err != nil {
+					fail(err)
+					continue
+				}
+				mu.Lock()
+				total += n
+				mu.Unlock()
+			}
+		}()
+	}
+	if err := batchVectorRows(ctx, rows, opts.BatchSize, opts.FlushInterval, batches); err != nil {
+		fail(err)
+		// discard the rows left so the sender is not blocked
+		for range rows {
+		}
+	}
+	close(batches)
+	wg.Wait()
+	return total, firstErr
+}
+
+// VectorCopyInFunc is VectorCopyIn for rows returned by next, until next
+// returns io.EOF.
+func VectorCopyInFunc(ctx context.Context, db *sql.DB, table string, next func() (VectorRow, error), opts VectorCopyOptions) (int64, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	rows := make(chan VectorRow)
+	var nextErr error
+	go func() {
+		defer close(rows)
+		for {
+			row, err := next()
+			if err != nil {
+				if err != io.EOF {
+					nextErr = err
+				}
+				return
+			}
+			select {
+			case rows <- row:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	n, err := VectorCopyIn(ctx, db, table, rows, opts)
+	cancel()
+	// wait for the producer so nextErr can be read
+	for range rows {
+	}
+	if err == nil {
+		err = nextErr
+	}
+	return n, err
+}
+
+// batchVectorRows groups the rows received from rows into batches of size
+// rows sent to out. A partial batch is sent when rows is closed, or when
+// interval is positive and its first row arrived interval ago.
+func batchVectorRows(ctx context.Context, rows <-chan VectorRow, size int, interval time.Duration, out chan<- []VectorRow) error {
+	var (
+		batch []VectorRow
+		timer *time.Timer
+		flush <-chan time.Time
+	)
+	send := func() error {
+		if timer != nil {
+			timer.Stop()
+			timer, flush = nil, nil
+		}
+		select {
+		case out <- batch:
+			batch = nil
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	for {
+		select {
+		case row, ok := <-rows:
+			if !ok {
+				if len(batch) > 0 {
+					return send()
+				}
+				return nil
+			}
+			if batch == nil {
+				batch = make([]VectorRow, 0, size)
+				if interval > 0 {
+					timer = time.NewTimer(interval)
+					flush = timer.C
+				}
+			}
+			batch = append(batch, row)
+			if len(batch) == size {
+				if err := send(); err != nil {
+					return err
+				}
+			}
+		case <-flush:
+			timer, flush = nil, nil
+			if err := send(); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// copyVectorBatch inserts batch with a bulk copy in a transaction.
+func copyVectorBatch(ctx context.Context, db *sql.DB, table string, batch []VectorRow, opts VectorCopyOptions) (n int64, err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+		}
+	}()
+	stmt, err := tx.PrepareContext(ctx, CopyIn(table, opts.Options, opts.KeyColumn, opts.VectorColumn))
+	if err != nil {
+		return 0, err
+	}
+	defer stmt.Close()
+	for _, row := range batch {
+		if _, err = stmt.ExecContext(ctx, row.Key, Vector{Data: row.Vector}); err != nil {
+			return 0, err
+		}
+	}
+	res, err := stmt.ExecContext(ctx)
+	if err != nil {
+		return 0, err
+	}
+	if n, err = res.RowsAffected(); err != nil {
+		return 0, err
+	}
+	return n, tx.Commit()
+}
@@ -0,0 +1,171 @@
+package mssql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBatchVectorRows(t *testing.T) {
+	rows := make(chan VectorRow)
+	out := make(chan []VectorRow, 10)
+	go func() {
+		for i := 0; i < 5; i++ {
+			rows <- VectorRow{Key: i}
+		}
+		close(rows)
+	}()
+	if err := batchVectorRows(context.Background(), rows, 2, 0, out); err != nil {
+		t.Fatal(err)
+	}
+	close(out)
+	var sizes []int
+	for b := range out {
+		sizes = append(sizes, len(b))
+	}
+	if fmt.Sprint(sizes) != "[2 2 1]" {
+		t.Errorf("batch sizes %v, want [2 2 1]", sizes)
+	}
+}
+
+func TestBatchVectorRowsFlushInterval(t *testing.T) {
+	rows := make(chan VectorRow)
+	out := make(chan []VectorRow)
+	done := make(chan error)
+	go func() {
+		done <- batchVectorRows(context.Background(), rows, 100, 10*time.Millisecond, out)
+	}()
+	rows <- VectorRow{Key: 1}
+	select {
+	case b := <-out:
+		if len(b) != 1 {
+			t.Errorf("flushed batch has %d rows", len(b))
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("partial batch was not flushed")
+	}
+	close(rows)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBatchVectorRowsCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := batchVectorRows(ctx, make(chan VectorRow), 10, 0, make(chan []VectorRow))
+	if err != context.Canceled {
+		t.Errorf("got %v, want context.Canceled", err)
+	}
+}
+
+func TestVectorCopyIn(t *testing.T) {
+	conn, logger := open(t)
+	defer conn.Close()
+	defer logger.StopLogging()
+
+	ctx := context.Background()
+	table := "vector_copy_test"
+	_, err := conn.ExecContext(ctx, "create table "+table+" (id int primary key, embedding vector(3))")
+	if err != nil {
+		if strings.Contains(err.Error(), "vector") {
+			t.Skip("vector type is not supported by the server:", err)
+		}
+		t.Fatal(err)
+	}
+	defer conn.ExecContext(ctx, "drop table "+table)
+
+	i := 0
+	next := func() (VectorRow, error) {
+		if i == 25 {
+			return VectorRow{}, io.EOF
+		}
+		i++
+		return VectorRow{Key: i, Vector: []float32{float32(i), 0, 1}}, nil
+	}
+	n, err := VectorCopyInFunc(ctx, conn, table, next, VectorCopyOptions{
+		KeyColumn:    "id",
+		VectorColumn: "embedding",
+		BatchSize:    10,
+		Parallelism:  2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 25 {
+		t.Errorf("inserted %d rows, want 25", n)
+	}
+	var v Vector
+	if err = conn.QueryRowContext(ctx, "select embedding from "+table+" where id = 7").Scan(&v); err != nil {
+		t.Fatal(err)
+	}
+	if v.String() != "[7,0,1]" {
+		t.Errorf("got %v", v)
+	}
+}
+
+func TestBulkVectorParam(t *testing.T) {
+	b := &Bulk{}
+	col := columnStruct{ti: typeInfo{TypeId: typeVector, Size: 20}}
+	p, err := b.makeParam([]float32{1, 2, 3}, col)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ti.Size != 20 || p.buffer[0] != vectorLayoutFormat {
+		t.Errorf("unexpected parameter %+v %x", p.ti, p.buffer)
+	}
+	if _, err = b.makeParam(Vector{Data: []float32{1, 2}}, col); err == nil {
+		t.Error("a vector with the wrong number of dimensions should fail")
+	}
+	col = columnStruct{ti: typeInfo{TypeId: typeBigVarChar, Size: 0xffff}}
+	if p, err = b.makeParam(Vector{Data: []float32{1, 2}}, col); err != nil || string(p.buffer) != "[1,2]" {
+		t.Errorf("vector for a text column got %q, %v", p.buffer, err)
+	}
+}
+
+type failingConnector struct{ err error }
+
+func (c failingConnector) Connect(context.Context) (driver.Conn, error) { return nil, c.err }
+func (c failingConnector) Driver() driver.Driver                        { return &Driver{} }
+
+func TestVectorCopyInDrainsRowsOnError(t *testing.T) {
+	connErr := errors.New("no connection")
+	db := sql.OpenDB(failingConnector{err: connErr})
+	defer db.Close()
+	rows := make(chan VectorRow)
+	sent := make(chan int)
+	go func() {
+		defer close(rows)
+		n := 0
+		for ; n < 100; n++ {
+			rows <- VectorRow{Key: n, Vector: []float32{1}}
+		}
+		sent <- n
+	}()
+	done := make(chan error)
+	go func() {
+		_, err := VectorCopyIn(context.Background(), db, "t", rows, VectorCopyOptions{
+			KeyColumn:    "id",
+			VectorColumn: "v",
+			BatchSize:    2,
+		})
+		done <- err
+	}()
+	select {
+	case n := <-sent:
+		if n != 100 {
+			t.Errorf("sent %d rows", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("the sender is blocked after the bulk copy failed")
+	}
+	if err := <-done; !errors.Is(err, connErr) {
+		t.Errorf("got %v, want %v", err, connErr)
+	}
+}
@@ -0,0 +1,236 @@
+package mssql
+
+import (
+	"bytes"
+	"context"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestFloat16Conversion(t *testing.T) {
+	tests := []struct {
+		f float32
+		h uint16
+	}{
+		{0, 0x0000},
+		{float32(math.Copysign(0, -1)), 0x8000},
+		{1, 0x3c00},
+		{-2, 0xc000},
+		{0.5, 0x3800},
+		{65504, 0x7bff},
+		{float32(math.Inf(1)), 0x7c00},
+		{float32(math.Inf(-1)), 0xfc00},
+		// smallest normal and subnormal values
+		{6.103515625e-05, 0x0400},
+		{5.960464477539063e-08, 0x0001},
+	}
+	for _, tst := range tests {
+		if got := float32ToFloat16(tst.f); got != tst.h {
+			t.Errorf("float32ToFloat16(%v) = %#04x, want %#04x", tst.f, got, tst.h)
+		}
+		if got := float16ToFloat32(tst.h); math.Float32bits(got) != math.Float32bits(tst.f) {
+			t.Errorf("float16ToFloat32(%#04x) = %v, want %v", tst.h, got, tst.f)
+		}
+	}
+	// rounding to nearest, ties to even
+	rounding := []struct {
+		f float32
+		h uint16
+	}{
+		{1 + 1.0/2048, 0x3c00},
+		{1 + 3.0/2048, 0x3c02},
+		{1 + 1.0/1024 + 1.0/4096, 0x3c01},
+		{65520, 0x7c00},
+		{1e-8, 0x0000},
+	}
+	for _, tst := range rounding {
+		if got := float32ToFloat16(tst.f); got != tst.h {
+			t.Errorf("float32ToFloat16(%v) = %#04x, want %#04x", tst.f, got, tst.h)
+		}
+	}
+	if h := float32ToFloat16(float32(math.NaN())); h&0x7c00 != 0x7c00 || h&0x3ff == 0 {
+		t.Errorf("NaN converted to %#04x", h)
+	}
+}
+
+func TestVectorEncoding(t *testing.T) {
+	v := Vector{Data: []float32{1, -2, 0.5}}
+	want := []byte{0xa9, 0x01, 3, 0, 0, 0, 0, 0,
+		0x00, 0x00, 0x80, 0x3f,
+		0x00, 0x00, 0x00, 0xc0,
+		0x00, 0x00, 0x00, 0x3f}
+	b := v.encode()
+	if !bytes.Equal(b, want) {
+		t.Errorf("float32 encoding got %x, want %x", b, want)
+	}
+	var back Vector
+	if err := back.Scan(b); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(back, v) {
+		t.Errorf("float32 decoding got %+v", back)
+	}
+
+	v.ElementType = VectorFloat16
+	want = []byte{0xa9, 0x01, 3, 0, 1, 0, 0, 0, 0x00, 0x3c, 0x00, 0xc0, 0x00, 0x38}
+	b = v.encode()
+	if !bytes.Equal(b, want) {
+		t.Errorf("float16 encoding got %x, want %x", b, want)
+	}
+	back = Vector{}
+	if err := back.Scan(b); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(back, v) {
+		t.Errorf("float16 decoding got %+v", back)
+	}
+
+	for _, bad := range [][]byte{
+		{0xa9, 0x01, 3, 0},
+		{0xa9, 0x02, 1, 0, 0, 0, 0, 0, 0, 0, 0x80, 0x3f},
+		{0xa9, 0x01, 2, 0, 0, 0, 0, 0, 0, 0, 0x80, 0x3f},
+		{0xa9, 0x01, 1, 0, 7, 0, 0, 0, 0, 0, 0x80, 0x3f},
+	} {
+		if err := back.Scan(bad); err == nil {
+			t.Errorf("scanning %x should fail", bad)
+		}
+	}
+}
+
+func TestVectorJSON(t *testing.T) {
+	v := Vector{Data: []float32{1, -2.5, 0.1, 1e20}}
+	if s := v.String(); s != "[1,-2.5,0.1,1e+20]" {
+		t.Errorf("String() = %q", s)
+	}
+	var back Vector
+	if err := back.Scan(v.String()); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(back, v) {
+		t.Errorf("JSON round trip got %+v", back)
+	}
+	if err := back.Scan([]byte("[3, 4]")); err != nil || !reflect.DeepEqual(back.Data, []float32{3, 4}) {
+		t.Errorf("scanning JSON bytes got %+v, %v", back, err)
+	}
+	for _, bad := range []interface{}{"null", "[1,", `["a"]`, 42} {
+		if err := back.Scan(bad); err == nil {
+			t.Errorf("scanning %v should fail", bad)
+		}
+	}
+
+	var n NullVector
+	if err := n.Scan("[1]"); err != nil || !n.Valid {
+		t.Errorf("got %+v, %v", n, err)
+	}
+	if err := n.Scan(nil); err != nil || n.Valid {
+		t.Errorf("NULL should scan into an invalid NullVector, got %+v, %v", n, err)
+	}
+}
+
+func TestMakeVectorParam(t *testing.T) {
+	v := Vector{Data: []float32{1, 2}}
+	s := &Stmt{}
+	p, err := s.makeParam(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ti.TypeId != typeNVarChar || !bytes.Equal(p.buffer, str2ucs2("[1,2]")) {
+		t.Errorf("without vector support the vector should be sent as JSON, got %+v", p.ti)
+	}
+
+	s.c = &Conn{sess: &tdsSession{vectorVersion: 1}}
+	p, err = s.makeParam(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ti.TypeId != typeVector || p.ti.Size != 16 || makeDecl(p.ti) != "vector(2)" {
+		t.Errorf("unexpected type info %+v", p.ti)
+	}
+	var buf bytes.Buffer
+	if err = writeVarLen(&buf, &p.ti, false); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), []byte{16, 0, 0}) {
+		t.Errorf("unexpected type info bytes %v", buf.Bytes())
+	}
+
+	v.ElementType = VectorFloat16
+	if p, _ = s.makeParam(v); p.ti.TypeId != typeNVarChar {
+		t.Errorf("float16 needs version 2 of vector support, got %+v", p.ti)
+	}
+	s.c.sess.vectorVersion = 2
+	if p, _ = s.makeParam(v); p.ti.TypeId != typeVector || makeDecl(p.ti) != "vector(2, float16)" {
+		t.Errorf("unexpected float16 type info %+v", p.ti)
+	}
+
+	if p, _ = s.makeParam(NullVector{}); p.ti.TypeId != typeNull {
+		t.Errorf("NULL vector should be sent as NULL, got %+v", p.ti)
+	}
+	if _, err = s.makeParam(Vector{}); err == nil {
+		t.Error("an empty vector should fail")
+	}
+}
+
+func TestReadVectorColumn(t *testing.T) {
+	v := Vector{Data: []float32{1, 2}}
+	data := append([]byte{typeVector, 16, 0, 0}, 16, 0)
+	data = append(data, v.encode()...)
+	r := &tdsBuffer{packetSize: len(data), rbuf: data, rsize: len(data)}
+	ti := readTypeInfo(r, r.byte(), nil)
+	if ti.Size != 16 || vectorDimensions(ti) != 2 {
+		t.Errorf("unexpected type info %+v", ti)
+	}
+	got := ti.Reader(&ti, r, nil)
+	if !reflect.DeepEqual(got, v) {
+		t.Errorf("got %#v, want %#v", got, v)
+	}
+}
+
+func TestVectorParameter(t *testing.T) {
+	conn, logger := open(t)
+	defer conn.Close()
+	defer logger.StopLogging()
+
+	v := Vector{Data: []float32{1, 2, 3}}
+	var got Vector
+	err := conn.QueryRowContext(context.Background(), "select cast(@p1 as vector(3))", v).Scan(&got)
+	if err != nil {
+		if strings.Contains(err.Error(), "vector") {
+			t.Skip("vector type is not supported by the server:", err)
+		}
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got.Data, v.Data) {
+		t.Errorf("got %v, want %v", got, v)
+	}
+}
+
+func TestVectorColumnType(t *testing.T) {
+	cols := []columnStruct{
+		{ti: typeInfo{TypeId: typeVector, Size: 8 + 2*1536, Scale: uint8(VectorFloat16)}},
+		{ti: typeInfo{TypeId: typeNVarChar, Size: 0xffff}},
+	}
+	var r RowsColumnTypeVectorElementType = &Rows{cols: cols}
+	rows := r.(*Rows)
+	if name := rows.ColumnTypeDatabaseTypeName(0); name != "VECTOR" {
+		t.Errorf("DatabaseTypeName = %q", name)
+	}
+	if n, ok := rows.ColumnTypeLength(0); n != 1536 || !ok {
+		t.Errorf("Length = %d, %v", n, ok)
+	}
+	if _, _, ok := rows.ColumnTypePrecisionScale(0); ok {
+		t.Error("vectors have no precision and scale")
+	}
+	if et, ok := r.ColumnTypeVectorElementType(0); et != VectorFloat16 || !ok {
+		t.Errorf("ColumnTypeVectorElementType = %v, %v", et, ok)
+	}
+	if _, ok := r.ColumnTypeVectorElementType(1); ok {
+		t.Error("an nvarchar column has no vector element type")
+	}
+	var rq RowsColumnTypeVectorElementType = &Rowsq{cols: cols}
+	if et, ok := rq.ColumnTypeVectorElementType(0); et != VectorFloat16 || !ok {
+		t.Errorf("Rowsq ColumnTypeVectorElementType = %v, %v", et, ok)
+	}
+}
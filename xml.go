@@ -0,0 +1,59 @@
+package mssql
+
+import (
+	"database/sql/driver"
+	"fmt"
+)
+
+// XML is an xml value. As a parameter it is declared as xml instead of
+// nvarchar, so XQuery methods can be called on it and it can be assigned
+// to typed xml columns directly. xml columns and output parameters scan
+// into it.
+type XML string
+
+// NullXML represents an XML that may be null.
+// NullXML implements the Scanner interface so
+// it can be used as a scan destination, similar to sql.NullString.
+type NullXML struct {
+	XML   XML
+	Valid bool // Valid is true if XML is not NULL
+}
+
+// Scan implements the sql.Scanner interface.
+func (x *XML) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case string:
+		*x = XML(v)
+	case []byte:
+		*x = XML(v)
+	default:
+		return fmt.Errorf("mssql: cannot scan %T into XML", src)
+	}
+	return nil
+}
+
+// Scan implements the sql.Scanner interface.
+func (n *NullXML) Scan(src interface{}) error {
+	if src == nil {
+		n.XML, n.Valid = "", false
+		return nil
+	}
+	n.Valid = true
+	return n.XML.Scan(src)
+}
+
+// Value implements the driver.Valuer interface.
+func (n NullXML) Value() (driver.Value, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	return string(n.XML), nil
+}
+
+// makeXMLParam encodes x as an xml parameter. xml is always sent in
+// chunks, in UTF-16 like nvarchar.
+func makeXMLParam(x XML) (res param) {
+	res.ti.TypeId = typeXml
+	res.buffer = str2ucs2(string(x))
+	return
+}
@@ -0,0 +1,91 @@
+package mssql
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"testing"
+)
+
+func TestMakeXMLParam(t *testing.T) {
+	s := &Stmt{}
+	p, err := s.makeParam(XML(`<a b="1"/>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ti.TypeId != typeXml || makeDecl(p.ti) != "xml" {
+		t.Errorf("unexpected type info %+v", p.ti)
+	}
+	if !bytes.Equal(p.buffer, str2ucs2(`<a b="1"/>`)) {
+		t.Errorf("xml should be sent as UTF-16, got %v", p.buffer)
+	}
+	var buf bytes.Buffer
+	if err = writeVarLen(&buf, &p.ti, false); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), []byte{0xff, 0xff, 0}) {
+		t.Errorf("unexpected type info bytes %v", buf.Bytes())
+	}
+
+	p, err = s.makeParam(NullXML{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ti.TypeId != typeXml || p.buffer != nil {
+		t.Errorf("NULL xml should be sent as a NULL xml, got %+v %v", p.ti, p.buffer)
+	}
+	p, err = s.makeParam(NullXML{XML: "<a/>", Valid: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.ti.TypeId != typeXml || !bytes.Equal(p.buffer, str2ucs2("<a/>")) {
+		t.Errorf("unexpected parameter %+v %v", p.ti, p.buffer)
+	}
+}
+
+func TestNullXMLScan(t *testing.T) {
+	var n NullXML
+	if err := n.Scan("<a/>"); err != nil {
+		t.Fatal(err)
+	}
+	if !n.Valid || n.XML != "<a/>" {
+		t.Errorf("got %+v", n)
+	}
+	if err := n.Scan(nil); err != nil {
+		t.Fatal(err)
+	}
+	if n.Valid {
+		t.Error("NULL should scan into an invalid NullXML")
+	}
+	var x XML
+	if err := x.Scan(42); err == nil {
+		t.Error("scanning an int into XML should fail")
+	}
+}
+
+func TestXMLParameter(t *testing.T) {
+	conn, logger := open(t)
+	defer conn.Close()
+	defer logger.StopLogging()
+
+	var b int
+	var doc XML
+	var null NullXML
+	err := conn.QueryRowContext(context.Background(),
+		"select @p1.value('(/a/@b)[1]', 'int'), @p1, @p2", XML(`<a b="42"/>`), NullXML{}).Scan(&b, &doc, &null)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b != 42 || doc != `<a b="42"/>` || null.Valid {
+		t.Errorf("got %d, %q, %+v", b, doc, null)
+	}
+
+	var out XML = "<x/>"
+	_, err = conn.ExecContext(context.Background(), "set @out.modify('insert <y/> into (/x)[1]')", sql.Named("out", sql.Out{Dest: &out}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out != "<x><y/></x>" {
+		t.Errorf("output parameter got %q", out)
+	}
+}